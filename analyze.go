@@ -0,0 +1,157 @@
+package db
+
+import (
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	defaultAnalyzeSampleRate  = 1
+	defaultAnalyzeMaxDistinct = 1 << 20
+)
+
+// defaultAnalyzePrefixLens are the prefix lengths whose cardinality AnalyzeKeys counts if none
+// are given.
+var defaultAnalyzePrefixLens = []int{1, 2, 4, 8, 16, 32}
+
+// AnalyzeConfig configures AnalyzeKeys. Zero values are replaced by defaults.
+type AnalyzeConfig struct {
+	// SampleRate is the fraction of keys analyzed, between 0 and 1. Defaults to 1, i.e. all keys.
+	// All keys are still iterated over, but sampling bounds the memory used for prefixes.
+	SampleRate float64
+	// PrefixLens are the prefix lengths whose number of distinct prefixes is counted. Defaults to
+	// 1, 2, 4, 8, 16 and 32 bytes.
+	PrefixLens []int
+	// MaxDistinct is the number of distinct prefixes counted per prefix length, bounding the
+	// memory used. Defaults to 2^20.
+	MaxDistinct int
+}
+
+// KeyAnalysis describes the distribution of the keys of a database, as returned by AnalyzeKeys.
+type KeyAnalysis struct {
+	// Keys is the number of keys analyzed, i.e. about SampleRate times the number of keys.
+	Keys       uint64              `json:"keys"`
+	SampleRate float64             `json:"sample_rate"`
+	KeySizes   SizeHistogram       `json:"key_sizes"`
+	ValueSizes SizeHistogram       `json:"value_sizes"`
+	Prefixes   []PrefixCardinality `json:"prefixes"`
+}
+
+// PrefixCardinality is the number of distinct prefixes of a length among the keys analyzed. Keys
+// shorter than the length are counted as their own prefix.
+type PrefixCardinality struct {
+	Len      int    `json:"len"`
+	Distinct uint64 `json:"distinct"`
+	// Truncated is set if MaxDistinct was reached, in which case Distinct is a lower bound.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// SizeHistogram is a histogram of sizes in bytes, with power of two buckets.
+type SizeHistogram struct {
+	Count uint64 `json:"count"`
+	Sum   uint64 `json:"sum"`
+	Max   uint64 `json:"max"`
+	// Buckets holds the non-empty buckets in increasing order of sizes.
+	Buckets []SizeBucket `json:"buckets"`
+}
+
+// SizeBucket is a bucket of a SizeHistogram, counting the sizes in [Min, Max].
+type SizeBucket struct {
+	Min   uint64 `json:"min"`
+	Max   uint64 `json:"max"`
+	Count uint64 `json:"count"`
+}
+
+// Mean returns the mean size, or 0 if the histogram is empty.
+func (h *SizeHistogram) Mean() uint64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / h.Count
+}
+
+// observe adds a size to the histogram. Sizes with the same bit length share a bucket, i.e. 0,
+// 1, 2-3, 4-7 and so on.
+func (h *SizeHistogram) observe(size int) {
+	h.Count++
+	h.Sum += uint64(size)
+	h.Max = max(h.Max, uint64(size))
+	b := bits.Len(uint(size))
+	for len(h.Buckets) <= b {
+		i := len(h.Buckets)
+		bucket := SizeBucket{}
+		if i > 0 {
+			bucket.Min, bucket.Max = 1<<(i-1), 1<<i-1
+		}
+		h.Buckets = append(h.Buckets, bucket)
+	}
+	h.Buckets[b].Count++
+}
+
+// compact removes the empty buckets.
+func (h *SizeHistogram) compact() {
+	buckets := h.Buckets[:0]
+	for _, bucket := range h.Buckets {
+		if bucket.Count > 0 {
+			buckets = append(buckets, bucket)
+		}
+	}
+	h.Buckets = buckets
+}
+
+// AnalyzeKeys iterates over db and samples its keys to return histograms of key and value sizes
+// and the number of distinct key prefixes of several lengths, e.g. to size bloom filters, whose
+// memory grows with the number of keys or prefixes they index, and caches. For the access
+// frequency of keys at runtime, see SamplingStatsDBConfig.HotKeys.
+func AnalyzeKeys(db DBReader, cfg AnalyzeConfig) (*KeyAnalysis, error) {
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaultAnalyzeSampleRate
+	}
+	if len(cfg.PrefixLens) == 0 {
+		cfg.PrefixLens = defaultAnalyzePrefixLens
+	}
+	if cfg.MaxDistinct <= 0 {
+		cfg.MaxDistinct = defaultAnalyzeMaxDistinct
+	}
+	analysis := &KeyAnalysis{SampleRate: cfg.SampleRate}
+	prefixes := make([]map[string]struct{}, len(cfg.PrefixLens))
+	for i, n := range cfg.PrefixLens {
+		prefixes[i] = make(map[string]struct{})
+		analysis.Prefixes = append(analysis.Prefixes, PrefixCardinality{Len: n})
+	}
+
+	itr, err := db.Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		if cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate {
+			continue
+		}
+		key := UnsafeKey(itr)
+		analysis.Keys++
+		analysis.KeySizes.observe(len(key))
+		analysis.ValueSizes.observe(len(UnsafeValue(itr)))
+		for i, n := range cfg.PrefixLens {
+			prefix := key[:min(n, len(key))]
+			if _, ok := prefixes[i][string(prefix)]; ok {
+				continue
+			}
+			if len(prefixes[i]) >= cfg.MaxDistinct {
+				analysis.Prefixes[i].Truncated = true
+				continue
+			}
+			prefixes[i][string(prefix)] = struct{}{}
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return nil, err
+	}
+	for i := range analysis.Prefixes {
+		analysis.Prefixes[i].Distinct = uint64(len(prefixes[i]))
+	}
+	analysis.KeySizes.compact()
+	analysis.ValueSizes.compact()
+	return analysis, nil
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeKeys(t *testing.T) {
+	db := NewMemDB()
+	require.NoError(t, db.Set(bz("H:1"), bz("")))
+	require.NoError(t, db.Set(bz("H:2"), make([]byte, 5)))
+	require.NoError(t, db.Set(bz("P:1"), make([]byte, 100)))
+	require.NoError(t, db.Set(bz("x"), bz("y")))
+
+	analysis, err := AnalyzeKeys(db, AnalyzeConfig{PrefixLens: []int{1, 2, 3}, MaxDistinct: 3})
+	require.NoError(t, err)
+	require.EqualValues(t, 4, analysis.Keys)
+	require.Equal(t, SizeHistogram{Count: 4, Sum: 10, Max: 3, Buckets: []SizeBucket{
+		{Min: 1, Max: 1, Count: 1},
+		{Min: 2, Max: 3, Count: 3},
+	}}, analysis.KeySizes)
+	require.Equal(t, []SizeBucket{
+		{Min: 0, Max: 0, Count: 1},
+		{Min: 1, Max: 1, Count: 1},
+		{Min: 4, Max: 7, Count: 1},
+		{Min: 64, Max: 127, Count: 1},
+	}, analysis.ValueSizes.Buckets)
+	require.EqualValues(t, 26, analysis.ValueSizes.Mean())
+	require.Equal(t, []PrefixCardinality{
+		{Len: 1, Distinct: 3},
+		{Len: 2, Distinct: 3},
+		{Len: 3, Distinct: 3, Truncated: true},
+	}, analysis.Prefixes)
+
+	analysis, err = AnalyzeKeys(NewMemDB(), AnalyzeConfig{})
+	require.NoError(t, err)
+	require.Zero(t, analysis.Keys)
+	require.Empty(t, analysis.KeySizes.Buckets)
+	require.Len(t, analysis.Prefixes, len(defaultAnalyzePrefixLens))
+}
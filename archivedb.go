@@ -0,0 +1,469 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrArchivedKey is returned when writing a key within an archived range.
+var ErrArchivedKey = errors.New("key is within an archived range")
+
+// ArchiveDB stores recent data in a local hot database, and archives immutable key ranges as
+// sorted, indexed segments in an ObjectStore, e.g. to keep old blocks of an archive node in
+// object storage. Reads see both the hot and the archived data, with the segments downloaded to a
+// local cache directory on first access.
+//
+// Archived ranges are immutable: writing or deleting keys between the first and last key of a
+// segment fails with ErrArchivedKey. Writes outside of the archived ranges land in the hot
+// database, which is typically used for keys growing over time, such as heights.
+type ArchiveDB struct {
+	mtx      sync.RWMutex
+	hot      DB
+	store    ObjectStore
+	cacheDir string
+	segments []*archiveSegment // sorted by key, non-overlapping
+	nextSeq  uint64
+}
+
+var _ DB = (*ArchiveDB)(nil)
+
+// NewArchiveDB opens an archive database over the hot database and the segments already in the
+// store, downloading their indexes to cacheDir if needed.
+func NewArchiveDB(hot DB, store ObjectStore, cacheDir string) (*ArchiveDB, error) {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+	adb := &ArchiveDB{
+		hot:      hot,
+		store:    store,
+		cacheDir: cacheDir,
+	}
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range names {
+		// Indexes are uploaded after their data, so segments without an index are incomplete
+		// uploads and are ignored.
+		name, ok := strings.CutSuffix(object, archiveIndexSuffix)
+		if !ok {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := adb.loadSegment(name)
+		if err != nil {
+			return nil, err
+		}
+		adb.segments = append(adb.segments, seg)
+		adb.nextSeq = max(adb.nextSeq, seq+1)
+	}
+	sort.Slice(adb.segments, func(i, j int) bool {
+		return bytes.Compare(adb.segments[i].firstKey(), adb.segments[j].firstKey()) < 0
+	})
+	for i := 1; i < len(adb.segments); i++ {
+		if bytes.Compare(adb.segments[i].firstKey(), adb.segments[i-1].lastKey) <= 0 {
+			return nil, fmt.Errorf("archive segments %s and %s overlap", adb.segments[i-1].name, adb.segments[i].name)
+		}
+	}
+	return adb, nil
+}
+
+// loadSegment loads the index of a segment, from the cache directory if present.
+func (adb *ArchiveDB) loadSegment(name string) (*archiveSegment, error) {
+	path := filepath.Join(adb.cacheDir, name+archiveIndexSuffix)
+	index, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		index, err = adb.store.Get(name + archiveIndexSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(path, index); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	seg, err := decodeArchiveSegment(name, index)
+	if err != nil {
+		return nil, err
+	}
+	seg.store = adb.store
+	seg.cacheDir = adb.cacheDir
+	return seg, nil
+}
+
+// segmentFor returns the segment whose range contains the key, or nil.
+// CONTRACT: adb.mtx must be held.
+func (adb *ArchiveDB) segmentFor(key []byte) *archiveSegment {
+	i := sort.Search(len(adb.segments), func(i int) bool {
+		return bytes.Compare(adb.segments[i].lastKey, key) >= 0
+	})
+	if i < len(adb.segments) && adb.segments[i].contains(key) {
+		return adb.segments[i]
+	}
+	return nil
+}
+
+// checkWritable returns ErrArchivedKey if the key is within an archived range.
+// CONTRACT: adb.mtx must be held.
+func (adb *ArchiveDB) checkWritable(key []byte) error {
+	if seg := adb.segmentFor(key); seg != nil {
+		return fmt.Errorf("%w: %X is archived in segment %s", ErrArchivedKey, key, seg.name)
+	}
+	return nil
+}
+
+// Archive moves the keys of the hot database within [start, end) into a new segment, and returns
+// the number of keys archived. The range must not overlap existing segments. Writes are blocked
+// while the range is archived, and the whole segment is held in memory, so ranges should be of
+// bounded size, e.g. a range of heights.
+func (adb *ArchiveDB) Archive(start, end []byte) (int, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+
+	var w archiveSegmentWriter
+	var keys [][]byte
+	itr, err := adb.hot.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+	for ; itr.Valid(); itr.Next() {
+		w.add(itr.Key(), itr.Value())
+		keys = append(keys, cp(itr.Key()))
+	}
+	if err := itr.Error(); err != nil {
+		itr.Close()
+		return 0, err
+	}
+	if err := itr.Close(); err != nil {
+		return 0, err
+	}
+	if w.count == 0 {
+		return 0, nil
+	}
+
+	first, last := keys[0], keys[len(keys)-1]
+	for _, seg := range adb.segments {
+		if seg.overlaps(first, cpIncr(last)) {
+			return 0, fmt.Errorf("range %X-%X overlaps archived segment %s", first, last, seg.name)
+		}
+	}
+
+	// The index is uploaded last, making the segment visible once complete.
+	name := fmt.Sprintf("%016x", adb.nextSeq)
+	data, index := w.finish()
+	if err := adb.store.Put(name+archiveDataSuffix, data); err != nil {
+		return 0, err
+	}
+	if err := adb.store.Put(name+archiveIndexSuffix, index); err != nil {
+		return 0, err
+	}
+	adb.nextSeq++
+	if err := writeFileAtomic(filepath.Join(adb.cacheDir, name+archiveDataSuffix), data); err != nil {
+		return 0, err
+	}
+	seg, err := adb.loadSegment(name)
+	if err != nil {
+		return 0, err
+	}
+	i := sort.Search(len(adb.segments), func(i int) bool {
+		return bytes.Compare(adb.segments[i].firstKey(), seg.firstKey()) > 0
+	})
+	adb.segments = append(adb.segments[:i], append([]*archiveSegment{seg}, adb.segments[i:]...)...)
+
+	// Reads prefer the hot database, so the archived keys remain consistent if deleting them fails
+	// or is interrupted.
+	batch := adb.hot.NewBatch()
+	defer batch.Close()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.WriteSync(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// Get implements DB.
+func (adb *ArchiveDB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	value, err := adb.hot.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	adb.mtx.RLock()
+	seg := adb.segmentFor(key)
+	adb.mtx.RUnlock()
+	if seg == nil {
+		return nil, nil
+	}
+	return seg.get(key)
+}
+
+// Has implements DB.
+func (adb *ArchiveDB) Has(key []byte) (bool, error) {
+	value, err := adb.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Set implements DB.
+func (adb *ArchiveDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	if err := adb.checkWritable(key); err != nil {
+		return err
+	}
+	return adb.hot.Set(key, value)
+}
+
+// SetSync implements DB.
+func (adb *ArchiveDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	if err := adb.checkWritable(key); err != nil {
+		return err
+	}
+	return adb.hot.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (adb *ArchiveDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	if err := adb.checkWritable(key); err != nil {
+		return err
+	}
+	return adb.hot.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (adb *ArchiveDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	if err := adb.checkWritable(key); err != nil {
+		return err
+	}
+	return adb.hot.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (adb *ArchiveDB) Iterator(start, end []byte) (Iterator, error) {
+	return adb.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (adb *ArchiveDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return adb.newIterator(start, end, true)
+}
+
+func (adb *ArchiveDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	// The lock prevents a range from being archived between creating the two iterators.
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	var hot Iterator
+	var err error
+	if isReverse {
+		hot, err = adb.hot.ReverseIterator(start, end)
+	} else {
+		hot, err = adb.hot.Iterator(start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newMergeIterator(start, end, isReverse, hot, newArchiveIterator(adb.segments, start, end, isReverse)), nil
+}
+
+// Close implements DB. It closes the hot database.
+func (adb *ArchiveDB) Close() error {
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+	for _, seg := range adb.segments {
+		if err := seg.close(); err != nil {
+			return err
+		}
+	}
+	return adb.hot.Close()
+}
+
+// NewBatch implements DB.
+func (adb *ArchiveDB) NewBatch() Batch {
+	return &archiveDBBatch{
+		adb:   adb,
+		batch: adb.hot.NewBatch(),
+		keys:  [][]byte{},
+	}
+}
+
+// Print implements DB.
+func (adb *ArchiveDB) Print() error {
+	itr, err := adb.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		key := itr.Key()
+		value := itr.Value()
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return nil
+}
+
+// Stats implements DB. It returns the stats of the hot database, and the number of archived
+// segments.
+func (adb *ArchiveDB) Stats() map[string]string {
+	stats := adb.hot.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	adb.mtx.RLock()
+	defer adb.mtx.RUnlock()
+	stats["archive.segments"] = strconv.Itoa(len(adb.segments))
+	return stats
+}
+
+// Compact implements DB. It compacts the hot database, archived segments are immutable.
+func (adb *ArchiveDB) Compact(start, end []byte) error {
+	return adb.hot.Compact(start, end)
+}
+
+// archiveDBBatch is a batch of the hot database, which checks that its keys are not archived when
+// written.
+type archiveDBBatch struct {
+	adb   *ArchiveDB
+	batch Batch
+	keys  [][]byte
+}
+
+var _ Batch = (*archiveDBBatch)(nil)
+
+// Set implements Batch.
+func (b *archiveDBBatch) Set(key, value []byte) error {
+	if b.keys == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+// Delete implements Batch.
+func (b *archiveDBBatch) Delete(key []byte) error {
+	if b.keys == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+// Count implements Batch.
+func (b *archiveDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *archiveDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *archiveDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *archiveDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *archiveDBBatch) write(sync bool) error {
+	if b.keys == nil {
+		return errBatchClosed
+	}
+	// The keys are checked while holding the lock, so that the range cannot be archived before the
+	// batch is written.
+	b.adb.mtx.RLock()
+	defer b.adb.mtx.RUnlock()
+	for _, key := range b.keys {
+		if err := b.adb.checkWritable(key); err != nil {
+			return err
+		}
+	}
+	var err error
+	if sync {
+		err = b.batch.WriteSync()
+	} else {
+		err = b.batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	// The written batch rejects further use, unless it is reset.
+	clear(b.keys)
+	b.keys = b.keys[:0]
+	return nil
+}
+
+// Reset implements Batch.
+func (b *archiveDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.keys)
+	b.keys = b.keys[:0]
+	return nil
+}
+
+// Close implements Batch.
+func (b *archiveDBBatch) Close() error {
+	b.keys = nil
+	return b.batch.Close()
+}
@@ -0,0 +1,454 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// An archive segment holds a sorted range of keys in two objects. The data object is a sequence
+// of blocks of entries, each encoded as uvarint length-prefixed key and value. The index object
+// lists the first key, offset, length and CRC32 checksum of every block, followed by the last key
+// of the segment, and ends with the CRC32 checksum of the index itself. Only the index is needed
+// to locate keys, so opening an archive only downloads indexes, and data objects are downloaded on
+// first access.
+const (
+	archiveSegmentVersion   = 1
+	archiveSegmentBlockSize = 64 << 10
+	archiveDataSuffix       = ".seg"
+	archiveIndexSuffix      = ".idx"
+)
+
+var errArchiveIndexCorrupted = errors.New("archive segment index corrupted")
+
+// archiveEntry is a key/value pair of a segment.
+type archiveEntry struct {
+	key   []byte
+	value []byte
+}
+
+// archiveBlock locates a block of a segment data object.
+type archiveBlock struct {
+	firstKey []byte
+	offset   uint64
+	length   uint64
+	checksum uint32
+}
+
+// archiveSegmentWriter encodes a segment from entries added in key order.
+type archiveSegmentWriter struct {
+	data    bytes.Buffer
+	block   bytes.Buffer
+	blocks  []archiveBlock
+	first   []byte // first key of the current block
+	lastKey []byte
+	count   int
+}
+
+// add appends an entry, whose key must sort after all previously added keys.
+func (w *archiveSegmentWriter) add(key, value []byte) {
+	if w.block.Len() == 0 {
+		w.first = cp(key)
+	}
+	w.block.Write(binary.AppendUvarint(nil, uint64(len(key))))
+	w.block.Write(key)
+	w.block.Write(binary.AppendUvarint(nil, uint64(len(value))))
+	w.block.Write(value)
+	w.lastKey = cp(key)
+	w.count++
+	if w.block.Len() >= archiveSegmentBlockSize {
+		w.flush()
+	}
+}
+
+// flush ends the current block.
+func (w *archiveSegmentWriter) flush() {
+	if w.block.Len() == 0 {
+		return
+	}
+	w.blocks = append(w.blocks, archiveBlock{
+		firstKey: w.first,
+		offset:   uint64(w.data.Len()),
+		length:   uint64(w.block.Len()),
+		checksum: crc32.ChecksumIEEE(w.block.Bytes()),
+	})
+	w.data.Write(w.block.Bytes())
+	w.block.Reset()
+}
+
+// finish returns the data and index objects of the segment.
+func (w *archiveSegmentWriter) finish() (data []byte, index []byte) {
+	w.flush()
+	index = []byte{archiveSegmentVersion}
+	index = binary.AppendUvarint(index, uint64(len(w.blocks)))
+	for _, block := range w.blocks {
+		index = binary.AppendUvarint(index, uint64(len(block.firstKey)))
+		index = append(index, block.firstKey...)
+		index = binary.AppendUvarint(index, block.offset)
+		index = binary.AppendUvarint(index, block.length)
+		index = binary.BigEndian.AppendUint32(index, block.checksum)
+	}
+	index = binary.AppendUvarint(index, uint64(len(w.lastKey)))
+	index = append(index, w.lastKey...)
+	index = binary.BigEndian.AppendUint32(index, crc32.ChecksumIEEE(index))
+	return w.data.Bytes(), index
+}
+
+// archiveSegment is an archived segment, whose data object is cached in a local file.
+type archiveSegment struct {
+	name     string
+	blocks   []archiveBlock
+	lastKey  []byte
+	store    ObjectStore
+	cacheDir string
+
+	mtx  sync.Mutex
+	file *os.File // nil until the data is first read
+}
+
+// decodeArchiveSegment decodes the index object of a segment.
+func decodeArchiveSegment(name string, index []byte) (*archiveSegment, error) {
+	if len(index) < 5 {
+		return nil, fmt.Errorf("%w: %s is too short", errArchiveIndexCorrupted, name)
+	}
+	body, checksum := index[:len(index)-4], binary.BigEndian.Uint32(index[len(index)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, fmt.Errorf("%w: %s checksum mismatch", errArchiveIndexCorrupted, name)
+	}
+	if body[0] != archiveSegmentVersion {
+		return nil, fmt.Errorf("%w: %s has unknown version %d", errArchiveIndexCorrupted, name, body[0])
+	}
+	r := bytes.NewReader(body[1:])
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return nil, fmt.Errorf("%w: %s", errArchiveIndexCorrupted, name)
+		}
+		bz := make([]byte, n)
+		_, err = io.ReadFull(r, bz)
+		return bz, err
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count == 0 || count > uint64(r.Len()) {
+		return nil, fmt.Errorf("%w: %s has invalid block count", errArchiveIndexCorrupted, name)
+	}
+	seg := &archiveSegment{name: name, blocks: make([]archiveBlock, count)}
+	for i := range seg.blocks {
+		block := &seg.blocks[i]
+		if block.firstKey, err = readBytes(); err != nil {
+			return nil, err
+		}
+		if block.offset, err = binary.ReadUvarint(r); err != nil {
+			return nil, fmt.Errorf("%w: %s", errArchiveIndexCorrupted, name)
+		}
+		if block.length, err = binary.ReadUvarint(r); err != nil {
+			return nil, fmt.Errorf("%w: %s", errArchiveIndexCorrupted, name)
+		}
+		var checksum [4]byte
+		if _, err := io.ReadFull(r, checksum[:]); err != nil {
+			return nil, fmt.Errorf("%w: %s", errArchiveIndexCorrupted, name)
+		}
+		block.checksum = binary.BigEndian.Uint32(checksum[:])
+	}
+	if seg.lastKey, err = readBytes(); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// firstKey returns the first key of the segment.
+func (seg *archiveSegment) firstKey() []byte {
+	return seg.blocks[0].firstKey
+}
+
+// size returns the size of the data object.
+func (seg *archiveSegment) size() uint64 {
+	last := seg.blocks[len(seg.blocks)-1]
+	return last.offset + last.length
+}
+
+// contains returns whether the key is within the range of the segment.
+func (seg *archiveSegment) contains(key []byte) bool {
+	return bytes.Compare(key, seg.firstKey()) >= 0 && bytes.Compare(key, seg.lastKey) <= 0
+}
+
+// overlaps returns whether the segment contains keys within [start, end).
+func (seg *archiveSegment) overlaps(start, end []byte) bool {
+	return (end == nil || bytes.Compare(seg.firstKey(), end) < 0) &&
+		(start == nil || bytes.Compare(seg.lastKey, start) >= 0)
+}
+
+// open returns the cached data file, downloading the data object if it is not cached yet.
+func (seg *archiveSegment) open() (*os.File, error) {
+	seg.mtx.Lock()
+	defer seg.mtx.Unlock()
+
+	if seg.file != nil {
+		return seg.file, nil
+	}
+	path := filepath.Join(seg.cacheDir, seg.name+archiveDataSuffix)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		var data []byte
+		data, err = seg.store.Get(seg.name + archiveDataSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(data)) != seg.size() {
+			return nil, fmt.Errorf("archive segment %s has %d bytes, expected %d", seg.name, len(data), seg.size())
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return nil, err
+		}
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seg.file = file
+	return file, nil
+}
+
+// close closes the cached data file, if open.
+func (seg *archiveSegment) close() error {
+	seg.mtx.Lock()
+	defer seg.mtx.Unlock()
+
+	if seg.file == nil {
+		return nil
+	}
+	err := seg.file.Close()
+	seg.file = nil
+	return err
+}
+
+// readBlock reads and verifies the entries of a block.
+func (seg *archiveSegment) readBlock(i int) ([]archiveEntry, error) {
+	file, err := seg.open()
+	if err != nil {
+		return nil, err
+	}
+	block := seg.blocks[i]
+	buf := make([]byte, block.length)
+	if _, err := file.ReadAt(buf, int64(block.offset)); err != nil {
+		return nil, fmt.Errorf("archive segment %s block %d: %w", seg.name, i, err)
+	}
+	if crc32.ChecksumIEEE(buf) != block.checksum {
+		return nil, fmt.Errorf("archive segment %s block %d: checksum mismatch", seg.name, i)
+	}
+
+	var entries []archiveEntry
+	for len(buf) > 0 {
+		var entry archiveEntry
+		for _, field := range []*[]byte{&entry.key, &entry.value} {
+			n, size := binary.Uvarint(buf)
+			if size <= 0 || n > uint64(len(buf)-size) {
+				return nil, fmt.Errorf("archive segment %s block %d: invalid entry", seg.name, i)
+			}
+			*field = buf[size : size+int(n) : size+int(n)]
+			buf = buf[size+int(n):]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// blockFor returns the index of the block which may contain the key, or -1 if the key sorts
+// before the segment.
+func (seg *archiveSegment) blockFor(key []byte) int {
+	return sort.Search(len(seg.blocks), func(i int) bool {
+		return bytes.Compare(seg.blocks[i].firstKey, key) > 0
+	}) - 1
+}
+
+// get returns the value of the key, or nil if the segment does not contain it.
+func (seg *archiveSegment) get(key []byte) ([]byte, error) {
+	i := seg.blockFor(key)
+	if i < 0 {
+		return nil, nil
+	}
+	entries, err := seg.readBlock(i)
+	if err != nil {
+		return nil, err
+	}
+	j := sort.Search(len(entries), func(j int) bool {
+		return bytes.Compare(entries[j].key, key) >= 0
+	})
+	if j < len(entries) && bytes.Equal(entries[j].key, key) {
+		return entries[j].value, nil
+	}
+	return nil, nil
+}
+
+// archiveIterator iterates over the entries of a sorted list of non-overlapping segments, reading
+// one block at a time.
+type archiveIterator struct {
+	start     []byte
+	end       []byte
+	isReverse bool
+	segments  []*archiveSegment // the segments overlapping the domain
+
+	seg     int // index of the current segment
+	block   int // index of the current block in the segment
+	entries []archiveEntry
+	pos     int // index of the current entry in the block
+	valid   bool
+	err     error
+}
+
+var _ Iterator = (*archiveIterator)(nil)
+
+func newArchiveIterator(segments []*archiveSegment, start, end []byte, isReverse bool) *archiveIterator {
+	itr := &archiveIterator{
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+	}
+	for _, seg := range segments {
+		if seg.overlaps(start, end) {
+			itr.segments = append(itr.segments, seg)
+		}
+	}
+	if len(itr.segments) == 0 {
+		return itr
+	}
+
+	if !isReverse {
+		itr.seg = 0
+		itr.block = 0
+		if start != nil {
+			itr.block = max(itr.segments[0].blockFor(start), 0)
+		}
+		itr.load()
+		if start != nil {
+			itr.pos = sort.Search(len(itr.entries), func(i int) bool {
+				return bytes.Compare(itr.entries[i].key, start) >= 0
+			})
+		}
+	} else {
+		itr.seg = len(itr.segments) - 1
+		seg := itr.segments[itr.seg]
+		itr.block = len(seg.blocks) - 1
+		if end != nil {
+			// The last block starting before end.
+			itr.block = sort.Search(len(seg.blocks), func(i int) bool {
+				return bytes.Compare(seg.blocks[i].firstKey, end) >= 0
+			}) - 1
+		}
+		itr.load()
+		itr.pos = len(itr.entries) - 1
+		if end != nil {
+			itr.pos = sort.Search(len(itr.entries), func(i int) bool {
+				return bytes.Compare(itr.entries[i].key, end) >= 0
+			}) - 1
+		}
+	}
+	itr.settle()
+	return itr
+}
+
+// load reads the entries of the current block.
+func (itr *archiveIterator) load() {
+	if itr.err != nil {
+		return
+	}
+	itr.entries, itr.err = itr.segments[itr.seg].readBlock(itr.block)
+}
+
+// settle moves past exhausted blocks and segments, and checks that the current entry is within the
+// domain.
+func (itr *archiveIterator) settle() {
+	itr.valid = false
+	for itr.err == nil && (itr.pos < 0 || itr.pos >= len(itr.entries)) {
+		if !itr.isReverse {
+			itr.block++
+			if itr.block >= len(itr.segments[itr.seg].blocks) {
+				itr.seg++
+				itr.block = 0
+				if itr.seg >= len(itr.segments) {
+					return
+				}
+			}
+			itr.load()
+			itr.pos = 0
+		} else {
+			itr.block--
+			if itr.block < 0 {
+				itr.seg--
+				if itr.seg < 0 {
+					return
+				}
+				itr.block = len(itr.segments[itr.seg].blocks) - 1
+			}
+			itr.load()
+			itr.pos = len(itr.entries) - 1
+		}
+	}
+	if itr.err != nil {
+		return
+	}
+	key := itr.entries[itr.pos].key
+	if !itr.isReverse {
+		itr.valid = itr.end == nil || bytes.Compare(key, itr.end) < 0
+	} else {
+		itr.valid = itr.start == nil || bytes.Compare(key, itr.start) >= 0
+	}
+}
+
+// Domain implements Iterator.
+func (itr *archiveIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *archiveIterator) Valid() bool {
+	return itr.valid && itr.err == nil
+}
+
+// Next implements Iterator.
+func (itr *archiveIterator) Next() {
+	itr.assertIsValid()
+	if !itr.isReverse {
+		itr.pos++
+	} else {
+		itr.pos--
+	}
+	itr.settle()
+}
+
+// Key implements Iterator.
+func (itr *archiveIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.entries[itr.pos].key
+}
+
+// Value implements Iterator.
+func (itr *archiveIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.entries[itr.pos].value
+}
+
+// Error implements Iterator.
+func (itr *archiveIterator) Error() error {
+	return itr.err
+}
+
+// Close implements Iterator.
+func (itr *archiveIterator) Close() error {
+	itr.entries = nil
+	return nil
+}
+
+func (itr *archiveIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestArchiveDB opens an archive database over a memdb, with a store in dir.
+func newTestArchiveDB(t *testing.T, dir string) *ArchiveDB {
+	t.Helper()
+	store, err := NewDirObjectStore(filepath.Join(dir, "store"))
+	require.NoError(t, err)
+	adb, err := NewArchiveDB(NewMemDB(), store, filepath.Join(dir, "cache"))
+	require.NoError(t, err)
+	return adb
+}
+
+func TestArchiveDB(t *testing.T) {
+	adb := newTestArchiveDB(t, t.TempDir())
+	defer adb.Close()
+
+	for i := int64(0); i < 10; i++ {
+		require.NoError(t, adb.Set(int642Bytes(i), int642Bytes(i*10)))
+	}
+	n, err := adb.Archive(int642Bytes(2), int642Bytes(5))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	n, err = adb.Archive(int642Bytes(2), int642Bytes(5))
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Equal(t, "1", adb.Stats()["archive.segments"])
+
+	// Archived keys are read from the segment, and are no longer in the hot database.
+	checkValue(t, adb, int642Bytes(3), int642Bytes(30))
+	checkValue(t, adb.hot, int642Bytes(3), nil)
+	checkValue(t, adb, int642Bytes(7), int642Bytes(70))
+
+	itr, err := adb.Iterator(int642Bytes(1), int642Bytes(8))
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{1, 2, 3, 4, 5, 6, 7}, "forward iterator")
+	require.NoError(t, itr.Close())
+	itr, err = adb.ReverseIterator(nil, int642Bytes(4))
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{3, 2, 1, 0}, "reverse iterator")
+	require.NoError(t, itr.Close())
+
+	// Archived ranges are immutable, other keys remain writable, also within the archived range.
+	require.ErrorIs(t, adb.Set(int642Bytes(3), bz("x")), ErrArchivedKey)
+	require.ErrorIs(t, adb.Delete(int642Bytes(4)), ErrArchivedKey)
+	require.NoError(t, adb.Delete(int642Bytes(5)))
+	require.NoError(t, adb.Set(int642Bytes(11), bz("x")))
+
+	batch := adb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(int642Bytes(12), bz("x")))
+	require.NoError(t, batch.Delete(int642Bytes(2)))
+	require.ErrorIs(t, batch.Write(), ErrArchivedKey)
+	checkValue(t, adb, int642Bytes(12), nil)
+
+	// Ranges overlapping existing segments cannot be archived.
+	n, err = adb.Archive(int642Bytes(5), int642Bytes(9))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	_, err = adb.Archive(nil, nil)
+	require.Error(t, err)
+}
+
+func TestArchiveDBReopen(t *testing.T) {
+	dir := t.TempDir()
+	adb := newTestArchiveDB(t, dir)
+	// Enough data for several blocks per segment.
+	value := make([]byte, 1000)
+	for i := int64(0); i < 500; i++ {
+		require.NoError(t, adb.Set(int642Bytes(i), value))
+	}
+	_, err := adb.Archive(nil, int642Bytes(200))
+	require.NoError(t, err)
+	_, err = adb.Archive(int642Bytes(300), nil)
+	require.NoError(t, err)
+	require.NoError(t, adb.Close())
+
+	// Open the store with an empty cache and hot database, the segments are downloaded.
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "cache")))
+	adb = newTestArchiveDB(t, dir)
+	defer adb.Close()
+	require.Len(t, adb.segments, 2)
+	require.Greater(t, len(adb.segments[0].blocks), 1)
+	checkValue(t, adb, int642Bytes(199), value)
+	checkValue(t, adb, int642Bytes(250), nil)
+	checkValue(t, adb, int642Bytes(499), value)
+
+	itr, err := adb.Iterator(int642Bytes(150), int642Bytes(350))
+	require.NoError(t, err)
+	count := 0
+	for ; itr.Valid(); itr.Next() {
+		key := bytes2Int64(itr.Key())
+		require.True(t, key < 200 || key >= 300, "key %d", key)
+		count++
+	}
+	require.NoError(t, itr.Error())
+	require.NoError(t, itr.Close())
+	require.Equal(t, 100, count)
+
+	itr, err = adb.ReverseIterator(int642Bytes(190), int642Bytes(310))
+	require.NoError(t, err)
+	var keys []int64
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, bytes2Int64(itr.Key()))
+	}
+	require.NoError(t, itr.Close())
+	require.Len(t, keys, 20)
+	require.EqualValues(t, 309, keys[0])
+	require.EqualValues(t, 190, keys[19])
+}
+
+func TestArchiveDBCorruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	adb := newTestArchiveDB(t, dir)
+	require.NoError(t, adb.Set(bz("a"), bz("1")))
+	_, err := adb.Archive(nil, nil)
+	require.NoError(t, err)
+	name := adb.segments[0].name
+	require.NoError(t, adb.Close())
+
+	// Corrupt the cached data, reads fail instead of returning wrong data.
+	path := filepath.Join(dir, "cache", name+archiveDataSuffix)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	adb = newTestArchiveDB(t, dir)
+	defer adb.Close()
+	_, err = adb.Get(bz("a"))
+	require.ErrorContains(t, err, "checksum mismatch")
+	itr, err := adb.Iterator(nil, nil)
+	require.NoError(t, err)
+	require.False(t, itr.Valid())
+	require.Error(t, itr.Error())
+	require.NoError(t, itr.Close())
+
+	// A corrupted index fails opening.
+	path = filepath.Join(dir, "cache", name+archiveIndexSuffix)
+	require.NoError(t, os.WriteFile(path, []byte("corrupted"), 0o644))
+	store, err := NewDirObjectStore(filepath.Join(dir, "store"))
+	require.NoError(t, err)
+	_, err = NewArchiveDB(NewMemDB(), store, filepath.Join(dir, "cache"))
+	require.True(t, errors.Is(err, errArchiveIndexCorrupted))
+}
+
+func TestDirObjectStore(t *testing.T) {
+	store, err := NewDirObjectStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("a", bz("1")))
+	require.NoError(t, store.Put("a", bz("2")))
+	data, err := store.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, bz("2"), data)
+	_, err = store.Get("b")
+	require.ErrorIs(t, err, ErrObjectNotFound)
+	require.Error(t, store.Put("../a", bz("1")))
+
+	names, err := store.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, names)
+}
@@ -0,0 +1,59 @@
+package db
+
+import "sync"
+
+// AsyncBatch is implemented by batches which can natively be written without waiting for them to
+// be flushed to disk, e.g. those of pebble. Use an AsyncWriter to write any batch asynchronously.
+type AsyncBatch interface {
+	Batch
+
+	// WriteAsync writes the batch like WriteSync, but returns before it was flushed to disk. The
+	// batch is visible to reads when WriteAsync returns, and the returned channel receives the
+	// result of the write once the batch is durable. The batch must not be used, nor closed,
+	// until then. Callers should still call Close after, for errors.
+	WriteAsync() <-chan error
+}
+
+// AsyncWriter writes the batches of a database like WriteSync without waiting for them, e.g. so
+// that block execution can overlap the flush of a block with the processing of the next one. Use
+// one AsyncWriter per database, which holds the queue of its pending writes. The zero value is
+// ready to use.
+type AsyncWriter struct {
+	mtx sync.Mutex
+	// tail is closed once the last batch queued is written, and nil if no batch is queued.
+	tail chan struct{}
+}
+
+// WriteAsync writes batch without waiting for it. The returned channel receives the result of the
+// write once the batch is durable. The batch must not be used, nor closed, until then. Callers
+// should still call Close after, for errors.
+//
+// If batch is an AsyncBatch, as for pebble, it is written natively: it is visible to reads when
+// WriteAsync returns, and only the flush is waited for in the background. Otherwise, it is written
+// with WriteSync by a goroutine, and only visible to reads once written. Such batches are written
+// one at a time, in the order of the calls to WriteAsync, so that batches written in turn are
+// applied in order.
+func (w *AsyncWriter) WriteAsync(batch Batch) <-chan error {
+	if ab, ok := batch.(AsyncBatch); ok {
+		return ab.WriteAsync()
+	}
+	result := make(chan error, 1)
+	done := make(chan struct{})
+	w.mtx.Lock()
+	prev := w.tail
+	w.tail = done
+	w.mtx.Unlock()
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		result <- batch.WriteSync()
+		w.mtx.Lock()
+		if w.tail == done {
+			w.tail = nil
+		}
+		w.mtx.Unlock()
+		close(done)
+	}()
+	return result
+}
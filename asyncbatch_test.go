@@ -0,0 +1,71 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncWriter(t *testing.T) {
+	db := NewMemDB()
+	var writer AsyncWriter
+
+	// Batches without native support are written in order.
+	results := make([]<-chan error, 0, 10)
+	for i := byte(0); i < 10; i++ {
+		batch := db.NewBatch()
+		require.NoError(t, batch.Set([]byte("key"), []byte{i}))
+		require.NoError(t, batch.Set([]byte{'k', i}, []byte{i}))
+		results = append(results, writer.WriteAsync(batch))
+	}
+	for _, result := range results {
+		require.NoError(t, <-result)
+	}
+	checkValue(t, db, []byte("key"), []byte{9})
+	checkValue(t, db, []byte{'k', 0}, []byte{0})
+
+	// Errors are returned through the channel.
+	batch := db.NewBatch()
+	require.NoError(t, batch.Close())
+	require.ErrorIs(t, <-writer.WriteAsync(batch), errBatchClosed)
+}
+
+// blockedBatch blocks WriteSync until unblocked.
+type blockedBatch struct {
+	Batch
+	unblock chan struct{}
+}
+
+func (b *blockedBatch) WriteSync() error {
+	<-b.unblock
+	return b.Batch.WriteSync()
+}
+
+func TestAsyncWriterPerDB(t *testing.T) {
+	// A hung database does not block the batches written to another one.
+	hung := NewMemDB()
+	var hungWriter, writer AsyncWriter
+	blocked := &blockedBatch{Batch: hung.NewBatch(), unblock: make(chan struct{})}
+	require.NoError(t, blocked.Set([]byte("a"), []byte{1}))
+	hungResult := hungWriter.WriteAsync(blocked)
+
+	db := NewMemDB()
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set([]byte("b"), []byte{2}))
+	select {
+	case err := <-writer.WriteAsync(batch):
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("batch blocked by another database")
+	}
+
+	// Later batches of the hung database wait for it.
+	next := hung.NewBatch()
+	require.NoError(t, next.Set([]byte("a"), []byte{2}))
+	nextResult := hungWriter.WriteAsync(next)
+	close(blocked.unblock)
+	require.NoError(t, <-hungResult)
+	require.NoError(t, <-nextResult)
+	checkValue(t, hung, []byte("a"), []byte{2})
+}
@@ -0,0 +1,399 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrAuditLogTampered is returned when the hash chain of an audit log does not verify.
+var ErrAuditLogTampered = errors.New("audit log hash chain is broken")
+
+// Operations recorded in an audit log.
+const (
+	AuditOpSet    = "set"
+	AuditOpDelete = "delete"
+)
+
+// AuditRecord is a record of an audit log, stored as a line of JSON. Its hash covers the record
+// with an empty hash, including the hash of the previous record, so that modifying, inserting or
+// removing records breaks the chain of all following records.
+type AuditRecord struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Op        string    `json:"op"`
+	Key       string    `json:"key"`                  // hex encoded
+	ValueHash string    `json:"value_hash,omitempty"` // hex encoded SHA-256 of the value of sets
+	PrevHash  string    `json:"prev_hash"`            // hex encoded, empty for the first record
+	Hash      string    `json:"hash"`                 // hex encoded SHA-256
+}
+
+// computeHash returns the hash of the record.
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash = ""
+	bz, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bz)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLogDB wraps a database, and appends a record of every set and delete, with the key, the
+// hash of the value, and a timestamp, to a hash-chained audit log file, giving a tamper-evident
+// history of the writes to sensitive stores. VerifyAuditLog checks the chain of a log.
+//
+// Records are appended before writes are applied, so a record whose write returned an error may
+// not have been applied. Synced writes sync the log. Only the chain is tamper-evident: anyone able
+// to rewrite the whole file can forge a new chain, so the hash of the latest record should be
+// exported elsewhere periodically, e.g. with LastHash.
+type AuditLogDB struct {
+	db    DB
+	clock Clock
+
+	mtx  sync.Mutex
+	log  *os.File
+	seq  uint64 // sequence number of the last record
+	hash string // hash of the last record
+}
+
+var _ DB = (*AuditLogDB)(nil)
+
+// NewAuditLogDB wraps db with the audit log at path, which is created if it does not exist. An
+// existing log is verified, and a record torn by a crash at its end is removed.
+func NewAuditLogDB(db DB, path string) (*AuditLogDB, error) {
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	last, size, err := verifyAuditLog(log)
+	if err != nil {
+		log.Close()
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+	// A torn record was never acknowledged, so it is removed.
+	if err := log.Truncate(size); err != nil {
+		log.Close()
+		return nil, err
+	}
+	if _, err := log.Seek(size, io.SeekStart); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return &AuditLogDB{
+		db:    db,
+		clock: SystemClock,
+		log:   log,
+		seq:   last.Seq,
+		hash:  last.Hash,
+	}, nil
+}
+
+// VerifyAuditLog verifies the hash chain of the audit log at path, and returns its number of
+// records. A record torn by a crash at its end is ignored.
+func VerifyAuditLog(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	last, _, err := verifyAuditLog(f)
+	return last.Seq, err
+}
+
+// verifyAuditLog verifies the records of r, and returns the last one, along with the size of the
+// complete records.
+func verifyAuditLog(r io.Reader) (AuditRecord, int64, error) {
+	var (
+		last AuditRecord
+		size int64
+	)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without a newline is torn.
+			return last, size, nil
+		}
+		if err != nil {
+			return last, size, err
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(bytes.TrimSuffix(line, []byte("\n")), &record); err != nil {
+			return last, size, fmt.Errorf("%w: invalid record after sequence %d: %w", ErrAuditLogTampered,
+				last.Seq, err)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return last, size, err
+		}
+		if record.Seq != last.Seq+1 || record.PrevHash != last.Hash || record.Hash != hash {
+			return last, size, fmt.Errorf("%w at sequence %d", ErrAuditLogTampered, record.Seq)
+		}
+		last = record
+		size += int64(len(line))
+	}
+}
+
+// LastHash returns the hash of the latest record, which is empty if there is none.
+func (adb *AuditLogDB) LastHash() string {
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+	return adb.hash
+}
+
+// append appends records of the operations to the log.
+func (adb *AuditLogDB) append(ops []operation, sync bool) error {
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+	if adb.log == nil {
+		return errors.New("audit log is closed")
+	}
+	var (
+		buf  bytes.Buffer
+		seq  = adb.seq
+		hash = adb.hash
+		now  = adb.clock.Now().UTC()
+	)
+	for _, op := range ops {
+		record := AuditRecord{
+			Seq:      seq + 1,
+			Time:     now,
+			Op:       AuditOpDelete,
+			Key:      hex.EncodeToString(op.key),
+			PrevHash: hash,
+		}
+		if op.opType == opTypeSet {
+			sum := sha256.Sum256(op.value)
+			record.Op, record.ValueHash = AuditOpSet, hex.EncodeToString(sum[:])
+		}
+		var err error
+		if record.Hash, err = record.computeHash(); err != nil {
+			return err
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		seq, hash = record.Seq, record.Hash
+	}
+	if _, err := adb.log.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if sync {
+		if err := adb.log.Sync(); err != nil {
+			return err
+		}
+	}
+	adb.seq, adb.hash = seq, hash
+	return nil
+}
+
+// Get implements DB.
+func (adb *AuditLogDB) Get(key []byte) ([]byte, error) {
+	return adb.db.Get(key)
+}
+
+// Has implements DB.
+func (adb *AuditLogDB) Has(key []byte) (bool, error) {
+	return adb.db.Has(key)
+}
+
+// Set implements DB.
+func (adb *AuditLogDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := adb.append([]operation{{opTypeSet, key, value}}, false); err != nil {
+		return err
+	}
+	return adb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (adb *AuditLogDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := adb.append([]operation{{opTypeSet, key, value}}, true); err != nil {
+		return err
+	}
+	return adb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (adb *AuditLogDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if err := adb.append([]operation{{opTypeDelete, key, nil}}, false); err != nil {
+		return err
+	}
+	return adb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (adb *AuditLogDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if err := adb.append([]operation{{opTypeDelete, key, nil}}, true); err != nil {
+		return err
+	}
+	return adb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (adb *AuditLogDB) Iterator(start, end []byte) (Iterator, error) {
+	return adb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (adb *AuditLogDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return adb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (adb *AuditLogDB) Close() error {
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+	if adb.log == nil {
+		return nil
+	}
+	err := adb.log.Sync()
+	if closeErr := adb.log.Close(); err == nil {
+		err = closeErr
+	}
+	adb.log = nil
+	if closeErr := adb.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (adb *AuditLogDB) NewBatch() Batch {
+	return &auditLogDBBatch{
+		adb:   adb,
+		batch: adb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (adb *AuditLogDB) Print() error {
+	return adb.db.Print()
+}
+
+// Stats implements DB.
+func (adb *AuditLogDB) Stats() map[string]string {
+	stats := adb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	adb.mtx.Lock()
+	defer adb.mtx.Unlock()
+	stats["audit.records"] = strconv.FormatUint(adb.seq, 10)
+	return stats
+}
+
+// Compact implements DB.
+func (adb *AuditLogDB) Compact(start, end []byte) error {
+	return adb.db.Compact(start, end)
+}
+
+// auditLogDBBatch records the operations of a batch, which are appended to the log when it is
+// written.
+type auditLogDBBatch struct {
+	adb   *AuditLogDB
+	batch Batch
+	ops   []operation
+}
+
+var _ Batch = (*auditLogDBBatch)(nil)
+
+// Set implements Batch.
+func (b *auditLogDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *auditLogDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *auditLogDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *auditLogDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *auditLogDBBatch) Write() error {
+	if err := b.adb.append(b.ops, false); err != nil {
+		return err
+	}
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	clear(b.ops)
+	b.ops = b.ops[:0]
+	return nil
+}
+
+// WriteSync implements Batch.
+func (b *auditLogDBBatch) WriteSync() error {
+	if err := b.adb.append(b.ops, true); err != nil {
+		return err
+	}
+	if err := b.batch.WriteSync(); err != nil {
+		return err
+	}
+	clear(b.ops)
+	b.ops = b.ops[:0]
+	return nil
+}
+
+// Reset implements Batch.
+func (b *auditLogDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.ops)
+	b.ops = b.ops[:0]
+	return nil
+}
+
+// Close implements Batch.
+func (b *auditLogDBBatch) Close() error {
+	b.ops = nil
+	return b.batch.Close()
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	adb, err := NewAuditLogDB(NewMemDB(), path)
+	require.NoError(t, err)
+	adb.clock = clocktest.NewManualClock(time.Unix(1000, 0))
+
+	require.NoError(t, adb.Set(bz("a"), bz("1")))
+	require.NoError(t, adb.DeleteSync(bz("b")))
+	batch := adb.NewBatch()
+	require.NoError(t, batch.Set(bz("c"), bz("3")))
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.WriteSync())
+	require.NoError(t, batch.Close())
+	checkValue(t, adb, bz("a"), nil)
+	checkValue(t, adb, bz("c"), bz("3"))
+	require.Error(t, adb.Set(nil, bz("1")))
+	require.Equal(t, "4", adb.Stats()["audit.records"])
+	hash := adb.LastHash()
+	require.NoError(t, adb.Close())
+
+	records, err := VerifyAuditLog(path)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, records)
+
+	// Reopening resumes the chain.
+	adb, err = NewAuditLogDB(NewMemDB(), path)
+	require.NoError(t, err)
+	require.Equal(t, hash, adb.LastHash())
+	require.NoError(t, adb.Set(bz("d"), bz("4")))
+	require.NoError(t, adb.Close())
+	records, err = VerifyAuditLog(path)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, records)
+}
+
+func TestAuditLogDBTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	adb, err := NewAuditLogDB(NewMemDB(), path)
+	require.NoError(t, err)
+	require.NoError(t, adb.Set(bz("a"), bz("1")))
+	require.NoError(t, adb.Set(bz("b"), bz("2")))
+	require.NoError(t, adb.Set(bz("c"), bz("3")))
+	require.NoError(t, adb.Close())
+	log, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.SplitAfter(log, []byte("\n"))
+
+	// A torn record at the end is ignored, and removed on open.
+	torn := append(append([]byte{}, log...), lines[0][:10]...)
+	require.NoError(t, os.WriteFile(path, torn, 0o600))
+	records, err := VerifyAuditLog(path)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, records)
+	adb, err = NewAuditLogDB(NewMemDB(), path)
+	require.NoError(t, err)
+	require.NoError(t, adb.Close())
+	repaired, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, log, repaired)
+
+	testcases := map[string][]byte{
+		"modified key": bytes.Replace(log, []byte(`"key":"62"`), []byte(`"key":"64"`), 1),
+		"removed":      bytes.Join([][]byte{lines[0], lines[2]}, nil),
+		"reordered":    bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil),
+		"invalid":      bytes.Join([][]byte{lines[0], []byte("{\n"), lines[2]}, nil),
+	}
+	for name, tampered := range testcases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, tampered, 0o600))
+			_, err := VerifyAuditLog(path)
+			require.ErrorIs(t, err, ErrAuditLogTampered)
+			_, err = NewAuditLogDB(NewMemDB(), path)
+			require.ErrorIs(t, err, ErrAuditLogTampered)
+		})
+	}
+}
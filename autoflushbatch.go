@@ -0,0 +1,138 @@
+package db
+
+// AutoFlushBatch is a Batch which writes its pending operations to the database, and starts a new
+// batch, whenever they reach a number of operations or a size in bytes, e.g. to commit every 100k
+// operations or 64MB during an import, without tracking counters. Sizes are those returned by
+// Batch.SizeBytes of the underlying batches.
+//
+// Unlike other batches, an AutoFlushBatch is not atomic: operations flushed before remain written
+// if a later write fails, or if the batch is closed without being written. Flushes are written
+// with Write, and only the last chunk is written with WriteSync by WriteSync.
+type AutoFlushBatch struct {
+	db       DB
+	maxCount int
+	maxBytes int
+	batch    Batch // nil once closed
+	flushed  int
+}
+
+var _ Batch = (*AutoFlushBatch)(nil)
+
+// NewAutoFlushBatch creates a batch of db which is flushed once it holds maxCount operations, or
+// maxBytes bytes. A limit of 0 or less is not enforced.
+func NewAutoFlushBatch(db DB, maxCount, maxBytes int) *AutoFlushBatch {
+	return &AutoFlushBatch{
+		db:       db,
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+		batch:    db.NewBatch(),
+	}
+}
+
+// Set implements Batch.
+func (b *AutoFlushBatch) Set(key, value []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	return b.flushIfFull()
+}
+
+// Delete implements Batch.
+func (b *AutoFlushBatch) Delete(key []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	return b.flushIfFull()
+}
+
+// flushIfFull writes the pending batch to the database and starts a new one, if it reached a
+// limit, reusing the written batch. If the write fails, the batch is kept, so that it can be
+// retried.
+func (b *AutoFlushBatch) flushIfFull() error {
+	count := b.batch.Count()
+	if (b.maxCount <= 0 || count < b.maxCount) && (b.maxBytes <= 0 || b.batch.SizeBytes() < b.maxBytes) {
+		return nil
+	}
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	b.flushed += count
+	return b.batch.Reset()
+}
+
+// Flushed returns the number of operations written to the database by flushes so far.
+func (b *AutoFlushBatch) Flushed() int {
+	return b.flushed
+}
+
+// Count implements Batch. Operations already flushed are not counted, see Flushed.
+func (b *AutoFlushBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch. Operations already flushed are not counted.
+func (b *AutoFlushBatch) SizeBytes() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *AutoFlushBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *AutoFlushBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *AutoFlushBatch) write(sync bool) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	count := b.batch.Count()
+	var err error
+	if sync {
+		err = b.batch.WriteSync()
+	} else {
+		err = b.batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	b.flushed += count
+	return nil
+}
+
+// Reset implements Batch. Operations already flushed remain written, and Flushed starts over from 0.
+func (b *AutoFlushBatch) Reset() error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	b.flushed = 0
+	return nil
+}
+
+// Close implements Batch. Operations already flushed remain written.
+func (b *AutoFlushBatch) Close() error {
+	if b.batch == nil {
+		return nil
+	}
+	err := b.batch.Close()
+	b.batch = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoFlushBatchCount(t *testing.T) {
+	db := NewMemDB()
+	batch := NewAutoFlushBatch(db, 3, 0)
+	defer batch.Close()
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, batch.Set(bz(fmt.Sprintf("key%d", i)), bz("value")))
+	}
+	require.Equal(t, 6, batch.Flushed())
+	require.Equal(t, 1, batch.Count())
+	// Flushed operations are visible before the batch is written.
+	checkValue(t, db, bz("key5"), bz("value"))
+	checkValue(t, db, bz("key6"), nil)
+
+	require.NoError(t, batch.Delete(bz("key0")))
+	require.Equal(t, 2, batch.Count())
+	require.NoError(t, batch.Write())
+	require.Equal(t, 8, batch.Flushed())
+	require.Zero(t, batch.Count())
+	checkValue(t, db, bz("key0"), nil)
+	checkValue(t, db, bz("key6"), bz("value"))
+
+	require.ErrorIs(t, batch.Set(bz("key"), bz("value")), errBatchClosed)
+	require.ErrorIs(t, batch.Write(), errBatchClosed)
+	require.NoError(t, batch.Close())
+}
+
+func TestAutoFlushBatchSize(t *testing.T) {
+	db := NewMemDB()
+	batch := NewAutoFlushBatch(db, 0, 100)
+	defer batch.Close()
+
+	// Every operation adds 4 bytes of key and 46 bytes of value.
+	value := make([]byte, 46)
+	require.NoError(t, batch.Set(bz("key0"), value))
+	require.Zero(t, batch.Flushed())
+	require.Equal(t, 50, batch.SizeBytes())
+	require.NoError(t, batch.Set(bz("key1"), value))
+	require.Equal(t, 2, batch.Flushed())
+	require.Zero(t, batch.SizeBytes())
+
+	require.NoError(t, batch.Set(bz("key2"), value))
+	require.NoError(t, batch.Close())
+	checkValue(t, db, bz("key1"), value)
+	checkValue(t, db, bz("key2"), nil)
+}
+
+func TestAutoFlushBatchInvalid(t *testing.T) {
+	batch := NewAutoFlushBatch(NewMemDB(), 1, 0)
+	defer batch.Close()
+
+	require.ErrorIs(t, batch.Set(nil, bz("value")), errKeyEmpty)
+	require.ErrorIs(t, batch.Delete(nil), errKeyEmpty)
+	require.Zero(t, batch.Flushed())
+}
@@ -15,7 +15,7 @@ import (
 // Register a test backend for PrefixDB as well, with some unrelated junk data.
 func init() {
 	//nolint: errcheck, revive // probably should check errors?
-	registerDBCreator("prefixdb", func(name, dir string) (DB, error) {
+	registerDBCreator("prefixdb", func(_, _ string, _ *dbOptions) (DB, error) {
 		mdb := NewMemDB()
 		mdb.Set([]byte("a"), []byte{1})
 		mdb.Set([]byte("b"), []byte{2})
@@ -174,6 +174,78 @@ func TestDBIterator(t *testing.T) {
 	}
 }
 
+func TestDBUnsafeIterator(t *testing.T) {
+	for dbType := range backends {
+		t.Run(string(dbType), func(t *testing.T) {
+			name := fmt.Sprintf("test_%x", randStr(12))
+			dir := os.TempDir()
+			db, err := NewDB(name, dbType, dir)
+			require.NoError(t, err)
+			defer cleanupDBDir(dir, name)
+			defer db.Close()
+			for i := 0; i < 3; i++ {
+				require.NoError(t, db.Set(bz(fmt.Sprintf("p/%d", i)), bz(fmt.Sprintf("v%d", i))))
+			}
+
+			for _, reader := range []DB{db, NewPrefixDB(db, bz("p/"))} {
+				itr, err := reader.Iterator(nil, nil)
+				require.NoError(t, err)
+				var keys, values []string
+				for ; itr.Valid(); itr.Next() {
+					require.Equal(t, itr.Key(), UnsafeKey(itr))
+					keys = append(keys, string(UnsafeKey(itr)))
+					values = append(values, string(UnsafeValue(itr)))
+				}
+				require.NoError(t, itr.Error())
+				require.NoError(t, itr.Close())
+				require.Equal(t, []string{"v0", "v1", "v2"}, values)
+				require.Len(t, keys, 3)
+				require.Equal(t, "2", keys[2][len(keys[2])-1:])
+			}
+		})
+	}
+}
+
+func TestDBGetAppend(t *testing.T) {
+	for dbType := range backends {
+		t.Run(string(dbType), func(t *testing.T) {
+			name := fmt.Sprintf("test_%x", randStr(12))
+			dir := os.TempDir()
+			db, err := NewDB(name, dbType, dir)
+			require.NoError(t, err)
+			defer cleanupDBDir(dir, name)
+			defer db.Close()
+			require.NoError(t, db.Set(bz("p/a"), bz("value")))
+			require.NoError(t, db.Set(bz("p/empty"), []byte{}))
+
+			for _, reader := range []DB{db, NewPrefixDB(db, bz("p/"))} {
+				key := bz("a")
+				if reader == db {
+					key = bz("p/a")
+				}
+				buf := make([]byte, 0, 16)
+				buf, ok, err := GetAppend(reader, key, append(buf, "prefix:"...))
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, "prefix:value", string(buf))
+
+				buf, ok, err = GetAppend(reader, bz("missing"), buf[:0])
+				require.NoError(t, err)
+				require.False(t, ok)
+				require.Empty(t, buf)
+
+				_, _, err = GetAppend(reader, nil, buf)
+				require.Equal(t, errKeyEmpty, err)
+			}
+
+			buf, ok, err := GetAppend(db, bz("p/empty"), nil)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Empty(t, buf)
+		})
+	}
+}
+
 func testDBIterator(t *testing.T, backend BackendType) {
 	t.Helper()
 
@@ -365,14 +437,24 @@ func testDBBatch(t *testing.T, backend BackendType) {
 
 	// create a new batch, and some items - they should not be visible until we write
 	batch := db.NewBatch()
+	require.Zero(t, batch.Count())
 	require.NoError(t, batch.Set([]byte("a"), []byte{1}))
 	require.NoError(t, batch.Set([]byte("b"), []byte{2}))
 	require.NoError(t, batch.Set([]byte("c"), []byte{3}))
 	assertKeyValues(t, db, map[string][]byte{})
 
+	// the batch should report its pending operations and their size
+	require.Equal(t, 3, batch.Count())
+	require.GreaterOrEqual(t, batch.SizeBytes(), 6)
+	require.NoError(t, batch.Delete([]byte("d")))
+	require.Equal(t, 4, batch.Count())
+	require.GreaterOrEqual(t, batch.SizeBytes(), 7)
+
 	err = batch.Write()
 	require.NoError(t, err)
 	assertKeyValues(t, db, map[string][]byte{"a": {1}, "b": {2}, "c": {3}})
+	require.Zero(t, batch.Count())
+	require.Zero(t, batch.SizeBytes())
 
 	// trying to modify or rewrite a written batch should error, but closing it should work
 	require.Error(t, batch.Set([]byte("a"), []byte{9}))
@@ -430,6 +512,166 @@ func testDBBatch(t *testing.T, backend BackendType) {
 	require.Error(t, batch.Delete([]byte("a")))
 	require.Error(t, batch.Write())
 	require.Error(t, batch.WriteSync())
+	require.Error(t, batch.Reset())
+
+	testBatchReset(t, db, db.NewBatch)
+}
+
+// testBatchReset checks that a batch created by newBatch can be reset, and reused once written,
+// by reading its writes from db.
+func testBatchReset(t *testing.T, db DBReader, newBatch func() Batch) {
+	t.Helper()
+
+	// resetting discards the pending operations
+	batch := newBatch()
+	require.NoError(t, batch.Set([]byte("reset"), []byte{1}))
+	require.NoError(t, batch.Reset())
+	require.Zero(t, batch.Count())
+	require.Zero(t, batch.SizeBytes())
+	require.NoError(t, batch.Write())
+	checkValue(t, db, []byte("reset"), nil)
+
+	// a written batch can be reused once reset
+	for i := byte(0); i < 4; i++ {
+		require.NoError(t, batch.Reset())
+		require.NoError(t, batch.Set([]byte("reset"), []byte{i}))
+		require.NoError(t, batch.Delete([]byte("reset-deleted")))
+		require.NoError(t, batch.Set([]byte("reset-deleted"), []byte{i}))
+		require.Equal(t, 3, batch.Count())
+		if i%2 == 0 {
+			require.NoError(t, batch.Write())
+		} else {
+			require.NoError(t, batch.WriteSync())
+		}
+		require.Error(t, batch.Set([]byte("reset"), []byte{9}))
+		checkValue(t, db, []byte("reset"), []byte{i})
+		checkValue(t, db, []byte("reset-deleted"), []byte{i})
+	}
+
+	// but not once closed
+	require.NoError(t, batch.Close())
+	require.Error(t, batch.Reset())
+	require.Error(t, batch.Set([]byte("reset"), []byte{9}))
+}
+
+func TestWrappedBatchReset(t *testing.T) {
+	dir := t.TempDir()
+	testCases := map[string]func() DB{
+		"archive": func() DB { return newTestArchiveDB(t, filepath.Join(dir, "archive")) },
+		"auditlog": func() DB {
+			adb, err := NewAuditLogDB(NewMemDB(), filepath.Join(dir, "audit.log"))
+			require.NoError(t, err)
+			return adb
+		},
+		"bitcask": func() DB {
+			bdb, err := NewBitcaskDB("bitcask", dir)
+			require.NoError(t, err)
+			return bdb
+		},
+		"caching":        func() DB { return NewCachingDB(NewMemDB(), 1<<20) },
+		"concurrentsafe": func() DB { return NewConcurrentSafeDB(NewMemDB(), 4) },
+		"deadline": func() DB {
+			return NewDeadlineDB(NewMemDB(), DeadlineDBConfig{ReadTimeout: time.Second, BatchTimeout: time.Second})
+		},
+		"encrypted": func() DB {
+			edb, err := NewEncryptedDB(NewMemDB(), make([]byte, 32))
+			require.NoError(t, err)
+			return edb
+		},
+		"groupcommit":  func() DB { return NewGroupCommitDB(NewMemDB(), 0) },
+		"hook":         func() DB { return NewHookDB(NewMemDB()) },
+		"instrumented": func() DB { return NewInstrumentedDB(NewMemDB(), newRecordingMetricsSink()) },
+		"keycodec":     func() DB { return NewKeyCodecDB(NewMemDB(), EscapeKeyCodec{}) },
+		"mirror":       func() DB { return NewMirrorDB(NewMemDB(), NewMemDB()) },
+		"prefix":       func() DB { return NewPrefixDB(NewMemDB(), []byte("prefix/")) },
+		"quota": func() DB {
+			qdb, err := NewQuotaDB(NewMemDB(), 1<<20, nil)
+			require.NoError(t, err)
+			return qdb
+		},
+		"retry":         func() DB { return NewRetryDB(NewMemDB(), RetryDBConfig{}) },
+		"samplingstats": func() DB { return NewSamplingStatsDB(NewMemDB(), SamplingStatsDBConfig{SampleRate: 1}) },
+		"sharded": func() DB {
+			return NewShardedDB([]DB{NewMemDB(), NewMemDB(), NewMemDB()}, HashSharding(3))
+		},
+		"slowlog":    func() DB { return NewSlowLogDB(NewMemDB(), time.Second, &testLogger{}) },
+		"tiered":     func() DB { return NewTieredDB(NewMemDB(), NewMemDB()) },
+		"tracing":    func() DB { return NewTracingDB(NewMemDB(), &recordingTracer{}, MemDBBackend) },
+		"validating": func() DB { return NewValidatingDB(NewMemDB()) },
+		"wal": func() DB {
+			wdb, err := NewWALDB(NewMemDB(), filepath.Join(dir, "wal"))
+			require.NoError(t, err)
+			return wdb
+		},
+		"tracked": func() DB {
+			tdb, err := NewDB("tracked", MemDBBackend, "", WithResourceTracking(false))
+			require.NoError(t, err)
+			return tdb
+		},
+	}
+	for name, open := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := open()
+			defer db.Close()
+			testBatchReset(t, db, db.NewBatch)
+		})
+	}
+
+	t.Run("autoflush", func(t *testing.T) {
+		db := NewMemDB()
+		testBatchReset(t, db, func() Batch { return NewAutoFlushBatch(db, 10, 0) })
+	})
+	t.Run("mvcc", func(t *testing.T) {
+		m := NewMVCCDB(NewMemDB())
+		defer m.Close()
+		testBatchReset(t, m, func() Batch { return m.VersionBatch(1) })
+	})
+}
+
+// nilStatsDB is a database whose Stats returns nil, like BadgerDB.
+type nilStatsDB struct {
+	*MemDB
+}
+
+func (nilStatsDB) Stats() map[string]string {
+	return nil
+}
+
+func TestWrappedNilStats(t *testing.T) {
+	testCases := map[string]func(t *testing.T, db DB) DB{
+		"caching":       func(_ *testing.T, db DB) DB { return NewCachingDB(db, 1<<20) },
+		"deadline":      func(_ *testing.T, db DB) DB { return NewDeadlineDB(db, DeadlineDBConfig{}) },
+		"writequeue":    func(_ *testing.T, db DB) DB { return NewWriteQueueDB(db, 16, 16) },
+		"mirror":        func(_ *testing.T, db DB) DB { return NewMirrorDB(db, NewMemDB()) },
+		"livemigration": func(_ *testing.T, db DB) DB { return NewLiveMigrationDB(db, NewMemDB(), LiveMigrationConfig{}) },
+		"wal": func(t *testing.T, db DB) DB {
+			wdb, err := NewWALDB(db, filepath.Join(t.TempDir(), "wal"))
+			require.NoError(t, err)
+			return wdb
+		},
+		"quota": func(t *testing.T, db DB) DB {
+			qdb, err := NewQuotaDB(db, 1<<20, nil)
+			require.NoError(t, err)
+			return qdb
+		},
+		"groupcommit":    func(_ *testing.T, db DB) DB { return NewGroupCommitDB(db, 0) },
+		"retry":          func(_ *testing.T, db DB) DB { return NewRetryDB(db, RetryDBConfig{}) },
+		"shadowread":     func(_ *testing.T, db DB) DB { return NewShadowReadDB(db, NewMemDB(), ShadowReadDBConfig{}) },
+		"concurrentsafe": func(_ *testing.T, db DB) DB { return NewConcurrentSafeDB(db, 4) },
+		"samplingstats":  func(_ *testing.T, db DB) DB { return NewSamplingStatsDB(db, SamplingStatsDBConfig{SampleRate: 1}) },
+		"auditlog": func(t *testing.T, db DB) DB {
+			adb, err := NewAuditLogDB(db, filepath.Join(t.TempDir(), "audit.log"))
+			require.NoError(t, err)
+			return adb
+		},
+	}
+	for name, wrap := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := wrap(t, nilStatsDB{NewMemDB()})
+			defer db.Close()
+			require.NotEmpty(t, db.Stats())
+		})
+	}
 }
 
 func assertKeyValues(t *testing.T, db DB, expect map[string][]byte) {
@@ -0,0 +1,453 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupManifestFile is the file of a backup directory listing its backups.
+const backupManifestFile = "manifest.json"
+
+// ErrBackupCorrupted is returned when the files of a backup do not match its manifest.
+var ErrBackupCorrupted = errors.New("backup corrupted")
+
+// BackupInfo describes a backup of a backup directory.
+type BackupInfo struct {
+	// ID numbers the backups of a directory from 1.
+	ID uint64 `json:"id"`
+	// Incremental is set for backups holding the changes since the previous backup, which must be
+	// restored along with all backups since the last full one.
+	Incremental bool      `json:"incremental"`
+	Time        time.Time `json:"time"`
+	// Sets is the number of items of a full backup, or the number of keys set or changed since the
+	// previous backup.
+	Sets uint64 `json:"sets"`
+	// Deletes is the number of keys deleted since the previous backup.
+	Deletes uint64 `json:"deletes"`
+	// SetsFile and DeletesFile are the dumps of the items set and the keys deleted, with their
+	// SHA-256 checksums. Full backups have no deletes file.
+	SetsFile      string `json:"sets_file"`
+	SetsSHA256    string `json:"sets_sha256"`
+	DeletesFile   string `json:"deletes_file,omitempty"`
+	DeletesSHA256 string `json:"deletes_sha256,omitempty"`
+}
+
+// Backup backs up src into the backup directory dir, which is created if needed, and returns the
+// new backup. Backups are dumps as written by ExportTo, listed in a manifest.
+//
+// Full backups hold all items of src. Incremental backups only hold the items set or changed and
+// the keys deleted since the previous backup, found by comparing src with the state restored from
+// the previous backups, so they work with any backend: they still read all of src and of the
+// previous backups, but only write the changes. The first backup of a directory is always full.
+//
+// src must not be written to during the backup, e.g. by backing up a stopped node's database or a
+// snapshot. If src was opened by NewDB with WithEventBus, EventBackupComplete is published once
+// the backup is complete.
+func Backup(src DBReader, dir string, incremental bool) (*BackupInfo, error) {
+	events := eventsOf(src)
+	began := events.now()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	info := &BackupInfo{
+		ID:          uint64(len(backups)) + 1,
+		Incremental: incremental && len(backups) > 0,
+		Time:        time.Now().UTC(),
+	}
+	info.SetsFile = fmt.Sprintf("%06d.sets", info.ID)
+	if info.Incremental {
+		info.DeletesFile = fmt.Sprintf("%06d.deletes", info.ID)
+	}
+
+	itr, err := src.Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	sets, err := createBackupFile(filepath.Join(dir, info.SetsFile))
+	if err != nil {
+		return nil, err
+	}
+	defer sets.abort()
+	if !info.Incremental {
+		for ; itr.Valid(); itr.Next() {
+			if err := sets.add(UnsafeKey(itr), UnsafeValue(itr)); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		deletes, err := createBackupFile(filepath.Join(dir, info.DeletesFile))
+		if err != nil {
+			return nil, err
+		}
+		defer deletes.abort()
+		state, err := openBackupState(dir, backups, info.ID-1)
+		if err != nil {
+			return nil, err
+		}
+		defer state.close()
+		if err := diffBackupState(itr, state, sets, deletes); err != nil {
+			return nil, err
+		}
+		if info.DeletesSHA256, err = deletes.commit(); err != nil {
+			return nil, err
+		}
+		info.Deletes = deletes.dump.total
+	}
+	if err := itr.Error(); err != nil {
+		return nil, err
+	}
+	if info.SetsSHA256, err = sets.commit(); err != nil {
+		return nil, err
+	}
+	info.Sets = sets.dump.total
+
+	if err := writeBackupManifest(dir, append(backups, *info)); err != nil {
+		return nil, err
+	}
+	events.publish(EventBackupComplete, nil, fmt.Sprintf("backup %d to %s: %d sets, %d deletes",
+		info.ID, dir, info.Sets, info.Deletes), events.now().Sub(began))
+	return info, nil
+}
+
+// diffBackupState writes the items of itr which are missing from or differ in the state of the
+// previous backups to sets, and the keys of the state missing from itr to deletes.
+func diffBackupState(itr Iterator, state *backupState, sets, deletes *backupFile) error {
+	key, value, err := state.next()
+	for {
+		if errors.Is(err, io.EOF) {
+			key = nil
+		} else if err != nil {
+			return err
+		}
+		if !itr.Valid() && key == nil {
+			return nil
+		}
+		switch {
+		case key == nil || (itr.Valid() && bytes.Compare(itr.Key(), key) < 0):
+			// The key was set since the previous backup.
+			if err := sets.add(itr.Key(), itr.Value()); err != nil {
+				return err
+			}
+			itr.Next()
+			continue
+		case !itr.Valid() || bytes.Compare(itr.Key(), key) > 0:
+			// The key was deleted since the previous backup.
+			if err := deletes.add(key, []byte{}); err != nil {
+				return err
+			}
+		default:
+			if !bytes.Equal(itr.Value(), value) {
+				if err := sets.add(itr.Key(), itr.Value()); err != nil {
+					return err
+				}
+			}
+			itr.Next()
+		}
+		key, value, err = state.next()
+	}
+}
+
+// ListBackups returns the backups of the backup directory dir, which is empty if it has none.
+func ListBackups(dir string) ([]BackupInfo, error) {
+	bz, err := os.ReadFile(filepath.Join(dir, backupManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []BackupInfo
+	if err := json.Unmarshal(bz, &backups); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", ErrBackupCorrupted, err)
+	}
+	return backups, nil
+}
+
+// VerifyBackup verifies the files of the backup with the given ID, or of the latest backup if 0,
+// and of the previous backups it needs to be restored, against their checksums.
+func VerifyBackup(dir string, id uint64) error {
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	chain, err := backupChain(backups, id)
+	if err != nil {
+		return err
+	}
+	for _, info := range chain {
+		files := [][2]string{{info.SetsFile, info.SetsSHA256}}
+		if info.Incremental {
+			files = append(files, [2]string{info.DeletesFile, info.DeletesSHA256})
+		}
+		for _, file := range files {
+			if err := verifyBackupFile(filepath.Join(dir, file[0]), file[1]); err != nil {
+				return fmt.Errorf("backup %d: %w", info.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RestoreBackup verifies the backup with the given ID, or the latest backup if 0, and writes its
+// items to dst, which should be empty, and returns the number of items written.
+func RestoreBackup(dst DB, dir string, id uint64) (uint64, error) {
+	if err := VerifyBackup(dir, id); err != nil {
+		return 0, err
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		id = uint64(len(backups))
+	}
+	state, err := openBackupState(dir, backups, id)
+	if err != nil {
+		return 0, err
+	}
+	defer state.close()
+	var written uint64
+	err = writeDumpItems(dst, state.next, func(n uint64) { written = n })
+	return written, err
+}
+
+// backupChain returns the backups needed to restore the backup with the given ID, or the latest
+// backup if 0: the last full backup up to it, and the incremental backups since.
+func backupChain(backups []BackupInfo, id uint64) ([]BackupInfo, error) {
+	if len(backups) == 0 {
+		return nil, errors.New("no backups")
+	}
+	if id == 0 {
+		id = uint64(len(backups))
+	}
+	if id > uint64(len(backups)) {
+		return nil, fmt.Errorf("backup %d not found", id)
+	}
+	start := id - 1
+	for backups[start].Incremental {
+		if start == 0 {
+			return nil, fmt.Errorf("%w: no full backup before backup %d", ErrBackupCorrupted, id)
+		}
+		start--
+	}
+	return backups[start:id], nil
+}
+
+// backupFile is a backup file being written, with the checksum of its content.
+type backupFile struct {
+	path string
+	file *os.File
+	sum  hash.Hash
+	hash []byte
+	dump *dumpWriter
+}
+
+// createBackupFile creates a temporary backup file, renamed to path once committed.
+func createBackupFile(path string) (*backupFile, error) {
+	file, err := os.Create(path + tmpFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.New()
+	dump, err := newDumpWriter(io.MultiWriter(file, sum))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &backupFile{path: path, file: file, sum: sum, dump: dump}, nil
+}
+
+// add adds an item to the file.
+func (f *backupFile) add(key, value []byte) error {
+	return f.dump.add(key, value)
+}
+
+// commit completes the file, and returns its hex encoded SHA-256 checksum.
+func (f *backupFile) commit() (string, error) {
+	if err := f.dump.close(); err != nil {
+		return "", err
+	}
+	if err := f.file.Sync(); err != nil {
+		return "", err
+	}
+	if err := f.file.Close(); err != nil {
+		return "", err
+	}
+	f.file = nil
+	if err := os.Rename(f.path+tmpFileSuffix, f.path); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(f.sum.Sum(nil)), nil
+}
+
+// abort removes the file if it was not committed.
+func (f *backupFile) abort() {
+	if f.file != nil {
+		f.file.Close()
+		os.Remove(f.path + tmpFileSuffix)
+	}
+}
+
+// verifyBackupFile verifies the SHA-256 checksum of a backup file, and the checksums of its dump.
+func verifyBackupFile(path, checksum string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	dr, err := newDumpReader(io.TeeReader(file, sum))
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	for {
+		if _, _, err = dr.next(); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if _, err := io.Copy(sum, file); err != nil {
+		return err
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != checksum {
+		return fmt.Errorf("%w: %s does not match its checksum", ErrBackupCorrupted, filepath.Base(path))
+	}
+	return nil
+}
+
+// writeBackupManifest atomically replaces the manifest of a backup directory.
+func writeBackupManifest(dir string, backups []BackupInfo) error {
+	bz, err := json.MarshalIndent(backups, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, backupManifestFile)
+	if err := os.WriteFile(path+tmpFileSuffix, bz, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+tmpFileSuffix, path)
+}
+
+// backupState returns the items of the state restored from a chain of backups, in key order, by
+// merging their dumps: the latest backup mentioning a key decides whether it is set, and to which
+// value.
+type backupState struct {
+	files   []*os.File
+	streams []*backupStream
+}
+
+// backupStream is a dump of a backup file, positioned at its current item.
+type backupStream struct {
+	dump    *dumpReader
+	rank    int // position of the backup in the chain
+	deletes bool
+	key     []byte
+	value   []byte
+	valid   bool
+}
+
+// advance moves the stream to its next item.
+func (s *backupStream) advance() error {
+	key, value, err := s.dump.next()
+	if errors.Is(err, io.EOF) {
+		s.valid = false
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.key, s.value, s.valid = key, value, true
+	return nil
+}
+
+// openBackupState opens the state of the backup with the given ID.
+func openBackupState(dir string, backups []BackupInfo, id uint64) (*backupState, error) {
+	chain, err := backupChain(backups, id)
+	if err != nil {
+		return nil, err
+	}
+	state := &backupState{}
+	for rank, info := range chain {
+		files := []string{info.SetsFile}
+		if info.Incremental {
+			files = append(files, info.DeletesFile)
+		}
+		for i, name := range files {
+			file, err := os.Open(filepath.Join(dir, name))
+			if err != nil {
+				state.close()
+				return nil, err
+			}
+			state.files = append(state.files, file)
+			dump, err := newDumpReader(file)
+			if err != nil {
+				state.close()
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			stream := &backupStream{dump: dump, rank: rank, deletes: i == 1}
+			if err := stream.advance(); err != nil {
+				state.close()
+				return nil, err
+			}
+			state.streams = append(state.streams, stream)
+		}
+	}
+	return state, nil
+}
+
+// next returns the next item of the state, or io.EOF after the last one.
+func (s *backupState) next() ([]byte, []byte, error) {
+	for {
+		var current *backupStream
+		for _, stream := range s.streams {
+			if !stream.valid {
+				continue
+			}
+			if current == nil {
+				current = stream
+				continue
+			}
+			switch c := bytes.Compare(stream.key, current.key); {
+			case c < 0, c == 0 && stream.rank > current.rank:
+				current = stream
+			}
+		}
+		if current == nil {
+			return nil, nil, io.EOF
+		}
+		key, value, deleted := cp(current.key), cp(current.value), current.deletes
+		for _, stream := range s.streams {
+			if stream.valid && bytes.Equal(stream.key, key) {
+				if err := stream.advance(); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		if !deleted {
+			return key, value, nil
+		}
+	}
+}
+
+// close closes the files of the state.
+func (s *backupState) close() {
+	for _, file := range s.files {
+		file.Close()
+	}
+}
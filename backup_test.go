@@ -0,0 +1,89 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemDB()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, src.Set(int642Bytes(int64(i)), bz("v")))
+	}
+
+	info, err := Backup(src, dir, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, info.ID)
+	require.False(t, info.Incremental, "the first backup must be full")
+	require.EqualValues(t, 10, info.Sets)
+
+	require.NoError(t, src.Set(int642Bytes(3), bz("changed")))
+	require.NoError(t, src.Set(int642Bytes(20), bz("added")))
+	require.NoError(t, src.Delete(int642Bytes(5)))
+	info, err = Backup(src, dir, true)
+	require.NoError(t, err)
+	require.True(t, info.Incremental)
+	require.EqualValues(t, 2, info.Sets)
+	require.EqualValues(t, 1, info.Deletes)
+
+	// Deleted keys can be set again.
+	require.NoError(t, src.Set(int642Bytes(5), bz("again")))
+	require.NoError(t, src.Delete(int642Bytes(20)))
+	info, err = Backup(src, dir, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, info.Sets)
+	require.EqualValues(t, 1, info.Deletes)
+
+	backups, err := ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+
+	dst := NewMemDB()
+	n, err := RestoreBackup(dst, dir, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, n)
+	checkValue(t, dst, int642Bytes(3), bz("changed"))
+	checkValue(t, dst, int642Bytes(5), bz("again"))
+	checkValue(t, dst, int642Bytes(20), nil)
+
+	dst = NewMemDB()
+	n, err = RestoreBackup(dst, dir, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, n)
+	checkValue(t, dst, int642Bytes(5), nil)
+	checkValue(t, dst, int642Bytes(20), bz("added"))
+
+	_, err = RestoreBackup(NewMemDB(), dir, 4)
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestBackupCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	src := NewMemDB()
+	require.NoError(t, src.Set(bz("a"), bz("1")))
+	_, err := Backup(src, dir, false)
+	require.NoError(t, err)
+	require.NoError(t, src.Set(bz("b"), bz("2")))
+	info, err := Backup(src, dir, true)
+	require.NoError(t, err)
+	require.NoError(t, VerifyBackup(dir, 0))
+
+	path := filepath.Join(dir, info.SetsFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	// Earlier backups can still be restored.
+	require.NoError(t, VerifyBackup(dir, 1))
+	require.ErrorIs(t, VerifyBackup(dir, 2), ErrDumpCorrupted)
+
+	dst := NewMemDB()
+	_, err = RestoreBackup(dst, dir, 0)
+	require.Error(t, err)
+	checkValue(t, dst, bz("a"), nil)
+}
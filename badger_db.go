@@ -5,6 +5,7 @@ package db
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -14,7 +15,7 @@ import (
 
 func init() { registerDBCreator(BadgerDBBackend, badgerDBCreator) }
 
-func badgerDBCreator(dbName, dir string) (DB, error) {
+func badgerDBCreator(dbName, dir string, _ *dbOptions) (DB, error) {
 	return NewBadgerDB(dbName, dir)
 }
 
@@ -170,6 +171,25 @@ func (b *BadgerDB) Stats() map[string]string {
 	return nil
 }
 
+var _ Checker = (*BadgerDB)(nil)
+
+// Check implements Checker. It verifies the checksums of all tables with badger's
+// VerifyChecksum, then iterates over the whole keyspace.
+func (b *BadgerDB) Check(ctx context.Context) (*CheckReport, error) {
+	tables := CheckResult{Name: "table-checksums", Checked: uint64(len(b.db.Tables()))}
+	if err := b.db.VerifyChecksum(); err != nil {
+		tables.addError("%v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyspace, err := checkKeyspace(ctx, b.Iterator)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{tables, keyspace}}, nil
+}
+
 func (b *BadgerDB) Compact(start, end []byte) error {
 	// Explicit compaction is not currently supported in badger
 	return nil
@@ -190,6 +210,9 @@ var _ Batch = (*badgerDBBatch)(nil)
 type badgerDBBatch struct {
 	db *badger.DB
 	wb *badger.WriteBatch
+	// badger does not expose the length of write batches, so they are tracked here.
+	count int
+	size  int
 
 	// Calling db.Flush twice panics, so we must keep track of whether we've
 	// flushed already on our own. If Write can receive from the firstFlush
@@ -198,6 +221,7 @@ type badgerDBBatch struct {
 	// Upstream bug report:
 	// https://github.com/dgraph-io/badger/issues/1394
 	firstFlush chan struct{}
+	closed     bool
 }
 
 func (b *badgerDBBatch) Set(key, value []byte) error {
@@ -207,19 +231,40 @@ func (b *badgerDBBatch) Set(key, value []byte) error {
 	if value == nil {
 		return errValueNil
 	}
-	return b.wb.Set(key, value)
+	if err := b.wb.Set(key, value); err != nil {
+		return err
+	}
+	b.count++
+	b.size += len(key) + len(value)
+	return nil
 }
 
 func (b *badgerDBBatch) Delete(key []byte) error {
 	if len(key) == 0 {
 		return errKeyEmpty
 	}
-	return b.wb.Delete(key)
+	if err := b.wb.Delete(key); err != nil {
+		return err
+	}
+	b.count++
+	b.size += len(key)
+	return nil
+}
+
+// Count implements Batch.
+func (b *badgerDBBatch) Count() int {
+	return b.count
+}
+
+// SizeBytes implements Batch. It is the total size of the keys and values.
+func (b *badgerDBBatch) SizeBytes() int {
+	return b.size
 }
 
 func (b *badgerDBBatch) Write() error {
 	select {
 	case <-b.firstFlush:
+		b.count, b.size = 0, 0
 		return b.wb.Flush()
 	default:
 		return fmt.Errorf("batch already flushed")
@@ -230,12 +275,30 @@ func (b *badgerDBBatch) WriteSync() error {
 	return withSync(b.db, b.Write())
 }
 
+// Reset implements Batch. badger write batches cannot be reused once flushed, so the batch
+// starts a new one.
+func (b *badgerDBBatch) Reset() error {
+	if b.closed {
+		return errBatchClosed
+	}
+	select {
+	case <-b.firstFlush:
+	default:
+	}
+	b.wb.Cancel()
+	b.wb = b.db.NewWriteBatch()
+	b.firstFlush <- struct{}{}
+	b.count, b.size = 0, 0
+	return nil
+}
+
 func (b *badgerDBBatch) Close() error {
 	select {
 	case <-b.firstFlush: // a Flush after Cancel panics too
 	default:
 	}
 	b.wb.Cancel()
+	b.count, b.size, b.closed = 0, 0, true
 	return nil
 }
 
@@ -0,0 +1,904 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+func init() {
+	registerDBCreator(BitcaskDBBackend, func(name, dir string, _ *dbOptions) (DB, error) {
+		return NewBitcaskDB(name, dir)
+	})
+}
+
+// A bitcask database is a directory of numbered data files, which are only ever appended to. Every
+// write appends one record, made of the big-endian crc32 and length of its payload, followed by the
+// payload itself: a sequence of operations, each a type byte and the uvarint length-prefixed key,
+// followed by the uvarint length-prefixed value for sets. Batches are thus written atomically.
+const (
+	bitcaskRecordHeaderSize = 8
+	bitcaskDataFileSuffix   = ".data"
+
+	// bitcaskMaxFileSize is the size at which the active data file is rotated.
+	bitcaskMaxFileSize = 64 << 20
+	// bitcaskMergeMinGarbage is the number of bytes of overwritten and deleted entries above which
+	// a background merge is started, provided they also make up half of the data files.
+	bitcaskMergeMinGarbage = 32 << 20
+)
+
+var errBitcaskCorrupted = errors.New("bitcask data file corrupted")
+
+// bitcaskEntry locates the value of a key in the data files.
+type bitcaskEntry struct {
+	key    []byte
+	file   uint32
+	offset int64
+	size   uint32
+}
+
+func bitcaskEntryLess(a, b *bitcaskEntry) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// cost returns the number of bytes taken by the entry's operation in its data file.
+func (e *bitcaskEntry) cost() int64 {
+	return int64(1 + 2*binary.MaxVarintLen32 + len(e.key) + int(e.size))
+}
+
+// bitcaskObsoleteFile is a data file replaced by a merge, which is closed, and removed unless its
+// path was reused, once no iterator can read from it anymore.
+type bitcaskObsoleteFile struct {
+	file *os.File
+	path string
+}
+
+// BitcaskDB is an append-only database following the design of Bitcask: writes are appended to
+// the active data file, and an in-memory key directory maps every key to the location of its
+// latest value. A write is a single append, and a synced write a single append and fsync, making
+// it well suited for write-heavy, rarely scanned stores such as write-ahead logs. Reads take one
+// disk read, and all keys must fit in memory.
+//
+// Overwritten and deleted entries are reclaimed by merging all data files but the active one into
+// a file holding only the live entries. Merges run in the background once enough garbage has
+// accumulated, and on Compact.
+//
+// Iterators work on a snapshot of the key directory, and do not block writes.
+type BitcaskDB struct {
+	mtx        sync.RWMutex
+	dir        string
+	keydir     *btree.BTreeG[*bitcaskEntry]
+	files      map[uint32]*os.File
+	sizes      map[uint32]int64
+	activeID   uint32
+	totalBytes int64 // size of all data files
+	liveBytes  int64 // approximate size of the live entries
+	iterators  int
+	obsolete   []bitcaskObsoleteFile
+	merging    bool
+	mergeErr   error
+	closed     bool
+
+	mergeMtx sync.Mutex // serializes merges
+	mergeWG  sync.WaitGroup
+}
+
+var _ DB = (*BitcaskDB)(nil)
+
+// NewBitcaskDB opens or creates a bitcask database in the directory name.db within dir. A record
+// torn by a crash at the end of the last data file is truncated away.
+func NewBitcaskDB(name, dir string) (*BitcaskDB, error) {
+	path := filepath.Join(dir, name+".db")
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	db := &BitcaskDB{
+		dir:    path,
+		keydir: btree.NewG(bTreeDegree, bitcaskEntryLess),
+		files:  map[uint32]*os.File{},
+		sizes:  map[uint32]int64{},
+	}
+	if err := db.load(); err != nil {
+		db.closeFiles()
+		return nil, err
+	}
+	return db, nil
+}
+
+// load replays the data files into the key directory, and opens the active data file.
+func (db *BitcaskDB) load() error {
+	dirEntries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	var ids []uint32
+	for _, e := range dirEntries {
+		name := e.Name()
+		if strings.HasSuffix(name, tmpFileSuffix) {
+			// An interrupted merge, whose inputs are all still there.
+			if err := os.Remove(filepath.Join(db.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, bitcaskDataFileSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, bitcaskDataFileSuffix), 16, 32)
+		if err != nil {
+			return fmt.Errorf("unexpected file %q in bitcask database: %w", name, err)
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		f, err := os.OpenFile(db.filePath(id), os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		db.files[id] = f
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			return err
+		}
+		size, err := db.replay(id, data)
+		if err != nil {
+			if i < len(ids)-1 || !errors.Is(err, errBitcaskCorrupted) {
+				return err
+			}
+			// The tail of the last file was torn by a crash, and was never acknowledged.
+			if err := f.Truncate(size); err != nil {
+				return err
+			}
+		}
+		db.sizes[id] = size
+		db.totalBytes += size
+	}
+	if len(ids) == 0 {
+		return db.createFile(0)
+	}
+	db.activeID = ids[len(ids)-1]
+	return nil
+}
+
+// replay applies the records of a data file to the key directory, and returns the size of the
+// valid records.
+func (db *BitcaskDB) replay(id uint32, data []byte) (int64, error) {
+	offset := 0
+	for offset < len(data) {
+		if len(data)-offset < bitcaskRecordHeaderSize {
+			return int64(offset), fmt.Errorf("%w: truncated record header in file %d", errBitcaskCorrupted, id)
+		}
+		checksum := binary.BigEndian.Uint32(data[offset:])
+		length := int(binary.BigEndian.Uint32(data[offset+4:]))
+		payloadOffset := offset + bitcaskRecordHeaderSize
+		if length > len(data)-payloadOffset {
+			return int64(offset), fmt.Errorf("%w: truncated record in file %d", errBitcaskCorrupted, id)
+		}
+		payload := data[payloadOffset : payloadOffset+length]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return int64(offset), fmt.Errorf("%w: checksum mismatch in file %d", errBitcaskCorrupted, id)
+		}
+		ops, valueOffsets, err := decodeBitcaskPayload(payload)
+		if err != nil {
+			return int64(offset), fmt.Errorf("%w: %v in file %d", errBitcaskCorrupted, err, id)
+		}
+		db.apply(ops, id, int64(payloadOffset), valueOffsets)
+		offset = payloadOffset + length
+	}
+	return int64(offset), nil
+}
+
+// apply applies the operations of a record written to a data file at the given payload offset.
+func (db *BitcaskDB) apply(ops []operation, id uint32, payloadOffset int64, valueOffsets []int) {
+	for i, op := range ops {
+		if old, ok := db.keydir.Delete(&bitcaskEntry{key: op.key}); ok {
+			db.liveBytes -= old.cost()
+		}
+		if op.opType == opTypeSet {
+			e := &bitcaskEntry{
+				key:    cp(op.key),
+				file:   id,
+				offset: payloadOffset + int64(valueOffsets[i]),
+				size:   uint32(len(op.value)),
+			}
+			db.keydir.ReplaceOrInsert(e)
+			db.liveBytes += e.cost()
+		}
+	}
+}
+
+// encodeBitcaskRecord encodes a record of the given operations, and returns the offset of each
+// set value within the record payload.
+func encodeBitcaskRecord(ops []operation) ([]byte, []int) {
+	buf := make([]byte, bitcaskRecordHeaderSize)
+	valueOffsets := make([]int, len(ops))
+	for i, op := range ops {
+		buf = append(buf, byte(op.opType))
+		buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+		buf = append(buf, op.key...)
+		if op.opType == opTypeSet {
+			buf = binary.AppendUvarint(buf, uint64(len(op.value)))
+			valueOffsets[i] = len(buf) - bitcaskRecordHeaderSize
+			buf = append(buf, op.value...)
+		}
+	}
+	payload := buf[bitcaskRecordHeaderSize:]
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	return buf, valueOffsets
+}
+
+// decodeBitcaskPayload decodes the operations of a record payload, along with the offset of each
+// set value within the payload.
+func decodeBitcaskPayload(payload []byte) ([]operation, []int, error) {
+	var (
+		ops          []operation
+		valueOffsets []int
+		offset       int
+	)
+	readBytes := func() ([]byte, int, bool) {
+		n, size := binary.Uvarint(payload[offset:])
+		if size <= 0 || n > uint64(len(payload)-offset-size) {
+			return nil, 0, false
+		}
+		start := offset + size
+		offset = start + int(n)
+		return payload[start:offset], start, true
+	}
+	for offset < len(payload) {
+		typ := opType(payload[offset])
+		offset++
+		key, _, ok := readBytes()
+		if !ok || len(key) == 0 {
+			return nil, nil, errors.New("invalid key")
+		}
+		switch typ {
+		case opTypeSet:
+			value, valueOffset, ok := readBytes()
+			if !ok {
+				return nil, nil, errors.New("invalid value")
+			}
+			ops = append(ops, operation{opTypeSet, key, value})
+			valueOffsets = append(valueOffsets, valueOffset)
+		case opTypeDelete:
+			ops = append(ops, operation{opTypeDelete, key, nil})
+			valueOffsets = append(valueOffsets, 0)
+		default:
+			return nil, nil, fmt.Errorf("unknown operation %d", typ)
+		}
+	}
+	return ops, valueOffsets, nil
+}
+
+func (db *BitcaskDB) filePath(id uint32) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%08x%s", id, bitcaskDataFileSuffix))
+}
+
+// createFile creates a new active data file. It must be called with the lock held.
+func (db *BitcaskDB) createFile(id uint32) error {
+	f, err := os.OpenFile(db.filePath(id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	db.files[id] = f
+	db.sizes[id] = 0
+	db.activeID = id
+	return nil
+}
+
+// rotate syncs the active data file, and makes a new one active. It must be called with the lock
+// held.
+func (db *BitcaskDB) rotate() error {
+	if err := db.files[db.activeID].Sync(); err != nil {
+		return err
+	}
+	return db.createFile(db.activeID + 1)
+}
+
+// write appends a record of the given operations to the active data file.
+func (db *BitcaskDB) write(ops []operation, sync bool) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	record, valueOffsets := encodeBitcaskRecord(ops)
+	if len(record)-bitcaskRecordHeaderSize > int(^uint32(0)) {
+		return fmt.Errorf("record of %d bytes is too large", len(record))
+	}
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if db.closed {
+		return errors.New("database is closed")
+	}
+	if size := db.sizes[db.activeID]; size > 0 && size+int64(len(record)) > bitcaskMaxFileSize {
+		if err := db.rotate(); err != nil {
+			return err
+		}
+	}
+	f, offset := db.files[db.activeID], db.sizes[db.activeID]
+	// A failed write leaves the size unchanged, so that the next write overwrites it.
+	if _, err := f.WriteAt(record, offset); err != nil {
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	db.sizes[db.activeID] += int64(len(record))
+	db.totalBytes += int64(len(record))
+	db.apply(ops, db.activeID, offset+bitcaskRecordHeaderSize, valueOffsets)
+
+	if garbage := db.totalBytes - db.liveBytes; !db.merging &&
+		garbage >= bitcaskMergeMinGarbage && garbage*2 >= db.totalBytes {
+		db.merging = true
+		db.mergeWG.Add(1)
+		go func() {
+			defer db.mergeWG.Done()
+			err := db.merge()
+			db.mtx.Lock()
+			db.merging, db.mergeErr = false, err
+			db.mtx.Unlock()
+		}()
+	}
+	return nil
+}
+
+// merge rewrites the live entries of all data files but the active one into a single file, which
+// atomically replaces the oldest of them, and then removes the others from oldest to newest.
+// Replaying the remaining files on top of the merged file after a crash yields the same state,
+// since the merged file holds the final value of every key they contain.
+func (db *BitcaskDB) merge() error {
+	db.mergeMtx.Lock()
+	defer db.mergeMtx.Unlock()
+
+	db.mtx.Lock()
+	if db.closed || len(db.obsolete) > 0 {
+		// The files replaced by the previous merge must be removed first, as they could otherwise
+		// be replayed on top of the new merged file after a crash.
+		db.mtx.Unlock()
+		return nil
+	}
+	if db.sizes[db.activeID] > 0 {
+		if err := db.rotate(); err != nil {
+			db.mtx.Unlock()
+			return err
+		}
+	}
+	inputs := make(map[uint32]*os.File, len(db.files)-1)
+	outID := db.activeID
+	for id, f := range db.files {
+		if id != db.activeID {
+			inputs[id] = f
+			if id < outID {
+				outID = id
+			}
+		}
+	}
+	snapshot := db.keydir.Clone()
+	db.mtx.Unlock()
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	// Copy the live entries of the inputs. Entries overwritten in the meantime may be copied too,
+	// but are superseded by the newer data files.
+	tmp := db.filePath(outID) + tmpFileSuffix
+	out, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	var (
+		moved   = map[*bitcaskEntry]*bitcaskEntry{}
+		buf     []byte
+		written int64
+	)
+	snapshot.Ascend(func(e *bitcaskEntry) bool {
+		f, ok := inputs[e.file]
+		if !ok {
+			return true
+		}
+		value := make([]byte, e.size)
+		if _, err = f.ReadAt(value, e.offset); err != nil {
+			return false
+		}
+		record, valueOffsets := encodeBitcaskRecord([]operation{{opTypeSet, e.key, value}})
+		moved[e] = &bitcaskEntry{
+			key:    e.key,
+			file:   outID,
+			offset: written + int64(len(buf)+bitcaskRecordHeaderSize+valueOffsets[0]),
+			size:   e.size,
+		}
+		buf = append(buf, record...)
+		if len(buf) >= 1<<20 {
+			if _, err = out.Write(buf); err != nil {
+				return false
+			}
+			written += int64(len(buf))
+			buf = buf[:0]
+		}
+		return true
+	})
+	if err == nil {
+		_, err = out.Write(buf)
+		written += int64(len(buf))
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if db.closed {
+		out.Close()
+		os.Remove(tmp)
+		return nil
+	}
+	if err := os.Rename(tmp, db.filePath(outID)); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	// Only entries which were not overwritten since the snapshot are moved.
+	for old, e := range moved {
+		if cur, ok := db.keydir.Get(old); ok && cur == old {
+			db.keydir.ReplaceOrInsert(e)
+		}
+	}
+	ids := make([]uint32, 0, len(inputs))
+	for id := range inputs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		obsolete := bitcaskObsoleteFile{file: inputs[id], path: db.filePath(id)}
+		if id == outID {
+			obsolete.path = ""
+		}
+		db.obsolete = append(db.obsolete, obsolete)
+		db.totalBytes -= db.sizes[id]
+		delete(db.files, id)
+		delete(db.sizes, id)
+	}
+	db.files[outID] = out
+	db.sizes[outID] = written
+	db.totalBytes += written
+	if db.iterators == 0 {
+		return db.releaseObsolete()
+	}
+	return nil
+}
+
+// releaseObsolete closes the files replaced by a merge, and removes them in order. It must be
+// called with the lock held, and no open iterators.
+func (db *BitcaskDB) releaseObsolete() error {
+	for i, o := range db.obsolete {
+		err := o.file.Close()
+		if err == nil && o.path != "" {
+			err = os.Remove(o.path)
+		}
+		if err != nil {
+			// Keep the remaining files, so that they are still removed in order.
+			db.obsolete = db.obsolete[i+1:]
+			return err
+		}
+	}
+	db.obsolete = nil
+	return nil
+}
+
+// Get implements DB.
+func (db *BitcaskDB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	e, ok := db.keydir.Get(&bitcaskEntry{key: key})
+	if !ok {
+		return nil, nil
+	}
+	return readBitcaskValue(db.files, e)
+}
+
+// readBitcaskValue reads the value of an entry from the given data files.
+func readBitcaskValue(files map[uint32]*os.File, e *bitcaskEntry) ([]byte, error) {
+	value := make([]byte, e.size)
+	if _, err := files[e.file].ReadAt(value, e.offset); err != nil {
+		return nil, fmt.Errorf("failed to read value of key %X: %w", e.key, err)
+	}
+	return value, nil
+}
+
+// Has implements DB.
+func (db *BitcaskDB) Has(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return db.keydir.Has(&bitcaskEntry{key: key}), nil
+}
+
+// Set implements DB.
+func (db *BitcaskDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return db.write([]operation{{opTypeSet, key, value}}, false)
+}
+
+// SetSync implements DB.
+func (db *BitcaskDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return db.write([]operation{{opTypeSet, key, value}}, true)
+}
+
+// Delete implements DB.
+func (db *BitcaskDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return db.write([]operation{{opTypeDelete, key, nil}}, false)
+}
+
+// DeleteSync implements DB.
+func (db *BitcaskDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return db.write([]operation{{opTypeDelete, key, nil}}, true)
+}
+
+// Iterator implements DB.
+func (db *BitcaskDB) Iterator(start, end []byte) (Iterator, error) {
+	return db.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (db *BitcaskDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return db.newIterator(start, end, true)
+}
+
+func (db *BitcaskDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	files := make(map[uint32]*os.File, len(db.files))
+	for id, f := range db.files {
+		files[id] = f
+	}
+	db.iterators++
+	return newBitcaskDBIterator(db, db.keydir.Clone(), files, start, end, isReverse), nil
+}
+
+// Close implements DB. It waits for a running merge to finish.
+func (db *BitcaskDB) Close() error {
+	db.mtx.Lock()
+	if db.closed {
+		db.mtx.Unlock()
+		return nil
+	}
+	db.closed = true
+	db.mtx.Unlock()
+	db.mergeWG.Wait()
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	var err error
+	if f, ok := db.files[db.activeID]; ok {
+		err = f.Sync()
+	}
+	if releaseErr := db.releaseObsolete(); err == nil {
+		err = releaseErr
+	}
+	if closeErr := db.closeFiles(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// closeFiles closes all data files.
+func (db *BitcaskDB) closeFiles() error {
+	var err error
+	for id, f := range db.files {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		delete(db.files, id)
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (db *BitcaskDB) NewBatch() Batch {
+	return &bitcaskDBBatch{db: db}
+}
+
+// Print implements DB.
+func (db *BitcaskDB) Print() error {
+	itr, err := db.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		fmt.Printf("[%X]:\t[%X]\n", itr.Key(), itr.Value())
+	}
+	return itr.Error()
+}
+
+// Stats implements DB.
+func (db *BitcaskDB) Stats() map[string]string {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	stats := map[string]string{
+		"database.type":       "bitcaskDB",
+		"database.size":       strconv.Itoa(db.keydir.Len()),
+		"bitcask.files":       strconv.Itoa(len(db.files)),
+		"bitcask.total_bytes": strconv.FormatInt(db.totalBytes, 10),
+		"bitcask.live_bytes":  strconv.FormatInt(db.liveBytes, 10),
+	}
+	if db.mergeErr != nil {
+		stats["bitcask.merge_error"] = db.mergeErr.Error()
+	}
+	return stats
+}
+
+// Compact implements DB. It merges all data files, regardless of the given range.
+func (db *BitcaskDB) Compact(_, _ []byte) error {
+	return db.merge()
+}
+
+// bitcaskDBIterator iterates over a snapshot of the key directory, reading values from the data
+// files which existed when it was created. They are kept open until the iterator is closed.
+type bitcaskDBIterator struct {
+	db        *BitcaskDB
+	keydir    *btree.BTreeG[*bitcaskEntry]
+	files     map[uint32]*os.File
+	start     []byte
+	end       []byte
+	isReverse bool
+	entry     *bitcaskEntry
+	value     []byte
+	err       error
+}
+
+var _ Iterator = (*bitcaskDBIterator)(nil)
+
+func newBitcaskDBIterator(db *BitcaskDB, keydir *btree.BTreeG[*bitcaskEntry], files map[uint32]*os.File,
+	start, end []byte, isReverse bool,
+) *bitcaskDBIterator {
+	itr := &bitcaskDBIterator{
+		db:        db,
+		keydir:    keydir,
+		files:     files,
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+	}
+	switch {
+	case !isReverse && start == nil:
+		itr.seek(nil, false)
+	case !isReverse:
+		itr.seek(start, true)
+	case end == nil:
+		itr.seek(nil, false)
+	default:
+		itr.seek(end, false)
+	}
+	return itr
+}
+
+// seek moves to the first entry after pivot in the iteration order, or to the first entry at all if
+// pivot is nil. If inclusive is set, an entry with the pivot key itself is also accepted.
+func (itr *bitcaskDBIterator) seek(pivot []byte, inclusive bool) {
+	itr.entry, itr.value = nil, nil
+	visit := func(e *bitcaskEntry) bool {
+		if !inclusive && pivot != nil && bytes.Equal(e.key, pivot) {
+			return true
+		}
+		itr.entry = e
+		return false
+	}
+	switch {
+	case itr.isReverse && pivot == nil:
+		itr.keydir.Descend(visit)
+	case itr.isReverse:
+		itr.keydir.DescendLessOrEqual(&bitcaskEntry{key: pivot}, visit)
+	case pivot == nil:
+		itr.keydir.Ascend(visit)
+	default:
+		itr.keydir.AscendGreaterOrEqual(&bitcaskEntry{key: pivot}, visit)
+	}
+	if itr.entry == nil {
+		return
+	}
+	if itr.isReverse && itr.start != nil && bytes.Compare(itr.entry.key, itr.start) < 0 {
+		itr.entry = nil
+	}
+	if !itr.isReverse && itr.end != nil && bytes.Compare(itr.entry.key, itr.end) >= 0 {
+		itr.entry = nil
+	}
+}
+
+// Domain implements Iterator.
+func (itr *bitcaskDBIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *bitcaskDBIterator) Valid() bool {
+	return itr.entry != nil && itr.err == nil
+}
+
+// Next implements Iterator.
+func (itr *bitcaskDBIterator) Next() {
+	itr.assertIsValid()
+	itr.seek(itr.entry.key, false)
+}
+
+// Key implements Iterator.
+func (itr *bitcaskDBIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.entry.key
+}
+
+// Value implements Iterator.
+func (itr *bitcaskDBIterator) Value() []byte {
+	itr.assertIsValid()
+	if itr.value == nil {
+		value, err := readBitcaskValue(itr.files, itr.entry)
+		if err != nil {
+			itr.err = err
+			return nil
+		}
+		itr.value = value
+	}
+	return itr.value
+}
+
+// Error implements Iterator.
+func (itr *bitcaskDBIterator) Error() error {
+	return itr.err
+}
+
+// Close implements Iterator.
+func (itr *bitcaskDBIterator) Close() error {
+	if itr.keydir == nil {
+		return nil
+	}
+	itr.keydir, itr.files, itr.entry = nil, nil, nil
+	itr.db.mtx.Lock()
+	defer itr.db.mtx.Unlock()
+	itr.db.iterators--
+	if itr.db.iterators == 0 && !itr.db.closed {
+		return itr.db.releaseObsolete()
+	}
+	return nil
+}
+
+func (itr *bitcaskDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
+
+// bitcaskDBBatch buffers operations, which are appended to the database as a single record.
+type bitcaskDBBatch struct {
+	db      *BitcaskDB
+	ops     []operation
+	size    int        // of the keys and values of ops
+	written *BitcaskDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*bitcaskDBBatch)(nil)
+
+// Set implements Batch.
+func (b *bitcaskDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.db == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *bitcaskDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.db == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *bitcaskDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *bitcaskDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *bitcaskDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *bitcaskDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *bitcaskDBBatch) write(sync bool) error {
+	if b.db == nil {
+		return errBatchClosed
+	}
+	if err := b.db.write(b.ops, sync); err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.db, b.written, b.ops, b.size = nil, b.db, b.ops[:0], 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *bitcaskDBBatch) Reset() error {
+	if b.db == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.db, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *bitcaskDBBatch) Close() error {
+	b.db, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcaskDBReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	require.NoError(t, db.SetSync(bz("a"), bz("1")))
+	require.NoError(t, db.Set(bz("b"), []byte{}))
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set(bz("c"), bz("3")))
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.WriteSync())
+	require.Equal(t, errBatchClosed, batch.Write())
+	require.NoError(t, db.Close())
+
+	// Tear the last record, as if the process crashed while appending it.
+	path := filepath.Join(dir, "bitcask.db", "00000000.data")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 2, 3, 4, 0, 0, 0, 9, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	db, err = NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	checkValue(t, db, bz("a"), nil)
+	checkValue(t, db, bz("b"), []byte{})
+	checkValue(t, db, bz("c"), bz("3"))
+	require.NoError(t, db.Set(bz("d"), bz("4")))
+	require.NoError(t, db.Close())
+
+	db, err = NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	defer db.Close()
+	checkValue(t, db, bz("d"), bz("4"))
+	require.Equal(t, "3", db.Stats()["database.size"])
+}
+
+func TestBitcaskDBMerge(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	for round := int64(0); round < 3; round++ {
+		for i := int64(0); i < 100; i++ {
+			require.NoError(t, db.Set(int642Bytes(i), int642Bytes(i*round)))
+		}
+	}
+	for i := int64(50); i < 100; i++ {
+		require.NoError(t, db.Delete(int642Bytes(i)))
+	}
+
+	// An open iterator keeps reading the merged files.
+	itr, err := db.ReverseIterator(int642Bytes(45), int642Bytes(55))
+	require.NoError(t, err)
+	require.NoError(t, db.Set(int642Bytes(1), bz("new")))
+	require.NoError(t, db.Compact(nil, nil))
+	require.NoError(t, db.Set(int642Bytes(2), bz("new")))
+	require.NoError(t, db.Compact(nil, nil))
+	verifyIterator(t, itr, []int64{49, 48, 47, 46, 45}, "reverse iterator")
+	require.NoError(t, itr.Close())
+
+	require.NoError(t, db.Compact(nil, nil))
+	checkValue(t, db, int642Bytes(1), bz("new"))
+	checkValue(t, db, int642Bytes(2), bz("new"))
+	checkValue(t, db, int642Bytes(3), int642Bytes(6))
+	checkValue(t, db, int642Bytes(60), nil)
+	require.NoError(t, db.Close())
+
+	files, err := os.ReadDir(filepath.Join(dir, "bitcask.db"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	db, err = NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	defer db.Close()
+	checkValue(t, db, int642Bytes(1), bz("new"))
+	checkValue(t, db, int642Bytes(3), int642Bytes(6))
+	checkValue(t, db, int642Bytes(60), nil)
+	itr, err = db.Iterator(int642Bytes(47), nil)
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{47, 48, 49}, "forward iterator")
+	require.NoError(t, itr.Close())
+}
+
+func TestBitcaskDBCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewBitcaskDB("bitcask", dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Set(bz("a"), bz("1")))
+	require.NoError(t, db.Compact(nil, nil))
+	require.NoError(t, db.Set(bz("b"), bz("2")))
+	require.NoError(t, db.Close())
+
+	// Corruption outside of the last data file cannot be a torn write.
+	path := filepath.Join(dir, "bitcask.db", "00000000.data")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	_, err = NewBitcaskDB("bitcask", dir)
+	require.ErrorIs(t, err, errBitcaskCorrupted)
+}
@@ -4,6 +4,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -15,7 +16,7 @@ import (
 var bucket = []byte("tm")
 
 func init() {
-	registerDBCreator(BoltDBBackend, func(name, dir string) (DB, error) {
+	registerDBCreator(BoltDBBackend, func(name, dir string, _ *dbOptions) (DB, error) {
 		return NewBoltDB(name, dir)
 	})
 }
@@ -175,6 +176,32 @@ func (bdb *BoltDB) Stats() map[string]string {
 	return m
 }
 
+var _ Checker = (*BoltDB)(nil)
+
+// Check implements Checker. It runs bbolt's consistency check of all pages, within a read
+// transaction, then iterates over the whole keyspace.
+func (bdb *BoltDB) Check(ctx context.Context) (*CheckReport, error) {
+	pages := CheckResult{Name: "pages"}
+	err := bdb.db.View(func(tx *bbolt.Tx) error {
+		pages.Checked = uint64(tx.Size() / int64(bdb.db.Info().PageSize))
+		for err := range tx.Check() {
+			pages.addError("%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyspace, err := checkKeyspace(ctx, bdb.Iterator)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{pages, keyspace}}, nil
+}
+
 // NewBatch implements DB.
 func (bdb *BoltDB) NewBatch() Batch {
 	return newBoltDBBatch(bdb)
@@ -7,8 +7,10 @@ import "go.etcd.io/bbolt"
 
 // boltDBBatch stores operations internally and dumps them to BoltDB on Write().
 type boltDBBatch struct {
-	db  *BoltDB
-	ops []operation
+	db      *BoltDB
+	ops     []operation
+	size    int         // of the keys and values of ops
+	written []operation // the cleared ops once written, reused by Reset
 }
 
 var _ Batch = (*boltDBBatch)(nil)
@@ -31,6 +33,7 @@ func (b *boltDBBatch) Set(key, value []byte) error {
 	if b.ops == nil {
 		return errBatchClosed
 	}
+	b.size += len(key) + len(value)
 	b.ops = append(b.ops, operation{opTypeSet, key, value})
 	return nil
 }
@@ -43,10 +46,21 @@ func (b *boltDBBatch) Delete(key []byte) error {
 	if b.ops == nil {
 		return errBatchClosed
 	}
+	b.size += len(key)
 	b.ops = append(b.ops, operation{opTypeDelete, key, nil})
 	return nil
 }
 
+// Count implements Batch.
+func (b *boltDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *boltDBBatch) SizeBytes() int {
+	return b.size
+}
+
 // Write implements Batch.
 func (b *boltDBBatch) Write() error {
 	if b.ops == nil {
@@ -71,8 +85,11 @@ func (b *boltDBBatch) Write() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.ops, b.size, b.written = nil, 0, b.ops[:0]
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -80,8 +97,21 @@ func (b *boltDBBatch) WriteSync() error {
 	return b.Write()
 }
 
+// Reset implements Batch.
+func (b *boltDBBatch) Reset() error {
+	if b.ops == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.ops, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
 // Close implements Batch.
 func (b *boltDBBatch) Close() error {
-	b.ops = nil
+	b.ops, b.size, b.written = nil, 0, nil
 	return nil
 }
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// cachingDBEntryOverhead approximates the memory used by a cache entry besides its key and value.
+const cachingDBEntryOverhead = 96
+
+// CachingDB wraps a database with an in-memory LRU cache of the values read with Get, including
+// keys found to be missing, so that reads of hot keys do not reach the underlying database. The
+// cached entries of keys written through the database, directly or with batches, are invalidated.
+// Writes made to the underlying database directly are not seen, so it must not be written to by
+// other means.
+//
+// Iterators are served by the underlying database, and do not populate the cache.
+type CachingDB struct {
+	db DB
+
+	mtx      sync.Mutex
+	lru      *list.List // of *cachingDBEntry, most recently used first
+	entries  map[string]*list.Element
+	size     int
+	maxSize  int
+	writes   uint64 // incremented on every write, to discard reads racing with writes
+	hits     uint64
+	misses   uint64
+	disabled bool
+}
+
+var _ DB = (*CachingDB)(nil)
+
+// cachingDBEntry is a cached value, which is nil for missing keys.
+type cachingDBEntry struct {
+	key   string
+	value []byte
+}
+
+func (e *cachingDBEntry) size() int {
+	return len(e.key) + len(e.value) + cachingDBEntryOverhead
+}
+
+// NewCachingDB wraps db with a cache of at most sizeBytes bytes. A size of 0 disables caching.
+func NewCachingDB(db DB, sizeBytes int) *CachingDB {
+	return &CachingDB{
+		db:       db,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		maxSize:  sizeBytes,
+		disabled: sizeBytes <= 0,
+	}
+}
+
+// lookup returns the cached value of key, and whether it was cached, along with the write counter
+// to pass to insert on a miss.
+func (cdb *CachingDB) lookup(key []byte) ([]byte, bool, uint64) {
+	cdb.mtx.Lock()
+	defer cdb.mtx.Unlock()
+	if el, ok := cdb.entries[string(key)]; ok {
+		cdb.lru.MoveToFront(el)
+		cdb.hits++
+		return el.Value.(*cachingDBEntry).value, true, 0
+	}
+	cdb.misses++
+	return nil, false, cdb.writes
+}
+
+// insert caches the value of key read from the underlying database, unless a write happened since
+// the read started, as the value could then be stale.
+func (cdb *CachingDB) insert(key, value []byte, writes uint64) {
+	e := &cachingDBEntry{key: string(key), value: value}
+	if cdb.disabled || e.size() > cdb.maxSize {
+		return
+	}
+	cdb.mtx.Lock()
+	defer cdb.mtx.Unlock()
+	if cdb.writes != writes {
+		return
+	}
+	if el, ok := cdb.entries[e.key]; ok {
+		cdb.remove(el)
+	}
+	cdb.entries[e.key] = cdb.lru.PushFront(e)
+	cdb.size += e.size()
+	for cdb.size > cdb.maxSize {
+		cdb.remove(cdb.lru.Back())
+	}
+}
+
+// remove removes a cache entry. It must be called with the lock held.
+func (cdb *CachingDB) remove(el *list.Element) {
+	e := cdb.lru.Remove(el).(*cachingDBEntry)
+	delete(cdb.entries, e.key)
+	cdb.size -= e.size()
+}
+
+// invalidate removes the cached entries of the given keys.
+func (cdb *CachingDB) invalidate(keys ...[]byte) {
+	cdb.mtx.Lock()
+	defer cdb.mtx.Unlock()
+	cdb.writes++
+	for _, key := range keys {
+		if el, ok := cdb.entries[string(key)]; ok {
+			cdb.remove(el)
+		}
+	}
+}
+
+// Get implements DB.
+func (cdb *CachingDB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	value, ok, writes := cdb.lookup(key)
+	if !ok {
+		var err error
+		value, err = cdb.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		cdb.insert(key, value, writes)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	// The cached value is copied, so that callers modifying it do not corrupt the cache.
+	return cp(value), nil
+}
+
+// Has implements DB.
+func (cdb *CachingDB) Has(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	value, ok, _ := cdb.lookup(key)
+	if ok {
+		return value != nil, nil
+	}
+	return cdb.db.Has(key)
+}
+
+// Set implements DB.
+func (cdb *CachingDB) Set(key []byte, value []byte) error {
+	defer cdb.invalidate(key)
+	return cdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (cdb *CachingDB) SetSync(key []byte, value []byte) error {
+	defer cdb.invalidate(key)
+	return cdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (cdb *CachingDB) Delete(key []byte) error {
+	defer cdb.invalidate(key)
+	return cdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (cdb *CachingDB) DeleteSync(key []byte) error {
+	defer cdb.invalidate(key)
+	return cdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (cdb *CachingDB) Iterator(start, end []byte) (Iterator, error) {
+	return cdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (cdb *CachingDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return cdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (cdb *CachingDB) Close() error {
+	cdb.mtx.Lock()
+	cdb.lru.Init()
+	cdb.entries = map[string]*list.Element{}
+	cdb.size = 0
+	cdb.mtx.Unlock()
+	return cdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (cdb *CachingDB) NewBatch() Batch {
+	return &cachingDBBatch{
+		cdb:   cdb,
+		batch: cdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (cdb *CachingDB) Print() error {
+	return cdb.db.Print()
+}
+
+// Stats implements DB.
+func (cdb *CachingDB) Stats() map[string]string {
+	stats := cdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	cdb.mtx.Lock()
+	defer cdb.mtx.Unlock()
+	stats["cache.entries"] = strconv.Itoa(len(cdb.entries))
+	stats["cache.size"] = strconv.Itoa(cdb.size)
+	stats["cache.hits"] = strconv.FormatUint(cdb.hits, 10)
+	stats["cache.misses"] = strconv.FormatUint(cdb.misses, 10)
+	return stats
+}
+
+// Compact implements DB.
+func (cdb *CachingDB) Compact(start, end []byte) error {
+	return cdb.db.Compact(start, end)
+}
+
+// cachingDBBatch records the keys written by a batch, whose cached entries are invalidated when
+// it is written.
+type cachingDBBatch struct {
+	cdb   *CachingDB
+	batch Batch
+	keys  [][]byte
+}
+
+var _ Batch = (*cachingDBBatch)(nil)
+
+// Set implements Batch.
+func (b *cachingDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, cp(key))
+	return nil
+}
+
+// Delete implements Batch.
+func (b *cachingDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, cp(key))
+	return nil
+}
+
+// Count implements Batch.
+func (b *cachingDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *cachingDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *cachingDBBatch) Write() error {
+	defer b.cdb.invalidate(b.keys...)
+	return b.batch.Write()
+}
+
+// WriteSync implements Batch.
+func (b *cachingDBBatch) WriteSync() error {
+	defer b.cdb.invalidate(b.keys...)
+	return b.batch.WriteSync()
+}
+
+// Reset implements Batch.
+func (b *cachingDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.keys)
+	b.keys = b.keys[:0]
+	return nil
+}
+
+// Close implements Batch.
+func (b *cachingDBBatch) Close() error {
+	return b.batch.Close()
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingDB(t *testing.T) {
+	mem := NewMemDB()
+	require.NoError(t, mem.Set(bz("a"), bz("1")))
+	cdb := NewCachingDB(mem, 1<<20)
+	defer cdb.Close()
+
+	checkValue(t, cdb, bz("a"), bz("1"))
+	checkValue(t, cdb, bz("b"), nil)
+	// Hits are served from the cache, including missing keys.
+	require.NoError(t, mem.Set(bz("a"), bz("stale")))
+	require.NoError(t, mem.Set(bz("b"), bz("stale")))
+	checkValue(t, cdb, bz("a"), bz("1"))
+	checkValue(t, cdb, bz("b"), nil)
+	ok, err := cdb.Has(bz("b"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	stats := cdb.Stats()
+	require.Equal(t, "3", stats["cache.hits"])
+	require.Equal(t, "2", stats["cache.misses"])
+	require.Equal(t, "memDB", stats["database.type"])
+
+	// Writes invalidate cached entries.
+	require.NoError(t, cdb.Set(bz("a"), bz("2")))
+	require.NoError(t, cdb.Delete(bz("b")))
+	checkValue(t, cdb, bz("a"), bz("2"))
+	checkValue(t, cdb, bz("b"), nil)
+
+	batch := cdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("b"), bz("3")))
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.Write())
+	checkValue(t, cdb, bz("a"), nil)
+	checkValue(t, cdb, bz("b"), bz("3"))
+
+	// Modifying a returned value does not corrupt the cache.
+	value, err := cdb.Get(bz("b"))
+	require.NoError(t, err)
+	value[0] = 'x'
+	checkValue(t, cdb, bz("b"), bz("3"))
+}
+
+func TestCachingDBEviction(t *testing.T) {
+	mem := NewMemDB()
+	for i := int64(0); i < 10; i++ {
+		require.NoError(t, mem.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	entrySize := (&cachingDBEntry{key: string(int642Bytes(0)), value: int642Bytes(0)}).size()
+	cdb := NewCachingDB(mem, 3*entrySize)
+	defer cdb.Close()
+
+	for i := int64(0); i < 4; i++ {
+		checkValue(t, cdb, int642Bytes(i), int642Bytes(i))
+	}
+	require.Equal(t, "3", cdb.Stats()["cache.entries"])
+	// The least recently used entry was evicted.
+	checkValue(t, cdb, int642Bytes(0), int642Bytes(0))
+	require.Equal(t, "5", cdb.Stats()["cache.misses"])
+	checkValue(t, cdb, int642Bytes(3), int642Bytes(3))
+	require.Equal(t, "1", cdb.Stats()["cache.hits"])
+
+	disabled := NewCachingDB(mem, 0)
+	checkValue(t, disabled, int642Bytes(1), int642Bytes(1))
+	require.Equal(t, "0", disabled.Stats()["cache.entries"])
+}
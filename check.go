@@ -0,0 +1,102 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// checkCancelInterval is the number of keys between checks of the context of a keyspace check.
+const checkCancelInterval = 1024
+
+// maxCheckErrors is the number of problems recorded per check, so that a badly corrupted database
+// does not produce an unbounded report.
+const maxCheckErrors = 100
+
+// Checker is implemented by databases which can check their integrity with the deepest
+// verification their engine offers. Check returns an error if the check could not run, e.g. as
+// ctx was canceled, and reports the problems found otherwise.
+type Checker interface {
+	Check(ctx context.Context) (*CheckReport, error)
+}
+
+// CheckReport is the result of checking the integrity of a database. It aggregates the results
+// of the checks run by the backend.
+type CheckReport struct {
+	Checks []CheckResult `json:"checks"`
+}
+
+// CheckResult is the result of one check of a database.
+type CheckResult struct {
+	// Name identifies the check, e.g. "keyspace" or "table-checksums".
+	Name string `json:"name"`
+	// Checked is the number of items checked, e.g. keys or tables.
+	Checked uint64 `json:"checked"`
+	// Errors describes the problems found, up to 100 of them.
+	Errors []string `json:"errors,omitempty"`
+	// Truncated is set if further problems were found but not recorded.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// OK reports whether all checks passed.
+func (r *CheckReport) OK() bool {
+	for _, c := range r.Checks {
+		if len(c.Errors) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addError records a problem found by the check.
+func (c *CheckResult) addError(format string, args ...any) {
+	if len(c.Errors) >= maxCheckErrors {
+		c.Truncated = true
+		return
+	}
+	c.Errors = append(c.Errors, fmt.Sprintf(format, args...))
+}
+
+// Check checks the integrity of db with its Check method if it implements Checker, or else by
+// iterating over its keyspace with checkKeyspace.
+func Check(ctx context.Context, db DB) (*CheckReport, error) {
+	if checker, ok := db.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	result, err := checkKeyspace(ctx, db.Iterator)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{result}}, nil
+}
+
+// checkKeyspace iterates over a whole keyspace, with an iterator created by newIterator, checking
+// that keys are strictly increasing and that the iteration completes, since most engines verify
+// the checksums of the blocks they read. It returns an error only if ctx is canceled.
+func checkKeyspace(ctx context.Context, newIterator func(start, end []byte) (Iterator, error)) (CheckResult, error) {
+	result := CheckResult{Name: "keyspace"}
+	itr, err := newIterator(nil, nil)
+	if err != nil {
+		result.addError("creating iterator: %v", err)
+		return result, nil
+	}
+	defer itr.Close()
+	var prev []byte
+	for ; itr.Valid(); itr.Next() {
+		if result.Checked%checkCancelInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+		}
+		key := UnsafeKey(itr)
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			result.addError("key %x after key %x", key, prev)
+		}
+		prev = append(prev[:0], key...)
+		result.Checked++
+	}
+	if err := itr.Error(); err != nil {
+		result.addError("iterating after %d keys: %v", result.Checked, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), bz("v")))
+	}
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, []CheckResult{{Name: "keyspace", Checked: 10}}, report.Checks)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Check(ctx, db)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGoLevelDBCheck(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+	createCorruptedGoLevelDB(t, name)
+
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer db.Close()
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Len(t, report.Checks, 2)
+	tables := report.Checks[0]
+	require.Equal(t, "table-checksums", tables.Name)
+	require.EqualValues(t, 1, tables.Checked)
+	require.Len(t, tables.Errors, 1)
+	require.NotEmpty(t, report.Checks[1].Errors, "strict reads must fail on the corrupted table")
+}
+
+func TestPebbleDBCheck(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewPebbleDB("test", dir)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), make([]byte, 100)))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+
+	report, err := db.Check(context.Background())
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report)
+	require.Equal(t, []string{"levels", "table-checksums", "keyspace"},
+		[]string{report.Checks[0].Name, report.Checks[1].Name, report.Checks[2].Name})
+	require.EqualValues(t, 1000, report.Checks[0].Checked)
+	require.EqualValues(t, 1, report.Checks[1].Checked)
+	require.EqualValues(t, 1000, report.Checks[2].Checked)
+	require.NoError(t, db.Close())
+
+	tables, err := filepath.Glob(filepath.Join(dir, "test.db", "*.sst"))
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	f, err := os.OpenFile(tables[0], os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("corrupted"), 1000)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	db, err = NewPebbleDB("test", dir)
+	require.NoError(t, err)
+	defer db.Close()
+	report, err = db.Check(context.Background())
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.NotEmpty(t, report.Checks[1].Errors)
+}
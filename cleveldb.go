@@ -4,6 +4,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -11,7 +12,7 @@ import (
 )
 
 func init() {
-	dbCreator := func(name string, dir string) (DB, error) {
+	dbCreator := func(name string, dir string, _ *dbOptions) (DB, error) {
 		return NewCLevelDB(name, dir)
 	}
 	registerDBCreator(CLevelDBBackend, dbCreator)
@@ -181,6 +182,24 @@ func (db *CLevelDB) Stats() map[string]string {
 	return stats
 }
 
+var _ Checker = (*CLevelDB)(nil)
+
+// Check implements Checker. It iterates over the whole keyspace with checksum verification of all
+// blocks read, without filling the block cache.
+func (db *CLevelDB) Check(ctx context.Context) (*CheckReport, error) {
+	ro := levigo.NewReadOptions()
+	ro.SetVerifyChecksums(true)
+	ro.SetFillCache(false)
+	defer ro.Close()
+	keyspace, err := checkKeyspace(ctx, func(start, end []byte) (Iterator, error) {
+		return newCLevelDBIterator(db.db.NewIterator(ro), start, end, false), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{keyspace}}, nil
+}
+
 // NewBatch implements DB.
 func (db *CLevelDB) NewBatch() Batch {
 	return newCLevelDBBatch(db)
@@ -9,6 +9,11 @@ import "github.com/jmhodges/levigo"
 type cLevelDBBatch struct {
 	db    *CLevelDB
 	batch *levigo.WriteBatch
+	// written is the batch once written, reused by Reset.
+	written *levigo.WriteBatch
+	// levigo does not expose the length of batches, so they are tracked here.
+	count int
+	size  int
 }
 
 func newCLevelDBBatch(db *CLevelDB) *cLevelDBBatch {
@@ -30,6 +35,8 @@ func (b *cLevelDBBatch) Set(key, value []byte) error {
 		return errBatchClosed
 	}
 	b.batch.Put(key, value)
+	b.count++
+	b.size += len(key) + len(value)
 	return nil
 }
 
@@ -42,9 +49,21 @@ func (b *cLevelDBBatch) Delete(key []byte) error {
 		return errBatchClosed
 	}
 	b.batch.Delete(key)
+	b.count++
+	b.size += len(key)
 	return nil
 }
 
+// Count implements Batch.
+func (b *cLevelDBBatch) Count() int {
+	return b.count
+}
+
+// SizeBytes implements Batch. It is the total size of the keys and values.
+func (b *cLevelDBBatch) SizeBytes() int {
+	return b.size
+}
+
 // Write implements Batch.
 func (b *cLevelDBBatch) Write() error {
 	if b.batch == nil {
@@ -54,8 +73,10 @@ func (b *cLevelDBBatch) Write() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written, b.count, b.size = nil, b.batch, 0, 0
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -67,16 +88,33 @@ func (b *cLevelDBBatch) WriteSync() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written, b.count, b.size = nil, b.batch, 0, 0
+	return nil
+}
+
+// Reset implements Batch. The underlying levigo batch is reused.
+func (b *cLevelDBBatch) Reset() error {
+	if b.batch == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.batch, b.written = b.written, nil
+	}
+	b.batch.Clear()
+	b.count, b.size = 0, 0
 	return nil
 }
 
 // Close implements Batch.
 func (b *cLevelDBBatch) Close() error {
-	if b.batch != nil {
-		b.batch.Close()
-		b.batch = nil
+	for _, batch := range []*levigo.WriteBatch{b.batch, b.written} {
+		if batch != nil {
+			batch.Close()
+		}
 	}
+	b.batch, b.written = nil, nil
+	b.count, b.size = 0, 0
 	return nil
 }
@@ -0,0 +1,35 @@
+package db
+
+import "time"
+
+// Clock is the source of time used by features measuring durations or waiting, such as event
+// timestamps, compaction durations and webhook retries. Tests can substitute a manually advanced
+// clock, e.g. dbtest.ManualClock, to exercise them deterministically without sleeping.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel receiving the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock reading the system time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// WithClock sets the clock used by the database opened by NewDB. Defaults to SystemClock.
+func WithClock(clock Clock) Option {
+	return func(o *dbOptions) {
+		o.clock = clock
+	}
+}
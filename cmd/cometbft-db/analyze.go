@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func runAnalyze(args []string, out io.Writer) error {
+	var (
+		f           dbFlags
+		sampleRate  float64
+		prefixLens  string
+		maxDistinct int
+		asJSON      bool
+	)
+	fs := newFlagSet("analyze", "[flags]", out)
+	f.register(fs, "")
+	fs.Float64Var(&sampleRate, "sample-rate", 1, "fraction of keys analyzed, between 0 and 1")
+	fs.StringVar(&prefixLens, "prefix-lens", "1,2,4,8,16,32",
+		"comma-separated prefix lengths whose number of distinct prefixes is counted")
+	fs.IntVar(&maxDistinct, "max-distinct", 1<<20, "number of distinct prefixes counted per length")
+	fs.BoolVar(&asJSON, "json", false, "print the analysis as JSON")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	lens, err := parsePrefixLens(prefixLens)
+	if err != nil {
+		return err
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	analysis, err := db.AnalyzeKeys(kvdb, db.AnalyzeConfig{
+		SampleRate:  sampleRate,
+		PrefixLens:  lens,
+		MaxDistinct: maxDistinct,
+	})
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(analysis)
+	}
+
+	fmt.Fprintf(out, "%d keys analyzed (sample rate %g)\n", analysis.Keys, analysis.SampleRate)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, h := range []struct {
+		name string
+		hist *db.SizeHistogram
+	}{{"KEY SIZE", &analysis.KeySizes}, {"VALUE SIZE", &analysis.ValueSizes}} {
+		fmt.Fprintf(tw, "\n%s\tKEYS\tSHARE\n", h.name)
+		for _, b := range h.hist.Buckets {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f%%\n", formatSizeBucket(b), b.Count,
+				float64(b.Count)/float64(h.hist.Count)*100)
+		}
+		fmt.Fprintf(tw, "mean %s, max %s\t\t\n", formatBytes(int64(h.hist.Mean())), formatBytes(int64(h.hist.Max)))
+	}
+	fmt.Fprintln(tw, "\nPREFIX LEN\tDISTINCT\t")
+	for _, p := range analysis.Prefixes {
+		distinct := strconv.FormatUint(p.Distinct, 10)
+		if p.Truncated {
+			distinct = ">=" + distinct
+		}
+		fmt.Fprintf(tw, "%d\t%s\t\n", p.Len, distinct)
+	}
+	return tw.Flush()
+}
+
+// parsePrefixLens parses a comma-separated list of positive prefix lengths.
+func parsePrefixLens(s string) ([]int, error) {
+	var lens []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid prefix length %q", field)
+		}
+		lens = append(lens, n)
+	}
+	return lens, nil
+}
+
+// formatSizeBucket formats the range of sizes of a bucket.
+func formatSizeBucket(b db.SizeBucket) string {
+	if b.Min == b.Max {
+		return formatBytes(int64(b.Min))
+	}
+	return formatBytes(int64(b.Min)) + "-" + formatBytes(int64(b.Max))
+}
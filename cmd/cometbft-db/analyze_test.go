@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func TestAnalyze(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "bb", "P:1", "cccc")
+	flags := []string{"-dir", dir, "-name", "test", "-prefix-lens", "1,3"}
+
+	out, err := runCommand(t, append([]string{"analyze"}, flags...)...)
+	require.NoError(t, err)
+	require.Contains(t, out, "3 keys analyzed (sample rate 1)\n")
+	require.Regexp(t, `2 B-3 B +3 +100.0%`, out)
+	require.Regexp(t, `4 B-7 B +1 +33.3%`, out)
+	require.Regexp(t, `\n1 +2 *\n3 +3 *\n`, out)
+
+	out, err = runCommand(t, append([]string{"analyze", "-json"}, flags...)...)
+	require.NoError(t, err)
+	var analysis db.KeyAnalysis
+	require.NoError(t, json.Unmarshal([]byte(out), &analysis))
+	require.EqualValues(t, 3, analysis.Keys)
+	require.Equal(t, []db.PrefixCardinality{{Len: 1, Distinct: 2}, {Len: 3, Distinct: 3}}, analysis.Prefixes)
+
+	_, err = runCommand(t, "analyze", "-dir", dir, "-name", "test", "-prefix-lens", "1,x")
+	require.ErrorContains(t, err, "invalid prefix length")
+}
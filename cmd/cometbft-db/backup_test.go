@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b")
+	backupDir := t.TempDir()
+	flags := []string{"-dir", dir, "-name", "test", "-backup-dir", backupDir}
+
+	out, err := runCommand(t, append([]string{"backup"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "created full backup 1: 2 keys set, 0 keys deleted\n", out)
+
+	_, err = runCommand(t, "set", "-dir", dir, "-name", "test", "H:3", "63")
+	require.NoError(t, err)
+	_, err = runCommand(t, "delete", "-dir", dir, "-name", "test", "H:1")
+	require.NoError(t, err)
+	out, err = runCommand(t, append([]string{"backup", "-incremental"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "created incremental backup 2: 1 keys set, 1 keys deleted\n", out)
+
+	out, err = runCommand(t, "backup", "-list", "-backup-dir", backupDir)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"2", "incremental"}, strings.Fields(lines[2])[:2])
+
+	toDir := t.TempDir()
+	restore := []string{"restore", "-backend", "pebbledb", "-dir", toDir, "-name", "test", "-backup-dir", backupDir}
+	out, err = runCommand(t, restore...)
+	require.NoError(t, err)
+	require.Equal(t, "restored 2 keys\n", out)
+	out, err = runCommand(t, "scan", "-backend", "pebbledb", "-dir", toDir, "-name", "test", "-keys-only")
+	require.NoError(t, err)
+	require.Equal(t, []string{"H:2", "H:3"}, strings.Fields(out))
+
+	_, err = runCommand(t, restore...)
+	require.ErrorContains(t, err, "already exists")
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a")
+	backupDir := t.TempDir()
+	_, err := runCommand(t, "backup", "-dir", dir, "-name", "test", "-backup-dir", backupDir)
+	require.NoError(t, err)
+
+	path := filepath.Join(backupDir, "000001.sets")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	toDir := t.TempDir()
+	_, err = runCommand(t, "restore", "-dir", toDir, "-name", "test", "-backup-dir", backupDir)
+	require.ErrorContains(t, err, "verification failed")
+	require.NoFileExists(t, filepath.Join(toDir, "test.db"))
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	db "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft-db/dbtest"
+)
+
+// benchWorkloads lists the workloads of the bench command, in the order they run by default.
+var benchWorkloads = []struct {
+	name        string
+	description string
+	run         func(b *bench) (*benchResult, error)
+}{
+	{"fillseq", "set keys in ascending order", (*bench).fillSeq},
+	{"readrandom", "get random existing keys", (*bench).readRandom},
+	{"readwhilewriting", "get random keys while another goroutine sets random keys", (*bench).readWhileWriting},
+	{"iterate", "iterate over all keys", (*bench).iterate},
+	{"batchsync", "write batches of random keys with WriteSync", (*bench).batchSync},
+}
+
+// bench runs workloads against a database.
+type bench struct {
+	db        db.DB
+	rand      *rand.Rand
+	keys      int
+	valueSize int
+	batchSize int
+	filled    bool
+}
+
+// benchResult is the result of a workload.
+type benchResult struct {
+	Workload  string        `json:"workload"`
+	Ops       int           `json:"ops"`
+	Duration  time.Duration `json:"duration_ns"`
+	OpsPerSec float64       `json:"ops_per_sec"`
+	P50       time.Duration `json:"p50_ns"`
+	P95       time.Duration `json:"p95_ns"`
+	P99       time.Duration `json:"p99_ns"`
+	Max       time.Duration `json:"max_ns"`
+}
+
+func runBench(args []string, out io.Writer) error {
+	var (
+		backend, dir, workloads string
+		asJSON                  bool
+		seed                    int64
+		b                       bench
+	)
+	fs := newFlagSet("bench", "[flags]", out)
+	fs.StringVar(&backend, "backend", string(db.GoLevelDBBackend), "backend to benchmark")
+	fs.StringVar(&dir, "dir", os.TempDir(), "directory in which a temporary database is created")
+	names := make([]string, len(benchWorkloads))
+	usage := "comma-separated workloads to run, in order:"
+	for i, w := range benchWorkloads {
+		names[i] = w.name
+		usage += fmt.Sprintf("\n  %s: %s", w.name, w.description)
+	}
+	fs.StringVar(&workloads, "workloads", strings.Join(names, ","), usage)
+	fs.IntVar(&b.keys, "keys", 100000, "number of keys, and of operations per workload")
+	fs.IntVar(&b.valueSize, "value-size", 100, "size of values in bytes")
+	fs.IntVar(&b.batchSize, "batch-size", 100, "number of keys per batch of batchsync")
+	fs.Int64Var(&seed, "seed", 1, "seed of the generated keys and values, for reproducible runs")
+	fs.BoolVar(&asJSON, "json", false, "print results as JSON")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if b.keys <= 0 || b.valueSize < 0 || b.batchSize <= 0 {
+		return errors.New("-keys and -batch-size must be positive, and -value-size not negative")
+	}
+
+	tmp, err := os.MkdirTemp(dir, "cometbft-db-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	b.db, err = db.NewDB("bench", db.BackendType(backend), tmp)
+	if err != nil {
+		return err
+	}
+	defer b.db.Close()
+	b.rand = dbtest.NewRand(seed)
+
+	var results []*benchResult
+	for _, name := range strings.Split(workloads, ",") {
+		found := false
+		for _, w := range benchWorkloads {
+			if w.name != name {
+				continue
+			}
+			found = true
+			result, err := w.run(&b)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			result.Workload = name
+			results = append(results, result)
+		}
+		if !found {
+			return fmt.Errorf("unknown workload %q, expected one of %s", name, strings.Join(names, ","))
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	fmt.Fprintf(out, "backend %s, %d keys, %d byte values\n", backend, b.keys, b.valueSize)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "workload\tops\tops/s\tp50\tp95\tp99\tmax\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%s\t%s\t%s\t%s\t\n", r.Workload, r.Ops, r.OpsPerSec, r.P50, r.P95, r.P99, r.Max)
+	}
+	return tw.Flush()
+}
+
+// key returns the key with the given index.
+func (b *bench) key(i int) []byte {
+	return dbtest.OrderedHeightKey([]byte("k"), uint64(i))
+}
+
+// value returns a random value.
+func (b *bench) value() []byte {
+	return dbtest.RandBytes(b.rand, b.valueSize)
+}
+
+// fill sets all keys, if not done yet, so that reads find them.
+func (b *bench) fill() error {
+	if b.filled {
+		return nil
+	}
+	_, err := b.fillSeq()
+	return err
+}
+
+// measure runs op n times, and returns the distribution of its latencies.
+func measure(n int, op func(i int) error) (*benchResult, error) {
+	latencies := make([]time.Duration, n)
+	begin := time.Now()
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		if err := op(i); err != nil {
+			return nil, err
+		}
+		latencies[i] = time.Since(start)
+	}
+	elapsed := time.Since(begin)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(n-1))]
+	}
+	return &benchResult{
+		Ops:       n,
+		Duration:  elapsed,
+		OpsPerSec: float64(n) / elapsed.Seconds(),
+		P50:       percentile(0.50),
+		P95:       percentile(0.95),
+		P99:       percentile(0.99),
+		Max:       latencies[n-1],
+	}, nil
+}
+
+func (b *bench) fillSeq() (*benchResult, error) {
+	result, err := measure(b.keys, func(i int) error {
+		return b.db.Set(b.key(i), b.value())
+	})
+	b.filled = err == nil
+	return result, err
+}
+
+func (b *bench) readRandom() (*benchResult, error) {
+	if err := b.fill(); err != nil {
+		return nil, err
+	}
+	return measure(b.keys, func(int) error {
+		_, err := b.db.Get(b.key(b.rand.Intn(b.keys)))
+		return err
+	})
+}
+
+func (b *bench) readWhileWriting() (*benchResult, error) {
+	if err := b.fill(); err != nil {
+		return nil, err
+	}
+	var (
+		wg       sync.WaitGroup
+		done     = make(chan struct{})
+		writeErr error
+	)
+	// The writer has its own source of randomness, since sources are not safe for concurrent use.
+	writer := &bench{db: b.db, rand: dbtest.NewRand(b.rand.Int63()), valueSize: b.valueSize}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if writeErr = b.db.Set(writer.key(writer.rand.Intn(b.keys)), writer.value()); writeErr != nil {
+				return
+			}
+		}
+	}()
+	result, err := measure(b.keys, func(int) error {
+		_, err := b.db.Get(b.key(b.rand.Intn(b.keys)))
+		return err
+	})
+	close(done)
+	wg.Wait()
+	if err == nil {
+		err = writeErr
+	}
+	return result, err
+}
+
+func (b *bench) iterate() (*benchResult, error) {
+	if err := b.fill(); err != nil {
+		return nil, err
+	}
+	itr, err := b.db.Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	result, err := measure(b.keys, func(int) error {
+		if !itr.Valid() {
+			return errors.New("iterator ended early")
+		}
+		_ = itr.Value()
+		itr.Next()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, itr.Error()
+}
+
+func (b *bench) batchSync() (*benchResult, error) {
+	batches := (b.keys + b.batchSize - 1) / b.batchSize
+	return measure(batches, func(int) error {
+		batch := b.db.NewBatch()
+		defer batch.Close()
+		for i := 0; i < b.batchSize; i++ {
+			if err := batch.Set(b.key(b.rand.Intn(b.keys)), b.value()); err != nil {
+				return err
+			}
+		}
+		return batch.WriteSync()
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench(t *testing.T) {
+	out, err := runCommand(t, "bench", "-dir", t.TempDir(), "-keys", "200", "-batch-size", "50", "-json")
+	require.NoError(t, err)
+	var results []benchResult
+	require.NoError(t, json.Unmarshal([]byte(out), &results))
+	require.Len(t, results, len(benchWorkloads))
+	for i, r := range results {
+		require.Equal(t, benchWorkloads[i].name, r.Workload)
+		require.Positive(t, r.OpsPerSec)
+		require.LessOrEqual(t, r.P50, r.P99)
+		require.LessOrEqual(t, r.P99, r.Max)
+	}
+	require.Equal(t, 200, results[0].Ops)
+	require.Equal(t, 4, results[4].Ops)
+
+	// Read workloads fill the database first.
+	out, err = runCommand(t, "bench", "-backend", "memdb", "-keys", "100", "-workloads", "iterate,readrandom")
+	require.NoError(t, err)
+	require.Contains(t, out, "iterate")
+	require.Contains(t, out, "readrandom")
+
+	_, err = runCommand(t, "bench", "-backend", "memdb", "-workloads", "unknown")
+	require.ErrorContains(t, err, "unknown workload")
+}
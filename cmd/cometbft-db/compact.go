@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func runCompact(args []string, out io.Writer) error {
+	var (
+		f          kvFlags
+		keyRange   string
+		interval   time.Duration
+		start, end []byte
+	)
+	flags := newFlagSet("compact", "[flags]", out)
+	f.register(flags)
+	flags.StringVar(&keyRange, "range", "", "range of keys to compact as start,end, where either may be empty; all keys by default")
+	flags.DurationVar(&interval, "progress-interval", 10*time.Second, "interval of progress output")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if keyRange != "" {
+		var err error
+		if start, end, err = parseRange(f.keys, keyRange); err != nil {
+			return err
+		}
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	path := f.path()
+	before, err := dirSize(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "compacting %s (%s)\n", path, formatBytes(before))
+	begin := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				size, _ := dirSize(path)
+				fmt.Fprintf(out, "still compacting after %s, size %s\n",
+					time.Since(begin).Round(time.Second), formatBytes(size))
+			}
+		}
+	}()
+	err = kvdb.Compact(start, end)
+	close(done)
+	<-stopped
+	if err != nil {
+		return err
+	}
+
+	after, err := dirSize(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "compacted in %s: %s -> %s (%+.1f%%)\n", time.Since(begin).Round(time.Millisecond),
+		formatBytes(before), formatBytes(after), percentChange(before, after))
+	return nil
+}
+
+// parseRange parses a range of keys given as start,end.
+func parseRange(keys encoding, s string) (start, end []byte, err error) {
+	bounds := strings.Split(s, ",")
+	if len(bounds) != 2 {
+		return nil, nil, errors.New("expected range as start,end")
+	}
+	if bounds[0] != "" {
+		if start, err = keys.decode(bounds[0]); err != nil {
+			return nil, nil, fmt.Errorf("invalid range start: %w", err)
+		}
+	}
+	if bounds[1] != "" {
+		if end, err = keys.decode(bounds[1]); err != nil {
+			return nil, nil, fmt.Errorf("invalid range end: %w", err)
+		}
+	}
+	return start, end, nil
+}
+
+// dirSize returns the total size of the files in the directory at path, or of the file at path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Files are removed by compactions while walking.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// formatBytes formats a size in bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// percentChange returns the change from before to after, in percent.
+func percentChange(before, after int64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return float64(after-before) / float64(before) * 100
+}
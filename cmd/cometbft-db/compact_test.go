@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	var items []string
+	for i := 0; i < 100; i++ {
+		items = append(items, fmt.Sprintf("H:%03d", i), "value")
+	}
+	dir := newTestDB(t, items...)
+
+	out, err := runCommand(t, "compact", "-dir", dir, "-name", "test")
+	require.NoError(t, err)
+	require.Contains(t, out, "compacting "+dir)
+	require.Contains(t, out, "compacted in")
+	out, err = runCommand(t, "compact", "-dir", dir, "-name", "test", "-range", "H:010,")
+	require.NoError(t, err)
+	require.Contains(t, out, "compacted in")
+	_, err = runCommand(t, "compact", "-dir", dir, "-name", "test", "-range", "H:010")
+	require.ErrorContains(t, err, "start,end")
+}
+
+func TestParseRange(t *testing.T) {
+	start, end, err := parseRange(encodingHex, "0102,")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, start)
+	require.Nil(t, end)
+	start, end, err = parseRange(encodingRaw, ",H:")
+	require.NoError(t, err)
+	require.Nil(t, start)
+	require.Equal(t, []byte("H:"), end)
+	_, _, err = parseRange(encodingHex, "zz,")
+	require.Error(t, err)
+}
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "512 B", formatBytes(512))
+	require.Equal(t, "1.5 KiB", formatBytes(1536))
+	require.Equal(t, "2.0 GiB", formatBytes(2<<30))
+	require.InDelta(t, -25.0, percentChange(400, 300), 0.001)
+}
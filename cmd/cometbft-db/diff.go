@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// diffHashLen is the number of bytes of the SHA-256 hashes of values printed by diff.
+const diffHashLen = 8
+
+// diffCounts are the numbers of keys found by diff.
+type diffCounts struct {
+	onlyA, onlyB, differ, same uint64
+}
+
+func runDiff(args []string, out io.Writer) error {
+	var (
+		a, b  dbFlags
+		keys  = encodingHex
+		limit int
+	)
+	fs := newFlagSet("diff", "[flags] <dirA> <dirB>", out)
+	fs.StringVar(&a.backend, "backend", string(db.GoLevelDBBackend), "backend of the databases")
+	fs.StringVar(&b.backend, "backend-b", "", "backend of the database in dirB, if not -backend")
+	fs.StringVar(&a.name, "name", "", "name of the databases, e.g. state for state.db")
+	fs.Var(&keys, "key-encoding", "encoding of printed keys, raw or hex")
+	fs.IntVar(&limit, "limit", 100, "maximum number of differences printed, or 0 for no limit")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+	a.dir, b.dir, b.name = fs.Arg(0), fs.Arg(1), a.name
+	if b.backend == "" {
+		b.backend = a.backend
+	}
+	dbA, err := a.open(false)
+	if err != nil {
+		return err
+	}
+	defer dbA.Close()
+	dbB, err := b.open(false)
+	if err != nil {
+		return err
+	}
+	defer dbB.Close()
+
+	printed := 0
+	report := func(mark string, key []byte, values ...[]byte) {
+		if limit > 0 && printed >= limit {
+			return
+		}
+		printed++
+		fmt.Fprintf(out, "%s %s", mark, keys.encode(key))
+		for _, value := range values {
+			hash := sha256.Sum256(value)
+			fmt.Fprintf(out, " %x", hash[:diffHashLen])
+		}
+		fmt.Fprintln(out)
+	}
+	counts, err := diffKeyspaces(dbA, dbB, report)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && uint64(printed) < counts.onlyA+counts.onlyB+counts.differ {
+		fmt.Fprintf(out, "... (limited to %d differences)\n", limit)
+	}
+	fmt.Fprintf(out, "%d keys only in A, %d only in B, %d with different values, %d identical\n",
+		counts.onlyA, counts.onlyB, counts.differ, counts.same)
+	if counts.onlyA+counts.onlyB+counts.differ > 0 {
+		return errors.New("databases differ")
+	}
+	return nil
+}
+
+// diffKeyspaces iterates over both databases in key order, and reports keys only in A with "-"
+// and the hash of their value, keys only in B with "+", and keys with different values with "~"
+// and the hashes of both values.
+func diffKeyspaces(dbA, dbB db.DB, report func(mark string, key []byte, values ...[]byte)) (diffCounts, error) {
+	var counts diffCounts
+	itrA, err := dbA.Iterator(nil, nil)
+	if err != nil {
+		return counts, err
+	}
+	defer itrA.Close()
+	itrB, err := dbB.Iterator(nil, nil)
+	if err != nil {
+		return counts, err
+	}
+	defer itrB.Close()
+
+	for itrA.Valid() || itrB.Valid() {
+		c := 0
+		switch {
+		case !itrB.Valid():
+			c = -1
+		case !itrA.Valid():
+			c = 1
+		default:
+			c = bytes.Compare(itrA.Key(), itrB.Key())
+		}
+		switch {
+		case c < 0:
+			counts.onlyA++
+			report("-", itrA.Key(), itrA.Value())
+			itrA.Next()
+		case c > 0:
+			counts.onlyB++
+			report("+", itrB.Key(), itrB.Value())
+			itrB.Next()
+		default:
+			if bytes.Equal(itrA.Value(), itrB.Value()) {
+				counts.same++
+			} else {
+				counts.differ++
+				report("~", itrA.Key(), itrA.Value(), itrB.Value())
+			}
+			itrA.Next()
+			itrB.Next()
+		}
+	}
+	if err := itrA.Error(); err != nil {
+		return counts, err
+	}
+	return counts, itrB.Error()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	dirA := newTestDB(t, "a", "1", "b", "2", "c", "3")
+	dirB := newTestDB(t, "b", "2", "c", "4", "d", "5")
+
+	out, err := runCommand(t, "diff", "-name", "test", "-key-encoding", "raw", dirA, dirB)
+	require.EqualError(t, err, "databases differ")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	// The hashes are the first bytes of the SHA-256 hashes of the values.
+	require.Equal(t, "- a 6b86b273ff34fce1", lines[0])
+	require.Equal(t, "~ c 4e07408562bedb8b 4b227777d4dd1fc6", lines[1])
+	require.Equal(t, "+ d ef2d127de37b942b", lines[2])
+	require.Equal(t, "1 keys only in A, 1 only in B, 1 with different values, 1 identical", lines[3])
+
+	out, err = runCommand(t, "diff", "-name", "test", "-limit", "1", dirA, dirB)
+	require.Error(t, err)
+	require.Contains(t, out, "- 61 ")
+	require.Contains(t, out, "limited to 1 differences")
+	require.NotContains(t, out, "~ 63")
+
+	dirC := newTestDB(t, "a", "1", "b", "2", "c", "3")
+	out, err = runCommand(t, "diff", "-name", "test", dirA, dirC)
+	require.NoError(t, err)
+	require.Equal(t, "0 keys only in A, 0 only in B, 0 with different values, 3 identical\n", out)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"unicode"
+)
+
+// maxDUPrefixSearch is the number of bytes searched for a separator to find the prefix of a key.
+const maxDUPrefixSearch = 64
+
+// duPrefix is the usage of the keys with a prefix.
+type duPrefix struct {
+	Prefix     string `json:"prefix"`
+	Keys       uint64 `json:"keys"`
+	KeyBytes   uint64 `json:"key_bytes"`
+	ValueBytes uint64 `json:"value_bytes"`
+}
+
+// total returns the size of the keys and values.
+func (p *duPrefix) total() uint64 {
+	return p.KeyBytes + p.ValueBytes
+}
+
+func runDU(args []string, out io.Writer) error {
+	var (
+		f          dbFlags
+		separators string
+		prefixLen  int
+		asJSON     bool
+	)
+	fs := newFlagSet("du", "[flags]", out)
+	f.register(fs, "")
+	fs.StringVar(&separators, "separators", ":/",
+		"characters ending the prefix of a key, e.g. H: in blockstores or tx.height/ in tx_index")
+	fs.IntVar(&prefixLen, "prefix-len", 0, "length of prefixes in bytes, instead of ending them at separators")
+	fs.BoolVar(&asJSON, "json", false, "print usage as JSON")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	itr, err := kvdb.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	usage := make(map[string]*duPrefix)
+	total := &duPrefix{Prefix: "total"}
+	for ; itr.Valid(); itr.Next() {
+		key, value := itr.Key(), itr.Value()
+		prefix := keyPrefix(key, []byte(separators), prefixLen)
+		p, ok := usage[string(prefix)]
+		if !ok {
+			p = &duPrefix{Prefix: formatPrefix(prefix)}
+			usage[string(prefix)] = p
+		}
+		for _, p := range []*duPrefix{p, total} {
+			p.Keys++
+			p.KeyBytes += uint64(len(key))
+			p.ValueBytes += uint64(len(value))
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+
+	prefixes := make([]*duPrefix, 0, len(usage))
+	for _, p := range usage {
+		prefixes = append(prefixes, p)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].total() != prefixes[j].total() {
+			return prefixes[i].total() > prefixes[j].total()
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(append(prefixes, total))
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tKEYS\tKEY BYTES\tVALUE BYTES\tTOTAL\tSHARE")
+	for _, p := range append(prefixes, total) {
+		share := 0.0
+		if total.total() > 0 {
+			share = float64(p.total()) / float64(total.total()) * 100
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%.1f%%\n", p.Prefix, p.Keys, formatBytes(int64(p.KeyBytes)),
+			formatBytes(int64(p.ValueBytes)), formatBytes(int64(p.total())), share)
+	}
+	return tw.Flush()
+}
+
+// keyPrefix returns the first prefixLen bytes of key if prefixLen is positive, or else its bytes up
+// to and including the first separator, or its first byte if there is none.
+func keyPrefix(key, separators []byte, prefixLen int) []byte {
+	if prefixLen > 0 {
+		return key[:min(prefixLen, len(key))]
+	}
+	search := key[:min(maxDUPrefixSearch, len(key))]
+	if i := bytes.IndexAny(search, string(separators)); i >= 0 {
+		return key[:i+1]
+	}
+	return key[:1]
+}
+
+// formatPrefix formats a prefix as text if printable, and as hex otherwise.
+func formatPrefix(prefix []byte) string {
+	for _, r := range string(prefix) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return "0x" + hex.EncodeToString(prefix)
+		}
+	}
+	return string(prefix)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDU(t *testing.T) {
+	dir := newTestDB(t, "H:1", "aaaa", "H:2", "bbbb", "P:1:0", "cccccccc", "tx.height/1/1/0", "d", "\x01\x02", "e")
+
+	out, err := runCommand(t, "du", "-dir", dir, "-name", "test", "-json")
+	require.NoError(t, err)
+	var usage []duPrefix
+	require.NoError(t, json.Unmarshal([]byte(out), &usage))
+	require.Equal(t, []duPrefix{
+		{Prefix: "tx.height/", Keys: 1, KeyBytes: 15, ValueBytes: 1},
+		{Prefix: "H:", Keys: 2, KeyBytes: 6, ValueBytes: 8},
+		{Prefix: "P:", Keys: 1, KeyBytes: 5, ValueBytes: 8},
+		{Prefix: "0x01", Keys: 1, KeyBytes: 2, ValueBytes: 1},
+		{Prefix: "total", Keys: 5, KeyBytes: 28, ValueBytes: 18},
+	}, usage)
+
+	out, err = runCommand(t, "du", "-dir", dir, "-name", "test", "-prefix-len", "1")
+	require.NoError(t, err)
+	require.Contains(t, out, "PREFIX")
+	require.Regexp(t, `(?m)^t +1 +15 B +1 B +16 B +34\.8%$`, out)
+}
+
+func TestKeyPrefix(t *testing.T) {
+	require.Equal(t, []byte("H:"), keyPrefix([]byte("H:12"), []byte(":/"), 0))
+	require.Equal(t, []byte("tx.height/"), keyPrefix([]byte("tx.height/1/1"), []byte(":/"), 0))
+	require.Equal(t, []byte("v"), keyPrefix([]byte("validators"), []byte(":/"), 0))
+	require.Equal(t, []byte("ab"), keyPrefix([]byte("ab"), nil, 4))
+	require.Equal(t, "0xff00", formatPrefix([]byte{0xff, 0x00}))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func runExport(args []string, out io.Writer) error {
+	var (
+		f                            dbFlags
+		path, format, recordEncoding string
+		start, end                   string
+	)
+	fs := newFlagSet("export", "[flags]", out)
+	f.register(fs, "")
+	fs.StringVar(&path, "file", "", "file to write, or - for standard output with the jsonl and csv formats")
+	fs.StringVar(&format, "format", "dump", "format of the file: dump, jsonl or csv")
+	fs.StringVar(&recordEncoding, "encoding", "hex", "encoding of keys and values with the jsonl and csv formats: hex or base64")
+	fs.StringVar(&start, "start", "", "hex key to export from, inclusive, with the jsonl and csv formats")
+	fs.StringVar(&end, "end", "", "hex key to export to, exclusive, with the jsonl and csv formats")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("no file given")
+	}
+	var export func(kvdb db.DB, w io.Writer) (uint64, error)
+	switch format {
+	case "dump":
+		if start != "" || end != "" || path == "-" {
+			return errors.New("-start, -end and standard output require the jsonl or csv format")
+		}
+		export = func(kvdb db.DB, w io.Writer) (uint64, error) {
+			return db.ExportTo(kvdb, w)
+		}
+	case "jsonl", "csv":
+		var encode func([]byte) string
+		switch recordEncoding {
+		case "hex":
+			encode = hex.EncodeToString
+		case "base64":
+			encode = base64.StdEncoding.EncodeToString
+		default:
+			return fmt.Errorf("unknown encoding %q, expected hex or base64", recordEncoding)
+		}
+		var startKey, endKey []byte
+		for _, bound := range []struct {
+			arg string
+			key *[]byte
+		}{{start, &startKey}, {end, &endKey}} {
+			if bound.arg == "" {
+				continue
+			}
+			key, err := encodingHex.decode(bound.arg)
+			if err != nil {
+				return fmt.Errorf("invalid key %s: %w", bound.arg, err)
+			}
+			*bound.key = key
+		}
+		export = func(kvdb db.DB, w io.Writer) (uint64, error) {
+			return exportRecords(kvdb, startKey, endKey, format == "csv", encode, w)
+		}
+	default:
+		return fmt.Errorf("unknown format %q, expected dump, jsonl or csv", format)
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	if path == "-" {
+		_, err := export(kvdb, out)
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	n, err := export(kvdb, file)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d keys to %s\n", n, path)
+	return nil
+}
+
+// exportRecord is a line of a jsonl export.
+type exportRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// exportRecords writes the items of the range [start, end) of kvdb to w, with keys and values
+// encoded by encode: as CSV records after a key,value header if asCSV is set, or else as JSON
+// objects with key and value fields, one per line.
+func exportRecords(kvdb db.DB, start, end []byte, asCSV bool, encode func([]byte) string, w io.Writer) (uint64, error) {
+	itr, err := kvdb.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	enc := json.NewEncoder(bw)
+	write := func(key, value string) error {
+		if asCSV {
+			return cw.Write([]string{key, value})
+		}
+		return enc.Encode(exportRecord{Key: key, Value: value})
+	}
+	if asCSV {
+		if err := write("key", "value"); err != nil {
+			return 0, err
+		}
+	}
+	var n uint64
+	for ; itr.Valid(); itr.Next() {
+		if err := write(encode(itr.Key()), encode(itr.Value())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := itr.Error(); err != nil {
+		return n, err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+func runImport(args []string, out io.Writer) error {
+	var (
+		f    dbFlags
+		path string
+	)
+	fs := newFlagSet("import", "[flags]", out)
+	f.register(fs, "")
+	fs.StringVar(&path, "file", "", "dump file to read")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("no dump file given")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	kvdb, err := f.open(true)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	n, err := db.ImportFrom(kvdb, file)
+	if err != nil {
+		return fmt.Errorf("import failed after %d keys: %w", n, err)
+	}
+	fmt.Fprintf(out, "imported %d keys from %s\n", n, path)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b")
+	path := filepath.Join(t.TempDir(), "test.dump")
+
+	out, err := runCommand(t, "export", "-dir", dir, "-name", "test", "-file", path)
+	require.NoError(t, err)
+	require.Equal(t, "exported 2 keys to "+path+"\n", out)
+
+	toDir := t.TempDir()
+	out, err = runCommand(t, "import", "-backend", "pebbledb", "-dir", toDir, "-name", "test", "-file", path)
+	require.NoError(t, err)
+	require.Equal(t, "imported 2 keys from "+path+"\n", out)
+	out, err = runCommand(t, "get", "-backend", "pebbledb", "-dir", toDir, "-name", "test",
+		"-value-encoding", "raw", "H:2")
+	require.NoError(t, err)
+	require.Equal(t, "b\n", out)
+}
+
+func TestExportRecords(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b", "P:1", "c")
+	flags := []string{"-dir", dir, "-name", "test", "-file", "-"}
+
+	// H:2 is 483a32, and P: is 503a.
+	out, err := runCommand(t, append([]string{"export", "-format", "jsonl", "-start", "483a32", "-end", "503a"},
+		flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, `{"key":"483a32","value":"62"}`+"\n", out)
+
+	out, err = runCommand(t, append([]string{"export", "-format", "csv", "-encoding", "base64"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "key,value\nSDox,YQ==\nSDoy,Yg==\nUDox,Yw==\n", out)
+
+	path := filepath.Join(t.TempDir(), "test.jsonl")
+	out, err = runCommand(t, "export", "-dir", dir, "-name", "test", "-format", "jsonl", "-file", path)
+	require.NoError(t, err)
+	require.Equal(t, "exported 3 keys to "+path+"\n", out)
+
+	_, err = runCommand(t, append([]string{"export", "-start", "48"}, flags...)...)
+	require.ErrorContains(t, err, "require the jsonl or csv format")
+	_, err = runCommand(t, append([]string{"export", "-format", "xml"}, flags...)...)
+	require.ErrorContains(t, err, "unknown format")
+	_, err = runCommand(t, append([]string{"export", "-format", "csv", "-encoding", "raw"}, flags...)...)
+	require.ErrorContains(t, err, "unknown encoding")
+}
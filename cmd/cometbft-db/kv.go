@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// kvFlags are the flags of the commands reading and writing keys. Keys are raw by default, as
+// most keys of CometBFT are readable, e.g. H:1, while values are hex by default, as most are
+// binary.
+type kvFlags struct {
+	dbFlags
+	keys   encoding
+	values encoding
+}
+
+func (f *kvFlags) register(fs *flag.FlagSet) {
+	f.dbFlags.register(fs, "")
+	f.keys, f.values = encodingRaw, encodingHex
+	fs.Var(&f.keys, "key-encoding", "encoding of keys, raw or hex")
+	fs.Var(&f.values, "value-encoding", "encoding of values, raw or hex")
+}
+
+func runGet(args []string, out io.Writer) error {
+	var f kvFlags
+	fs := newFlagSet("get", "[flags] <key>", out)
+	f.register(fs)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	key, err := f.keys.decode(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	value, err := kvdb.Get(key)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return fmt.Errorf("key %s not found", fs.Arg(0))
+	}
+	fmt.Fprintln(out, f.values.encode(value))
+	return nil
+}
+
+func runSet(args []string, out io.Writer) error {
+	var f kvFlags
+	fs := newFlagSet("set", "[flags] <key> <value>", out)
+	f.register(fs)
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+	key, err := f.keys.decode(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	value, err := f.values.decode(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+	return kvdb.SetSync(key, value)
+}
+
+func runDelete(args []string, out io.Writer) error {
+	var f kvFlags
+	fs := newFlagSet("delete", "[flags] <key>", out)
+	f.register(fs)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	key, err := f.keys.decode(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+	return kvdb.DeleteSync(key)
+}
+
+func runScan(args []string, out io.Writer) error {
+	var (
+		f                  kvFlags
+		start, end, prefix string
+		reverse, keysOnly  bool
+		limit              int
+	)
+	fs := newFlagSet("scan", "[flags]", out)
+	f.register(fs)
+	fs.StringVar(&start, "start", "", "first key of the range, inclusive")
+	fs.StringVar(&end, "end", "", "last key of the range, exclusive")
+	fs.StringVar(&prefix, "prefix", "", "prefix of the keys, instead of a range")
+	fs.BoolVar(&reverse, "reverse", false, "print keys in descending order")
+	fs.BoolVar(&keysOnly, "keys-only", false, "print only keys")
+	fs.IntVar(&limit, "limit", 0, "maximum number of keys to print, or 0 for all")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if prefix != "" && (start != "" || end != "") {
+		return errors.New("-prefix cannot be combined with -start or -end")
+	}
+	var startKey, endKey []byte
+	for _, bound := range []struct {
+		arg string
+		key *[]byte
+	}{{start, &startKey}, {end, &endKey}, {prefix, &startKey}} {
+		if bound.arg == "" {
+			continue
+		}
+		key, err := f.keys.decode(bound.arg)
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %w", bound.arg, err)
+		}
+		*bound.key = key
+	}
+	if prefix != "" {
+		endKey = prefixEnd(startKey)
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	newIterator := kvdb.Iterator
+	if reverse {
+		newIterator = kvdb.ReverseIterator
+	}
+	itr, err := newIterator(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for n := 0; itr.Valid() && (limit <= 0 || n < limit); n++ {
+		if keysOnly {
+			fmt.Fprintln(out, f.keys.encode(itr.Key()))
+		} else {
+			fmt.Fprintf(out, "%s\t%s\n", f.keys.encode(itr.Key()), f.values.encode(itr.Value()))
+		}
+		itr.Next()
+	}
+	return itr.Error()
+}
+
+// prefixEnd returns the end of the range of keys with the given prefix, or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for len(end) > 0 {
+		if end[len(end)-1] != 0xff {
+			end[len(end)-1]++
+			return end
+		}
+		end = end[:len(end)-1]
+	}
+	return nil
+}
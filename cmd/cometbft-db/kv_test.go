@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKV(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b", "P:1", "c")
+	flags := []string{"-dir", dir, "-name", "test"}
+
+	out, err := runCommand(t, append([]string{"get"}, append(flags, "H:1")...)...)
+	require.NoError(t, err)
+	require.Equal(t, "61\n", out)
+	out, err = runCommand(t, append([]string{"get", "-key-encoding", "hex", "-value-encoding", "raw"},
+		append(flags, "483a32")...)...)
+	require.NoError(t, err)
+	require.Equal(t, "b\n", out)
+	_, err = runCommand(t, append([]string{"get"}, append(flags, "H:3")...)...)
+	require.ErrorContains(t, err, "not found")
+
+	_, err = runCommand(t, append([]string{"set", "-value-encoding", "raw"}, append(flags, "H:3", "d")...)...)
+	require.NoError(t, err)
+	_, err = runCommand(t, append([]string{"delete"}, append(flags, "P:1")...)...)
+	require.NoError(t, err)
+
+	out, err = runCommand(t, append([]string{"scan", "-value-encoding", "raw"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "H:1\ta\nH:2\tb\nH:3\td\n", out)
+	out, err = runCommand(t, append([]string{"scan", "-keys-only", "-reverse", "-limit", "2", "-prefix", "H:"},
+		flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"H:3", "H:2"}, strings.Fields(out))
+	out, err = runCommand(t, append([]string{"scan", "-keys-only", "-start", "H:2", "-end", "H:3"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "H:2\n", out)
+
+	// Mistyped names do not create databases.
+	_, err = runCommand(t, "get", "-dir", dir, "-name", "tset", "H:1")
+	require.ErrorContains(t, err, "not found")
+}
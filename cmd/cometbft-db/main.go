@@ -0,0 +1,188 @@
+// Command cometbft-db inspects and maintains databases of any backend supported by cometbft-db,
+// e.g. to read or repair keys of a stopped node.
+//
+// Usage:
+//
+//	cometbft-db <command> [flags] [arguments]
+//
+// Run cometbft-db help to list the commands, and cometbft-db <command> -h for their flags.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// command is a subcommand of the tool.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, out io.Writer) error
+}
+
+// commands lists the subcommands, in the order they are documented.
+var commands = []command{
+	{"get", "print the value of a key", runGet},
+	{"set", "set the value of a key", runSet},
+	{"delete", "delete a key", runDelete},
+	{"scan", "print the keys and values of a range", runScan},
+	{"migrate", "copy a database to another backend", runMigrate},
+	{"export", "write a database to a dump, jsonl or csv file", runExport},
+	{"import", "write the items of a dump file to a database", runImport},
+	{"verify", "check the ordering, reads and checksums of a database", runVerify},
+	{"compact", "compact a database, or a range of its keys", runCompact},
+	{"bench", "benchmark a backend with standard workloads", runBench},
+	{"du", "report the number and size of keys per prefix", runDU},
+	{"repair", "repair a goleveldb or pebble database after a crash", runRepair},
+	{"prune", "delete a range of keys in throttled batches", runPrune},
+	{"backup", "back up a database, fully or incrementally", runBackup},
+	{"restore", "verify and restore a backup", runRestore},
+	{"diff", "compare the keys and values of two databases", runDiff},
+	{"analyze", "report the distribution of key and value sizes and prefixes", runAnalyze},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command given by args, writing its output to out.
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(out)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			err := cmd.run(args[1:], out)
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+	}
+	printUsage(out)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: cometbft-db <command> [flags] [arguments]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Run cometbft-db <command> -h for the flags of a command.")
+}
+
+// newFlagSet returns the flag set of a command, whose usage is printed to out.
+func newFlagSet(name, usage string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintf(out, "Usage: cometbft-db %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a command, and checks the number of arguments.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return fmt.Errorf("expected %d arguments, got %d", nargs, fs.NArg())
+	}
+	return nil
+}
+
+// dbFlags are the flags selecting a database.
+type dbFlags struct {
+	backend string
+	dir     string
+	name    string
+}
+
+// register registers the flags on fs, with the given prefix, e.g. "from-".
+func (f *dbFlags) register(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&f.backend, prefix+"backend", string(db.GoLevelDBBackend), "backend of the database")
+	fs.StringVar(&f.dir, prefix+"dir", ".", "directory containing the database")
+	fs.StringVar(&f.name, prefix+"name", "", "name of the database, e.g. blockstore for blockstore.db")
+}
+
+// open opens the database. Unless create is set, the database must exist, so that a mistyped name
+// does not silently create an empty database.
+func (f *dbFlags) open(create bool, opts ...db.Option) (db.DB, error) {
+	if f.name == "" {
+		return nil, errors.New("no database name given")
+	}
+	backend := db.BackendType(f.backend)
+	if !create && backend != db.MemDBBackend {
+		if !db.FileExists(f.path()) {
+			return nil, fmt.Errorf("database %s not found in %s", f.name, f.dir)
+		}
+	}
+	return db.NewDB(f.name, backend, f.dir, opts...)
+}
+
+// path returns the path of the database files, which most backends store in <dir>/<name>.db,
+// and badger in <dir>/<name>.
+func (f *dbFlags) path() string {
+	path := filepath.Join(f.dir, f.name+".db")
+	if db.FileExists(path) {
+		return path
+	}
+	return filepath.Join(f.dir, f.name)
+}
+
+// encoding is the encoding of keys and values given as arguments and printed.
+type encoding string
+
+const (
+	encodingRaw encoding = "raw"
+	encodingHex encoding = "hex"
+)
+
+// String implements flag.Value.
+func (e *encoding) String() string {
+	return string(*e)
+}
+
+// Set implements flag.Value.
+func (e *encoding) Set(s string) error {
+	switch encoding(s) {
+	case encodingRaw, encodingHex:
+		*e = encoding(s)
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding %q, expected raw or hex", s)
+	}
+}
+
+// decode decodes an argument.
+func (e encoding) decode(s string) ([]byte, error) {
+	if e == encodingHex {
+		return hex.DecodeString(s)
+	}
+	return []byte(s), nil
+}
+
+// encode encodes bytes for printing.
+func (e encoding) encode(bz []byte) string {
+	if e == encodingHex {
+		return hex.EncodeToString(bz)
+	}
+	return string(bz)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// newTestDB creates a goleveldb database named test in a temporary directory with the given
+// items, and returns the directory.
+func newTestDB(t *testing.T, items ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	kvdb, err := db.NewGoLevelDB("test", dir)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(items); i += 2 {
+		require.NoError(t, kvdb.Set([]byte(items[i]), []byte(items[i+1])))
+	}
+	require.NoError(t, kvdb.Close())
+	return dir
+}
+
+// runCommand runs the tool with the given arguments, and returns its output.
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(args, &out)
+	return out.String(), err
+}
+
+func TestUsage(t *testing.T) {
+	out, err := runCommand(t)
+	require.NoError(t, err)
+	require.Contains(t, out, "Commands:")
+	_, err = runCommand(t, "unknown")
+	require.Error(t, err)
+	out, err = runCommand(t, "get", "-h")
+	require.NoError(t, err)
+	require.Contains(t, out, "-key-encoding")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func runMigrate(args []string, out io.Writer) error {
+	var (
+		from, to   dbFlags
+		checkpoint string
+		batchSize  int
+	)
+	fs := newFlagSet("migrate", "[flags]", out)
+	fs.StringVar(&from.backend, "from", string(db.GoLevelDBBackend), "backend of the source database")
+	fs.StringVar(&from.dir, "dir", ".", "directory containing the source database")
+	fs.StringVar(&from.name, "name", "", "name of the database, e.g. blockstore for blockstore.db")
+	fs.StringVar(&to.backend, "to", string(db.PebbleDBBackend), "backend of the destination database")
+	fs.StringVar(&to.dir, "to-dir", "", "directory of the destination database, which must differ from -dir")
+	fs.StringVar(&to.name, "to-name", "", "name of the destination database, defaults to -name")
+	fs.StringVar(&checkpoint, "checkpoint", "",
+		"file recording the progress of the migration, defaults to <to-dir>/<to-name>.migrate.json")
+	fs.IntVar(&batchSize, "batch-size", 10000, "number of items written per batch")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if to.name == "" {
+		to.name = from.name
+	}
+	if to.dir == "" {
+		return errors.New("no destination directory given")
+	}
+	if filepath.Clean(to.dir) == filepath.Clean(from.dir) && to.name == from.name {
+		return errors.New("the source and destination databases are the same")
+	}
+	if checkpoint == "" {
+		checkpoint = filepath.Join(to.dir, to.name+".migrate.json")
+	}
+
+	src, err := from.open(false)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := to.open(true)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	result, err := db.Migrate(src, dst, db.MigrateConfig{
+		BatchSize:      batchSize,
+		CheckpointPath: checkpoint,
+		Progress: func(r db.MigrateResult) {
+			fmt.Fprintf(out, "copied %d keys (%d bytes)\n", r.Keys, r.Bytes)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("migration failed, rerun the command to resume it: %w", err)
+	}
+	if result.Resumed {
+		fmt.Fprintln(out, "resumed from checkpoint", checkpoint)
+	}
+	fmt.Fprintf(out, "migrated %d keys (%d bytes) from %s to %s, checksum %x\n",
+		result.Keys, result.Bytes, from.backend, to.backend, result.Checksum)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b", "P:1", "c")
+	toDir := t.TempDir()
+
+	out, err := runCommand(t, "migrate", "-from", "goleveldb", "-to", "pebbledb", "-dir", dir, "-name", "test",
+		"-to-dir", toDir, "-batch-size", "2")
+	require.NoError(t, err)
+	require.Contains(t, out, "copied 2 keys")
+	require.Contains(t, out, "migrated 3 keys (12 bytes) from goleveldb to pebbledb")
+	require.NoFileExists(t, filepath.Join(toDir, "test.migrate.json"))
+
+	pdb, err := db.NewPebbleDB("test", toDir)
+	require.NoError(t, err)
+	defer pdb.Close()
+	value, err := pdb.Get([]byte("P:1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), value)
+
+	_, err = runCommand(t, "migrate", "-dir", dir, "-name", "test", "-to", "goleveldb", "-to-dir", dir)
+	require.ErrorContains(t, err, "same")
+}
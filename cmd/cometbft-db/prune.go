@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func runPrune(args []string, out io.Writer) error {
+	var (
+		f                 dbFlags
+		prefix, beforeKey string
+		rate              float64
+		batchSize         int
+		compact, dryRun   bool
+	)
+	fs := newFlagSet("prune", "[flags]", out)
+	f.register(fs, "")
+	fs.StringVar(&prefix, "prefix", "", "hex prefix of the keys to delete")
+	fs.StringVar(&beforeKey, "before-key", "", "hex key before which keys are deleted, exclusive")
+	fs.Float64Var(&rate, "rate", 10000, "maximum number of keys deleted per second, or 0 for no limit")
+	fs.IntVar(&batchSize, "batch-size", 1000, "number of keys deleted per batch")
+	fs.BoolVar(&compact, "compact", false, "compact the range once deleted, to reclaim space")
+	fs.BoolVar(&dryRun, "dry-run", false, "only count the keys which would be deleted")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	start, end, err := pruneRange(prefix, beforeKey)
+	if err != nil {
+		return err
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	if dryRun {
+		n, err := countKeys(kvdb, start, end)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "would delete %d keys in [%x, %x)\n", n, start, end)
+		return nil
+	}
+	deleted, err := db.PruneRange(kvdb, start, end, db.PruneConfig{
+		BatchSize: batchSize,
+		Rate:      rate,
+		Progress: func(deleted int) {
+			if deleted%(100*batchSize) == 0 {
+				fmt.Fprintf(out, "deleted %d keys\n", deleted)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("pruning failed after %d keys: %w", deleted, err)
+	}
+	fmt.Fprintf(out, "deleted %d keys in [%x, %x)\n", deleted, start, end)
+	if compact {
+		fmt.Fprintln(out, "compacting")
+		if err := kvdb.Compact(start, end); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "compacted")
+	}
+	return nil
+}
+
+// pruneRange returns the range of keys with the given hex prefix and before the given hex key. At
+// least one must be given, so that a mistake does not delete the whole database.
+func pruneRange(prefix, beforeKey string) (start, end []byte, err error) {
+	if prefix == "" && beforeKey == "" {
+		return nil, nil, errors.New("-prefix or -before-key must be given")
+	}
+	if start, err = encodingHex.decode(prefix); err != nil {
+		return nil, nil, fmt.Errorf("invalid prefix: %w", err)
+	}
+	if len(start) > 0 {
+		end = prefixEnd(start)
+	} else {
+		start = nil
+	}
+	if beforeKey != "" {
+		before, err := encodingHex.decode(beforeKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid key: %w", err)
+		}
+		if end == nil || bytes.Compare(before, end) < 0 {
+			end = before
+		}
+	}
+	return start, end, nil
+}
+
+// countKeys returns the number of keys in the range [start, end) of kvdb.
+func countKeys(kvdb db.DB, start, end []byte) (int, error) {
+	itr, err := kvdb.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+	n := 0
+	for ; itr.Valid(); itr.Next() {
+		n++
+	}
+	return n, itr.Error()
+}
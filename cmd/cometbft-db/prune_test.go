@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b", "H:3", "c", "P:1", "d")
+	flags := []string{"-dir", dir, "-name", "test"}
+
+	// H: is 483a, and H:3 is 483a33.
+	out, err := runCommand(t, append([]string{"prune", "-prefix", "483a", "-before-key", "483a33", "-dry-run"},
+		flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, "would delete 2 keys in [483a, 483a33)\n", out)
+
+	out, err = runCommand(t, append([]string{"prune", "-prefix", "483a", "-before-key", "483a33", "-compact",
+		"-batch-size", "1"}, flags...)...)
+	require.NoError(t, err)
+	require.Contains(t, out, "deleted 2 keys in [483a, 483a33)")
+	require.Contains(t, out, "compacted")
+
+	out, err = runCommand(t, append([]string{"scan", "-keys-only"}, flags...)...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"H:3", "P:1"}, strings.Fields(out))
+
+	_, err = runCommand(t, append([]string{"prune"}, flags...)...)
+	require.ErrorContains(t, err, "must be given")
+}
+
+func TestPruneRange(t *testing.T) {
+	start, end, err := pruneRange("48", "")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x48}, start)
+	require.Equal(t, []byte{0x49}, end)
+
+	// The prefix ends before the key.
+	start, end, err = pruneRange("48", "50")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x48}, start)
+	require.Equal(t, []byte{0x49}, end)
+
+	start, end, err = pruneRange("", "50")
+	require.NoError(t, err)
+	require.Nil(t, start)
+	require.Equal(t, []byte{0x50}, end)
+}
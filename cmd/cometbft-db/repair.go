@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func runRepair(args []string, out io.Writer) error {
+	var (
+		f      dbFlags
+		dryRun bool
+	)
+	fs := newFlagSet("repair", "[flags]", out)
+	f.register(fs, "")
+	fs.BoolVar(&dryRun, "dry-run", false, "only report what would be repaired and dropped")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if f.name == "" {
+		return errors.New("no database name given")
+	}
+	switch db.BackendType(f.backend) {
+	case db.GoLevelDBBackend:
+		return repairGoLevelDB(f, dryRun, out)
+	case db.PebbleDBBackend:
+		return repairPebbleDB(f, dryRun, out)
+	default:
+		return fmt.Errorf("repair is not supported for %s databases, only goleveldb and pebbledb", f.backend)
+	}
+}
+
+func repairGoLevelDB(f dbFlags, dryRun bool, out io.Writer) error {
+	report, err := db.RepairGoLevelDB(f.name, f.dir, dryRun)
+	if err != nil {
+		return err
+	}
+	if report.OpenErr != nil {
+		fmt.Fprintf(out, "database fails to open: %v\n", report.OpenErr)
+	}
+	fmt.Fprintf(out, "checked %d tables, %d corrupted\n", report.Tables, len(report.Corrupted))
+	drop := "dropping"
+	if dryRun {
+		drop = "would drop"
+	}
+	for _, c := range report.Corrupted {
+		fmt.Fprintf(out, "%s %s: %v\n", drop, filepath.Base(c.File), c.Err)
+	}
+	switch {
+	case !report.NeedsRepair():
+		fmt.Fprintln(out, "no repair needed")
+	case dryRun:
+		fmt.Fprintln(out, "would rebuild the manifest from the remaining tables")
+	default:
+		if report.QuarantineDir != "" {
+			fmt.Fprintln(out, "moved corrupted tables to", report.QuarantineDir)
+		}
+		fmt.Fprintln(out, "rebuilt the manifest, the database is repaired")
+	}
+	return nil
+}
+
+func repairPebbleDB(f dbFlags, dryRun bool, out io.Writer) error {
+	report, err := db.RepairPebbleDB(f.name, f.dir, dryRun)
+	if err != nil {
+		return err
+	}
+	switch {
+	case report.OpenErr != nil:
+		fmt.Fprintf(out, "database fails to open: %v\n", report.OpenErr)
+	case report.CheckErr != nil:
+		fmt.Fprintf(out, "database is inconsistent: %v\n", report.CheckErr)
+	default:
+		fmt.Fprintf(out, "checked %d points and %d tombstones\n", report.Stats.NumPoints, report.Stats.NumTombstones)
+	}
+	if report.NeedsRepair() {
+		return errors.New("pebble databases cannot be repaired in place, copy their readable data with export")
+	}
+	if report.Recovered {
+		fmt.Fprintln(out, "replayed and flushed the write-ahead log, the database is consistent")
+	} else {
+		fmt.Fprintln(out, "the database is consistent")
+	}
+	return nil
+}
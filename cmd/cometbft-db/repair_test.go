@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b")
+	manifests, err := filepath.Glob(filepath.Join(dir, "test.db", "MANIFEST-*"))
+	require.NoError(t, err)
+	for _, manifest := range manifests {
+		require.NoError(t, os.WriteFile(manifest, []byte("corrupted"), 0o600))
+	}
+
+	out, err := runCommand(t, "repair", "-dir", dir, "-name", "test", "-dry-run")
+	require.NoError(t, err)
+	require.Contains(t, out, "database fails to open")
+	require.Contains(t, out, "would rebuild the manifest")
+
+	out, err = runCommand(t, "repair", "-dir", dir, "-name", "test")
+	require.NoError(t, err)
+	require.Contains(t, out, "the database is repaired")
+	out, err = runCommand(t, "get", "-dir", dir, "-name", "test", "-value-encoding", "raw", "H:2")
+	require.NoError(t, err)
+	require.Equal(t, "b\n", out)
+
+	out, err = runCommand(t, "repair", "-dir", dir, "-name", "test")
+	require.NoError(t, err)
+	require.Contains(t, out, "no repair needed")
+
+	_, err = runCommand(t, "repair", "-backend", "memdb", "-name", "test")
+	require.ErrorContains(t, err, "not supported")
+}
+
+func TestRepairPebble(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a")
+	toDir := t.TempDir()
+	_, err := runCommand(t, "migrate", "-dir", dir, "-name", "test", "-to-dir", toDir)
+	require.NoError(t, err)
+
+	out, err := runCommand(t, "repair", "-backend", "pebbledb", "-dir", toDir, "-name", "test")
+	require.NoError(t, err)
+	require.Contains(t, out, "checked 1 points")
+	require.Contains(t, out, "the database is consistent")
+}
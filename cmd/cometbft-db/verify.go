@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// maxVerifyIssues is the number of issues of each kind listed by a verify report.
+const maxVerifyIssues = 100
+
+// verifyReport is the report printed by the verify command, as JSON.
+type verifyReport struct {
+	Backend string `json:"backend"`
+	Keys    uint64 `json:"keys"`
+	Bytes   uint64 `json:"bytes"`
+	// OrderViolations counts keys not strictly greater than their predecessor.
+	OrderViolations uint64       `json:"order_violations"`
+	Order           []keyIssue   `json:"order,omitempty"`
+	Sampled         uint64       `json:"sampled"`
+	SampleFailures  uint64       `json:"sample_failures"`
+	Samples         []keyIssue   `json:"samples,omitempty"`
+	Native          *nativeCheck `json:"native"`
+	Error           string       `json:"error,omitempty"`
+	OK              bool         `json:"ok"`
+}
+
+// keyIssue describes a problem found at a key.
+type keyIssue struct {
+	Key   string `json:"key"` // hex encoded
+	Issue string `json:"issue"`
+}
+
+// nativeCheck is the result of the checks of the backend, if it implements db.Checker.
+type nativeCheck struct {
+	Supported bool             `json:"supported"`
+	Checks    []db.CheckResult `json:"checks,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	ok        bool
+}
+
+func runVerify(args []string, out io.Writer) error {
+	var (
+		f           dbFlags
+		sampleEvery uint64
+	)
+	fs := newFlagSet("verify", "[flags]", out)
+	f.register(fs, "")
+	fs.Uint64Var(&sampleEvery, "sample-every", 100, "re-read every nth key with Get, or 0 to skip")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	kvdb, err := f.open(false)
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	report := verifyKeyspace(kvdb, sampleEvery)
+	report.Backend = f.backend
+	report.Native = verifyNative(kvdb)
+	report.OK = report.Error == "" && report.OrderViolations == 0 && report.SampleFailures == 0 &&
+		report.Native.Error == "" && report.Native.ok
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if !report.OK {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+// verifyKeyspace iterates over all keys of kvdb, checking that they are strictly ordered, and
+// reads every nth key again with Get.
+func verifyKeyspace(kvdb db.DB, sampleEvery uint64) *verifyReport {
+	report := &verifyReport{}
+	itr, err := kvdb.Iterator(nil, nil)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	defer itr.Close()
+
+	var prev []byte
+	for ; itr.Valid(); itr.Next() {
+		key, value := itr.Key(), itr.Value()
+		report.Keys++
+		report.Bytes += uint64(len(key) + len(value))
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			report.OrderViolations++
+			if len(report.Order) < maxVerifyIssues {
+				report.Order = append(report.Order, keyIssue{
+					Key:   hex.EncodeToString(key),
+					Issue: "not greater than previous key " + hex.EncodeToString(prev),
+				})
+			}
+		}
+		prev = append(prev[:0], key...)
+
+		if sampleEvery == 0 || report.Keys%sampleEvery != 0 {
+			continue
+		}
+		report.Sampled++
+		var issue string
+		switch got, err := kvdb.Get(key); {
+		case err != nil:
+			issue = "get failed: " + err.Error()
+		case got == nil:
+			issue = "get returned no value"
+		case !bytes.Equal(got, value):
+			issue = "get returned a different value than the iterator"
+		}
+		if issue != "" {
+			report.SampleFailures++
+			if len(report.Samples) < maxVerifyIssues {
+				report.Samples = append(report.Samples, keyIssue{Key: hex.EncodeToString(key), Issue: issue})
+			}
+		}
+	}
+	if err := itr.Error(); err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// verifyNative runs the checks of the backend, e.g. the verification of table checksums, if it
+// has any.
+func verifyNative(kvdb db.DB) *nativeCheck {
+	check := &nativeCheck{ok: true}
+	checker, ok := kvdb.(db.Checker)
+	if !ok {
+		return check
+	}
+	check.Supported = true
+	report, err := checker.Check(context.Background())
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Checks = report.Checks
+	check.ok = report.OK()
+	return check
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func TestVerify(t *testing.T) {
+	dir := newTestDB(t, "H:1", "a", "H:2", "b", "P:1", "c")
+
+	out, err := runCommand(t, "verify", "-dir", dir, "-name", "test", "-sample-every", "1")
+	require.NoError(t, err)
+	var report verifyReport
+	require.NoError(t, json.Unmarshal([]byte(out), &report))
+	require.True(t, report.OK)
+	require.EqualValues(t, 3, report.Keys)
+	require.EqualValues(t, 3, report.Sampled)
+	require.True(t, report.Native.Supported)
+	require.Len(t, report.Native.Checks, 2)
+	require.Equal(t, "table-checksums", report.Native.Checks[0].Name)
+}
+
+// misorderedDB returns its keys out of order from iterators, and no values from Get.
+type misorderedDB struct {
+	*db.MemDB
+}
+
+func (m misorderedDB) Iterator(start, end []byte) (db.Iterator, error) {
+	return m.MemDB.ReverseIterator(start, end)
+}
+
+func (m misorderedDB) Get([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func TestVerifyKeyspace(t *testing.T) {
+	mdb := db.NewMemDB()
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, mdb.Set([]byte(key), []byte(key)))
+	}
+	report := verifyKeyspace(misorderedDB{mdb}, 2)
+	require.EqualValues(t, 3, report.Keys)
+	require.EqualValues(t, 2, report.OrderViolations)
+	require.Equal(t, keyIssue{Key: "61", Issue: "not greater than previous key 62"}, report.Order[1])
+	require.EqualValues(t, 1, report.Sampled)
+	require.EqualValues(t, 1, report.SampleFailures)
+	require.Equal(t, "get returned no value", report.Samples[0].Issue)
+
+	require.False(t, verifyNative(mdb).Supported)
+}
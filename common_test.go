@@ -14,7 +14,7 @@ import (
 // ----------------------------------------
 // Helper functions.
 
-func checkValue(t *testing.T, db DB, key []byte, valueWanted []byte) {
+func checkValue(t *testing.T, db DBReader, key []byte, valueWanted []byte) {
 	t.Helper()
 	valueGot, err := db.Get(key)
 	assert.NoError(t, err)
@@ -178,6 +178,34 @@ func benchmarkRandomReadsWrites(b *testing.B, db DB) {
 	}
 }
 
+// benchmarkMissingKeys measures Has and Get of keys missing from a database of numItems keys with
+// values of valueSize bytes, written to tables by flush, e.g. to show the effect of bloom filters.
+func benchmarkMissingKeys(b *testing.B, db DB, numItems int64, valueSize int, flush func() error) {
+	b.Helper()
+	for i := int64(0); i < numItems; i++ {
+		// Even keys are stored, so that odd keys are missing but within the range of every table.
+		require.NoError(b, db.Set(int642Bytes(2*i), []byte(randStr(valueSize))))
+	}
+	require.NoError(b, flush())
+
+	b.Run("Has", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ok, err := db.Has(int642Bytes(2*(int64(i)%numItems) + 1))
+			if err != nil || ok {
+				b.Fatal(ok, err)
+			}
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			value, err := db.Get(int642Bytes(2*(int64(i)%numItems) + 1))
+			if err != nil || value != nil {
+				b.Fatal(value, err)
+			}
+		}
+	})
+}
+
 func int642Bytes(i int64) []byte {
 	buf := make([]byte, 8)
 	binary.BigEndian.PutUint64(buf, uint64(i))
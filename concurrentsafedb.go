@@ -0,0 +1,227 @@
+package db
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// defaultConcurrentSafeDBStripes is the number of locks of a ConcurrentSafeDB if none is given.
+const defaultConcurrentSafeDBStripes = 64
+
+// ConcurrentSafeDB wraps a database, and serializes operations on the same keys with a fixed set
+// of locks, the stripes, which keys are hashed onto, while operations on keys of different stripes
+// run in parallel. It makes any backend safe for concurrent use with the following guarantees,
+// without serializing all callers behind a single lock:
+//
+//   - Reads of a key never run concurrently with writes of the same key.
+//   - Writes of the same key are applied one at a time, in the order they acquire its stripe.
+//   - A batch holds the stripes of all its keys while it is written, so that reads of its keys
+//     observe either none or all of its writes to them.
+//   - Iterators and compactions take no stripe: they see writes as the backend allows.
+//   - Close waits for all operations holding stripes.
+type ConcurrentSafeDB struct {
+	db      DB
+	stripes []sync.RWMutex
+}
+
+var _ DB = (*ConcurrentSafeDB)(nil)
+
+// NewConcurrentSafeDB wraps inner, with the given number of stripes, or 64 if not positive. More
+// stripes allow more parallelism, at the cost of batches acquiring more locks.
+func NewConcurrentSafeDB(inner DB, stripes int) *ConcurrentSafeDB {
+	if stripes <= 0 {
+		stripes = defaultConcurrentSafeDBStripes
+	}
+	return &ConcurrentSafeDB{
+		db:      inner,
+		stripes: make([]sync.RWMutex, stripes),
+	}
+}
+
+// stripe returns the index of the stripe of key.
+func (cdb *ConcurrentSafeDB) stripe(key []byte) int {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	return int(h.Sum64() % uint64(len(cdb.stripes)))
+}
+
+// Get implements DB.
+func (cdb *ConcurrentSafeDB) Get(key []byte) ([]byte, error) {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.RLock()
+	defer stripe.RUnlock()
+	return cdb.db.Get(key)
+}
+
+// Has implements DB.
+func (cdb *ConcurrentSafeDB) Has(key []byte) (bool, error) {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.RLock()
+	defer stripe.RUnlock()
+	return cdb.db.Has(key)
+}
+
+// Set implements DB.
+func (cdb *ConcurrentSafeDB) Set(key []byte, value []byte) error {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.Lock()
+	defer stripe.Unlock()
+	return cdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (cdb *ConcurrentSafeDB) SetSync(key []byte, value []byte) error {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.Lock()
+	defer stripe.Unlock()
+	return cdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (cdb *ConcurrentSafeDB) Delete(key []byte) error {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.Lock()
+	defer stripe.Unlock()
+	return cdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (cdb *ConcurrentSafeDB) DeleteSync(key []byte) error {
+	stripe := &cdb.stripes[cdb.stripe(key)]
+	stripe.Lock()
+	defer stripe.Unlock()
+	return cdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (cdb *ConcurrentSafeDB) Iterator(start, end []byte) (Iterator, error) {
+	return cdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (cdb *ConcurrentSafeDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return cdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (cdb *ConcurrentSafeDB) Close() error {
+	for i := range cdb.stripes {
+		cdb.stripes[i].Lock()
+	}
+	defer func() {
+		for i := range cdb.stripes {
+			cdb.stripes[i].Unlock()
+		}
+	}()
+	return cdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (cdb *ConcurrentSafeDB) NewBatch() Batch {
+	return &concurrentSafeDBBatch{
+		cdb:     cdb,
+		batch:   cdb.db.NewBatch(),
+		stripes: make([]bool, len(cdb.stripes)),
+	}
+}
+
+// Print implements DB.
+func (cdb *ConcurrentSafeDB) Print() error {
+	return cdb.db.Print()
+}
+
+// Stats implements DB.
+func (cdb *ConcurrentSafeDB) Stats() map[string]string {
+	stats := cdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	stats["concurrent.stripes"] = strconv.Itoa(len(cdb.stripes))
+	return stats
+}
+
+// Compact implements DB.
+func (cdb *ConcurrentSafeDB) Compact(start, end []byte) error {
+	return cdb.db.Compact(start, end)
+}
+
+// concurrentSafeDBBatch records the stripes of its keys, which are acquired while it is written.
+type concurrentSafeDBBatch struct {
+	cdb     *ConcurrentSafeDB
+	batch   Batch
+	stripes []bool
+}
+
+var _ Batch = (*concurrentSafeDBBatch)(nil)
+
+// Set implements Batch.
+func (b *concurrentSafeDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.stripes[b.cdb.stripe(key)] = true
+	return nil
+}
+
+// Delete implements Batch.
+func (b *concurrentSafeDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.stripes[b.cdb.stripe(key)] = true
+	return nil
+}
+
+// Count implements Batch.
+func (b *concurrentSafeDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *concurrentSafeDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *concurrentSafeDBBatch) Write() error {
+	defer b.lock()()
+	return b.batch.Write()
+}
+
+// WriteSync implements Batch.
+func (b *concurrentSafeDBBatch) WriteSync() error {
+	defer b.lock()()
+	return b.batch.WriteSync()
+}
+
+// lock acquires the stripes of the batch in ascending order, so that batches cannot deadlock,
+// and returns a function releasing them.
+func (b *concurrentSafeDBBatch) lock() func() {
+	for i, ok := range b.stripes {
+		if ok {
+			b.cdb.stripes[i].Lock()
+		}
+	}
+	return func() {
+		for i, ok := range b.stripes {
+			if ok {
+				b.cdb.stripes[i].Unlock()
+			}
+		}
+	}
+}
+
+// Reset implements Batch.
+func (b *concurrentSafeDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.stripes)
+	return nil
+}
+
+// Close implements Batch.
+func (b *concurrentSafeDBBatch) Close() error {
+	return b.batch.Close()
+}
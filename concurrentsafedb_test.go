@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentSafeDBStress(t *testing.T) {
+	cdb := NewConcurrentSafeDB(NewMemDB(), 8)
+	defer cdb.Close()
+
+	const (
+		workers = 8
+		rounds  = 200
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				// Every worker writes its own keys, and reads and deletes shared ones.
+				own := bz(fmt.Sprintf("w%d/%d", w, i%10))
+				shared := bz(fmt.Sprintf("shared/%d", i%5))
+				value := bz(fmt.Sprintf("%d", i))
+				require.NoError(t, cdb.Set(own, value))
+				checkValue(t, cdb, own, value)
+
+				batch := cdb.NewBatch()
+				require.NoError(t, batch.Set(shared, value))
+				require.NoError(t, batch.Set(own, value))
+				require.NoError(t, batch.Write())
+				require.NoError(t, batch.Close())
+
+				_, err := cdb.Get(shared)
+				require.NoError(t, err)
+				if i%7 == 0 {
+					require.NoError(t, cdb.DeleteSync(shared))
+				}
+				if i%50 == 0 {
+					itr, err := cdb.Iterator(nil, nil)
+					require.NoError(t, err)
+					require.NoError(t, itr.Close())
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		for i := rounds - 10; i < rounds; i++ {
+			checkValue(t, cdb, bz(fmt.Sprintf("w%d/%d", w, i%10)), bz(fmt.Sprintf("%d", i)))
+		}
+	}
+}
+
+func TestConcurrentSafeDBBatchAtomicity(t *testing.T) {
+	cdb := NewConcurrentSafeDB(NewMemDB(), 4)
+	defer cdb.Close()
+
+	// Batches write the same value to two keys. A reader holding both stripes, as a batch does,
+	// always observes equal values.
+	keys := [][]byte{bz("a"), bz("b")}
+	require.NoError(t, cdb.Set(keys[0], bz("0")))
+	require.NoError(t, cdb.Set(keys[1], bz("0")))
+	reader := cdb.NewBatch().(*concurrentSafeDBBatch)
+	for _, key := range keys {
+		reader.stripes[cdb.stripe(key)] = true
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 200; i++ {
+			batch := cdb.NewBatch()
+			require.NoError(t, batch.Set(keys[0], bz(fmt.Sprint(i))))
+			require.NoError(t, batch.Set(keys[1], bz(fmt.Sprint(i))))
+			require.NoError(t, batch.Write())
+			require.NoError(t, batch.Close())
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		unlock := reader.lock()
+		a, err := cdb.db.Get(keys[0])
+		require.NoError(t, err)
+		b, err := cdb.db.Get(keys[1])
+		require.NoError(t, err)
+		unlock()
+		require.Equal(t, a, b)
+	}
+	wg.Wait()
+	require.NoError(t, reader.Close())
+	require.Equal(t, "4", cdb.Stats()["concurrent.stripes"])
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type BackendType string
@@ -41,9 +42,39 @@ const (
 	// PebbleDBDBBackend represents pebble (uses github.com/cockroachdb/pebble)
 	//   - pure go
 	PebbleDBBackend BackendType = "pebbledb"
+	// BitcaskDBBackend represents an append-only log with an in-memory key directory (see
+	// BitcaskDB), suited for write-heavy stores which are rarely scanned
+	//   - pure go
+	//   - all keys must fit in memory
+	BitcaskDBBackend BackendType = "bitcask"
 )
 
-type dbCreator func(name string, dir string) (DB, error)
+// Option configures a database opened with NewDB. Options that do not apply to the selected
+// backend are ignored.
+type Option func(*dbOptions)
+
+// dbOptions holds the backend settings collected from the Options passed to NewDB.
+type dbOptions struct {
+	clock         Clock
+	events        eventSource
+	tracking      *resourceTracking
+	periodicSync  periodicSyncOptions
+	statsCacheTTL time.Duration
+	deadlines     *DeadlineDBConfig
+	goLevelDB     goLevelDBOptions
+	pebble        pebbleOptions
+}
+
+func newDBOptions(opts []Option) *dbOptions {
+	o := &dbOptions{clock: SystemClock}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.events.clock = o.clock
+	return o
+}
+
+type dbCreator func(name string, dir string, opts *dbOptions) (DB, error)
 
 var backends = map[BackendType]dbCreator{}
 
@@ -55,8 +86,9 @@ func registerDBCreator(backend BackendType, creator dbCreator) {
 	backends[backend] = creator
 }
 
-// NewDB creates a new database of type backend with the given name.
-func NewDB(name string, backend BackendType, dir string) (DB, error) {
+// NewDB creates a new database of type backend with the given name, configured with the given
+// options.
+func NewDB(name string, backend BackendType, dir string, opts ...Option) (DB, error) {
 	dbCreator, ok := backends[backend]
 	if !ok {
 		keys := make([]string, 0, len(backends))
@@ -67,9 +99,26 @@ func NewDB(name string, backend BackendType, dir string) (DB, error) {
 			backend, strings.Join(keys, ","))
 	}
 
-	db, err := dbCreator(name, dir)
+	o := newDBOptions(opts)
+	o.events.backend, o.events.name, o.events.dir = backend, name, dir
+	db, err := dbCreator(name, dir, o)
 	if err != nil {
+		o.events.checkCorruption(err)
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
+	if o.deadlines != nil {
+		cfg := *o.deadlines
+		if cfg.Clock == nil {
+			cfg.Clock = o.clock
+		}
+		db = NewDeadlineDB(db, cfg)
+	}
+	if o.events.bus != nil {
+		o.events.publish(EventOpen, nil, "", 0)
+		db = &eventDB{db: db, source: o.events}
+	}
+	if o.tracking != nil {
+		db = &trackedDB{db: db, source: o.events, captureStacks: o.tracking.captureStacks}
+	}
 	return db, nil
 }
@@ -0,0 +1,19 @@
+package dbtest
+
+import (
+	"time"
+
+	db "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+)
+
+// ManualClock is a clock which only moves when advanced, so that code measuring durations or
+// waiting for timers can be tested deterministically. It satisfies the db.Clock interface.
+type ManualClock = clocktest.ManualClock
+
+var _ db.Clock = (*ManualClock)(nil)
+
+// NewManualClock creates a clock set to the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return clocktest.NewManualClock(now)
+}
@@ -0,0 +1,607 @@
+package dbtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// OpenFunc opens the database with the given name for a conformance check. Opening a database
+// again after closing it must return its previous contents, unless the backend is not persistent.
+type OpenFunc func(name string) (db.DB, error)
+
+// Guarantee is a semantic of the DB interface that callers may rely on, expressed as an executable
+// check. Required guarantees must hold for every backend. The others are capabilities which differ
+// between backends and configurations, and are reported by Capabilities.
+type Guarantee struct {
+	// Name identifies the guarantee, e.g. "iterator/end-exclusive".
+	Name string
+	// Description documents the guarantee.
+	Description string
+	// Required is set for guarantees every backend must provide.
+	Required bool
+	// Check verifies the guarantee, returning an error describing the first violation. It must close
+	// all databases it opens.
+	Check func(open func() (db.DB, error)) error
+}
+
+// Result is the outcome of checking a guarantee against a backend.
+type Result struct {
+	Guarantee Guarantee
+	// Err is nil if the guarantee holds.
+	Err error
+}
+
+// Holds reports whether the guarantee holds.
+func (r Result) Holds() bool {
+	return r.Err == nil
+}
+
+// Spec lists the guarantees of the DB interface.
+var Spec = []Guarantee{
+	{
+		Name:        "get/missing",
+		Description: "Get returns a nil value and no error for missing keys, and Has returns false.",
+		Required:    true,
+		Check:       withDB(checkGetMissing),
+	},
+	{
+		Name:        "keys/empty-rejected",
+		Description: "Get, Has, Set and Delete reject nil and empty keys with an error.",
+		Required:    true,
+		Check:       withDB(checkEmptyKeysRejected),
+	},
+	{
+		Name:        "values/nil-rejected",
+		Description: "Set and Batch.Set reject nil values with an error.",
+		Required:    true,
+		Check:       withDB(checkNilValuesRejected),
+	},
+	{
+		Name:        "values/empty-allowed",
+		Description: "Empty values can be set, and the key then exists.",
+		Required:    true,
+		Check:       withDB(checkEmptyValuesAllowed),
+	},
+	{
+		Name:        "values/empty-non-nil",
+		Description: "Get returns a non-nil empty slice for keys set to an empty value.",
+		Check:       withDB(checkEmptyValuesNonNil),
+	},
+	{
+		Name:        "iterator/order",
+		Description: "Iterator returns keys in ascending and ReverseIterator in descending bytewise order.",
+		Required:    true,
+		Check:       withDB(checkIteratorOrder),
+	},
+	{
+		Name: "iterator/bounds",
+		Description: "Iterator domains include start and exclude end in both directions, and nil bounds " +
+			"are unbounded.",
+		Required: true,
+		Check:    withDB(checkIteratorBounds),
+	},
+	{
+		Name:        "iterator/empty-bound-rejected",
+		Description: "Iterator and ReverseIterator reject empty, non-nil bounds with an error.",
+		Required:    true,
+		Check:       withDB(checkIteratorEmptyBoundRejected),
+	},
+	{
+		Name:        "iterator/copy",
+		Description: "Keys and values returned by an iterator remain unchanged after it moves on.",
+		Check:       withDB(checkIteratorCopy),
+	},
+	{
+		Name:        "get/copy",
+		Description: "Modifying a value returned by Get does not modify the stored value.",
+		Check:       withDB(checkGetCopy),
+	},
+	{
+		Name:        "set/copy",
+		Description: "Modifying a key or value after passing it to Set does not modify the stored data.",
+		Check:       withDB(checkSetCopy),
+	},
+	{
+		Name: "batch/atomic-visibility",
+		Description: "Batch operations are not visible before Write, and are applied in order by " +
+			"Write.",
+		Required: true,
+		Check:    withDB(checkBatchVisibility),
+	},
+	{
+		Name:        "batch/closed",
+		Description: "Batches cannot be used after they have been written or closed.",
+		Required:    true,
+		Check:       withDB(checkBatchClosed),
+	},
+	{
+		Name: "batch/count",
+		Description: "Batch.Count and Batch.SizeBytes report the operations pending in a batch, and " +
+			"are 0 once it was written.",
+		Required: true,
+		Check:    withDB(checkBatchCount),
+	},
+	{
+		Name:        "batch/reset",
+		Description: "Batch.Reset discards pending operations, and lets a written batch be reused.",
+		Required:    true,
+		Check:       withDB(checkBatchReset),
+	},
+	{
+		Name:        "writesync/durable",
+		Description: "Data written by SetSync, DeleteSync and Batch.WriteSync is present after reopening.",
+		Check:       checkWriteSyncDurable,
+	},
+}
+
+// Capabilities checks every guarantee of Spec against the backend opened by open, and returns the
+// results in the order of Spec.
+func Capabilities(open OpenFunc) []Result {
+	results := make([]Result, 0, len(Spec))
+	for i, g := range Spec {
+		name := fmt.Sprintf("conformance_%d_%s", i, strings.ReplaceAll(g.Name, "/", "_"))
+		err := g.Check(func() (db.DB, error) {
+			return open(name)
+		})
+		results = append(results, Result{Guarantee: g, Err: err})
+	}
+	return results
+}
+
+// RunConformance checks every guarantee of Spec against the backend opened by open in a subtest.
+// Violations of required guarantees fail the test, while missing capabilities are only logged.
+func RunConformance(t *testing.T, open OpenFunc) {
+	t.Helper()
+	for _, r := range Capabilities(open) {
+		t.Run(r.Guarantee.Name, func(t *testing.T) {
+			switch {
+			case r.Holds():
+			case r.Guarantee.Required:
+				t.Errorf("required guarantee violated: %v", r.Err)
+			default:
+				t.Logf("capability missing: %v", r.Err)
+			}
+		})
+	}
+}
+
+// withDB adapts a check using a single open database.
+func withDB(check func(d db.DB) error) func(open func() (db.DB, error)) error {
+	return func(open func() (db.DB, error)) error {
+		d, err := open()
+		if err != nil {
+			return fmt.Errorf("open: %w", err)
+		}
+		err = check(d)
+		if cerr := d.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("close: %w", cerr)
+		}
+		return err
+	}
+}
+
+// expectValue returns an error unless key has the given value, nil meaning missing.
+func expectValue(d db.DB, key, value []byte) error {
+	got, err := d.Get(key)
+	if err != nil {
+		return fmt.Errorf("get %X: %w", key, err)
+	}
+	if !bytes.Equal(got, value) || (got == nil) != (value == nil) {
+		return fmt.Errorf("get %X: expected %X, got %X", key, value, got)
+	}
+	return nil
+}
+
+// collect returns the keys and values of an iterator, which it closes.
+func collect(itr db.Iterator) ([][]byte, [][]byte, error) {
+	defer itr.Close()
+	var keys, values [][]byte
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, bytes.Clone(itr.Key()))
+		values = append(values, bytes.Clone(itr.Value()))
+	}
+	return keys, values, itr.Error()
+}
+
+func checkGetMissing(d db.DB) error {
+	if err := expectValue(d, []byte("missing"), nil); err != nil {
+		return err
+	}
+	ok, err := d.Has([]byte("missing"))
+	if err != nil {
+		return err
+	}
+	if ok {
+		return errors.New("has returned true for a missing key")
+	}
+	return nil
+}
+
+func checkEmptyKeysRejected(d db.DB) error {
+	for _, key := range [][]byte{nil, {}} {
+		if _, err := d.Get(key); err == nil {
+			return fmt.Errorf("get accepted key %#v", key)
+		}
+		if _, err := d.Has(key); err == nil {
+			return fmt.Errorf("has accepted key %#v", key)
+		}
+		if err := d.Set(key, []byte{1}); err == nil {
+			return fmt.Errorf("set accepted key %#v", key)
+		}
+		if err := d.Delete(key); err == nil {
+			return fmt.Errorf("delete accepted key %#v", key)
+		}
+	}
+	return nil
+}
+
+func checkNilValuesRejected(d db.DB) error {
+	if err := d.Set([]byte("key"), nil); err == nil {
+		return errors.New("set accepted a nil value")
+	}
+	batch := d.NewBatch()
+	defer batch.Close()
+	if err := batch.Set([]byte("key"), nil); err == nil {
+		return errors.New("batch set accepted a nil value")
+	}
+	return nil
+}
+
+func checkEmptyValuesAllowed(d db.DB) error {
+	if err := d.Set([]byte("key"), []byte{}); err != nil {
+		return err
+	}
+	ok, err := d.Has([]byte("key"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("key set to an empty value does not exist")
+	}
+	return nil
+}
+
+func checkEmptyValuesNonNil(d db.DB) error {
+	if err := d.Set([]byte("key"), []byte{}); err != nil {
+		return err
+	}
+	return expectValue(d, []byte("key"), []byte{})
+}
+
+// orderKeys are keys in ascending bytewise order, including prefixes and edge bytes.
+var orderKeys = [][]byte{{0x00}, {0x00, 0x00}, {0x00, 0xff}, {0x01}, {0x7f}, {0x80}, {0xff}, {0xff, 0x00}, {0xff, 0xff}}
+
+func checkIteratorOrder(d db.DB) error {
+	for i := len(orderKeys) - 1; i >= 0; i-- {
+		if err := d.Set(orderKeys[i], []byte{byte(i)}); err != nil {
+			return err
+		}
+	}
+	itr, err := d.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	keys, _, err := collect(itr)
+	if err != nil {
+		return err
+	}
+	if !equalKeys(keys, orderKeys) {
+		return fmt.Errorf("iterator returned %X, expected %X", keys, orderKeys)
+	}
+	itr, err = d.ReverseIterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	keys, _, err = collect(itr)
+	if err != nil {
+		return err
+	}
+	reversed := make([][]byte, 0, len(orderKeys))
+	for i := len(orderKeys) - 1; i >= 0; i-- {
+		reversed = append(reversed, orderKeys[i])
+	}
+	if !equalKeys(keys, reversed) {
+		return fmt.Errorf("reverse iterator returned %X, expected %X", keys, reversed)
+	}
+	return nil
+}
+
+func checkIteratorBounds(d db.DB) error {
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if err := d.Set([]byte(key), []byte(key)); err != nil {
+			return err
+		}
+	}
+	testcases := []struct {
+		start, end []byte
+		expect     string
+	}{
+		{nil, nil, "abcd"},
+		{[]byte("b"), []byte("d"), "bc"},
+		{[]byte("b"), nil, "bcd"},
+		{nil, []byte("c"), "ab"},
+		{[]byte("a1"), []byte("c1"), "bc"},
+		{[]byte("c"), []byte("c"), ""},
+	}
+	for _, tc := range testcases {
+		for _, reverse := range []bool{false, true} {
+			var itr db.Iterator
+			var err error
+			if reverse {
+				itr, err = d.ReverseIterator(tc.start, tc.end)
+			} else {
+				itr, err = d.Iterator(tc.start, tc.end)
+			}
+			if err != nil {
+				return err
+			}
+			keys, _, err := collect(itr)
+			if err != nil {
+				return err
+			}
+			var got []byte
+			for _, key := range keys {
+				got = append(got, key...)
+			}
+			expect := []byte(tc.expect)
+			if reverse {
+				expect = bytes.Clone(expect)
+				for i, j := 0, len(expect)-1; i < j; i, j = i+1, j-1 {
+					expect[i], expect[j] = expect[j], expect[i]
+				}
+			}
+			if !bytes.Equal(got, expect) {
+				return fmt.Errorf("iterating [%q, %q) (reverse %v) returned %q, expected %q",
+					tc.start, tc.end, reverse, got, expect)
+			}
+		}
+	}
+	return nil
+}
+
+func checkIteratorEmptyBoundRejected(d db.DB) error {
+	for _, bounds := range [][2][]byte{{{}, nil}, {nil, {}}} {
+		if itr, err := d.Iterator(bounds[0], bounds[1]); err == nil {
+			itr.Close()
+			return fmt.Errorf("iterator accepted bounds %#v", bounds)
+		}
+		if itr, err := d.ReverseIterator(bounds[0], bounds[1]); err == nil {
+			itr.Close()
+			return fmt.Errorf("reverse iterator accepted bounds %#v", bounds)
+		}
+	}
+	return nil
+}
+
+func checkIteratorCopy(d db.DB) error {
+	for i := byte(1); i <= 8; i++ {
+		if err := d.Set(bytes.Repeat([]byte{i}, 16), bytes.Repeat([]byte{i}, 64)); err != nil {
+			return err
+		}
+	}
+	itr, err := d.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	var keys, values [][]byte
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, itr.Key())
+		values = append(values, itr.Value())
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+	for i := range keys {
+		b := byte(i + 1)
+		if !bytes.Equal(keys[i], bytes.Repeat([]byte{b}, 16)) || !bytes.Equal(values[i], bytes.Repeat([]byte{b}, 64)) {
+			return fmt.Errorf("key or value %d changed after the iterator moved on", i)
+		}
+	}
+	return nil
+}
+
+func checkGetCopy(d db.DB) error {
+	if err := d.Set([]byte("key"), []byte("value")); err != nil {
+		return err
+	}
+	value, err := d.Get([]byte("key"))
+	if err != nil {
+		return err
+	}
+	value[0] = 'X'
+	return expectValue(d, []byte("key"), []byte("value"))
+}
+
+func checkSetCopy(d db.DB) error {
+	key, value := []byte("key"), []byte("value")
+	if err := d.Set(key, value); err != nil {
+		return err
+	}
+	key[0], value[0] = 'X', 'X'
+	return expectValue(d, []byte("key"), []byte("value"))
+}
+
+func checkBatchVisibility(d db.DB) error {
+	if err := d.Set([]byte("b"), []byte("old")); err != nil {
+		return err
+	}
+	batch := d.NewBatch()
+	defer batch.Close()
+	ops := []func() error{
+		func() error { return batch.Set([]byte("a"), []byte("1")) },
+		func() error { return batch.Delete([]byte("a")) },
+		func() error { return batch.Delete([]byte("b")) },
+		func() error { return batch.Set([]byte("b"), []byte("new")) },
+		func() error { return batch.Set([]byte("c"), []byte("1")) },
+	}
+	for _, op := range ops {
+		if err := op(); err != nil {
+			return err
+		}
+	}
+	if err := expectValue(d, []byte("b"), []byte("old")); err != nil {
+		return fmt.Errorf("before write: %w", err)
+	}
+	if err := expectValue(d, []byte("c"), nil); err != nil {
+		return fmt.Errorf("before write: %w", err)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	for key, value := range map[string][]byte{"a": nil, "b": []byte("new"), "c": []byte("1")} {
+		if err := expectValue(d, []byte(key), value); err != nil {
+			return fmt.Errorf("after write: %w", err)
+		}
+	}
+	return nil
+}
+
+func checkBatchCount(d db.DB) error {
+	batch := d.NewBatch()
+	defer batch.Close()
+	if n := batch.Count(); n != 0 {
+		return fmt.Errorf("new batch has count %d", n)
+	}
+	if err := batch.Set([]byte("key"), []byte("value")); err != nil {
+		return err
+	}
+	if err := batch.Delete([]byte("other")); err != nil {
+		return err
+	}
+	if n := batch.Count(); n != 2 {
+		return fmt.Errorf("batch of 2 operations has count %d", n)
+	}
+	if n := batch.SizeBytes(); n < len("keyvalueother") {
+		return fmt.Errorf("batch has size %d, less than its keys and values", n)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if n, size := batch.Count(), batch.SizeBytes(); n != 0 || size != 0 {
+		return fmt.Errorf("written batch has count %d and size %d", n, size)
+	}
+	return nil
+}
+
+func checkBatchClosed(d db.DB) error {
+	batch := d.NewBatch()
+	if err := batch.Set([]byte("a"), []byte("1")); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if err := batch.Set([]byte("b"), []byte("1")); err == nil {
+		return errors.New("batch set succeeded after write")
+	}
+	if err := batch.Write(); err == nil {
+		return errors.New("batch write succeeded twice")
+	}
+	if err := batch.Close(); err != nil {
+		return err
+	}
+
+	batch = d.NewBatch()
+	if err := batch.Close(); err != nil {
+		return err
+	}
+	if err := batch.Delete([]byte("a")); err == nil {
+		return errors.New("batch delete succeeded after close")
+	}
+	if err := batch.WriteSync(); err == nil {
+		return errors.New("batch write succeeded after close")
+	}
+	return expectValue(d, []byte("b"), nil)
+}
+
+func checkBatchReset(d db.DB) error {
+	batch := d.NewBatch()
+	defer batch.Close()
+	if err := batch.Set([]byte("a"), []byte("1")); err != nil {
+		return err
+	}
+	if err := batch.Reset(); err != nil {
+		return err
+	}
+	if n := batch.Count(); n != 0 {
+		return fmt.Errorf("reset batch has count %d", n)
+	}
+	for _, value := range []string{"2", "3"} {
+		if err := batch.Set([]byte("b"), []byte(value)); err != nil {
+			return err
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		if err := expectValue(d, []byte("b"), []byte(value)); err != nil {
+			return err
+		}
+		if err := batch.Reset(); err != nil {
+			return fmt.Errorf("reset after write: %w", err)
+		}
+	}
+	if err := batch.Close(); err != nil {
+		return err
+	}
+	if err := batch.Reset(); err == nil {
+		return errors.New("batch reset succeeded after close")
+	}
+	return expectValue(d, []byte("a"), nil)
+}
+
+func checkWriteSyncDurable(open func() (db.DB, error)) error {
+	d, err := open()
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	err = func() error {
+		if err := d.SetSync([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		if err := d.Set([]byte("b"), []byte("1")); err != nil {
+			return err
+		}
+		if err := d.DeleteSync([]byte("b")); err != nil {
+			return err
+		}
+		batch := d.NewBatch()
+		defer batch.Close()
+		if err := batch.Set([]byte("c"), []byte("1")); err != nil {
+			return err
+		}
+		return batch.WriteSync()
+	}()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return withDB(func(d db.DB) error {
+		for key, value := range map[string][]byte{"a": []byte("1"), "b": nil, "c": []byte("1")} {
+			if err := expectValue(d, []byte(key), value); err != nil {
+				return fmt.Errorf("after reopening: %w", err)
+			}
+		}
+		return nil
+	})(open)
+}
+
+func equalKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package dbtest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// backendOpener opens databases of the given backend in dir.
+func backendOpener(backend db.BackendType, dir string) OpenFunc {
+	return func(name string) (db.DB, error) {
+		return db.NewDB(name, backend, dir)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	backends := []db.BackendType{
+		db.GoLevelDBBackend, db.MemDBBackend, db.PebbleDBBackend,
+		db.BoltDBBackend, db.BadgerDBBackend, db.RocksDBBackend, db.CLevelDBBackend,
+	}
+	for _, backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "conformance")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			d, err := db.NewDB("probe", backend, dir)
+			if err != nil && strings.Contains(err.Error(), "unknown db_backend") {
+				t.Skipf("backend %s not built", backend)
+			}
+			require.NoError(t, err)
+			require.NoError(t, d.Close())
+
+			RunConformance(t, backendOpener(backend, dir))
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	holds := func(backend db.BackendType) map[string]bool {
+		caps := make(map[string]bool)
+		for _, r := range Capabilities(backendOpener(backend, t.TempDir())) {
+			caps[r.Guarantee.Name] = r.Holds()
+		}
+		return caps
+	}
+
+	// Pin the capabilities of the default backends, so that semantic changes are never silent.
+	goleveldb := holds(db.GoLevelDBBackend)
+	require.False(t, goleveldb["iterator/copy"])
+	require.True(t, goleveldb["writesync/durable"])
+
+	memdb := holds(db.MemDBBackend)
+	require.True(t, memdb["iterator/copy"])
+	require.False(t, memdb["get/copy"])
+	require.True(t, memdb["set/copy"])
+	require.False(t, memdb["writesync/durable"])
+
+	pebble := holds(db.PebbleDBBackend)
+	require.False(t, pebble["iterator/copy"])
+	require.True(t, pebble["writesync/durable"])
+
+	// Copying can be restored on goleveldb.
+	dir := t.TempDir()
+	caps := Capabilities(func(name string) (db.DB, error) {
+		return db.NewDB(name, db.GoLevelDBBackend, dir, db.WithGoLevelDBIteratorCopy())
+	})
+	for _, r := range caps {
+		if r.Guarantee.Name == "iterator/copy" {
+			require.True(t, r.Holds(), r.Err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package dbtest provides helpers for testing, benchmarking and fuzzing database backends and the
+// code built on top of them with data shaped like real CometBFT workloads.
+package dbtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	// HashSize is the size of CometBFT block, transaction and evidence hashes.
+	HashSize = 32
+	// BlockPartSize is the size of a full CometBFT block part.
+	BlockPartSize = 65536
+)
+
+// KeyFunc generates a key using the given source of randomness.
+type KeyFunc func(r *rand.Rand) []byte
+
+// ValueFunc generates a value using the given source of randomness.
+type ValueFunc func(r *rand.Rand) []byte
+
+// NewRand returns a deterministic source of randomness, so that generated data sets are
+// reproducible across runs and backends.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed)) //nolint:gosec // G404: reproducibility is intended
+}
+
+// BlockMetaKey returns the blockstore key of the block meta at the given height.
+func BlockMetaKey(height int64) []byte {
+	return []byte(fmt.Sprintf("H:%v", height))
+}
+
+// BlockPartKey returns the blockstore key of a block part.
+func BlockPartKey(height int64, part int) []byte {
+	return []byte(fmt.Sprintf("P:%v:%v", height, part))
+}
+
+// BlockCommitKey returns the blockstore key of the commit for the given height.
+func BlockCommitKey(height int64) []byte {
+	return []byte(fmt.Sprintf("C:%v", height))
+}
+
+// BlockHashKey returns the blockstore key indexing a block by its hash.
+func BlockHashKey(hash []byte) []byte {
+	return []byte(fmt.Sprintf("BH:%x", hash))
+}
+
+// TxHeightKey returns a tx_index key of a transaction, indexed by height.
+func TxHeightKey(height int64, index uint32) []byte {
+	return []byte(fmt.Sprintf("tx.height/%d/%d/%d", height, height, index))
+}
+
+// OrderedHeightKey returns prefix followed by the big-endian encoded height, so that keys sort by
+// height.
+func OrderedHeightKey(prefix []byte, height uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], height)
+	return key
+}
+
+// Hash returns random bytes of the size of a CometBFT hash.
+func Hash(r *rand.Rand) []byte {
+	return RandBytes(r, HashSize)
+}
+
+// RandBytes returns n random bytes.
+func RandBytes(r *rand.Rand, n int) []byte {
+	bz := make([]byte, n)
+	_, _ = r.Read(bz)
+	return bz
+}
+
+// SequentialHeightKeys generates the keys of a height-indexed store, such as block metas, in the
+// order they are written by a node: the key function is called with heights start, start+1, ...
+func SequentialHeightKeys(key func(height int64) []byte, start int64) KeyFunc {
+	height := start
+	return func(*rand.Rand) []byte {
+		k := key(height)
+		height++
+		return k
+	}
+}
+
+// RandomHeightKeys generates the keys of a height-indexed store for uniformly random heights in
+// [1, maxHeight], as produced by RPC queries for historical data.
+func RandomHeightKeys(key func(height int64) []byte, maxHeight int64) KeyFunc {
+	return func(r *rand.Rand) []byte {
+		return key(r.Int63n(maxHeight) + 1)
+	}
+}
+
+// HashKeys generates prefix followed by a random hash, as used to index transactions or evidence.
+func HashKeys(prefix []byte) KeyFunc {
+	return func(r *rand.Rand) []byte {
+		return append(append([]byte{}, prefix...), Hash(r)...)
+	}
+}
+
+// WeightedKeyFunc is a KeyFunc chosen with the given relative weight by MixedKeys.
+type WeightedKeyFunc struct {
+	Weight int
+	Key    KeyFunc
+}
+
+// MixedKeys picks one of the given key functions at random, according to their weights, for every
+// key. It can be used to model a store holding several prefixes, such as the blockstore.
+func MixedKeys(keys ...WeightedKeyFunc) KeyFunc {
+	total := 0
+	for _, k := range keys {
+		if k.Weight <= 0 {
+			panic("key function weights must be positive")
+		}
+		total += k.Weight
+	}
+	return func(r *rand.Rand) []byte {
+		n := r.Intn(total)
+		for _, k := range keys {
+			if n < k.Weight {
+				return k.Key(r)
+			}
+			n -= k.Weight
+		}
+		panic("unreachable")
+	}
+}
+
+// FixedSizeValues generates random values of the given size.
+func FixedSizeValues(size int) ValueFunc {
+	return func(r *rand.Rand) []byte {
+		return RandBytes(r, size)
+	}
+}
+
+// UniformSizeValues generates random values with a size uniformly distributed in [minSize,
+// maxSize].
+func UniformSizeValues(minSize, maxSize int) ValueFunc {
+	return func(r *rand.Rand) []byte {
+		return RandBytes(r, minSize+r.Intn(maxSize-minSize+1))
+	}
+}
+
+// LogNormalSizeValues generates random values whose size follows a log-normal distribution with the
+// given median, capped at maxSize. Most values stored by a node, such as transactions and ABCI
+// results, are small with a long tail of large ones, which this models better than uniform sizes.
+func LogNormalSizeValues(median int, sigma float64, maxSize int) ValueFunc {
+	mu := math.Log(float64(median))
+	return func(r *rand.Rand) []byte {
+		size := int(math.Exp(mu + sigma*r.NormFloat64()))
+		if size > maxSize {
+			size = maxSize
+		}
+		return RandBytes(r, size)
+	}
+}
+
+// BlockPartValues generates values of the size of full block parts.
+func BlockPartValues() ValueFunc {
+	return FixedSizeValues(BlockPartSize)
+}
+
+// AddFuzzSeeds adds n key/value pairs produced by the given generators to the seed corpus of a fuzz
+// test taking ([]byte, []byte) arguments.
+func AddFuzzSeeds(f *testing.F, seed int64, n int, key KeyFunc, value ValueFunc) {
+	f.Helper()
+	r := NewRand(seed)
+	for i := 0; i < n; i++ {
+		f.Add(key(r), value(r))
+	}
+}
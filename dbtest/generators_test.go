@@ -0,0 +1,81 @@
+package dbtest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func TestKeyShapes(t *testing.T) {
+	require.Equal(t, []byte("H:12"), BlockMetaKey(12))
+	require.Equal(t, []byte("P:12:3"), BlockPartKey(12, 3))
+	require.Equal(t, []byte("C:12"), BlockCommitKey(12))
+	require.Equal(t, []byte("BH:0a0b"), BlockHashKey([]byte{0x0a, 0x0b}))
+	require.Equal(t, []byte("tx.height/5/5/1"), TxHeightKey(5, 1))
+	require.Equal(t, []byte{'h', 0, 0, 0, 0, 0, 0, 1, 0}, OrderedHeightKey([]byte("h"), 256))
+	require.Negative(t, bytes.Compare(OrderedHeightKey(nil, 9), OrderedHeightKey(nil, 10)))
+}
+
+func TestKeyFuncs(t *testing.T) {
+	r := NewRand(1)
+
+	seq := SequentialHeightKeys(BlockMetaKey, 1)
+	require.Equal(t, []byte("H:1"), seq(r))
+	require.Equal(t, []byte("H:2"), seq(r))
+
+	random := RandomHeightKeys(BlockCommitKey, 10)
+	for i := 0; i < 100; i++ {
+		require.True(t, bytes.HasPrefix(random(r), []byte("C:")))
+	}
+
+	hashes := HashKeys([]byte("tx/"))
+	key := hashes(r)
+	require.Len(t, key, 3+HashSize)
+	require.True(t, bytes.HasPrefix(key, []byte("tx/")))
+
+	mixed := MixedKeys(
+		WeightedKeyFunc{Weight: 1, Key: func(_ *rand.Rand) []byte { return []byte("a") }},
+		WeightedKeyFunc{Weight: 3, Key: func(_ *rand.Rand) []byte { return []byte("b") }},
+	)
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[string(mixed(r))]++
+	}
+	require.Greater(t, counts["b"], counts["a"])
+	require.Equal(t, 1000, counts["a"]+counts["b"])
+}
+
+func TestValueFuncs(t *testing.T) {
+	r := NewRand(1)
+
+	require.Len(t, FixedSizeValues(10)(r), 10)
+	require.Len(t, BlockPartValues()(r), BlockPartSize)
+	for i := 0; i < 100; i++ {
+		size := len(UniformSizeValues(5, 8)(r))
+		require.GreaterOrEqual(t, size, 5)
+		require.LessOrEqual(t, size, 8)
+		require.LessOrEqual(t, len(LogNormalSizeValues(100, 1, 1000)(r)), 1000)
+	}
+}
+
+func TestNewRandIsDeterministic(t *testing.T) {
+	require.Equal(t, Hash(NewRand(7)), Hash(NewRand(7)))
+}
+
+func FuzzMemDBSetGet(f *testing.F) {
+	AddFuzzSeeds(f, 1, 10, HashKeys([]byte("tx/")), LogNormalSizeValues(200, 1, 4096))
+	f.Fuzz(func(t *testing.T, key, value []byte) {
+		if len(key) == 0 {
+			return
+		}
+		mdb := db.NewMemDB()
+		require.NoError(t, mdb.Set(key, value))
+		got, err := mdb.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+}
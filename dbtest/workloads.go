@@ -0,0 +1,214 @@
+package dbtest
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+// workloadKeyPrefix is the prefix of the keys of the records of a workload.
+var workloadKeyPrefix = []byte("user")
+
+// Workload is a parameterized benchmark workload, modeled after the YCSB core workloads: a number
+// of records is loaded, and each operation of the benchmark is then chosen at random among reads,
+// updates, inserts and scans according to their weights.
+type Workload struct {
+	// Name identifies the workload in benchmark names.
+	Name string
+	// Records is the number of records loaded before the benchmark starts.
+	Records int
+	// Reads, Updates, Inserts and Scans are the relative weights of each operation. Reads and
+	// updates get and set existing records, inserts add new records after the existing ones, and
+	// scans iterate over ScanLength records from an existing one.
+	Reads, Updates, Inserts, Scans int
+	// ScanLength is the number of records read by each scan.
+	ScanLength int
+	// Value generates the values of loaded, updated and inserted records.
+	Value ValueFunc
+	// Skewed chooses records with a zipfian distribution favoring the most recently inserted ones,
+	// as queries for recent blocks do, instead of uniformly.
+	Skewed bool
+}
+
+// Workloads are the standard workloads run by RunWorkloads.
+var Workloads = []Workload{
+	{
+		// YCSB workload B.
+		Name:    "read-heavy",
+		Records: 10000,
+		Reads:   95,
+		Updates: 5,
+		Value:   FixedSizeValues(1000),
+		Skewed:  true,
+	},
+	{
+		// YCSB workload A.
+		Name:    "write-heavy",
+		Records: 10000,
+		Reads:   50,
+		Updates: 50,
+		Value:   FixedSizeValues(1000),
+		Skewed:  true,
+	},
+	{
+		// YCSB workload E.
+		Name:       "scan-heavy",
+		Records:    10000,
+		Scans:      95,
+		Inserts:    5,
+		ScanLength: 50,
+		Value:      FixedSizeValues(1000),
+		Skewed:     true,
+	},
+	{
+		// A node appending blocks while serving queries for recent ones, with values ranging from
+		// small metas and commits to full block parts.
+		Name:    "blockstore",
+		Records: 1000,
+		Reads:   50,
+		Inserts: 50,
+		Value:   LogNormalSizeValues(4096, 1.5, BlockPartSize),
+		Skewed:  true,
+	},
+}
+
+// workloadOps are the names of the operations of a workload, in the order of their weights.
+var workloadOps = []string{"read", "update", "insert", "scan"}
+
+// RunWorkloads runs every workload of Workloads in a sub-benchmark, against a new database opened
+// by open for each of them.
+func RunWorkloads(b *testing.B, open OpenFunc) {
+	b.Helper()
+	for _, w := range Workloads {
+		b.Run(w.Name, func(b *testing.B) {
+			d, err := open("workload_" + w.Name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer d.Close()
+			RunWorkload(b, d, w)
+		})
+	}
+}
+
+// RunWorkload loads the records of the workload into d, and runs b.N of its operations. Besides the
+// time and allocations per operation, it reports the median and 99th percentile latency of each
+// kind of operation, e.g. as read-p99-ns, so that results are comparable across backends and
+// changes.
+func RunWorkload(b *testing.B, d db.DB, w Workload) {
+	b.Helper()
+	if w.Records <= 0 {
+		b.Fatal("workload has no records")
+	}
+	r := NewRand(1)
+	if err := loadRecords(d, w, r); err != nil {
+		b.Fatal(err)
+	}
+
+	weights := []int{w.Reads, w.Updates, w.Inserts, w.Scans}
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		b.Fatal("workload has no operations")
+	}
+	var zipf *rand.Zipf
+	if w.Skewed {
+		zipf = rand.NewZipf(r, 1.01, 1, uint64(w.Records-1))
+	}
+	records := w.Records
+	// existing chooses an existing record.
+	existing := func() int {
+		if zipf != nil {
+			return max(records-1-int(zipf.Uint64()), 0)
+		}
+		return r.Intn(records)
+	}
+	latencies := make([][]time.Duration, len(workloadOps))
+	for op := range latencies {
+		latencies[op] = make([]time.Duration, 0, b.N)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op, n := 0, r.Intn(total)
+		for n >= weights[op] {
+			n -= weights[op]
+			op++
+		}
+		start := time.Now()
+		var err error
+		switch op {
+		case 0:
+			_, err = d.Get(workloadKey(existing()))
+		case 1:
+			err = d.Set(workloadKey(existing()), w.Value(r))
+		case 2:
+			err = d.Set(workloadKey(records), w.Value(r))
+			records++
+		case 3:
+			err = scanRecords(d, workloadKey(existing()), w.ScanLength)
+		}
+		if err != nil {
+			b.Fatalf("%s: %v", workloadOps[op], err)
+		}
+		latencies[op] = append(latencies[op], time.Since(start))
+	}
+	b.StopTimer()
+
+	for op, l := range latencies {
+		if len(l) == 0 {
+			continue
+		}
+		slices.Sort(l)
+		b.ReportMetric(float64(l[len(l)/2].Nanoseconds()), workloadOps[op]+"-p50-ns")
+		b.ReportMetric(float64(l[len(l)*99/100].Nanoseconds()), workloadOps[op]+"-p99-ns")
+	}
+}
+
+// workloadKey returns the key of the i-th record of a workload.
+func workloadKey(i int) []byte {
+	return OrderedHeightKey(workloadKeyPrefix, uint64(i))
+}
+
+// loadRecords writes the records of a workload to d in batches.
+func loadRecords(d db.DB, w Workload, r *rand.Rand) error {
+	const batchSize = 1000
+	for start := 0; start < w.Records; start += batchSize {
+		batch := d.NewBatch()
+		for i := start; i < min(start+batchSize, w.Records); i++ {
+			if err := batch.Set(workloadKey(i), w.Value(r)); err != nil {
+				batch.Close()
+				return fmt.Errorf("load: %w", err)
+			}
+		}
+		if err := batch.Write(); err != nil {
+			batch.Close()
+			return fmt.Errorf("load: %w", err)
+		}
+		if err := batch.Close(); err != nil {
+			return fmt.Errorf("load: %w", err)
+		}
+	}
+	return nil
+}
+
+// scanRecords reads up to n records from start.
+func scanRecords(d db.DB, start []byte, n int) error {
+	itr, err := d.Iterator(start, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for i := 0; i < n && itr.Valid(); i++ {
+		_ = itr.Value()
+		itr.Next()
+	}
+	return itr.Error()
+}
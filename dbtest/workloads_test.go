@@ -0,0 +1,63 @@
+package dbtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/cometbft/cometbft-db"
+)
+
+func TestRunWorkload(t *testing.T) {
+	for _, w := range Workloads {
+		t.Run(w.Name, func(t *testing.T) {
+			w.Records = 100
+			d := db.NewMemDB()
+			defer d.Close()
+
+			var failed bool
+			result := testing.Benchmark(func(b *testing.B) {
+				RunWorkload(b, d, w)
+				failed = b.Failed()
+			})
+			require.False(t, failed)
+			require.Positive(t, result.N)
+			ops := 0
+			for _, op := range workloadOps {
+				if _, ok := result.Extra[op+"-p99-ns"]; ok {
+					ops++
+				}
+			}
+			require.Positive(t, ops)
+
+			// Inserted records follow the loaded ones.
+			itr, err := d.Iterator(nil, nil)
+			require.NoError(t, err)
+			keys, _, err := collect(itr)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, len(keys), w.Records)
+			require.Equal(t, workloadKey(0), keys[0])
+		})
+	}
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+	backends := []db.BackendType{
+		db.GoLevelDBBackend, db.MemDBBackend, db.PebbleDBBackend,
+		db.BoltDBBackend, db.BadgerDBBackend, db.RocksDBBackend, db.CLevelDBBackend,
+	}
+	for _, backend := range backends {
+		b.Run(string(backend), func(b *testing.B) {
+			dir := b.TempDir()
+			d, err := db.NewDB("probe", backend, dir)
+			if err != nil && strings.Contains(err.Error(), "unknown db_backend") {
+				b.Skipf("backend %s not built", backend)
+			}
+			require.NoError(b, err)
+			require.NoError(b, d.Close())
+
+			RunWorkloads(b, backendOpener(backend, dir))
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned, wrapped in a DeadlineExceededError, by a DeadlineDB when an
+// operation does not complete within its timeout.
+var ErrDeadlineExceeded = errors.New("database operation deadline exceeded")
+
+// DeadlineExceededError is returned by a DeadlineDB when an operation does not complete within its
+// timeout. It wraps ErrDeadlineExceeded.
+type DeadlineExceededError struct {
+	Op      DBOperation
+	Timeout time.Duration
+}
+
+// Error implements error.
+func (e *DeadlineExceededError) Error() string {
+	return fmt.Sprintf("%s: %s did not complete within %s", ErrDeadlineExceeded, e.Op, e.Timeout)
+}
+
+// Unwrap returns ErrDeadlineExceeded.
+func (e *DeadlineExceededError) Unwrap() error {
+	return ErrDeadlineExceeded
+}
+
+// DeadlineDBConfig configures a DeadlineDB. A zero timeout leaves the operations it covers
+// unbounded.
+type DeadlineDBConfig struct {
+	// ReadTimeout bounds Get, Has, GetAppend and Check.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds Set, SetSync, Delete and DeleteSync.
+	WriteTimeout time.Duration
+	// BatchTimeout bounds the Write and WriteSync of batches.
+	BatchTimeout time.Duration
+	// Clock is used to time the operations. Defaults to SystemClock.
+	Clock Clock
+}
+
+// WithDeadlines makes NewDB wrap the database in a DeadlineDB configured by cfg. The clock
+// defaults to the one set by WithClock.
+func WithDeadlines(cfg DeadlineDBConfig) Option {
+	return func(o *dbOptions) {
+		o.deadlines = &cfg
+	}
+}
+
+// DeadlineDB wraps a database, and fails the operations which do not complete within their
+// timeout with a DeadlineExceededError, so that a hung disk surfaces as errors rather than as a
+// goroutine blocked forever, e.g. the one running consensus.
+//
+// The embedded backends cannot cancel an operation, so the deadline is best effort: an operation
+// which exceeds it keeps running in the background, and may still be applied once the disk
+// recovers. A batch whose write exceeds the deadline is closed once the write completes, and can
+// no longer be reset. Keys and values are copied when a timeout applies, since a write which
+// exceeds its deadline may still read them. Iterators, compactions and size estimates are not
+// bounded.
+type DeadlineDB struct {
+	db  DB
+	cfg DeadlineDBConfig
+
+	exceeded atomic.Uint64 // operations which exceeded their deadline
+	pending  atomic.Int64  // of those, the ones still running
+}
+
+var _ DB = (*DeadlineDB)(nil)
+
+// NewDeadlineDB wraps db, bounding its operations with the timeouts of cfg.
+func NewDeadlineDB(db DB, cfg DeadlineDBConfig) *DeadlineDB {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	return &DeadlineDB{db: db, cfg: cfg}
+}
+
+// withDeadline runs fn, and returns a DeadlineExceededError if it does not complete within
+// timeout. fn then keeps running in the background, and late is called once it completes.
+func withDeadline[T any](ddb *DeadlineDB, op DBOperation, timeout time.Duration, fn func() (T, error),
+	late func(),
+) (T, error) {
+	if timeout <= 0 {
+		return fn()
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ddb.cfg.Clock.After(timeout):
+		ddb.exceeded.Add(1)
+		ddb.pending.Add(1)
+		go func() {
+			<-done
+			ddb.pending.Add(-1)
+			if late != nil {
+				late()
+			}
+		}()
+		var zero T
+		return zero, &DeadlineExceededError{Op: op, Timeout: timeout}
+	}
+}
+
+// write runs a write with the write timeout. The key and value are copied, since the write may
+// still read them after the deadline, once the caller has reused them. A nil value is kept nil,
+// so that the database still rejects it.
+func (ddb *DeadlineDB) write(op DBOperation, key, value []byte, fn func(key, value []byte) error) error {
+	if ddb.cfg.WriteTimeout > 0 {
+		key, value = bytes.Clone(key), bytes.Clone(value)
+	}
+	_, err := withDeadline(ddb, op, ddb.cfg.WriteTimeout, func() (struct{}, error) {
+		return struct{}{}, fn(key, value)
+	}, nil)
+	return err
+}
+
+// Get implements DB.
+func (ddb *DeadlineDB) Get(key []byte) ([]byte, error) {
+	if ddb.cfg.ReadTimeout > 0 {
+		key = cp(key)
+	}
+	return withDeadline(ddb, OpGet, ddb.cfg.ReadTimeout, func() ([]byte, error) {
+		return ddb.db.Get(key)
+	}, nil)
+}
+
+var _ GetAppender = (*DeadlineDB)(nil)
+
+// GetAppend implements GetAppender. The value is read into dst without an intermediate copy if
+// the underlying database is a GetAppender. Since the read may still append to dst after the
+// deadline, it reads into a new buffer when a timeout applies.
+func (ddb *DeadlineDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	if ddb.cfg.ReadTimeout <= 0 {
+		return GetAppend(ddb.db, key, dst)
+	}
+	key = cp(key)
+	type result struct {
+		value []byte
+		ok    bool
+	}
+	res, err := withDeadline(ddb, OpGet, ddb.cfg.ReadTimeout, func() (result, error) {
+		value, ok, err := GetAppend(ddb.db, key, nil)
+		return result{value, ok}, err
+	}, nil)
+	if err != nil || !res.ok {
+		return dst, false, err
+	}
+	return append(dst, res.value...), true, nil
+}
+
+// Has implements DB.
+func (ddb *DeadlineDB) Has(key []byte) (bool, error) {
+	if ddb.cfg.ReadTimeout > 0 {
+		key = cp(key)
+	}
+	return withDeadline(ddb, OpHas, ddb.cfg.ReadTimeout, func() (bool, error) {
+		return ddb.db.Has(key)
+	}, nil)
+}
+
+// Set implements DB.
+func (ddb *DeadlineDB) Set(key []byte, value []byte) error {
+	return ddb.write(OpSet, key, value, ddb.db.Set)
+}
+
+// SetSync implements DB.
+func (ddb *DeadlineDB) SetSync(key []byte, value []byte) error {
+	return ddb.write(OpSetSync, key, value, ddb.db.SetSync)
+}
+
+// Delete implements DB.
+func (ddb *DeadlineDB) Delete(key []byte) error {
+	return ddb.write(OpDelete, key, nil, func(key, _ []byte) error {
+		return ddb.db.Delete(key)
+	})
+}
+
+// DeleteSync implements DB.
+func (ddb *DeadlineDB) DeleteSync(key []byte) error {
+	return ddb.write(OpDeleteSync, key, nil, func(key, _ []byte) error {
+		return ddb.db.DeleteSync(key)
+	})
+}
+
+// Iterator implements DB.
+func (ddb *DeadlineDB) Iterator(start, end []byte) (Iterator, error) {
+	return ddb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (ddb *DeadlineDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return ddb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (ddb *DeadlineDB) Close() error {
+	return ddb.db.Close()
+}
+
+// NewBatch implements DB.
+func (ddb *DeadlineDB) NewBatch() Batch {
+	return &deadlineDBBatch{ddb: ddb, batch: ddb.db.NewBatch()}
+}
+
+// Print implements DB.
+func (ddb *DeadlineDB) Print() error {
+	return ddb.db.Print()
+}
+
+// Stats implements DB.
+func (ddb *DeadlineDB) Stats() map[string]string {
+	stats := ddb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	stats["deadline.exceeded"] = strconv.FormatUint(ddb.exceeded.Load(), 10)
+	stats["deadline.pending"] = strconv.FormatInt(ddb.pending.Load(), 10)
+	return stats
+}
+
+// Compact implements DB.
+func (ddb *DeadlineDB) Compact(start, end []byte) error {
+	return ddb.db.Compact(start, end)
+}
+
+var _ Checker = (*DeadlineDB)(nil)
+
+// Check implements Checker, with the read timeout. The check of the underlying database is
+// canceled once the deadline is exceeded.
+func (ddb *DeadlineDB) Check(ctx context.Context) (*CheckReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return withDeadline(ddb, OpCheck, ddb.cfg.ReadTimeout, func() (*CheckReport, error) {
+		return Check(ctx, ddb.db)
+	}, nil)
+}
+
+var _ RangeSizeEstimator = (*DeadlineDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator, if the underlying database does. Otherwise, it
+// returns 0.
+func (ddb *DeadlineDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	estimator, ok := ddb.db.(RangeSizeEstimator)
+	if !ok {
+		return 0, nil
+	}
+	return estimator.EstimateRangeSize(start, end)
+}
+
+// deadlineDBBatch bounds the writes of a batch of the underlying database.
+type deadlineDBBatch struct {
+	ddb   *DeadlineDB
+	batch Batch // nil once closed, or abandoned to a write which exceeded the deadline
+}
+
+var _ Batch = (*deadlineDBBatch)(nil)
+
+// Set implements Batch. The key and value are copied if the batch timeout applies, since batches
+// such as those of MemDB keep them until written, which may go on after the deadline.
+func (b *deadlineDBBatch) Set(key, value []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if b.ddb.cfg.BatchTimeout > 0 {
+		key, value = bytes.Clone(key), bytes.Clone(value)
+	}
+	return b.batch.Set(key, value)
+}
+
+// Delete implements Batch. The key is copied if the batch timeout applies, see Set.
+func (b *deadlineDBBatch) Delete(key []byte) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	if b.ddb.cfg.BatchTimeout > 0 {
+		key = bytes.Clone(key)
+	}
+	return b.batch.Delete(key)
+}
+
+// Count implements Batch.
+func (b *deadlineDBBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *deadlineDBBatch) SizeBytes() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *deadlineDBBatch) Write() error {
+	return b.write(OpBatchWrite, Batch.Write)
+}
+
+// WriteSync implements Batch.
+func (b *deadlineDBBatch) WriteSync() error {
+	return b.write(OpBatchWriteSync, Batch.WriteSync)
+}
+
+func (b *deadlineDBBatch) write(op DBOperation, write func(Batch) error) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	batch := b.batch
+	_, err := withDeadline(b.ddb, op, b.ddb.cfg.BatchTimeout, func() (struct{}, error) {
+		return struct{}{}, write(batch)
+	}, func() {
+		batch.Close()
+	})
+	if errors.Is(err, ErrDeadlineExceeded) {
+		// The write still owns the batch, which is closed once it completes.
+		b.batch = nil
+	}
+	return err
+}
+
+// Reset implements Batch.
+func (b *deadlineDBBatch) Reset() error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return b.batch.Reset()
+}
+
+// Close implements Batch.
+func (b *deadlineDBBatch) Close() error {
+	if b.batch == nil {
+		return nil
+	}
+	err := b.batch.Close()
+	b.batch = nil
+	return err
+}
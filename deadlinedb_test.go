@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// hungDB blocks Get, Set and batch writes until unblocked, like a database on a hung disk.
+type hungDB struct {
+	*MemDB
+	unblock chan struct{}
+}
+
+func newHungDB() *hungDB {
+	return &hungDB{MemDB: NewMemDB(), unblock: make(chan struct{})}
+}
+
+func (db *hungDB) Get(key []byte) ([]byte, error) {
+	<-db.unblock
+	return db.MemDB.Get(key)
+}
+
+func (db *hungDB) Set(key, value []byte) error {
+	<-db.unblock
+	return db.MemDB.Set(key, value)
+}
+
+func (db *hungDB) Check(ctx context.Context) (*CheckReport, error) {
+	select {
+	case <-db.unblock:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return Check(ctx, db.MemDB)
+}
+
+func (db *hungDB) NewBatch() Batch {
+	return &hungBatch{Batch: db.MemDB.NewBatch(), db: db}
+}
+
+type hungBatch struct {
+	Batch
+	db *hungDB
+}
+
+func (b *hungBatch) Write() error {
+	<-b.db.unblock
+	return b.Batch.Write()
+}
+
+func TestDeadlineDB(t *testing.T) {
+	hdb := newHungDB()
+	ddb := NewDeadlineDB(hdb, DeadlineDBConfig{
+		ReadTimeout:  10 * time.Millisecond,
+		WriteTimeout: 10 * time.Millisecond,
+		BatchTimeout: 10 * time.Millisecond,
+	})
+
+	_, err := ddb.Get(bz("a"))
+	require.ErrorIs(t, err, ErrDeadlineExceeded)
+	var deadlineErr *DeadlineExceededError
+	require.ErrorAs(t, err, &deadlineErr)
+	require.Equal(t, OpGet, deadlineErr.Op)
+	require.Equal(t, 10*time.Millisecond, deadlineErr.Timeout)
+
+	// The key and value are copied, so the caller can reuse them while the write is pending.
+	key, value := bz("a"), bz("1")
+	require.ErrorIs(t, ddb.Set(key, value), ErrDeadlineExceeded)
+	copy(key, "b")
+	copy(value, "2")
+
+	// A batch whose write exceeds the deadline can no longer be used. Its keys and values were
+	// copied, so the caller can reuse them too.
+	batch := ddb.NewBatch()
+	key, value = bz("c"), bz("3")
+	require.NoError(t, batch.Set(key, value))
+	require.ErrorIs(t, batch.Write(), ErrDeadlineExceeded)
+	copy(key, "d")
+	copy(value, "4")
+	require.ErrorIs(t, batch.Reset(), errBatchClosed)
+	require.ErrorIs(t, batch.Set(bz("d"), bz("4")), errBatchClosed)
+	require.NoError(t, batch.Close())
+
+	_, err = ddb.Check(context.Background())
+	var checkErr *DeadlineExceededError
+	require.ErrorAs(t, err, &checkErr)
+	require.Equal(t, OpCheck, checkErr.Op)
+
+	require.Equal(t, "4", ddb.Stats()["deadline.exceeded"])
+	require.Equal(t, "4", ddb.Stats()["deadline.pending"])
+
+	// Pending operations complete once the disk recovers.
+	close(hdb.unblock)
+	require.Eventually(t, func() bool {
+		return ddb.Stats()["deadline.pending"] == "0"
+	}, time.Second, time.Millisecond)
+	checkValue(t, ddb, bz("a"), bz("1"))
+	checkValue(t, ddb, bz("b"), nil)
+	checkValue(t, ddb, bz("c"), bz("3"))
+	checkValue(t, ddb, bz("d"), nil)
+}
+
+func TestDeadlineDBWithinDeadline(t *testing.T) {
+	ddb := NewDeadlineDB(NewMemDB(), DeadlineDBConfig{
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+		BatchTimeout: time.Second,
+	})
+	require.NoError(t, ddb.Set(bz("a"), bz("1")))
+	checkValue(t, ddb, bz("a"), bz("1"))
+	ok, err := ddb.Has(bz("a"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.ErrorIs(t, ddb.Set(nil, bz("1")), errKeyEmpty)
+
+	batch := ddb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.Write())
+	checkValue(t, ddb, bz("a"), nil)
+	require.Equal(t, "0", ddb.Stats()["deadline.exceeded"])
+}
+
+func TestDeadlineDBNilValue(t *testing.T) {
+	ddb := NewDeadlineDB(NewMemDB(), DeadlineDBConfig{WriteTimeout: time.Second, BatchTimeout: time.Second})
+	require.ErrorIs(t, ddb.Set(bz("a"), nil), errValueNil)
+	require.ErrorIs(t, ddb.SetSync(bz("a"), nil), errValueNil)
+	require.ErrorIs(t, ddb.Set(nil, bz("1")), errKeyEmpty)
+	checkValue(t, ddb, bz("a"), nil)
+
+	// Empty values are still stored.
+	require.NoError(t, ddb.Set(bz("a"), []byte{}))
+	checkValue(t, ddb, bz("a"), []byte{})
+
+	batch := ddb.NewBatch()
+	defer batch.Close()
+	require.ErrorIs(t, batch.Set(bz("b"), nil), errValueNil)
+}
+
+func TestDeadlineDBOptionalInterfaces(t *testing.T) {
+	gdb, err := NewGoLevelDB("deadline", t.TempDir())
+	require.NoError(t, err)
+	ddb := NewDeadlineDB(gdb, DeadlineDBConfig{ReadTimeout: time.Second})
+	defer ddb.Close()
+	fillAndRead(t, ddb, 100)
+
+	// The checks of the backend are run, rather than a plain scan of the keyspace.
+	report, err := Check(context.Background(), ddb)
+	require.NoError(t, err)
+	expected, err := gdb.Check(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, report)
+
+	size, err := ddb.EstimateRangeSize(nil, nil)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	buf, ok, err := GetAppend(ddb, []byte("key000001"), []byte("x"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, buf, 1025)
+	buf, ok, err = GetAppend(ddb, []byte("missing"), buf[:1])
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, []byte("x"), buf)
+}
+
+func TestWithDeadlines(t *testing.T) {
+	db, err := NewDB("deadline", MemDBBackend, "", WithDeadlines(DeadlineDBConfig{ReadTimeout: time.Second}))
+	require.NoError(t, err)
+	defer db.Close()
+	ddb, ok := db.(*DeadlineDB)
+	require.True(t, ok)
+	require.Equal(t, SystemClock, ddb.cfg.Clock)
+}
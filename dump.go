@@ -0,0 +1,295 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A dump starts with a magic header and the uvarint version of the format, followed by chunks of
+// items in key order. A chunk is the uvarint number of its items, the uvarint length of its
+// payload, the payload of uvarint length-prefixed keys and values, and the big-endian CRC-32C of
+// the payload. A chunk of zero items ends the dump, followed by the uvarint total number of items
+// and the SHA-256 checksum of all items, as computed by Migrate. All integers have a fixed byte
+// order, so dumps can be moved across architectures and backends.
+const (
+	dumpMagic     = "CMTDBDMP"
+	dumpVersion   = 1
+	dumpChunkSize = 1 << 20
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrDumpCorrupted is returned when a dump is truncated or does not match its checksums.
+var ErrDumpCorrupted = errors.New("dump corrupted")
+
+// ExportTo writes all items of src to w as a dump, which can be read by ImportFrom, and returns the
+// number of items written.
+func ExportTo(src DBReader, w io.Writer) (uint64, error) {
+	itr, err := src.Iterator(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+
+	dw, err := newDumpWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	for ; itr.Valid(); itr.Next() {
+		// Items are appended to the pending chunk, so they need not be copied.
+		if err := dw.add(UnsafeKey(itr), UnsafeValue(itr)); err != nil {
+			return dw.total, err
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return dw.total, err
+	}
+	return dw.total, dw.close()
+}
+
+// ImportFrom writes the items of a dump read from r, as written by ExportTo, to dst, and returns
+// the number of items written. Every chunk is verified before it is written, and the complete dump
+// once all chunks are written, so an ErrDumpCorrupted about a truncated or reordered dump may be
+// returned after some of its items were written.
+func ImportFrom(dst DB, r io.Reader) (uint64, error) {
+	dr, err := newDumpReader(r)
+	if err != nil {
+		return 0, err
+	}
+	var written uint64
+	err = writeDumpItems(dst, dr.next, func(n uint64) { written = n })
+	return written, err
+}
+
+// writeDumpItems writes the items returned by next to dst, in synced batches of about a chunk,
+// until next returns io.EOF, calling progress with the number of items written after every batch.
+func writeDumpItems(dst DB, next func() ([]byte, []byte, error), progress func(uint64)) error {
+	var (
+		written, batched uint64
+		size             int
+	)
+	batch := dst.NewBatch()
+	defer func() { batch.Close() }()
+	flush := func() error {
+		if err := batch.WriteSync(); err != nil {
+			return err
+		}
+		if err := batch.Close(); err != nil {
+			return err
+		}
+		written += batched
+		progress(written)
+		batch, batched, size = dst.NewBatch(), 0, 0
+		return nil
+	}
+	for {
+		key, value, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := batch.Set(key, value); err != nil {
+			return err
+		}
+		batched++
+		if size += len(key) + len(value); size >= dumpChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if batched == 0 {
+		return nil
+	}
+	return flush()
+}
+
+// dumpWriter writes items to a dump.
+type dumpWriter struct {
+	w       *bufio.Writer
+	sum     hash.Hash
+	total   uint64
+	items   uint64
+	payload []byte
+}
+
+// newDumpWriter creates a dump writer, writing the header of the dump.
+func newDumpWriter(w io.Writer) (*dumpWriter, error) {
+	dw := &dumpWriter{w: bufio.NewWriter(w), sum: sha256.New()}
+	if _, err := dw.w.Write(binary.AppendUvarint([]byte(dumpMagic), dumpVersion)); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+// add adds an item, which must be greater than the previous one.
+func (dw *dumpWriter) add(key, value []byte) error {
+	dw.payload = binary.AppendUvarint(dw.payload, uint64(len(key)))
+	dw.payload = append(dw.payload, key...)
+	dw.payload = binary.AppendUvarint(dw.payload, uint64(len(value)))
+	dw.payload = append(dw.payload, value...)
+	addChecksum(dw.sum, key, value)
+	dw.items++
+	dw.total++
+	if len(dw.payload) >= dumpChunkSize {
+		return dw.writeChunk()
+	}
+	return nil
+}
+
+// writeChunk writes the pending items as a chunk.
+func (dw *dumpWriter) writeChunk() error {
+	chunk := binary.AppendUvarint(nil, dw.items)
+	chunk = binary.AppendUvarint(chunk, uint64(len(dw.payload)))
+	chunk = append(chunk, dw.payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.Checksum(dw.payload, crc32c))
+	if _, err := dw.w.Write(chunk); err != nil {
+		return err
+	}
+	dw.items, dw.payload = 0, dw.payload[:0]
+	return nil
+}
+
+// close writes the pending items and the trailer, and flushes the dump. It does not close the
+// underlying writer.
+func (dw *dumpWriter) close() error {
+	if dw.items > 0 {
+		if err := dw.writeChunk(); err != nil {
+			return err
+		}
+	}
+	trailer := binary.AppendUvarint(nil, 0)
+	trailer = binary.AppendUvarint(trailer, dw.total)
+	trailer = append(trailer, dw.sum.Sum(nil)...)
+	if _, err := dw.w.Write(trailer); err != nil {
+		return err
+	}
+	return dw.w.Flush()
+}
+
+// dumpReader reads the items of a dump. Chunks are verified before their items are returned, and
+// the trailer once all items are read.
+type dumpReader struct {
+	r       *bufio.Reader
+	sum     hash.Hash
+	total   uint64
+	items   uint64 // items remaining in the current chunk
+	payload []byte
+	done    bool
+}
+
+// newDumpReader creates a dump reader, reading the header of the dump.
+func newDumpReader(r io.Reader) (*dumpReader, error) {
+	dr := &dumpReader{r: bufio.NewReader(r), sum: sha256.New()}
+	magic := make([]byte, len(dumpMagic))
+	if _, err := io.ReadFull(dr.r, magic); err != nil || string(magic) != dumpMagic {
+		return nil, fmt.Errorf("%w: not a dump", ErrDumpCorrupted)
+	}
+	version, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		return nil, dumpReadError(err)
+	}
+	if version != dumpVersion {
+		return nil, fmt.Errorf("unsupported dump version %d", version)
+	}
+	return dr, nil
+}
+
+// next returns the next item, or io.EOF once all items were read and the dump is verified. The
+// returned slices are valid until the next chunk is read.
+func (dr *dumpReader) next() ([]byte, []byte, error) {
+	if dr.done {
+		return nil, nil, io.EOF
+	}
+	for dr.items == 0 {
+		if len(dr.payload) != 0 {
+			return nil, nil, fmt.Errorf("%w: invalid chunk", ErrDumpCorrupted)
+		}
+		more, err := dr.readChunk()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !more {
+			dr.done = true
+			return nil, nil, io.EOF
+		}
+	}
+	var fields [2][]byte
+	for i := range fields {
+		length, read := binary.Uvarint(dr.payload)
+		if read <= 0 || uint64(len(dr.payload)-read) < length {
+			return nil, nil, fmt.Errorf("%w: invalid chunk", ErrDumpCorrupted)
+		}
+		fields[i], dr.payload = dr.payload[read:read+int(length)], dr.payload[read+int(length):]
+	}
+	dr.items--
+	dr.total++
+	addChecksum(dr.sum, fields[0], fields[1])
+	return fields[0], fields[1], nil
+}
+
+// readChunk reads and verifies the next chunk, or verifies the trailer and returns false once all
+// chunks are read.
+func (dr *dumpReader) readChunk() (bool, error) {
+	items, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		return false, dumpReadError(err)
+	}
+	if items == 0 {
+		return false, dr.readTrailer()
+	}
+	size, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		return false, dumpReadError(err)
+	}
+	if size > math.MaxInt32 {
+		return false, fmt.Errorf("%w: chunk of %d bytes", ErrDumpCorrupted, size)
+	}
+	// The payload is read as it arrives rather than allocated upfront, so that a corrupted size
+	// fails with a truncated dump rather than a huge allocation.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, dr.r, int64(size)+4); err != nil {
+		return false, dumpReadError(err)
+	}
+	payload, crc := buf.Bytes()[:size], binary.BigEndian.Uint32(buf.Bytes()[size:])
+	if crc32.Checksum(payload, crc32c) != crc {
+		return false, fmt.Errorf("%w: chunk checksum mismatch after %d items", ErrDumpCorrupted, dr.total)
+	}
+	dr.items, dr.payload = items, payload
+	return true, nil
+}
+
+// readTrailer reads the trailer, and verifies the number and checksum of the items read.
+func (dr *dumpReader) readTrailer() error {
+	count, err := binary.ReadUvarint(dr.r)
+	if err != nil {
+		return dumpReadError(err)
+	}
+	checksum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(dr.r, checksum); err != nil {
+		return dumpReadError(err)
+	}
+	if count != dr.total || !bytes.Equal(checksum, dr.sum.Sum(nil)) {
+		return fmt.Errorf("%w: dump checksum mismatch", ErrDumpCorrupted)
+	}
+	return nil
+}
+
+// dumpReadError returns the error of a failed read of a dump, where an unexpected end means it was
+// truncated.
+func dumpReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrDumpCorrupted)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	src := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, src.Set(int642Bytes(int64(i)), bytes.Repeat([]byte{byte(i)}, 3000)))
+	}
+	require.NoError(t, src.Set(bz("empty"), []byte{}))
+
+	var buf bytes.Buffer
+	exported, err := ExportTo(src, &buf)
+	require.NoError(t, err)
+	require.EqualValues(t, 1001, exported)
+
+	dst, err := NewGoLevelDB("dst", t.TempDir())
+	require.NoError(t, err)
+	defer dst.Close()
+	imported, err := ImportFrom(dst, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.EqualValues(t, 1001, imported)
+	expected, err := checksumItems(src)
+	require.NoError(t, err)
+	actual, err := checksumItems(dst)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+	checkValue(t, dst, bz("empty"), []byte{})
+
+	// An empty database exports an empty dump.
+	var empty bytes.Buffer
+	exported, err = ExportTo(NewMemDB(), &empty)
+	require.NoError(t, err)
+	require.Zero(t, exported)
+	imported, err = ImportFrom(NewMemDB(), &empty)
+	require.NoError(t, err)
+	require.Zero(t, imported)
+}
+
+func TestDumpCorrupted(t *testing.T) {
+	src := NewMemDB()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, src.Set(int642Bytes(int64(i)), int642Bytes(int64(i))))
+	}
+	var buf bytes.Buffer
+	_, err := ExportTo(src, &buf)
+	require.NoError(t, err)
+	dump := buf.Bytes()
+
+	flipped := bytes.Clone(dump)
+	flipped[len(dumpMagic)+10] ^= 0xff
+	testcases := map[string][]byte{
+		"not a dump":       []byte("not a dump at all"),
+		"truncated":        dump[:len(dump)-10],
+		"truncated chunk":  dump[:len(dumpMagic)+20],
+		"flipped byte":     flipped,
+		"trailer mismatch": append(bytes.Clone(dump[:len(dump)-1]), dump[len(dump)-1]^0xff),
+	}
+	for name, dump := range testcases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ImportFrom(NewMemDB(), bytes.NewReader(dump))
+			require.ErrorIs(t, err, ErrDumpCorrupted)
+		})
+	}
+
+	// Unknown versions are rejected.
+	future := append([]byte(dumpMagic), 2)
+	_, err = ImportFrom(NewMemDB(), bytes.NewReader(future))
+	require.ErrorContains(t, err, "unsupported dump version 2")
+}
@@ -0,0 +1,344 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// encryptedValueVersion is the first byte of values encrypted by EncryptedDB, followed by the
+// nonce and the AES-GCM ciphertext.
+const encryptedValueVersion = 1
+
+var (
+	// ErrDecryption is returned when a value cannot be decrypted, e.g. because it was encrypted
+	// with another key or was tampered with.
+	ErrDecryption = errors.New("value decryption failed")
+
+	// errHashedKeysIteration is returned when iterating over an EncryptedDB with hashed keys.
+	errHashedKeysIteration = errors.New("iteration is not supported with hashed keys")
+)
+
+// EncryptedDB wraps a database and encrypts all values at rest with AES-256-GCM, so that the
+// underlying backend, its files and backups only ever see ciphertexts. Every value is bound to its
+// key, so ciphertexts cannot be moved to other keys without failing decryption with ErrDecryption.
+//
+// Keys are stored in plaintext by default, so iteration keeps working in key order. Databases
+// created with NewEncryptedDBWithHashedKeys instead store the HMAC-SHA256 of the keys, hiding them
+// too, but then cannot be iterated over.
+type EncryptedDB struct {
+	db        DB
+	aead      cipher.AEAD
+	keyHashes []byte // HMAC key of stored keys, nil to store plaintext keys
+}
+
+var _ DB = (*EncryptedDB)(nil)
+
+// NewEncryptedDB wraps db, encrypting values with the given 32-byte secret.
+func NewEncryptedDB(db DB, secret []byte) (*EncryptedDB, error) {
+	return newEncryptedDB(db, secret, false)
+}
+
+// NewEncryptedDBWithHashedKeys wraps db, encrypting values and hashing keys with the given 32-byte
+// secret. Iterators are not supported.
+func NewEncryptedDBWithHashedKeys(db DB, secret []byte) (*EncryptedDB, error) {
+	return newEncryptedDB(db, secret, true)
+}
+
+func newEncryptedDB(db DB, secret []byte, hashKeys bool) (*EncryptedDB, error) {
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("encryption secret must be 32 bytes, got %d", len(secret))
+	}
+	// Separate keys are derived for encryption and key hashing.
+	block, err := aes.NewCipher(deriveKey(secret, "cometbft-db encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	edb := &EncryptedDB{
+		db:   db,
+		aead: aead,
+	}
+	if hashKeys {
+		edb.keyHashes = deriveKey(secret, "cometbft-db key hashing")
+	}
+	return edb, nil
+}
+
+// deriveKey derives a 32-byte key for the given purpose from the secret.
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// storedKey returns the key under which the given key is stored.
+func (edb *EncryptedDB) storedKey(key []byte) []byte {
+	if edb.keyHashes == nil || len(key) == 0 {
+		return key
+	}
+	mac := hmac.New(sha256.New, edb.keyHashes)
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// encrypt encrypts the value of the key.
+func (edb *EncryptedDB) encrypt(key, value []byte) ([]byte, error) {
+	nonceSize := edb.aead.NonceSize()
+	out := make([]byte, 1+nonceSize, 1+nonceSize+len(value)+edb.aead.Overhead())
+	out[0] = encryptedValueVersion
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return edb.aead.Seal(out, out[1:], value, key), nil
+}
+
+// decrypt decrypts the stored value of the key.
+func (edb *EncryptedDB) decrypt(key, stored []byte) ([]byte, error) {
+	nonceSize := edb.aead.NonceSize()
+	if len(stored) < 1+nonceSize || stored[0] != encryptedValueVersion {
+		return nil, fmt.Errorf("%w: invalid value of key %X", ErrDecryption, key)
+	}
+	value, err := edb.aead.Open(nil, stored[1:1+nonceSize], stored[1+nonceSize:], key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value of key %X", ErrDecryption, key)
+	}
+	// Empty values must remain non-nil, since nil means missing.
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+// Get implements DB.
+func (edb *EncryptedDB) Get(key []byte) ([]byte, error) {
+	stored, err := edb.db.Get(edb.storedKey(key))
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return edb.decrypt(key, stored)
+}
+
+// Has implements DB.
+func (edb *EncryptedDB) Has(key []byte) (bool, error) {
+	return edb.db.Has(edb.storedKey(key))
+}
+
+// Set implements DB.
+func (edb *EncryptedDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	stored, err := edb.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return edb.db.Set(edb.storedKey(key), stored)
+}
+
+// SetSync implements DB.
+func (edb *EncryptedDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	stored, err := edb.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return edb.db.SetSync(edb.storedKey(key), stored)
+}
+
+// Delete implements DB.
+func (edb *EncryptedDB) Delete(key []byte) error {
+	return edb.db.Delete(edb.storedKey(key))
+}
+
+// DeleteSync implements DB.
+func (edb *EncryptedDB) DeleteSync(key []byte) error {
+	return edb.db.DeleteSync(edb.storedKey(key))
+}
+
+// Iterator implements DB.
+func (edb *EncryptedDB) Iterator(start, end []byte) (Iterator, error) {
+	if edb.keyHashes != nil {
+		return nil, errHashedKeysIteration
+	}
+	itr, err := edb.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedDBIterator{edb: edb, source: itr}, nil
+}
+
+// ReverseIterator implements DB.
+func (edb *EncryptedDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	if edb.keyHashes != nil {
+		return nil, errHashedKeysIteration
+	}
+	itr, err := edb.db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedDBIterator{edb: edb, source: itr}, nil
+}
+
+// Close implements DB.
+func (edb *EncryptedDB) Close() error {
+	return edb.db.Close()
+}
+
+// NewBatch implements DB.
+func (edb *EncryptedDB) NewBatch() Batch {
+	return &encryptedDBBatch{
+		edb:   edb,
+		batch: edb.db.NewBatch(),
+	}
+}
+
+// Print implements DB. It prints the stored, encrypted values.
+func (edb *EncryptedDB) Print() error {
+	return edb.db.Print()
+}
+
+// Stats implements DB.
+func (edb *EncryptedDB) Stats() map[string]string {
+	return edb.db.Stats()
+}
+
+// Compact implements DB.
+func (edb *EncryptedDB) Compact(start, end []byte) error {
+	return edb.db.Compact(start, end)
+}
+
+// encryptedDBIterator decrypts the values of an iterator over plaintext keys. A value which fails
+// to decrypt invalidates the iterator, and is reported by Error.
+type encryptedDBIterator struct {
+	edb    *EncryptedDB
+	source Iterator
+	err    error
+}
+
+var _ Iterator = (*encryptedDBIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *encryptedDBIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *encryptedDBIterator) Valid() bool {
+	return itr.err == nil && itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *encryptedDBIterator) Next() {
+	itr.assertIsValid()
+	itr.source.Next()
+}
+
+// Key implements Iterator.
+func (itr *encryptedDBIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.source.Key()
+}
+
+// Value implements Iterator.
+func (itr *encryptedDBIterator) Value() []byte {
+	itr.assertIsValid()
+	value, err := itr.edb.decrypt(itr.source.Key(), itr.source.Value())
+	if err != nil {
+		itr.err = err
+		return nil
+	}
+	return value
+}
+
+// Error implements Iterator.
+func (itr *encryptedDBIterator) Error() error {
+	if err := itr.source.Error(); err != nil {
+		return err
+	}
+	return itr.err
+}
+
+// Close implements Iterator.
+func (itr *encryptedDBIterator) Close() error {
+	return itr.source.Close()
+}
+
+func (itr *encryptedDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
+
+// encryptedDBBatch encrypts the values of a batch of the underlying database.
+type encryptedDBBatch struct {
+	edb   *EncryptedDB
+	batch Batch
+}
+
+var _ Batch = (*encryptedDBBatch)(nil)
+
+// Set implements Batch.
+func (b *encryptedDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	stored, err := b.edb.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return b.batch.Set(b.edb.storedKey(key), stored)
+}
+
+// Delete implements Batch.
+func (b *encryptedDBBatch) Delete(key []byte) error {
+	return b.batch.Delete(b.edb.storedKey(key))
+}
+
+// Count implements Batch.
+func (b *encryptedDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *encryptedDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *encryptedDBBatch) Write() error {
+	return b.batch.Write()
+}
+
+// WriteSync implements Batch.
+func (b *encryptedDBBatch) WriteSync() error {
+	return b.batch.WriteSync()
+}
+
+// Reset implements Batch.
+func (b *encryptedDBBatch) Reset() error {
+	return b.batch.Reset()
+}
+
+// Close implements Batch.
+func (b *encryptedDBBatch) Close() error {
+	return b.batch.Close()
+}
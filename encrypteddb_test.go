@@ -0,0 +1,83 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedDB(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, 32)
+	mem := NewMemDB()
+	edb, err := NewEncryptedDB(mem, secret)
+	require.NoError(t, err)
+	defer edb.Close()
+
+	require.NoError(t, edb.Set(bz("a"), bz("secret value")))
+	require.NoError(t, edb.Set(bz("b"), []byte{}))
+	batch := edb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("c"), bz("3")))
+	require.NoError(t, batch.Delete(bz("b")))
+	require.NoError(t, batch.Write())
+
+	checkValue(t, edb, bz("a"), bz("secret value"))
+	checkValue(t, edb, bz("b"), nil)
+	stored, err := mem.Get(bz("a"))
+	require.NoError(t, err)
+	require.NotContains(t, string(stored), "secret value")
+
+	require.NoError(t, edb.Set(bz("b"), []byte{}))
+	checkValue(t, edb, bz("b"), []byte{})
+
+	itr, err := edb.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	var got []string
+	for ; itr.Valid(); itr.Next() {
+		got = append(got, string(itr.Key())+"="+string(itr.Value()))
+	}
+	require.NoError(t, itr.Error())
+	require.NoError(t, itr.Close())
+	require.Equal(t, []string{"c=3", "b=", "a=secret value"}, got)
+
+	// Values are bound to their keys, and to the secret.
+	require.NoError(t, mem.Set(bz("d"), stored))
+	_, err = edb.Get(bz("d"))
+	require.ErrorIs(t, err, ErrDecryption)
+	itr, err = edb.Iterator(bz("d"), nil)
+	require.NoError(t, err)
+	require.Nil(t, itr.Value())
+	require.False(t, itr.Valid())
+	require.ErrorIs(t, itr.Error(), ErrDecryption)
+	require.NoError(t, itr.Close())
+
+	other, err := NewEncryptedDB(mem, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = other.Get(bz("a"))
+	require.ErrorIs(t, err, ErrDecryption)
+
+	_, err = NewEncryptedDB(mem, []byte("short"))
+	require.Error(t, err)
+}
+
+func TestEncryptedDBHashedKeys(t *testing.T) {
+	mem := NewMemDB()
+	edb, err := NewEncryptedDBWithHashedKeys(mem, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	defer edb.Close()
+
+	require.NoError(t, edb.Set(bz("key"), bz("value")))
+	checkValue(t, edb, bz("key"), bz("value"))
+	ok, err := edb.Has(bz("key"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	checkValue(t, mem, bz("key"), nil)
+
+	_, err = edb.Iterator(nil, nil)
+	require.Error(t, err)
+
+	require.NoError(t, edb.Delete(bz("key")))
+	checkValue(t, edb, bz("key"), nil)
+	require.Equal(t, errKeyEmpty, edb.Set(nil, bz("value")))
+}
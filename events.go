@@ -0,0 +1,416 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/prometheus/client_golang/prometheus"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// EventType identifies a storage lifecycle event.
+type EventType string
+
+// These are the events published to an EventBus.
+const (
+	// EventOpen is published after a database has been opened.
+	EventOpen EventType = "open"
+	// EventClose is published after a database has been closed.
+	EventClose EventType = "close"
+	// EventCompaction is published after an explicit compaction has finished.
+	EventCompaction EventType = "compaction"
+	// EventWriteStall is published when the backend stalls writes, e.g. because compactions
+	// cannot keep up. Pebble reports stalls as they begin, while goleveldb databases are polled
+	// every second for the writes it delayed or paused.
+	EventWriteStall EventType = "write_stall"
+	// EventCorruption is published whenever an operation fails because of data corruption.
+	EventCorruption EventType = "corruption"
+	// EventBackupComplete is published after Backup has completed a backup of a database.
+	EventBackupComplete EventType = "backup_complete"
+)
+
+// Event describes a storage lifecycle event.
+type Event struct {
+	Type    EventType
+	Backend BackendType
+	Name    string
+	Dir     string
+	Time    time.Time
+	// Duration is set for events describing an operation, such as EventCompaction.
+	Duration time.Duration
+	// Details is a human-readable description of the event, if any.
+	Details string
+	// Err is the error that caused the event, or the error returned by the operation.
+	Err error
+}
+
+// EventSink receives events published to an EventBus. HandleEvent is called synchronously from
+// the goroutine publishing the event, so implementations must not block.
+type EventSink interface {
+	HandleEvent(ev Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(ev Event)
+
+// HandleEvent implements EventSink.
+func (f EventSinkFunc) HandleEvent(ev Event) {
+	f(ev)
+}
+
+// EventBus dispatches storage events to the subscribed sinks. A single bus may be shared by all
+// databases of a node, so that operators get alerted uniformly across backends.
+type EventBus struct {
+	mtx   sync.RWMutex
+	sinks []EventSink
+}
+
+// NewEventBus creates an event bus dispatching to the given sinks.
+func NewEventBus(sinks ...EventSink) *EventBus {
+	return &EventBus{
+		sinks: sinks,
+	}
+}
+
+// Subscribe adds a sink to the bus.
+func (b *EventBus) Subscribe(sink EventSink) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.sinks = append(b.sinks, sink)
+}
+
+// Publish sends an event to all subscribed sinks, in the order they were subscribed. The event
+// time is set to the current time if it is zero.
+func (b *EventBus) Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for _, sink := range b.sinks {
+		sink.HandleEvent(ev)
+	}
+}
+
+// WithEventBus publishes the lifecycle events of the database opened by NewDB to bus. The returned
+// database is wrapped in order to observe them, so it can no longer be type asserted to the backend
+// type.
+func WithEventBus(bus *EventBus) Option {
+	return func(o *dbOptions) {
+		o.events.bus = bus
+	}
+}
+
+// eventSource publishes events for a single database. The zero value publishes nothing.
+type eventSource struct {
+	bus     *EventBus
+	clock   Clock
+	backend BackendType
+	name    string
+	dir     string
+}
+
+// now returns the current time of the source's clock, or the system time if it has none.
+func (s eventSource) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s eventSource) publish(typ EventType, err error, details string, duration time.Duration) {
+	if s.bus == nil {
+		return
+	}
+	s.bus.Publish(Event{
+		Type:     typ,
+		Backend:  s.backend,
+		Name:     s.name,
+		Dir:      s.dir,
+		Time:     s.now(),
+		Duration: duration,
+		Details:  details,
+		Err:      err,
+	})
+}
+
+// checkCorruption publishes EventCorruption if err was caused by data corruption, and returns err.
+func (s eventSource) checkCorruption(err error) error {
+	if err != nil && isCorruption(err) {
+		s.publish(EventCorruption, err, "", 0)
+	}
+	return err
+}
+
+// eventPublisher is implemented by the wrappers NewDB adds to publish events, so that operations
+// taking a database, such as Backup, can publish events for it.
+type eventPublisher interface {
+	events() eventSource
+}
+
+// eventsOf returns the event source of db, which publishes nothing unless db was opened by NewDB
+// with WithEventBus.
+func eventsOf(db DBReader) eventSource {
+	if p, ok := db.(eventPublisher); ok {
+		return p.events()
+	}
+	return eventSource{}
+}
+
+// isCorruption returns whether err reports corrupted data in one of the supported backends.
+func isCorruption(err error) bool {
+	return lerrors.IsCorrupted(err) || errors.Is(err, pebble.ErrCorruption)
+}
+
+// eventDB wraps a database opened by NewDB to publish its lifecycle events.
+type eventDB struct {
+	db     DB
+	source eventSource
+}
+
+var _ DB = (*eventDB)(nil)
+
+// events implements eventPublisher.
+func (edb *eventDB) events() eventSource {
+	return edb.source
+}
+
+// Get implements DB.
+func (edb *eventDB) Get(key []byte) ([]byte, error) {
+	value, err := edb.db.Get(key)
+	return value, edb.source.checkCorruption(err)
+}
+
+var _ GetAppender = (*eventDB)(nil)
+
+// GetAppend implements GetAppender. The value is read into dst without an intermediate copy if
+// the underlying database is a GetAppender.
+func (edb *eventDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	dst, ok, err := GetAppend(edb.db, key, dst)
+	return dst, ok, edb.source.checkCorruption(err)
+}
+
+// Has implements DB.
+func (edb *eventDB) Has(key []byte) (bool, error) {
+	ok, err := edb.db.Has(key)
+	return ok, edb.source.checkCorruption(err)
+}
+
+// Set implements DB.
+func (edb *eventDB) Set(key []byte, value []byte) error {
+	return edb.source.checkCorruption(edb.db.Set(key, value))
+}
+
+// SetSync implements DB.
+func (edb *eventDB) SetSync(key []byte, value []byte) error {
+	return edb.source.checkCorruption(edb.db.SetSync(key, value))
+}
+
+// Delete implements DB.
+func (edb *eventDB) Delete(key []byte) error {
+	return edb.source.checkCorruption(edb.db.Delete(key))
+}
+
+// DeleteSync implements DB.
+func (edb *eventDB) DeleteSync(key []byte) error {
+	return edb.source.checkCorruption(edb.db.DeleteSync(key))
+}
+
+// Iterator implements DB.
+func (edb *eventDB) Iterator(start, end []byte) (Iterator, error) {
+	itr, err := edb.db.Iterator(start, end)
+	return itr, edb.source.checkCorruption(err)
+}
+
+// ReverseIterator implements DB.
+func (edb *eventDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	itr, err := edb.db.ReverseIterator(start, end)
+	return itr, edb.source.checkCorruption(err)
+}
+
+// Close implements DB.
+func (edb *eventDB) Close() error {
+	err := edb.db.Close()
+	edb.source.publish(EventClose, err, "", 0)
+	return err
+}
+
+// NewBatch implements DB. The batch is an AsyncBatch if the batches of the database are.
+func (edb *eventDB) NewBatch() Batch {
+	batch := &eventDBBatch{
+		source: edb.db.NewBatch(),
+		events: edb.source,
+	}
+	if _, ok := batch.source.(AsyncBatch); ok {
+		return &eventDBAsyncBatch{batch}
+	}
+	return batch
+}
+
+// Print implements DB.
+func (edb *eventDB) Print() error {
+	return edb.db.Print()
+}
+
+// Stats implements DB.
+func (edb *eventDB) Stats() map[string]string {
+	return edb.db.Stats()
+}
+
+// Compact implements DB.
+func (edb *eventDB) Compact(start, end []byte) error {
+	began := edb.source.now()
+	err := edb.db.Compact(start, end)
+	edb.source.publish(EventCompaction, err, "", edb.source.now().Sub(began))
+	return edb.source.checkCorruption(err)
+}
+
+var _ Checker = (*eventDB)(nil)
+
+// Check implements Checker, running the checks of the underlying database.
+func (edb *eventDB) Check(ctx context.Context) (*CheckReport, error) {
+	return Check(ctx, edb.db)
+}
+
+var _ RangeSizeEstimator = (*eventDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator, if the underlying database does. Otherwise, it
+// returns 0.
+func (edb *eventDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	estimator, ok := edb.db.(RangeSizeEstimator)
+	if !ok {
+		return 0, nil
+	}
+	size, err := estimator.EstimateRangeSize(start, end)
+	return size, edb.source.checkCorruption(err)
+}
+
+// eventDBBatch reports corruption errors when writing a batch.
+type eventDBBatch struct {
+	source Batch
+	events eventSource
+}
+
+var _ Batch = (*eventDBBatch)(nil)
+
+// Set implements Batch.
+func (b *eventDBBatch) Set(key, value []byte) error {
+	return b.source.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *eventDBBatch) Delete(key []byte) error {
+	return b.source.Delete(key)
+}
+
+// Count implements Batch.
+func (b *eventDBBatch) Count() int {
+	return b.source.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *eventDBBatch) SizeBytes() int {
+	return b.source.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *eventDBBatch) Write() error {
+	return b.events.checkCorruption(b.source.Write())
+}
+
+// WriteSync implements Batch.
+func (b *eventDBBatch) WriteSync() error {
+	return b.events.checkCorruption(b.source.WriteSync())
+}
+
+// Reset implements Batch.
+func (b *eventDBBatch) Reset() error {
+	return b.source.Reset()
+}
+
+// Close implements Batch.
+func (b *eventDBBatch) Close() error {
+	return b.source.Close()
+}
+
+// eventDBAsyncBatch is an eventDBBatch of a database whose batches are AsyncBatches.
+type eventDBAsyncBatch struct {
+	*eventDBBatch
+}
+
+var _ AsyncBatch = (*eventDBAsyncBatch)(nil)
+
+// WriteAsync implements AsyncBatch.
+func (b *eventDBAsyncBatch) WriteAsync() <-chan error {
+	return forwardAsyncResult(b.source.(AsyncBatch).WriteAsync(), b.events.checkCorruption)
+}
+
+// forwardAsyncResult returns a channel receiving the result received from result, passed through
+// check, so that wrappers can observe the result of an AsyncBatch write.
+func forwardAsyncResult(result <-chan error, check func(error) error) <-chan error {
+	forwarded := make(chan error, 1)
+	go func() {
+		forwarded <- check(<-result)
+	}()
+	return forwarded
+}
+
+// NewLogEventSink returns a sink logging every event, at error level for corruption and write
+// stalls and at info level otherwise.
+func NewLogEventSink(logger Logger) EventSink {
+	return EventSinkFunc(func(ev Event) {
+		keyvals := []any{"type", ev.Type, "backend", ev.Backend, "name", ev.Name, "dir", ev.Dir}
+		if ev.Duration != 0 {
+			keyvals = append(keyvals, "duration", ev.Duration)
+		}
+		if ev.Details != "" {
+			keyvals = append(keyvals, "details", ev.Details)
+		}
+		if ev.Err != nil {
+			keyvals = append(keyvals, "err", ev.Err)
+		}
+		switch ev.Type {
+		case EventCorruption, EventWriteStall:
+			logger.Error("storage event", keyvals...)
+		default:
+			if ev.Err != nil {
+				logger.Error("storage event", keyvals...)
+				return
+			}
+			logger.Info("storage event", keyvals...)
+		}
+	})
+}
+
+// PrometheusEventSink counts events in a Prometheus counter labeled by backend, database name and
+// event type.
+type PrometheusEventSink struct {
+	events *prometheus.CounterVec
+}
+
+var _ EventSink = (*PrometheusEventSink)(nil)
+
+// NewPrometheusEventSink creates a sink counting events in the storage_events_total counter of the
+// given namespace, and registers the counter with reg.
+func NewPrometheusEventSink(namespace string, reg prometheus.Registerer) (*PrometheusEventSink, error) {
+	events := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "events_total",
+		Help:      "Number of storage lifecycle events, by backend, database and event type.",
+	}, []string{"backend", "name", "type"})
+	if err := reg.Register(events); err != nil {
+		return nil, err
+	}
+	return &PrometheusEventSink{events: events}, nil
+}
+
+// HandleEvent implements EventSink.
+func (s *PrometheusEventSink) HandleEvent(ev Event) {
+	s.events.WithLabelValues(string(ev.Backend), ev.Name, string(ev.Type)).Inc()
+}
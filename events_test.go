@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// eventRecorder is an EventSink which records all events.
+type eventRecorder struct {
+	mtx    sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) HandleEvent(ev Event) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	types := make([]EventType, 0, len(r.events))
+	for _, ev := range r.events {
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+// testLogger is a Logger recording the messages and their level.
+type testLogger struct {
+	mtx   sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Info(msg string, keyvals ...any) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(append([]any{"I", msg}, keyvals...)...))
+}
+
+func (l *testLogger) Error(msg string, keyvals ...any) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(append([]any{"E", msg}, keyvals...)...))
+}
+
+func TestEventBusLifecycle(t *testing.T) {
+	for _, backend := range []BackendType{GoLevelDBBackend, PebbleDBBackend, MemDBBackend} {
+		t.Run(string(backend), func(t *testing.T) {
+			recorder := &eventRecorder{}
+			bus := NewEventBus(recorder)
+
+			name := fmt.Sprintf("test_%x", randStr(12))
+			dir := os.TempDir()
+			db, err := NewDB(name, backend, dir, WithEventBus(bus))
+			require.NoError(t, err)
+			defer cleanupDBDir(dir, name)
+
+			require.NoError(t, db.Set([]byte("a"), []byte{1}))
+			require.NoError(t, db.Set([]byte("b"), []byte{2}))
+			require.NoError(t, db.Compact(nil, nil))
+			require.NoError(t, db.Close())
+
+			require.Equal(t, []EventType{EventOpen, EventCompaction, EventClose}, recorder.types())
+			for _, ev := range recorder.events {
+				require.Equal(t, backend, ev.Backend)
+				require.Equal(t, name, ev.Name)
+				require.Equal(t, dir, ev.Dir)
+				require.False(t, ev.Time.IsZero())
+			}
+		})
+	}
+}
+
+func TestEventBusClock(t *testing.T) {
+	recorder := &eventRecorder{}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := clocktest.NewManualClock(start)
+
+	db, err := NewDB("test", MemDBBackend, "", WithEventBus(NewEventBus(recorder)), WithClock(clock))
+	require.NoError(t, err)
+	clock.Advance(time.Minute)
+	require.NoError(t, db.Compact(nil, nil))
+	clock.Advance(time.Minute)
+	require.NoError(t, db.Close())
+
+	require.Len(t, recorder.events, 3)
+	for i, ev := range recorder.events {
+		require.Equal(t, start.Add(time.Duration(i)*time.Minute), ev.Time)
+		require.Zero(t, ev.Duration)
+	}
+}
+
+func TestEventSourceCorruption(t *testing.T) {
+	recorder := &eventRecorder{}
+	source := eventSource{bus: NewEventBus(recorder), backend: GoLevelDBBackend, name: "test"}
+
+	err := lerrors.NewErrCorrupted(storage.FileDesc{}, fmt.Errorf("bad block"))
+	require.Equal(t, err, source.checkCorruption(err))
+	require.NoError(t, source.checkCorruption(nil))
+	require.Error(t, source.checkCorruption(fmt.Errorf("not corrupted")))
+	require.Equal(t, []EventType{EventCorruption}, recorder.types())
+}
+
+func TestLogEventSink(t *testing.T) {
+	logger := &testLogger{}
+	bus := NewEventBus()
+	bus.Subscribe(NewLogEventSink(logger))
+
+	bus.Publish(Event{Type: EventOpen, Backend: MemDBBackend, Name: "test"})
+	bus.Publish(Event{Type: EventCorruption, Backend: MemDBBackend, Name: "test", Err: fmt.Errorf("boom")})
+
+	require.Len(t, logger.lines, 2)
+	require.Contains(t, logger.lines[0], "I")
+	require.Contains(t, logger.lines[0], "open")
+	require.Contains(t, logger.lines[1], "E")
+	require.Contains(t, logger.lines[1], "boom")
+}
+
+func TestPrometheusEventSink(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewPrometheusEventSink("test", reg)
+	require.NoError(t, err)
+	bus := NewEventBus(sink)
+
+	bus.Publish(Event{Type: EventOpen, Backend: MemDBBackend, Name: "state"})
+	bus.Publish(Event{Type: EventOpen, Backend: MemDBBackend, Name: "state"})
+	bus.Publish(Event{Type: EventClose, Backend: MemDBBackend, Name: "state"})
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Equal(t, "test_storage_events_total", families[0].GetName())
+	counts := map[string]float64{}
+	for _, m := range families[0].GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "type" {
+				counts[label.GetValue()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{"open": 2, "close": 1}, counts)
+
+	// Registering a second sink with the same namespace fails.
+	_, err = NewPrometheusEventSink("test", reg)
+	require.Error(t, err)
+}
+
+func TestEventBusBackupComplete(t *testing.T) {
+	recorder := &eventRecorder{}
+	db, err := NewDB("test", MemDBBackend, "", WithEventBus(NewEventBus(recorder)))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Set(bz("a"), bz("1")))
+
+	dir := t.TempDir()
+	_, err = Backup(db, dir, false)
+	require.NoError(t, err)
+	require.Equal(t, []EventType{EventOpen, EventBackupComplete}, recorder.types())
+	require.Equal(t, fmt.Sprintf("backup 1 to %s: 1 sets, 0 deletes", dir), recorder.events[1].Details)
+
+	// Databases without an event bus publish nothing.
+	_, err = Backup(NewMemDB(), t.TempDir(), false)
+	require.NoError(t, err)
+	require.Len(t, recorder.events, 2)
+}
+
+func TestGoLevelDBStallMonitor(t *testing.T) {
+	recorder := &eventRecorder{}
+	clock := clocktest.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var (
+		mtx   sync.Mutex
+		stats leveldb.DBStats
+	)
+	monitor := newGoLevelDBStallMonitor(clock, eventSource{bus: NewEventBus(recorder), clock: clock},
+		func(s *leveldb.DBStats) error {
+			mtx.Lock()
+			defer mtx.Unlock()
+			*s = stats
+			return nil
+		})
+	defer monitor.close()
+	poll := func(update func(s *leveldb.DBStats)) {
+		require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+		mtx.Lock()
+		update(&stats)
+		mtx.Unlock()
+		clock.Advance(goLevelDBStallPollInterval)
+	}
+
+	poll(func(s *leveldb.DBStats) {
+		s.WriteDelayCount, s.WriteDelayDuration = 3, time.Second
+	})
+	poll(func(s *leveldb.DBStats) {})
+	poll(func(s *leveldb.DBStats) { s.WritePaused = true })
+	poll(func(s *leveldb.DBStats) {})
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+
+	require.Equal(t, []EventType{EventWriteStall, EventWriteStall}, recorder.types())
+	require.Equal(t, "3 writes delayed", recorder.events[0].Details)
+	require.Equal(t, time.Second, recorder.events[0].Duration)
+	require.Equal(t, "writes paused", recorder.events[1].Details)
+
+	// Without an event bus, there is nothing to monitor.
+	require.Nil(t, newGoLevelDBStallMonitor(clock, eventSource{}, nil))
+}
+
+func TestEventDBOptionalInterfaces(t *testing.T) {
+	db, err := NewDB("events", GoLevelDBBackend, t.TempDir(), WithEventBus(NewEventBus()))
+	require.NoError(t, err)
+	defer db.Close()
+	fillAndRead(t, db, 100)
+
+	// The checks of the backend are run, rather than a plain scan of the keyspace.
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Len(t, report.Checks, 2)
+	require.Equal(t, "table-checksums", report.Checks[0].Name)
+	require.Positive(t, report.Checks[0].Checked)
+
+	require.Implements(t, (*RangeSizeEstimator)(nil), db)
+	size, err := db.(RangeSizeEstimator).EstimateRangeSize(nil, nil)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	require.Implements(t, (*GetAppender)(nil), db)
+	buf, ok, err := GetAppend(db, []byte("key000001"), []byte("x"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, buf, 1025)
+}
@@ -0,0 +1,27 @@
+package db
+
+// GetAppender is implemented by databases which can read a value into a buffer provided by the
+// caller, e.g. pebble, which reads it from the block cache without an intermediate copy. Use the
+// GetAppend function to read into a buffer from any database.
+type GetAppender interface {
+	// GetAppend appends the value of key to dst, and returns the extended buffer and whether the
+	// key exists. dst is returned unchanged if it does not.
+	// CONTRACT: key readonly []byte
+	GetAppend(key, dst []byte) ([]byte, bool, error)
+}
+
+// GetAppend appends the value of key in db to dst, and returns the extended buffer and whether the
+// key exists, so that hot readers can reuse a buffer across reads, e.g. with
+// buf, ok, err = GetAppend(db, key, buf[:0]). If db is a GetAppender, the value is read into the
+// buffer without allocating when it has enough capacity. Otherwise, the value is read with Get and
+// copied.
+func GetAppend(db DBReader, key, dst []byte) ([]byte, bool, error) {
+	if ga, ok := db.(GetAppender); ok {
+		return ga.GetAppend(key, dst)
+	}
+	value, err := db.Get(key)
+	if err != nil || value == nil {
+		return dst, false, err
+	}
+	return append(dst, value...), true, nil
+}
@@ -6,19 +6,168 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func init() {
-	dbCreator := func(name string, dir string) (DB, error) {
-		return NewGoLevelDB(name, dir)
+	dbCreator := func(name string, dir string, opts *dbOptions) (DB, error) {
+		return newGoLevelDB(name, dir, nil, opts)
 	}
 	registerDBCreator(GoLevelDBBackend, dbCreator)
 }
 
+// goLevelDBOptions holds the goleveldb settings that can be passed to NewDB or
+// NewGoLevelDBWithOpts.
+type goLevelDBOptions struct {
+	tune          []func(*opt.Options)
+	copyIterators bool
+	autoRecover   bool
+	maxBatchSize  int
+	verify        *goLevelDBVerify
+}
+
+// withGoLevelDBTuning returns an Option which adjusts the goleveldb options.
+func withGoLevelDBTuning(tune func(*opt.Options)) Option {
+	return func(o *dbOptions) {
+		o.goLevelDB.tune = append(o.goLevelDB.tune, tune)
+	}
+}
+
+// WithGoLevelDBWriteBuffer sets the size in bytes of the goleveldb memtable. Larger buffers absorb
+// write bursts, such as block commits, at the cost of memory and longer recovery on open.
+func WithGoLevelDBWriteBuffer(size int) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.WriteBuffer = size
+	})
+}
+
+// WithGoLevelDBBlockCacheCapacity sets the capacity in bytes of the goleveldb block cache.
+func WithGoLevelDBBlockCacheCapacity(size int) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.BlockCacheCapacity = size
+	})
+}
+
+// defaultBloomFilterBitsPerKey is the number of bits per key of the bloom filters enabled by
+// default for goleveldb and pebble, which makes about 1% of the lookups of missing keys read a
+// table.
+const defaultBloomFilterBitsPerKey = 10
+
+// WithGoLevelDBBloomFilter sets the number of bits per key of the bloom filters, which avoid disk
+// reads for most lookups of missing keys. Bloom filters of 10 bits per key are enabled by default,
+// unless the leveldb options set another filter, and a bitsPerKey of 0 or less disables them.
+func WithGoLevelDBBloomFilter(bitsPerKey int) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		if bitsPerKey <= 0 {
+			o.Filter = nil
+			return
+		}
+		o.Filter = filter.NewBloomFilter(bitsPerKey)
+	})
+}
+
+// WithGoLevelDBCompactionTableSize sets the size in bytes of the sorted tables written by
+// compactions.
+func WithGoLevelDBCompactionTableSize(size int) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.CompactionTableSize = size
+	})
+}
+
+// WithGoLevelDBOpenFilesCacheCapacity sets the number of open table files goleveldb keeps cached.
+func WithGoLevelDBOpenFilesCacheCapacity(capacity int) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.OpenFilesCacheCapacity = capacity
+	})
+}
+
+// WithGoLevelDBCompression sets the block compression used by goleveldb.
+func WithGoLevelDBCompression(compression opt.Compression) Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.Compression = compression
+	})
+}
+
+// LevelDBProfileBlockstore tunes goleveldb for block stores, which mostly append large values at
+// increasing heights and read recent blocks: a larger memtable absorbs whole block commits, bigger
+// tables reduce the number of files, bloom filters avoid disk reads for missing heights and hashes,
+// and compression is disabled since block parts are mostly incompressible transactions. Options
+// passed after the profile override its settings.
+func LevelDBProfileBlockstore() Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.WriteBuffer = 64 * opt.MiB
+		o.BlockCacheCapacity = 32 * opt.MiB
+		o.CompactionTableSize = 8 * opt.MiB
+		o.Filter = filter.NewBloomFilter(10)
+		o.Compression = opt.NoCompression
+	})
+}
+
+// LevelDBProfileState tunes goleveldb for state and application stores, which see many small
+// random reads and updates: a large block cache keeps the working set in memory, bloom filters
+// avoid disk reads for missing keys, and compression is kept since small values compress well.
+// Options passed after the profile override its settings.
+func LevelDBProfileState() Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.WriteBuffer = 32 * opt.MiB
+		o.BlockCacheCapacity = 128 * opt.MiB
+		o.CompactionTableSize = 4 * opt.MiB
+		o.Filter = filter.NewBloomFilter(10)
+		o.Compression = opt.SnappyCompression
+	})
+}
+
+// WithGoLevelDBReadOnly opens an existing goleveldb database in read-only mode, without taking the
+// write lock, so that explorers and debugging tools can inspect the database of a running node.
+// Writes fail, and the database is never modified, e.g. by compactions.
+func WithGoLevelDBReadOnly() Option {
+	return withGoLevelDBTuning(func(o *opt.Options) {
+		o.ReadOnly = true
+		o.ErrorIfMissing = true
+	})
+}
+
+// WithGoLevelDBIteratorCopy makes all iterators return copies of their keys and values, which
+// remain valid after the iterator moves on, at the cost of an allocation per call. By default the
+// returned slices are only valid until the next call to Next or Close. Use IteratorWithOptions to
+// choose per iterator instead.
+func WithGoLevelDBIteratorCopy() Option {
+	return func(o *dbOptions) {
+		o.goLevelDB.copyIterators = true
+	}
+}
+
+// WithGoLevelDBMaxBatchSize limits the memory used by batches: once a batch grows beyond size bytes,
+// its operations are written to the database in a chunk, and the batch continues with the next
+// ones. Operations are still applied in order, but a batch is no longer atomic: chunks already
+// written remain when the batch is closed without being written, or when the final write fails.
+// Use NewAtomicBatch for batches that must be atomic.
+func WithGoLevelDBMaxBatchSize(size int) Option {
+	return func(o *dbOptions) {
+		o.goLevelDB.maxBatchSize = size
+	}
+}
+
+// WithGoLevelDBAutoRecover makes opening a goleveldb database attempt a recovery with
+// RecoverGoLevelDB when it fails because of corruption, e.g. a corrupted manifest after a crash.
+// The corruption is still published as EventCorruption.
+func WithGoLevelDBAutoRecover() Option {
+	return func(o *dbOptions) {
+		o.goLevelDB.autoRecover = true
+	}
+}
+
 type GoLevelDB struct {
-	db *leveldb.DB
+	db            *leveldb.DB
+	path          string
+	copyIterators bool
+	maxBatchSize  int
+	syncer        *periodicSyncer
+	journal       *goLevelDBJournalStorage
+	stalls        *goLevelDBStallMonitor
+	stats         *statsCache
 }
 
 var _ DB = (*GoLevelDB)(nil)
@@ -27,19 +176,77 @@ func NewGoLevelDB(name string, dir string) (*GoLevelDB, error) {
 	return NewGoLevelDBWithOpts(name, dir, nil)
 }
 
-func NewGoLevelDBWithOpts(name string, dir string, o *opt.Options) (*GoLevelDB, error) {
+// NewGoLevelDBWithOpts creates a goleveldb database with the given leveldb options, which may be
+// nil, adjusted by the given Options. The leveldb options are not modified. Bloom filters are
+// enabled if the options set no filter, see WithGoLevelDBBloomFilter.
+func NewGoLevelDBWithOpts(name string, dir string, o *opt.Options, opts ...Option) (*GoLevelDB, error) {
+	return newGoLevelDB(name, dir, o, newDBOptions(opts))
+}
+
+func newGoLevelDB(name string, dir string, o *opt.Options, dbOpts *dbOptions) (*GoLevelDB, error) {
+	var tuned opt.Options
+	if o != nil {
+		tuned = *o
+	}
+	if tuned.Filter == nil {
+		tuned.Filter = filter.NewBloomFilter(defaultBloomFilterBitsPerKey)
+	}
+	for _, f := range dbOpts.goLevelDB.tune {
+		f(&tuned)
+	}
+	o = &tuned
+
 	dbPath := filepath.Join(dir, name+".db")
-	db, err := leveldb.OpenFile(dbPath, o)
+	var journal *goLevelDBJournalStorage
+	periodicSync := dbOpts.periodicSync.interval > 0 || dbOpts.periodicSync.bytes > 0
+	if periodicSync && !o.ReadOnly {
+		var err error
+		if journal, err = openGoLevelDBJournalStorage(dbPath); err != nil {
+			return nil, err
+		}
+	}
+	db, err := openGoLevelDB(dbPath, o, journal, false)
+	if err != nil && dbOpts.goLevelDB.autoRecover && errors.IsCorrupted(err) {
+		dbOpts.events.publish(EventCorruption, err, "recovering database", 0)
+		db, err = openGoLevelDB(dbPath, o, journal, true)
+	}
 	if err != nil {
+		journal.close()
 		return nil, err
 	}
 
 	database := &GoLevelDB{
-		db: db,
+		db:            db,
+		path:          dbPath,
+		copyIterators: dbOpts.goLevelDB.copyIterators,
+		maxBatchSize:  dbOpts.goLevelDB.maxBatchSize,
+		journal:       journal,
+		stats:         newStatsCache(dbOpts),
+	}
+	if dbOpts.goLevelDB.verify != nil {
+		if database, err = verifyGoLevelDBOnOpen(database, o, dbOpts); err != nil {
+			journal.close()
+			return nil, err
+		}
 	}
+	if journal != nil {
+		database.syncer = newPeriodicSyncer(dbOpts.clock, dbOpts.periodicSync, journal.sync)
+	}
+	database.stalls = newGoLevelDBStallMonitor(dbOpts.clock, dbOpts.events, database.db.Stats)
 	return database, nil
 }
 
+// RecoverGoLevelDB recovers the goleveldb database with the given name, which must not be open, by
+// rebuilding its manifest from the existing table files, e.g. after "leveldb: manifest corrupted"
+// errors. Data that was only in corrupted files is lost.
+func RecoverGoLevelDB(name string, dir string) error {
+	db, err := leveldb.RecoverFile(filepath.Join(dir, name+".db"), nil)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
 // Get implements DB.
 func (db *GoLevelDB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
@@ -76,6 +283,7 @@ func (db *GoLevelDB) Set(key []byte, value []byte) error {
 	if err != nil {
 		return err
 	}
+	db.syncer.wrote(len(key) + len(value))
 	return nil
 }
 
@@ -105,6 +313,7 @@ func (db *GoLevelDB) Delete(key []byte) error {
 	if err != nil {
 		return err
 	}
+	db.syncer.wrote(len(key))
 	return nil
 }
 
@@ -124,9 +333,20 @@ func (db *GoLevelDB) DB() *leveldb.DB {
 	return db.db
 }
 
+// SyncError returns the error of the first failed background sync of a database opened with
+// WithPeriodicSync, if any. Writes which were not synced since then may be lost on a crash.
+func (db *GoLevelDB) SyncError() error {
+	return db.syncer.error()
+}
+
 // Close implements DB.
 func (db *GoLevelDB) Close() error {
-	return db.db.Close()
+	db.stalls.close()
+	db.syncer.close()
+	if err := db.db.Close(); err != nil {
+		return err
+	}
+	return db.journal.close()
 }
 
 // Print implements DB.
@@ -146,8 +366,13 @@ func (db *GoLevelDB) Print() error {
 	return nil
 }
 
-// Stats implements DB.
+// Stats implements DB. Statistics are cached if the database was opened with WithStatsCacheTTL.
 func (db *GoLevelDB) Stats() map[string]string {
+	return db.stats.get(db.computeStats)
+}
+
+// computeStats returns the statistics of the database.
+func (db *GoLevelDB) computeStats() map[string]string {
 	keys := []string{
 		"leveldb.num-files-at-level{n}",
 		"leveldb.stats",
@@ -171,28 +396,64 @@ func (db *GoLevelDB) Stats() map[string]string {
 
 // NewBatch implements DB.
 func (db *GoLevelDB) NewBatch() Batch {
-	return newGoLevelDBBatch(db)
+	return newGoLevelDBBatch(db, db.maxBatchSize)
+}
+
+// NewAtomicBatch creates a batch which is written atomically, regardless of the maximum batch size
+// set with WithGoLevelDBMaxBatchSize.
+func (db *GoLevelDB) NewAtomicBatch() Batch {
+	return newGoLevelDBBatch(db, 0)
 }
 
 // Iterator implements DB.
 func (db *GoLevelDB) Iterator(start, end []byte) (Iterator, error) {
+	return db.IteratorWithOptions(start, end, IterOptions{Copy: db.copyIterators})
+}
+
+// ReverseIterator implements DB.
+func (db *GoLevelDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return db.ReverseIteratorWithOptions(start, end, IterOptions{Copy: db.copyIterators})
+}
+
+// IteratorWithOptions is like Iterator, but with the given iterator options instead of the ones
+// the database was opened with.
+func (db *GoLevelDB) IteratorWithOptions(start, end []byte, o IterOptions) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
 		return nil, errKeyEmpty
 	}
-	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
-	return newGoLevelDBIterator(itr, start, end, false), nil
+	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, o.readOptions())
+	return newGoLevelDBIterator(itr, start, end, false).withOptions(o), nil
 }
 
-// ReverseIterator implements DB.
-func (db *GoLevelDB) ReverseIterator(start, end []byte) (Iterator, error) {
+// ReverseIteratorWithOptions is like ReverseIterator, but with the given iterator options instead
+// of the ones the database was opened with.
+func (db *GoLevelDB) ReverseIteratorWithOptions(start, end []byte, o IterOptions) (Iterator, error) {
 	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
 		return nil, errKeyEmpty
 	}
-	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
-	return newGoLevelDBIterator(itr, start, end, true), nil
+	itr := db.db.NewIterator(&util.Range{Start: start, Limit: end}, o.readOptions())
+	return newGoLevelDBIterator(itr, start, end, true).withOptions(o), nil
 }
 
 // Compact range.
 func (db *GoLevelDB) Compact(start, end []byte) error {
 	return db.db.CompactRange(util.Range{Start: start, Limit: end})
 }
+
+var _ RangeSizeEstimator = (*GoLevelDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator. Data in the memtable is not accounted for.
+func (db *GoLevelDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	if start == nil || end == nil {
+		first, last, err := keyBounds(db, start, end)
+		if err != nil || first == nil {
+			return 0, err
+		}
+		start, end = first, append(last, 0)
+	}
+	sizes, err := db.db.SizeOf([]util.Range{{Start: start, Limit: end}})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(sizes.Sum()), nil
+}
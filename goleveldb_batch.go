@@ -8,14 +8,19 @@ import (
 type goLevelDBBatch struct {
 	db    *GoLevelDB
 	batch *leveldb.Batch
+	// written is the batch once written, reused by Reset.
+	written *leveldb.Batch
+	// maxSize is the size in bytes above which the batch is flushed to the database, or 0.
+	maxSize int
 }
 
 var _ Batch = (*goLevelDBBatch)(nil)
 
-func newGoLevelDBBatch(db *GoLevelDB) *goLevelDBBatch {
+func newGoLevelDBBatch(db *GoLevelDB, maxSize int) *goLevelDBBatch {
 	return &goLevelDBBatch{
-		db:    db,
-		batch: new(leveldb.Batch),
+		db:      db,
+		batch:   new(leveldb.Batch),
+		maxSize: maxSize,
 	}
 }
 
@@ -31,7 +36,7 @@ func (b *goLevelDBBatch) Set(key, value []byte) error {
 		return errBatchClosed
 	}
 	b.batch.Put(key, value)
-	return nil
+	return b.flushIfFull()
 }
 
 // Delete implements Batch.
@@ -43,6 +48,38 @@ func (b *goLevelDBBatch) Delete(key []byte) error {
 		return errBatchClosed
 	}
 	b.batch.Delete(key)
+	return b.flushIfFull()
+}
+
+// Count implements Batch. Operations already flushed by WithGoLevelDBMaxBatchSize are not
+// counted.
+func (b *goLevelDBBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.Len()
+}
+
+// SizeBytes implements Batch. It is the size of the encoded batch.
+func (b *goLevelDBBatch) SizeBytes() int {
+	if b.batch == nil {
+		return 0
+	}
+	return len(b.batch.Dump())
+}
+
+// flushIfFull writes the batch to the database and resets it, if it exceeds the maximum size.
+// Chunks are written in order, so the operations are applied in the order they were added.
+func (b *goLevelDBBatch) flushIfFull() error {
+	if b.maxSize <= 0 || len(b.batch.Dump()) < b.maxSize {
+		return nil
+	}
+	if err := b.db.db.Write(b.batch, nil); err != nil {
+		return err
+	}
+	size := len(b.batch.Dump())
+	b.batch.Reset()
+	b.db.syncer.wrote(size)
 	return nil
 }
 
@@ -65,8 +102,26 @@ func (b *goLevelDBBatch) write(sync bool) error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	if !sync {
+		b.db.syncer.wrote(len(b.batch.Dump()))
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch.Reset()
+	b.batch, b.written = nil, b.batch
+	return nil
+}
+
+// Reset implements Batch. The underlying leveldb batch is reused.
+func (b *goLevelDBBatch) Reset() error {
+	if b.batch == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.batch, b.written = b.written, nil
+	}
+	b.batch.Reset()
+	return nil
 }
 
 // Close implements Batch.
@@ -75,5 +130,6 @@ func (b *goLevelDBBatch) Close() error {
 		b.batch.Reset()
 		b.batch = nil
 	}
+	b.written = nil
 	return nil
 }
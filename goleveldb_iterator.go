@@ -4,17 +4,43 @@ import (
 	"bytes"
 
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
+// IterOptions configures a single goleveldb iterator.
+type IterOptions struct {
+	// Copy makes Key and Value return copies, which remain valid after the iterator moves on.
+	Copy bool
+	// DontFillCache keeps the blocks read by the iterator out of the block cache, so that large
+	// scans, e.g. state exports or pruning, do not evict the hot working set.
+	DontFillCache bool
+	// Strict verifies the checksums of all blocks read by the iterator, failing with a corruption
+	// error instead of returning corrupted data.
+	Strict bool
+}
+
+// readOptions returns the goleveldb read options of the iterator, or nil for the defaults.
+func (o IterOptions) readOptions() *opt.ReadOptions {
+	if !o.DontFillCache && !o.Strict {
+		return nil
+	}
+	ro := &opt.ReadOptions{DontFillCache: o.DontFillCache}
+	if o.Strict {
+		ro.Strict = opt.StrictBlockChecksum | opt.StrictReader
+	}
+	return ro
+}
+
 type goLevelDBIterator struct {
 	source    iterator.Iterator
 	start     []byte
 	end       []byte
 	isReverse bool
 	isInvalid bool
+	copy      bool
 }
 
-var _ Iterator = (*goLevelDBIterator)(nil)
+var _ UnsafeIterator = (*goLevelDBIterator)(nil)
 
 func newGoLevelDBIterator(source iterator.Iterator, start, end []byte, isReverse bool) *goLevelDBIterator {
 	if isReverse {
@@ -47,6 +73,12 @@ func newGoLevelDBIterator(source iterator.Iterator, start, end []byte, isReverse
 	}
 }
 
+// withOptions applies the iterator options and returns the iterator.
+func (itr *goLevelDBIterator) withOptions(o IterOptions) *goLevelDBIterator {
+	itr.copy = o.Copy
+	return itr
+}
+
 // Domain implements Iterator.
 func (itr *goLevelDBIterator) Domain() ([]byte, []byte) {
 	return itr.start, itr.end
@@ -93,17 +125,37 @@ func (itr *goLevelDBIterator) Valid() bool {
 }
 
 // Key implements Iterator.
-// The caller should not modify the contents of the returned slice.
-// Instead, the caller should make a copy and work on the copy.
+// Unless the iterator was created with IterOptions.Copy, the caller should not modify the contents
+// of the returned slice, which is only valid until the next call to Next or Close. Instead, the
+// caller should make a copy and work on the copy.
 func (itr *goLevelDBIterator) Key() []byte {
 	itr.assertIsValid()
+	if itr.copy {
+		return cp(itr.source.Key())
+	}
 	return itr.source.Key()
 }
 
 // Value implements Iterator.
-// The caller should not modify the contents of the returned slice.
-// Instead, the caller should make a copy and work on the copy.
+// Unless the iterator was created with IterOptions.Copy, the caller should not modify the contents
+// of the returned slice, which is only valid until the next call to Next or Close. Instead, the
+// caller should make a copy and work on the copy.
 func (itr *goLevelDBIterator) Value() []byte {
+	itr.assertIsValid()
+	if itr.copy {
+		return cp(itr.source.Value())
+	}
+	return itr.source.Value()
+}
+
+// UnsafeKey implements UnsafeIterator. It does not copy the key, even with IterOptions.Copy.
+func (itr *goLevelDBIterator) UnsafeKey() []byte {
+	itr.assertIsValid()
+	return itr.source.Key()
+}
+
+// UnsafeValue implements UnsafeIterator. It does not copy the value, even with IterOptions.Copy.
+func (itr *goLevelDBIterator) UnsafeValue() []byte {
 	itr.assertIsValid()
 	return itr.source.Value()
 }
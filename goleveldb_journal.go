@@ -0,0 +1,112 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// goLevelDBJournalStorage wraps the storage of a goleveldb database opened with WithPeriodicSync,
+// to keep the writer of its current journal. goleveldb only syncs the journal along with a synced
+// write, so this lets the journal be synced on its own. The methods of a nil
+// goLevelDBJournalStorage do nothing, so that databases without a durability policy need no
+// checks.
+type goLevelDBJournalStorage struct {
+	storage.Storage
+
+	mtx     sync.Mutex
+	journal *goLevelDBJournalWriter
+}
+
+// openGoLevelDBJournalStorage opens the storage of the goleveldb database at path.
+func openGoLevelDBJournalStorage(path string) (*goLevelDBJournalStorage, error) {
+	stor, err := storage.OpenFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return &goLevelDBJournalStorage{Storage: stor}, nil
+}
+
+// Create implements storage.Storage.
+func (s *goLevelDBJournalStorage) Create(fd storage.FileDesc) (storage.Writer, error) {
+	w, err := s.Storage.Create(fd)
+	if err != nil || fd.Type != storage.TypeJournal {
+		return w, err
+	}
+	journal := &goLevelDBJournalWriter{Writer: w}
+	s.mtx.Lock()
+	s.journal = journal
+	s.mtx.Unlock()
+	return journal, nil
+}
+
+// sync syncs the current journal, if any.
+func (s *goLevelDBJournalStorage) sync() error {
+	if s == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	journal := s.journal
+	s.mtx.Unlock()
+	if journal == nil {
+		return nil
+	}
+	return journal.sync()
+}
+
+// close closes the storage, once the database is closed.
+func (s *goLevelDBJournalStorage) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.Storage.Close()
+}
+
+// goLevelDBJournalWriter is the writer of a goleveldb journal, which can be synced concurrently
+// with goleveldb rotating and closing it.
+type goLevelDBJournalWriter struct {
+	storage.Writer
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+// Close implements storage.Writer. The journal is synced first, as goleveldb rotates journals
+// without syncing them, so that the writes in a rotated journal are not left unsynced.
+func (w *goLevelDBJournalWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.closed = true
+	if err := w.Writer.Sync(); err != nil {
+		w.Writer.Close()
+		return err
+	}
+	return w.Writer.Close()
+}
+
+// sync syncs the journal, unless it was closed.
+func (w *goLevelDBJournalWriter) sync() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.Writer.Sync()
+}
+
+// openGoLevelDB opens the goleveldb database at path, on the given journal storage if not nil, and
+// recovers it if requested.
+func openGoLevelDB(path string, o *opt.Options, journal *goLevelDBJournalStorage, recover bool) (*leveldb.DB, error) {
+	switch {
+	case journal == nil && recover:
+		return leveldb.RecoverFile(path, o)
+	case journal == nil:
+		return leveldb.OpenFile(path, o)
+	case recover:
+		return leveldb.Recover(journal, o)
+	default:
+		return leveldb.Open(journal, o)
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// GoLevelDBRepairReport is the result of repairing a goleveldb database.
+type GoLevelDBRepairReport struct {
+	// OpenErr is the error opening the database failed with before the repair, e.g. a corrupted
+	// manifest, if any.
+	OpenErr error
+	// Tables is the number of table files checked.
+	Tables int
+	// Corrupted lists the corrupted tables. Their level is -1, since the manifest recording the
+	// levels may be corrupted itself.
+	Corrupted []GoLevelDBTableCorruption
+	// QuarantineDir is the directory the corrupted tables were moved to, if any.
+	QuarantineDir string
+	// Recovered is set if the manifest was rebuilt.
+	Recovered bool
+}
+
+// NeedsRepair reports whether the database failed to open or has corrupted tables.
+func (r *GoLevelDBRepairReport) NeedsRepair() bool {
+	return r.OpenErr != nil || len(r.Corrupted) > 0
+}
+
+// RepairGoLevelDB repairs the goleveldb database with the given name, which must not be open,
+// e.g. after a crash in the middle of a compaction. It verifies the checksums of all table files,
+// including those missing from a corrupted manifest, moves the corrupted ones to a
+// <name>.db.corrupted directory next to the database, and rebuilds the manifest from the
+// remaining tables like RecoverGoLevelDB. Data that was only in corrupted tables is lost, but the
+// tables are kept for forensics. Nothing is done if the database opens and has no corrupted
+// tables. If dryRun is set, the database is only checked, and the report lists what would be
+// dropped.
+func RepairGoLevelDB(name string, dir string, dryRun bool) (*GoLevelDBRepairReport, error) {
+	dbPath := filepath.Join(dir, name+".db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	report := &GoLevelDBRepairReport{}
+	ldb, err := leveldb.OpenFile(dbPath, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		report.OpenErr = err
+	} else if err := ldb.Close(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		var num int64
+		var ext string
+		if _, err := fmt.Sscanf(entry.Name(), "%d.%s", &num, &ext); err != nil || (ext != "ldb" && ext != "sst") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		report.Tables++
+		file, err := verifyGoLevelDBTable(dbPath, num, info.Size())
+		if err != nil {
+			report.Corrupted = append(report.Corrupted, GoLevelDBTableCorruption{File: file, Level: -1, Err: err})
+		}
+	}
+	if dryRun || !report.NeedsRepair() {
+		return report, nil
+	}
+
+	if len(report.Corrupted) > 0 {
+		report.QuarantineDir = dbPath + ".corrupted"
+		if err := os.MkdirAll(report.QuarantineDir, 0o755); err != nil {
+			return report, err
+		}
+		for _, c := range report.Corrupted {
+			if err := os.Rename(c.File, filepath.Join(report.QuarantineDir, filepath.Base(c.File))); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := RecoverGoLevelDB(name, dir); err != nil {
+		return report, err
+	}
+	report.Recovered = true
+	return report, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairGoLevelDBCorruptedTable(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+	defer os.RemoveAll(name + ".db.corrupted")
+	createCorruptedGoLevelDB(t, name)
+
+	report, err := RepairGoLevelDB(name, "", true)
+	require.NoError(t, err)
+	require.True(t, report.NeedsRepair())
+	require.Equal(t, 1, report.Tables)
+	require.Len(t, report.Corrupted, 1)
+	require.Equal(t, -1, report.Corrupted[0].Level)
+	require.False(t, report.Recovered)
+	require.FileExists(t, report.Corrupted[0].File)
+
+	report, err = RepairGoLevelDB(name, "", false)
+	require.NoError(t, err)
+	require.True(t, report.Recovered)
+	require.FileExists(t, filepath.Join(report.QuarantineDir, filepath.Base(report.Corrupted[0].File)))
+	require.NoFileExists(t, report.Corrupted[0].File)
+
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	verify, err := db.Verify()
+	require.NoError(t, err)
+	require.Empty(t, verify.Corrupted)
+	require.NoError(t, db.Close())
+
+	report, err = RepairGoLevelDB(name, "", false)
+	require.NoError(t, err)
+	require.False(t, report.NeedsRepair())
+	require.False(t, report.Recovered)
+}
+
+func TestRepairGoLevelDBManifest(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewGoLevelDB("test", dir)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), int642Bytes(int64(i))))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+	require.NoError(t, db.Close())
+	manifests, err := filepath.Glob(filepath.Join(dir, "test.db", "MANIFEST-*"))
+	require.NoError(t, err)
+	for _, manifest := range manifests {
+		require.NoError(t, os.WriteFile(manifest, []byte("corrupted"), 0o600))
+	}
+
+	report, err := RepairGoLevelDB("test", dir, false)
+	require.NoError(t, err)
+	require.Error(t, report.OpenErr)
+	require.Empty(t, report.Corrupted)
+	require.True(t, report.Recovered)
+
+	db, err = NewGoLevelDB("test", dir)
+	require.NoError(t, err)
+	defer db.Close()
+	checkValue(t, db, int642Bytes(42), int642Bytes(42))
+}
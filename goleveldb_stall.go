@@ -0,0 +1,82 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// goLevelDBStallPollInterval is how often a goleveldb database publishing events is checked for
+// write stalls.
+const goLevelDBStallPollInterval = time.Second
+
+// goLevelDBStallMonitor publishes EventWriteStall when goleveldb delays or pauses writes because
+// compactions cannot keep up. goleveldb has no callback for stalls, so its stats are polled from a
+// background goroutine. The methods of a nil goLevelDBStallMonitor do nothing, so that databases
+// without an event bus need no checks.
+type goLevelDBStallMonitor struct {
+	stats    func(*leveldb.DBStats) error
+	events   eventSource
+	clock    Clock
+	done     chan struct{} // closed by close to stop the goroutine
+	finished chan struct{} // closed by the goroutine when it returns
+	stop     sync.Once
+}
+
+// newGoLevelDBStallMonitor starts a goLevelDBStallMonitor polling stats, or returns nil if events
+// are not published.
+func newGoLevelDBStallMonitor(clock Clock, events eventSource,
+	stats func(*leveldb.DBStats) error,
+) *goLevelDBStallMonitor {
+	if events.bus == nil {
+		return nil
+	}
+	m := &goLevelDBStallMonitor{
+		stats:    stats,
+		events:   events,
+		clock:    clock,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// run publishes an event whenever writes were delayed since the previous poll, or have been
+// paused, until the monitor is closed.
+func (m *goLevelDBStallMonitor) run() {
+	defer close(m.finished)
+	var last leveldb.DBStats
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.clock.After(goLevelDBStallPollInterval):
+		}
+		var stats leveldb.DBStats
+		if err := m.stats(&stats); err != nil {
+			continue
+		}
+		if delayed := stats.WriteDelayCount - last.WriteDelayCount; delayed > 0 {
+			m.events.publish(EventWriteStall, nil, fmt.Sprintf("%d writes delayed", delayed),
+				stats.WriteDelayDuration-last.WriteDelayDuration)
+		}
+		if stats.WritePaused && !last.WritePaused {
+			m.events.publish(EventWriteStall, nil, "writes paused", 0)
+		}
+		last = stats
+	}
+}
+
+// close stops the background goroutine. It can be called more than once.
+func (m *goLevelDBStallMonitor) close() {
+	if m == nil {
+		return
+	}
+	m.stop.Do(func() {
+		close(m.done)
+	})
+	<-m.finished
+}
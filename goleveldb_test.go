@@ -2,11 +2,16 @@ package db
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func TestGoLevelDBNewGoLevelDB(t *testing.T) {
@@ -30,6 +35,93 @@ func TestGoLevelDBNewGoLevelDB(t *testing.T) {
 	defer ro2.Close()
 }
 
+func TestGoLevelDBTuningOptions(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	base := &opt.Options{WriteBuffer: 1 << 20}
+	db, err := NewGoLevelDBWithOpts(name, "", base,
+		WithGoLevelDBWriteBuffer(8<<20),
+		WithGoLevelDBBlockCacheCapacity(16<<20),
+		WithGoLevelDBBloomFilter(10),
+		WithGoLevelDBCompactionTableSize(4<<20),
+		WithGoLevelDBOpenFilesCacheCapacity(100),
+		WithGoLevelDBCompression(opt.NoCompression),
+	)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The given options must not be modified.
+	require.Equal(t, 1<<20, base.WriteBuffer)
+	require.Nil(t, base.Filter)
+
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	checkValue(t, db, []byte("a"), []byte{1})
+}
+
+func TestGoLevelDBTuningOptionsNewDB(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewDB(name, GoLevelDBBackend, "", WithGoLevelDBBloomFilter(10))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	checkValue(t, db, []byte("a"), []byte{1})
+}
+
+func TestGoLevelDBBloomFilterOptOut(t *testing.T) {
+	var o opt.Options
+	o.Filter = filter.NewBloomFilter(defaultBloomFilterBitsPerKey)
+	for _, tune := range newDBOptions([]Option{WithGoLevelDBBloomFilter(0)}).goLevelDB.tune {
+		tune(&o)
+	}
+	require.Nil(t, o.Filter)
+
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+	db, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBBloomFilter(0))
+	require.NoError(t, err)
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	checkValue(t, db, []byte("a"), []byte{1})
+	require.NoError(t, db.Close())
+}
+
+func TestLevelDBProfiles(t *testing.T) {
+	tuned := func(opts ...Option) opt.Options {
+		var o opt.Options
+		for _, tune := range newDBOptions(opts).goLevelDB.tune {
+			tune(&o)
+		}
+		return o
+	}
+
+	blockstore := tuned(LevelDBProfileBlockstore())
+	require.Equal(t, 64*opt.MiB, blockstore.WriteBuffer)
+	require.Equal(t, opt.NoCompression, blockstore.Compression)
+	require.NotNil(t, blockstore.Filter)
+
+	state := tuned(LevelDBProfileState())
+	require.Equal(t, 128*opt.MiB, state.BlockCacheCapacity)
+	require.Equal(t, opt.SnappyCompression, state.Compression)
+	require.NotNil(t, state.Filter)
+
+	// Later options override the profile.
+	overridden := tuned(LevelDBProfileState(), WithGoLevelDBWriteBuffer(opt.MiB))
+	require.Equal(t, opt.MiB, overridden.WriteBuffer)
+
+	for _, profile := range []Option{LevelDBProfileBlockstore(), LevelDBProfileState()} {
+		name := fmt.Sprintf("test_%x", randStr(12))
+		db, err := NewDB(name, GoLevelDBBackend, "", profile)
+		require.NoError(t, err)
+		require.NoError(t, db.Set([]byte("a"), []byte{1}))
+		checkValue(t, db, []byte("a"), []byte{1})
+		require.NoError(t, db.Close())
+		cleanupDBDir("", name)
+	}
+}
+
 func BenchmarkGoLevelDBRandomReadsWrites(b *testing.B) {
 	name := fmt.Sprintf("test_%x", randStr(12))
 	db, err := NewGoLevelDB(name, "")
@@ -54,3 +146,374 @@ func TestGoLevelDBBackend(t *testing.T) {
 	_, ok := db.(*GoLevelDB)
 	assert.True(t, ok)
 }
+
+func TestGoLevelDBSnapshot(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer cleanupDBDir("", name)
+	defer db.Close()
+
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	require.NoError(t, db.Set([]byte("b"), []byte{2}))
+
+	snapshot, err := db.NewSnapshot()
+	require.NoError(t, err)
+	defer snapshot.Close()
+
+	require.NoError(t, db.Set([]byte("a"), []byte{9}))
+	require.NoError(t, db.Delete([]byte("b")))
+	require.NoError(t, db.Set([]byte("c"), []byte{3}))
+
+	value, err := snapshot.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, value)
+	ok, err := snapshot.Has([]byte("b"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = snapshot.Has([]byte("c"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = snapshot.Get(nil)
+	require.Equal(t, errKeyEmpty, err)
+
+	itr, err := snapshot.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte("a"), []byte{1})
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte("b"), []byte{2})
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	ritr, err := snapshot.ReverseIterator(nil, []byte("b"))
+	require.NoError(t, err)
+	checkItem(t, ritr, []byte("a"), []byte{1})
+	checkNext(t, ritr, false)
+	require.NoError(t, ritr.Close())
+
+	checkValue(t, db, []byte("a"), []byte{9})
+}
+
+func TestGoLevelDBCompactReclaimsSpace(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer cleanupDBDir("", name)
+	defer db.Close()
+
+	// The values are random, so that they are not compressed, and the keys are spread over
+	// several tables.
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), []byte(randStr(1024))))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+	sizes, err := db.DB().SizeOf([]util.Range{{Start: int642Bytes(0), Limit: int642Bytes(10000)}})
+	require.NoError(t, err)
+	require.NotZero(t, sizes.Sum())
+
+	// Compacting a sub-range only reclaims the space of that range.
+	halves := []util.Range{
+		{Start: int642Bytes(0), Limit: int642Bytes(5000)},
+		{Start: int642Bytes(5000), Limit: int642Bytes(10000)},
+	}
+	before, err := db.DB().SizeOf(halves)
+	require.NoError(t, err)
+	for i := 0; i < 5000; i++ {
+		require.NoError(t, db.Delete(int642Bytes(int64(i))))
+	}
+	require.NoError(t, db.Compact(int642Bytes(0), int642Bytes(5000)))
+	after, err := db.DB().SizeOf(halves)
+	require.NoError(t, err)
+	require.Zero(t, after[0])
+	// The table holding keys of both halves is rewritten, which changes the estimate slightly.
+	require.InEpsilon(t, before[1], after[1], 0.01)
+
+	for i := 5000; i < 10000; i++ {
+		require.NoError(t, db.Delete(int642Bytes(int64(i))))
+	}
+	require.NoError(t, db.Compact(int642Bytes(5000), nil))
+	sizes, err = db.DB().SizeOf([]util.Range{{Start: int642Bytes(0), Limit: int642Bytes(10000)}})
+	require.NoError(t, err)
+	require.Zero(t, sizes.Sum())
+}
+
+func TestGoLevelDBTransaction(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer cleanupDBDir("", name)
+	defer db.Close()
+
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+
+	// Writes are visible within the transaction, but not outside of it until committed.
+	tx, err := db.NewTransaction()
+	require.NoError(t, err)
+	value, err := tx.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, tx.Set([]byte("a"), append(value, 2)))
+	require.NoError(t, tx.Set([]byte("b"), []byte{3}))
+	require.NoError(t, tx.Delete([]byte("c")))
+	require.Equal(t, errKeyEmpty, tx.Set(nil, []byte{1}))
+
+	value, err = tx.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, value)
+	ok, err := tx.Has([]byte("b"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	itr, err := tx.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte("a"), []byte{1, 2})
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte("b"), []byte{3})
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	snapshot, err := db.NewSnapshot()
+	require.NoError(t, err)
+	checkValue(t, snapshot, []byte("a"), []byte{1})
+	checkValue(t, snapshot, []byte("b"), nil)
+	require.NoError(t, snapshot.Close())
+
+	require.NoError(t, tx.Commit())
+	checkValue(t, db, []byte("a"), []byte{1, 2})
+	checkValue(t, db, []byte("b"), []byte{3})
+
+	// Discarded writes are dropped.
+	tx, err = db.NewTransaction()
+	require.NoError(t, err)
+	require.NoError(t, tx.Set([]byte("a"), []byte{9}))
+	tx.Discard()
+	checkValue(t, db, []byte("a"), []byte{1, 2})
+}
+
+func TestGoLevelDBIteratorCopy(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBIteratorCopy())
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := byte(1); i <= 3; i++ {
+		require.NoError(t, db.Set([]byte{i}, []byte{i}))
+	}
+
+	collect := func(itr Iterator) (keys, values [][]byte) {
+		defer itr.Close()
+		for ; itr.Valid(); itr.Next() {
+			keys = append(keys, itr.Key())
+			values = append(values, itr.Value())
+		}
+		require.NoError(t, itr.Error())
+		return keys, values
+	}
+
+	// Slices returned by a copying iterator remain valid after it moves on or is closed.
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	keys, values := collect(itr)
+	require.Equal(t, [][]byte{{1}, {2}, {3}}, keys)
+	require.Equal(t, [][]byte{{1}, {2}, {3}}, values)
+
+	itr, err = db.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	keys, values = collect(itr)
+	require.Equal(t, [][]byte{{3}, {2}, {1}}, keys)
+	require.Equal(t, [][]byte{{3}, {2}, {1}}, values)
+
+	// Modifying a copy does not affect the iterator.
+	itr, err = db.IteratorWithOptions(nil, nil, IterOptions{Copy: true})
+	require.NoError(t, err)
+	defer itr.Close()
+	itr.Key()[0] = 9
+	itr.Value()[0] = 9
+	require.Equal(t, []byte{1}, itr.Key())
+	require.Equal(t, []byte{1}, itr.Value())
+
+	// UnsafeKey and UnsafeValue never copy.
+	u := itr.(UnsafeIterator)
+	require.NotSame(t, &itr.Key()[0], &itr.Key()[0])
+	require.Same(t, &u.UnsafeKey()[0], &u.UnsafeKey()[0])
+	require.Same(t, &u.UnsafeValue()[0], &u.UnsafeValue()[0])
+	require.Equal(t, []byte{1}, u.UnsafeKey())
+
+	// Copying can be disabled per iterator.
+	itr, err = db.ReverseIteratorWithOptions([]byte{2}, nil, IterOptions{})
+	require.NoError(t, err)
+	defer itr.Close()
+	require.Equal(t, []byte{3}, itr.Key())
+	itr.Next()
+	require.Equal(t, []byte{2}, itr.Value())
+}
+
+// corruptGoLevelDBManifest overwrites the manifest of a closed goleveldb database with garbage.
+func corruptGoLevelDBManifest(t *testing.T, name string) {
+	t.Helper()
+	manifests, err := filepath.Glob(filepath.Join(name+".db", "MANIFEST-*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, manifests)
+	for _, manifest := range manifests {
+		require.NoError(t, os.WriteFile(manifest, []byte("garbage garbage garbage garbage"), 0o600))
+	}
+}
+
+func TestRecoverGoLevelDB(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	require.NoError(t, db.SetSync([]byte("a"), []byte{1}))
+	require.NoError(t, db.Close())
+
+	corruptGoLevelDBManifest(t, name)
+	_, err = NewGoLevelDB(name, "")
+	require.True(t, errors.IsCorrupted(err), "unexpected error %v", err)
+
+	require.NoError(t, RecoverGoLevelDB(name, ""))
+	db, err = NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer db.Close()
+	checkValue(t, db, []byte("a"), []byte{1})
+}
+
+func TestGoLevelDBAutoRecover(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	require.NoError(t, db.SetSync([]byte("a"), []byte{1}))
+	require.NoError(t, db.Close())
+	corruptGoLevelDBManifest(t, name)
+
+	recorder := &eventRecorder{}
+	rdb, err := NewDB(name, GoLevelDBBackend, "", WithGoLevelDBAutoRecover(), WithEventBus(NewEventBus(recorder)))
+	require.NoError(t, err)
+	defer rdb.Close()
+	checkValue(t, rdb, []byte("a"), []byte{1})
+	require.Equal(t, []EventType{EventCorruption, EventOpen}, recorder.types())
+}
+
+func TestGoLevelDBMaxBatchSize(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBMaxBatchSize(1024))
+	require.NoError(t, err)
+	defer db.Close()
+
+	value := make([]byte, 100)
+	batch := db.NewBatch()
+	defer batch.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, batch.Set(int642Bytes(int64(i)), value))
+	}
+	require.NoError(t, batch.Delete(int642Bytes(0)))
+	require.NoError(t, batch.Set([]byte("last"), []byte{1}))
+
+	// Full chunks have been written before the batch, in order.
+	checkValue(t, db, int642Bytes(0), value)
+	checkValue(t, db, int642Bytes(1), value)
+	checkValue(t, db, []byte("last"), nil)
+	require.NoError(t, batch.Write())
+	checkValue(t, db, int642Bytes(0), nil)
+	checkValue(t, db, int642Bytes(99), value)
+	checkValue(t, db, []byte("last"), []byte{1})
+
+	// Atomic batches are never split.
+	atomic := db.NewAtomicBatch()
+	defer atomic.Close()
+	for i := 100; i < 200; i++ {
+		require.NoError(t, atomic.Set(int642Bytes(int64(i)), value))
+	}
+	checkValue(t, db, int642Bytes(100), nil)
+	require.NoError(t, atomic.WriteSync())
+	checkValue(t, db, int642Bytes(100), value)
+	checkValue(t, db, int642Bytes(199), value)
+}
+
+func TestGoLevelDBReadOnly(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	// Read-only mode does not create missing databases.
+	_, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBReadOnly())
+	require.Error(t, err)
+
+	wr, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	require.NoError(t, wr.SetSync([]byte("a"), []byte{1}))
+	require.NoError(t, wr.Close())
+
+	ro1, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBReadOnly())
+	require.NoError(t, err)
+	defer ro1.Close()
+	ro2, err := NewDB(name, GoLevelDBBackend, "", WithGoLevelDBReadOnly())
+	require.NoError(t, err)
+	defer ro2.Close()
+
+	checkValue(t, ro1, []byte("a"), []byte{1})
+	checkValue(t, ro2, []byte("a"), []byte{1})
+	require.Error(t, ro1.Set([]byte("b"), []byte{2}))
+	batch := ro2.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Delete([]byte("a")))
+	require.Error(t, batch.Write())
+	checkValue(t, ro1, []byte("a"), []byte{1})
+}
+
+func TestGoLevelDBIteratorReadOptions(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), make([]byte, 100)))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+	require.NoError(t, db.Close())
+
+	// Reopen with an empty block cache.
+	db, err = NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	defer db.Close()
+	cachedBlocks := func() string {
+		value, err := db.DB().GetProperty("leveldb.cachedblock")
+		require.NoError(t, err)
+		return value
+	}
+	scan := func(o IterOptions) {
+		itr, err := db.IteratorWithOptions(nil, nil, o)
+		require.NoError(t, err)
+		defer itr.Close()
+		count := 0
+		for ; itr.Valid(); itr.Next() {
+			count++
+		}
+		require.NoError(t, itr.Error())
+		require.Equal(t, 1000, count)
+	}
+
+	scan(IterOptions{DontFillCache: true, Strict: true})
+	require.Equal(t, "0", cachedBlocks())
+	scan(IterOptions{})
+	require.NotEqual(t, "0", cachedBlocks())
+}
+
+func BenchmarkGoLevelDBMissingKeys(b *testing.B) {
+	for _, bitsPerKey := range []int{0, defaultBloomFilterBitsPerKey} {
+		b.Run(fmt.Sprintf("bloom=%d", bitsPerKey), func(b *testing.B) {
+			// The block cache is disabled, so that lookups without filters read blocks from disk.
+			db, err := NewGoLevelDBWithOpts("bench", b.TempDir(), &opt.Options{DisableBlockCache: true},
+				WithGoLevelDBBloomFilter(bitsPerKey))
+			require.NoError(b, err)
+			defer db.Close()
+			benchmarkMissingKeys(b, db, 100000, 32, func() error { return db.Compact(nil, nil) })
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// GoLevelDBTransaction is a native goleveldb transaction with read-your-writes semantics: reads
+// made through the transaction observe its own uncommitted writes. Writes become visible to the
+// database atomically on Commit.
+//
+// While a transaction is open, all other writes to the database block, so transactions should be
+// short-lived. Callers must call either Commit or Discard when done.
+type GoLevelDBTransaction struct {
+	tx *leveldb.Transaction
+}
+
+var _ DBReader = (*GoLevelDBTransaction)(nil)
+
+// NewTransaction opens a transaction. It blocks until any other open transaction is committed or
+// discarded.
+func (db *GoLevelDB) NewTransaction() (*GoLevelDBTransaction, error) {
+	tx, err := db.db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return &GoLevelDBTransaction{tx: tx}, nil
+}
+
+// Get implements DBReader.
+func (tx *GoLevelDBTransaction) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	res, err := tx.tx.Get(key, nil)
+	if err != nil {
+		if err == errors.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// Has implements DBReader.
+func (tx *GoLevelDBTransaction) Has(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	return tx.tx.Has(key, nil)
+}
+
+// Set sets the value for the given key within the transaction.
+// CONTRACT: key, value readonly []byte
+func (tx *GoLevelDBTransaction) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return tx.tx.Put(key, value, nil)
+}
+
+// Delete deletes the key within the transaction.
+// CONTRACT: key readonly []byte
+func (tx *GoLevelDBTransaction) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return tx.tx.Delete(key, nil)
+}
+
+// Iterator implements DBReader. The iterator observes the writes made within the transaction
+// before it was created.
+func (tx *GoLevelDBTransaction) Iterator(start, end []byte) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	itr := tx.tx.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	return newGoLevelDBIterator(itr, start, end, false), nil
+}
+
+// ReverseIterator implements DBReader. The iterator observes the writes made within the
+// transaction before it was created.
+func (tx *GoLevelDBTransaction) ReverseIterator(start, end []byte) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	itr := tx.tx.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	return newGoLevelDBIterator(itr, start, end, true), nil
+}
+
+// Commit atomically applies the writes of the transaction to the database. The transaction cannot
+// be used afterwards.
+func (tx *GoLevelDBTransaction) Commit() error {
+	return tx.tx.Commit()
+}
+
+// Discard drops the writes of the transaction. It is a no-op if the transaction has already been
+// committed or discarded.
+func (tx *GoLevelDBTransaction) Discard() {
+	tx.tx.Discard()
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/table"
+)
+
+// GoLevelDBTableCorruption describes a corrupted goleveldb table file.
+type GoLevelDBTableCorruption struct {
+	// File is the path of the table file.
+	File string
+	// Level is the level of the table in the LSM tree.
+	Level int
+	// Err describes the corruption.
+	Err error
+}
+
+// GoLevelDBVerifyReport is the result of verifying the tables of a goleveldb database.
+type GoLevelDBVerifyReport struct {
+	// Tables is the number of tables checked.
+	Tables int
+	// Corrupted lists the corrupted tables.
+	Corrupted []GoLevelDBTableCorruption
+	// Dropped is set if the corrupted tables were dropped from the database.
+	Dropped bool
+}
+
+// GoLevelDBCorruptionError is returned when opening a goleveldb database with
+// WithGoLevelDBVerifyOnOpen finds corrupted tables.
+type GoLevelDBCorruptionError struct {
+	Report *GoLevelDBVerifyReport
+}
+
+// Error implements error.
+func (e *GoLevelDBCorruptionError) Error() string {
+	files := make([]string, 0, len(e.Report.Corrupted))
+	for _, c := range e.Report.Corrupted {
+		files = append(files, fmt.Sprintf("%s (level %d): %v", filepath.Base(c.File), c.Level, c.Err))
+	}
+	return fmt.Sprintf("%d of %d tables corrupted: %s", len(e.Report.Corrupted), e.Report.Tables,
+		strings.Join(files, "; "))
+}
+
+// goLevelDBVerify holds the settings of WithGoLevelDBVerifyOnOpen.
+type goLevelDBVerify struct {
+	dropCorrupted bool
+}
+
+// WithGoLevelDBVerifyOnOpen verifies the checksums of all tables after opening a goleveldb
+// database, so that corruption is reported upfront with the affected tables, instead of failing
+// later in the middle of a block with a cryptic error. Opening fails with a
+// *GoLevelDBCorruptionError if corrupted tables are found, unless dropCorrupted is set, in which
+// case they are deleted and the database is recovered without them. The data of dropped tables is
+// lost, and must be restored by other means, e.g. by syncing it again. Dropped tables are reported
+// by an EventCorruption whose error is a *GoLevelDBCorruptionError.
+func WithGoLevelDBVerifyOnOpen(dropCorrupted bool) Option {
+	return func(o *dbOptions) {
+		o.goLevelDB.verify = &goLevelDBVerify{dropCorrupted: dropCorrupted}
+	}
+}
+
+// Verify reads all tables of the database, verifying their checksums, and reports the corrupted
+// ones. It can run while the database is in use, but is expensive since it reads all data. Tables
+// deleted by concurrent compactions are skipped.
+func (db *GoLevelDB) Verify() (*GoLevelDBVerifyReport, error) {
+	sstables, err := db.db.GetProperty("leveldb.sstables")
+	if err != nil {
+		return nil, err
+	}
+	report := &GoLevelDBVerifyReport{}
+	level := 0
+	scanner := bufio.NewScanner(strings.NewReader(sstables))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, err := fmt.Sscanf(line, "--- level %d ---", &level); err == nil {
+			continue
+		}
+		var num, size int64
+		if _, err := fmt.Sscanf(line, "%d:%d", &num, &size); err != nil {
+			return nil, fmt.Errorf("unexpected sstables line %q: %w", line, err)
+		}
+		report.Tables++
+		file, err := verifyGoLevelDBTable(db.path, num, size)
+		if os.IsNotExist(err) {
+			// The table was deleted by a compaction since it was listed.
+			continue
+		}
+		if err != nil {
+			report.Corrupted = append(report.Corrupted, GoLevelDBTableCorruption{File: file, Level: level, Err: err})
+		}
+	}
+	return report, scanner.Err()
+}
+
+var _ Checker = (*GoLevelDB)(nil)
+
+// Check implements Checker. It verifies the checksums of all tables with Verify, then iterates
+// over the whole keyspace with strict reads, which also checks the merged view of the tables and
+// the memtable.
+func (db *GoLevelDB) Check(ctx context.Context) (*CheckReport, error) {
+	tables := CheckResult{Name: "table-checksums"}
+	verify, err := db.Verify()
+	if err != nil {
+		return nil, err
+	}
+	tables.Checked = uint64(verify.Tables)
+	for _, c := range verify.Corrupted {
+		tables.addError("%s (level %d): %v", filepath.Base(c.File), c.Level, c.Err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyspace, err := checkKeyspace(ctx, func(start, end []byte) (Iterator, error) {
+		return db.IteratorWithOptions(start, end, IterOptions{DontFillCache: true, Strict: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{tables, keyspace}}, nil
+}
+
+// verifyGoLevelDBTable reads the table with the given file number, returning its path and the
+// first corruption found.
+func verifyGoLevelDBTable(dbPath string, num, size int64) (string, error) {
+	fd := storage.FileDesc{Type: storage.TypeTable, Num: num}
+	path := filepath.Join(dbPath, fmt.Sprintf("%06d.ldb", num))
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Tables written by older versions of leveldb use the .sst extension.
+		path = filepath.Join(dbPath, fmt.Sprintf("%06d.sst", num))
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return path, err
+	}
+	defer f.Close()
+
+	strict := &opt.Options{Strict: opt.StrictAll}
+	reader, err := table.NewReader(f, size, fd, nil, nil, strict)
+	if err != nil {
+		return path, err
+	}
+	defer reader.Release()
+	itr := reader.NewIterator(nil, &opt.ReadOptions{Strict: opt.StrictAll})
+	defer itr.Release()
+	for itr.Next() {
+		// Reading the entries verifies the checksums of their blocks.
+	}
+	return path, itr.Error()
+}
+
+// verifyGoLevelDBOnOpen verifies a freshly opened database, dropping its corrupted tables if
+// requested. It returns the database to use, which is reopened after dropping tables, and closes
+// it on errors.
+func verifyGoLevelDBOnOpen(db *GoLevelDB, o *opt.Options, dbOpts *dbOptions) (*GoLevelDB, error) {
+	report, err := db.Verify()
+	if err != nil {
+		db.db.Close()
+		return nil, err
+	}
+	if len(report.Corrupted) == 0 {
+		return db, nil
+	}
+	corruption := &GoLevelDBCorruptionError{Report: report}
+	if !dbOpts.goLevelDB.verify.dropCorrupted {
+		db.db.Close()
+		return nil, corruption
+	}
+
+	dbOpts.events.publish(EventCorruption, corruption, "dropping corrupted tables", 0)
+	if err := db.db.Close(); err != nil {
+		return nil, err
+	}
+	for _, c := range report.Corrupted {
+		if err := os.Remove(c.File); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	ldb, err := openGoLevelDB(db.path, o, db.journal, true)
+	if err != nil {
+		return nil, err
+	}
+	report.Dropped = true
+	db.db = ldb
+	return db, nil
+}
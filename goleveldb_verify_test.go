@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createCorruptedGoLevelDB creates a goleveldb database whose single table is corrupted.
+func createCorruptedGoLevelDB(t *testing.T, name string) {
+	t.Helper()
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), make([]byte, 100)))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+	report, err := db.Verify()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Tables)
+	require.Empty(t, report.Corrupted)
+	require.NoError(t, db.Close())
+
+	tables, err := filepath.Glob(filepath.Join(name+".db", "*.ldb"))
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	f, err := os.OpenFile(tables[0], os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte("corrupted"), 1000)
+	require.NoError(t, err)
+}
+
+func TestGoLevelDBVerifyOnOpen(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+	createCorruptedGoLevelDB(t, name)
+
+	_, err := NewGoLevelDBWithOpts(name, "", nil, WithGoLevelDBVerifyOnOpen(false))
+	var cerr *GoLevelDBCorruptionError
+	require.True(t, errors.As(err, &cerr), "unexpected error %v", err)
+	require.Equal(t, 1, cerr.Report.Tables)
+	require.Len(t, cerr.Report.Corrupted, 1)
+	require.Equal(t, ".ldb", filepath.Ext(cerr.Report.Corrupted[0].File))
+	require.False(t, cerr.Report.Dropped)
+
+	// Without verification, the database opens and fails later.
+	db, err := NewGoLevelDB(name, "")
+	require.NoError(t, err)
+	report, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, report.Corrupted, 1)
+	require.NoError(t, db.Close())
+}
+
+func TestGoLevelDBVerifyOnOpenDropCorrupted(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	defer cleanupDBDir("", name)
+	createCorruptedGoLevelDB(t, name)
+
+	recorder := &eventRecorder{}
+	db, err := NewDB(name, GoLevelDBBackend, "", WithGoLevelDBVerifyOnOpen(true), WithEventBus(NewEventBus(recorder)))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.Equal(t, []EventType{EventCorruption, EventOpen}, recorder.types())
+	var cerr *GoLevelDBCorruptionError
+	require.True(t, errors.As(recorder.events[0].Err, &cerr))
+	require.True(t, cerr.Report.Dropped)
+
+	// The data of the dropped table is gone, and the database is usable.
+	checkValue(t, db, int642Bytes(1), nil)
+	require.NoError(t, db.Set(int642Bytes(1), []byte{1}))
+	checkValue(t, db, int642Bytes(1), []byte{1})
+}
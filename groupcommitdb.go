@@ -0,0 +1,266 @@
+package db
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GroupCommitDB wraps a database, and coalesces concurrent synced writes into groups which are
+// written as a single synced batch, so that they share one fsync instead of paying one each. The
+// first synced write of a group waits for the commit window to let others join, then writes the
+// group, and all of its writers return once the write completes, with its error if any. A group
+// is only written after the previous one completed, and writes arriving meanwhile join the next
+// group, so that groups grow with the load even with a zero window.
+//
+// Writes within a group are applied in the order they joined it, and a batch is applied atomically
+// with the rest of its group. Writes which are not synced are passed through.
+type GroupCommitDB struct {
+	db     DB
+	window time.Duration
+	clock  Clock
+
+	commitMtx sync.Mutex // serializes the writes of groups
+
+	mtx     sync.Mutex
+	group   *commitGroup
+	groups  uint64
+	commits uint64
+}
+
+var _ DB = (*GroupCommitDB)(nil)
+
+// commitGroup is a group of synced writes to be written together.
+type commitGroup struct {
+	ops     []operation
+	writers int
+	done    chan struct{}
+	err     error
+}
+
+// NewGroupCommitDB wraps db, waiting for window before writing a group of synced writes.
+func NewGroupCommitDB(db DB, window time.Duration) *GroupCommitDB {
+	return &GroupCommitDB{
+		db:     db,
+		window: window,
+		clock:  SystemClock,
+	}
+}
+
+// commit adds operations to the current group, and returns once the group was written. The
+// operations must not be modified until then.
+func (gdb *GroupCommitDB) commit(ops []operation) error {
+	gdb.mtx.Lock()
+	group := gdb.group
+	leader := group == nil
+	if leader {
+		group = &commitGroup{done: make(chan struct{})}
+		gdb.group = group
+	}
+	group.ops = append(group.ops, ops...)
+	group.writers++
+	gdb.mtx.Unlock()
+
+	if !leader {
+		<-group.done
+		return group.err
+	}
+
+	if gdb.window > 0 {
+		<-gdb.clock.After(gdb.window)
+	}
+	gdb.commitMtx.Lock()
+	defer gdb.commitMtx.Unlock()
+	// Writes arriving from now on join the next group.
+	gdb.mtx.Lock()
+	gdb.group = nil
+	gdb.groups++
+	gdb.commits += uint64(group.writers)
+	gdb.mtx.Unlock()
+
+	group.err = writeOperations(gdb.db, group.ops, true)
+	close(group.done)
+	return group.err
+}
+
+// Get implements DB.
+func (gdb *GroupCommitDB) Get(key []byte) ([]byte, error) {
+	return gdb.db.Get(key)
+}
+
+// Has implements DB.
+func (gdb *GroupCommitDB) Has(key []byte) (bool, error) {
+	return gdb.db.Has(key)
+}
+
+// Set implements DB.
+func (gdb *GroupCommitDB) Set(key []byte, value []byte) error {
+	return gdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (gdb *GroupCommitDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return gdb.commit([]operation{{opTypeSet, key, value}})
+}
+
+// Delete implements DB.
+func (gdb *GroupCommitDB) Delete(key []byte) error {
+	return gdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (gdb *GroupCommitDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return gdb.commit([]operation{{opTypeDelete, key, nil}})
+}
+
+// Iterator implements DB.
+func (gdb *GroupCommitDB) Iterator(start, end []byte) (Iterator, error) {
+	return gdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (gdb *GroupCommitDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return gdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (gdb *GroupCommitDB) Close() error {
+	return gdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (gdb *GroupCommitDB) NewBatch() Batch {
+	return &groupCommitDBBatch{gdb: gdb}
+}
+
+// Print implements DB.
+func (gdb *GroupCommitDB) Print() error {
+	return gdb.db.Print()
+}
+
+// Stats implements DB.
+func (gdb *GroupCommitDB) Stats() map[string]string {
+	stats := gdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	gdb.mtx.Lock()
+	defer gdb.mtx.Unlock()
+	stats["group_commit.groups"] = strconv.FormatUint(gdb.groups, 10)
+	stats["group_commit.commits"] = strconv.FormatUint(gdb.commits, 10)
+	return stats
+}
+
+// Compact implements DB.
+func (gdb *GroupCommitDB) Compact(start, end []byte) error {
+	return gdb.db.Compact(start, end)
+}
+
+// groupCommitDBBatch buffers operations, which join a group when the batch is written synced.
+type groupCommitDBBatch struct {
+	gdb     *GroupCommitDB
+	ops     []operation
+	size    int            // of the keys and values of ops
+	written *GroupCommitDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*groupCommitDBBatch)(nil)
+
+// Set implements Batch.
+func (b *groupCommitDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.gdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *groupCommitDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.gdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *groupCommitDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *groupCommitDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *groupCommitDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *groupCommitDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *groupCommitDBBatch) write(sync bool) error {
+	if b.gdb == nil {
+		return errBatchClosed
+	}
+	var err error
+	switch {
+	case len(b.ops) == 0:
+	case sync:
+		err = b.gdb.commit(b.ops)
+	default:
+		err = writeOperations(b.gdb.db, b.ops, false)
+	}
+	if err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.gdb, b.written, b.ops, b.size = nil, b.gdb, b.ops[:0], 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *groupCommitDBBatch) Reset() error {
+	if b.gdb == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.gdb, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *groupCommitDBBatch) Close() error {
+	b.gdb, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForGroup waits until the current group of gdb has the given number of writers, and its
+// leader is waiting for the commit window.
+func waitForGroup(t *testing.T, gdb *GroupCommitDB, clock *clocktest.ManualClock, writers int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		gdb.mtx.Lock()
+		defer gdb.mtx.Unlock()
+		return gdb.group != nil && gdb.group.writers == writers && clock.Timers() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestGroupCommitDB(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	gdb := NewGroupCommitDB(NewMemDB(), time.Millisecond)
+	gdb.clock = clock
+	defer gdb.Close()
+
+	require.NoError(t, gdb.db.SetSync(bz("b"), bz("x")))
+
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+2)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- gdb.SetSync(bz(fmt.Sprintf("key%02d", i)), bz(fmt.Sprintf("value%02d", i)))
+		}(i)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs <- gdb.DeleteSync(bz("b"))
+	}()
+	go func() {
+		defer wg.Done()
+		batch := gdb.NewBatch()
+		defer batch.Close()
+		if err := batch.Set(bz("c"), bz("batch")); err != nil {
+			errs <- err
+			return
+		}
+		errs <- batch.WriteSync()
+	}()
+
+	// Nothing is written until the commit window elapses.
+	waitForGroup(t, gdb, clock, writers+2)
+	checkValue(t, gdb, bz("key00"), nil)
+	clock.Advance(time.Millisecond)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < writers; i++ {
+		checkValue(t, gdb, bz(fmt.Sprintf("key%02d", i)), bz(fmt.Sprintf("value%02d", i)))
+	}
+	checkValue(t, gdb, bz("b"), nil)
+	checkValue(t, gdb, bz("c"), bz("batch"))
+	stats := gdb.Stats()
+	require.Equal(t, "1", stats["group_commit.groups"])
+	require.Equal(t, "12", stats["group_commit.commits"])
+
+	// Writes which are not synced are passed through.
+	require.NoError(t, gdb.Set(bz("d"), bz("d")))
+	batch := gdb.NewBatch()
+	require.NoError(t, batch.Set(bz("e"), bz("e")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	checkValue(t, gdb, bz("d"), bz("d"))
+	checkValue(t, gdb, bz("e"), bz("e"))
+	require.Equal(t, "1", gdb.Stats()["group_commit.groups"])
+}
+
+func TestGroupCommitDBError(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	gdb := NewGroupCommitDB(NewReadOnlyDB(NewMemDB()), time.Millisecond)
+	gdb.clock = clock
+
+	// All writers of a group get the error of its write.
+	errs := make(chan error, 2)
+	go func() { errs <- gdb.SetSync(bz("a"), bz("a")) }()
+	go func() { errs <- gdb.DeleteSync(bz("b")) }()
+	waitForGroup(t, gdb, clock, 2)
+	clock.Advance(time.Millisecond)
+	require.ErrorIs(t, <-errs, ErrReadOnly)
+	require.ErrorIs(t, <-errs, ErrReadOnly)
+
+	require.Equal(t, errKeyEmpty, gdb.SetSync(nil, bz("a")))
+	require.Equal(t, errValueNil, gdb.SetSync(bz("a"), nil))
+}
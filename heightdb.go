@@ -0,0 +1,631 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrHeightNotFound is returned when no writes were recorded for a height.
+	ErrHeightNotFound = errors.New("height not found")
+	// ErrHeightPruned is returned when the writes needed to reconstruct a height have been pruned.
+	ErrHeightPruned = errors.New("height pruned")
+)
+
+// Layout of a HeightDB in the underlying database. User data is stored under heightDataPrefix,
+// so that it never collides with the metadata stored under heightMetaPrefix:
+//
+//	m s                       -> next sequence number
+//	m p                       -> height below which writes have been pruned
+//	m h <height>              -> heightRecord of the writes made at height
+//	m c <sequence>            -> changeEntry of the write with the given sequence number
+//	m k <escaped key> <seq>   -> height of the write with the given sequence number to key
+//
+// Heights and sequence numbers are encoded as big-endian uint64, so that they sort numerically.
+var (
+	heightDataPrefix     = []byte("d")
+	heightMetaPrefix     = []byte("m")
+	heightSeqKey         = []byte("ms")
+	heightPrunedKey      = []byte("mp")
+	heightRecordPrefix   = []byte("mh")
+	heightChangePrefix   = []byte("mc")
+	heightKeyIndexPrefix = []byte("mk")
+)
+
+// HeightDB wraps a database and groups writes by block height. Every write made through a
+// HeightBatch is tagged with its height and recorded in a changelog stored alongside the data, which
+// makes it possible to efficiently delete everything written below a height, to verify that all
+// writes of a height were persisted, or to roll the store back to a previous height.
+//
+// The underlying database must be used exclusively by the HeightDB.
+type HeightDB struct {
+	mtx  sync.RWMutex
+	db   DB
+	data *PrefixDB
+}
+
+// NewHeightDB wraps db.
+func NewHeightDB(db DB) *HeightDB {
+	return &HeightDB{
+		db:   db,
+		data: NewPrefixDB(db, heightDataPrefix),
+	}
+}
+
+// heightRecord describes the writes made at a height. Writes made at the same height are assigned
+// consecutive sequence numbers, and their encoded change entries are hashed into a digest.
+type heightRecord struct {
+	firstSeq uint64
+	count    uint64
+	digest   [sha256.Size]byte
+}
+
+func (r heightRecord) encode() []byte {
+	bz := make([]byte, 16, 16+sha256.Size)
+	binary.BigEndian.PutUint64(bz, r.firstSeq)
+	binary.BigEndian.PutUint64(bz[8:], r.count)
+	return append(bz, r.digest[:]...)
+}
+
+func decodeHeightRecord(bz []byte) (heightRecord, error) {
+	var r heightRecord
+	if len(bz) != 16+sha256.Size {
+		return r, fmt.Errorf("invalid height record length %d", len(bz))
+	}
+	r.firstSeq = binary.BigEndian.Uint64(bz)
+	r.count = binary.BigEndian.Uint64(bz[8:])
+	copy(r.digest[:], bz[16:])
+	return r, nil
+}
+
+// changeEntry is a single write recorded in the changelog. It includes the value the key had
+// before the write, if any, so that the write can be reverted.
+type changeEntry struct {
+	height uint64
+	op     WriteOp
+	key    []byte
+	value  []byte
+	prev   []byte // nil if the key did not exist
+}
+
+func (e changeEntry) encode() []byte {
+	bz := make([]byte, 0, 8+2+3*binary.MaxVarintLen64+len(e.key)+len(e.value)+len(e.prev))
+	bz = binary.BigEndian.AppendUint64(bz, e.height)
+	bz = append(bz, byte(e.op))
+	bz = binary.AppendUvarint(bz, uint64(len(e.key)))
+	bz = append(bz, e.key...)
+	bz = binary.AppendUvarint(bz, uint64(len(e.value)))
+	bz = append(bz, e.value...)
+	if e.prev == nil {
+		return append(bz, 0)
+	}
+	bz = append(bz, 1)
+	bz = binary.AppendUvarint(bz, uint64(len(e.prev)))
+	return append(bz, e.prev...)
+}
+
+func decodeChangeEntry(bz []byte) (changeEntry, error) {
+	var e changeEntry
+	if len(bz) < 9 {
+		return e, errors.New("change entry too short")
+	}
+	e.height = binary.BigEndian.Uint64(bz)
+	e.op = WriteOp(bz[8])
+	bz = bz[9:]
+	var err error
+	if e.key, bz, err = decodeLengthPrefixed(bz); err != nil {
+		return e, err
+	}
+	if e.value, bz, err = decodeLengthPrefixed(bz); err != nil {
+		return e, err
+	}
+	switch {
+	case len(bz) == 0:
+		return e, errors.New("change entry truncated")
+	case bz[0] == 0:
+		return e, nil
+	}
+	if e.prev, _, err = decodeLengthPrefixed(bz[1:]); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// decodeLengthPrefixed decodes a uvarint length prefixed byte slice, returning the remainder.
+func decodeLengthPrefixed(bz []byte) ([]byte, []byte, error) {
+	n, read := binary.Uvarint(bz)
+	if read <= 0 || uint64(len(bz)-read) < n {
+		return nil, nil, errors.New("invalid length prefixed field")
+	}
+	return bz[read : read+int(n)], bz[read+int(n):], nil
+}
+
+// uint64Key returns prefix followed by the big-endian encoding of n.
+func uint64Key(prefix []byte, n uint64) []byte {
+	return binary.BigEndian.AppendUint64(cp(prefix), n)
+}
+
+// escapeKey encodes key such that no encoded key is a prefix of another, while preserving their
+// order: 0x00 bytes are escaped as 0x00 0xFF, and the key is terminated by 0x00 0x01.
+func escapeKey(key []byte) []byte {
+	escaped := make([]byte, 0, len(key)+2)
+	for _, b := range key {
+		if b == 0x00 {
+			escaped = append(escaped, 0x00, 0xFF)
+			continue
+		}
+		escaped = append(escaped, b)
+	}
+	return append(escaped, 0x00, 0x01)
+}
+
+// keyIndexPrefix returns the prefix of all key index entries of key.
+func keyIndexPrefix(key []byte) []byte {
+	return append(cp(heightKeyIndexPrefix), escapeKey(key)...)
+}
+
+// Get implements DBReader.
+func (hdb *HeightDB) Get(key []byte) ([]byte, error) {
+	return hdb.data.Get(key)
+}
+
+// Has implements DBReader.
+func (hdb *HeightDB) Has(key []byte) (bool, error) {
+	return hdb.data.Has(key)
+}
+
+// Iterator implements DBReader.
+func (hdb *HeightDB) Iterator(start, end []byte) (Iterator, error) {
+	return hdb.data.Iterator(start, end)
+}
+
+// ReverseIterator implements DBReader.
+func (hdb *HeightDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return hdb.data.ReverseIterator(start, end)
+}
+
+// Close closes the underlying database.
+func (hdb *HeightDB) Close() error {
+	return hdb.db.Close()
+}
+
+// HeightBatch creates a batch whose writes are tagged with the given height. Heights must not
+// decrease: writing a batch for a height lower than the latest recorded one fails. Several batches
+// may be written for the same height. The caller must call Batch.Close.
+func (hdb *HeightDB) HeightBatch(height uint64) Batch {
+	return &heightDBBatch{
+		hdb:    hdb,
+		height: height,
+		ops:    []operation{},
+	}
+}
+
+// LatestHeight returns the highest height with recorded writes, and false if there is none.
+func (hdb *HeightDB) LatestHeight() (uint64, bool, error) {
+	itr, err := hdb.db.ReverseIterator(heightRecordPrefix, cpIncr(heightRecordPrefix))
+	if err != nil {
+		return 0, false, err
+	}
+	defer itr.Close()
+	if !itr.Valid() {
+		return 0, false, itr.Error()
+	}
+	return binary.BigEndian.Uint64(itr.Key()[len(heightRecordPrefix):]), true, nil
+}
+
+// heightRecord returns the record of the given height, or ErrHeightNotFound.
+func (hdb *HeightDB) heightRecord(height uint64) (heightRecord, error) {
+	bz, err := hdb.db.Get(uint64Key(heightRecordPrefix, height))
+	if err != nil {
+		return heightRecord{}, err
+	}
+	if bz == nil {
+		return heightRecord{}, ErrHeightNotFound
+	}
+	return decodeHeightRecord(bz)
+}
+
+// changeEntry returns the change entry with the given sequence number.
+func (hdb *HeightDB) changeEntry(seq uint64) (changeEntry, error) {
+	bz, err := hdb.db.Get(uint64Key(heightChangePrefix, seq))
+	if err != nil {
+		return changeEntry{}, err
+	}
+	if bz == nil {
+		return changeEntry{}, fmt.Errorf("change entry %d not found", seq)
+	}
+	return decodeChangeEntry(bz)
+}
+
+// VerifyHeight checks that all writes recorded for the given height were persisted, returning
+// ErrHeightNotFound if no writes were recorded for it.
+func (hdb *HeightDB) VerifyHeight(height uint64) error {
+	record, err := hdb.heightRecord(height)
+	if err != nil {
+		return err
+	}
+	var digest [sha256.Size]byte
+	for seq := record.firstSeq; seq < record.firstSeq+record.count; seq++ {
+		bz, err := hdb.db.Get(uint64Key(heightChangePrefix, seq))
+		if err != nil {
+			return err
+		}
+		if bz == nil {
+			return fmt.Errorf("height %d: change entry %d is missing", height, seq)
+		}
+		entry, err := decodeChangeEntry(bz)
+		if err != nil {
+			return fmt.Errorf("height %d: change entry %d: %w", height, seq, err)
+		}
+		if entry.height != height {
+			return fmt.Errorf("height %d: change entry %d belongs to height %d", height, seq, entry.height)
+		}
+		digest = sha256.Sum256(append(digest[:], bz...))
+	}
+	if digest != record.digest {
+		return fmt.Errorf("height %d: digest mismatch", height)
+	}
+	return nil
+}
+
+// PruneBelow deletes everything written at heights lower than the given one, along with the
+// corresponding metadata. Keys that were written again at the given height or later are kept.
+// Each height is pruned atomically. It returns the number of pruned heights.
+func (hdb *HeightDB) PruneBelow(height uint64) (int, error) {
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+
+	var heights []uint64
+	itr, err := hdb.db.Iterator(heightRecordPrefix, uint64Key(heightRecordPrefix, height))
+	if err != nil {
+		return 0, err
+	}
+	for ; itr.Valid(); itr.Next() {
+		heights = append(heights, binary.BigEndian.Uint64(itr.Key()[len(heightRecordPrefix):]))
+	}
+	err = itr.Error()
+	itr.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, h := range heights {
+		if err := hdb.pruneHeight(h, height); err != nil {
+			return i, err
+		}
+	}
+	return len(heights), nil
+}
+
+// pruneHeight atomically deletes the writes and metadata of height, keeping keys which were
+// written again at retainHeight or later. The caller must hold the mutex.
+func (hdb *HeightDB) pruneHeight(height, retainHeight uint64) error {
+	record, err := hdb.heightRecord(height)
+	if err != nil {
+		return err
+	}
+	batch := newAtomicBatch(hdb.db)
+	defer batch.Close()
+
+	for seq := record.firstSeq; seq < record.firstSeq+record.count; seq++ {
+		entry, err := hdb.changeEntry(seq)
+		if err != nil {
+			return err
+		}
+		lastHeight, err := hdb.lastWriteHeight(entry.key)
+		if err != nil {
+			return err
+		}
+		if lastHeight < retainHeight {
+			if err := batch.Delete(append(cp(heightDataPrefix), entry.key...)); err != nil {
+				return err
+			}
+		}
+		if err := batch.Delete(uint64Key(heightChangePrefix, seq)); err != nil {
+			return err
+		}
+		if err := batch.Delete(uint64Key(keyIndexPrefix(entry.key), seq)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(uint64Key(heightRecordPrefix, height)); err != nil {
+		return err
+	}
+	pruned, err := hdb.prunedBelow()
+	if err != nil {
+		return err
+	}
+	if retainHeight > pruned {
+		if err := batch.Set(heightPrunedKey, uint64Key(nil, retainHeight)); err != nil {
+			return err
+		}
+	}
+	return batch.WriteSync()
+}
+
+// prunedBelow returns the height below which writes have been pruned, or 0.
+func (hdb *HeightDB) prunedBelow() (uint64, error) {
+	bz, err := hdb.db.Get(heightPrunedKey)
+	if err != nil || bz == nil {
+		return 0, err
+	}
+	if len(bz) != 8 {
+		return 0, fmt.Errorf("invalid pruned height length %d", len(bz))
+	}
+	return binary.BigEndian.Uint64(bz), nil
+}
+
+// RollbackTo reverts all writes made at heights greater than the given one, restoring the state the
+// store had at that height, e.g. to recover from an app hash mismatch without resyncing. Heights are
+// reverted one at a time, atomically and from the latest one down, so an interrupted rollback can
+// simply be resumed. Data deleted by PruneBelow is not restored.
+func (hdb *HeightDB) RollbackTo(height uint64) error {
+	if height == math.MaxUint64 {
+		return nil
+	}
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+
+	var heights []uint64
+	itr, err := hdb.db.ReverseIterator(uint64Key(heightRecordPrefix, height+1), cpIncr(heightRecordPrefix))
+	if err != nil {
+		return err
+	}
+	for ; itr.Valid(); itr.Next() {
+		heights = append(heights, binary.BigEndian.Uint64(itr.Key()[len(heightRecordPrefix):]))
+	}
+	err = itr.Error()
+	itr.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range heights {
+		if err := hdb.rollbackHeight(h); err != nil {
+			return fmt.Errorf("rolling back height %d: %w", h, err)
+		}
+	}
+	return nil
+}
+
+// rollbackHeight atomically reverts the writes of height, which must be the latest height, and
+// deletes its metadata. The caller must hold the mutex.
+func (hdb *HeightDB) rollbackHeight(height uint64) error {
+	record, err := hdb.heightRecord(height)
+	if err != nil {
+		return err
+	}
+	batch := newAtomicBatch(hdb.db)
+	defer batch.Close()
+
+	for seq := record.firstSeq + record.count; seq > record.firstSeq; seq-- {
+		entry, err := hdb.changeEntry(seq - 1)
+		if err != nil {
+			return err
+		}
+		dataKey := append(cp(heightDataPrefix), entry.key...)
+		if entry.prev == nil {
+			err = batch.Delete(dataKey)
+		} else {
+			err = batch.Set(dataKey, entry.prev)
+		}
+		if err != nil {
+			return err
+		}
+		if err := batch.Delete(uint64Key(heightChangePrefix, seq-1)); err != nil {
+			return err
+		}
+		if err := batch.Delete(uint64Key(keyIndexPrefix(entry.key), seq-1)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(uint64Key(heightRecordPrefix, height)); err != nil {
+		return err
+	}
+	// Sequence numbers grow with heights, so the reverted ones can be reused.
+	if err := batch.Set(heightSeqKey, uint64Key(nil, record.firstSeq)); err != nil {
+		return err
+	}
+	return batch.WriteSync()
+}
+
+// lastWriteHeight returns the height of the most recent recorded write to key.
+func (hdb *HeightDB) lastWriteHeight(key []byte) (uint64, error) {
+	prefix := keyIndexPrefix(key)
+	itr, err := hdb.db.ReverseIterator(prefix, cpIncr(prefix))
+	if err != nil {
+		return 0, err
+	}
+	defer itr.Close()
+	if !itr.Valid() {
+		return 0, fmt.Errorf("no recorded write for key %X", key)
+	}
+	return binary.BigEndian.Uint64(itr.Value()), nil
+}
+
+// heightDBBatch buffers the operations of a height, and records them in the changelog on write.
+type heightDBBatch struct {
+	hdb     *HeightDB
+	height  uint64
+	ops     []operation
+	size    int         // of the keys and values of ops
+	written []operation // the cleared ops once written, reused by Reset
+}
+
+var _ Batch = (*heightDBBatch)(nil)
+
+// Set implements Batch.
+func (b *heightDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, key, value})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *heightDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, key, nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *heightDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *heightDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *heightDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *heightDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *heightDBBatch) write(sync bool) error {
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	hdb := b.hdb
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+
+	latest, ok, err := hdb.LatestHeight()
+	if err != nil {
+		return err
+	}
+	if ok && b.height < latest {
+		return fmt.Errorf("cannot write height %d below latest height %d", b.height, latest)
+	}
+	record, err := hdb.heightRecord(b.height)
+	switch {
+	case errors.Is(err, ErrHeightNotFound):
+		record = heightRecord{}
+	case err != nil:
+		return err
+	}
+	seq, err := hdb.nextSeq()
+	if err != nil {
+		return err
+	}
+	if record.count == 0 {
+		record.firstSeq = seq
+	} else if record.firstSeq+record.count != seq {
+		return fmt.Errorf("height %d: writes are not contiguous", b.height)
+	}
+
+	batch := newAtomicBatch(hdb.db)
+	defer batch.Close()
+	// pending holds the values written by earlier operations of the batch, nil for deletes.
+	pending := make(map[string][]byte)
+	for _, op := range b.ops {
+		entry := changeEntry{height: b.height, key: op.key, value: op.value}
+		prev, ok := pending[string(op.key)]
+		if !ok {
+			if prev, err = hdb.data.Get(op.key); err != nil {
+				return err
+			}
+		}
+		entry.prev = prev
+		pending[string(op.key)] = op.value
+		dataKey := append(cp(heightDataPrefix), op.key...)
+		switch op.opType {
+		case opTypeSet:
+			entry.op = WriteOpSet
+			err = batch.Set(dataKey, op.value)
+		case opTypeDelete:
+			entry.op = WriteOpDelete
+			err = batch.Delete(dataKey)
+		default:
+			err = fmt.Errorf("unknown operation type %v (%v)", op.opType, op)
+		}
+		if err != nil {
+			return err
+		}
+		encoded := entry.encode()
+		if err := batch.Set(uint64Key(heightChangePrefix, seq), encoded); err != nil {
+			return err
+		}
+		if err := batch.Set(uint64Key(keyIndexPrefix(op.key), seq), uint64Key(nil, b.height)); err != nil {
+			return err
+		}
+		record.digest = sha256.Sum256(append(record.digest[:], encoded...))
+		record.count++
+		seq++
+	}
+	if err := batch.Set(uint64Key(heightRecordPrefix, b.height), record.encode()); err != nil {
+		return err
+	}
+	if err := batch.Set(heightSeqKey, uint64Key(nil, seq)); err != nil {
+		return err
+	}
+	if sync {
+		err = batch.WriteSync()
+	} else {
+		err = batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.ops, b.size, b.written = nil, 0, b.ops[:0]
+	return nil
+}
+
+// nextSeq returns the next unused sequence number. The caller must hold the mutex.
+func (hdb *HeightDB) nextSeq() (uint64, error) {
+	bz, err := hdb.db.Get(heightSeqKey)
+	if err != nil || bz == nil {
+		return 0, err
+	}
+	if len(bz) != 8 {
+		return 0, fmt.Errorf("invalid sequence number length %d", len(bz))
+	}
+	return binary.BigEndian.Uint64(bz), nil
+}
+
+// Reset implements Batch.
+func (b *heightDBBatch) Reset() error {
+	if b.ops == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.ops, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *heightDBBatch) Close() error {
+	b.ops, b.size, b.written = nil, 0, nil
+	return nil
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeHeight writes the given key/value pairs at height, deleting keys with an empty value.
+func writeHeight(t *testing.T, hdb *HeightDB, height uint64, kvs ...string) {
+	t.Helper()
+	batch := hdb.HeightBatch(height)
+	defer batch.Close()
+	for i := 0; i < len(kvs); i += 2 {
+		if kvs[i+1] == "" {
+			require.NoError(t, batch.Delete(bz(kvs[i])))
+			continue
+		}
+		require.NoError(t, batch.Set(bz(kvs[i]), bz(kvs[i+1])))
+	}
+	require.NoError(t, batch.WriteSync())
+}
+
+func TestHeightDBHeightBatch(t *testing.T) {
+	hdb := NewHeightDB(NewMemDB())
+	defer hdb.Close()
+
+	_, ok, err := hdb.LatestHeight()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	writeHeight(t, hdb, 1, "a", "1", "b", "1")
+	writeHeight(t, hdb, 2, "a", "2", "b", "")
+	writeHeight(t, hdb, 2, "c", "2")
+
+	latest, ok, err := hdb.LatestHeight()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.EqualValues(t, 2, latest)
+
+	checkValue(t, hdb, bz("a"), bz("2"))
+	checkValue(t, hdb, bz("b"), nil)
+	checkValue(t, hdb, bz("c"), bz("2"))
+
+	// Metadata is not visible when iterating.
+	itr, err := hdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	var keys []string
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, string(itr.Key()))
+	}
+	require.NoError(t, itr.Close())
+	require.Equal(t, []string{"a", "c"}, keys)
+
+	// Heights must not decrease.
+	batch := hdb.HeightBatch(1)
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("a"), bz("x")))
+	require.Error(t, batch.Write())
+	checkValue(t, hdb, bz("a"), bz("2"))
+
+	require.NoError(t, batch.Close())
+	require.Equal(t, errBatchClosed, batch.Set(bz("a"), bz("x")))
+}
+
+func TestHeightDBVerifyHeight(t *testing.T) {
+	mdb := NewMemDB()
+	hdb := NewHeightDB(mdb)
+	defer hdb.Close()
+
+	writeHeight(t, hdb, 1, "a", "1", "b", "1")
+	writeHeight(t, hdb, 2, "a", "2")
+	writeHeight(t, hdb, 2, "c", "2")
+
+	require.NoError(t, hdb.VerifyHeight(1))
+	require.NoError(t, hdb.VerifyHeight(2))
+	require.ErrorIs(t, hdb.VerifyHeight(3), ErrHeightNotFound)
+
+	// Losing or tampering with an entry of a height is detected.
+	record, err := hdb.heightRecord(1)
+	require.NoError(t, err)
+	require.NoError(t, mdb.Delete(uint64Key(heightChangePrefix, record.firstSeq+1)))
+	require.Error(t, hdb.VerifyHeight(1))
+
+	record, err = hdb.heightRecord(2)
+	require.NoError(t, err)
+	entry, err := hdb.changeEntry(record.firstSeq)
+	require.NoError(t, err)
+	entry.value = bz("tampered")
+	require.NoError(t, mdb.Set(uint64Key(heightChangePrefix, record.firstSeq), entry.encode()))
+	require.Error(t, hdb.VerifyHeight(2))
+}
+
+func TestHeightDBPruneBelow(t *testing.T) {
+	mdb := NewMemDB()
+	hdb := NewHeightDB(mdb)
+	defer hdb.Close()
+
+	writeHeight(t, hdb, 1, "a", "1", "b", "1", "c", "1")
+	writeHeight(t, hdb, 2, "b", "2")
+	writeHeight(t, hdb, 3, "c", "3", "d", "3")
+
+	pruned, err := hdb.PruneBelow(3)
+	require.NoError(t, err)
+	require.Equal(t, 2, pruned)
+
+	// Keys last written below height 3 are gone, while c was written again at height 3.
+	checkValue(t, hdb, bz("a"), nil)
+	checkValue(t, hdb, bz("b"), nil)
+	checkValue(t, hdb, bz("c"), bz("3"))
+	checkValue(t, hdb, bz("d"), bz("3"))
+
+	require.ErrorIs(t, hdb.VerifyHeight(1), ErrHeightNotFound)
+	require.ErrorIs(t, hdb.VerifyHeight(2), ErrHeightNotFound)
+	require.NoError(t, hdb.VerifyHeight(3))
+
+	// Only the metadata of height 3 is left.
+	record, err := hdb.heightRecord(3)
+	require.NoError(t, err)
+	itr, err := mdb.Iterator(heightChangePrefix, cpIncr(heightChangePrefix))
+	require.NoError(t, err)
+	defer itr.Close()
+	count := 0
+	for ; itr.Valid(); itr.Next() {
+		count++
+	}
+	require.EqualValues(t, record.count, count)
+
+	pruned, err = hdb.PruneBelow(3)
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+}
+
+func TestEscapeKey(t *testing.T) {
+	keys := [][]byte{{0x00}, {0x00, 0x00}, {0x00, 0x01}, {0x01}, {0x01, 0x00}, {0xFF}}
+	for i := 1; i < len(keys); i++ {
+		require.Negative(t, bytes.Compare(escapeKey(keys[i-1]), escapeKey(keys[i])))
+		require.False(t, bytes.HasPrefix(escapeKey(keys[i]), escapeKey(keys[i-1])))
+	}
+}
+
+func TestHeightDBRollbackTo(t *testing.T) {
+	hdb := NewHeightDB(NewMemDB())
+	defer hdb.Close()
+
+	writeHeight(t, hdb, 1, "a", "1", "b", "1")
+	writeHeight(t, hdb, 2, "a", "2", "b", "", "c", "2")
+	writeHeight(t, hdb, 3, "c", "3", "c", "", "d", "3")
+
+	require.NoError(t, hdb.RollbackTo(2))
+	checkValue(t, hdb, bz("a"), bz("2"))
+	checkValue(t, hdb, bz("b"), nil)
+	checkValue(t, hdb, bz("c"), bz("2"))
+	checkValue(t, hdb, bz("d"), nil)
+	require.ErrorIs(t, hdb.VerifyHeight(3), ErrHeightNotFound)
+
+	require.NoError(t, hdb.RollbackTo(1))
+	checkValue(t, hdb, bz("a"), bz("1"))
+	checkValue(t, hdb, bz("b"), bz("1"))
+	checkValue(t, hdb, bz("c"), nil)
+
+	latest, ok, err := hdb.LatestHeight()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.EqualValues(t, 1, latest)
+
+	// Rolling back to a later height is a no-op.
+	require.NoError(t, hdb.RollbackTo(5))
+	checkValue(t, hdb, bz("a"), bz("1"))
+
+	// Heights can be written again after a rollback.
+	writeHeight(t, hdb, 2, "a", "x")
+	require.NoError(t, hdb.VerifyHeight(1))
+	require.NoError(t, hdb.VerifyHeight(2))
+	checkValue(t, hdb, bz("a"), bz("x"))
+
+	require.NoError(t, hdb.RollbackTo(0))
+	itr, err := hdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	require.False(t, itr.Valid())
+	_, ok, err = hdb.LatestHeight()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestHeightDBViewAt(t *testing.T) {
+	hdb := NewHeightDB(NewMemDB())
+	defer hdb.Close()
+
+	writeHeight(t, hdb, 1, "a", "1", "b", "1")
+	writeHeight(t, hdb, 2, "a", "2", "b", "", "c", "2")
+	writeHeight(t, hdb, 4, "c", "4", "c", "", "d", "4", "a", "4")
+
+	collect := func(itr Iterator) []string {
+		t.Helper()
+		defer itr.Close()
+		var kvs []string
+		for ; itr.Valid(); itr.Next() {
+			kvs = append(kvs, string(itr.Key())+"="+string(itr.Value()))
+		}
+		require.NoError(t, itr.Error())
+		return kvs
+	}
+
+	testcases := []struct {
+		height uint64
+		expect []string
+	}{
+		{0, nil},
+		{1, []string{"a=1", "b=1"}},
+		{2, []string{"a=2", "c=2"}},
+		{3, []string{"a=2", "c=2"}},
+		{4, []string{"a=4", "d=4"}},
+		{5, []string{"a=4", "d=4"}},
+	}
+	views := make([]DBReader, len(testcases))
+	for i, tc := range testcases {
+		view, err := hdb.ViewAt(tc.height)
+		require.NoError(t, err)
+		views[i] = view
+	}
+
+	// Views remain consistent when the store is written to afterwards.
+	writeHeight(t, hdb, 5, "a", "5", "e", "5")
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("height %d", tc.height), func(t *testing.T) {
+			view := views[i]
+			itr, err := view.Iterator(nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, collect(itr))
+
+			itr, err = view.ReverseIterator(nil, nil)
+			require.NoError(t, err)
+			var reversed []string
+			for j := len(tc.expect) - 1; j >= 0; j-- {
+				reversed = append(reversed, tc.expect[j])
+			}
+			require.Equal(t, reversed, collect(itr))
+
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				var expect []byte
+				for _, kv := range tc.expect {
+					if kv[:1] == key {
+						expect = bz(kv[2:])
+					}
+				}
+				checkValue(t, view, bz(key), expect)
+			}
+		})
+	}
+
+	view, err := hdb.ViewAt(2)
+	require.NoError(t, err)
+	itr, err := view.Iterator(bz("b"), bz("d"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"c=2"}, collect(itr))
+
+	_, err = hdb.PruneBelow(2)
+	require.NoError(t, err)
+	_, err = hdb.ViewAt(1)
+	require.ErrorIs(t, err, ErrHeightPruned)
+	view, err = hdb.ViewAt(2)
+	require.NoError(t, err)
+	checkValue(t, view, bz("a"), bz("2"))
+}
@@ -0,0 +1,277 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// heightDBView is a read-only view of a HeightDB at a height. Writes with a sequence number of at
+// least seq were made after that height, and are reverted on the fly using the previous values
+// recorded in the changelog.
+type heightDBView struct {
+	hdb *HeightDB
+	seq uint64
+}
+
+var _ DBReader = (*heightDBView)(nil)
+
+// ViewAt returns a read-only view of the store as it was at the given height, i.e. containing all
+// writes made at that height or below, and none of the later ones. The view remains consistent while
+// the store is written to, so historical queries can be served directly from it. Heights which were
+// pruned return ErrHeightPruned.
+//
+// Reads through the view are slower the more writes were made after the height, since they are
+// reverted on every read.
+func (hdb *HeightDB) ViewAt(height uint64) (DBReader, error) {
+	hdb.mtx.RLock()
+	defer hdb.mtx.RUnlock()
+
+	pruned, err := hdb.prunedBelow()
+	if err != nil {
+		return nil, err
+	}
+	if height < pruned {
+		return nil, fmt.Errorf("%w: height %d is below %d", ErrHeightPruned, height, pruned)
+	}
+
+	// Sequence numbers grow with heights, so the writes made after height are the ones starting at
+	// the first sequence number of the next recorded height, if any.
+	seq, err := hdb.nextSeq()
+	if err != nil {
+		return nil, err
+	}
+	if height < math.MaxUint64 {
+		itr, err := hdb.db.Iterator(uint64Key(heightRecordPrefix, height+1), cpIncr(heightRecordPrefix))
+		if err != nil {
+			return nil, err
+		}
+		defer itr.Close()
+		if itr.Valid() {
+			record, err := decodeHeightRecord(itr.Value())
+			if err != nil {
+				return nil, err
+			}
+			seq = record.firstSeq
+		}
+		if err := itr.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return &heightDBView{hdb: hdb, seq: seq}, nil
+}
+
+// Get implements DBReader.
+func (v *heightDBView) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	v.hdb.mtx.RLock()
+	defer v.hdb.mtx.RUnlock()
+
+	// The first write to key made after the height recorded the value the key had at the height.
+	prefix := keyIndexPrefix(key)
+	itr, err := v.hdb.db.Iterator(uint64Key(prefix, v.seq), cpIncr(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	if !itr.Valid() {
+		if err := itr.Error(); err != nil {
+			return nil, err
+		}
+		return v.hdb.data.Get(key)
+	}
+	entry, err := v.hdb.changeEntry(binary.BigEndian.Uint64(itr.Key()[len(prefix):]))
+	if err != nil {
+		return nil, err
+	}
+	return entry.prev, nil
+}
+
+// Has implements DBReader.
+func (v *heightDBView) Has(key []byte) (bool, error) {
+	value, err := v.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Iterator implements DBReader.
+func (v *heightDBView) Iterator(start, end []byte) (Iterator, error) {
+	return v.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DBReader.
+func (v *heightDBView) ReverseIterator(start, end []byte) (Iterator, error) {
+	return v.newIterator(start, end, true)
+}
+
+func (v *heightDBView) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	v.hdb.mtx.RLock()
+	defer v.hdb.mtx.RUnlock()
+
+	// Collect the values at the height of all keys in the domain written after it, and merge them
+	// with the current data. Both are read under the lock, so they are consistent with each other.
+	overlay, err := v.overlay(start, end)
+	if err != nil {
+		return nil, err
+	}
+	var source Iterator
+	if isReverse {
+		source, err = v.hdb.data.ReverseIterator(start, end)
+	} else {
+		source, err = v.hdb.data.Iterator(start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isReverse {
+		for i, j := 0, len(overlay)-1; i < j; i, j = i+1, j-1 {
+			overlay[i], overlay[j] = overlay[j], overlay[i]
+		}
+	}
+	itr := &heightDBViewIterator{
+		source:    source,
+		overlay:   overlay,
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+	}
+	itr.advance()
+	return itr, nil
+}
+
+// overlay returns the values at the view's height of the keys in the given domain that were written
+// after it, sorted by key. Keys which did not exist have a nil value.
+func (v *heightDBView) overlay(start, end []byte) ([]operation, error) {
+	itr, err := v.hdb.db.Iterator(uint64Key(heightChangePrefix, v.seq), cpIncr(heightChangePrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+
+	seen := make(map[string]bool)
+	overlay := []operation{}
+	for ; itr.Valid(); itr.Next() {
+		entry, err := decodeChangeEntry(cp(itr.Value()))
+		if err != nil {
+			return nil, err
+		}
+		if seen[string(entry.key)] || !IsKeyInDomain(entry.key, start, end) {
+			continue
+		}
+		seen[string(entry.key)] = true
+		// Entries are decoded from a copy of the value, so they can be retained.
+		overlay = append(overlay, operation{key: entry.key, value: entry.prev})
+	}
+	if err := itr.Error(); err != nil {
+		return nil, err
+	}
+	sort.Slice(overlay, func(i, j int) bool {
+		return bytes.Compare(overlay[i].key, overlay[j].key) < 0
+	})
+	return overlay, nil
+}
+
+// heightDBViewIterator merges the current data with the overlay of values at the view's height,
+// giving precedence to the overlay.
+type heightDBViewIterator struct {
+	source    Iterator
+	overlay   []operation
+	start     []byte
+	end       []byte
+	isReverse bool
+	key       []byte
+	value     []byte
+	err       error
+}
+
+var _ Iterator = (*heightDBViewIterator)(nil)
+
+// before returns whether a comes before b in iteration order.
+func (itr *heightDBViewIterator) before(a, b []byte) bool {
+	if itr.isReverse {
+		return bytes.Compare(a, b) > 0
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// advance moves to the next key with a value, or invalidates the iterator.
+func (itr *heightDBViewIterator) advance() {
+	for {
+		itr.key, itr.value = nil, nil
+		sourceValid := itr.source.Valid()
+		if !sourceValid {
+			if err := itr.source.Error(); err != nil {
+				itr.err = err
+				return
+			}
+		}
+		switch {
+		case len(itr.overlay) > 0 && (!sourceValid || !itr.before(itr.source.Key(), itr.overlay[0].key)):
+			if sourceValid && bytes.Equal(itr.source.Key(), itr.overlay[0].key) {
+				itr.source.Next()
+			}
+			itr.key, itr.value = itr.overlay[0].key, itr.overlay[0].value
+			itr.overlay = itr.overlay[1:]
+			if itr.value == nil {
+				continue
+			}
+		case sourceValid:
+			itr.key, itr.value = cp(itr.source.Key()), cp(itr.source.Value())
+			itr.source.Next()
+		}
+		return
+	}
+}
+
+// Domain implements Iterator.
+func (itr *heightDBViewIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *heightDBViewIterator) Valid() bool {
+	return itr.err == nil && itr.key != nil
+}
+
+// Key implements Iterator.
+func (itr *heightDBViewIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.key
+}
+
+// Value implements Iterator.
+func (itr *heightDBViewIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.value
+}
+
+// Next implements Iterator.
+func (itr *heightDBViewIterator) Next() {
+	itr.assertIsValid()
+	itr.advance()
+}
+
+// Error implements Iterator.
+func (itr *heightDBViewIterator) Error() error {
+	return itr.err
+}
+
+// Close implements Iterator.
+func (itr *heightDBViewIterator) Close() error {
+	return itr.source.Close()
+}
+
+func (itr *heightDBViewIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BatchOp is a single operation of a batch passed to commit hooks. The value is nil for deletes.
+type BatchOp struct {
+	Op    WriteOp
+	Key   []byte
+	Value []byte
+}
+
+// PreCommitHook is called before a batch is written, with the operations of the batch in order and
+// the underlying batch. Additional operations written to the batch, e.g. changelog entries or
+// secondary index updates, are committed atomically with it. Returning an error aborts the write.
+// CONTRACT: ops readonly
+type PreCommitHook func(ops []BatchOp, batch Batch) error
+
+// PostCommitHook is called after a batch has been written successfully, e.g. to publish events or
+// invalidate caches. It cannot fail the write.
+// CONTRACT: ops readonly
+type PostCommitHook func(ops []BatchOp)
+
+// HookError is returned when a PreCommitHook aborts a write.
+type HookError struct {
+	Err error
+}
+
+// Error implements error.
+func (e *HookError) Error() string {
+	return fmt.Sprintf("pre-commit hook aborted write: %v", e.Err)
+}
+
+// Unwrap returns the error reported by the hook.
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// HookDB wraps a database and runs registered hooks whenever a batch is written. Single writes
+// such as Set and Delete are written as batches of one operation, so hooks see every write.
+//
+// Pre-commit hooks run in registration order, and the first error aborts the write, leaving the
+// batch unwritten but open. Post-commit hooks run in registration order after a successful write.
+type HookDB struct {
+	mtx  sync.RWMutex
+	db   DB
+	pre  []PreCommitHook
+	post []PostCommitHook
+}
+
+var _ DB = (*HookDB)(nil)
+
+// NewHookDB wraps db.
+func NewHookDB(db DB) *HookDB {
+	return &HookDB{
+		db: db,
+	}
+}
+
+// RegisterPreCommitHook adds a hook which is run before every write, after all previously
+// registered ones.
+func (hdb *HookDB) RegisterPreCommitHook(hook PreCommitHook) {
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+
+	hdb.pre = append(hdb.pre, hook)
+}
+
+// RegisterPostCommitHook adds a hook which is run after every successful write, after all
+// previously registered ones.
+func (hdb *HookDB) RegisterPostCommitHook(hook PostCommitHook) {
+	hdb.mtx.Lock()
+	defer hdb.mtx.Unlock()
+
+	hdb.post = append(hdb.post, hook)
+}
+
+// hooks returns the registered hooks.
+func (hdb *HookDB) hooks() ([]PreCommitHook, []PostCommitHook) {
+	hdb.mtx.RLock()
+	defer hdb.mtx.RUnlock()
+
+	return hdb.pre, hdb.post
+}
+
+// Get implements DB.
+func (hdb *HookDB) Get(key []byte) ([]byte, error) {
+	return hdb.db.Get(key)
+}
+
+// Has implements DB.
+func (hdb *HookDB) Has(key []byte) (bool, error) {
+	return hdb.db.Has(key)
+}
+
+// Set implements DB.
+func (hdb *HookDB) Set(key []byte, value []byte) error {
+	return hdb.writeOne(BatchOp{Op: WriteOpSet, Key: key, Value: value}, false)
+}
+
+// SetSync implements DB.
+func (hdb *HookDB) SetSync(key []byte, value []byte) error {
+	return hdb.writeOne(BatchOp{Op: WriteOpSet, Key: key, Value: value}, true)
+}
+
+// Delete implements DB.
+func (hdb *HookDB) Delete(key []byte) error {
+	return hdb.writeOne(BatchOp{Op: WriteOpDelete, Key: key}, false)
+}
+
+// DeleteSync implements DB.
+func (hdb *HookDB) DeleteSync(key []byte) error {
+	return hdb.writeOne(BatchOp{Op: WriteOpDelete, Key: key}, true)
+}
+
+// writeOne writes a single operation as a batch.
+func (hdb *HookDB) writeOne(op BatchOp, sync bool) error {
+	batch := hdb.NewBatch()
+	defer batch.Close()
+
+	var err error
+	if op.Op == WriteOpSet {
+		err = batch.Set(op.Key, op.Value)
+	} else {
+		err = batch.Delete(op.Key)
+	}
+	if err != nil {
+		return err
+	}
+	if sync {
+		return batch.WriteSync()
+	}
+	return batch.Write()
+}
+
+// Iterator implements DB.
+func (hdb *HookDB) Iterator(start, end []byte) (Iterator, error) {
+	return hdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (hdb *HookDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return hdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (hdb *HookDB) Close() error {
+	return hdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (hdb *HookDB) NewBatch() Batch {
+	return &hookDBBatch{
+		hdb: hdb,
+		ops: []BatchOp{},
+	}
+}
+
+// Print implements DB.
+func (hdb *HookDB) Print() error {
+	return hdb.db.Print()
+}
+
+// Stats implements DB.
+func (hdb *HookDB) Stats() map[string]string {
+	return hdb.db.Stats()
+}
+
+// Compact implements DB.
+func (hdb *HookDB) Compact(start, end []byte) error {
+	return hdb.db.Compact(start, end)
+}
+
+// hookDBBatch buffers the operations of a batch, so that they can be passed to the hooks before
+// being written to an underlying batch.
+type hookDBBatch struct {
+	hdb     *HookDB
+	ops     []BatchOp
+	size    int       // of the keys and values of ops
+	written []BatchOp // the new ops once written, used by Reset
+}
+
+var _ Batch = (*hookDBBatch)(nil)
+
+// Set implements Batch.
+func (b *hookDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, BatchOp{Op: WriteOpSet, Key: key, Value: value})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *hookDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, BatchOp{Op: WriteOpDelete, Key: key})
+	return nil
+}
+
+// Count implements Batch.
+func (b *hookDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *hookDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *hookDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *hookDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *hookDBBatch) write(sync bool) error {
+	if b.ops == nil {
+		return errBatchClosed
+	}
+	pre, post := b.hdb.hooks()
+
+	batch := newAtomicBatch(b.hdb.db)
+	defer batch.Close()
+	for _, op := range b.ops {
+		var err error
+		if op.Op == WriteOpSet {
+			err = batch.Set(op.Key, op.Value)
+		} else {
+			err = batch.Delete(op.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, hook := range pre {
+		if err := hook(b.ops, batch); err != nil {
+			return &HookError{Err: err}
+		}
+	}
+
+	var err error
+	if sync {
+		err = batch.WriteSync()
+	} else {
+		err = batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	for _, hook := range post {
+		hook(b.ops)
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors. Hooks may retain the written ops, so they are not reused.
+	b.ops, b.size, b.written = nil, 0, []BatchOp{}
+	return nil
+}
+
+// Reset implements Batch.
+func (b *hookDBBatch) Reset() error {
+	if b.ops == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.ops, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *hookDBBatch) Close() error {
+	b.ops, b.size, b.written = nil, 0, nil
+	return nil
+}
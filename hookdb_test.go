@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookDBHooks(t *testing.T) {
+	hdb := NewHookDB(NewMemDB())
+	defer hdb.Close()
+
+	// Maintain a secondary index of values, and record the committed writes.
+	hdb.RegisterPreCommitHook(func(ops []BatchOp, batch Batch) error {
+		for _, op := range ops {
+			if op.Op == WriteOpSet {
+				if err := batch.Set(append(bz("idx/"), op.Value...), op.Key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	var committed []string
+	hdb.RegisterPostCommitHook(func(ops []BatchOp) {
+		for _, op := range ops {
+			committed = append(committed, op.Op.String()+" "+string(op.Key))
+		}
+	})
+
+	batch := hdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("a"), bz("1")))
+	require.NoError(t, batch.Delete(bz("b")))
+	require.Empty(t, committed)
+	require.NoError(t, batch.Write())
+	require.Equal(t, errBatchClosed, batch.Write())
+
+	require.NoError(t, hdb.SetSync(bz("c"), bz("2")))
+	require.NoError(t, hdb.Delete(bz("c")))
+
+	checkValue(t, hdb, bz("idx/1"), bz("a"))
+	checkValue(t, hdb, bz("idx/2"), bz("c"))
+	require.Equal(t, []string{"set a", "delete b", "set c", "delete c"}, committed)
+}
+
+func TestHookDBPreCommitHookAborts(t *testing.T) {
+	errAbort := errors.New("abort")
+	hdb := NewHookDB(NewMemDB())
+	defer hdb.Close()
+
+	calls := 0
+	hdb.RegisterPreCommitHook(func(_ []BatchOp, batch Batch) error {
+		calls++
+		return batch.Set(bz("extra"), bz("1"))
+	})
+	hdb.RegisterPreCommitHook(func(ops []BatchOp, _ Batch) error {
+		if string(ops[0].Key) == "bad" {
+			return errAbort
+		}
+		return nil
+	})
+	hdb.RegisterPostCommitHook(func([]BatchOp) {
+		t.Fatal("post-commit hook called for aborted write")
+	})
+
+	err := hdb.Set(bz("bad"), bz("1"))
+	var herr *HookError
+	require.True(t, errors.As(err, &herr))
+	require.ErrorIs(t, err, errAbort)
+	require.Equal(t, 1, calls)
+
+	// Nothing was written, including the operations added by earlier hooks.
+	checkValue(t, hdb, bz("bad"), nil)
+	checkValue(t, hdb, bz("extra"), nil)
+
+	// The batch remains open after an aborted write.
+	batch := hdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("bad"), bz("1")))
+	require.ErrorIs(t, batch.Write(), errAbort)
+	require.ErrorIs(t, batch.Write(), errAbort)
+	require.Equal(t, errKeyEmpty, hdb.Set(nil, bz("1")))
+}
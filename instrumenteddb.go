@@ -0,0 +1,349 @@
+package db
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DBOperation identifies a database operation in metrics.
+type DBOperation string
+
+// These are the operations observed by InstrumentedDB. OpCheck is only bounded by DeadlineDB.
+const (
+	OpGet             DBOperation = "get"
+	OpHas             DBOperation = "has"
+	OpSet             DBOperation = "set"
+	OpSetSync         DBOperation = "set_sync"
+	OpDelete          DBOperation = "delete"
+	OpDeleteSync      DBOperation = "delete_sync"
+	OpIterator        DBOperation = "iterator"
+	OpReverseIterator DBOperation = "reverse_iterator"
+	OpIteratorNext    DBOperation = "iterator_next"
+	OpBatchWrite      DBOperation = "batch_write"
+	OpBatchWriteSync  DBOperation = "batch_write_sync"
+	OpCompact         DBOperation = "compact"
+	OpCheck           DBOperation = "check"
+)
+
+// MetricsSink receives the measurements of an InstrumentedDB. Its methods are called
+// synchronously from the database operations, so they must be fast and concurrency-safe.
+type MetricsSink interface {
+	// ObserveOperation records the duration of an operation, and the error it failed with if any.
+	ObserveOperation(op DBOperation, duration time.Duration, err error)
+	// ObserveValueSize records the size in bytes of the values read or written by an operation.
+	// For batch writes, it is the total size of the keys and values in the batch.
+	ObserveValueSize(op DBOperation, size int)
+}
+
+// InstrumentedDB wraps a database of any backend, and reports the duration of its operations and
+// the sizes of the values read and written to a MetricsSink.
+type InstrumentedDB struct {
+	db      DB
+	metrics MetricsSink
+	clock   Clock
+}
+
+var _ DB = (*InstrumentedDB)(nil)
+
+// NewInstrumentedDB wraps db, reporting its measurements to metrics.
+func NewInstrumentedDB(db DB, metrics MetricsSink) *InstrumentedDB {
+	return &InstrumentedDB{
+		db:      db,
+		metrics: metrics,
+		clock:   SystemClock,
+	}
+}
+
+// observe reports an operation which started at start.
+func (idb *InstrumentedDB) observe(op DBOperation, start time.Time, err error) {
+	idb.metrics.ObserveOperation(op, idb.clock.Now().Sub(start), err)
+}
+
+// Get implements DB.
+func (idb *InstrumentedDB) Get(key []byte) ([]byte, error) {
+	start := idb.clock.Now()
+	value, err := idb.db.Get(key)
+	idb.observe(OpGet, start, err)
+	if value != nil {
+		idb.metrics.ObserveValueSize(OpGet, len(value))
+	}
+	return value, err
+}
+
+// Has implements DB.
+func (idb *InstrumentedDB) Has(key []byte) (bool, error) {
+	start := idb.clock.Now()
+	ok, err := idb.db.Has(key)
+	idb.observe(OpHas, start, err)
+	return ok, err
+}
+
+// Set implements DB.
+func (idb *InstrumentedDB) Set(key []byte, value []byte) error {
+	start := idb.clock.Now()
+	err := idb.db.Set(key, value)
+	idb.observe(OpSet, start, err)
+	if err == nil {
+		idb.metrics.ObserveValueSize(OpSet, len(value))
+	}
+	return err
+}
+
+// SetSync implements DB.
+func (idb *InstrumentedDB) SetSync(key []byte, value []byte) error {
+	start := idb.clock.Now()
+	err := idb.db.SetSync(key, value)
+	idb.observe(OpSetSync, start, err)
+	if err == nil {
+		idb.metrics.ObserveValueSize(OpSetSync, len(value))
+	}
+	return err
+}
+
+// Delete implements DB.
+func (idb *InstrumentedDB) Delete(key []byte) error {
+	start := idb.clock.Now()
+	err := idb.db.Delete(key)
+	idb.observe(OpDelete, start, err)
+	return err
+}
+
+// DeleteSync implements DB.
+func (idb *InstrumentedDB) DeleteSync(key []byte) error {
+	start := idb.clock.Now()
+	err := idb.db.DeleteSync(key)
+	idb.observe(OpDeleteSync, start, err)
+	return err
+}
+
+// Iterator implements DB.
+func (idb *InstrumentedDB) Iterator(start, end []byte) (Iterator, error) {
+	begin := idb.clock.Now()
+	itr, err := idb.db.Iterator(start, end)
+	idb.observe(OpIterator, begin, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedDBIterator{idb: idb, source: itr}, nil
+}
+
+// ReverseIterator implements DB.
+func (idb *InstrumentedDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	begin := idb.clock.Now()
+	itr, err := idb.db.ReverseIterator(start, end)
+	idb.observe(OpReverseIterator, begin, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedDBIterator{idb: idb, source: itr}, nil
+}
+
+// Close implements DB.
+func (idb *InstrumentedDB) Close() error {
+	return idb.db.Close()
+}
+
+// NewBatch implements DB.
+func (idb *InstrumentedDB) NewBatch() Batch {
+	return &instrumentedDBBatch{
+		idb:   idb,
+		batch: idb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (idb *InstrumentedDB) Print() error {
+	return idb.db.Print()
+}
+
+// Stats implements DB.
+func (idb *InstrumentedDB) Stats() map[string]string {
+	return idb.db.Stats()
+}
+
+// Compact implements DB.
+func (idb *InstrumentedDB) Compact(start, end []byte) error {
+	begin := idb.clock.Now()
+	err := idb.db.Compact(start, end)
+	idb.observe(OpCompact, begin, err)
+	return err
+}
+
+// instrumentedDBIterator reports the duration of each step of an iterator.
+type instrumentedDBIterator struct {
+	idb    *InstrumentedDB
+	source Iterator
+}
+
+var _ Iterator = (*instrumentedDBIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *instrumentedDBIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *instrumentedDBIterator) Valid() bool {
+	return itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *instrumentedDBIterator) Next() {
+	start := itr.idb.clock.Now()
+	itr.source.Next()
+	itr.idb.observe(OpIteratorNext, start, nil)
+}
+
+// Key implements Iterator.
+func (itr *instrumentedDBIterator) Key() []byte {
+	return itr.source.Key()
+}
+
+// Value implements Iterator.
+func (itr *instrumentedDBIterator) Value() []byte {
+	return itr.source.Value()
+}
+
+// Error implements Iterator.
+func (itr *instrumentedDBIterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *instrumentedDBIterator) Close() error {
+	return itr.source.Close()
+}
+
+// instrumentedDBBatch reports the duration and size of batch writes.
+type instrumentedDBBatch struct {
+	idb   *InstrumentedDB
+	batch Batch
+	size  int
+}
+
+var _ Batch = (*instrumentedDBBatch)(nil)
+
+// Set implements Batch.
+func (b *instrumentedDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete implements Batch.
+func (b *instrumentedDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.size += len(key)
+	return nil
+}
+
+// Count implements Batch.
+func (b *instrumentedDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *instrumentedDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *instrumentedDBBatch) Write() error {
+	return b.write(OpBatchWrite, b.batch.Write)
+}
+
+// WriteSync implements Batch.
+func (b *instrumentedDBBatch) WriteSync() error {
+	return b.write(OpBatchWriteSync, b.batch.WriteSync)
+}
+
+func (b *instrumentedDBBatch) write(op DBOperation, write func() error) error {
+	start := b.idb.clock.Now()
+	err := write()
+	b.idb.observe(op, start, err)
+	if err == nil {
+		b.idb.metrics.ObserveValueSize(op, b.size)
+	}
+	return err
+}
+
+// Reset implements Batch.
+func (b *instrumentedDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	b.size = 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *instrumentedDBBatch) Close() error {
+	return b.batch.Close()
+}
+
+// PrometheusMetricsSink records the measurements of an InstrumentedDB in Prometheus histograms of
+// operation durations and value sizes, and a counter of failed operations, all labeled by
+// operation.
+type PrometheusMetricsSink struct {
+	durations  *prometheus.HistogramVec
+	valueSizes *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+}
+
+var _ MetricsSink = (*PrometheusMetricsSink)(nil)
+
+// NewPrometheusMetricsSink creates a sink for the database with the given name, whose metrics are
+// in the storage subsystem of the given namespace and carry a "db" label with the name, and
+// registers them with reg. Sinks of several databases can be registered with the same registry.
+func NewPrometheusMetricsSink(namespace, name string, reg prometheus.Registerer) (*PrometheusMetricsSink, error) {
+	labels := prometheus.Labels{"db": name}
+	s := &PrometheusMetricsSink{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "storage",
+			Name:        "operation_duration_seconds",
+			Help:        "Duration of database operations, by operation.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"operation"}),
+		valueSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "storage",
+			Name:        "value_size_bytes",
+			Help:        "Size of the values read and written by database operations, by operation.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(16, 4, 10),
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "storage",
+			Name:        "operation_errors_total",
+			Help:        "Number of failed database operations, by operation.",
+			ConstLabels: labels,
+		}, []string{"operation"}),
+	}
+	for _, c := range []prometheus.Collector{s.durations, s.valueSizes, s.errors} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ObserveOperation implements MetricsSink.
+func (s *PrometheusMetricsSink) ObserveOperation(op DBOperation, duration time.Duration, err error) {
+	s.durations.WithLabelValues(string(op)).Observe(duration.Seconds())
+	if err != nil {
+		s.errors.WithLabelValues(string(op)).Inc()
+	}
+}
+
+// ObserveValueSize implements MetricsSink.
+func (s *PrometheusMetricsSink) ObserveValueSize(op DBOperation, size int) {
+	s.valueSizes.WithLabelValues(string(op)).Observe(float64(size))
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetricsSink records the measurements it receives.
+type recordingMetricsSink struct {
+	mtx       sync.Mutex
+	durations map[DBOperation][]time.Duration
+	errors    map[DBOperation]int
+	sizes     map[DBOperation][]int
+}
+
+func newRecordingMetricsSink() *recordingMetricsSink {
+	return &recordingMetricsSink{
+		durations: map[DBOperation][]time.Duration{},
+		errors:    map[DBOperation]int{},
+		sizes:     map[DBOperation][]int{},
+	}
+}
+
+func (s *recordingMetricsSink) ObserveOperation(op DBOperation, duration time.Duration, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.durations[op] = append(s.durations[op], duration)
+	if err != nil {
+		s.errors[op]++
+	}
+}
+
+func (s *recordingMetricsSink) ObserveValueSize(op DBOperation, size int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.sizes[op] = append(s.sizes[op], size)
+}
+
+// slowClockDB advances a manual clock on every write, to simulate slow operations.
+type slowClockDB struct {
+	*MemDB
+	clock *clocktest.ManualClock
+	delay time.Duration
+}
+
+func (db *slowClockDB) Set(key, value []byte) error {
+	db.clock.Advance(db.delay)
+	return db.MemDB.Set(key, value)
+}
+
+func TestInstrumentedDB(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	sink := newRecordingMetricsSink()
+	idb := NewInstrumentedDB(&slowClockDB{MemDB: NewMemDB(), clock: clock, delay: time.Second}, sink)
+	idb.clock = clock
+	defer idb.Close()
+
+	require.NoError(t, idb.Set(bz("a"), bz("value")))
+	require.NoError(t, idb.Set(bz("b"), bz("v")))
+	checkValue(t, idb, bz("a"), bz("value"))
+	checkValue(t, idb, bz("c"), nil)
+	require.Error(t, idb.Delete(nil))
+
+	batch := idb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("c"), bz("12345")))
+	require.NoError(t, batch.Delete(bz("b")))
+	require.NoError(t, batch.WriteSync())
+
+	itr, err := idb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, bz("a"), bz("value"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, bz("c"), bz("12345"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	require.Equal(t, []time.Duration{time.Second, time.Second}, sink.durations[OpSet])
+	require.Equal(t, []int{5, 1}, sink.sizes[OpSet])
+	require.Len(t, sink.durations[OpGet], 2)
+	require.Equal(t, []int{5}, sink.sizes[OpGet])
+	require.Equal(t, 1, sink.errors[OpDelete])
+	require.Equal(t, []int{7}, sink.sizes[OpBatchWriteSync])
+	require.Len(t, sink.durations[OpIterator], 1)
+	require.Len(t, sink.durations[OpIteratorNext], 2)
+}
+
+func TestPrometheusMetricsSink(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewPrometheusMetricsSink("test", "state", reg)
+	require.NoError(t, err)
+	_, err = NewPrometheusMetricsSink("test", "blockstore", reg)
+	require.NoError(t, err)
+
+	idb := NewInstrumentedDB(NewMemDB(), sink)
+	require.NoError(t, idb.Set(bz("a"), bz("value")))
+	require.Error(t, idb.Set(nil, bz("value")))
+	checkValue(t, idb, bz("a"), bz("value"))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, f := range families {
+		names[f.GetName()] = true
+		if f.GetName() == "test_storage_operation_errors_total" {
+			require.Len(t, f.GetMetric(), 1)
+			require.EqualValues(t, 1, f.GetMetric()[0].GetCounter().GetValue())
+		}
+	}
+	require.Equal(t, map[string]bool{
+		"test_storage_operation_duration_seconds": true,
+		"test_storage_value_size_bytes":           true,
+		"test_storage_operation_errors_total":     true,
+	}, names)
+}
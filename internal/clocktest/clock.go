@@ -0,0 +1,72 @@
+// Package clocktest provides the manual clock used by the tests of the db package, and exported
+// by dbtest.
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// ManualClock is a clock which only moves when advanced, so that code measuring durations or
+// waiting for timers can be tested deterministically. It satisfies the db.Clock interface.
+type ManualClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+type manualTimer struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewManualClock creates a clock set to the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the clock's time once it has been advanced by at least d.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, manualTimer{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Timers returns the number of timers waiting for the clock to be advanced, which allows tests to
+// wait until the code under test is blocked on the clock.
+func (c *ManualClock) Timers() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.timers)
+}
+
+// Advance moves the clock forward by d, firing all timers whose deadline has passed.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			timers = append(timers, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = timers
+}
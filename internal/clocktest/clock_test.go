@@ -0,0 +1,34 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	require.Equal(t, start, clock.Now())
+
+	immediate := clock.After(0)
+	require.Equal(t, start, <-immediate)
+
+	second := clock.After(time.Second)
+	minute := clock.After(time.Minute)
+	require.Equal(t, 2, clock.Timers())
+
+	clock.Advance(500 * time.Millisecond)
+	require.Len(t, second, 0)
+
+	clock.Advance(500 * time.Millisecond)
+	require.Equal(t, start.Add(time.Second), <-second)
+	require.Len(t, minute, 0)
+	require.Equal(t, 1, clock.Timers())
+
+	clock.Advance(time.Hour)
+	require.Equal(t, start.Add(time.Hour+time.Second), <-minute)
+	require.Equal(t, 0, clock.Timers())
+	require.Equal(t, start.Add(time.Hour+time.Second), clock.Now())
+}
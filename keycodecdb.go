@@ -0,0 +1,387 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// KeyCodec is a reversible transformation of keys, applied by a KeyCodecDB before keys reach the
+// underlying database.
+type KeyCodec interface {
+	// EncodeKey returns the key stored in the underlying database for key, which must not be
+	// empty. Distinct keys must have distinct encodings.
+	EncodeKey(key []byte) ([]byte, error)
+	// DecodeKey returns the key whose encoding is encoded.
+	DecodeKey(encoded []byte) ([]byte, error)
+}
+
+// KeyCodecDB wraps a database, transforming keys with a KeyCodec, so that stores can keep using
+// their keys on top of a different key layout, e.g. a legacy one.
+//
+// Iterator bounds are encoded, and iterators yield keys in the order of their encodings: if the
+// codec preserves the order of keys, iteration behaves as usual, otherwise iterators yield the
+// keys whose encodings are within the encoded bounds.
+type KeyCodecDB struct {
+	db    DB
+	codec KeyCodec
+}
+
+var _ DB = (*KeyCodecDB)(nil)
+
+// NewKeyCodecDB wraps db, transforming keys with codec.
+func NewKeyCodecDB(db DB, codec KeyCodec) *KeyCodecDB {
+	return &KeyCodecDB{
+		db:    db,
+		codec: codec,
+	}
+}
+
+// encode encodes a key, which must not be empty.
+func (kdb *KeyCodecDB) encode(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	encoded, err := kdb.codec.EncodeKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encoding key %X: %w", key, err)
+	}
+	return encoded, nil
+}
+
+// encodeBound encodes an iterator bound, which may be nil.
+func (kdb *KeyCodecDB) encodeBound(key []byte) ([]byte, error) {
+	if key == nil {
+		return nil, nil
+	}
+	return kdb.encode(key)
+}
+
+// Get implements DB.
+func (kdb *KeyCodecDB) Get(key []byte) ([]byte, error) {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return nil, err
+	}
+	return kdb.db.Get(encoded)
+}
+
+// Has implements DB.
+func (kdb *KeyCodecDB) Has(key []byte) (bool, error) {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return false, err
+	}
+	return kdb.db.Has(encoded)
+}
+
+// Set implements DB.
+func (kdb *KeyCodecDB) Set(key []byte, value []byte) error {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return kdb.db.Set(encoded, value)
+}
+
+// SetSync implements DB.
+func (kdb *KeyCodecDB) SetSync(key []byte, value []byte) error {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return kdb.db.SetSync(encoded, value)
+}
+
+// Delete implements DB.
+func (kdb *KeyCodecDB) Delete(key []byte) error {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return kdb.db.Delete(encoded)
+}
+
+// DeleteSync implements DB.
+func (kdb *KeyCodecDB) DeleteSync(key []byte) error {
+	encoded, err := kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return kdb.db.DeleteSync(encoded)
+}
+
+// Iterator implements DB.
+func (kdb *KeyCodecDB) Iterator(start, end []byte) (Iterator, error) {
+	return kdb.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (kdb *KeyCodecDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return kdb.newIterator(start, end, true)
+}
+
+func (kdb *KeyCodecDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	estart, err := kdb.encodeBound(start)
+	if err != nil {
+		return nil, err
+	}
+	eend, err := kdb.encodeBound(end)
+	if err != nil {
+		return nil, err
+	}
+	var source Iterator
+	if isReverse {
+		source, err = kdb.db.ReverseIterator(estart, eend)
+	} else {
+		source, err = kdb.db.Iterator(estart, eend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	itr := &keyCodecDBIterator{
+		codec:  kdb.codec,
+		source: source,
+		start:  start,
+		end:    end,
+	}
+	itr.decode()
+	return itr, nil
+}
+
+// Close implements DB.
+func (kdb *KeyCodecDB) Close() error {
+	return kdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (kdb *KeyCodecDB) NewBatch() Batch {
+	return &keyCodecDBBatch{
+		kdb:   kdb,
+		batch: kdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (kdb *KeyCodecDB) Print() error {
+	itr, err := kdb.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		key := itr.Key()
+		value := itr.Value()
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return itr.Error()
+}
+
+// Stats implements DB.
+func (kdb *KeyCodecDB) Stats() map[string]string {
+	return kdb.db.Stats()
+}
+
+// Compact implements DB.
+func (kdb *KeyCodecDB) Compact(start, end []byte) error {
+	estart, err := kdb.encodeBound(start)
+	if err != nil {
+		return err
+	}
+	eend, err := kdb.encodeBound(end)
+	if err != nil {
+		return err
+	}
+	return kdb.db.Compact(estart, eend)
+}
+
+// keyCodecDBIterator decodes the keys of the underlying iterator.
+type keyCodecDBIterator struct {
+	codec  KeyCodec
+	source Iterator
+	start  []byte
+	end    []byte
+	key    []byte
+	err    error
+}
+
+var _ Iterator = (*keyCodecDBIterator)(nil)
+
+// decode decodes the current key of the underlying iterator.
+func (itr *keyCodecDBIterator) decode() {
+	itr.key = nil
+	if !itr.source.Valid() {
+		return
+	}
+	key, err := itr.codec.DecodeKey(itr.source.Key())
+	if err != nil {
+		itr.err = fmt.Errorf("decoding key %X: %w", itr.source.Key(), err)
+		return
+	}
+	itr.key = key
+}
+
+// Domain implements Iterator.
+func (itr *keyCodecDBIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *keyCodecDBIterator) Valid() bool {
+	return itr.err == nil && itr.key != nil && itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *keyCodecDBIterator) Next() {
+	itr.assertIsValid()
+	itr.source.Next()
+	itr.decode()
+}
+
+// Key implements Iterator.
+func (itr *keyCodecDBIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.key
+}
+
+// Value implements Iterator.
+func (itr *keyCodecDBIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.source.Value()
+}
+
+// Error implements Iterator.
+func (itr *keyCodecDBIterator) Error() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *keyCodecDBIterator) Close() error {
+	return itr.source.Close()
+}
+
+func (itr *keyCodecDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
+
+// keyCodecDBBatch encodes the keys of batch operations.
+type keyCodecDBBatch struct {
+	kdb   *KeyCodecDB
+	batch Batch
+}
+
+var _ Batch = (*keyCodecDBBatch)(nil)
+
+// Set implements Batch.
+func (b *keyCodecDBBatch) Set(key, value []byte) error {
+	encoded, err := b.kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return b.batch.Set(encoded, value)
+}
+
+// Delete implements Batch.
+func (b *keyCodecDBBatch) Delete(key []byte) error {
+	encoded, err := b.kdb.encode(key)
+	if err != nil {
+		return err
+	}
+	return b.batch.Delete(encoded)
+}
+
+// Count implements Batch.
+func (b *keyCodecDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *keyCodecDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *keyCodecDBBatch) Write() error {
+	return b.batch.Write()
+}
+
+// WriteSync implements Batch.
+func (b *keyCodecDBBatch) WriteSync() error {
+	return b.batch.WriteSync()
+}
+
+// Reset implements Batch.
+func (b *keyCodecDBBatch) Reset() error {
+	return b.batch.Reset()
+}
+
+// Close implements Batch.
+func (b *keyCodecDBBatch) Close() error {
+	return b.batch.Close()
+}
+
+// EscapeKeyCodec escapes 0x00 bytes of keys, and terminates them with 0x00 0x01, so that no
+// encoded key is a prefix of another. It preserves the order of keys, and allows concatenating
+// encoded keys into composite keys which sort by their components.
+type EscapeKeyCodec struct{}
+
+var _ KeyCodec = EscapeKeyCodec{}
+
+// EncodeKey implements KeyCodec.
+func (EscapeKeyCodec) EncodeKey(key []byte) ([]byte, error) {
+	return escapeKey(key), nil
+}
+
+// DecodeKey implements KeyCodec.
+func (EscapeKeyCodec) DecodeKey(encoded []byte) ([]byte, error) {
+	if !bytes.HasSuffix(encoded, []byte{0x00, 0x01}) {
+		return nil, fmt.Errorf("unterminated escaped key %X", encoded)
+	}
+	return unescapeKey(encoded), nil
+}
+
+// HeightKeyCodec packs the decimal heights of keys made of a prefix followed by a height, such as
+// "H:42", into 8 big-endian bytes, so that they sort by height and take a fixed size. Keys
+// without the prefix are left unchanged.
+type HeightKeyCodec struct {
+	Prefix []byte
+}
+
+var _ KeyCodec = HeightKeyCodec{}
+
+// EncodeKey implements KeyCodec.
+func (c HeightKeyCodec) EncodeKey(key []byte) ([]byte, error) {
+	if !bytes.HasPrefix(key, c.Prefix) {
+		return key, nil
+	}
+	height, err := strconv.ParseUint(string(key[len(c.Prefix):]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid height: %w", err)
+	}
+	// Leading zeros are rejected, as the key could not be decoded back.
+	if strconv.FormatUint(height, 10) != string(key[len(c.Prefix):]) {
+		return nil, fmt.Errorf("invalid height %q", key[len(c.Prefix):])
+	}
+	return uint64Key(c.Prefix, height), nil
+}
+
+// DecodeKey implements KeyCodec.
+func (c HeightKeyCodec) DecodeKey(encoded []byte) ([]byte, error) {
+	if !bytes.HasPrefix(encoded, c.Prefix) {
+		return encoded, nil
+	}
+	if len(encoded) != len(c.Prefix)+8 {
+		return nil, fmt.Errorf("invalid packed height %X", encoded[len(c.Prefix):])
+	}
+	height := binary.BigEndian.Uint64(encoded[len(c.Prefix):])
+	return strconv.AppendUint(cp(c.Prefix), height, 10), nil
+}
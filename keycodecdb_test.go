@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCodecDBHeightKeys(t *testing.T) {
+	mem := NewMemDB()
+	kdb := NewKeyCodecDB(mem, HeightKeyCodec{Prefix: bz("H:")})
+	defer kdb.Close()
+
+	for _, key := range []string{"H:9", "H:10", "H:100", "other"} {
+		require.NoError(t, kdb.Set(bz(key), bz(key)))
+	}
+	batch := kdb.NewBatch()
+	require.NoError(t, batch.Set(bz("H:11"), bz("H:11")))
+	require.NoError(t, batch.Delete(bz("H:100")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+
+	// Heights are stored packed, and read back as written.
+	checkValue(t, mem, uint64Key(bz("H:"), 10), bz("H:10"))
+	checkValue(t, mem, bz("other"), bz("other"))
+	checkValue(t, kdb, bz("H:9"), bz("H:9"))
+	checkValue(t, kdb, bz("H:100"), nil)
+
+	// Iteration follows the packed order, i.e. heights sort numerically.
+	itr, err := kdb.Iterator(bz("H:9"), bz("H:11"))
+	require.NoError(t, err)
+	checkItem(t, itr, bz("H:9"), bz("H:9"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, bz("H:10"), bz("H:10"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	itr, err = kdb.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	var keys []string
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, string(itr.Key()))
+	}
+	require.NoError(t, itr.Close())
+	require.Equal(t, []string{"other", "H:11", "H:10", "H:9"}, keys)
+
+	// Keys with an invalid height fail.
+	require.Error(t, kdb.Set(bz("H:x"), bz("x")))
+	require.Error(t, kdb.Set(bz("H:09"), bz("x")))
+	_, err = kdb.Get(nil)
+	require.Equal(t, errKeyEmpty, err)
+
+	// Stored keys which cannot be decoded fail iteration.
+	require.NoError(t, mem.Set(bz("H:bad"), bz("x")))
+	itr, err = kdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	for ; itr.Valid(); itr.Next() {
+	}
+	require.Error(t, itr.Error())
+	require.NoError(t, itr.Close())
+}
+
+func TestKeyCodecDBEscapeKeys(t *testing.T) {
+	mem := NewMemDB()
+	kdb := NewKeyCodecDB(mem, EscapeKeyCodec{})
+	defer kdb.Close()
+
+	for _, key := range []string{"a", "a\x00", "a\x00b", "b"} {
+		require.NoError(t, kdb.Set(bz(key), bz(key)))
+	}
+	checkValue(t, mem, bz("a\x00\xffb\x00\x01"), bz("a\x00b"))
+
+	itr, err := kdb.Iterator(bz("a\x00"), bz("b"))
+	require.NoError(t, err)
+	checkItem(t, itr, bz("a\x00"), bz("a\x00"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, bz("a\x00b"), bz("a\x00b"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	_, err = EscapeKeyCodec{}.DecodeKey(bz("a"))
+	require.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ErrMigrationDiverged is returned by LiveMigrationDB.Run when the target does not match the
+// source after the backfill, so that the migration was not cut over.
+var ErrMigrationDiverged = errors.New("migration target diverges from source")
+
+// LiveMigrationPhase is the phase of a LiveMigrationDB.
+type LiveMigrationPhase string
+
+// These are the phases of a LiveMigrationDB, in order.
+const (
+	// LiveMigrationMirroring mirrors writes to the target, until Run is called.
+	LiveMigrationMirroring LiveMigrationPhase = "mirroring"
+	// LiveMigrationBackfilling copies the existing data of the source to the target.
+	LiveMigrationBackfilling LiveMigrationPhase = "backfilling"
+	// LiveMigrationVerifying compares the source and the target.
+	LiveMigrationVerifying LiveMigrationPhase = "verifying"
+	// LiveMigrationCutOver serves all operations from the target.
+	LiveMigrationCutOver LiveMigrationPhase = "cut-over"
+	// LiveMigrationFailed keeps serving reads from the source and mirroring writes after Run
+	// failed, so that it can be run again.
+	LiveMigrationFailed LiveMigrationPhase = "failed"
+)
+
+// LiveMigrationConfig configures a LiveMigrationDB. Zero values are replaced by defaults.
+type LiveMigrationConfig struct {
+	// Rate is the maximum number of keys backfilled and verified per second, to bound the impact
+	// of the migration on the node. Defaults to no limit.
+	Rate float64
+	// Progress, if set, is called after every chunk of 1000 keys backfilled or verified, with the
+	// current phase and the number of keys processed in it so far.
+	Progress func(phase LiveMigrationPhase, keys uint64)
+	// Logger, if set, logs divergences and phase changes.
+	Logger Logger
+	// Clock is the clock used for rate limiting. Defaults to SystemClock.
+	Clock Clock
+}
+
+// LiveMigrationDB migrates a running process from a source database to a target database, e.g.
+// from goleveldb to pebble, without downtime. It is used as the database handle of the process
+// throughout the migration: it mirrors writes to both databases and serves reads from the source
+// (see MirrorDB) until Run has backfilled the existing data to the target with rate limiting,
+// verified that both match, and atomically switched all operations to the target.
+//
+// Operations started before the cut-over complete against the source, and writes in flight are
+// still mirrored, so the target misses none of them. Iterators and batches created before the
+// cut-over keep using the source and the mirror respectively. After the cut-over, the source is
+// no longer written to, and is only closed by Close.
+type LiveMigrationDB struct {
+	mirror *MirrorDB
+	target DB
+	cfg    LiveMigrationConfig
+
+	mtx    sync.RWMutex
+	active DB
+	phase  LiveMigrationPhase
+	runs   bool
+}
+
+var _ DB = (*LiveMigrationDB)(nil)
+
+// NewLiveMigrationDB wraps source and starts mirroring its writes to target, which should be
+// empty. Call Run to backfill, verify and cut over.
+func NewLiveMigrationDB(source, target DB, cfg LiveMigrationConfig) *LiveMigrationDB {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	mirror := NewMirrorDB(source, target)
+	if cfg.Logger != nil {
+		mirror.SetLogger(cfg.Logger)
+	}
+	return &LiveMigrationDB{
+		mirror: mirror,
+		target: target,
+		cfg:    cfg,
+		active: mirror,
+		phase:  LiveMigrationMirroring,
+	}
+}
+
+// Phase returns the current phase of the migration.
+func (ldb *LiveMigrationDB) Phase() LiveMigrationPhase {
+	ldb.mtx.RLock()
+	defer ldb.mtx.RUnlock()
+	return ldb.phase
+}
+
+// current returns the database serving operations.
+func (ldb *LiveMigrationDB) current() DB {
+	ldb.mtx.RLock()
+	defer ldb.mtx.RUnlock()
+	return ldb.active
+}
+
+// setPhase moves the migration to the given phase.
+func (ldb *LiveMigrationDB) setPhase(phase LiveMigrationPhase) {
+	ldb.mtx.Lock()
+	ldb.phase = phase
+	ldb.mtx.Unlock()
+	if ldb.cfg.Logger != nil {
+		ldb.cfg.Logger.Info("live migration", "phase", string(phase))
+	}
+}
+
+// Run backfills the target with the data of the source, verifies that they match, and cuts over
+// to the target. It blocks until done, so it is usually run in a goroutine while the process
+// keeps using the database. If it fails, e.g. as ctx was canceled or the databases diverge, with
+// ErrMigrationDiverged, the migration is left in the failed phase, still mirroring writes, and Run
+// can be called again, which restarts the backfill from scratch. The backfill does not delete keys
+// of the target, e.g. left by failed mirrored deletes, so a migration which keeps diverging must be
+// restarted with an empty target.
+func (ldb *LiveMigrationDB) Run(ctx context.Context) error {
+	ldb.mtx.Lock()
+	switch {
+	case ldb.phase == LiveMigrationCutOver:
+		ldb.mtx.Unlock()
+		return errors.New("migration already cut over")
+	case ldb.runs:
+		ldb.mtx.Unlock()
+		return errors.New("migration already running")
+	}
+	ldb.runs = true
+	ldb.mtx.Unlock()
+	defer func() {
+		ldb.mtx.Lock()
+		ldb.runs = false
+		ldb.mtx.Unlock()
+	}()
+
+	if err := ldb.run(ctx); err != nil {
+		ldb.setPhase(LiveMigrationFailed)
+		return err
+	}
+	return nil
+}
+
+func (ldb *LiveMigrationDB) run(ctx context.Context) error {
+	limiter := newRateLimiter(ldb.cfg.Clock, ldb.cfg.Rate)
+	ldb.setPhase(LiveMigrationBackfilling)
+	err := ldb.forEachChunk(ctx, limiter, LiveMigrationBackfilling, func(next *[]byte) (int, bool, error) {
+		return ldb.mirror.backfillChunk(next, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("backfill failed: %w", err)
+	}
+
+	// Writes failing on the target from now on would not be caught by the verification.
+	divergences := ldb.mirror.Divergences()
+	ldb.setPhase(LiveMigrationVerifying)
+	var diverging int
+	err = ldb.forEachChunk(ctx, limiter, LiveMigrationVerifying, func(next *[]byte) (int, bool, error) {
+		n, d, done, err := ldb.mirror.verifyChunk(next, nil)
+		diverging += d
+		return n, done, err
+	})
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if diverging > 0 {
+		return fmt.Errorf("%w: %d keys differ", ErrMigrationDiverged, diverging)
+	}
+
+	// Holding the lock of the mirror waits for writes in flight, and the lock of the migration
+	// switches new operations to the target atomically.
+	ldb.mirror.mtx.Lock()
+	defer ldb.mirror.mtx.Unlock()
+	if n := ldb.mirror.divergences - divergences; n > 0 {
+		return fmt.Errorf("%w: %d writes failed on the target during verification", ErrMigrationDiverged, n)
+	}
+	ldb.mtx.Lock()
+	ldb.active = ldb.target
+	ldb.phase = LiveMigrationCutOver
+	ldb.mtx.Unlock()
+	if ldb.cfg.Logger != nil {
+		ldb.cfg.Logger.Info("live migration", "phase", string(LiveMigrationCutOver))
+	}
+	return nil
+}
+
+// forEachChunk calls chunk over the keyspace until it reports being done, with rate limiting,
+// and reports progress.
+func (ldb *LiveMigrationDB) forEachChunk(ctx context.Context, limiter *rateLimiter, phase LiveMigrationPhase,
+	chunk func(next *[]byte) (int, bool, error),
+) error {
+	var (
+		next []byte
+		keys uint64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, done, err := chunk(&next)
+		if err != nil {
+			return err
+		}
+		keys += uint64(n)
+		if ldb.cfg.Progress != nil {
+			ldb.cfg.Progress(phase, keys)
+		}
+		if done {
+			return nil
+		}
+		limiter.wait(n)
+	}
+}
+
+// Get implements DB.
+func (ldb *LiveMigrationDB) Get(key []byte) ([]byte, error) {
+	return ldb.current().Get(key)
+}
+
+// Has implements DB.
+func (ldb *LiveMigrationDB) Has(key []byte) (bool, error) {
+	return ldb.current().Has(key)
+}
+
+// Set implements DB.
+func (ldb *LiveMigrationDB) Set(key []byte, value []byte) error {
+	return ldb.current().Set(key, value)
+}
+
+// SetSync implements DB.
+func (ldb *LiveMigrationDB) SetSync(key []byte, value []byte) error {
+	return ldb.current().SetSync(key, value)
+}
+
+// Delete implements DB.
+func (ldb *LiveMigrationDB) Delete(key []byte) error {
+	return ldb.current().Delete(key)
+}
+
+// DeleteSync implements DB.
+func (ldb *LiveMigrationDB) DeleteSync(key []byte) error {
+	return ldb.current().DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (ldb *LiveMigrationDB) Iterator(start, end []byte) (Iterator, error) {
+	return ldb.current().Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (ldb *LiveMigrationDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return ldb.current().ReverseIterator(start, end)
+}
+
+// Close implements DB. It closes both databases.
+func (ldb *LiveMigrationDB) Close() error {
+	return ldb.mirror.Close()
+}
+
+// NewBatch implements DB.
+func (ldb *LiveMigrationDB) NewBatch() Batch {
+	return ldb.current().NewBatch()
+}
+
+// Print implements DB.
+func (ldb *LiveMigrationDB) Print() error {
+	return ldb.current().Print()
+}
+
+// Stats implements DB. It adds the phase of the migration, and the divergences found so far.
+func (ldb *LiveMigrationDB) Stats() map[string]string {
+	stats := ldb.current().Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	stats["migration.phase"] = string(ldb.Phase())
+	stats["migration.divergences"] = strconv.FormatUint(ldb.mirror.Divergences(), 10)
+	return stats
+}
+
+// Compact implements DB.
+func (ldb *LiveMigrationDB) Compact(start, end []byte) error {
+	return ldb.current().Compact(start, end)
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveMigrationDB(t *testing.T) {
+	source, target := NewMemDB(), NewMemDB()
+	for i := int64(0); i < 2*mirrorDBChunk+5; i++ {
+		require.NoError(t, source.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	var progress []uint64
+	ldb := NewLiveMigrationDB(source, target, LiveMigrationConfig{
+		Progress: func(phase LiveMigrationPhase, keys uint64) {
+			if phase == LiveMigrationBackfilling {
+				progress = append(progress, keys)
+			}
+		},
+	})
+	defer ldb.Close()
+	require.Equal(t, LiveMigrationMirroring, ldb.Phase())
+
+	// Writes are mirrored before the backfill.
+	require.NoError(t, ldb.Set(bz("a"), bz("1")))
+	require.NoError(t, ldb.Delete(int642Bytes(0)))
+	checkValue(t, target, bz("a"), bz("1"))
+
+	require.NoError(t, ldb.Run(context.Background()))
+	require.Equal(t, LiveMigrationCutOver, ldb.Phase())
+	require.Equal(t, []uint64{mirrorDBChunk, 2 * mirrorDBChunk, 2*mirrorDBChunk + 5}, progress)
+	checkValue(t, target, int642Bytes(2), int642Bytes(2))
+
+	// Operations are now served by the target only.
+	require.NoError(t, ldb.Set(bz("b"), bz("2")))
+	checkValue(t, target, bz("b"), bz("2"))
+	checkValue(t, source, bz("b"), nil)
+	require.NoError(t, source.Set(bz("c"), bz("3")))
+	checkValue(t, ldb, bz("c"), nil)
+	require.Equal(t, "cut-over", ldb.Stats()["migration.phase"])
+
+	require.ErrorContains(t, ldb.Run(context.Background()), "already cut over")
+}
+
+func TestLiveMigrationDBDiverged(t *testing.T) {
+	source, target := NewMemDB(), NewMemDB()
+	require.NoError(t, source.Set(bz("a"), bz("1")))
+	require.NoError(t, target.Set(bz("stale"), bz("x")))
+	ldb := NewLiveMigrationDB(source, target, LiveMigrationConfig{})
+	defer ldb.Close()
+
+	require.ErrorIs(t, ldb.Run(context.Background()), ErrMigrationDiverged)
+	require.Equal(t, LiveMigrationFailed, ldb.Phase())
+	// The source still serves reads, and writes are still mirrored.
+	checkValue(t, ldb, bz("stale"), nil)
+	require.NoError(t, ldb.Set(bz("b"), bz("2")))
+	checkValue(t, target, bz("b"), bz("2"))
+
+	// Once the target is fixed, the migration can be run again.
+	require.NoError(t, target.Delete(bz("stale")))
+	require.NoError(t, ldb.Run(context.Background()))
+	require.Equal(t, LiveMigrationCutOver, ldb.Phase())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ldb = NewLiveMigrationDB(NewMemDB(), NewMemDB(), LiveMigrationConfig{})
+	require.ErrorIs(t, ldb.Run(ctx), context.Canceled)
+	require.Equal(t, LiveMigrationFailed, ldb.Phase())
+}
+
+func TestLiveMigrationDBRate(t *testing.T) {
+	source := NewMemDB()
+	for i := int64(0); i < 2*mirrorDBChunk+5; i++ {
+		require.NoError(t, source.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	ldb := NewLiveMigrationDB(source, NewMemDB(), LiveMigrationConfig{Rate: mirrorDBChunk, Clock: clock})
+	defer ldb.Close()
+	done := make(chan error)
+	go func() {
+		done <- ldb.Run(context.Background())
+	}()
+
+	// Each full chunk of the backfill and the verification waits for a second, since the start.
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, LiveMigrationBackfilling, ldb.Phase())
+	for waits := 1; ; waits++ {
+		clock.Advance(2 * time.Second)
+		var err error
+		finished := false
+		require.Eventually(t, func() bool {
+			select {
+			case err = <-done:
+				finished = true
+				return true
+			default:
+				return clock.Timers() == 1
+			}
+		}, time.Second, time.Millisecond)
+		if finished {
+			require.NoError(t, err)
+			require.Equal(t, LiveMigrationCutOver, ldb.Phase())
+			return
+		}
+		require.Less(t, waits, 10)
+	}
+}
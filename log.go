@@ -0,0 +1,8 @@
+package db
+
+// Logger is the logging interface used by this package. It is satisfied by CometBFT's logger and
+// by *slog.Logger.
+type Logger interface {
+	Info(msg string, keyvals ...any)
+	Error(msg string, keyvals ...any)
+}
@@ -15,43 +15,100 @@ const (
 )
 
 func init() {
-	registerDBCreator(MemDBBackend, func(_, _ string) (DB, error) {
+	registerDBCreator(MemDBBackend, func(_, _ string, _ *dbOptions) (DB, error) {
 		return NewMemDB(), nil
 	})
 }
 
-// item is a btree.Item with byte slices as keys and values.
-type item struct {
+const (
+	// memDBArenaChunkSize is the size of the chunks of memory from which the keys and values of a
+	// MemDB are allocated.
+	memDBArenaChunkSize = 64 << 10
+	// memDBArenaMaxSize is the size above which keys and values are allocated on their own rather
+	// than from the chunks, so that large values do not waste the rest of a chunk.
+	memDBArenaMaxSize = memDBArenaChunkSize / 8
+	// memDBArenaSlack is the size of the dead keys and values the chunks may retain regardless of
+	// the size of the live ones, so that small databases are not compacted over and over.
+	memDBArenaSlack = 4 * memDBArenaChunkSize
+)
+
+// memDBItem is an entry of a MemDB. Items are stored by value in the B-tree, so that inserting
+// them does not allocate.
+type memDBItem struct {
 	key   []byte
 	value []byte
 }
 
-// Less implements btree.Item.
-func (i *item) Less(other btree.Item) bool {
-	// this considers nil == []byte{}, but that's ok since we handle nil endpoints
-	// in iterators specially anyway
-	return bytes.Compare(i.key, other.(*item).key) == -1
+// memDBItemLess orders items by key.
+func memDBItemLess(a, b memDBItem) bool {
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+// memDBArena allocates the keys and values set in a MemDB from large chunks of memory, so that
+// copying them does not allocate each time. A chunk is only released once none of the keys and
+// values it holds are referenced anymore, so a single live key can retain a whole chunk of
+// overwritten or deleted ones: the arena counts the size of the live and dead ones, for the
+// database to compact it once the dead ones retain more memory than the live ones.
+type memDBArena struct {
+	chunk     []byte
+	allocated int // size of the keys and values allocated from chunks
+	live      int // of those, the size of the ones still referenced by the database
+}
+
+// memDBArenaBacked returns whether b, returned by copy, was allocated from the chunks of an arena.
+// Larger keys and values are allocated on their own, and are left out of the counts of the arena.
+func memDBArenaBacked(b []byte) bool {
+	return len(b) <= memDBArenaMaxSize
 }
 
-// newKey creates a new key item.
-func newKey(key []byte) *item {
-	return &item{key: key}
+// copy returns a copy of b, which is never nil.
+func (a *memDBArena) copy(b []byte) []byte {
+	if !memDBArenaBacked(b) {
+		return bytes.Clone(b)
+	}
+	if cap(a.chunk)-len(a.chunk) < len(b) {
+		a.chunk = make([]byte, 0, memDBArenaChunkSize)
+	}
+	n := len(a.chunk)
+	a.chunk = append(a.chunk, b...)
+	a.allocated += len(b)
+	a.live += len(b)
+	return a.chunk[n:len(a.chunk):len(a.chunk)]
 }
 
-// newPair creates a new pair item.
-func newPair(key, value []byte) *item {
-	return &item{key: key, value: value}
+// free records that b, returned by copy, is no longer referenced by the database.
+func (a *memDBArena) free(b []byte) {
+	if memDBArenaBacked(b) {
+		a.live -= len(b)
+	}
+}
+
+// move returns b, returned by the copy of another arena, copied into this arena if it was
+// allocated from chunks, and b itself otherwise, as it retains no chunk.
+func (a *memDBArena) move(b []byte) []byte {
+	if !memDBArenaBacked(b) {
+		return b
+	}
+	return a.copy(b)
+}
+
+// needsCompaction returns whether the dead keys and values retain more memory than the live ones.
+func (a *memDBArena) needsCompaction() bool {
+	dead := a.allocated - a.live
+	return dead > memDBArenaSlack && dead > a.live
 }
 
 // MemDB is an in-memory database backend using a B-tree for storage.
 //
-// For performance reasons, all given and returned keys and values are pointers to the in-memory
-// database, so modifying them will cause the stored values to be modified as well. All DB methods
-// already specify that keys and values should be considered read-only, but this is especially
-// important with MemDB.
+// Keys and values are copied when set, into chunks of memory shared by many of them. For
+// performance reasons, returned keys and values are pointers to the in-memory database, so
+// modifying them will cause the stored values to be modified as well. All DB methods already
+// specify that keys and values should be considered read-only, but this is especially important
+// with MemDB.
 type MemDB struct {
 	mtx   sync.RWMutex
-	btree *btree.BTree
+	btree *btree.BTreeG[memDBItem]
+	arena memDBArena
 }
 
 var _ DB = (*MemDB)(nil)
@@ -59,7 +116,7 @@ var _ DB = (*MemDB)(nil)
 // NewMemDB creates a new in-memory database.
 func NewMemDB() *MemDB {
 	database := &MemDB{
-		btree: btree.New(bTreeDegree),
+		btree: btree.NewG(bTreeDegree, memDBItemLess),
 	}
 	return database
 }
@@ -72,13 +129,29 @@ func (db *MemDB) Get(key []byte) ([]byte, error) {
 	db.mtx.RLock()
 	defer db.mtx.RUnlock()
 
-	i := db.btree.Get(newKey(key))
-	if i != nil {
-		return i.(*item).value, nil
+	if i, ok := db.btree.Get(memDBItem{key: key}); ok {
+		return i.value, nil
 	}
 	return nil, nil
 }
 
+var _ GetAppender = (*MemDB)(nil)
+
+// GetAppend implements GetAppender.
+func (db *MemDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	if len(key) == 0 {
+		return dst, false, errKeyEmpty
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	i, ok := db.btree.Get(memDBItem{key: key})
+	if !ok {
+		return dst, false, nil
+	}
+	return append(dst, i.value...), true, nil
+}
+
 // Has implements DB.
 func (db *MemDB) Has(key []byte) (bool, error) {
 	if len(key) == 0 {
@@ -87,7 +160,7 @@ func (db *MemDB) Has(key []byte) (bool, error) {
 	db.mtx.RLock()
 	defer db.mtx.RUnlock()
 
-	return db.btree.Has(newKey(key)), nil
+	return db.btree.Has(memDBItem{key: key}), nil
 }
 
 // Set implements DB.
@@ -107,7 +180,11 @@ func (db *MemDB) Set(key []byte, value []byte) error {
 
 // set sets a value without locking the mutex.
 func (db *MemDB) set(key []byte, value []byte) {
-	db.btree.ReplaceOrInsert(newPair(key, value))
+	if old, ok := db.btree.ReplaceOrInsert(memDBItem{key: db.arena.copy(key), value: db.arena.copy(value)}); ok {
+		db.arena.free(old.key)
+		db.arena.free(old.value)
+		db.compactArena()
+	}
 }
 
 // SetSync implements DB.
@@ -129,7 +206,32 @@ func (db *MemDB) Delete(key []byte) error {
 
 // delete deletes a key without locking the mutex.
 func (db *MemDB) delete(key []byte) {
-	db.btree.Delete(newKey(key))
+	if old, ok := db.btree.Delete(memDBItem{key: key}); ok {
+		db.arena.free(old.key)
+		db.arena.free(old.value)
+		db.compactArena()
+	}
+}
+
+// compactArena copies the live keys and values allocated from chunks into new chunks once the dead
+// ones retain more memory than the live ones, so that the old chunks can be released. Larger keys
+// and values are kept as they are. Its cost is amortized over
+// the writes which made the keys and values dead. Keys and values returned earlier remain valid,
+// as they are never modified.
+func (db *MemDB) compactArena() {
+	if !db.arena.needsCompaction() {
+		return
+	}
+	var arena memDBArena
+	items := make([]memDBItem, 0, db.btree.Len())
+	db.btree.Ascend(func(i memDBItem) bool {
+		items = append(items, memDBItem{key: arena.move(i.key), value: arena.move(i.value)})
+		return true
+	})
+	for _, i := range items {
+		db.btree.ReplaceOrInsert(i)
+	}
+	db.arena = arena
 }
 
 // DeleteSync implements DB.
@@ -149,12 +251,8 @@ func (db *MemDB) Print() error {
 	db.mtx.RLock()
 	defer db.mtx.RUnlock()
 
-	db.btree.Ascend(func(i btree.Item) bool {
-		item, ok := i.(*item)
-		if !ok {
-			return false // or handle the error as appropriate
-		}
-		fmt.Printf("[%X]:\t[%X]\n", item.key, item.value)
+	db.btree.Ascend(func(i memDBItem) bool {
+		fmt.Printf("[%X]:\t[%X]\n", i.key, i.value)
 		return true
 	})
 	return nil
@@ -214,3 +312,58 @@ func (*MemDB) Compact(_, _ []byte) error {
 	// No Compaction is supported for memDB and there is no point in supporting compaction for a memory DB
 	return nil
 }
+
+// Clone returns an independent copy of the database in constant time. The copies share the
+// B-tree nodes of the database, which are copied lazily when either copy is written to, so forking
+// a large state, e.g. for a simulation, is cheap. Like writes, cloning waits for open iterators to
+// be closed.
+func (db *MemDB) Clone() *MemDB {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	// The clone gets its own arena, as both databases keep appending to theirs, but shares the
+	// keys and values allocated so far, so it starts with the same counts.
+	return &MemDB{
+		btree: db.btree.Clone(),
+		arena: memDBArena{allocated: db.arena.allocated, live: db.arena.live},
+	}
+}
+
+// MemDBSnapshot is a read-only, consistent view of a MemDB at the time the snapshot was taken.
+// Writes to the database made afterwards are not visible through the snapshot.
+type MemDBSnapshot struct {
+	db *MemDB
+}
+
+var _ DBReader = (*MemDBSnapshot)(nil)
+
+// NewSnapshot takes a snapshot of the database in constant time, see Clone.
+func (db *MemDB) NewSnapshot() *MemDBSnapshot {
+	return &MemDBSnapshot{db: db.Clone()}
+}
+
+// Get implements DBReader.
+func (s *MemDBSnapshot) Get(key []byte) ([]byte, error) {
+	return s.db.Get(key)
+}
+
+// Has implements DBReader.
+func (s *MemDBSnapshot) Has(key []byte) (bool, error) {
+	return s.db.Has(key)
+}
+
+// Iterator implements DBReader.
+func (s *MemDBSnapshot) Iterator(start, end []byte) (Iterator, error) {
+	return s.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DBReader.
+func (s *MemDBSnapshot) ReverseIterator(start, end []byte) (Iterator, error) {
+	return s.db.ReverseIterator(start, end)
+}
+
+// Close implements the same method as GoLevelDBSnapshot.Close. It is a no-op, since the snapshot
+// holds no resources other than memory, which is released once the snapshot is unreachable.
+func (*MemDBSnapshot) Close() error {
+	return nil
+}
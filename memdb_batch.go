@@ -18,8 +18,10 @@ type operation struct {
 
 // memDBBatch handles in-memory batching.
 type memDBBatch struct {
-	db  *MemDB
-	ops []operation
+	db      *MemDB
+	ops     []operation
+	size    int         // of the keys and values of ops
+	written []operation // the cleared ops once written, reused by Reset
 }
 
 var _ Batch = (*memDBBatch)(nil)
@@ -43,6 +45,7 @@ func (b *memDBBatch) Set(key, value []byte) error {
 	if b.ops == nil {
 		return errBatchClosed
 	}
+	b.size += len(key) + len(value)
 	b.ops = append(b.ops, operation{opTypeSet, key, value})
 	return nil
 }
@@ -55,10 +58,21 @@ func (b *memDBBatch) Delete(key []byte) error {
 	if b.ops == nil {
 		return errBatchClosed
 	}
+	b.size += len(key)
 	b.ops = append(b.ops, operation{opTypeDelete, key, nil})
 	return nil
 }
 
+// Count implements Batch.
+func (b *memDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *memDBBatch) SizeBytes() int {
+	return b.size
+}
+
 // Write implements Batch.
 func (b *memDBBatch) Write() error {
 	if b.ops == nil {
@@ -78,8 +92,11 @@ func (b *memDBBatch) Write() error {
 		}
 	}
 
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.ops, b.size, b.written = nil, 0, b.ops[:0]
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -87,8 +104,21 @@ func (b *memDBBatch) WriteSync() error {
 	return b.Write()
 }
 
+// Reset implements Batch.
+func (b *memDBBatch) Reset() error {
+	if b.ops == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.ops, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
 // Close implements Batch.
 func (b *memDBBatch) Close() error {
-	b.ops = nil
+	b.ops, b.size, b.written = nil, 0, nil
 	return nil
 }
@@ -1,9 +1,93 @@
 package db
 
 import (
+	"fmt"
+	"runtime"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
+func TestMemDBClone(t *testing.T) {
+	db := NewMemDB()
+	for i := int64(0); i < 1000; i++ {
+		require.NoError(t, db.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	snapshot := db.NewSnapshot()
+	defer snapshot.Close()
+	clone := db.Clone()
+
+	// Writes to the database and its clone are independent, and not visible in the snapshot.
+	require.NoError(t, db.Set(int642Bytes(1), bz("db")))
+	require.NoError(t, db.Delete(int642Bytes(2)))
+	require.NoError(t, clone.Set(int642Bytes(1), bz("clone")))
+	require.NoError(t, clone.Set(int642Bytes(1000), bz("clone")))
+
+	checkValue(t, db, int642Bytes(1), bz("db"))
+	checkValue(t, db, int642Bytes(1000), nil)
+	checkValue(t, clone, int642Bytes(1), bz("clone"))
+	checkValue(t, clone, int642Bytes(2), int642Bytes(2))
+	checkValue(t, snapshot, int642Bytes(1), int642Bytes(1))
+	checkValue(t, snapshot, int642Bytes(2), int642Bytes(2))
+	checkValue(t, snapshot, int642Bytes(1000), nil)
+
+	itr, err := snapshot.ReverseIterator(int642Bytes(997), nil)
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{999, 998, 997}, "snapshot reverse iterator")
+	require.NoError(t, itr.Close())
+	itr, err = clone.Iterator(int642Bytes(998), nil)
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{998, 999, 1000}, "clone iterator")
+	require.NoError(t, itr.Close())
+}
+
+func TestMemDBArenaRetention(t *testing.T) {
+	db := NewMemDB()
+	heapAlloc := func() uint64 {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+	before := heapAlloc()
+
+	// Every chunk holds a key which is never overwritten, which would keep alive the overwritten
+	// values of the whole chunk.
+	value := make([]byte, 1024)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set([]byte(fmt.Sprintf("cold%06d", i)), bz("1")))
+		for j := 0; j < 64; j++ {
+			require.NoError(t, db.Set([]byte(fmt.Sprintf("hot%02d", j%16)), value))
+		}
+	}
+	checkValue(t, db, bz("hot00"), value)
+	checkValue(t, db, bz("cold000999"), bz("1"))
+
+	// 64 MiB were written, for a live set of about 30 KiB.
+	require.LessOrEqual(t, db.arena.allocated-db.arena.live, max(db.arena.live, memDBArenaSlack))
+	require.Less(t, int64(heapAlloc())-int64(before), int64(4<<20))
+	runtime.KeepAlive(db)
+}
+
+func TestMemDBArenaLargeValues(t *testing.T) {
+	db := NewMemDB()
+	large := make([]byte, 2*memDBArenaMaxSize)
+	require.NoError(t, db.Set(bz("large"), large))
+	stored, err := db.Get(bz("large"))
+	require.NoError(t, err)
+
+	// Large values are not counted by the arena, nor moved by compactions.
+	value := make([]byte, 1024)
+	for i := 0; i < 2*memDBArenaSlack/len(value); i++ {
+		require.NoError(t, db.Set(bz("hot"), value))
+	}
+	require.Less(t, db.arena.allocated, 2*memDBArenaSlack, "the arena was not compacted")
+	require.Less(t, db.arena.live, len(large))
+	compacted, err := db.Get(bz("large"))
+	require.NoError(t, err)
+	require.Same(t, &stored[0], &compacted[0])
+}
+
 func BenchmarkMemDBRangeScans1M(b *testing.B) {
 	db := NewMemDB()
 	defer db.Close()
@@ -24,3 +108,52 @@ func BenchmarkMemDBRandomReadsWrites(b *testing.B) {
 
 	benchmarkRandomReadsWrites(b, db)
 }
+
+func BenchmarkMemDBSet(b *testing.B) {
+	db := NewMemDB()
+	value := []byte(randStr(100))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Set(int642Bytes(int64(i)), value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemDBGet(b *testing.B) {
+	db := NewMemDB()
+	for i := int64(0); i < 10000; i++ {
+		require.NoError(b, db.Set(int642Bytes(i), []byte(randStr(100))))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Get(int642Bytes(int64(i % 10000))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemDBIterator(b *testing.B) {
+	db := NewMemDB()
+	for i := int64(0); i < 10000; i++ {
+		require.NoError(b, db.Set(int642Bytes(i), []byte(randStr(100))))
+	}
+	for _, n := range []int64{1, 10, 1000} {
+		b.Run(fmt.Sprintf("entries=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				start := int64(i) % (10000 - n)
+				itr, err := db.Iterator(int642Bytes(start), int642Bytes(start+n))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for ; itr.Valid(); itr.Next() {
+					_ = itr.Value()
+				}
+				itr.Close()
+			}
+		})
+	}
+}
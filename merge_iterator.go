@@ -0,0 +1,113 @@
+package db
+
+import "bytes"
+
+// mergeIterator merges several iterators over the same domain and in the same direction into a
+// single ordered iterator. When several sources contain the same key, the value of the first one
+// is used and the others are skipped.
+type mergeIterator struct {
+	start     []byte
+	end       []byte
+	isReverse bool
+	sources   []Iterator
+	current   int // index of the source positioned at the current key, -1 when exhausted
+}
+
+var _ Iterator = (*mergeIterator)(nil)
+
+func newMergeIterator(start, end []byte, isReverse bool, sources ...Iterator) *mergeIterator {
+	itr := &mergeIterator{
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+		sources:   sources,
+	}
+	itr.current = itr.pick()
+	return itr
+}
+
+// before returns whether key a is iterated before key b.
+func (itr *mergeIterator) before(a, b []byte) bool {
+	if itr.isReverse {
+		return bytes.Compare(a, b) > 0
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// pick returns the index of the first source positioned at the next key, or -1 if all sources
+// are exhausted.
+func (itr *mergeIterator) pick() int {
+	current := -1
+	for i, source := range itr.sources {
+		if !source.Valid() {
+			continue
+		}
+		if current < 0 || itr.before(source.Key(), itr.sources[current].Key()) {
+			current = i
+		}
+	}
+	return current
+}
+
+// Domain implements Iterator.
+func (itr *mergeIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *mergeIterator) Valid() bool {
+	return itr.current >= 0 && itr.Error() == nil
+}
+
+// Next implements Iterator.
+func (itr *mergeIterator) Next() {
+	itr.assertIsValid()
+	// The current source is advanced last, since advancing it may invalidate its key.
+	key := itr.sources[itr.current].Key()
+	for i, source := range itr.sources {
+		if i != itr.current && source.Valid() && bytes.Equal(source.Key(), key) {
+			source.Next()
+		}
+	}
+	itr.sources[itr.current].Next()
+	itr.current = itr.pick()
+}
+
+// Key implements Iterator.
+func (itr *mergeIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.sources[itr.current].Key()
+}
+
+// Value implements Iterator.
+func (itr *mergeIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.sources[itr.current].Value()
+}
+
+// Error implements Iterator.
+func (itr *mergeIterator) Error() error {
+	for _, source := range itr.sources {
+		if err := source.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Iterator.
+func (itr *mergeIterator) Close() error {
+	var err error
+	for _, source := range itr.sources {
+		if cerr := source.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (itr *mergeIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
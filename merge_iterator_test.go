@@ -0,0 +1,50 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeIterator(t *testing.T) {
+	db1, db2 := NewMemDB(), NewMemDB()
+	for _, key := range []string{"a", "c", "e"} {
+		require.NoError(t, db1.Set(bz(key), bz("1")))
+	}
+	for _, key := range []string{"b", "c", "d"} {
+		require.NoError(t, db2.Set(bz(key), bz("2")))
+	}
+
+	for _, isReverse := range []bool{false, true} {
+		var itr1, itr2 Iterator
+		var err error
+		if isReverse {
+			itr1, err = db1.ReverseIterator(bz("b"), nil)
+			require.NoError(t, err)
+			itr2, err = db2.ReverseIterator(bz("b"), nil)
+			require.NoError(t, err)
+		} else {
+			itr1, err = db1.Iterator(bz("b"), nil)
+			require.NoError(t, err)
+			itr2, err = db2.Iterator(bz("b"), nil)
+			require.NoError(t, err)
+		}
+		itr := newMergeIterator(bz("b"), nil, isReverse, itr1, itr2)
+		checkDomain(t, itr, bz("b"), nil)
+
+		var got []string
+		for ; itr.Valid(); itr.Next() {
+			got = append(got, string(itr.Key())+"="+string(itr.Value()))
+		}
+		require.NoError(t, itr.Error())
+		checkInvalid(t, itr)
+		require.NoError(t, itr.Close())
+
+		// The first source takes precedence for c.
+		expect := []string{"b=2", "c=1", "d=2", "e=1"}
+		if isReverse {
+			expect = []string{"e=1", "d=2", "c=1", "b=2"}
+		}
+		require.Equal(t, expect, got)
+	}
+}
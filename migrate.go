@@ -0,0 +1,240 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+// defaultMigrateBatchSize is the number of items of the batches of a migration if none is given.
+const defaultMigrateBatchSize = 10000
+
+// ErrMigrateMismatch is returned when the destination of a migration does not hold the same items
+// as the source once copied, e.g. because it was not empty.
+var ErrMigrateMismatch = errors.New("migrated database does not match the source")
+
+// MigrateConfig configures Migrate. Zero values are replaced by defaults.
+type MigrateConfig struct {
+	// BatchSize is the number of items written per batch. Defaults to 10000.
+	BatchSize int
+	// CheckpointPath is the file recording the progress of the migration after every batch, from
+	// which an interrupted migration resumes. It is removed once the migration completes. If
+	// empty, migrations cannot be resumed.
+	CheckpointPath string
+	// Progress, if set, is called after every batch.
+	Progress func(MigrateResult)
+}
+
+// MigrateResult describes the items copied by a migration.
+type MigrateResult struct {
+	// Keys is the number of items copied.
+	Keys uint64
+	// Bytes is the size of the keys and values copied.
+	Bytes uint64
+	// Checksum is the SHA-256 of the length-prefixed keys and values, in order.
+	Checksum []byte
+	// Resumed is set if the migration resumed from a checkpoint.
+	Resumed bool
+}
+
+// migrateCheckpoint is the content of a checkpoint file. The checksum state is the marshaled state
+// of the hash of the items copied so far.
+type migrateCheckpoint struct {
+	NextKey       string `json:"next_key"` // hex encoded
+	Keys          uint64 `json:"keys"`
+	Bytes         uint64 `json:"bytes"`
+	ChecksumState string `json:"checksum_state"` // hex encoded
+}
+
+// Migrate copies all items of src to dst, e.g. to move a database to another backend, writing
+// them in synced batches. Once copied, dst is read back and must hold the same number of items
+// with the same checksum as src, or ErrMigrateMismatch is returned, so dst should be empty.
+//
+// If cfg.CheckpointPath is set, the migration records its progress there after every batch, and
+// a migration interrupted e.g. by a crash resumes from it. src must not be written to until the
+// migration completes.
+func Migrate(src, dst DB, cfg MigrateConfig) (MigrateResult, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultMigrateBatchSize
+	}
+	var (
+		result MigrateResult
+		start  []byte
+		sum    = sha256.New()
+	)
+	if cfg.CheckpointPath != "" {
+		checkpoint, err := readMigrateCheckpoint(cfg.CheckpointPath)
+		if err != nil {
+			return result, err
+		}
+		if checkpoint != nil {
+			if start, err = hex.DecodeString(checkpoint.NextKey); err != nil {
+				return result, fmt.Errorf("invalid checkpoint %s: %w", cfg.CheckpointPath, err)
+			}
+			state, err := hex.DecodeString(checkpoint.ChecksumState)
+			if err == nil {
+				err = sum.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+			}
+			if err != nil {
+				return result, fmt.Errorf("invalid checkpoint %s: %w", cfg.CheckpointPath, err)
+			}
+			result.Keys, result.Bytes, result.Resumed = checkpoint.Keys, checkpoint.Bytes, true
+		}
+	}
+
+	itr, err := src.Iterator(start, nil)
+	if err != nil {
+		return result, err
+	}
+	defer itr.Close()
+	batch := dst.NewBatch()
+	defer func() { batch.Close() }()
+	var (
+		batched int
+		lastKey []byte
+	)
+	flush := func() error {
+		if err := batch.WriteSync(); err != nil {
+			return err
+		}
+		if err := batch.Close(); err != nil {
+			return err
+		}
+		batch, batched = dst.NewBatch(), 0
+		if cfg.CheckpointPath != "" {
+			if err := writeMigrateCheckpoint(cfg.CheckpointPath, append(lastKey, 0x00), result, sum); err != nil {
+				return err
+			}
+		}
+		if cfg.Progress != nil {
+			cfg.Progress(result)
+		}
+		return nil
+	}
+	for ; itr.Valid(); itr.Next() {
+		key, value := itr.Key(), itr.Value()
+		if err := batch.Set(key, value); err != nil {
+			return result, err
+		}
+		addChecksum(sum, key, value)
+		result.Keys++
+		result.Bytes += uint64(len(key) + len(value))
+		lastKey = cp(key)
+		if batched++; batched >= cfg.BatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return result, err
+	}
+	if batched > 0 {
+		if err := flush(); err != nil {
+			return result, err
+		}
+	}
+	result.Checksum = sum.Sum(nil)
+
+	copied, err := checksumItems(dst)
+	if err != nil {
+		return result, err
+	}
+	if copied.Keys != result.Keys || copied.Bytes != result.Bytes || !bytes.Equal(copied.Checksum, result.Checksum) {
+		return result, fmt.Errorf("%w: copied %d keys (%d bytes), destination has %d keys (%d bytes)",
+			ErrMigrateMismatch, result.Keys, result.Bytes, copied.Keys, copied.Bytes)
+	}
+	if cfg.CheckpointPath != "" {
+		if err := os.Remove(cfg.CheckpointPath); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// addChecksum adds a key and a value to a checksum.
+func addChecksum(sum hash.Hash, key, value []byte) {
+	var length [binary.MaxVarintLen64]byte
+	sum.Write(length[:binary.PutUvarint(length[:], uint64(len(key)))])
+	sum.Write(key)
+	sum.Write(length[:binary.PutUvarint(length[:], uint64(len(value)))])
+	sum.Write(value)
+}
+
+// checksumItems returns the number, size and checksum of the items of db.
+func checksumItems(db DB) (MigrateResult, error) {
+	var result MigrateResult
+	itr, err := db.Iterator(nil, nil)
+	if err != nil {
+		return result, err
+	}
+	defer itr.Close()
+	sum := sha256.New()
+	for ; itr.Valid(); itr.Next() {
+		key, value := UnsafeKey(itr), UnsafeValue(itr)
+		addChecksum(sum, key, value)
+		result.Keys++
+		result.Bytes += uint64(len(key) + len(value))
+	}
+	if err := itr.Error(); err != nil {
+		return result, err
+	}
+	result.Checksum = sum.Sum(nil)
+	return result, nil
+}
+
+// readMigrateCheckpoint reads the checkpoint at path, if any.
+func readMigrateCheckpoint(path string) (*migrateCheckpoint, error) {
+	bz, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint migrateCheckpoint
+	if err := json.Unmarshal(bz, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// writeMigrateCheckpoint atomically replaces the checkpoint at path.
+func writeMigrateCheckpoint(path string, nextKey []byte, result MigrateResult, sum hash.Hash) error {
+	state, err := sum.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	bz, err := json.Marshal(migrateCheckpoint{
+		NextKey:       hex.EncodeToString(nextKey),
+		Keys:          result.Keys,
+		Bytes:         result.Bytes,
+		ChecksumState: hex.EncodeToString(state),
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bz); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
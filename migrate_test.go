@@ -0,0 +1,86 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	src := NewMemDB()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, src.Set(int642Bytes(int64(i)), int642Bytes(int64(i*i))))
+	}
+	dst, err := NewGoLevelDB("dst", t.TempDir())
+	require.NoError(t, err)
+	defer dst.Close()
+
+	var batches int
+	result, err := Migrate(src, dst, MigrateConfig{
+		BatchSize: 30,
+		Progress:  func(MigrateResult) { batches++ },
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 100, result.Keys)
+	require.EqualValues(t, 1600, result.Bytes)
+	require.False(t, result.Resumed)
+	require.Equal(t, 4, batches)
+	expected, err := checksumItems(src)
+	require.NoError(t, err)
+	require.Equal(t, expected.Checksum, result.Checksum)
+	checkValue(t, dst, int642Bytes(99), int642Bytes(99*99))
+
+	// A destination which is not empty does not match.
+	require.NoError(t, src.Set(bz("extra"), bz("1")))
+	other := NewMemDB()
+	require.NoError(t, other.Set(bz("unrelated"), bz("1")))
+	_, err = Migrate(src, other, MigrateConfig{})
+	require.ErrorIs(t, err, ErrMigrateMismatch)
+}
+
+func TestMigrateResume(t *testing.T) {
+	src := NewMemDB()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, src.Set(int642Bytes(int64(i)), int642Bytes(int64(i))))
+	}
+	dst := NewMemDB()
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// Interrupt the migration after 3 batches.
+	require.Panics(t, func() {
+		var batches int
+		_, _ = Migrate(src, dst, MigrateConfig{
+			BatchSize:      10,
+			CheckpointPath: checkpoint,
+			Progress: func(MigrateResult) {
+				if batches++; batches == 3 {
+					panic("interrupted")
+				}
+			},
+		})
+	})
+	require.FileExists(t, checkpoint)
+	items, err := checksumItems(dst)
+	require.NoError(t, err)
+	require.EqualValues(t, 30, items.Keys)
+
+	var first uint64
+	result, err := Migrate(src, dst, MigrateConfig{
+		BatchSize:      10,
+		CheckpointPath: checkpoint,
+		Progress: func(r MigrateResult) {
+			if first == 0 {
+				first = r.Keys
+			}
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, result.Resumed)
+	require.EqualValues(t, 40, first)
+	require.EqualValues(t, 100, result.Keys)
+	expected, err := checksumItems(src)
+	require.NoError(t, err)
+	require.Equal(t, expected.Checksum, result.Checksum)
+	require.NoFileExists(t, checkpoint)
+}
@@ -0,0 +1,467 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// mirrorDBChunk is the number of keys copied or compared at once by MirrorDB.Backfill and Verify.
+const mirrorDBChunk = 1000
+
+// MirrorDB wraps two databases, applying all writes to both while serving reads from the primary,
+// to migrate a live node from one backend to another. New writes are mirrored as soon as the
+// database is wrapped, Backfill copies the existing data of the primary to the secondary, and
+// Verify compares them before cutting over to the secondary.
+//
+// Writes are applied to the primary first, and only fail if the primary write fails. A failed
+// secondary write is counted as a divergence, and logged if a logger is set, so that the migration
+// can be restarted. Writes are serialized, so that both databases apply them in the same order.
+// With SetReadRepair, diverging keys found by reads and by Verify are also rewritten in the
+// secondary, which turns it into a continuously verified copy of the primary.
+type MirrorDB struct {
+	primary    DB
+	secondary  DB
+	logger     Logger
+	readRepair bool
+
+	mtx         sync.Mutex // serializes writes, backfills, verifications and repaired reads
+	divergences uint64
+	repairs     uint64
+}
+
+var _ DB = (*MirrorDB)(nil)
+
+// NewMirrorDB wraps primary, mirroring its writes to secondary.
+func NewMirrorDB(primary, secondary DB) *MirrorDB {
+	return &MirrorDB{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// SetLogger sets the logger used to report divergences.
+func (mdb *MirrorDB) SetLogger(logger Logger) {
+	mdb.logger = logger
+}
+
+// SetReadRepair enables or disables read repair. Get and Has then also read the secondary, and a
+// key whose value differs from the primary is counted as a divergence, logged, and rewritten in
+// the secondary with the value of the primary, or deleted from it. Verify also repairs the keys it
+// finds to diverge. Reads are then serialized with writes, and cost a read of each database.
+func (mdb *MirrorDB) SetReadRepair(enabled bool) {
+	mdb.readRepair = enabled
+}
+
+// Divergences returns the number of divergences found so far, i.e. failed secondary writes and
+// keys found to differ by Verify.
+func (mdb *MirrorDB) Divergences() uint64 {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	return mdb.divergences
+}
+
+// diverged records a divergence. It must be called with the lock held.
+func (mdb *MirrorDB) diverged(msg string, keyvals ...any) {
+	mdb.divergences++
+	if mdb.logger != nil {
+		mdb.logger.Error(msg, keyvals...)
+	}
+}
+
+// Repairs returns the number of keys repaired in the secondary so far, see SetReadRepair.
+func (mdb *MirrorDB) Repairs() uint64 {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	return mdb.repairs
+}
+
+// repair rewrites key in the secondary with its value in the primary, or deletes it from the
+// secondary if value is nil. It must be called with the lock held.
+func (mdb *MirrorDB) repair(key, value []byte) {
+	var err error
+	if value == nil {
+		err = mdb.secondary.Delete(key)
+	} else {
+		err = mdb.secondary.Set(key, value)
+	}
+	if err != nil {
+		if mdb.logger != nil {
+			mdb.logger.Error("mirrored read repair failed", "key", fmt.Sprintf("%X", key), "err", err)
+		}
+		return
+	}
+	mdb.repairs++
+}
+
+// getRepaired reads key from both databases, and repairs the secondary if they diverge. Failing to
+// read the secondary is counted as a divergence, but does not fail the read.
+func (mdb *MirrorDB) getRepaired(key []byte) ([]byte, error) {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	value, err := mdb.primary.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := mdb.secondary.Get(key)
+	if err != nil {
+		mdb.diverged("mirrored read failed", "key", fmt.Sprintf("%X", key), "err", err)
+		return value, nil
+	}
+	var reason string
+	switch {
+	case value == nil && secondary == nil:
+		return value, nil
+	case secondary == nil:
+		reason = "missing from secondary"
+	case value == nil:
+		reason = "missing from primary"
+	case bytes.Equal(value, secondary):
+		return value, nil
+	default:
+		reason = fmt.Sprintf("values differ: %X in primary, %X in secondary", value, secondary)
+	}
+	mdb.diverged("mirrored databases diverge", "key", fmt.Sprintf("%X", key), "reason", reason)
+	mdb.repair(key, value)
+	return value, nil
+}
+
+// write applies a write to both databases.
+func (mdb *MirrorDB) write(op DBOperation, key []byte, write func(DB) error) error {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	if err := write(mdb.primary); err != nil {
+		return err
+	}
+	if err := write(mdb.secondary); err != nil {
+		mdb.diverged("mirrored write failed", "op", string(op), "key_prefix", keyPrefixHex(key), "err", err)
+	}
+	return nil
+}
+
+// Backfill copies the data of the primary within [start, end) to the secondary, in chunks between
+// which writes may proceed. Keys of the secondary which do not exist in the primary are not
+// deleted, so the secondary should be empty when mirroring starts.
+func (mdb *MirrorDB) Backfill(start, end []byte) error {
+	for next := start; ; {
+		_, done, err := mdb.backfillChunk(&next, end)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// backfillChunk copies a chunk of keys starting at *next, advances *next past them, and returns
+// the number of keys copied.
+func (mdb *MirrorDB) backfillChunk(next *[]byte, end []byte) (int, bool, error) {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	items, more, err := readChunk(mdb.primary, *next, end)
+	if err != nil {
+		return 0, false, err
+	}
+	batch := mdb.secondary.NewBatch()
+	defer batch.Close()
+	for _, item := range items {
+		if err := batch.Set(item.key, item.value); err != nil {
+			return 0, false, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, false, err
+	}
+	*next = more
+	return len(items), more == nil, nil
+}
+
+// Verify compares the primary and the secondary within [start, end), in chunks between which
+// writes may proceed, and returns the number of keys which are missing from either or whose
+// values differ. Each of them is counted as a divergence, and repaired if read repair is enabled.
+func (mdb *MirrorDB) Verify(start, end []byte) (int, error) {
+	var diverging int
+	for next := start; ; {
+		_, n, done, err := mdb.verifyChunk(&next, end)
+		diverging += n
+		if err != nil || done {
+			return diverging, err
+		}
+	}
+}
+
+// verifyChunk compares a chunk of keys of the primary starting at *next, along with the keys of
+// the secondary within the same range, advances *next past them, and returns the number of keys
+// of the primary compared and the number of diverging keys.
+func (mdb *MirrorDB) verifyChunk(next *[]byte, end []byte) (int, int, bool, error) {
+	mdb.mtx.Lock()
+	defer mdb.mtx.Unlock()
+	primary, more, err := readChunk(mdb.primary, *next, end)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	compared := len(primary)
+	chunkEnd := end
+	if more != nil {
+		chunkEnd = more
+	}
+	secondary, err := readRange(mdb.secondary, *next, chunkEnd)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var diverging int
+	for len(primary) > 0 || len(secondary) > 0 {
+		var (
+			key, value []byte // value is the value of key in the primary
+			reason     string
+		)
+		switch {
+		case len(secondary) == 0 || (len(primary) > 0 && bytes.Compare(primary[0].key, secondary[0].key) < 0):
+			key, value, reason = primary[0].key, primary[0].value, "missing from secondary"
+			primary = primary[1:]
+		case len(primary) == 0 || bytes.Compare(primary[0].key, secondary[0].key) > 0:
+			key, reason = secondary[0].key, "missing from primary"
+			secondary = secondary[1:]
+		default:
+			if !bytes.Equal(primary[0].value, secondary[0].value) {
+				key, value, reason = primary[0].key, primary[0].value, "values differ"
+			}
+			primary, secondary = primary[1:], secondary[1:]
+		}
+		if key != nil {
+			diverging++
+			mdb.diverged("mirrored databases diverge", "key", fmt.Sprintf("%X", key), "reason", reason)
+			if mdb.readRepair {
+				mdb.repair(key, value)
+			}
+		}
+	}
+	*next = more
+	return compared, diverging, more == nil, nil
+}
+
+// mirrorItem is a key/value pair read by readChunk.
+type mirrorItem struct {
+	key   []byte
+	value []byte
+}
+
+// readChunk reads up to mirrorDBChunk items within [start, end), and returns the key following
+// them, or nil if there are none.
+func readChunk(db DB, start, end []byte) ([]mirrorItem, []byte, error) {
+	itr, err := db.Iterator(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer itr.Close()
+	var items []mirrorItem
+	for ; itr.Valid(); itr.Next() {
+		if len(items) == mirrorDBChunk {
+			return items, cp(itr.Key()), itr.Error()
+		}
+		items = append(items, mirrorItem{cp(itr.Key()), cp(itr.Value())})
+	}
+	return items, nil, itr.Error()
+}
+
+// readRange reads all items within [start, end).
+func readRange(db DB, start, end []byte) ([]mirrorItem, error) {
+	itr, err := db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	var items []mirrorItem
+	for ; itr.Valid(); itr.Next() {
+		items = append(items, mirrorItem{cp(itr.Key()), cp(itr.Value())})
+	}
+	return items, itr.Error()
+}
+
+// Get implements DB.
+func (mdb *MirrorDB) Get(key []byte) ([]byte, error) {
+	if mdb.readRepair {
+		return mdb.getRepaired(key)
+	}
+	return mdb.primary.Get(key)
+}
+
+// Has implements DB.
+func (mdb *MirrorDB) Has(key []byte) (bool, error) {
+	if mdb.readRepair {
+		value, err := mdb.getRepaired(key)
+		return value != nil, err
+	}
+	return mdb.primary.Has(key)
+}
+
+// Set implements DB.
+func (mdb *MirrorDB) Set(key []byte, value []byte) error {
+	return mdb.write(OpSet, key, func(db DB) error {
+		return db.Set(key, value)
+	})
+}
+
+// SetSync implements DB.
+func (mdb *MirrorDB) SetSync(key []byte, value []byte) error {
+	return mdb.write(OpSetSync, key, func(db DB) error {
+		return db.SetSync(key, value)
+	})
+}
+
+// Delete implements DB.
+func (mdb *MirrorDB) Delete(key []byte) error {
+	return mdb.write(OpDelete, key, func(db DB) error {
+		return db.Delete(key)
+	})
+}
+
+// DeleteSync implements DB.
+func (mdb *MirrorDB) DeleteSync(key []byte) error {
+	return mdb.write(OpDeleteSync, key, func(db DB) error {
+		return db.DeleteSync(key)
+	})
+}
+
+// Iterator implements DB.
+func (mdb *MirrorDB) Iterator(start, end []byte) (Iterator, error) {
+	return mdb.primary.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (mdb *MirrorDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return mdb.primary.ReverseIterator(start, end)
+}
+
+// Close implements DB. It closes both databases.
+func (mdb *MirrorDB) Close() error {
+	err := mdb.primary.Close()
+	if closeErr := mdb.secondary.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (mdb *MirrorDB) NewBatch() Batch {
+	return &mirrorDBBatch{mdb: mdb}
+}
+
+// Print implements DB.
+func (mdb *MirrorDB) Print() error {
+	return mdb.primary.Print()
+}
+
+// Stats implements DB.
+func (mdb *MirrorDB) Stats() map[string]string {
+	stats := mdb.primary.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	stats["mirror.divergences"] = strconv.FormatUint(mdb.Divergences(), 10)
+	stats["mirror.repairs"] = strconv.FormatUint(mdb.Repairs(), 10)
+	return stats
+}
+
+// Compact implements DB. It compacts both databases.
+func (mdb *MirrorDB) Compact(start, end []byte) error {
+	if err := mdb.primary.Compact(start, end); err != nil {
+		return err
+	}
+	return mdb.secondary.Compact(start, end)
+}
+
+// mirrorDBBatch buffers operations, which are written as a batch to both databases.
+type mirrorDBBatch struct {
+	mdb     *MirrorDB
+	ops     []operation
+	size    int       // of the keys and values of ops
+	written *MirrorDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*mirrorDBBatch)(nil)
+
+// Set implements Batch.
+func (b *mirrorDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.mdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *mirrorDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.mdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *mirrorDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *mirrorDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *mirrorDBBatch) Write() error {
+	return b.write(OpBatchWrite, false)
+}
+
+// WriteSync implements Batch.
+func (b *mirrorDBBatch) WriteSync() error {
+	return b.write(OpBatchWriteSync, true)
+}
+
+func (b *mirrorDBBatch) write(op DBOperation, sync bool) error {
+	if b.mdb == nil {
+		return errBatchClosed
+	}
+	err := b.mdb.write(op, nil, func(db DB) error {
+		return writeOperations(db, b.ops, sync)
+	})
+	if err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.mdb, b.written, b.ops, b.size = nil, b.mdb, b.ops[:0], 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *mirrorDBBatch) Reset() error {
+	if b.mdb == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.mdb, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *mirrorDBBatch) Close() error {
+	b.mdb, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorDB(t *testing.T) {
+	primary, secondary := NewMemDB(), NewMemDB()
+	for i := int64(0); i < 2*mirrorDBChunk+5; i++ {
+		require.NoError(t, primary.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	mdb := NewMirrorDB(primary, secondary)
+	logger := &testLogger{}
+	mdb.SetLogger(logger)
+	defer mdb.Close()
+
+	// Writes are mirrored, and reads are served by the primary.
+	require.NoError(t, mdb.Set(bz("a"), bz("1")))
+	require.NoError(t, mdb.DeleteSync(int642Bytes(0)))
+	batch := mdb.NewBatch()
+	require.NoError(t, batch.Set(bz("b"), bz("2")))
+	require.NoError(t, batch.Delete(int642Bytes(1)))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	checkValue(t, secondary, bz("a"), bz("1"))
+	checkValue(t, secondary, bz("b"), bz("2"))
+	checkValue(t, mdb, int642Bytes(2), int642Bytes(2))
+	checkValue(t, secondary, int642Bytes(2), nil)
+
+	// The secondary is missing the data written before mirroring, until backfilled.
+	diverging, err := mdb.Verify(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2*mirrorDBChunk+3, diverging)
+	require.Len(t, logger.lines, diverging)
+
+	require.NoError(t, mdb.Backfill(nil, nil))
+	diverging, err = mdb.Verify(nil, nil)
+	require.NoError(t, err)
+	require.Zero(t, diverging)
+	checkValue(t, secondary, int642Bytes(2), int642Bytes(2))
+
+	// Keys only in the secondary, and differing values, are divergences too.
+	require.NoError(t, secondary.Set(bz("a"), bz("x")))
+	require.NoError(t, secondary.Set(bz("c"), bz("3")))
+	diverging, err = mdb.Verify(bz("a"), nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, diverging)
+	require.EqualValues(t, 2*mirrorDBChunk+5, mdb.Divergences())
+	require.Equal(t, "2005", mdb.Stats()["mirror.divergences"])
+}
+
+func TestMirrorDBSecondaryFailure(t *testing.T) {
+	primary := NewMemDB()
+	mdb := NewMirrorDB(primary, NewReadOnlyDB(NewMemDB()))
+
+	// A failed secondary write does not fail the write, but is counted as a divergence.
+	require.NoError(t, mdb.Set(bz("a"), bz("1")))
+	checkValue(t, mdb, bz("a"), bz("1"))
+	require.EqualValues(t, 1, mdb.Divergences())
+
+	// A failed primary write fails.
+	mdb = NewMirrorDB(NewReadOnlyDB(primary), NewMemDB())
+	require.ErrorIs(t, mdb.Set(bz("b"), bz("1")), ErrReadOnly)
+	require.Zero(t, mdb.Divergences())
+}
+
+func TestMirrorDBReadRepair(t *testing.T) {
+	primary, secondary := NewMemDB(), NewMemDB()
+	mdb := NewMirrorDB(primary, secondary)
+	logger := &testLogger{}
+	mdb.SetLogger(logger)
+	mdb.SetReadRepair(true)
+	defer mdb.Close()
+	require.NoError(t, mdb.Set(bz("a"), bz("1")))
+	require.NoError(t, mdb.Set(bz("b"), bz("2")))
+
+	// Reads of keys diverging in the secondary repair them.
+	require.NoError(t, secondary.Set(bz("a"), bz("x")))
+	require.NoError(t, secondary.Delete(bz("b")))
+	require.NoError(t, secondary.Set(bz("c"), bz("3")))
+	checkValue(t, mdb, bz("a"), bz("1"))
+	ok, err := mdb.Has(bz("b"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	checkValue(t, mdb, bz("c"), nil)
+	checkValue(t, secondary, bz("a"), bz("1"))
+	checkValue(t, secondary, bz("b"), bz("2"))
+	checkValue(t, secondary, bz("c"), nil)
+	require.Len(t, logger.lines, 3)
+	require.Contains(t, logger.lines[0], "values differ: 31 in primary, 78 in secondary")
+
+	// Reads of consistent keys do not.
+	checkValue(t, mdb, bz("a"), bz("1"))
+	require.EqualValues(t, 3, mdb.Divergences())
+	require.EqualValues(t, 3, mdb.Repairs())
+
+	// Verify repairs the keys it finds to diverge.
+	require.NoError(t, secondary.Set(bz("a"), bz("x")))
+	require.NoError(t, secondary.Set(bz("d"), bz("4")))
+	diverging, err := mdb.Verify(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, diverging)
+	diverging, err = mdb.Verify(nil, nil)
+	require.NoError(t, err)
+	require.Zero(t, diverging)
+	require.Equal(t, "5", mdb.Stats()["mirror.repairs"])
+
+	// Without read repair, reads only go to the primary.
+	require.NoError(t, secondary.Set(bz("a"), bz("x")))
+	mdb.SetReadRepair(false)
+	checkValue(t, mdb, bz("a"), bz("1"))
+	checkValue(t, secondary, bz("a"), bz("x"))
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package db
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of the file into memory, on platforms without mmap support.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile releases memory returned by mmapFile.
+func munmapFile([]byte) error {
+	return nil
+}
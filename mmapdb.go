@@ -0,0 +1,373 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// An mmap database file starts with a magic header, followed by the entries in key order, each
+// encoded as uvarint length-prefixed key and value. The index lists the big-endian uint64 file
+// offset of every entry, and is followed by a footer with the offset of the index, the number of
+// entries, and the magic header again. Lookups binary search the index, so opening a file only
+// needs to read its footer.
+const (
+	mmapDBMagic      = "CMTDBMM1"
+	mmapDBFooterSize = 8 + 8 + len(mmapDBMagic)
+)
+
+var errMmapDBCorrupted = errors.New("mmap database file corrupted")
+
+// ExportMmapDB writes the contents of src to a new immutable database file at path, which can be
+// opened with OpenMmapDB.
+func ExportMmapDB(src DBReader, path string) error {
+	itr, err := src.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+
+	tmp := path + tmpFileSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	var offset uint64
+	var index []byte
+	buf := []byte(mmapDBMagic)
+	for ; itr.Valid(); itr.Next() {
+		index = binary.BigEndian.AppendUint64(index, offset+uint64(len(buf)))
+		buf = binary.AppendUvarint(buf, uint64(len(itr.Key())))
+		buf = append(buf, itr.Key()...)
+		buf = binary.AppendUvarint(buf, uint64(len(itr.Value())))
+		buf = append(buf, itr.Value()...)
+		if len(buf) >= 1<<20 {
+			if _, err := f.Write(buf); err != nil {
+				return err
+			}
+			offset += uint64(len(buf))
+			buf = buf[:0]
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+
+	indexOffset := offset + uint64(len(buf))
+	buf = append(buf, index...)
+	buf = binary.BigEndian.AppendUint64(buf, indexOffset)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(index)/8))
+	buf = append(buf, mmapDBMagic...)
+	if _, err := f.Write(buf); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MmapDB is an immutable database serving reads from a file written by ExportMmapDB, which is
+// mapped into memory. Opening it is instant regardless of its size, and reads do not allocate:
+// the keys and values returned point directly into the mapped file, so they must not be used
+// after the database is closed, and must be copied if needed longer. Writes return ErrReadOnly.
+//
+// It is meant for serving historical queries from prebuilt, exported data.
+type MmapDB struct {
+	data  []byte
+	index []byte // big-endian uint64 entry offsets
+	count int
+}
+
+var _ DB = (*MmapDB)(nil)
+
+// OpenMmapDB opens a database file written by ExportMmapDB.
+func OpenMmapDB(path string) (*MmapDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < int64(len(mmapDBMagic)+mmapDBFooterSize) {
+		return nil, fmt.Errorf("%w: %s is too short", errMmapDBCorrupted, path)
+	}
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	footer := data[len(data)-mmapDBFooterSize:]
+	indexOffset := binary.BigEndian.Uint64(footer[0:8])
+	count := binary.BigEndian.Uint64(footer[8:16])
+	indexEnd := uint64(len(data) - mmapDBFooterSize)
+	if string(data[:len(mmapDBMagic)]) != mmapDBMagic || string(footer[16:]) != mmapDBMagic ||
+		indexOffset > indexEnd || (indexEnd-indexOffset)/8 != count || (indexEnd-indexOffset)%8 != 0 {
+		munmapFile(data)
+		return nil, fmt.Errorf("%w: %s has an invalid header or footer", errMmapDBCorrupted, path)
+	}
+	return &MmapDB{
+		data:  data,
+		index: data[indexOffset:indexEnd],
+		count: int(count),
+	}, nil
+}
+
+// entry returns the key and value of the i-th entry.
+func (db *MmapDB) entry(i int) (key, value []byte) {
+	offset := binary.BigEndian.Uint64(db.index[i*8:])
+	buf := db.data[offset:]
+	n, size := binary.Uvarint(buf)
+	key = buf[size : size+int(n) : size+int(n)]
+	buf = buf[size+int(n):]
+	n, size = binary.Uvarint(buf)
+	value = buf[size : size+int(n) : size+int(n)]
+	return key, value
+}
+
+// search returns the index of the first entry with a key of at least key.
+func (db *MmapDB) search(key []byte) int {
+	return sort.Search(db.count, func(i int) bool {
+		k, _ := db.entry(i)
+		return bytes.Compare(k, key) >= 0
+	})
+}
+
+// Get implements DB.
+func (db *MmapDB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	i := db.search(key)
+	if i < db.count {
+		if k, v := db.entry(i); bytes.Equal(k, key) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// Has implements DB.
+func (db *MmapDB) Has(key []byte) (bool, error) {
+	value, err := db.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Set implements DB.
+func (*MmapDB) Set([]byte, []byte) error {
+	return ErrReadOnly
+}
+
+// SetSync implements DB.
+func (*MmapDB) SetSync([]byte, []byte) error {
+	return ErrReadOnly
+}
+
+// Delete implements DB.
+func (*MmapDB) Delete([]byte) error {
+	return ErrReadOnly
+}
+
+// DeleteSync implements DB.
+func (*MmapDB) DeleteSync([]byte) error {
+	return ErrReadOnly
+}
+
+// Iterator implements DB.
+func (db *MmapDB) Iterator(start, end []byte) (Iterator, error) {
+	return db.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (db *MmapDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return db.newIterator(start, end, true)
+}
+
+func (db *MmapDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	first, last := 0, db.count
+	if start != nil {
+		first = db.search(start)
+	}
+	if end != nil {
+		last = db.search(end)
+	}
+	itr := &mmapDBIterator{
+		db:        db,
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+		first:     first,
+		last:      last,
+		pos:       first,
+	}
+	if isReverse {
+		itr.pos = last - 1
+	}
+	return itr, nil
+}
+
+// Close implements DB. Keys and values returned by the database must not be used afterwards.
+func (db *MmapDB) Close() error {
+	if db.data == nil {
+		return nil
+	}
+	err := munmapFile(db.data)
+	db.data, db.index, db.count = nil, nil, 0
+	return err
+}
+
+// NewBatch implements DB. The batch returns ErrReadOnly on writes.
+func (*MmapDB) NewBatch() Batch {
+	return readOnlyBatch{}
+}
+
+// Print implements DB.
+func (db *MmapDB) Print() error {
+	for i := 0; i < db.count; i++ {
+		key, value := db.entry(i)
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return nil
+}
+
+// Stats implements DB.
+func (db *MmapDB) Stats() map[string]string {
+	return map[string]string{
+		"database.type": "mmapDB",
+		"database.size": strconv.Itoa(db.count),
+	}
+}
+
+// Compact implements DB. It is a no-op, the database is immutable.
+func (*MmapDB) Compact(_, _ []byte) error {
+	return nil
+}
+
+// mmapDBIterator iterates over the entries within [first, last) of an MmapDB.
+type mmapDBIterator struct {
+	db        *MmapDB
+	start     []byte
+	end       []byte
+	isReverse bool
+	first     int
+	last      int
+	pos       int
+}
+
+var _ Iterator = (*mmapDBIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *mmapDBIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *mmapDBIterator) Valid() bool {
+	return itr.pos >= itr.first && itr.pos < itr.last
+}
+
+// Next implements Iterator.
+func (itr *mmapDBIterator) Next() {
+	itr.assertIsValid()
+	if itr.isReverse {
+		itr.pos--
+	} else {
+		itr.pos++
+	}
+}
+
+// Key implements Iterator.
+func (itr *mmapDBIterator) Key() []byte {
+	itr.assertIsValid()
+	key, _ := itr.db.entry(itr.pos)
+	return key
+}
+
+// Value implements Iterator.
+func (itr *mmapDBIterator) Value() []byte {
+	itr.assertIsValid()
+	_, value := itr.db.entry(itr.pos)
+	return value
+}
+
+// Error implements Iterator.
+func (*mmapDBIterator) Error() error {
+	return nil
+}
+
+// Close implements Iterator.
+func (itr *mmapDBIterator) Close() error {
+	itr.first, itr.last = 0, 0
+	return nil
+}
+
+func (itr *mmapDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
+
+// readOnlyBatch is a batch of a read-only database, which rejects all writes.
+type readOnlyBatch struct{}
+
+var _ Batch = readOnlyBatch{}
+
+// Set implements Batch.
+func (readOnlyBatch) Set(_, _ []byte) error {
+	return ErrReadOnly
+}
+
+// Delete implements Batch.
+func (readOnlyBatch) Delete([]byte) error {
+	return ErrReadOnly
+}
+
+// Count implements Batch.
+func (readOnlyBatch) Count() int {
+	return 0
+}
+
+// SizeBytes implements Batch.
+func (readOnlyBatch) SizeBytes() int {
+	return 0
+}
+
+// Write implements Batch.
+func (readOnlyBatch) Write() error {
+	return ErrReadOnly
+}
+
+// WriteSync implements Batch.
+func (readOnlyBatch) WriteSync() error {
+	return ErrReadOnly
+}
+
+// Reset implements Batch.
+func (readOnlyBatch) Reset() error {
+	return nil
+}
+
+// Close implements Batch.
+func (readOnlyBatch) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMmapDB(t *testing.T) {
+	src := NewMemDB()
+	for i := int64(0); i < 100; i++ {
+		require.NoError(t, src.Set(int642Bytes(i*2), int642Bytes(i)))
+	}
+	path := filepath.Join(t.TempDir(), "archive.mmdb")
+	require.NoError(t, ExportMmapDB(src, path))
+
+	db, err := OpenMmapDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	checkValue(t, db, int642Bytes(10), int642Bytes(5))
+	checkValue(t, db, int642Bytes(11), nil)
+	checkValue(t, db, int642Bytes(1000), nil)
+	require.Equal(t, "100", db.Stats()["database.size"])
+
+	itr, err := db.Iterator(int642Bytes(191), nil)
+	require.NoError(t, err)
+	checkDomain(t, itr, int642Bytes(191), nil)
+	verifyIterator(t, itr, []int64{192, 194, 196, 198}, "forward iterator")
+	itr, err = db.ReverseIterator(nil, int642Bytes(6))
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{4, 2, 0}, "reverse iterator")
+	itr, err = db.Iterator(int642Bytes(7), int642Bytes(8))
+	require.NoError(t, err)
+	checkInvalid(t, itr)
+
+	require.Equal(t, ErrReadOnly, db.Set(int642Bytes(1), bz("x")))
+	require.Equal(t, ErrReadOnly, db.Delete(int642Bytes(2)))
+	batch := db.NewBatch()
+	require.Equal(t, ErrReadOnly, batch.Set(int642Bytes(1), bz("x")))
+	require.Equal(t, ErrReadOnly, batch.Write())
+	require.NoError(t, batch.Close())
+}
+
+func TestMmapDBEmptyAndCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.mmdb")
+	require.NoError(t, ExportMmapDB(NewMemDB(), path))
+	db, err := OpenMmapDB(path)
+	require.NoError(t, err)
+	itr, err := db.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	checkInvalid(t, itr)
+	checkValue(t, db, bz("a"), nil)
+	require.NoError(t, db.Close())
+
+	path = filepath.Join(dir, "corrupted.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("CMTDBMM1 not an mmap database file"), 0o644))
+	_, err = OpenMmapDB(path)
+	require.ErrorIs(t, err, errMmapDBCorrupted)
+}
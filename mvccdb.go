@@ -0,0 +1,560 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrVersionPruned is returned when reading an MVCCDB at a version which has been pruned.
+	ErrVersionPruned = errors.New("version pruned")
+
+	// errVersionDecreased is returned when writing an MVCCDB batch below the latest version.
+	errVersionDecreased = errors.New("version is lower than the latest version")
+)
+
+// mvccDBPruneChunk is the number of versions deleted per batch when pruning an MVCCDB.
+const mvccDBPruneChunk = 1000
+
+// Layout of an MVCCDB in the underlying database. Every write of a key is stored as a separate
+// entry, which sort by key and then by version:
+//
+//	v <escaped key> <version> -> 0x01 <value>, or 0x00 for a delete
+//	m l                       -> latest version
+//	m p                       -> version below which versions have been pruned
+//
+// Versions are encoded as big-endian uint64, so that they sort numerically.
+var (
+	mvccVersionPrefix = []byte("v")
+	mvccLatestKey     = []byte("ml")
+	mvccPrunedKey     = []byte("mp")
+)
+
+const (
+	mvccTombstone byte = 0x00
+	mvccValue     byte = 0x01
+)
+
+// MVCCDB wraps a database and keeps every version of every key, tagged with a monotonically
+// increasing version such as a block height. Reads at any retained version take a single seek,
+// regardless of the number of later writes, and versions older than a retention window can be
+// pruned. The database itself reads the latest version.
+//
+// The underlying database must be used exclusively by the MVCCDB.
+type MVCCDB struct {
+	mtx sync.RWMutex
+	db  DB
+}
+
+var _ DBReader = (*MVCCDB)(nil)
+
+// NewMVCCDB wraps db.
+func NewMVCCDB(db DB) *MVCCDB {
+	return &MVCCDB{db: db}
+}
+
+// mvccVersionKey returns the key storing the given version of key.
+func mvccVersionKey(key []byte, version uint64) []byte {
+	return uint64Key(append(cp(mvccVersionPrefix), escapeKey(key)...), version)
+}
+
+// splitMVCCVersionKey returns the escaped key and the version of a stored key.
+func splitMVCCVersionKey(stored []byte) ([]byte, uint64, error) {
+	if len(stored) < len(mvccVersionPrefix)+2+8 || !bytes.HasPrefix(stored, mvccVersionPrefix) {
+		return nil, 0, fmt.Errorf("invalid versioned key %X", stored)
+	}
+	escaped := stored[len(mvccVersionPrefix) : len(stored)-8]
+	return escaped, binary.BigEndian.Uint64(stored[len(stored)-8:]), nil
+}
+
+// unescapeKey decodes a key encoded by escapeKey.
+func unescapeKey(escaped []byte) []byte {
+	key := make([]byte, 0, len(escaped)-2)
+	for i := 0; i < len(escaped)-2; i++ {
+		key = append(key, escaped[i])
+		if escaped[i] == 0x00 {
+			i++
+		}
+	}
+	return key
+}
+
+// readUint64 reads a uint64 stored under key, or 0 if it does not exist.
+func (m *MVCCDB) readUint64(key []byte) (uint64, error) {
+	bz, err := m.db.Get(key)
+	if err != nil || bz == nil {
+		return 0, err
+	}
+	if len(bz) != 8 {
+		return 0, fmt.Errorf("invalid value of %q", key)
+	}
+	return binary.BigEndian.Uint64(bz), nil
+}
+
+// LatestVersion returns the latest version written, or 0 if none was.
+func (m *MVCCDB) LatestVersion() (uint64, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.readUint64(mvccLatestKey)
+}
+
+// VersionBatch creates a batch whose writes are tagged with the given version. Versions must not
+// decrease: writing a batch for a version lower than the latest one fails. Several batches may be
+// written for the same version. The caller must call Batch.Close.
+func (m *MVCCDB) VersionBatch(version uint64) Batch {
+	return &mvccDBBatch{
+		m:       m,
+		version: version,
+		batch:   m.db.NewBatch(),
+	}
+}
+
+// AtVersion returns a read-only view of the database as of the given version, i.e. containing
+// the latest writes made at that version or below. Versions which were pruned return
+// ErrVersionPruned, and a view must not be used once its version has been pruned.
+func (m *MVCCDB) AtVersion(version uint64) (DBReader, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	pruned, err := m.readUint64(mvccPrunedKey)
+	if err != nil {
+		return nil, err
+	}
+	if version < pruned {
+		return nil, fmt.Errorf("%w: version %d is below %d", ErrVersionPruned, version, pruned)
+	}
+	return &mvccDBView{m: m, version: version}, nil
+}
+
+// Get implements DBReader, reading the latest version.
+func (m *MVCCDB) Get(key []byte) ([]byte, error) {
+	return (&mvccDBView{m: m, version: math.MaxUint64}).Get(key)
+}
+
+// Has implements DBReader, reading the latest version.
+func (m *MVCCDB) Has(key []byte) (bool, error) {
+	return (&mvccDBView{m: m, version: math.MaxUint64}).Has(key)
+}
+
+// Iterator implements DBReader, reading the latest version.
+func (m *MVCCDB) Iterator(start, end []byte) (Iterator, error) {
+	return (&mvccDBView{m: m, version: math.MaxUint64}).Iterator(start, end)
+}
+
+// ReverseIterator implements DBReader, reading the latest version.
+func (m *MVCCDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return (&mvccDBView{m: m, version: math.MaxUint64}).ReverseIterator(start, end)
+}
+
+// Close closes the underlying database.
+func (m *MVCCDB) Close() error {
+	return m.db.Close()
+}
+
+// Prune deletes the versions which are no longer needed to read the versions within the retention
+// window, i.e. the latest version and the retain versions before it, and returns the number of
+// versions deleted. Older versions can no longer be read afterwards. Writes are blocked while it
+// runs.
+func (m *MVCCDB) Prune(retain uint64) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	latest, err := m.readUint64(mvccLatestKey)
+	if err != nil {
+		return 0, err
+	}
+	if latest <= retain {
+		return 0, nil
+	}
+	horizon := latest - retain
+	pruned, err := m.readUint64(mvccPrunedKey)
+	if err != nil || pruned >= horizon {
+		return 0, err
+	}
+
+	var (
+		deleted int
+		next    = mvccVersionPrefix
+	)
+	for next != nil {
+		var stale [][]byte
+		stale, next, err = m.staleVersions(next, horizon)
+		if err != nil {
+			return deleted, err
+		}
+		batch := m.db.NewBatch()
+		for _, key := range stale {
+			if err := batch.Delete(key); err != nil {
+				batch.Close()
+				return deleted, err
+			}
+		}
+		if next == nil {
+			if err := batch.Set(mvccPrunedKey, binary.BigEndian.AppendUint64(nil, horizon)); err != nil {
+				batch.Close()
+				return deleted, err
+			}
+		}
+		err = batch.WriteSync()
+		batch.Close()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(stale)
+	}
+	return deleted, nil
+}
+
+// staleVersions collects the stored keys of the versions which are not needed to read at horizon
+// or later, scanning keys from start until about mvccDBPruneChunk are found. It returns the start of
+// the next scan, or nil once all keys were scanned. For every key, all versions at or below horizon
+// except the latest are stale, as well as that one if it is a delete.
+func (m *MVCCDB) staleVersions(start []byte, horizon uint64) ([][]byte, []byte, error) {
+	itr, err := m.db.Iterator(start, prefixEnd(mvccVersionPrefix))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer itr.Close()
+
+	var (
+		stale      [][]byte
+		group      []byte // escaped key of the current key
+		candidate  []byte // latest version at or below horizon of the current key
+		tombstoned bool
+	)
+	endGroup := func() {
+		if candidate != nil && tombstoned {
+			stale = append(stale, candidate)
+		}
+		candidate = nil
+	}
+	for ; itr.Valid(); itr.Next() {
+		escaped, version, err := splitMVCCVersionKey(itr.Key())
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(escaped, group) {
+			endGroup()
+			if len(stale) >= mvccDBPruneChunk {
+				return stale, cp(itr.Key()), itr.Error()
+			}
+			group = cp(escaped)
+		}
+		if version > horizon {
+			continue
+		}
+		if candidate != nil {
+			stale = append(stale, candidate)
+		}
+		candidate = cp(itr.Key())
+		tombstoned = len(itr.Value()) > 0 && itr.Value()[0] == mvccTombstone
+	}
+	endGroup()
+	return stale, nil, itr.Error()
+}
+
+// mvccDBView is a read-only view of an MVCCDB at a version.
+type mvccDBView struct {
+	m       *MVCCDB
+	version uint64
+}
+
+var _ DBReader = (*mvccDBView)(nil)
+
+// Get implements DBReader.
+func (v *mvccDBView) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	// The entry of the latest version of key at or below the view's version comes first when
+	// iterating backwards from the next version.
+	end := prefixEnd(mvccVersionKey(key, v.version))
+	itr, err := v.m.db.ReverseIterator(mvccVersionKey(key, 0), end)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	if !itr.Valid() {
+		return nil, itr.Error()
+	}
+	return decodeMVCCValue(itr.Key(), itr.Value())
+}
+
+// decodeMVCCValue decodes a stored value, which is nil for deletes.
+func decodeMVCCValue(key, stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("invalid value of versioned key %X", key)
+	}
+	if stored[0] == mvccTombstone {
+		return nil, nil
+	}
+	return stored[1:], nil
+}
+
+// Has implements DBReader.
+func (v *mvccDBView) Has(key []byte) (bool, error) {
+	value, err := v.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Iterator implements DBReader.
+func (v *mvccDBView) Iterator(start, end []byte) (Iterator, error) {
+	return v.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DBReader.
+func (v *mvccDBView) ReverseIterator(start, end []byte) (Iterator, error) {
+	return v.newIterator(start, end, true)
+}
+
+func (v *mvccDBView) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	// The escaped form of a key sorts before all its versions, and after all smaller keys.
+	sstart, send := mvccVersionPrefix, prefixEnd(mvccVersionPrefix)
+	if start != nil {
+		sstart = append(cp(mvccVersionPrefix), escapeKey(start)...)
+	}
+	if end != nil {
+		send = append(cp(mvccVersionPrefix), escapeKey(end)...)
+	}
+	var (
+		source Iterator
+		err    error
+	)
+	if isReverse {
+		source, err = v.m.db.ReverseIterator(sstart, send)
+	} else {
+		source, err = v.m.db.Iterator(sstart, send)
+	}
+	if err != nil {
+		return nil, err
+	}
+	itr := &mvccDBIterator{
+		source:    source,
+		version:   v.version,
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+	}
+	itr.advance()
+	return itr, nil
+}
+
+// mvccDBIterator iterates over the versions of keys, yielding for every key the latest version
+// at or below the view's version, unless it is a delete.
+type mvccDBIterator struct {
+	source    Iterator
+	version   uint64
+	start     []byte
+	end       []byte
+	isReverse bool
+	key       []byte
+	value     []byte
+	err       error
+}
+
+var _ Iterator = (*mvccDBIterator)(nil)
+
+// advance moves to the next key with a visible value.
+func (itr *mvccDBIterator) advance() {
+	itr.key, itr.value = nil, nil
+	for itr.err == nil && itr.source.Valid() {
+		escaped, _, err := splitMVCCVersionKey(itr.source.Key())
+		if err != nil {
+			itr.err = err
+			return
+		}
+		group := cp(escaped)
+		var (
+			stored []byte
+			found  bool
+		)
+		// Versions are ascending within a key, or descending when iterating in reverse.
+		for ; itr.source.Valid(); itr.source.Next() {
+			escaped, version, err := splitMVCCVersionKey(itr.source.Key())
+			if err != nil {
+				itr.err = err
+				return
+			}
+			if !bytes.Equal(escaped, group) {
+				break
+			}
+			if version <= itr.version && (!itr.isReverse || !found) {
+				stored, found = cp(itr.source.Value()), true
+			}
+		}
+		if err := itr.source.Error(); err != nil {
+			itr.err = err
+			return
+		}
+		if !found {
+			continue
+		}
+		value, err := decodeMVCCValue(group, stored)
+		if err != nil {
+			itr.err = err
+			return
+		}
+		if value != nil {
+			itr.key, itr.value = unescapeKey(group), value
+			return
+		}
+	}
+}
+
+// Domain implements Iterator.
+func (itr *mvccDBIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *mvccDBIterator) Valid() bool {
+	return itr.key != nil && itr.err == nil
+}
+
+// Next implements Iterator.
+func (itr *mvccDBIterator) Next() {
+	itr.assertIsValid()
+	itr.advance()
+}
+
+// Key implements Iterator.
+func (itr *mvccDBIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.key
+}
+
+// Value implements Iterator.
+func (itr *mvccDBIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.value
+}
+
+// Error implements Iterator.
+func (itr *mvccDBIterator) Error() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *mvccDBIterator) Close() error {
+	return itr.source.Close()
+}
+
+func (itr *mvccDBIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
+
+// mvccDBBatch is a batch of writes tagged with a version.
+type mvccDBBatch struct {
+	m       *MVCCDB
+	version uint64
+	batch   Batch
+}
+
+var _ Batch = (*mvccDBBatch)(nil)
+
+// Set implements Batch.
+func (b *mvccDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return b.batch.Set(mvccVersionKey(key, b.version), append([]byte{mvccValue}, value...))
+}
+
+// Delete implements Batch.
+func (b *mvccDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return b.batch.Set(mvccVersionKey(key, b.version), []byte{mvccTombstone})
+}
+
+// Count implements Batch.
+func (b *mvccDBBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch. It includes the versions and tags added to keys and values.
+func (b *mvccDBBatch) SizeBytes() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *mvccDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *mvccDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *mvccDBBatch) write(sync bool) error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	b.m.mtx.Lock()
+	defer b.m.mtx.Unlock()
+	latest, err := b.m.readUint64(mvccLatestKey)
+	if err != nil {
+		return err
+	}
+	if b.version < latest {
+		return fmt.Errorf("%w: %d is lower than %d", errVersionDecreased, b.version, latest)
+	}
+	if err := b.batch.Set(mvccLatestKey, binary.BigEndian.AppendUint64(nil, b.version)); err != nil {
+		return err
+	}
+	if sync {
+		err = b.batch.WriteSync()
+	} else {
+		err = b.batch.Write()
+	}
+	// The written batch rejects further use, unless it is reset.
+	return err
+}
+
+// Reset implements Batch. The batch keeps its version.
+func (b *mvccDBBatch) Reset() error {
+	if b.batch == nil {
+		return errBatchClosed
+	}
+	return b.batch.Reset()
+}
+
+// Close implements Batch.
+func (b *mvccDBBatch) Close() error {
+	if b.batch == nil {
+		return nil
+	}
+	err := b.batch.Close()
+	b.batch = nil
+	return err
+}
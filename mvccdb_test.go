@@ -0,0 +1,183 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeVersion writes the given key/value pairs at version, deleting keys with an empty value.
+func writeVersion(t *testing.T, mdb *MVCCDB, version uint64, kvs ...string) {
+	t.Helper()
+	batch := mdb.VersionBatch(version)
+	defer batch.Close()
+	for i := 0; i < len(kvs); i += 2 {
+		if kvs[i+1] == "" {
+			require.NoError(t, batch.Delete(bz(kvs[i])))
+			continue
+		}
+		require.NoError(t, batch.Set(bz(kvs[i]), bz(kvs[i+1])))
+	}
+	require.NoError(t, batch.WriteSync())
+}
+
+// mvccItems returns the key/value pairs of an iterator, and closes it.
+func mvccItems(t *testing.T, itr Iterator) []string {
+	t.Helper()
+	var items []string
+	for ; itr.Valid(); itr.Next() {
+		items = append(items, string(itr.Key()), string(itr.Value()))
+	}
+	require.NoError(t, itr.Error())
+	require.NoError(t, itr.Close())
+	return items
+}
+
+func TestMVCCDBAtVersion(t *testing.T) {
+	mdb := NewMVCCDB(NewMemDB())
+	defer mdb.Close()
+
+	writeVersion(t, mdb, 1, "a", "1", "b", "1", "c\x00", "1")
+	writeVersion(t, mdb, 2, "a", "2", "b", "")
+	writeVersion(t, mdb, 4, "b", "4", "c", "4")
+
+	latest, err := mdb.LatestVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 4, latest)
+
+	// Versions must not decrease.
+	batch := mdb.VersionBatch(3)
+	require.NoError(t, batch.Set(bz("a"), bz("3")))
+	require.ErrorIs(t, batch.Write(), errVersionDecreased)
+	require.NoError(t, batch.Close())
+
+	testCases := []struct {
+		version uint64
+		items   []string
+	}{
+		{0, nil},
+		{1, []string{"a", "1", "b", "1", "c\x00", "1"}},
+		{2, []string{"a", "2", "c\x00", "1"}},
+		{3, []string{"a", "2", "c\x00", "1"}},
+		{4, []string{"a", "2", "b", "4", "c", "4", "c\x00", "1"}},
+		{100, []string{"a", "2", "b", "4", "c", "4", "c\x00", "1"}},
+	}
+	for _, tc := range testCases {
+		view, err := mdb.AtVersion(tc.version)
+		require.NoError(t, err)
+
+		itr, err := view.Iterator(nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, tc.items, mvccItems(t, itr), "version %d", tc.version)
+
+		itr, err = view.ReverseIterator(nil, nil)
+		require.NoError(t, err)
+		var reversed []string
+		for i := len(tc.items) - 2; i >= 0; i -= 2 {
+			reversed = append(reversed, tc.items[i], tc.items[i+1])
+		}
+		require.Equal(t, reversed, mvccItems(t, itr), "version %d", tc.version)
+
+		items := make(map[string]string)
+		for i := 0; i < len(tc.items); i += 2 {
+			items[tc.items[i]] = tc.items[i+1]
+		}
+		for _, key := range []string{"a", "b", "c", "c\x00"} {
+			value, err := view.Get(bz(key))
+			require.NoError(t, err)
+			if expected, ok := items[key]; ok {
+				require.Equal(t, bz(expected), value, "version %d key %q", tc.version, key)
+			} else {
+				require.Nil(t, value, "version %d key %q", tc.version, key)
+			}
+		}
+	}
+
+	// Ranges are bounded by the original keys.
+	view, err := mdb.AtVersion(4)
+	require.NoError(t, err)
+	itr, err := view.Iterator(bz("b"), bz("c\x00"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "4", "c", "4"}, mvccItems(t, itr))
+	itr, err = view.ReverseIterator(bz("a\x00"), bz("c"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "4"}, mvccItems(t, itr))
+
+	// The database itself reads the latest version.
+	checkValue(t, mdb, bz("a"), bz("2"))
+	checkValue(t, mdb, bz("b"), bz("4"))
+	ok, err := mdb.Has(bz("d"))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMVCCDBPrune(t *testing.T) {
+	mdb := NewMVCCDB(NewMemDB())
+	defer mdb.Close()
+
+	writeVersion(t, mdb, 1, "a", "1", "b", "1", "c", "1")
+	writeVersion(t, mdb, 2, "a", "2", "b", "")
+	writeVersion(t, mdb, 3, "a", "3")
+	writeVersion(t, mdb, 5, "a", "5", "c", "5")
+
+	// Nothing is pruned while the retention window covers all versions.
+	deleted, err := mdb.Prune(10)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	// Reading versions 3 to 5 needs a@3, a@5, c@1 and c@5: a@1, a@2, b@1 and b@2 are stale.
+	deleted, err = mdb.Prune(2)
+	require.NoError(t, err)
+	require.Equal(t, 4, deleted)
+
+	_, err = mdb.AtVersion(2)
+	require.ErrorIs(t, err, ErrVersionPruned)
+	view, err := mdb.AtVersion(3)
+	require.NoError(t, err)
+	itr, err := view.Iterator(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "3", "c", "1"}, mvccItems(t, itr))
+	itr, err = mdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "5", "c", "5"}, mvccItems(t, itr))
+
+	// Pruning again at the same horizon is a no-op.
+	deleted, err = mdb.Prune(2)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestMVCCDBPruneChunks(t *testing.T) {
+	mdb := NewMVCCDB(NewMemDB())
+	defer mdb.Close()
+
+	keys := 2*mvccDBPruneChunk + 10
+	for version := uint64(1); version <= 3; version++ {
+		batch := mdb.VersionBatch(version)
+		for i := 0; i < keys; i++ {
+			require.NoError(t, batch.Set(int642Bytes(int64(i)), int642Bytes(int64(version))))
+		}
+		require.NoError(t, batch.Write())
+		require.NoError(t, batch.Close())
+	}
+
+	deleted, err := mdb.Prune(0)
+	require.NoError(t, err)
+	require.Equal(t, 2*keys, deleted)
+
+	itr, err := mdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	var count int
+	for ; itr.Valid(); itr.Next() {
+		require.EqualValues(t, 3, bytes2Int64(itr.Value()))
+		count++
+	}
+	require.NoError(t, itr.Close())
+	require.Equal(t, keys, count)
+}
+
+func TestUnescapeKey(t *testing.T) {
+	for _, key := range []string{"", "a", "\x00", "a\x00b\x00\x00", "\xff\x00\x01"} {
+		require.Equal(t, []byte(key), unescapeKey(escapeKey([]byte(key))))
+	}
+}
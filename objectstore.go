@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrObjectNotFound is returned by ObjectStore.Get for missing objects.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is a flat namespace of immutable objects, such as an S3 or GCS bucket, used by
+// ArchiveDB to store archived segments. Implementations must be safe for concurrent use.
+type ObjectStore interface {
+	// Put stores an object, replacing any existing object with the same name.
+	Put(name string, data []byte) error
+
+	// Get returns the contents of an object, or an error wrapping ErrObjectNotFound.
+	Get(name string) ([]byte, error)
+
+	// List returns the names of all objects, in any order.
+	List() ([]string, error)
+}
+
+// DirObjectStore is an ObjectStore backed by the files of a directory, e.g. a network file system
+// or a mounted bucket.
+type DirObjectStore struct {
+	dir string
+}
+
+var _ ObjectStore = (*DirObjectStore)(nil)
+
+// NewDirObjectStore creates an object store in dir, creating the directory if needed.
+func NewDirObjectStore(dir string) (*DirObjectStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirObjectStore{dir: dir}, nil
+}
+
+// Put implements ObjectStore. The object is written to a temporary file first, so that readers
+// never see partial objects.
+func (s *DirObjectStore) Put(name string, data []byte) error {
+	if err := checkObjectName(name); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, name), data)
+}
+
+// Get implements ObjectStore.
+func (s *DirObjectStore) Get(name string) ([]byte, error) {
+	if err := checkObjectName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+	}
+	return data, err
+}
+
+// List implements ObjectStore.
+func (s *DirObjectStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), tmpFileSuffix) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// checkObjectName rejects names which are not plain file names.
+func checkObjectName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasSuffix(name, tmpFileSuffix) {
+		return fmt.Errorf("invalid object name %q", name)
+	}
+	return nil
+}
+
+// tmpFileSuffix is the suffix of files being written by writeFileAtomic.
+const tmpFileSuffix = ".tmp"
+
+// writeFileAtomic writes and syncs data to a temporary file, then renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + tmpFileSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// splitRangeTolerance bounds the imbalance of the halves of a range split by SplitRange by size:
+// each half may differ from half the size of the range by 1/splitRangeTolerance of it.
+const splitRangeTolerance = 32
+
+// RangeSizeEstimator is implemented by databases which can estimate the size of a key range
+// without reading it, from the metadata of their tables. Data not yet flushed to tables is usually
+// not accounted for.
+type RangeSizeEstimator interface {
+	// EstimateRangeSize returns the approximate size in bytes on disk of the keys in [start, end).
+	// A nil start or end is unbounded.
+	EstimateRangeSize(start, end []byte) (uint64, error)
+}
+
+// KeyRange is the range of keys [Start, End). A nil Start or End is unbounded.
+type KeyRange struct {
+	Start []byte
+	End   []byte
+}
+
+// rangePiece is a sub-range being split by SplitRange. Its keys are within [lo, hi), which are
+// the bounds used to split it, as Start and End may be nil.
+type rangePiece struct {
+	KeyRange
+	lo, hi []byte
+	size   uint64
+}
+
+// SplitRange splits [start, end) of db into up to n contiguous sub-ranges covering it, e.g. to
+// scan them concurrently. If db implements RangeSizeEstimator, the sub-ranges have about the same
+// size on disk. Otherwise, they span about the same part of the keyspace between the first and
+// the last key of the range, which only balances them if keys are evenly distributed. Fewer
+// sub-ranges are returned if the range is too small to be split, and none if it is empty.
+func SplitRange(db DBReader, start, end []byte, n int) ([]KeyRange, error) {
+	first, last, err := keyBounds(db, start, end)
+	if err != nil || first == nil {
+		return nil, err
+	}
+	estimator, _ := db.(RangeSizeEstimator)
+	// The upper bound just after the last key keeps it within the range when splitting.
+	pieces := []rangePiece{{KeyRange: KeyRange{Start: start, End: end}, lo: first, hi: append(cp(last), 0)}}
+	if estimator != nil {
+		if pieces[0].size, err = estimator.EstimateRangeSize(first, pieces[0].hi); err != nil {
+			return nil, err
+		}
+	}
+	// unsplittable marks the pieces without keys between their bounds, by lower bound.
+	unsplittable := make(map[string]bool)
+	for len(pieces) < n {
+		i := -1
+		for j := range pieces {
+			if !unsplittable[string(pieces[j].lo)] && (i < 0 || largerPiece(pieces[j], pieces[i])) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+		mid, err := splitPoint(estimator, pieces[i])
+		if err != nil {
+			return nil, err
+		}
+		if mid == nil {
+			unsplittable[string(pieces[i].lo)] = true
+			continue
+		}
+		left := rangePiece{KeyRange: KeyRange{Start: pieces[i].Start, End: mid}, lo: pieces[i].lo, hi: mid}
+		right := rangePiece{KeyRange: KeyRange{Start: mid, End: pieces[i].End}, lo: mid, hi: pieces[i].hi}
+		if estimator != nil {
+			if left.size, err = estimator.EstimateRangeSize(left.lo, left.hi); err != nil {
+				return nil, err
+			}
+			if right.size, err = estimator.EstimateRangeSize(right.lo, right.hi); err != nil {
+				return nil, err
+			}
+		}
+		pieces = append(pieces[:i], append([]rangePiece{left, right}, pieces[i+1:]...)...)
+	}
+
+	ranges := make([]KeyRange, 0, len(pieces))
+	for _, piece := range pieces {
+		ranges = append(ranges, piece.KeyRange)
+	}
+	return ranges, nil
+}
+
+// keyBounds returns the first and the last key of db in [start, end), or nil if there are none.
+func keyBounds(db DBReader, start, end []byte) (first, last []byte, err error) {
+	itr, err := db.Iterator(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	if itr.Valid() {
+		first = cp(itr.Key())
+	}
+	err = itr.Error()
+	itr.Close()
+	if err != nil || first == nil {
+		return nil, nil, err
+	}
+	ritr, err := db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ritr.Close()
+	if !ritr.Valid() {
+		return nil, nil, ritr.Error()
+	}
+	return first, cp(ritr.Key()), nil
+}
+
+// keyCoords returns the common prefix of lo and hi, and the 8 bytes following it in each as
+// big-endian integers, padded with zeros. Keys with the prefix and the 8 bytes of an integer
+// between x and y are between lo and hi.
+func keyCoords(lo, hi []byte) (prefix []byte, x, y uint64) {
+	n := 0
+	for n < len(lo) && n < len(hi) && lo[n] == hi[n] {
+		n++
+	}
+	var bx, by [8]byte
+	copy(bx[:], lo[n:])
+	copy(by[:], hi[n:])
+	return lo[:n], binary.BigEndian.Uint64(bx[:]), binary.BigEndian.Uint64(by[:])
+}
+
+// coordKey returns the key made of prefix and the 8 bytes of x, without trailing zeros.
+func coordKey(prefix []byte, x uint64) []byte {
+	key := binary.BigEndian.AppendUint64(cp(prefix), x)
+	return bytes.TrimRight(key, "\x00")
+}
+
+// largerPiece reports whether piece a should be split before piece b: the larger on disk if
+// known, or else the one spanning the largest part of the keyspace.
+func largerPiece(a, b rangePiece) bool {
+	if a.size != b.size {
+		return a.size > b.size
+	}
+	prefixA, xa, ya := keyCoords(a.lo, a.hi)
+	prefixB, xb, yb := keyCoords(b.lo, b.hi)
+	if len(prefixA) != len(prefixB) {
+		return len(prefixA) < len(prefixB)
+	}
+	return ya-xa > yb-xb
+}
+
+// splitPoint returns a key strictly between the bounds of piece, splitting it in two halves of
+// about the same size if estimator is set, or else of the same part of the keyspace. It returns
+// nil if the piece cannot be split.
+func splitPoint(estimator RangeSizeEstimator, piece rangePiece) ([]byte, error) {
+	prefix, x, y := keyCoords(piece.lo, piece.hi)
+	if y-x < 2 {
+		return nil, nil
+	}
+	mid := x + (y-x)/2
+	if estimator == nil || piece.size == 0 {
+		return coordKey(prefix, mid), nil
+	}
+	// Keys are often concentrated in a small part of the keyspace, so the bisection may take up
+	// to 64 steps, one for each bit of the coordinates.
+	half, tolerance := piece.size/2, piece.size/splitRangeTolerance
+	for y-x >= 2 {
+		mid = x + (y-x)/2
+		size, err := estimator.EstimateRangeSize(piece.lo, coordKey(prefix, mid))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case size+tolerance < half:
+			x = mid
+		case size > half+tolerance:
+			y = mid
+		default:
+			return coordKey(prefix, mid), nil
+		}
+	}
+	return coordKey(prefix, mid), nil
+}
+
+// ParallelScan splits [start, end) of db into up to workers sub-ranges with SplitRange, and calls
+// fn concurrently with an iterator over each of them, e.g. so that jobs over a whole store, such as
+// reindexing, use all the IO bandwidth available. Iterators are closed when fn returns. The errors
+// of all sub-ranges are joined. workers defaults to GOMAXPROCS if 0 or less.
+func ParallelScan(db DBReader, start, end []byte, workers int, fn func(r KeyRange, itr Iterator) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	ranges, err := SplitRange(db, start, end, workers)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(ranges))
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			itr, err := db.Iterator(r.Start, r.End)
+			if err != nil {
+				errs[i] = fmt.Errorf("range %X-%X: %w", r.Start, r.End, err)
+				return
+			}
+			defer itr.Close()
+			if err := fn(r, itr); err != nil {
+				errs[i] = fmt.Errorf("range %X-%X: %w", r.Start, r.End, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countRangeKeys returns the number of keys of db in each range, checking that the ranges are
+// contiguous.
+func countRangeKeys(t *testing.T, db DB, ranges []KeyRange) []int {
+	t.Helper()
+	counts := make([]int, len(ranges))
+	for i, r := range ranges {
+		if i > 0 {
+			require.Equal(t, ranges[i-1].End, r.Start)
+			require.Negative(t, bytes.Compare(ranges[i-1].Start, r.Start))
+		}
+		itr, err := db.Iterator(r.Start, r.End)
+		require.NoError(t, err)
+		for ; itr.Valid(); itr.Next() {
+			counts[i]++
+		}
+		require.NoError(t, itr.Close())
+	}
+	return counts
+}
+
+func TestSplitRange(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(bz(fmt.Sprintf("key%03d", i)), bz("value")))
+	}
+
+	ranges, err := SplitRange(db, nil, nil, 4)
+	require.NoError(t, err)
+	require.Len(t, ranges, 4)
+	require.Nil(t, ranges[0].Start)
+	require.Nil(t, ranges[3].End)
+	counts := countRangeKeys(t, db, ranges)
+	require.Equal(t, 1000, counts[0]+counts[1]+counts[2]+counts[3])
+	for _, n := range counts {
+		require.Greater(t, n, 0)
+	}
+
+	// Ranges with a single key cannot be split.
+	ranges, err = SplitRange(db, bz("key010"), bz("key011"), 4)
+	require.NoError(t, err)
+	require.Equal(t, []KeyRange{{Start: bz("key010"), End: bz("key011")}}, ranges)
+
+	ranges, err = SplitRange(db, bz("x"), nil, 4)
+	require.NoError(t, err)
+	require.Empty(t, ranges)
+}
+
+func TestSplitRangeSizes(t *testing.T) {
+	db, err := NewGoLevelDB("split", t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Most keys share a prefix, so splitting the keyspace evenly would not balance the ranges.
+	// Values are random, so that they are not compressed.
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, db.Set(bz(fmt.Sprintf("a%05d", i)), bz(randStr(1000))))
+	}
+	require.NoError(t, db.Set(bz("z"), bz(randStr(1000))))
+	require.NoError(t, db.Compact(nil, nil))
+
+	size, err := db.EstimateRangeSize(nil, nil)
+	require.NoError(t, err)
+	require.Greater(t, size, uint64(1000*1000))
+
+	ranges, err := SplitRange(db, nil, nil, 4)
+	require.NoError(t, err)
+	require.Len(t, ranges, 4)
+	counts := countRangeKeys(t, db, ranges)
+	require.Equal(t, 2001, counts[0]+counts[1]+counts[2]+counts[3])
+	for _, n := range counts {
+		require.InDelta(t, 500, n, 200)
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(bz(fmt.Sprintf("key%03d", i)), bz("value")))
+	}
+
+	var (
+		mtx  sync.Mutex
+		keys = make(map[string]bool)
+	)
+	err := ParallelScan(db, nil, nil, 8, func(_ KeyRange, itr Iterator) error {
+		for ; itr.Valid(); itr.Next() {
+			mtx.Lock()
+			require.False(t, keys[string(itr.Key())])
+			keys[string(itr.Key())] = true
+			mtx.Unlock()
+		}
+		return itr.Error()
+	})
+	require.NoError(t, err)
+	require.Len(t, keys, 1000)
+
+	// The errors of all ranges are returned.
+	errScan := errors.New("scan failed")
+	err = ParallelScan(db, nil, nil, 4, func(KeyRange, Iterator) error {
+		return errScan
+	})
+	require.ErrorIs(t, err, errScan)
+	require.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 4)
+}
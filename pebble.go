@@ -3,21 +3,187 @@ package db
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
 )
 
 func init() {
-	dbCreator := func(name string, dir string) (DB, error) {
-		return NewPebbleDB(name, dir)
+	dbCreator := func(name string, dir string, opts *dbOptions) (DB, error) {
+		return newPebbleDBWithOptions(name, dir, opts)
 	}
 	registerDBCreator(PebbleDBBackend, dbCreator)
 }
 
+// pebbleOptions holds the pebble settings that can be passed to NewDB.
+type pebbleOptions struct {
+	cache           *pebble.Cache
+	cacheSize       *int64
+	bloomBitsPerKey *int
+	forceSync       bool
+
+	compactionConcurrency   int
+	l0CompactionThreshold   int
+	l0CompactionConcurrency int
+	l0StopWritesThreshold   int
+}
+
+// PebbleForceSyncEnv is the environment variable which, when set to 1 or true, makes all pebble
+// databases behave as if opened with WithPebbleForceSync, e.g. to apply the workaround to a node
+// without changing its configuration.
+const PebbleForceSyncEnv = "COMETBFT_DB_PEBBLE_FORCE_SYNC"
+
+// WithPebbleCache makes a pebble database use the given block cache instead of allocating its own.
+// Passing the same cache to several databases lets them share one memory budget. The database
+// takes its own reference to the cache, so the caller must still call Unref on it once it no
+// longer needs it.
+func WithPebbleCache(cache *pebble.Cache) Option {
+	return func(o *dbOptions) {
+		o.pebble.cache = cache
+	}
+}
+
+// WithPebbleCacheSize sets the size in bytes of the block cache allocated by a pebble database. A
+// size of 0 disables block caching entirely. It is ignored if WithPebbleCache is also given.
+func WithPebbleCacheSize(size int64) Option {
+	return func(o *dbOptions) {
+		o.pebble.cacheSize = &size
+	}
+}
+
+// WithPebbleBloomFilter sets the number of bits per key of the bloom filters of all levels, which
+// avoid disk reads for most lookups of missing keys. Bloom filters of 10 bits per key are enabled
+// by default on the levels for which the pebble options set no filter policy, and a bitsPerKey of
+// 0 or less disables them. Note that pebble does not use the filters of the last level for point
+// lookups.
+func WithPebbleBloomFilter(bitsPerKey int) Option {
+	return func(o *dbOptions) {
+		o.pebble.bloomBitsPerKey = &bitsPerKey
+	}
+}
+
+// WithPebbleForceSync makes all writes to a pebble database synced, including Set, Delete and
+// Batch.Write, at the cost of an fsync per write. This works around lost writes on crashes for
+// applications which rely on writes being durable without using the synced methods, e.g. during
+// chain upgrades. See also PebbleForceSyncEnv.
+func WithPebbleForceSync() Option {
+	return func(o *dbOptions) {
+		o.pebble.forceSync = true
+	}
+}
+
+// WithPebbleCompactionConcurrency sets the maximum number of compactions a pebble database runs
+// concurrently, which are its only background jobs besides flushes. It can be changed on a live
+// database with PebbleDB.SetCompactionConcurrency.
+func WithPebbleCompactionConcurrency(n int) Option {
+	return func(o *dbOptions) {
+		o.pebble.compactionConcurrency = n
+	}
+}
+
+// WithPebbleL0Thresholds sets the L0 thresholds of a pebble database: the L0 read amplification
+// from which L0 is compacted, compactionThreshold, the one from which an additional compaction is
+// allowed for every further concurrencyThreshold, up to the compaction concurrency, and the one at
+// which writes are stopped, stopWritesThreshold. Thresholds of 0 or less keep the pebble defaults.
+func WithPebbleL0Thresholds(compactionThreshold, concurrencyThreshold, stopWritesThreshold int) Option {
+	return func(o *dbOptions) {
+		o.pebble.l0CompactionThreshold = compactionThreshold
+		o.pebble.l0CompactionConcurrency = concurrencyThreshold
+		o.pebble.l0StopWritesThreshold = stopWritesThreshold
+	}
+}
+
+// newPebbleDBWithOptions creates a pebble database from the options passed to NewDB.
+func newPebbleDBWithOptions(name string, dir string, o *dbOptions) (*PebbleDB, error) {
+	opts := &pebble.Options{}
+	switch {
+	case o.pebble.cache != nil:
+		opts.Cache = o.pebble.cache
+	case o.pebble.cacheSize != nil:
+		// pebble.Open takes its own reference, so the database ends up owning the cache.
+		cache := pebble.NewCache(*o.pebble.cacheSize)
+		defer cache.Unref()
+		opts.Cache = cache
+	}
+	if o.events.bus != nil {
+		events := o.events
+		opts.EventListener = &pebble.EventListener{
+			BackgroundError: func(err error) {
+				events.checkCorruption(err)
+			},
+			WriteStallBegin: func(info pebble.WriteStallBeginInfo) {
+				events.publish(EventWriteStall, nil, info.Reason, 0)
+			},
+		}
+	}
+	return newPebbleDB(name, dir, opts, o)
+}
+
+// tunePebbleOptions returns a copy of opts, which may be nil, with the defaults set and adjusted by
+// the given Options, and the compaction concurrency read by the copy. opts is not modified, so it
+// can be reused for other databases.
+func tunePebbleOptions(opts *pebble.Options, o *dbOptions) (*pebble.Options, *atomic.Int64) {
+	// EnsureDefaults sets the defaults of the levels and the event listener in place, so they are
+	// copied too.
+	opts = opts.Clone()
+	opts.Levels = slices.Clone(opts.Levels)
+	if opts.EventListener != nil {
+		listener := *opts.EventListener
+		opts.EventListener = &listener
+	}
+	opts.EnsureDefaults()
+	bitsPerKey := defaultBloomFilterBitsPerKey
+	if o.pebble.bloomBitsPerKey != nil {
+		bitsPerKey = *o.pebble.bloomBitsPerKey
+	}
+	for i := range opts.Levels {
+		switch {
+		case bitsPerKey <= 0:
+			opts.Levels[i].FilterPolicy = nil
+		case o.pebble.bloomBitsPerKey != nil || opts.Levels[i].FilterPolicy == nil:
+			opts.Levels[i].FilterPolicy = bloom.FilterPolicy(bitsPerKey)
+		}
+	}
+	if o.periodicSync.bytes > 0 {
+		opts.WALBytesPerSync = int(o.periodicSync.bytes)
+	}
+	if o.pebble.l0CompactionThreshold > 0 {
+		opts.L0CompactionThreshold = o.pebble.l0CompactionThreshold
+	}
+	if o.pebble.l0CompactionConcurrency > 0 {
+		opts.Experimental.L0CompactionConcurrency = o.pebble.l0CompactionConcurrency
+	}
+	if o.pebble.l0StopWritesThreshold > 0 {
+		opts.L0StopWritesThreshold = o.pebble.l0StopWritesThreshold
+	}
+	// pebble reads the compaction concurrency every time it schedules compactions, which lets
+	// SetCompactionConcurrency change it on a live database.
+	compactionConcurrency := &atomic.Int64{}
+	compactionConcurrency.Store(int64(opts.MaxConcurrentCompactions()))
+	if o.pebble.compactionConcurrency > 0 {
+		compactionConcurrency.Store(int64(o.pebble.compactionConcurrency))
+	}
+	opts.MaxConcurrentCompactions = func() int {
+		return int(compactionConcurrency.Load())
+	}
+	return opts, compactionConcurrency
+}
+
 // PebbleDB is a PebbleDB backend.
 type PebbleDB struct {
-	db *pebble.DB
+	db     *pebble.DB
+	path   string
+	syncer *periodicSyncer
+	stats  *statsCache
+	// compactionConcurrency is the maximum number of concurrent compactions, read by pebble.
+	compactionConcurrency *atomic.Int64
+	// writeOpts are the options of the writes which are not explicitly synced.
+	writeOpts *pebble.WriteOptions
 }
 
 var _ DB = (*PebbleDB)(nil)
@@ -28,16 +194,35 @@ func NewPebbleDB(name string, dir string) (*PebbleDB, error) {
 	return NewPebbleDBWithOpts(name, dir, opts)
 }
 
-func NewPebbleDBWithOpts(name string, dir string, opts *pebble.Options) (*PebbleDB, error) {
+// NewPebbleDBWithOpts creates a pebble database with the given pebble options, adjusted by the given
+// Options. The pebble options are not modified. Bloom filters are enabled on the levels without a
+// filter policy, see WithPebbleBloomFilter.
+func NewPebbleDBWithOpts(name string, dir string, opts *pebble.Options, options ...Option) (*PebbleDB, error) {
+	return newPebbleDB(name, dir, opts, newDBOptions(options))
+}
+
+func newPebbleDB(name string, dir string, opts *pebble.Options, o *dbOptions) (*PebbleDB, error) {
 	dbPath := filepath.Join(dir, name+".db")
-	opts.EnsureDefaults()
+	opts, compactionConcurrency := tunePebbleOptions(opts, o)
 	p, err := pebble.Open(dbPath, opts)
 	if err != nil {
 		return nil, err
 	}
-	return &PebbleDB{
-		db: p,
-	}, err
+	db := &PebbleDB{
+		db:                    p,
+		path:                  dbPath,
+		writeOpts:             pebble.NoSync,
+		stats:                 newStatsCache(o),
+		compactionConcurrency: compactionConcurrency,
+	}
+	if env := os.Getenv(PebbleForceSyncEnv); o.pebble.forceSync || env == "1" || env == "true" {
+		db.writeOpts = pebble.Sync
+	}
+	if !opts.ReadOnly {
+		// Syncs every bytes written are left to WALBytesPerSync.
+		db.syncer = newPeriodicSyncer(o.clock, periodicSyncOptions{interval: o.periodicSync.interval}, db.syncWAL)
+	}
+	return db, nil
 }
 
 // Get implements DB.
@@ -58,6 +243,24 @@ func (db *PebbleDB) Get(key []byte) ([]byte, error) {
 	return cp(res), nil
 }
 
+var _ GetAppender = (*PebbleDB)(nil)
+
+// GetAppend implements GetAppender. The value is copied straight from the block cache.
+func (db *PebbleDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	if len(key) == 0 {
+		return dst, false, errKeyEmpty
+	}
+	res, closer, err := db.db.Get(key)
+	if err != nil {
+		if err == pebble.ErrNotFound {
+			return dst, false, nil
+		}
+		return dst, false, err
+	}
+	defer closer.Close()
+	return append(dst, res...), true, nil
+}
+
 // Has implements DB.
 func (db *PebbleDB) Has(key []byte) (bool, error) {
 	if len(key) == 0 {
@@ -80,11 +283,11 @@ func (db *PebbleDB) Set(key []byte, value []byte) error {
 		return errValueNil
 	}
 
-	wopts := pebble.NoSync
-	err := db.db.Set(key, value, wopts)
+	err := db.db.Set(key, value, db.writeOpts)
 	if err != nil {
 		return err
 	}
+	db.syncer.wrote(len(key) + len(value))
 	return nil
 }
 
@@ -109,8 +312,11 @@ func (db *PebbleDB) Delete(key []byte) error {
 		return errKeyEmpty
 	}
 
-	wopts := pebble.NoSync
-	return db.db.Delete(key, wopts)
+	if err := db.db.Delete(key, db.writeOpts); err != nil {
+		return err
+	}
+	db.syncer.wrote(len(key))
+	return nil
 }
 
 // DeleteSync implements DB.
@@ -125,6 +331,23 @@ func (db *PebbleDB) DB() *pebble.DB {
 	return db.db
 }
 
+// CompactionConcurrency returns the maximum number of compactions the database runs concurrently.
+func (db *PebbleDB) CompactionConcurrency() int {
+	return int(db.compactionConcurrency.Load())
+}
+
+// SetCompactionConcurrency changes the maximum number of compactions the database runs
+// concurrently, e.g. to catch up on compactions during a maintenance window, or to leave more I/O
+// to the node during peak load. It applies from the next time compactions are scheduled, and
+// running compactions are not interrupted.
+func (db *PebbleDB) SetCompactionConcurrency(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("compaction concurrency must be positive, got %d", n)
+	}
+	db.compactionConcurrency.Store(int64(n))
+	return nil
+}
+
 func (db *PebbleDB) Compact(start, end []byte) (err error) {
 	// Currently nil,nil is an invalid range in Pebble.
 	// This was taken from https://github.com/cockroachdb/pebble/issues/1474
@@ -152,12 +375,39 @@ func (db *PebbleDB) Compact(start, end []byte) (err error) {
 	return db.db.Compact(start, end, true)
 }
 
+var _ RangeSizeEstimator = (*PebbleDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator. Data in memtables is not accounted for, and
+// the estimate includes the end key.
+func (db *PebbleDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	if start == nil || end == nil {
+		first, last, err := keyBounds(db, start, end)
+		if err != nil || first == nil {
+			return 0, err
+		}
+		start, end = first, last
+	}
+	return db.db.EstimateDiskUsage(start, end)
+}
+
 // Close implements DB.
 func (db PebbleDB) Close() error {
+	db.syncer.close()
 	db.db.Close()
 	return nil
 }
 
+// SyncError returns the error of the first failed background sync of a database opened with
+// WithPeriodicSync, if any. Writes which were not synced since then may be lost on a crash.
+func (db *PebbleDB) SyncError() error {
+	return db.syncer.error()
+}
+
+// syncWAL syncs the WAL of the database, for WithPeriodicSync, by writing an empty log record.
+func (db *PebbleDB) syncWAL() error {
+	return db.db.LogData(nil, pebble.Sync)
+}
+
 // Print implements DB.
 func (db *PebbleDB) Print() error {
 	itr, err := db.Iterator(nil, nil)
@@ -173,9 +423,22 @@ func (db *PebbleDB) Print() error {
 	return nil
 }
 
-// Stats implements DB.
-func (*PebbleDB) Stats() map[string]string {
-	return nil
+// Stats implements DB. It returns a summary of the pebble metrics, which are cached if the
+// database was opened with WithStatsCacheTTL.
+func (db *PebbleDB) Stats() map[string]string {
+	return db.stats.get(db.computeStats)
+}
+
+// computeStats returns the statistics of the database.
+func (db *PebbleDB) computeStats() map[string]string {
+	m := db.db.Metrics()
+	return map[string]string{
+		"pebble.metrics":          m.String(),
+		"pebble.disk_space_usage": strconv.FormatUint(m.DiskSpaceUsage(), 10),
+		"pebble.read_amp":         strconv.Itoa(m.ReadAmp()),
+		"pebble.memtable_size":    strconv.FormatUint(m.MemTable.Size, 10),
+		"pebble.block_cache_size": strconv.FormatInt(m.BlockCache.Size, 10),
+	}
 }
 
 // NewBatch implements DB.
@@ -218,14 +481,14 @@ func (db *PebbleDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	return newPebbleDBIterator(itr, start, end, true), nil
 }
 
-var _ Batch = (*pebbleDBBatch)(nil)
-
 type pebbleDBBatch struct {
 	db    *PebbleDB
 	batch *pebble.Batch
+	// written is the batch once written, reused by Reset.
+	written *pebble.Batch
 }
 
-var _ Batch = (*pebbleDBBatch)(nil)
+var _ AsyncBatch = (*pebbleDBBatch)(nil)
 
 func newPebbleDBBatch(db *PebbleDB) *pebbleDBBatch {
 	return &pebbleDBBatch{
@@ -265,20 +528,38 @@ func (b *pebbleDBBatch) Delete(key []byte) error {
 	return b.batch.Delete(key, nil)
 }
 
+// Count implements Batch.
+func (b *pebbleDBBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return int(b.batch.Count())
+}
+
+// SizeBytes implements Batch. It is the size of the encoded batch.
+func (b *pebbleDBBatch) SizeBytes() int {
+	// A reset batch keeps its header.
+	if b.batch == nil || b.batch.Empty() {
+		return 0
+	}
+	return b.batch.Len()
+}
+
 // Write implements Batch.
 func (b *pebbleDBBatch) Write() error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
 
-	wopts := pebble.NoSync
-	err := b.batch.Commit(wopts)
+	err := b.batch.Commit(b.db.writeOpts)
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-
-	return b.Close()
+	b.db.syncer.wrote(b.batch.Len())
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written = nil, b.batch
+	return nil
 }
 
 // WriteSync implements Batch.
@@ -290,12 +571,53 @@ func (b *pebbleDBBatch) WriteSync() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written = nil, b.batch
+	return nil
+}
+
+// WriteAsync implements AsyncBatch. The batch is applied to the memtable before returning, and
+// only the sync of the WAL is waited for in the background.
+func (b *pebbleDBBatch) WriteAsync() <-chan error {
+	result := make(chan error, 1)
+	if b.batch == nil {
+		result <- errBatchClosed
+		return result
+	}
+	if err := b.db.db.ApplyNoSyncWait(b.batch, pebble.Sync); err != nil {
+		result <- err
+		return result
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors. This is done before returning, as the caller holds the batch.
+	batch := b.batch
+	b.batch, b.written = nil, batch
+	go func() {
+		// The batch must not be closed before the sync completes.
+		result <- batch.SyncWait()
+	}()
+	return result
+}
+
+// Reset implements Batch. The underlying pebble batch is reused. After WriteAsync, the batch can
+// only be reset once the write completed.
+func (b *pebbleDBBatch) Reset() error {
+	if b.batch == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.batch, b.written = b.written, nil
+	}
+	b.batch.Reset()
+	return nil
 }
 
 // Close implements Batch.
 func (b *pebbleDBBatch) Close() error {
+	if b.batch == nil {
+		b.batch, b.written = b.written, nil
+	}
 	if b.batch != nil {
 		err := b.batch.Close()
 		if err != nil {
@@ -314,7 +636,7 @@ type pebbleDBIterator struct {
 	isInvalid  bool
 }
 
-var _ Iterator = (*pebbleDBIterator)(nil)
+var _ UnsafeIterator = (*pebbleDBIterator)(nil)
 
 func newPebbleDBIterator(source *pebble.Iterator, start, end []byte, isReverse bool) *pebbleDBIterator {
 	if isReverse {
@@ -399,6 +721,18 @@ func (itr *pebbleDBIterator) Value() []byte {
 	return itr.source.Value()
 }
 
+// UnsafeKey implements UnsafeIterator.
+func (itr *pebbleDBIterator) UnsafeKey() []byte {
+	itr.assertIsValid()
+	return itr.source.Key()
+}
+
+// UnsafeValue implements UnsafeIterator.
+func (itr *pebbleDBIterator) UnsafeValue() []byte {
+	itr.assertIsValid()
+	return itr.source.Value()
+}
+
 // Next implements Iterator.
 func (itr pebbleDBIterator) Next() {
 	itr.assertIsValid()
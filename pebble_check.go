@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+var _ Checker = (*PebbleDB)(nil)
+
+// Check implements Checker. It checks the consistency of all levels with pebble's CheckLevels,
+// validates the block checksums of every table, including blocks no iterator reads, e.g. of
+// filters, and iterates over the whole keyspace.
+func (db *PebbleDB) Check(ctx context.Context) (*CheckReport, error) {
+	levels := CheckResult{Name: "levels"}
+	var stats pebble.CheckLevelsStats
+	if err := db.db.CheckLevels(&stats); err != nil {
+		levels.addError("%v", err)
+	}
+	levels.Checked = uint64(stats.NumPoints)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tables, err := db.checkTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keyspace, err := checkKeyspace(ctx, db.Iterator)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{levels, tables, keyspace}}, nil
+}
+
+// checkTables validates the block checksums of all tables. Tables deleted by concurrent
+// compactions are skipped.
+func (db *PebbleDB) checkTables(ctx context.Context) (CheckResult, error) {
+	result := CheckResult{Name: "table-checksums"}
+	levels, err := db.db.SSTables()
+	if err != nil {
+		return result, err
+	}
+	checked := make(map[pebble.FileNum]bool)
+	for level, tables := range levels {
+		for _, table := range tables {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			// Virtual tables share the file of their backing table.
+			num := table.BackingSSTNum
+			if checked[num] {
+				continue
+			}
+			checked[num] = true
+			name := fmt.Sprintf("%s.sst", num)
+			err := validatePebbleTable(filepath.Join(db.path, name))
+			if os.IsNotExist(err) {
+				continue
+			}
+			result.Checked++
+			if err != nil {
+				result.addError("%s (level %d): %v", name, level, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// validatePebbleTable validates the checksums of all blocks of a table file.
+func validatePebbleTable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	readable, err := sstable.NewSimpleReadable(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// The reader closes the file.
+	reader, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return reader.ValidateBlockChecksums()
+}
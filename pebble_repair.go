@@ -0,0 +1,55 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// PebbleRepairReport is the result of repairing a pebble database.
+type PebbleRepairReport struct {
+	// OpenErr is the error opening the database failed with, if any, e.g. a corrupted manifest.
+	OpenErr error
+	// CheckErr is the first inconsistency found by checking all levels, if any.
+	CheckErr error
+	// Stats are the statistics of the check of the levels.
+	Stats pebble.CheckLevelsStats
+	// Recovered is set if the write-ahead log was replayed and flushed.
+	Recovered bool
+}
+
+// NeedsRepair reports whether the database failed to open or check.
+func (r *PebbleRepairReport) NeedsRepair() bool {
+	return r.OpenErr != nil || r.CheckErr != nil
+}
+
+// RepairPebbleDB recovers the pebble database with the given name, which must not be open, e.g.
+// after a crash: opening it replays its write-ahead log, dropping a torn tail, and flushes it to
+// tables, after which the consistency of all levels is checked. Unlike goleveldb, pebble cannot
+// rebuild a corrupted manifest or drop corrupted tables, so a database which fails to open or
+// check cannot be repaired in place, and its readable data must be copied out, e.g. with
+// ExportTo. If dryRun is set, the database is opened read-only and nothing is written.
+func RepairPebbleDB(name string, dir string, dryRun bool) (*PebbleRepairReport, error) {
+	dbPath := filepath.Join(dir, name+".db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	report := &PebbleRepairReport{}
+	opts := &pebble.Options{ReadOnly: dryRun, ErrorIfNotExists: true}
+	opts.EnsureDefaults()
+	pdb, err := pebble.Open(dbPath, opts)
+	if err != nil {
+		report.OpenErr = err
+		return report, nil
+	}
+	report.CheckErr = pdb.CheckLevels(&report.Stats)
+	if !dryRun {
+		if err := pdb.Flush(); err != nil {
+			pdb.Close()
+			return report, err
+		}
+		report.Recovered = true
+	}
+	return report, pdb.Close()
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairPebbleDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewPebbleDB("test", dir)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), int642Bytes(int64(i))))
+	}
+	require.NoError(t, db.Close())
+
+	report, err := RepairPebbleDB("test", dir, true)
+	require.NoError(t, err)
+	require.False(t, report.NeedsRepair())
+	require.False(t, report.Recovered)
+	require.EqualValues(t, 100, report.Stats.NumPoints)
+
+	report, err = RepairPebbleDB("test", dir, false)
+	require.NoError(t, err)
+	require.False(t, report.NeedsRepair())
+	require.True(t, report.Recovered)
+
+	// A corrupted manifest cannot be repaired.
+	manifests, err := filepath.Glob(filepath.Join(dir, "test.db", "MANIFEST-*"))
+	require.NoError(t, err)
+	for _, manifest := range manifests {
+		require.NoError(t, os.WriteFile(manifest, []byte("corrupted"), 0o600))
+	}
+	report, err = RepairPebbleDB("test", dir, false)
+	require.NoError(t, err)
+	require.Error(t, report.OpenErr)
+	require.True(t, report.NeedsRepair())
+
+	_, err = RepairPebbleDB("missing", dir, true)
+	require.Error(t, err)
+}
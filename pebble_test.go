@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,6 +22,64 @@ func TestPebbleDBBackend(t *testing.T) {
 	assert.True(t, ok)
 }
 
+func TestPebbleDBSharedCache(t *testing.T) {
+	dir := os.TempDir()
+	cache := pebble.NewCache(1 << 20)
+	defer cache.Unref()
+
+	name1 := fmt.Sprintf("test_%x", randStr(12))
+	db1, err := NewDB(name1, PebbleDBBackend, dir, WithPebbleCache(cache))
+	require.NoError(t, err)
+	defer cleanupDBDir(dir, name1)
+
+	name2 := fmt.Sprintf("test_%x", randStr(12))
+	db2, err := NewDB(name2, PebbleDBBackend, dir, WithPebbleCache(cache))
+	require.NoError(t, err)
+	defer cleanupDBDir(dir, name2)
+
+	require.NoError(t, db1.Set([]byte("a"), []byte{1}))
+	require.NoError(t, db2.Set([]byte("a"), []byte{2}))
+	checkValue(t, db1, []byte("a"), []byte{1})
+	checkValue(t, db2, []byte("a"), []byte{2})
+
+	require.NoError(t, db1.Close())
+	require.NoError(t, db2.Close())
+}
+
+func TestPebbleDBNoCache(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	dir := os.TempDir()
+	db, err := NewDB(name, PebbleDBBackend, dir, WithPebbleCacheSize(0))
+	require.NoError(t, err)
+	defer cleanupDBDir(dir, name)
+
+	require.Zero(t, db.(*PebbleDB).DB().Metrics().BlockCache.Size)
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	checkValue(t, db, []byte("a"), []byte{1})
+	require.NoError(t, db.Close())
+}
+
+func TestPebbleDBForceSync(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB("default", PebbleDBBackend, dir)
+	require.NoError(t, err)
+	require.Equal(t, pebble.NoSync, db.(*PebbleDB).writeOpts)
+	require.NoError(t, db.Close())
+
+	db, err = NewDB("option", PebbleDBBackend, dir, WithPebbleForceSync())
+	require.NoError(t, err)
+	require.Equal(t, pebble.Sync, db.(*PebbleDB).writeOpts)
+	require.NoError(t, db.Set([]byte("a"), []byte{1}))
+	checkValue(t, db, []byte("a"), []byte{1})
+	require.NoError(t, db.Close())
+
+	t.Setenv(PebbleForceSyncEnv, "1")
+	db, err = NewDB("env", PebbleDBBackend, dir)
+	require.NoError(t, err)
+	require.Equal(t, pebble.Sync, db.(*PebbleDB).writeOpts)
+	require.NoError(t, db.Close())
+}
+
 func BenchmarkPebbleDBRandomReadsWrites(b *testing.B) {
 	name := fmt.Sprintf("test_%x", randStr(12))
 	dir := os.TempDir()
@@ -37,4 +97,160 @@ func BenchmarkPebbleDBRandomReadsWrites(b *testing.B) {
 	benchmarkRandomReadsWrites(b, db)
 }
 
+func BenchmarkPebbleDBGet(b *testing.B) {
+	db, err := NewPebbleDB("bench", b.TempDir())
+	require.NoError(b, err)
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(b, db.Set(int642Bytes(int64(i)), []byte(randStr(128))))
+	}
+
+	b.Run("Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := db.Get(int642Bytes(int64(i % 1000))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetAppend", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 128)
+		for i := 0; i < b.N; i++ {
+			if buf, _, err = db.GetAppend(int642Bytes(int64(i%1000)), buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPebbleDBMissingKeys(b *testing.B) {
+	for _, bitsPerKey := range []int{0, defaultBloomFilterBitsPerKey} {
+		b.Run(fmt.Sprintf("bloom=%d", bitsPerKey), func(b *testing.B) {
+			// The block cache is much smaller than the tables, but large enough for their filters,
+			// so that lookups without filters mostly read blocks from disk.
+			cache := pebble.NewCache(1 << 20)
+			defer cache.Unref()
+			db, err := NewPebbleDBWithOpts("bench", b.TempDir(), &pebble.Options{Cache: cache},
+				WithPebbleBloomFilter(bitsPerKey))
+			require.NoError(b, err)
+			defer db.Close()
+			// The tables are flushed to L0 rather than compacted, as pebble does not use the
+			// filters of the last level for point lookups.
+			benchmarkMissingKeys(b, db, 100000, 256, db.DB().Flush)
+		})
+	}
+}
+
+func TestPebbleDBBloomFilter(t *testing.T) {
+	opts, _ := tunePebbleOptions(&pebble.Options{}, newDBOptions(nil))
+	for _, level := range opts.Levels {
+		require.Equal(t, bloom.FilterPolicy(defaultBloomFilterBitsPerKey), level.FilterPolicy)
+	}
+
+	opts, _ = tunePebbleOptions(&pebble.Options{}, newDBOptions([]Option{WithPebbleBloomFilter(0)}))
+	for _, level := range opts.Levels {
+		require.Nil(t, level.FilterPolicy)
+	}
+
+	db, err := NewPebbleDBWithOpts("bloom", t.TempDir(), &pebble.Options{})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func TestPebbleDBCompactionOptions(t *testing.T) {
+	opts, _ := tunePebbleOptions(&pebble.Options{}, newDBOptions(nil))
+	require.Equal(t, 4, opts.L0CompactionThreshold)
+	require.Equal(t, 12, opts.L0StopWritesThreshold)
+	require.Equal(t, 1, opts.MaxConcurrentCompactions())
+
+	opts, compactionConcurrency := tunePebbleOptions(&pebble.Options{}, newDBOptions([]Option{
+		WithPebbleCompactionConcurrency(4), WithPebbleL0Thresholds(2, 5, 1000),
+	}))
+	require.Equal(t, 2, opts.L0CompactionThreshold)
+	require.Equal(t, 5, opts.Experimental.L0CompactionConcurrency)
+	require.Equal(t, 1000, opts.L0StopWritesThreshold)
+	require.Equal(t, 4, opts.MaxConcurrentCompactions())
+	compactionConcurrency.Store(8)
+	require.Equal(t, 8, opts.MaxConcurrentCompactions())
+
+	dir := t.TempDir()
+	db, err := NewPebbleDBWithOpts("defaults", dir, &pebble.Options{})
+	require.NoError(t, err)
+	require.Equal(t, 1, db.CompactionConcurrency())
+	require.NoError(t, db.Close())
+
+	db, err = NewPebbleDBWithOpts("tuned", dir, &pebble.Options{}, WithPebbleCompactionConcurrency(4))
+	require.NoError(t, err)
+	defer db.Close()
+	require.Equal(t, 4, db.CompactionConcurrency())
+
+	// The concurrency can be changed on the live database.
+	require.NoError(t, db.SetCompactionConcurrency(8))
+	require.Equal(t, 8, db.CompactionConcurrency())
+	require.Error(t, db.SetCompactionConcurrency(0))
+	require.Equal(t, 8, db.CompactionConcurrency())
+}
+
+func TestPebbleDBOptionsReused(t *testing.T) {
+	opts := &pebble.Options{}
+	opts.EnsureDefaults()
+
+	// The options are not modified, so the databases opened with them are independent.
+	dir := t.TempDir()
+	db1, err := NewPebbleDBWithOpts("db1", dir, opts)
+	require.NoError(t, err)
+	defer db1.Close()
+	db2, err := NewPebbleDBWithOpts("db2", dir, opts)
+	require.NoError(t, err)
+	defer db2.Close()
+	for _, level := range opts.Levels {
+		require.Nil(t, level.FilterPolicy)
+	}
+
+	require.NoError(t, db1.SetCompactionConcurrency(4))
+	require.NoError(t, db2.SetCompactionConcurrency(2))
+	require.Equal(t, 4, db1.CompactionConcurrency())
+	require.Equal(t, 2, db2.CompactionConcurrency())
+	require.Equal(t, 1, opts.MaxConcurrentCompactions())
+}
+
 // TODO: Add tests for pebble
+
+func TestPebbleDBWriteAsync(t *testing.T) {
+	name := fmt.Sprintf("test_%x", randStr(12))
+	dir := t.TempDir()
+	db, err := NewPebbleDB(name, dir)
+	require.NoError(t, err)
+	defer db.Close()
+
+	batch := db.NewBatch()
+	require.Implements(t, (*AsyncBatch)(nil), batch)
+	require.NoError(t, batch.Set([]byte("a"), []byte{1}))
+	var writer AsyncWriter
+	result := writer.WriteAsync(batch)
+	// The batch is applied and marked written before WriteAsync returns.
+	checkValue(t, db, []byte("a"), []byte{1})
+	require.ErrorIs(t, batch.Set([]byte("b"), []byte{2}), errBatchClosed)
+	require.NoError(t, <-result)
+	require.NoError(t, batch.Close())
+	require.ErrorIs(t, <-writer.WriteAsync(batch), errBatchClosed)
+}
+
+func TestPebbleDBEstimateRangeSize(t *testing.T) {
+	db, err := NewPebbleDB("estimate", t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(randStr(100))))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+
+	total, err := db.EstimateRangeSize(nil, nil)
+	require.NoError(t, err)
+	require.Greater(t, total, uint64(1000*100))
+	part, err := db.EstimateRangeSize([]byte("key000"), []byte("key500"))
+	require.NoError(t, err)
+	require.Less(t, part, total)
+}
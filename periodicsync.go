@@ -0,0 +1,128 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// periodicSyncOptions holds the durability policy set by WithPeriodicSync.
+type periodicSyncOptions struct {
+	interval time.Duration
+	bytes    int64
+}
+
+// WithPeriodicSync sets a durability policy between syncing every write and syncing none of them:
+// writes which are not synced, such as Set and Batch.Write, are synced to disk in the background
+// at least every interval, and every bytes written, whichever comes first. This bounds the writes
+// lost on a crash without paying an fsync per write. A zero interval or bytes disables that
+// bound. Writes which are synced, such as SetSync and Batch.WriteSync, are unaffected.
+//
+// It applies to goleveldb, which syncs its journal from a background goroutine, and pebble, which
+// syncs its WAL every interval from a background goroutine and every bytes written with its
+// WALBytesPerSync option. Writes which were applied do not fail if a background sync fails: the
+// first failed background sync is reported by the SyncError method of the database instead.
+func WithPeriodicSync(interval time.Duration, bytes int64) Option {
+	return func(o *dbOptions) {
+		o.periodicSync = periodicSyncOptions{interval: interval, bytes: bytes}
+	}
+}
+
+// periodicSyncer calls sync from a background goroutine every interval, and once bytes have been
+// written, if anything was written since the previous sync. The methods of a nil periodicSyncer do
+// nothing, so that databases without a durability policy need no checks.
+type periodicSyncer struct {
+	sync     func() error
+	clock    Clock
+	opts     periodicSyncOptions
+	written  atomic.Int64  // bytes written since the last sync
+	trigger  chan struct{} // signaled once bytes have been written
+	done     chan struct{} // closed by close to stop the goroutine
+	finished chan struct{} // closed by the goroutine when it returns
+	stop     sync.Once
+
+	mtx sync.Mutex
+	err error // the first failed sync
+}
+
+// newPeriodicSyncer starts a periodicSyncer calling sync according to opts, or returns nil if opts
+// set no bound.
+func newPeriodicSyncer(clock Clock, opts periodicSyncOptions, sync func() error) *periodicSyncer {
+	if opts.interval <= 0 && opts.bytes <= 0 {
+		return nil
+	}
+	s := &periodicSyncer{
+		sync:     sync,
+		clock:    clock,
+		opts:     opts,
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run syncs whenever the interval elapses or bytes have been written, until the syncer is closed.
+func (s *periodicSyncer) run() {
+	defer close(s.finished)
+	for {
+		var tick <-chan time.Time
+		if s.opts.interval > 0 {
+			tick = s.clock.After(s.opts.interval)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-tick:
+		case <-s.trigger:
+		}
+		// Syncing is skipped if nothing was written since the previous sync.
+		if s.written.Swap(0) == 0 {
+			continue
+		}
+		if err := s.sync(); err != nil {
+			s.mtx.Lock()
+			if s.err == nil {
+				s.err = err
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// wrote records that n bytes were written without syncing.
+func (s *periodicSyncer) wrote(n int) {
+	if s == nil {
+		return
+	}
+	// At least 1 is recorded, so that writes of empty values are synced too.
+	written := s.written.Add(int64(max(n, 1)))
+	if s.opts.bytes > 0 && written >= s.opts.bytes {
+		select {
+		case s.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// error returns the error of the first failed background sync, if any.
+func (s *periodicSyncer) error() error {
+	if s == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// close stops the background goroutine. It can be called more than once.
+func (s *periodicSyncer) close() {
+	if s == nil {
+		return
+	}
+	s.stop.Do(func() {
+		close(s.done)
+	})
+	<-s.finished
+}
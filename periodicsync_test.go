@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodicSyncerInterval(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	var syncs atomic.Int64
+	s := newPeriodicSyncer(clock, periodicSyncOptions{interval: time.Second}, func() error {
+		syncs.Add(1)
+		return nil
+	})
+	defer s.close()
+
+	// Nothing is synced if nothing was written.
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	require.Zero(t, syncs.Load())
+
+	s.wrote(10)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool { return syncs.Load() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestPeriodicSyncerBytes(t *testing.T) {
+	synced := make(chan struct{}, 10)
+	s := newPeriodicSyncer(SystemClock, periodicSyncOptions{bytes: 100}, func() error {
+		synced <- struct{}{}
+		return nil
+	})
+	defer s.close()
+
+	s.wrote(60)
+	select {
+	case <-synced:
+		t.Fatal("synced before writing enough bytes")
+	case <-time.After(10 * time.Millisecond):
+	}
+	s.wrote(60)
+	<-synced
+}
+
+func TestPeriodicSyncerError(t *testing.T) {
+	errSync := errors.New("sync failed")
+	s := newPeriodicSyncer(SystemClock, periodicSyncOptions{bytes: 1}, func() error {
+		return errSync
+	})
+	defer s.close()
+
+	s.wrote(1)
+	require.Eventually(t, func() bool {
+		s.wrote(1)
+		return errors.Is(s.error(), errSync)
+	}, time.Second, time.Millisecond)
+
+	// The syncer can be closed more than once.
+	s.close()
+}
+
+func TestGoLevelDBPeriodicSyncJournal(t *testing.T) {
+	db, err := NewDB("test", GoLevelDBBackend, t.TempDir(), WithPeriodicSync(time.Hour, 0))
+	require.NoError(t, err)
+	gdb := db.(*GoLevelDB)
+
+	// The journal is synced on its own, without writing to the database.
+	require.NoError(t, db.Set(bz("a"), bz("1")))
+	require.NotNil(t, gdb.journal.journal)
+	require.NoError(t, gdb.journal.sync())
+
+	// Closing the database twice fails, but does not panic.
+	require.NoError(t, db.Close())
+	require.NoError(t, gdb.journal.sync())
+	require.Error(t, db.Close())
+}
+
+func TestPeriodicSyncerDisabled(t *testing.T) {
+	s := newPeriodicSyncer(SystemClock, periodicSyncOptions{}, func() error {
+		panic("unexpected sync")
+	})
+	require.Nil(t, s)
+	s.wrote(1)
+	require.NoError(t, s.error())
+	s.close()
+}
+
+func TestDBPeriodicSync(t *testing.T) {
+	for _, backend := range []BackendType{GoLevelDBBackend, PebbleDBBackend} {
+		t.Run(string(backend), func(t *testing.T) {
+			dir := t.TempDir()
+			name := fmt.Sprintf("test_%x", randStr(12))
+			db, err := NewDB(name, backend, dir, WithPeriodicSync(time.Millisecond, 100))
+			require.NoError(t, err)
+
+			for i := 0; i < 100; i++ {
+				require.NoError(t, db.Set([]byte(fmt.Sprintf("key%02d", i)), []byte("value")))
+			}
+			require.NoError(t, db.Delete([]byte("key00")))
+			batch := db.NewBatch()
+			require.NoError(t, batch.Set([]byte("batch"), []byte("value")))
+			require.NoError(t, batch.Write())
+			require.NoError(t, batch.Close())
+			time.Sleep(10 * time.Millisecond)
+			require.NoError(t, db.(interface{ SyncError() error }).SyncError())
+			require.NoError(t, db.Close())
+
+			// The syncs leave no entries behind.
+			db, err = NewDB(name, backend, dir)
+			require.NoError(t, err)
+			defer db.Close()
+			itr, err := db.Iterator(nil, nil)
+			require.NoError(t, err)
+			defer itr.Close()
+			count := 0
+			for ; itr.Valid(); itr.Next() {
+				require.NotEmpty(t, itr.Key())
+				count++
+			}
+			require.NoError(t, itr.Error())
+			require.Equal(t, 100, count)
+		})
+	}
+}
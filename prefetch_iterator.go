@@ -0,0 +1,147 @@
+package db
+
+const (
+	defaultPrefetchSize = 1024
+	// prefetchChunkSize is the maximum number of entries passed at once from the background
+	// goroutine of a prefetchIterator, so that it synchronizes once per chunk rather than per entry.
+	prefetchChunkSize = 64
+)
+
+// prefetchChunk is a chunk of entries read ahead by a prefetchIterator. Keys and values share a
+// single buffer.
+type prefetchChunk struct {
+	keys   [][]byte
+	values [][]byte
+	// last is set on the last chunk, along with the error of the source, if any.
+	last bool
+	err  error
+}
+
+// prefetchIterator reads the entries of its source ahead on a background goroutine.
+type prefetchIterator struct {
+	start, end []byte
+	source     Iterator
+	chunks     chan prefetchChunk
+	done       chan struct{} // closed by Close to stop the goroutine
+	finished   chan struct{} // closed by the goroutine when it returns
+	chunk      prefetchChunk
+	i          int // index of the current entry in chunk
+	closed     bool
+}
+
+var _ Iterator = (*prefetchIterator)(nil)
+
+// NewPrefetchIterator wraps source, reading up to size of its next entries ahead on a background
+// goroutine, so that the latency of the source, such as reads from disk or from a remote store,
+// overlaps with the processing of the entries. It is meant for sequential scans of large ranges,
+// where the entries read ahead are not wasted. size defaults to 1024 if 0 or less.
+//
+// The source must not be used afterwards, and is closed by Close. Keys and values are copied, and
+// remain valid after Next.
+func NewPrefetchIterator(source Iterator, size int) Iterator {
+	if size <= 0 {
+		size = defaultPrefetchSize
+	}
+	chunkSize := min(size, prefetchChunkSize)
+	start, end := source.Domain()
+	itr := &prefetchIterator{
+		start:    start,
+		end:      end,
+		source:   source,
+		chunks:   make(chan prefetchChunk, max(size/chunkSize-1, 0)),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go itr.prefetch(chunkSize)
+	itr.chunk = <-itr.chunks
+	return itr
+}
+
+// prefetch reads chunks of entries from the source until it is exhausted or the iterator is closed.
+func (itr *prefetchIterator) prefetch(chunkSize int) {
+	defer close(itr.finished)
+	for {
+		var (
+			chunk prefetchChunk
+			buf   []byte
+			ends  []int // end offsets in buf of each key and value
+		)
+		for len(ends) < 2*chunkSize && itr.source.Valid() {
+			buf = append(buf, UnsafeKey(itr.source)...)
+			ends = append(ends, len(buf))
+			buf = append(buf, UnsafeValue(itr.source)...)
+			ends = append(ends, len(buf))
+			itr.source.Next()
+		}
+		offset := 0
+		for i := 0; i < len(ends); i += 2 {
+			chunk.keys = append(chunk.keys, buf[offset:ends[i]:ends[i]])
+			chunk.values = append(chunk.values, buf[ends[i]:ends[i+1]:ends[i+1]])
+			offset = ends[i+1]
+		}
+		if !itr.source.Valid() {
+			chunk.last, chunk.err = true, itr.source.Error()
+		}
+		select {
+		case itr.chunks <- chunk:
+		case <-itr.done:
+			return
+		}
+		if chunk.last {
+			return
+		}
+	}
+}
+
+// Domain implements Iterator.
+func (itr *prefetchIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements Iterator.
+func (itr *prefetchIterator) Valid() bool {
+	return !itr.closed && itr.i < len(itr.chunk.keys)
+}
+
+// Next implements Iterator.
+func (itr *prefetchIterator) Next() {
+	itr.assertIsValid()
+	itr.i++
+	if itr.i == len(itr.chunk.keys) && !itr.chunk.last {
+		itr.chunk, itr.i = <-itr.chunks, 0
+	}
+}
+
+// Key implements Iterator.
+func (itr *prefetchIterator) Key() []byte {
+	itr.assertIsValid()
+	return itr.chunk.keys[itr.i]
+}
+
+// Value implements Iterator.
+func (itr *prefetchIterator) Value() []byte {
+	itr.assertIsValid()
+	return itr.chunk.values[itr.i]
+}
+
+// Error implements Iterator.
+func (itr *prefetchIterator) Error() error {
+	return itr.chunk.err
+}
+
+// Close implements Iterator.
+func (itr *prefetchIterator) Close() error {
+	if itr.closed {
+		return nil
+	}
+	itr.closed = true
+	close(itr.done)
+	<-itr.finished
+	return itr.source.Close()
+}
+
+func (itr *prefetchIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingIterator is an iterator which fails after its source is exhausted.
+type failingIterator struct {
+	Iterator
+	err    error
+	closed bool
+}
+
+func (itr *failingIterator) Error() error {
+	if itr.Iterator.Valid() {
+		return nil
+	}
+	return itr.err
+}
+
+func (itr *failingIterator) Close() error {
+	itr.closed = true
+	return itr.Iterator.Close()
+}
+
+func TestPrefetchIterator(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(bz(fmt.Sprintf("key%03d", i)), bz(fmt.Sprintf("value%d", i))))
+	}
+
+	for _, size := range []int{0, 1, 10, 64, 100, 5000} {
+		t.Run(fmt.Sprintf("size %d", size), func(t *testing.T) {
+			source, err := db.ReverseIterator(bz("key100"), nil)
+			require.NoError(t, err)
+			itr := NewPrefetchIterator(source, size)
+			start, end := itr.Domain()
+			require.Equal(t, bz("key100"), start)
+			require.Nil(t, end)
+
+			var keys [][]byte
+			for i := 999; itr.Valid(); i-- {
+				require.Equal(t, fmt.Sprintf("key%03d", i), string(itr.Key()))
+				require.Equal(t, fmt.Sprintf("value%d", i), string(itr.Value()))
+				keys = append(keys, itr.Key())
+				itr.Next()
+			}
+			require.NoError(t, itr.Error())
+			require.Len(t, keys, 900)
+			// Keys remain valid after Next.
+			require.Equal(t, "key999", string(keys[0]))
+			require.Panics(t, itr.Next)
+			require.NoError(t, itr.Close())
+			require.NoError(t, itr.Close())
+		})
+	}
+}
+
+func TestPrefetchIteratorClose(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Set(bz(fmt.Sprintf("key%03d", i)), bz("value")))
+	}
+	source, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	failing := &failingIterator{Iterator: source}
+	itr := NewPrefetchIterator(failing, 10)
+	require.True(t, itr.Valid())
+	itr.Next()
+
+	// Closing stops the background goroutine before closing the source.
+	require.NoError(t, itr.Close())
+	require.True(t, failing.closed)
+	require.False(t, itr.Valid())
+}
+
+func TestPrefetchIteratorError(t *testing.T) {
+	db := NewMemDB()
+	require.NoError(t, db.Set(bz("key"), bz("value")))
+	source, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	errSource := errors.New("read failed")
+	itr := NewPrefetchIterator(&failingIterator{Iterator: source, err: errSource}, 10)
+	defer itr.Close()
+
+	require.True(t, itr.Valid())
+	itr.Next()
+	require.False(t, itr.Valid())
+	require.ErrorIs(t, itr.Error(), errSource)
+}
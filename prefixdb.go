@@ -38,6 +38,20 @@ func (pdb *PrefixDB) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
+var _ GetAppender = (*PrefixDB)(nil)
+
+// GetAppend implements GetAppender. The value is read into dst without an intermediate copy if
+// the underlying database is a GetAppender.
+func (pdb *PrefixDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	if len(key) == 0 {
+		return dst, false, errKeyEmpty
+	}
+	pdb.mtx.Lock()
+	defer pdb.mtx.Unlock()
+
+	return GetAppend(pdb.db, pdb.prefixed(key), dst)
+}
+
 // Has implements DB.
 func (pdb *PrefixDB) Has(key []byte) (bool, error) {
 	if len(key) == 0 {
@@ -113,13 +127,7 @@ func (pdb *PrefixDB) Iterator(start, end []byte) (Iterator, error) {
 	pdb.mtx.Lock()
 	defer pdb.mtx.Unlock()
 
-	var pstart, pend []byte
-	pstart = append(cp(pdb.prefix), start...)
-	if end == nil {
-		pend = cpIncr(pdb.prefix)
-	} else {
-		pend = append(cp(pdb.prefix), end...)
-	}
+	pstart, pend := pdb.prefixedRange(start, end)
 	itr, err := pdb.db.Iterator(pstart, pend)
 	if err != nil {
 		return nil, err
@@ -136,13 +144,7 @@ func (pdb *PrefixDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	pdb.mtx.Lock()
 	defer pdb.mtx.Unlock()
 
-	var pstart, pend []byte
-	pstart = append(cp(pdb.prefix), start...)
-	if end == nil {
-		pend = cpIncr(pdb.prefix)
-	} else {
-		pend = append(cp(pdb.prefix), end...)
-	}
+	pstart, pend := pdb.prefixedRange(start, end)
 	ritr, err := pdb.db.ReverseIterator(pstart, pend)
 	if err != nil {
 		return nil, err
@@ -151,6 +153,22 @@ func (pdb *PrefixDB) ReverseIterator(start, end []byte) (Iterator, error) {
 	return newPrefixIterator(pdb.prefix, start, end, ritr)
 }
 
+// prefixedRange returns the range of the underlying database covering [start, end) within the
+// prefix. A nil bound of an empty prefix remains unbounded, and so does a nil end of a prefix made
+// only of 0xFF bytes.
+func (pdb *PrefixDB) prefixedRange(start, end []byte) (pstart, pend []byte) {
+	if len(pdb.prefix) == 0 {
+		return start, end
+	}
+	pstart = append(cp(pdb.prefix), start...)
+	if end == nil {
+		pend = prefixEnd(pdb.prefix)
+	} else {
+		pend = append(cp(pdb.prefix), end...)
+	}
+	return pstart, pend
+}
+
 // NewBatch implements DB.
 func (pdb *PrefixDB) NewBatch() Batch {
 	pdb.mtx.Lock()
@@ -203,3 +221,16 @@ func (pdb *PrefixDB) prefixed(key []byte) []byte {
 func (pdb *PrefixDB) Compact(start, end []byte) error {
 	return pdb.db.Compact(start, end)
 }
+
+var _ RangeSizeEstimator = (*PrefixDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator, if the underlying database does. Otherwise, it
+// returns 0.
+func (pdb *PrefixDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	estimator, ok := pdb.db.(RangeSizeEstimator)
+	if !ok {
+		return 0, nil
+	}
+	pstart, pend := pdb.prefixedRange(start, end)
+	return estimator.EstimateRangeSize(pstart, pend)
+}
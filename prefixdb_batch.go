@@ -35,6 +35,16 @@ func (pb prefixDBBatch) Delete(key []byte) error {
 	return pb.source.Delete(pkey)
 }
 
+// Count implements Batch.
+func (pb prefixDBBatch) Count() int {
+	return pb.source.Count()
+}
+
+// SizeBytes implements Batch.
+func (pb prefixDBBatch) SizeBytes() int {
+	return pb.source.SizeBytes()
+}
+
 // Write implements Batch.
 func (pb prefixDBBatch) Write() error {
 	return pb.source.Write()
@@ -45,6 +55,11 @@ func (pb prefixDBBatch) WriteSync() error {
 	return pb.source.WriteSync()
 }
 
+// Reset implements Batch.
+func (pb prefixDBBatch) Reset() error {
+	return pb.source.Reset()
+}
+
 // Close implements Batch.
 func (pb prefixDBBatch) Close() error {
 	return pb.source.Close()
@@ -14,7 +14,7 @@ func IteratePrefix(db DB, prefix []byte) (Iterator, error) {
 		end = nil
 	} else {
 		start = cp(prefix)
-		end = cpIncr(prefix)
+		end = prefixEnd(prefix)
 	}
 	itr, err := db.Iterator(start, end)
 	if err != nil {
@@ -33,7 +33,7 @@ type prefixDBIterator struct {
 	err    error
 }
 
-var _ Iterator = (*prefixDBIterator)(nil)
+var _ UnsafeIterator = (*prefixDBIterator)(nil)
 
 func newPrefixIterator(prefix, start, end []byte, source Iterator) (*prefixDBIterator, error) { //nolint:unparam
 	pitrInvalid := &prefixDBIterator{
@@ -111,6 +111,20 @@ func (itr *prefixDBIterator) Value() []byte {
 	return itr.source.Value()
 }
 
+// UnsafeKey implements UnsafeIterator. It does not copy the key if the underlying iterator is an
+// UnsafeIterator.
+func (itr *prefixDBIterator) UnsafeKey() []byte {
+	itr.assertIsValid()
+	return UnsafeKey(itr.source)[len(itr.prefix):]
+}
+
+// UnsafeValue implements UnsafeIterator. It does not copy the value if the underlying iterator is
+// an UnsafeIterator.
+func (itr *prefixDBIterator) UnsafeValue() []byte {
+	itr.assertIsValid()
+	return UnsafeValue(itr.source)
+}
+
 // Error implements Iterator.
 func (itr *prefixDBIterator) Error() error {
 	if err := itr.source.Error(); err != nil {
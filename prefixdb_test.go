@@ -121,3 +121,76 @@ func TestPrefixDBReverseIterator7(t *testing.T) {
 	err = itr.Close()
 	require.NoError(t, err)
 }
+
+func TestPrefixDBEndOfPrefix(t *testing.T) {
+	db := NewMemDB()
+	require.NoError(t, db.Set([]byte{0x01, 0xff}, bz("prefix")))
+	require.NoError(t, db.Set([]byte{0x01, 0xff, 0x00}, bz("first")))
+	require.NoError(t, db.Set([]byte{0x01, 0xff, 0xff}, bz("last")))
+	require.NoError(t, db.Set([]byte{0x02}, bz("after")))
+	require.NoError(t, db.Set([]byte{0x02, 0x00}, bz("after")))
+	pdb := NewPrefixDB(db, []byte{0x01, 0xff})
+
+	itr, err := pdb.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte{0xff}, bz("last"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte{0x00}, bz("first"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	itr, err = pdb.ReverseIterator([]byte{0x01}, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte{0xff}, bz("last"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	itr, err = pdb.Iterator(nil, []byte{0xff})
+	require.NoError(t, err)
+	checkItem(t, itr, []byte{0x00}, bz("first"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+}
+
+func TestPrefixDBMaxPrefix(t *testing.T) {
+	db := NewMemDB()
+	require.NoError(t, db.Set([]byte{0xfe, 0x01}, bz("before")))
+	require.NoError(t, db.Set([]byte{0xff, 0xff, 0x01}, bz("a")))
+	require.NoError(t, db.Set([]byte{0xff, 0xff, 0xff, 0xff}, bz("b")))
+	pdb := NewPrefixDB(db, []byte{0xff, 0xff})
+
+	itr, err := pdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte{0x01}, bz("a"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte{0xff, 0xff}, bz("b"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	itr, err = pdb.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, []byte{0xff, 0xff}, bz("b"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, []byte{0x01}, bz("a"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+}
+
+func TestPrefixDBEmptyPrefix(t *testing.T) {
+	db := mockDBWithStuff(t)
+	pdb := NewPrefixDB(db, nil)
+
+	checkValue(t, pdb, bz("key1"), bz("value1"))
+	itr, err := pdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, bz("k"), bz("val"))
+	require.NoError(t, itr.Close())
+
+	itr, err = pdb.ReverseIterator(bz("key3"), nil)
+	require.NoError(t, err)
+	checkItem(t, itr, bz("something"), bz("else"))
+	checkNext(t, itr, true)
+	checkItem(t, itr, bz("key3"), bz("value3"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+}
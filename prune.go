@@ -0,0 +1,102 @@
+package db
+
+import "time"
+
+// defaultPruneBatchSize is the number of keys deleted per batch by PruneRange if none is given.
+const defaultPruneBatchSize = 1000
+
+// PruneConfig configures PruneRange. Zero values are replaced by defaults.
+type PruneConfig struct {
+	// BatchSize is the number of keys deleted per batch. Defaults to 1000.
+	BatchSize int
+	// Rate is the maximum number of keys deleted per second, to bound the impact of pruning on
+	// other users of the database. Defaults to no limit.
+	Rate float64
+	// Progress, if set, is called after every batch with the number of keys deleted so far.
+	Progress func(deleted int)
+	// Clock is the clock used for throttling. Defaults to SystemClock.
+	Clock Clock
+}
+
+// PruneRange deletes all keys in the range [start, end) of db in synced batches, throttled to
+// cfg.Rate keys per second, and returns the number of keys deleted. Keys of each batch are read
+// with a new iterator, so that iterators are not held open across deletions. Space is only
+// reclaimed once the range is compacted, e.g. with db.Compact(start, end).
+func PruneRange(db DB, start, end []byte, cfg PruneConfig) (int, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultPruneBatchSize
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	limiter := newRateLimiter(cfg.Clock, cfg.Rate)
+	deleted := 0
+	for {
+		keys, err := readKeys(db, start, end, cfg.BatchSize)
+		if err != nil || len(keys) == 0 {
+			return deleted, err
+		}
+		batch := db.NewBatch()
+		for _, key := range keys {
+			if err := batch.Delete(key); err != nil {
+				batch.Close()
+				return deleted, err
+			}
+		}
+		err = batch.WriteSync()
+		if closeErr := batch.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(keys)
+		if cfg.Progress != nil {
+			cfg.Progress(deleted)
+		}
+		if len(keys) < cfg.BatchSize {
+			return deleted, nil
+		}
+		start = append(keys[len(keys)-1], 0x00)
+		limiter.wait(len(keys))
+	}
+}
+
+// readKeys returns up to limit keys of the range [start, end) of db.
+func readKeys(db DBReader, start, end []byte, limit int) ([][]byte, error) {
+	itr, err := db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	var keys [][]byte
+	for ; itr.Valid() && len(keys) < limit; itr.Next() {
+		keys = append(keys, cp(itr.Key()))
+	}
+	return keys, itr.Error()
+}
+
+// rateLimiter paces operations to a rate per second, measured since it was created.
+type rateLimiter struct {
+	clock Clock
+	rate  float64
+	start time.Time
+	ops   float64
+}
+
+// newRateLimiter creates a limiter for the given rate, which does not limit if not positive.
+func newRateLimiter(clock Clock, rate float64) *rateLimiter {
+	return &rateLimiter{clock: clock, rate: rate, start: clock.Now()}
+}
+
+// wait records n operations, and waits until they are within the rate.
+func (l *rateLimiter) wait(n int) {
+	if l.rate <= 0 {
+		return
+	}
+	l.ops += float64(n)
+	due := l.start.Add(time.Duration(l.ops / l.rate * float64(time.Second)))
+	if d := due.Sub(l.clock.Now()); d > 0 {
+		<-l.clock.After(d)
+	}
+}
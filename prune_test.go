@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneRange(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), bz("v")))
+	}
+
+	var progress []int
+	deleted, err := PruneRange(db, int642Bytes(10), int642Bytes(55), PruneConfig{
+		BatchSize: 20,
+		Progress:  func(deleted int) { progress = append(progress, deleted) },
+	})
+	require.NoError(t, err)
+	require.Equal(t, 45, deleted)
+	require.Equal(t, []int{20, 40, 45}, progress)
+	checkValue(t, db, int642Bytes(9), bz("v"))
+	checkValue(t, db, int642Bytes(10), nil)
+	checkValue(t, db, int642Bytes(54), nil)
+	checkValue(t, db, int642Bytes(55), bz("v"))
+
+	deleted, err = PruneRange(db, int642Bytes(10), int642Bytes(55), PruneConfig{})
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestPruneRangeRate(t *testing.T) {
+	db := NewMemDB()
+	for i := 0; i < 30; i++ {
+		require.NoError(t, db.Set(int642Bytes(int64(i)), bz("v")))
+	}
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	done := make(chan int)
+	go func() {
+		deleted, err := PruneRange(db, nil, nil, PruneConfig{BatchSize: 10, Rate: 5, Clock: clock})
+		require.NoError(t, err)
+		done <- deleted
+	}()
+
+	// Every full batch of 10 keys waits for 2s at 5 keys per second.
+	for i := 0; i < 2; i++ {
+		require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+		clock.Advance(2 * time.Second)
+	}
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("pruning finished before being throttled")
+	default:
+	}
+	clock.Advance(2 * time.Second)
+	require.Equal(t, 30, <-done)
+}
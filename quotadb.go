@@ -0,0 +1,328 @@
+package db
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// quotaDBRefreshInterval is the minimum time between two estimations of the size of a QuotaDB
+// caused by writes exceeding the quota, as estimating may walk the whole database directory.
+const quotaDBRefreshInterval = 10 * time.Second
+
+// ErrQuotaExceeded is returned by a QuotaDB when a write would exceed its size quota.
+var ErrQuotaExceeded = errors.New("database size quota exceeded")
+
+// SizeEstimator estimates the size in bytes of a database, e.g. on disk.
+type SizeEstimator func() (int64, error)
+
+// DirSize returns a SizeEstimator summing the sizes of the files within dir, e.g. the directory of
+// a database opened by NewDB.
+func DirSize(dir string) SizeEstimator {
+	return func() (int64, error) {
+		var size int64
+		err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				// The file was removed in the meantime, e.g. by a compaction.
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			size += info.Size()
+			return nil
+		})
+		return size, err
+	}
+}
+
+// QuotaDB wraps a database, and fails writes with ErrQuotaExceeded once its approximate size would
+// exceed a limit, so that a node on a fixed-size volume stops gracefully instead of filling the
+// disk. Deletes, and batches made only of deletes, are always allowed, so that data can be pruned.
+//
+// The size is estimated when the database is wrapped, and the size of the keys and values written
+// is added to it. As writes are usually compressed and compacted away over time, the size is
+// estimated again when the quota would be exceeded, at most every 10 seconds, and on Compact.
+type QuotaDB struct {
+	db       DB
+	maxBytes int64
+	estimate SizeEstimator
+	clock    Clock
+
+	mtx         sync.Mutex
+	size        int64
+	lastRefresh time.Time
+}
+
+var _ DB = (*QuotaDB)(nil)
+
+// NewQuotaDB wraps db, limiting its size to maxBytes. The size is estimated with estimate, or
+// only accounts for the writes through the wrapper if estimate is nil.
+func NewQuotaDB(db DB, maxBytes int64, estimate SizeEstimator) (*QuotaDB, error) {
+	qdb := &QuotaDB{
+		db:       db,
+		maxBytes: maxBytes,
+		estimate: estimate,
+		clock:    SystemClock,
+	}
+	if err := qdb.Refresh(); err != nil {
+		return nil, err
+	}
+	return qdb, nil
+}
+
+// Refresh estimates the size of the database again.
+func (qdb *QuotaDB) Refresh() error {
+	qdb.mtx.Lock()
+	defer qdb.mtx.Unlock()
+	return qdb.refresh()
+}
+
+// refresh estimates the size of the database. It must be called with the lock held.
+func (qdb *QuotaDB) refresh() error {
+	qdb.lastRefresh = qdb.clock.Now()
+	if qdb.estimate == nil {
+		return nil
+	}
+	size, err := qdb.estimate()
+	if err != nil {
+		return err
+	}
+	qdb.size = size
+	return nil
+}
+
+// Headroom returns the number of bytes which can still be written before reaching the quota, which
+// is negative if it has been exceeded.
+func (qdb *QuotaDB) Headroom() int64 {
+	qdb.mtx.Lock()
+	defer qdb.mtx.Unlock()
+	return qdb.maxBytes - qdb.size
+}
+
+// RegisterMetrics registers a gauge of the headroom of the database with the given name, named
+// storage_quota_headroom_bytes within namespace, with reg.
+func (qdb *QuotaDB) RegisterMetrics(namespace, name string, reg prometheus.Registerer) error {
+	return reg.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "storage",
+		Name:        "quota_headroom_bytes",
+		Help:        "Number of bytes which can still be written before reaching the size quota.",
+		ConstLabels: prometheus.Labels{"db": name},
+	}, func() float64 {
+		return float64(qdb.Headroom())
+	}))
+}
+
+// reserve accounts for a write of the given size, or returns ErrQuotaExceeded. Deletes always
+// succeed, and are accounted for as their tombstones take space until compacted.
+func (qdb *QuotaDB) reserve(size int64, deletesOnly bool) error {
+	qdb.mtx.Lock()
+	defer qdb.mtx.Unlock()
+	if !deletesOnly && qdb.size+size > qdb.maxBytes {
+		if qdb.estimate == nil || qdb.clock.Now().Sub(qdb.lastRefresh) < quotaDBRefreshInterval {
+			return ErrQuotaExceeded
+		}
+		if err := qdb.refresh(); err != nil {
+			return err
+		}
+		if qdb.size+size > qdb.maxBytes {
+			return ErrQuotaExceeded
+		}
+	}
+	qdb.size += size
+	return nil
+}
+
+// Get implements DB.
+func (qdb *QuotaDB) Get(key []byte) ([]byte, error) {
+	return qdb.db.Get(key)
+}
+
+// Has implements DB.
+func (qdb *QuotaDB) Has(key []byte) (bool, error) {
+	return qdb.db.Has(key)
+}
+
+// Set implements DB.
+func (qdb *QuotaDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := qdb.reserve(int64(len(key)+len(value)), false); err != nil {
+		return err
+	}
+	return qdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (qdb *QuotaDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := qdb.reserve(int64(len(key)+len(value)), false); err != nil {
+		return err
+	}
+	return qdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (qdb *QuotaDB) Delete(key []byte) error {
+	if err := qdb.reserve(int64(len(key)), true); err != nil {
+		return err
+	}
+	return qdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (qdb *QuotaDB) DeleteSync(key []byte) error {
+	if err := qdb.reserve(int64(len(key)), true); err != nil {
+		return err
+	}
+	return qdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (qdb *QuotaDB) Iterator(start, end []byte) (Iterator, error) {
+	return qdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (qdb *QuotaDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return qdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (qdb *QuotaDB) Close() error {
+	return qdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (qdb *QuotaDB) NewBatch() Batch {
+	return &quotaDBBatch{
+		qdb:         qdb,
+		batch:       qdb.db.NewBatch(),
+		deletesOnly: true,
+	}
+}
+
+// Print implements DB.
+func (qdb *QuotaDB) Print() error {
+	return qdb.db.Print()
+}
+
+// Stats implements DB.
+func (qdb *QuotaDB) Stats() map[string]string {
+	stats := qdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	qdb.mtx.Lock()
+	defer qdb.mtx.Unlock()
+	stats["quota.size"] = strconv.FormatInt(qdb.size, 10)
+	stats["quota.max_size"] = strconv.FormatInt(qdb.maxBytes, 10)
+	return stats
+}
+
+// Compact implements DB. The size is estimated again after compacting.
+func (qdb *QuotaDB) Compact(start, end []byte) error {
+	if err := qdb.db.Compact(start, end); err != nil {
+		return err
+	}
+	return qdb.Refresh()
+}
+
+// quotaDBBatch accounts for the size of a batch when it is written.
+type quotaDBBatch struct {
+	qdb         *QuotaDB
+	batch       Batch
+	size        int64
+	deletesOnly bool
+}
+
+var _ Batch = (*quotaDBBatch)(nil)
+
+// Set implements Batch.
+func (b *quotaDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.size += int64(len(key) + len(value))
+	b.deletesOnly = false
+	return nil
+}
+
+// Delete implements Batch.
+func (b *quotaDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.size += int64(len(key))
+	return nil
+}
+
+// Count implements Batch.
+func (b *quotaDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *quotaDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *quotaDBBatch) Write() error {
+	if err := b.qdb.reserve(b.size, b.deletesOnly); err != nil {
+		return err
+	}
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	b.size = 0
+	return nil
+}
+
+// WriteSync implements Batch.
+func (b *quotaDBBatch) WriteSync() error {
+	if err := b.qdb.reserve(b.size, b.deletesOnly); err != nil {
+		return err
+	}
+	if err := b.batch.WriteSync(); err != nil {
+		return err
+	}
+	b.size = 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *quotaDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	b.size, b.deletesOnly = 0, true
+	return nil
+}
+
+// Close implements Batch.
+func (b *quotaDBBatch) Close() error {
+	return b.batch.Close()
+}
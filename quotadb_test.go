@@ -0,0 +1,70 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaDB(t *testing.T) {
+	qdb, err := NewQuotaDB(NewMemDB(), 100, nil)
+	require.NoError(t, err)
+	defer qdb.Close()
+
+	require.NoError(t, qdb.Set(bz("a"), make([]byte, 59)))
+	require.Equal(t, ErrQuotaExceeded, qdb.Set(bz("b"), make([]byte, 59)))
+	checkValue(t, qdb, bz("b"), nil)
+
+	batch := qdb.NewBatch()
+	require.NoError(t, batch.Set(bz("c"), make([]byte, 30)))
+	require.NoError(t, batch.Set(bz("d"), make([]byte, 30)))
+	require.Equal(t, ErrQuotaExceeded, batch.Write())
+	require.NoError(t, batch.Close())
+	checkValue(t, qdb, bz("c"), nil)
+
+	// Deletes are always allowed, even past the quota.
+	require.NoError(t, qdb.Set(bz("c"), make([]byte, 30)))
+	require.EqualValues(t, 9, qdb.Headroom())
+	require.NoError(t, qdb.Delete(bz("a")))
+	batch = qdb.NewBatch()
+	require.NoError(t, batch.Delete(bz("c")))
+	require.NoError(t, batch.Delete(bz("e")))
+	require.NoError(t, batch.WriteSync())
+	require.NoError(t, batch.Close())
+	require.EqualValues(t, 6, qdb.Headroom())
+	require.Equal(t, "94", qdb.Stats()["quota.size"])
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, qdb.RegisterMetrics("test", "state", reg))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Equal(t, "test_storage_quota_headroom_bytes", families[0].GetName())
+	require.EqualValues(t, 6, families[0].GetMetric()[0].GetGauge().GetValue())
+}
+
+func TestQuotaDBEstimate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data"), make([]byte, 50), 0o644))
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	qdb, err := NewQuotaDB(NewMemDB(), 100, DirSize(dir))
+	require.NoError(t, err)
+	qdb.clock, qdb.lastRefresh = clock, clock.Now()
+	require.EqualValues(t, 50, qdb.Headroom())
+
+	require.NoError(t, qdb.Set(bz("a"), make([]byte, 39)))
+	require.Equal(t, ErrQuotaExceeded, qdb.Set(bz("b"), make([]byte, 39)))
+
+	// Once the data shrinks, e.g. after a compaction, writes succeed again after the next
+	// estimation.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data"), make([]byte, 10), 0o644))
+	require.Equal(t, ErrQuotaExceeded, qdb.Set(bz("b"), make([]byte, 39)))
+	clock.Advance(quotaDBRefreshInterval)
+	require.NoError(t, qdb.Set(bz("b"), make([]byte, 39)))
+	require.EqualValues(t, 50, qdb.Headroom())
+}
@@ -0,0 +1,82 @@
+package db
+
+// ReadOnlyDB wraps a database, and rejects all writes with ErrReadOnly, so that it can be handed
+// to subsystems which must never write, such as query or RPC handlers, regardless of whether the
+// backend can be opened read-only. Reads and iterators are served by the underlying database.
+//
+// Closing a ReadOnlyDB does not close the underlying database, which remains owned by its opener.
+type ReadOnlyDB struct {
+	db DB
+}
+
+var _ DB = (*ReadOnlyDB)(nil)
+
+// NewReadOnlyDB wraps db, rejecting writes.
+func NewReadOnlyDB(db DB) *ReadOnlyDB {
+	return &ReadOnlyDB{db: db}
+}
+
+// Get implements DB.
+func (rdb *ReadOnlyDB) Get(key []byte) ([]byte, error) {
+	return rdb.db.Get(key)
+}
+
+// Has implements DB.
+func (rdb *ReadOnlyDB) Has(key []byte) (bool, error) {
+	return rdb.db.Has(key)
+}
+
+// Set implements DB.
+func (*ReadOnlyDB) Set([]byte, []byte) error {
+	return ErrReadOnly
+}
+
+// SetSync implements DB.
+func (*ReadOnlyDB) SetSync([]byte, []byte) error {
+	return ErrReadOnly
+}
+
+// Delete implements DB.
+func (*ReadOnlyDB) Delete([]byte) error {
+	return ErrReadOnly
+}
+
+// DeleteSync implements DB.
+func (*ReadOnlyDB) DeleteSync([]byte) error {
+	return ErrReadOnly
+}
+
+// Iterator implements DB.
+func (rdb *ReadOnlyDB) Iterator(start, end []byte) (Iterator, error) {
+	return rdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (rdb *ReadOnlyDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return rdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB. It is a no-op, the underlying database must be closed by its owner.
+func (*ReadOnlyDB) Close() error {
+	return nil
+}
+
+// NewBatch implements DB. The batch returns ErrReadOnly on writes.
+func (*ReadOnlyDB) NewBatch() Batch {
+	return readOnlyBatch{}
+}
+
+// Print implements DB.
+func (rdb *ReadOnlyDB) Print() error {
+	return rdb.db.Print()
+}
+
+// Stats implements DB.
+func (rdb *ReadOnlyDB) Stats() map[string]string {
+	return rdb.db.Stats()
+}
+
+// Compact implements DB. It returns ErrReadOnly, as compactions rewrite the database.
+func (*ReadOnlyDB) Compact(_, _ []byte) error {
+	return ErrReadOnly
+}
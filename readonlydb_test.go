@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyDB(t *testing.T) {
+	mem := NewMemDB()
+	require.NoError(t, mem.Set(bz("a"), bz("1")))
+	rdb := NewReadOnlyDB(mem)
+
+	checkValue(t, rdb, bz("a"), bz("1"))
+	ok, err := rdb.Has(bz("a"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	itr, err := rdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, bz("a"), bz("1"))
+	require.NoError(t, itr.Close())
+
+	require.Equal(t, ErrReadOnly, rdb.Set(bz("b"), bz("2")))
+	require.Equal(t, ErrReadOnly, rdb.SetSync(bz("b"), bz("2")))
+	require.Equal(t, ErrReadOnly, rdb.Delete(bz("a")))
+	require.Equal(t, ErrReadOnly, rdb.DeleteSync(bz("a")))
+	require.Equal(t, ErrReadOnly, rdb.Compact(nil, nil))
+	batch := rdb.NewBatch()
+	require.Equal(t, ErrReadOnly, batch.Delete(bz("a")))
+	require.Equal(t, ErrReadOnly, batch.WriteSync())
+	require.NoError(t, batch.Close())
+
+	// Closing the read-only view leaves the database open.
+	require.NoError(t, rdb.Close())
+	require.NoError(t, mem.Set(bz("b"), bz("2")))
+	checkValue(t, rdb, bz("b"), bz("2"))
+}
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceStats counts the iterators and batches of databases opened with WithResourceTracking.
+type ResourceStats struct {
+	// OpenIterators and OpenBatches are the number of iterators and batches not closed yet.
+	OpenIterators int
+	OpenBatches   int
+	// IteratorsOpened and BatchesOpened are the total number of iterators and batches created.
+	IteratorsOpened uint64
+	BatchesOpened   uint64
+}
+
+// resourceKind identifies the kind of a tracked resource.
+type resourceKind string
+
+const (
+	resourceIterator resourceKind = "iterator"
+	resourceBatch    resourceKind = "batch"
+)
+
+// openResource is an iterator or batch which has not been closed yet.
+type openResource struct {
+	id      uint64
+	kind    resourceKind
+	source  eventSource
+	opened  time.Time
+	stack   []byte
+	release sync.Once
+}
+
+// resourceRegistry tracks the open resources of all tracked databases of the process.
+type resourceRegistry struct {
+	nextID          atomic.Uint64
+	iteratorsOpened atomic.Uint64
+	batchesOpened   atomic.Uint64
+
+	mtx  sync.Mutex
+	open map[uint64]*openResource
+}
+
+var resources = &resourceRegistry{open: make(map[uint64]*openResource)}
+
+// acquire registers a new open resource, capturing the stack that created it if requested.
+func (r *resourceRegistry) acquire(kind resourceKind, source eventSource, captureStack bool) *openResource {
+	res := &openResource{
+		id:     r.nextID.Add(1),
+		kind:   kind,
+		source: source,
+		opened: source.now(),
+	}
+	if captureStack {
+		res.stack = debug.Stack()
+	}
+	switch kind {
+	case resourceIterator:
+		r.iteratorsOpened.Add(1)
+	case resourceBatch:
+		r.batchesOpened.Add(1)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.open[res.id] = res
+	return res
+}
+
+// release unregisters the resource. It is safe to call several times.
+func (r *resourceRegistry) release(res *openResource) {
+	res.release.Do(func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		delete(r.open, res.id)
+	})
+}
+
+// OpenResourceStats returns the resource counts of all databases opened with WithResourceTracking.
+func OpenResourceStats() ResourceStats {
+	stats := ResourceStats{
+		IteratorsOpened: resources.iteratorsOpened.Load(),
+		BatchesOpened:   resources.batchesOpened.Load(),
+	}
+	resources.mtx.Lock()
+	defer resources.mtx.Unlock()
+	for _, res := range resources.open {
+		switch res.kind {
+		case resourceIterator:
+			stats.OpenIterators++
+		case resourceBatch:
+			stats.OpenBatches++
+		}
+	}
+	return stats
+}
+
+// DumpOpenResources writes the iterators and batches of databases opened with WithResourceTracking
+// that have not been closed yet, oldest first, with their age and, if enabled, the stack that
+// created them. This helps finding leaked iterators, e.g. when closing a database hangs.
+func DumpOpenResources(w io.Writer) error {
+	resources.mtx.Lock()
+	open := make([]*openResource, 0, len(resources.open))
+	for _, res := range resources.open {
+		open = append(open, res)
+	}
+	resources.mtx.Unlock()
+
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].id < open[j].id
+	})
+	for _, res := range open {
+		age := res.source.now().Sub(res.opened)
+		_, err := fmt.Fprintf(w, "%s #%d of %s database %q, open for %s\n",
+			res.kind, res.id, res.source.backend, res.source.name, age)
+		if err != nil {
+			return err
+		}
+		if res.stack != nil {
+			if _, err := fmt.Fprintf(w, "%s\n", res.stack); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WithResourceTracking tracks the iterators and batches of the database opened by NewDB, which are
+// then reported by OpenResourceStats and DumpOpenResources. Capturing the stack creating every
+// resource is expensive, so it should only be enabled while debugging. The returned database is
+// wrapped, so it can no longer be type asserted to the backend type.
+func WithResourceTracking(captureStacks bool) Option {
+	return func(o *dbOptions) {
+		o.tracking = &resourceTracking{captureStacks: captureStacks}
+	}
+}
+
+// resourceTracking holds the settings of WithResourceTracking.
+type resourceTracking struct {
+	captureStacks bool
+}
+
+// trackedDB wraps a database opened by NewDB to track its iterators and batches.
+type trackedDB struct {
+	db            DB
+	source        eventSource
+	captureStacks bool
+}
+
+var _ DB = (*trackedDB)(nil)
+
+// events implements eventPublisher.
+func (tdb *trackedDB) events() eventSource {
+	return tdb.source
+}
+
+// Get implements DB.
+func (tdb *trackedDB) Get(key []byte) ([]byte, error) {
+	return tdb.db.Get(key)
+}
+
+var _ GetAppender = (*trackedDB)(nil)
+
+// GetAppend implements GetAppender. The value is read into dst without an intermediate copy if
+// the underlying database is a GetAppender.
+func (tdb *trackedDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	return GetAppend(tdb.db, key, dst)
+}
+
+// Has implements DB.
+func (tdb *trackedDB) Has(key []byte) (bool, error) {
+	return tdb.db.Has(key)
+}
+
+// Set implements DB.
+func (tdb *trackedDB) Set(key []byte, value []byte) error {
+	return tdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (tdb *trackedDB) SetSync(key []byte, value []byte) error {
+	return tdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (tdb *trackedDB) Delete(key []byte) error {
+	return tdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (tdb *trackedDB) DeleteSync(key []byte) error {
+	return tdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (tdb *trackedDB) Iterator(start, end []byte) (Iterator, error) {
+	itr, err := tdb.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedIterator{
+		source:   itr,
+		resource: resources.acquire(resourceIterator, tdb.source, tdb.captureStacks),
+	}, nil
+}
+
+// ReverseIterator implements DB.
+func (tdb *trackedDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	itr, err := tdb.db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &trackedIterator{
+		source:   itr,
+		resource: resources.acquire(resourceIterator, tdb.source, tdb.captureStacks),
+	}, nil
+}
+
+// Close implements DB.
+func (tdb *trackedDB) Close() error {
+	return tdb.db.Close()
+}
+
+// NewBatch implements DB. The batch is an AsyncBatch if the batches of the database are.
+func (tdb *trackedDB) NewBatch() Batch {
+	batch := &trackedBatch{
+		tdb:      tdb,
+		source:   tdb.db.NewBatch(),
+		resource: resources.acquire(resourceBatch, tdb.source, tdb.captureStacks),
+	}
+	if _, ok := batch.source.(AsyncBatch); ok {
+		return &trackedAsyncBatch{batch}
+	}
+	return batch
+}
+
+// Print implements DB.
+func (tdb *trackedDB) Print() error {
+	return tdb.db.Print()
+}
+
+// Stats implements DB.
+func (tdb *trackedDB) Stats() map[string]string {
+	return tdb.db.Stats()
+}
+
+// Compact implements DB.
+func (tdb *trackedDB) Compact(start, end []byte) error {
+	return tdb.db.Compact(start, end)
+}
+
+var _ Checker = (*trackedDB)(nil)
+
+// Check implements Checker, running the checks of the underlying database.
+func (tdb *trackedDB) Check(ctx context.Context) (*CheckReport, error) {
+	return Check(ctx, tdb.db)
+}
+
+var _ RangeSizeEstimator = (*trackedDB)(nil)
+
+// EstimateRangeSize implements RangeSizeEstimator, if the underlying database does. Otherwise, it
+// returns 0.
+func (tdb *trackedDB) EstimateRangeSize(start, end []byte) (uint64, error) {
+	estimator, ok := tdb.db.(RangeSizeEstimator)
+	if !ok {
+		return 0, nil
+	}
+	return estimator.EstimateRangeSize(start, end)
+}
+
+// trackedIterator releases its resource when closed.
+type trackedIterator struct {
+	source   Iterator
+	resource *openResource
+}
+
+var _ UnsafeIterator = (*trackedIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *trackedIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *trackedIterator) Valid() bool {
+	return itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *trackedIterator) Next() {
+	itr.source.Next()
+}
+
+// Key implements Iterator.
+func (itr *trackedIterator) Key() []byte {
+	return itr.source.Key()
+}
+
+// Value implements Iterator.
+func (itr *trackedIterator) Value() []byte {
+	return itr.source.Value()
+}
+
+// UnsafeKey implements UnsafeIterator. It does not copy the key if the underlying iterator is an
+// UnsafeIterator.
+func (itr *trackedIterator) UnsafeKey() []byte {
+	return UnsafeKey(itr.source)
+}
+
+// UnsafeValue implements UnsafeIterator. It does not copy the value if the underlying iterator is
+// an UnsafeIterator.
+func (itr *trackedIterator) UnsafeValue() []byte {
+	return UnsafeValue(itr.source)
+}
+
+// Error implements Iterator.
+func (itr *trackedIterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *trackedIterator) Close() error {
+	resources.release(itr.resource)
+	return itr.source.Close()
+}
+
+// trackedBatch releases its resource when closed or written, since a written batch can no longer
+// be used until it is reset.
+type trackedBatch struct {
+	tdb      *trackedDB
+	source   Batch
+	resource *openResource
+}
+
+var _ Batch = (*trackedBatch)(nil)
+
+// Set implements Batch.
+func (b *trackedBatch) Set(key, value []byte) error {
+	return b.source.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *trackedBatch) Delete(key []byte) error {
+	return b.source.Delete(key)
+}
+
+// Count implements Batch.
+func (b *trackedBatch) Count() int {
+	return b.source.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *trackedBatch) SizeBytes() int {
+	return b.source.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *trackedBatch) Write() error {
+	err := b.source.Write()
+	if err == nil {
+		resources.release(b.resource)
+	}
+	return err
+}
+
+// WriteSync implements Batch.
+func (b *trackedBatch) WriteSync() error {
+	err := b.source.WriteSync()
+	if err == nil {
+		resources.release(b.resource)
+	}
+	return err
+}
+
+// Reset implements Batch. The reset batch is tracked as a new batch.
+func (b *trackedBatch) Reset() error {
+	if err := b.source.Reset(); err != nil {
+		return err
+	}
+	resources.release(b.resource)
+	b.resource = resources.acquire(resourceBatch, b.tdb.source, b.tdb.captureStacks)
+	return nil
+}
+
+// Close implements Batch.
+func (b *trackedBatch) Close() error {
+	resources.release(b.resource)
+	return b.source.Close()
+}
+
+// trackedAsyncBatch is a trackedBatch of a database whose batches are AsyncBatches.
+type trackedAsyncBatch struct {
+	*trackedBatch
+}
+
+var _ AsyncBatch = (*trackedAsyncBatch)(nil)
+
+// WriteAsync implements AsyncBatch. The resource is released once the write succeeded.
+func (b *trackedAsyncBatch) WriteAsync() <-chan error {
+	resource := b.resource
+	return forwardAsyncResult(b.source.(AsyncBatch).WriteAsync(), func(err error) error {
+		if err == nil {
+			resources.release(resource)
+		}
+		return err
+	})
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceTracking(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	db, err := NewDB("tracked", MemDBBackend, "", WithResourceTracking(true), WithClock(clock))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Set(bz("a"), bz("1")))
+
+	before := OpenResourceStats()
+
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	require.True(t, itr.Valid())
+	require.Equal(t, bz("a"), itr.Key())
+
+	clock.Advance(time.Minute)
+	rev, err := db.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	batch := db.NewBatch()
+	require.NoError(t, batch.Set(bz("b"), bz("2")))
+
+	stats := OpenResourceStats()
+	require.Equal(t, before.OpenIterators+2, stats.OpenIterators)
+	require.Equal(t, before.OpenBatches+1, stats.OpenBatches)
+	require.Equal(t, before.IteratorsOpened+2, stats.IteratorsOpened)
+	require.Equal(t, before.BatchesOpened+1, stats.BatchesOpened)
+
+	var buf bytes.Buffer
+	require.NoError(t, DumpOpenResources(&buf))
+	dump := buf.String()
+	require.Contains(t, dump, `of memdb database "tracked", open for 1m0s`)
+	require.Contains(t, dump, `of memdb database "tracked", open for 0s`)
+	require.Contains(t, dump, "TestResourceTracking")
+
+	// Written batches and closed iterators are released, even when closed twice.
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	require.NoError(t, itr.Close())
+	require.NoError(t, rev.Close())
+	require.NoError(t, rev.Close())
+
+	stats = OpenResourceStats()
+	require.Equal(t, before.OpenIterators, stats.OpenIterators)
+	require.Equal(t, before.OpenBatches, stats.OpenBatches)
+	checkValue(t, db, bz("b"), bz("2"))
+}
+
+func TestWrappersForwardOptionalInterfaces(t *testing.T) {
+	db, err := NewDB("forward", PebbleDBBackend, t.TempDir(),
+		WithEventBus(NewEventBus()), WithResourceTracking(false))
+	require.NoError(t, err)
+	defer db.Close()
+	before := OpenResourceStats()
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	require.Implements(t, (*AsyncBatch)(nil), batch)
+	require.NoError(t, batch.Set(bz("a"), bz("1")))
+	require.NoError(t, <-new(AsyncWriter).WriteAsync(batch))
+	require.Equal(t, before.OpenBatches, OpenResourceStats().OpenBatches)
+
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	require.Implements(t, (*UnsafeIterator)(nil), itr)
+	require.Equal(t, bz("a"), UnsafeKey(itr))
+	require.Equal(t, bz("1"), UnsafeValue(itr))
+
+	// The batches of backends without native support are still written by an AsyncWriter.
+	mdb, err := NewDB("forward", MemDBBackend, "", WithEventBus(NewEventBus()), WithResourceTracking(false))
+	require.NoError(t, err)
+	defer mdb.Close()
+	mbatch := mdb.NewBatch()
+	defer mbatch.Close()
+	_, ok := mbatch.(AsyncBatch)
+	require.False(t, ok)
+	require.NoError(t, mbatch.Set(bz("a"), bz("1")))
+	require.NoError(t, <-new(AsyncWriter).WriteAsync(mbatch))
+	checkValue(t, mdb, bz("a"), bz("1"))
+}
+
+func TestTrackedDBOptionalInterfaces(t *testing.T) {
+	db, err := NewDB("tracked", PebbleDBBackend, t.TempDir(), WithResourceTracking(false))
+	require.NoError(t, err)
+	defer db.Close()
+	fillAndRead(t, db, 100)
+
+	// The checks of the backend are run, rather than a plain scan of the keyspace.
+	report, err := Check(context.Background(), db)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, "levels", report.Checks[0].Name)
+
+	size, err := db.(RangeSizeEstimator).EstimateRangeSize(nil, nil)
+	require.NoError(t, err)
+	require.Positive(t, size)
+
+	buf, ok, err := db.(GetAppender).GetAppend([]byte("key000001"), []byte("x"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, buf, 1025)
+}
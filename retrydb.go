@@ -0,0 +1,370 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxRetries       = 3
+	defaultRetryBackoff          = 10 * time.Millisecond
+	defaultRetryMaxBackoff       = time.Second
+	defaultRetryBreakerThreshold = 5
+	defaultRetryBreakerCooldown  = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned by a RetryDB while its circuit breaker is open, i.e. after repeated
+// failures, without calling the underlying database.
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// RetryDBConfig configures a RetryDB. Zero values are replaced by defaults.
+type RetryDBConfig struct {
+	// MaxRetries is the number of times a failed operation is retried, with RetryBackoff doubling
+	// after every attempt up to MaxRetryBackoff. Defaults to 3 retries starting at 10ms, up to 1s.
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// RetryWrites enables retrying writes, batch writes and compactions. By default only reads
+	// are retried, as a failed write may still have been applied, and retrying it may then
+	// overwrite a write made by someone else in between.
+	RetryWrites bool
+	// Retryable reports whether an error is transient, so that the operation is retried and counts
+	// as a failure for the circuit breaker. Defaults to all errors except invalid arguments,
+	// ErrReadOnly, ErrQuotaExceeded and context cancellation.
+	Retryable func(err error) bool
+	// BreakerThreshold is the number of consecutive failed operations, after retries, which open
+	// the circuit breaker. Operations then fail with ErrCircuitOpen for BreakerCooldown, after which
+	// a single operation is let through to probe the backend: the breaker closes if it succeeds, and
+	// opens again otherwise. Defaults to 5 failures and 10s.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Logger, if set, is used to report retries and breaker state changes.
+	Logger Logger
+	// Clock is used to wait between retries and to time the breaker. Defaults to SystemClock.
+	Clock Clock
+}
+
+// retryableError is the default of RetryDBConfig.Retryable.
+func retryableError(err error) bool {
+	switch {
+	case errors.Is(err, errKeyEmpty), errors.Is(err, errValueNil), errors.Is(err, errBatchClosed),
+		errors.Is(err, ErrReadOnly), errors.Is(err, ErrQuotaExceeded), errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
+
+// RetryDB wraps a database whose operations may fail transiently, such as a remote backend, and
+// retries failed operations with exponential backoff. A circuit breaker fails operations fast
+// after repeated failures, so that callers do not pile up on an unavailable backend.
+//
+// Iterators are retried when created, but not while iterating.
+type RetryDB struct {
+	db  DB
+	cfg RetryDBConfig
+
+	mtx       sync.Mutex
+	failures  int       // consecutive failed operations
+	openUntil time.Time // end of the cooldown of the open breaker
+	probing   bool      // whether an operation is probing the backend after the cooldown
+	retries   uint64
+	trips     uint64
+}
+
+var _ DB = (*RetryDB)(nil)
+
+// NewRetryDB wraps db, retrying its failed operations as configured by cfg.
+func NewRetryDB(db DB, cfg RetryDBConfig) *RetryDB {
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultRetryMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = defaultRetryMaxBackoff
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = retryableError
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = defaultRetryBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = defaultRetryBreakerCooldown
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	return &RetryDB{db: db, cfg: cfg}
+}
+
+// allow returns ErrCircuitOpen if the breaker is open, or lets the operation through.
+func (rdb *RetryDB) allow() error {
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	if rdb.failures < rdb.cfg.BreakerThreshold {
+		return nil
+	}
+	if rdb.probing || rdb.cfg.Clock.Now().Before(rdb.openUntil) {
+		return ErrCircuitOpen
+	}
+	rdb.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of an operation.
+func (rdb *RetryDB) record(err error) {
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	rdb.probing = false
+	if err == nil || !rdb.cfg.Retryable(err) {
+		if rdb.failures >= rdb.cfg.BreakerThreshold && rdb.cfg.Logger != nil {
+			rdb.cfg.Logger.Info("database circuit breaker closed")
+		}
+		rdb.failures = 0
+		return
+	}
+	rdb.failures++
+	if rdb.failures >= rdb.cfg.BreakerThreshold {
+		if rdb.failures == rdb.cfg.BreakerThreshold {
+			rdb.trips++
+		}
+		rdb.openUntil = rdb.cfg.Clock.Now().Add(rdb.cfg.BreakerCooldown)
+		if rdb.cfg.Logger != nil {
+			rdb.cfg.Logger.Error("database circuit breaker opened", "failures", rdb.failures, "err", err)
+		}
+	}
+}
+
+// do runs an operation, retrying it while it fails with a transient error, unless it is a write
+// and writes are not retried.
+func (rdb *RetryDB) do(op DBOperation, write bool, fn func() error) error {
+	if err := rdb.allow(); err != nil {
+		return err
+	}
+	backoff := rdb.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !rdb.cfg.Retryable(err) || (write && !rdb.cfg.RetryWrites) ||
+			attempt >= rdb.cfg.MaxRetries {
+			rdb.record(err)
+			return err
+		}
+		if rdb.cfg.Logger != nil {
+			rdb.cfg.Logger.Info("retrying database operation", "op", string(op), "attempt", attempt+1,
+				"backoff", backoff, "err", err)
+		}
+		rdb.mtx.Lock()
+		rdb.retries++
+		rdb.mtx.Unlock()
+		<-rdb.cfg.Clock.After(backoff)
+		backoff = min(2*backoff, rdb.cfg.MaxRetryBackoff)
+	}
+}
+
+// Get implements DB.
+func (rdb *RetryDB) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := rdb.do(OpGet, false, func() (err error) {
+		value, err = rdb.db.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Has implements DB.
+func (rdb *RetryDB) Has(key []byte) (bool, error) {
+	var ok bool
+	err := rdb.do(OpHas, false, func() (err error) {
+		ok, err = rdb.db.Has(key)
+		return err
+	})
+	return ok, err
+}
+
+// Set implements DB.
+func (rdb *RetryDB) Set(key []byte, value []byte) error {
+	return rdb.do(OpSet, true, func() error {
+		return rdb.db.Set(key, value)
+	})
+}
+
+// SetSync implements DB.
+func (rdb *RetryDB) SetSync(key []byte, value []byte) error {
+	return rdb.do(OpSetSync, true, func() error {
+		return rdb.db.SetSync(key, value)
+	})
+}
+
+// Delete implements DB.
+func (rdb *RetryDB) Delete(key []byte) error {
+	return rdb.do(OpDelete, true, func() error {
+		return rdb.db.Delete(key)
+	})
+}
+
+// DeleteSync implements DB.
+func (rdb *RetryDB) DeleteSync(key []byte) error {
+	return rdb.do(OpDeleteSync, true, func() error {
+		return rdb.db.DeleteSync(key)
+	})
+}
+
+// Iterator implements DB.
+func (rdb *RetryDB) Iterator(start, end []byte) (Iterator, error) {
+	var itr Iterator
+	err := rdb.do(OpIterator, false, func() (err error) {
+		itr, err = rdb.db.Iterator(start, end)
+		return err
+	})
+	return itr, err
+}
+
+// ReverseIterator implements DB.
+func (rdb *RetryDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	var itr Iterator
+	err := rdb.do(OpReverseIterator, false, func() (err error) {
+		itr, err = rdb.db.ReverseIterator(start, end)
+		return err
+	})
+	return itr, err
+}
+
+// Close implements DB.
+func (rdb *RetryDB) Close() error {
+	return rdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (rdb *RetryDB) NewBatch() Batch {
+	return &retryDBBatch{rdb: rdb}
+}
+
+// Print implements DB.
+func (rdb *RetryDB) Print() error {
+	return rdb.db.Print()
+}
+
+// Stats implements DB.
+func (rdb *RetryDB) Stats() map[string]string {
+	stats := rdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	rdb.mtx.Lock()
+	defer rdb.mtx.Unlock()
+	stats["retry.retries"] = strconv.FormatUint(rdb.retries, 10)
+	stats["retry.breaker_trips"] = strconv.FormatUint(rdb.trips, 10)
+	stats["retry.breaker_open"] = strconv.FormatBool(rdb.failures >= rdb.cfg.BreakerThreshold)
+	return stats
+}
+
+// Compact implements DB. Compactions are retried like writes.
+func (rdb *RetryDB) Compact(start, end []byte) error {
+	return rdb.do(OpCompact, true, func() error {
+		return rdb.db.Compact(start, end)
+	})
+}
+
+// retryDBBatch buffers operations, so that a failed write can be retried with a new batch of the
+// underlying database.
+type retryDBBatch struct {
+	rdb     *RetryDB
+	ops     []operation
+	size    int      // of the keys and values of ops
+	written *RetryDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*retryDBBatch)(nil)
+
+// Set implements Batch.
+func (b *retryDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.rdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *retryDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.rdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *retryDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *retryDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *retryDBBatch) Write() error {
+	return b.write(OpBatchWrite, false)
+}
+
+// WriteSync implements Batch.
+func (b *retryDBBatch) WriteSync() error {
+	return b.write(OpBatchWriteSync, true)
+}
+
+func (b *retryDBBatch) write(op DBOperation, sync bool) error {
+	if b.rdb == nil {
+		return errBatchClosed
+	}
+	err := b.rdb.do(op, true, func() error {
+		return writeOperations(b.rdb.db, b.ops, sync)
+	})
+	if err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.rdb, b.written, b.ops, b.size = nil, b.rdb, b.ops[:0], 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *retryDBBatch) Reset() error {
+	if b.rdb == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.rdb, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *retryDBBatch) Close() error {
+	b.rdb, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
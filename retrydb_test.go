@@ -0,0 +1,143 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransient = errors.New("transient error")
+
+// flakyDB fails the given number of Get, Set and batch write calls with errTransient.
+type flakyDB struct {
+	*MemDB
+	failures int
+	calls    int
+}
+
+func (db *flakyDB) fail() error {
+	db.calls++
+	if db.failures > 0 {
+		db.failures--
+		return errTransient
+	}
+	return nil
+}
+
+func (db *flakyDB) Get(key []byte) ([]byte, error) {
+	if err := db.fail(); err != nil {
+		return nil, err
+	}
+	return db.MemDB.Get(key)
+}
+
+func (db *flakyDB) Set(key, value []byte) error {
+	if err := db.fail(); err != nil {
+		return err
+	}
+	return db.MemDB.Set(key, value)
+}
+
+func (db *flakyDB) NewBatch() Batch {
+	return &flakyBatch{Batch: db.MemDB.NewBatch(), db: db}
+}
+
+type flakyBatch struct {
+	Batch
+	db *flakyDB
+}
+
+func (b *flakyBatch) Write() error {
+	if err := b.db.fail(); err != nil {
+		return err
+	}
+	return b.Batch.Write()
+}
+
+func TestRetryDBRetries(t *testing.T) {
+	fdb := &flakyDB{MemDB: NewMemDB()}
+	rdb := NewRetryDB(fdb, RetryDBConfig{RetryBackoff: time.Nanosecond})
+	require.NoError(t, fdb.MemDB.Set(bz("a"), bz("1")))
+
+	// Reads are retried up to MaxRetries times.
+	fdb.failures = 3
+	checkValue(t, rdb, bz("a"), bz("1"))
+	require.Equal(t, 4, fdb.calls)
+	fdb.failures, fdb.calls = 4, 0
+	_, err := rdb.Get(bz("a"))
+	require.ErrorIs(t, err, errTransient)
+	require.Equal(t, 4, fdb.calls)
+
+	// Writes are not retried by default.
+	fdb.failures, fdb.calls = 1, 0
+	require.ErrorIs(t, rdb.Set(bz("b"), bz("2")), errTransient)
+	require.Equal(t, 1, fdb.calls)
+
+	// Errors which are not transient are not retried.
+	fdb.calls = 0
+	_, err = rdb.Get(nil)
+	require.Equal(t, errKeyEmpty, err)
+	require.Equal(t, 1, fdb.calls)
+	require.Equal(t, "6", rdb.Stats()["retry.retries"])
+}
+
+func TestRetryDBRetryWrites(t *testing.T) {
+	fdb := &flakyDB{MemDB: NewMemDB()}
+	rdb := NewRetryDB(fdb, RetryDBConfig{RetryBackoff: time.Nanosecond, RetryWrites: true})
+
+	fdb.failures = 2
+	require.NoError(t, rdb.Set(bz("a"), bz("1")))
+	checkValue(t, fdb.MemDB, bz("a"), bz("1"))
+
+	// Failed batch writes are retried with a new batch.
+	fdb.failures = 2
+	batch := rdb.NewBatch()
+	require.NoError(t, batch.Set(bz("b"), bz("2")))
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	checkValue(t, fdb.MemDB, bz("a"), nil)
+	checkValue(t, fdb.MemDB, bz("b"), bz("2"))
+}
+
+func TestRetryDBCircuitBreaker(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	fdb := &flakyDB{MemDB: NewMemDB(), failures: 100}
+	rdb := NewRetryDB(fdb, RetryDBConfig{
+		MaxRetries:       -1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+		Clock:            clock,
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := rdb.Get(bz("a"))
+		require.ErrorIs(t, err, errTransient)
+	}
+	require.Equal(t, "true", rdb.Stats()["retry.breaker_open"])
+
+	// The open breaker fails operations without calling the backend.
+	fdb.calls = 0
+	_, err := rdb.Get(bz("a"))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Zero(t, fdb.calls)
+
+	// After the cooldown, a failed probe opens the breaker again.
+	clock.Advance(time.Minute)
+	_, err = rdb.Get(bz("a"))
+	require.ErrorIs(t, err, errTransient)
+	_, err = rdb.Get(bz("a"))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+
+	// A successful probe closes it.
+	fdb.failures = 0
+	clock.Advance(time.Minute)
+	checkValue(t, rdb, bz("a"), nil)
+	checkValue(t, rdb, bz("a"), nil)
+	stats := rdb.Stats()
+	require.Equal(t, "false", stats["retry.breaker_open"])
+	require.Equal(t, "1", stats["retry.breaker_trips"])
+}
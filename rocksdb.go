@@ -4,6 +4,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"runtime"
@@ -12,7 +13,7 @@ import (
 )
 
 func init() {
-	dbCreator := func(name string, dir string) (DB, error) {
+	dbCreator := func(name string, dir string, _ *dbOptions) (DB, error) {
 		return NewRocksDB(name, dir)
 	}
 	registerDBCreator(RocksDBBackend, dbCreator)
@@ -24,25 +25,80 @@ type RocksDB struct {
 	ro     *grocksdb.ReadOptions
 	wo     *grocksdb.WriteOptions
 	woSync *grocksdb.WriteOptions
+	cfs    map[string]*grocksdb.ColumnFamilyHandle
 }
 
 var _ DB = (*RocksDB)(nil)
 
-func NewRocksDB(name string, dir string) (*RocksDB, error) {
+// RocksDBConfig configures the commonly tuned options of a RocksDB database opened with
+// NewRocksDBWithConfig. Zero values select the defaults of NewRocksDB.
+type RocksDBConfig struct {
+	// BlockCacheSize is the size of the LRU block cache in bytes. Defaults to 1GB.
+	BlockCacheSize uint64
+	// BloomFilterBitsPerKey is the number of bits per key of the bloom filters. Defaults to 10,
+	// and a negative value disables bloom filters.
+	BloomFilterBitsPerKey float64
+	// MemtableMemoryBudget is the memory budget of the write buffers in bytes. Defaults to 512MB,
+	// RocksDB may use 50% more on heavy workloads.
+	MemtableMemoryBudget uint64
+	// CompressionPerLevel sets the compression of every level, starting at level 0. By default,
+	// snappy is used on all levels.
+	CompressionPerLevel []grocksdb.CompressionType
+	// RateLimitBytesPerSec limits the rate of flushes and compactions, to bound their impact on
+	// foreground reads. The limit is auto-tuned below this maximum. Disabled by default.
+	RateLimitBytesPerSec int64
+	// ColumnFamilies are the column families to open, in addition to the default one and any
+	// existing ones. Missing column families are created. See RocksDB.ColumnFamily.
+	ColumnFamilies []string
+}
+
+// Options returns the RocksDB options for the configuration.
+func (cfg RocksDBConfig) Options() *grocksdb.Options {
 	// default rocksdb option, good enough for most cases, including heavy workloads.
 	// 1GB table cache, 512MB write buffer(may use 50% more on heavy workloads).
 	// compression: snappy as default, need to -lsnappy to enable.
+	blockCacheSize := cfg.BlockCacheSize
+	if blockCacheSize == 0 {
+		blockCacheSize = 1 << 30
+	}
+	bloomBitsPerKey := cfg.BloomFilterBitsPerKey
+	if bloomBitsPerKey == 0 {
+		bloomBitsPerKey = 10
+	}
+	memtableMemoryBudget := cfg.MemtableMemoryBudget
+	if memtableMemoryBudget == 0 {
+		memtableMemoryBudget = 512 * 1024 * 1024
+	}
+
 	bbto := grocksdb.NewDefaultBlockBasedTableOptions()
-	bbto.SetBlockCache(grocksdb.NewLRUCache(1 << 30))
-	bbto.SetFilterPolicy(grocksdb.NewBloomFilter(10))
+	bbto.SetBlockCache(grocksdb.NewLRUCache(blockCacheSize))
+	if bloomBitsPerKey > 0 {
+		bbto.SetFilterPolicy(grocksdb.NewBloomFilter(bloomBitsPerKey))
+	}
 
 	opts := grocksdb.NewDefaultOptions()
 	opts.SetBlockBasedTableFactory(bbto)
 	opts.SetCreateIfMissing(true)
+	opts.SetCreateIfMissingColumnFamilies(true)
 	opts.IncreaseParallelism(runtime.NumCPU())
-	// 1.5GB maximum memory use for writebuffer.
-	opts.OptimizeLevelStyleCompaction(512 * 1024 * 1024)
-	return NewRocksDBWithOptions(name, dir, opts)
+	opts.OptimizeLevelStyleCompaction(memtableMemoryBudget)
+	if len(cfg.CompressionPerLevel) > 0 {
+		opts.SetCompressionPerLevel(cfg.CompressionPerLevel)
+	}
+	if cfg.RateLimitBytesPerSec > 0 {
+		opts.SetRateLimiter(grocksdb.NewAutoTunedRateLimiter(cfg.RateLimitBytesPerSec, 100*1000, 10))
+	}
+	return opts
+}
+
+func NewRocksDB(name string, dir string) (*RocksDB, error) {
+	return NewRocksDBWithConfig(name, dir, RocksDBConfig{})
+}
+
+// NewRocksDBWithConfig opens a RocksDB database with the given configuration, including its
+// column families.
+func NewRocksDBWithConfig(name string, dir string, cfg RocksDBConfig) (*RocksDB, error) {
+	return NewRocksDBWithColumnFamilies(name, dir, cfg.Options(), cfg.ColumnFamilies)
 }
 
 func NewRocksDBWithOptions(name string, dir string, opts *grocksdb.Options) (*RocksDB, error) {
@@ -58,6 +114,94 @@ func NewRocksDBWithOptions(name string, dir string, opts *grocksdb.Options) (*Ro
 	return NewRocksDBWithRawDB(db, ro, wo, woSync), nil
 }
 
+// NewRocksDBWithColumnFamilies opens a RocksDB database with the given column families, in
+// addition to the default one. Existing column families which are not listed are opened too,
+// since RocksDB requires all of them to be opened. All column families use the same options.
+func NewRocksDBWithColumnFamilies(name string, dir string, opts *grocksdb.Options, columnFamilies []string) (*RocksDB, error) {
+	dbPath := filepath.Join(dir, name+".db")
+	names := []string{rocksDBDefaultColumnFamily}
+	// Listing fails if the database does not exist yet, in which case there is nothing to add.
+	if existing, err := grocksdb.ListColumnFamilies(opts, dbPath); err == nil {
+		names = appendMissing(names, existing...)
+	}
+	names = appendMissing(names, columnFamilies...)
+
+	cfOpts := make([]*grocksdb.Options, len(names))
+	for i := range cfOpts {
+		cfOpts[i] = opts
+	}
+	db, handles, err := grocksdb.OpenDbColumnFamilies(opts, dbPath, names, cfOpts)
+	if err != nil {
+		return nil, err
+	}
+	return newRocksDBWithColumnFamilyHandles(db, names, handles), nil
+}
+
+// NewRocksDBSecondary opens the RocksDB database name in dir as a read-only secondary instance,
+// e.g. to let an indexer read the database of a running node without contending for its lock. The
+// secondary keeps its own info logs in secondaryDir, and only sees the writes of the primary up to
+// the last call to CatchUp. All column families of the database are opened.
+func NewRocksDBSecondary(name string, dir string, secondaryDir string) (*RocksDB, error) {
+	dbPath := filepath.Join(dir, name+".db")
+	opts := RocksDBConfig{}.Options()
+	opts.SetCreateIfMissing(false)
+	opts.SetCreateIfMissingColumnFamilies(false)
+	// Secondary instances must keep all table files open, since the primary may delete them.
+	opts.SetMaxOpenFiles(-1)
+
+	names, err := grocksdb.ListColumnFamilies(opts, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	cfOpts := make([]*grocksdb.Options, len(names))
+	for i := range cfOpts {
+		cfOpts[i] = opts
+	}
+	db, handles, err := grocksdb.OpenDbAsSecondaryColumnFamilies(opts, dbPath, secondaryDir, names, cfOpts)
+	if err != nil {
+		return nil, err
+	}
+	return newRocksDBWithColumnFamilyHandles(db, names, handles), nil
+}
+
+// CatchUp makes the writes of the primary visible to a secondary instance opened with
+// NewRocksDBSecondary, by replaying its MANIFEST and write-ahead logs. It should be called
+// periodically, the interval bounding the staleness of the secondary.
+func (db *RocksDB) CatchUp() error {
+	return db.db.TryCatchUpWithPrimary()
+}
+
+// newRocksDBWithColumnFamilyHandles wraps a database opened with the given column families.
+func newRocksDBWithColumnFamilyHandles(db *grocksdb.DB, names []string, handles []*grocksdb.ColumnFamilyHandle) *RocksDB {
+	ro := grocksdb.NewDefaultReadOptions()
+	wo := grocksdb.NewDefaultWriteOptions()
+	woSync := grocksdb.NewDefaultWriteOptions()
+	woSync.SetSync(true)
+	rdb := NewRocksDBWithRawDB(db, ro, wo, woSync)
+	rdb.cfs = make(map[string]*grocksdb.ColumnFamilyHandle, len(names))
+	for i, name := range names {
+		rdb.cfs[name] = handles[i]
+	}
+	return rdb
+}
+
+// appendMissing appends the names not already in names.
+func appendMissing(names []string, add ...string) []string {
+	for _, name := range add {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func NewRocksDBWithRawDB(db *grocksdb.DB, ro *grocksdb.ReadOptions, wo *grocksdb.WriteOptions, woSync *grocksdb.WriteOptions) *RocksDB {
 	return &RocksDB{
 		db:     db,
@@ -79,6 +223,25 @@ func (db *RocksDB) Get(key []byte) ([]byte, error) {
 	return moveSliceToBytes(res), nil
 }
 
+var _ GetAppender = (*RocksDB)(nil)
+
+// GetAppend implements GetAppender. The value is copied straight from the slice returned by
+// RocksDB.
+func (db *RocksDB) GetAppend(key, dst []byte) ([]byte, bool, error) {
+	if len(key) == 0 {
+		return dst, false, errKeyEmpty
+	}
+	res, err := db.db.Get(db.ro, key)
+	if err != nil {
+		return dst, false, err
+	}
+	defer res.Free()
+	if !res.Exists() {
+		return dst, false, nil
+	}
+	return append(dst, res.Data()...), true, nil
+}
+
 // Has implements DB.
 func (db *RocksDB) Has(key []byte) (bool, error) {
 	bytes, err := db.Get(key)
@@ -146,8 +309,12 @@ func (db *RocksDB) DB() *grocksdb.DB {
 	return db.db
 }
 
-// Close implements DB.
+// Close implements DB. It also closes the column families of the database.
 func (db *RocksDB) Close() error {
+	for _, cf := range db.cfs {
+		cf.Destroy()
+	}
+	db.cfs = nil
 	db.ro.Destroy()
 	db.wo.Destroy()
 	db.woSync.Destroy()
@@ -180,6 +347,24 @@ func (db *RocksDB) Stats() map[string]string {
 	return stats
 }
 
+var _ Checker = (*RocksDB)(nil)
+
+// Check implements Checker. It iterates over the whole keyspace with checksum verification of all
+// blocks read, without filling the block cache.
+func (db *RocksDB) Check(ctx context.Context) (*CheckReport, error) {
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetVerifyChecksums(true)
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	keyspace, err := checkKeyspace(ctx, func(start, end []byte) (Iterator, error) {
+		return newRocksDBIterator(db.db.NewIterator(ro), start, end, false), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckReport{Checks: []CheckResult{keyspace}}, nil
+}
+
 // NewBatch implements DB.
 func (db *RocksDB) NewBatch() Batch {
 	return newRocksDBBatch(db)
@@ -7,7 +7,10 @@ import "github.com/linxGnu/grocksdb"
 
 type rocksDBBatch struct {
 	db    *RocksDB
+	cf    *grocksdb.ColumnFamilyHandle // nil for the default column family
 	batch *grocksdb.WriteBatch
+	// written is the batch once written, reused by Reset.
+	written *grocksdb.WriteBatch
 }
 
 var _ Batch = (*rocksDBBatch)(nil)
@@ -19,6 +22,14 @@ func newRocksDBBatch(db *RocksDB) *rocksDBBatch {
 	}
 }
 
+func newRocksDBColumnFamilyBatch(db *RocksDB, cf *grocksdb.ColumnFamilyHandle) *rocksDBBatch {
+	return &rocksDBBatch{
+		db:    db,
+		cf:    cf,
+		batch: grocksdb.NewWriteBatch(),
+	}
+}
+
 // Set implements Batch.
 func (b *rocksDBBatch) Set(key, value []byte) error {
 	if len(key) == 0 {
@@ -30,6 +41,10 @@ func (b *rocksDBBatch) Set(key, value []byte) error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
+	if b.cf != nil {
+		b.batch.PutCF(b.cf, key, value)
+		return nil
+	}
 	b.batch.Put(key, value)
 	return nil
 }
@@ -42,10 +57,30 @@ func (b *rocksDBBatch) Delete(key []byte) error {
 	if b.batch == nil {
 		return errBatchClosed
 	}
+	if b.cf != nil {
+		b.batch.DeleteCF(b.cf, key)
+		return nil
+	}
 	b.batch.Delete(key)
 	return nil
 }
 
+// Count implements Batch.
+func (b *rocksDBBatch) Count() int {
+	if b.batch == nil {
+		return 0
+	}
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch. It is the size of the encoded batch.
+func (b *rocksDBBatch) SizeBytes() int {
+	if b.batch == nil {
+		return 0
+	}
+	return len(b.batch.Data())
+}
+
 // Write implements Batch.
 func (b *rocksDBBatch) Write() error {
 	if b.batch == nil {
@@ -55,8 +90,9 @@ func (b *rocksDBBatch) Write() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written = nil, b.batch
 	return nil
 }
 
@@ -69,15 +105,31 @@ func (b *rocksDBBatch) WriteSync() error {
 	if err != nil {
 		return err
 	}
-	// Make sure batch cannot be used afterwards. Callers should still call Close(), for errors.
-	return b.Close()
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batch, b.written = nil, b.batch
+	return nil
+}
+
+// Reset implements Batch. The underlying rocksdb batch is reused.
+func (b *rocksDBBatch) Reset() error {
+	if b.batch == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.batch, b.written = b.written, nil
+	}
+	b.batch.Clear()
+	return nil
 }
 
 // Close implements Batch.
 func (b *rocksDBBatch) Close() error {
-	if b.batch != nil {
-		b.batch.Destroy()
-		b.batch = nil
+	for _, batch := range []*grocksdb.WriteBatch{b.batch, b.written} {
+		if batch != nil {
+			batch.Destroy()
+		}
 	}
+	b.batch, b.written = nil, nil
 	return nil
 }
@@ -0,0 +1,166 @@
+//go:build rocksdb
+// +build rocksdb
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// rocksDBDefaultColumnFamily is the name of the column family always present in a database.
+const rocksDBDefaultColumnFamily = "default"
+
+// RocksDBColumnFamily is a column family of a RocksDB database, exposed as a separate DB. Column
+// families share the write-ahead log and caches of the database, so several logical databases can
+// be stored in one physical database.
+type RocksDBColumnFamily struct {
+	db   *RocksDB
+	name string
+	cf   *grocksdb.ColumnFamilyHandle
+}
+
+var _ DB = (*RocksDBColumnFamily)(nil)
+
+// ColumnFamily returns the column family with the given name, which must have been opened with the
+// database, e.g. using RocksDBConfig.ColumnFamilies. It remains usable until the database is closed.
+func (db *RocksDB) ColumnFamily(name string) (*RocksDBColumnFamily, error) {
+	cf, ok := db.cfs[name]
+	if !ok {
+		return nil, fmt.Errorf("column family %q is not open", name)
+	}
+	return &RocksDBColumnFamily{db: db, name: name, cf: cf}, nil
+}
+
+// ColumnFamilies returns the names of the open column families.
+func (db *RocksDB) ColumnFamilies() []string {
+	names := make([]string, 0, len(db.cfs))
+	for name := range db.cfs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Name returns the name of the column family.
+func (cf *RocksDBColumnFamily) Name() string {
+	return cf.name
+}
+
+// Get implements DB.
+func (cf *RocksDBColumnFamily) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	res, err := cf.db.db.GetCF(cf.db.ro, cf.cf, key)
+	if err != nil {
+		return nil, err
+	}
+	return moveSliceToBytes(res), nil
+}
+
+// Has implements DB.
+func (cf *RocksDBColumnFamily) Has(key []byte) (bool, error) {
+	bytes, err := cf.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return bytes != nil, nil
+}
+
+// Set implements DB.
+func (cf *RocksDBColumnFamily) Set(key []byte, value []byte) error {
+	return cf.set(key, value, cf.db.wo)
+}
+
+// SetSync implements DB.
+func (cf *RocksDBColumnFamily) SetSync(key []byte, value []byte) error {
+	return cf.set(key, value, cf.db.woSync)
+}
+
+func (cf *RocksDBColumnFamily) set(key []byte, value []byte, wo *grocksdb.WriteOptions) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return cf.db.db.PutCF(wo, cf.cf, key, value)
+}
+
+// Delete implements DB.
+func (cf *RocksDBColumnFamily) Delete(key []byte) error {
+	return cf.delete(key, cf.db.wo)
+}
+
+// DeleteSync implements DB.
+func (cf *RocksDBColumnFamily) DeleteSync(key []byte) error {
+	return cf.delete(key, cf.db.woSync)
+}
+
+func (cf *RocksDBColumnFamily) delete(key []byte, wo *grocksdb.WriteOptions) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return cf.db.db.DeleteCF(wo, cf.cf, key)
+}
+
+// Iterator implements DB.
+func (cf *RocksDBColumnFamily) Iterator(start, end []byte) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	itr := cf.db.db.NewIteratorCF(cf.db.ro, cf.cf)
+	return newRocksDBIterator(itr, start, end, false), nil
+}
+
+// ReverseIterator implements DB.
+func (cf *RocksDBColumnFamily) ReverseIterator(start, end []byte) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	itr := cf.db.db.NewIteratorCF(cf.db.ro, cf.cf)
+	return newRocksDBIterator(itr, start, end, true), nil
+}
+
+// Close implements DB. It is a no-op, the column family is closed with its database.
+func (cf *RocksDBColumnFamily) Close() error {
+	return nil
+}
+
+// NewBatch implements DB. Batches of different column families of the same database are not
+// atomic with respect to each other.
+func (cf *RocksDBColumnFamily) NewBatch() Batch {
+	return newRocksDBColumnFamilyBatch(cf.db, cf.cf)
+}
+
+// Print implements DB.
+func (cf *RocksDBColumnFamily) Print() error {
+	itr, err := cf.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		key := itr.Key()
+		value := itr.Value()
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return nil
+}
+
+// Stats implements DB.
+func (cf *RocksDBColumnFamily) Stats() map[string]string {
+	keys := []string{"rocksdb.stats"}
+	stats := make(map[string]string, len(keys))
+	for _, key := range keys {
+		stats[key] = cf.db.db.GetPropertyCF(key, cf.cf)
+	}
+	return stats
+}
+
+// Compact implements DB.
+func (cf *RocksDBColumnFamily) Compact(start, end []byte) error {
+	cf.db.db.CompactRangeCF(cf.cf, grocksdb.Range{Start: start, Limit: end})
+	return nil
+}
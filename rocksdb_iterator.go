@@ -16,7 +16,7 @@ type rocksDBIterator struct {
 	isInvalid  bool
 }
 
-var _ Iterator = (*rocksDBIterator)(nil)
+var _ UnsafeIterator = (*rocksDBIterator)(nil)
 
 func newRocksDBIterator(source *grocksdb.Iterator, start, end []byte, isReverse bool) *rocksDBIterator {
 	if isReverse {
@@ -76,7 +76,8 @@ func (itr *rocksDBIterator) Valid() bool {
 	// If key is end or past it, invalid.
 	start := itr.start
 	end := itr.end
-	key := moveSliceToBytes(itr.source.Key())
+	// The key is only compared, so it is not copied.
+	key := itr.source.Key().Data()
 	if itr.isReverse {
 		if start != nil && bytes.Compare(key, start) < 0 {
 			itr.isInvalid = true
@@ -107,6 +108,18 @@ func (itr *rocksDBIterator) Value() []byte {
 	return moveSliceToBytes(itr.source.Value())
 }
 
+// UnsafeKey implements UnsafeIterator. The returned slice points to memory of rocksdb.
+func (itr *rocksDBIterator) UnsafeKey() []byte {
+	itr.assertIsValid()
+	return itr.source.Key().Data()
+}
+
+// UnsafeValue implements UnsafeIterator. The returned slice points to memory of rocksdb.
+func (itr *rocksDBIterator) UnsafeValue() []byte {
+	itr.assertIsValid()
+	return itr.source.Value().Data()
+}
+
 // Next implements Iterator.
 func (itr rocksDBIterator) Next() {
 	itr.assertIsValid()
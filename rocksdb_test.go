@@ -34,3 +34,71 @@ func TestRocksDBStats(t *testing.T) {
 }
 
 // TODO: Add tests for rocksdb
+
+func TestRocksDBColumnFamilies(t *testing.T) {
+	dir := t.TempDir()
+	cfg := RocksDBConfig{
+		BlockCacheSize:       8 << 20,
+		RateLimitBytesPerSec: 16 << 20,
+		ColumnFamilies:       []string{"blocks", "state"},
+	}
+	db, err := NewRocksDBWithConfig("cf", dir, cfg)
+	require.NoError(t, err)
+
+	blocks, err := db.ColumnFamily("blocks")
+	require.NoError(t, err)
+	state, err := db.ColumnFamily("state")
+	require.NoError(t, err)
+	_, err = db.ColumnFamily("missing")
+	require.Error(t, err)
+
+	require.NoError(t, db.Set([]byte("a"), []byte("default")))
+	require.NoError(t, blocks.Set([]byte("a"), []byte("blocks")))
+	batch := state.NewBatch()
+	require.NoError(t, batch.Set([]byte("a"), []byte("state")))
+	require.NoError(t, batch.Set([]byte("b"), []byte("state")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+
+	checkValue(t, db, []byte("a"), []byte("default"))
+	checkValue(t, blocks, []byte("a"), []byte("blocks"))
+	checkValue(t, blocks, []byte("b"), nil)
+
+	itr, err := state.Iterator(nil, nil)
+	require.NoError(t, err)
+	var keys []string
+	for ; itr.Valid(); itr.Next() {
+		keys = append(keys, string(itr.Key()))
+	}
+	require.NoError(t, itr.Close())
+	require.Equal(t, []string{"a", "b"}, keys)
+	require.NoError(t, db.Close())
+
+	// Existing column families are reopened even if not listed.
+	db, err = NewRocksDBWithConfig("cf", dir, RocksDBConfig{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.ElementsMatch(t, []string{"default", "blocks", "state"}, db.ColumnFamilies())
+	state, err = db.ColumnFamily("state")
+	require.NoError(t, err)
+	checkValue(t, state, []byte("b"), []byte("state"))
+}
+
+func TestRocksDBSecondary(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := NewRocksDB("primary", dir)
+	require.NoError(t, err)
+	defer primary.Close()
+	require.NoError(t, primary.SetSync([]byte("a"), []byte("1")))
+
+	secondary, err := NewRocksDBSecondary("primary", dir, t.TempDir())
+	require.NoError(t, err)
+	defer secondary.Close()
+	checkValue(t, secondary, []byte("a"), []byte("1"))
+	require.Error(t, secondary.Set([]byte("b"), []byte("2")))
+
+	// Writes of the primary are visible after catching up.
+	require.NoError(t, primary.SetSync([]byte("b"), []byte("2")))
+	require.NoError(t, secondary.CatchUp())
+	checkValue(t, secondary, []byte("b"), []byte("2"))
+}
@@ -0,0 +1,490 @@
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultSamplingRate        = 0.01
+	defaultSamplingPrefixLen   = 1
+	defaultSamplingMaxPrefixes = 256
+)
+
+// samplingSizeBuckets are the upper bounds of the size histograms of a SamplingStatsDB: powers of
+// 4 from 16 bytes to 16 MiB.
+var samplingSizeBuckets = prometheus.ExponentialBuckets(16, 4, 11)
+
+// samplingOtherPrefix is the prefix label of operations on keys whose prefix is not tracked, as
+// MaxPrefixes was reached.
+const samplingOtherPrefix = "other"
+
+// Kinds of operations distinguished by a SamplingStatsDB.
+const (
+	samplingOpRead   = "read"
+	samplingOpWrite  = "write"
+	samplingOpDelete = "delete"
+)
+
+// SamplingStatsDBConfig configures a SamplingStatsDB. Zero values are replaced by defaults.
+type SamplingStatsDBConfig struct {
+	// SampleRate is the fraction of operations sampled, between 0 and 1. Defaults to 0.01.
+	SampleRate float64
+	// PrefixLen is the number of leading key bytes operations are counted by. Defaults to 1, the
+	// prefix length of most CometBFT stores.
+	PrefixLen int
+	// MaxPrefixes is the number of distinct prefixes tracked, bounding the number of metrics.
+	// Operations on further prefixes are counted under "other". Defaults to 256.
+	MaxPrefixes int
+	// HotKeys, if positive, is the number of most frequently accessed keys tracked, returned by
+	// HotKeys. Tracking uses the space-saving algorithm: a key accessed when HotKeys keys are
+	// tracked replaces the least accessed one, inheriting its count, so counts may be
+	// overestimated by up to KeyCount.Error. Defaults to none.
+	HotKeys int
+}
+
+// SamplingStatsDB wraps a database, and samples a fraction of its reads, writes and deletes to
+// maintain histograms of key and value sizes, and counts of operations per key prefix, so that
+// operators can see which stores dominate the load. Counts are those of the sampled operations,
+// i.e. about SampleRate times the actual ones. They are exposed by Stats, and as Prometheus
+// metrics with RegisterMetrics.
+type SamplingStatsDB struct {
+	db  DB
+	cfg SamplingStatsDBConfig
+
+	mtx        sync.Mutex
+	keySizes   map[string]*samplingHistogram // by kind of operation
+	valueSizes map[string]*samplingHistogram // by kind of operation
+	prefixes   map[string]map[string]uint64  // counts by hex prefix and kind of operation
+	hotKeys    map[string]*KeyCount          // by key, if cfg.HotKeys is positive
+}
+
+var _ DB = (*SamplingStatsDB)(nil)
+
+// KeyCount is the sampled number of accesses of a key, as returned by SamplingStatsDB.HotKeys.
+type KeyCount struct {
+	Key   []byte
+	Count uint64
+	// Error is the maximum overestimation of Count, i.e. the count inherited from the key it
+	// replaced.
+	Error uint64
+}
+
+// samplingHistogram is a histogram of sizes over samplingSizeBuckets.
+type samplingHistogram struct {
+	count   uint64
+	sum     uint64
+	max     uint64
+	buckets []uint64 // non-cumulative counts, with a last bucket for larger sizes
+}
+
+func newSamplingHistogram() *samplingHistogram {
+	return &samplingHistogram{buckets: make([]uint64, len(samplingSizeBuckets)+1)}
+}
+
+func (h *samplingHistogram) observe(size int) {
+	h.count++
+	h.sum += uint64(size)
+	h.max = max(h.max, uint64(size))
+	h.buckets[sort.SearchFloat64s(samplingSizeBuckets, float64(size))]++
+}
+
+// NewSamplingStatsDB wraps db, sampling its operations as configured by cfg.
+func NewSamplingStatsDB(db DB, cfg SamplingStatsDBConfig) *SamplingStatsDB {
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaultSamplingRate
+	}
+	if cfg.PrefixLen <= 0 {
+		cfg.PrefixLen = defaultSamplingPrefixLen
+	}
+	if cfg.MaxPrefixes <= 0 {
+		cfg.MaxPrefixes = defaultSamplingMaxPrefixes
+	}
+	sdb := &SamplingStatsDB{
+		db:         db,
+		cfg:        cfg,
+		keySizes:   make(map[string]*samplingHistogram),
+		valueSizes: make(map[string]*samplingHistogram),
+		prefixes:   make(map[string]map[string]uint64),
+	}
+	if cfg.HotKeys > 0 {
+		sdb.hotKeys = make(map[string]*KeyCount, cfg.HotKeys)
+	}
+	return sdb
+}
+
+// sample returns whether to sample an operation.
+func (sdb *SamplingStatsDB) sample() bool {
+	return sdb.cfg.SampleRate >= 1 || rand.Float64() < sdb.cfg.SampleRate
+}
+
+// record records a sampled operation. The value size is negative for operations without a value,
+// i.e. deletes and reads of missing keys.
+func (sdb *SamplingStatsDB) record(op string, key []byte, valueSize int) {
+	prefix := key
+	if len(prefix) > sdb.cfg.PrefixLen {
+		prefix = prefix[:sdb.cfg.PrefixLen]
+	}
+	label := hex.EncodeToString(prefix)
+
+	sdb.mtx.Lock()
+	defer sdb.mtx.Unlock()
+	counts, ok := sdb.prefixes[label]
+	if !ok {
+		if len(sdb.prefixes) >= sdb.cfg.MaxPrefixes {
+			label = samplingOtherPrefix
+			counts = sdb.prefixes[label]
+		}
+		if counts == nil {
+			counts = make(map[string]uint64)
+			sdb.prefixes[label] = counts
+		}
+	}
+	counts[op]++
+	observeSize(sdb.keySizes, op, len(key))
+	if valueSize >= 0 {
+		observeSize(sdb.valueSizes, op, valueSize)
+	}
+	if sdb.hotKeys != nil {
+		sdb.countAccess(key)
+	}
+}
+
+// countAccess counts an access of key among the hot keys, replacing the least accessed key if
+// cfg.HotKeys keys are tracked. Finding it takes time linear in cfg.HotKeys, which is affordable
+// as only sampled operations are counted.
+func (sdb *SamplingStatsDB) countAccess(key []byte) {
+	if kc, ok := sdb.hotKeys[string(key)]; ok {
+		kc.Count++
+		return
+	}
+	if len(sdb.hotKeys) < sdb.cfg.HotKeys {
+		sdb.hotKeys[string(key)] = &KeyCount{Key: cp(key), Count: 1}
+		return
+	}
+	var least *KeyCount
+	for _, kc := range sdb.hotKeys {
+		if least == nil || kc.Count < least.Count {
+			least = kc
+		}
+	}
+	delete(sdb.hotKeys, string(least.Key))
+	sdb.hotKeys[string(key)] = &KeyCount{Key: cp(key), Count: least.Count + 1, Error: least.Count}
+}
+
+// HotKeys returns the most frequently accessed keys among the sampled operations, by decreasing
+// count, or nil unless SamplingStatsDBConfig.HotKeys is set.
+func (sdb *SamplingStatsDB) HotKeys() []KeyCount {
+	sdb.mtx.Lock()
+	defer sdb.mtx.Unlock()
+	if sdb.hotKeys == nil {
+		return nil
+	}
+	hot := make([]KeyCount, 0, len(sdb.hotKeys))
+	for _, kc := range sdb.hotKeys {
+		hot = append(hot, KeyCount{Key: cp(kc.Key), Count: kc.Count, Error: kc.Error})
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Count != hot[j].Count {
+			return hot[i].Count > hot[j].Count
+		}
+		return bytes.Compare(hot[i].Key, hot[j].Key) < 0
+	})
+	return hot
+}
+
+// observeSize observes a size in the histogram of op.
+func observeSize(histograms map[string]*samplingHistogram, op string, size int) {
+	h, ok := histograms[op]
+	if !ok {
+		h = newSamplingHistogram()
+		histograms[op] = h
+	}
+	h.observe(size)
+}
+
+// valueSize returns the size of a value read, or -1 if it is missing.
+func valueSize(value []byte) int {
+	if value == nil {
+		return -1
+	}
+	return len(value)
+}
+
+// Get implements DB.
+func (sdb *SamplingStatsDB) Get(key []byte) ([]byte, error) {
+	value, err := sdb.db.Get(key)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpRead, key, valueSize(value))
+	}
+	return value, err
+}
+
+// Has implements DB.
+func (sdb *SamplingStatsDB) Has(key []byte) (bool, error) {
+	ok, err := sdb.db.Has(key)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpRead, key, -1)
+	}
+	return ok, err
+}
+
+// Set implements DB.
+func (sdb *SamplingStatsDB) Set(key []byte, value []byte) error {
+	err := sdb.db.Set(key, value)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpWrite, key, len(value))
+	}
+	return err
+}
+
+// SetSync implements DB.
+func (sdb *SamplingStatsDB) SetSync(key []byte, value []byte) error {
+	err := sdb.db.SetSync(key, value)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpWrite, key, len(value))
+	}
+	return err
+}
+
+// Delete implements DB.
+func (sdb *SamplingStatsDB) Delete(key []byte) error {
+	err := sdb.db.Delete(key)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpDelete, key, -1)
+	}
+	return err
+}
+
+// DeleteSync implements DB.
+func (sdb *SamplingStatsDB) DeleteSync(key []byte) error {
+	err := sdb.db.DeleteSync(key)
+	if err == nil && sdb.sample() {
+		sdb.record(samplingOpDelete, key, -1)
+	}
+	return err
+}
+
+// Iterator implements DB.
+func (sdb *SamplingStatsDB) Iterator(start, end []byte) (Iterator, error) {
+	return sdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (sdb *SamplingStatsDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return sdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (sdb *SamplingStatsDB) Close() error {
+	return sdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (sdb *SamplingStatsDB) NewBatch() Batch {
+	return &samplingStatsDBBatch{
+		sdb:   sdb,
+		batch: sdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (sdb *SamplingStatsDB) Print() error {
+	return sdb.db.Print()
+}
+
+// Stats implements DB. It adds the number of samples, the mean and maximum key and value sizes
+// of each kind of operation, and the sampled counts per prefix, e.g.
+// "sampling.prefix.48.write".
+func (sdb *SamplingStatsDB) Stats() map[string]string {
+	stats := sdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	sdb.mtx.Lock()
+	defer sdb.mtx.Unlock()
+	var samples uint64
+	for op, h := range sdb.keySizes {
+		samples += h.count
+		addSizeStats(stats, "sampling.key_size."+op, h)
+	}
+	for op, h := range sdb.valueSizes {
+		addSizeStats(stats, "sampling.value_size."+op, h)
+	}
+	for prefix, counts := range sdb.prefixes {
+		for op, count := range counts {
+			stats["sampling.prefix."+prefix+"."+op] = strconv.FormatUint(count, 10)
+		}
+	}
+	stats["sampling.samples"] = strconv.FormatUint(samples, 10)
+	return stats
+}
+
+// addSizeStats adds the mean and maximum of a histogram to stats.
+func addSizeStats(stats map[string]string, name string, h *samplingHistogram) {
+	stats[name+".mean"] = strconv.FormatUint(h.sum/h.count, 10)
+	stats[name+".max"] = strconv.FormatUint(h.max, 10)
+}
+
+// Compact implements DB.
+func (sdb *SamplingStatsDB) Compact(start, end []byte) error {
+	return sdb.db.Compact(start, end)
+}
+
+// RegisterMetrics registers the sampled statistics of the database with the given name with reg,
+// as the histograms storage_sampled_key_size_bytes and storage_sampled_value_size_bytes by kind of
+// operation, and the counter storage_sampled_operations_total by prefix and kind of operation,
+// within namespace.
+func (sdb *SamplingStatsDB) RegisterMetrics(namespace, name string, reg prometheus.Registerer) error {
+	labels := prometheus.Labels{"db": name}
+	return reg.Register(&samplingStatsCollector{
+		sdb: sdb,
+		keySizes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "sampled_key_size_bytes"),
+			"Sizes of the keys of sampled operations.", []string{"op"}, labels),
+		valueSizes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "sampled_value_size_bytes"),
+			"Sizes of the values of sampled operations.", []string{"op"}, labels),
+		operations: prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "sampled_operations_total"),
+			"Number of sampled operations by key prefix.", []string{"prefix", "op"}, labels),
+	})
+}
+
+// samplingStatsCollector collects the statistics of a SamplingStatsDB.
+type samplingStatsCollector struct {
+	sdb        *SamplingStatsDB
+	keySizes   *prometheus.Desc
+	valueSizes *prometheus.Desc
+	operations *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*samplingStatsCollector)(nil)
+
+// Describe implements prometheus.Collector.
+func (c *samplingStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.keySizes
+	ch <- c.valueSizes
+	ch <- c.operations
+}
+
+// Collect implements prometheus.Collector.
+func (c *samplingStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.sdb.mtx.Lock()
+	defer c.sdb.mtx.Unlock()
+	for op, h := range c.sdb.keySizes {
+		ch <- constHistogram(c.keySizes, h, op)
+	}
+	for op, h := range c.sdb.valueSizes {
+		ch <- constHistogram(c.valueSizes, h, op)
+	}
+	for prefix, counts := range c.sdb.prefixes {
+		for op, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.operations, prometheus.CounterValue, float64(count), prefix, op)
+		}
+	}
+}
+
+// constHistogram returns a histogram metric from a samplingHistogram.
+func constHistogram(desc *prometheus.Desc, h *samplingHistogram, labels ...string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(samplingSizeBuckets))
+	var cumulative uint64
+	for i, bound := range samplingSizeBuckets {
+		cumulative += h.buckets[i]
+		buckets[bound] = cumulative
+	}
+	return prometheus.MustNewConstHistogram(desc, h.count, float64(h.sum), buckets, labels...)
+}
+
+// samplingStatsDBBatch samples the operations of a batch when it is written.
+type samplingStatsDBBatch struct {
+	sdb     *SamplingStatsDB
+	batch   Batch
+	samples []samplingSample
+}
+
+// samplingSample is a sampled batch operation.
+type samplingSample struct {
+	op        string
+	key       []byte
+	valueSize int
+}
+
+var _ Batch = (*samplingStatsDBBatch)(nil)
+
+// Set implements Batch.
+func (b *samplingStatsDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	if b.sdb.sample() {
+		b.samples = append(b.samples, samplingSample{samplingOpWrite, cp(key), len(value)})
+	}
+	return nil
+}
+
+// Delete implements Batch.
+func (b *samplingStatsDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	if b.sdb.sample() {
+		b.samples = append(b.samples, samplingSample{samplingOpDelete, cp(key), -1})
+	}
+	return nil
+}
+
+// Count implements Batch.
+func (b *samplingStatsDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *samplingStatsDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *samplingStatsDBBatch) Write() error {
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	b.flush()
+	return nil
+}
+
+// WriteSync implements Batch.
+func (b *samplingStatsDBBatch) WriteSync() error {
+	if err := b.batch.WriteSync(); err != nil {
+		return err
+	}
+	b.flush()
+	return nil
+}
+
+// flush records the sampled operations of the written batch.
+func (b *samplingStatsDBBatch) flush() {
+	for _, sample := range b.samples {
+		b.sdb.record(sample.op, sample.key, sample.valueSize)
+	}
+	clear(b.samples)
+	b.samples = b.samples[:0]
+}
+
+// Reset implements Batch.
+func (b *samplingStatsDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.samples)
+	b.samples = b.samples[:0]
+	return nil
+}
+
+// Close implements Batch.
+func (b *samplingStatsDBBatch) Close() error {
+	return b.batch.Close()
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingStatsDB(t *testing.T) {
+	sdb := NewSamplingStatsDB(NewMemDB(), SamplingStatsDBConfig{SampleRate: 1, MaxPrefixes: 2})
+	defer sdb.Close()
+
+	require.NoError(t, sdb.Set(bz("H:1"), make([]byte, 100)))
+	require.NoError(t, sdb.SetSync(bz("H:2"), make([]byte, 300)))
+	checkValue(t, sdb, bz("H:1"), make([]byte, 100))
+	checkValue(t, sdb, bz("P:1"), nil)
+	batch := sdb.NewBatch()
+	require.NoError(t, batch.Set(bz("P:2"), bz("x")))
+	require.NoError(t, batch.Delete(bz("H:1")))
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	// A third prefix is counted as other.
+	require.NoError(t, sdb.Delete(bz("S:1")))
+
+	stats := sdb.Stats()
+	require.Equal(t, "7", stats["sampling.samples"])
+	require.Equal(t, "2", stats["sampling.prefix.48.write"])
+	require.Equal(t, "1", stats["sampling.prefix.48.read"])
+	require.Equal(t, "1", stats["sampling.prefix.48.delete"])
+	require.Equal(t, "1", stats["sampling.prefix.50.read"])
+	require.Equal(t, "1", stats["sampling.prefix.50.write"])
+	require.Equal(t, "1", stats["sampling.prefix.other.delete"])
+	require.Equal(t, "133", stats["sampling.value_size.write.mean"])
+	require.Equal(t, "300", stats["sampling.value_size.write.max"])
+	require.Equal(t, "100", stats["sampling.value_size.read.max"])
+	require.Equal(t, "3", stats["sampling.key_size.delete.max"])
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, sdb.RegisterMetrics("test", "state", reg))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	operations := make(map[string]float64)
+	histograms := 0
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			require.Equal(t, "state", labels["db"])
+			switch f.GetName() {
+			case "test_storage_sampled_operations_total":
+				operations[labels["prefix"]+"/"+labels["op"]] = m.GetCounter().GetValue()
+			case "test_storage_sampled_value_size_bytes":
+				histograms++
+				if labels["op"] == "write" {
+					require.EqualValues(t, 3, m.GetHistogram().GetSampleCount())
+					require.EqualValues(t, 401, m.GetHistogram().GetSampleSum())
+				}
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"48/write": 2, "48/read": 1, "48/delete": 1,
+		"50/write": 1, "50/read": 1, "other/delete": 1,
+	}, operations)
+	require.Equal(t, 2, histograms)
+}
+
+func TestSamplingStatsDBSampleRate(t *testing.T) {
+	sdb := NewSamplingStatsDB(NewMemDB(), SamplingStatsDBConfig{SampleRate: 0.1})
+	defer sdb.Close()
+
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, sdb.Set(int642Bytes(int64(i)), bz("x")))
+	}
+	var samples int
+	for _, h := range sdb.keySizes {
+		samples += int(h.count)
+	}
+	require.InDelta(t, 1000, samples, 200)
+}
+
+func TestSamplingStatsDBHotKeys(t *testing.T) {
+	sdb := NewSamplingStatsDB(NewMemDB(), SamplingStatsDBConfig{SampleRate: 1, HotKeys: 2})
+	defer sdb.Close()
+	require.Nil(t, NewSamplingStatsDB(NewMemDB(), SamplingStatsDBConfig{}).HotKeys())
+
+	for i := 0; i < 3; i++ {
+		checkValue(t, sdb, bz("a"), nil)
+	}
+	require.NoError(t, sdb.Set(bz("b"), bz("1")))
+	require.NoError(t, sdb.Set(bz("b"), bz("2")))
+	// c replaces b, the least accessed key, inheriting its count.
+	require.NoError(t, sdb.Delete(bz("c")))
+
+	require.Equal(t, []KeyCount{
+		{Key: bz("a"), Count: 3},
+		{Key: bz("c"), Count: 3, Error: 2},
+	}, sdb.HotKeys())
+}
@@ -0,0 +1,538 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultShadowReadQueueSize = 1024
+	defaultShadowReadPageSize  = 100
+)
+
+// ShadowReadDBConfig configures a ShadowReadDB. Zero values are replaced by defaults.
+type ShadowReadDBConfig struct {
+	// QueueSize is the number of comparisons which can wait to be run. Further comparisons are
+	// dropped, so that reads are never slowed down. Defaults to 1024.
+	QueueSize int
+	// PageSize is the number of iterated items compared at once. Defaults to 100.
+	PageSize int
+	// Logger, if set, is used to report mismatches and errors of the shadow database.
+	Logger Logger
+	// Repair makes mismatches rewrite the shadow database with the items read from the wrapped
+	// one, so that a shadow which diverged, e.g. because of a lost write, converges back. Repairs
+	// are not serialized with the writes applied to the shadow by other means: a repair racing
+	// with such a write may undo it, until the key is read and repaired again.
+	Repair bool
+}
+
+// ShadowReadDB wraps a database, serving all operations from it, and compares the results of
+// reads against a shadow database in a background goroutine, to validate a new backend before
+// trusting it. Gets and Has are compared, and iterations are compared by pages of items.
+//
+// Writes are only applied to the wrapped database, so the shadow must be kept up to date by other
+// means, e.g. by wrapping a MirrorDB writing to both. As comparisons run after the reads, a
+// comparison is skipped when the wrapped database no longer returns the same result, i.e. when it
+// was written to in the meantime.
+type ShadowReadDB struct {
+	db     DB
+	shadow DB
+	cfg    ShadowReadDBConfig
+	queue  chan shadowComparison
+	done   chan struct{}
+
+	closeMtx sync.RWMutex // guards closed against enqueuing
+	closed   bool
+
+	mtx        sync.Mutex
+	matches    uint64
+	mismatches uint64
+	skipped    uint64
+	dropped    uint64
+	failures   uint64
+	repairs    uint64
+}
+
+var _ DB = (*ShadowReadDB)(nil)
+
+// shadowComparison is a read to compare against the shadow database. Point reads have a key,
+// iterator pages have the range they cover in the direction of the iteration, and their items.
+type shadowComparison struct {
+	op    DBOperation
+	key   []byte
+	value []byte // value read, nil if the key did not exist
+	start []byte
+	end   []byte
+	items []mirrorItem
+}
+
+// NewShadowReadDB wraps db, comparing its reads against shadow, and starts the comparison
+// goroutine. Callers must call Close when done.
+func NewShadowReadDB(db, shadow DB, cfg ShadowReadDBConfig) *ShadowReadDB {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultShadowReadQueueSize
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = defaultShadowReadPageSize
+	}
+	sdb := &ShadowReadDB{
+		db:     db,
+		shadow: shadow,
+		cfg:    cfg,
+		queue:  make(chan shadowComparison, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go sdb.run()
+	return sdb
+}
+
+// enqueue schedules a comparison, or drops it if the queue is full.
+func (sdb *ShadowReadDB) enqueue(c shadowComparison) {
+	sdb.closeMtx.RLock()
+	defer sdb.closeMtx.RUnlock()
+	if sdb.closed {
+		return
+	}
+	select {
+	case sdb.queue <- c:
+	default:
+		sdb.count(&sdb.dropped)
+	}
+}
+
+// count increments a counter.
+func (sdb *ShadowReadDB) count(counter *uint64) {
+	sdb.mtx.Lock()
+	defer sdb.mtx.Unlock()
+	*counter++
+}
+
+// run runs comparisons until the queue is closed.
+func (sdb *ShadowReadDB) run() {
+	defer close(sdb.done)
+	for c := range sdb.queue {
+		sdb.compare(c)
+	}
+}
+
+// compare runs a comparison, and records its outcome.
+func (sdb *ShadowReadDB) compare(c shadowComparison) {
+	var (
+		mismatch bool
+		details  string
+		err      error
+	)
+	switch c.op {
+	case OpGet, OpHas:
+		mismatch, details, err = sdb.comparePoint(c)
+	default:
+		mismatch, details, err = sdb.comparePage(c)
+	}
+	switch {
+	case errors.Is(err, errShadowSkipped):
+		sdb.count(&sdb.skipped)
+	case err != nil:
+		sdb.count(&sdb.failures)
+		if sdb.cfg.Logger != nil {
+			sdb.cfg.Logger.Error("shadow read failed", "op", string(c.op), "err", err)
+		}
+	case mismatch:
+		sdb.count(&sdb.mismatches)
+		if sdb.cfg.Logger != nil {
+			sdb.cfg.Logger.Error("shadow read mismatch", "op", string(c.op), "details", details)
+		}
+		if !sdb.cfg.Repair {
+			return
+		}
+		if err := sdb.repair(c); err != nil {
+			sdb.count(&sdb.failures)
+			if sdb.cfg.Logger != nil {
+				sdb.cfg.Logger.Error("shadow read repair failed", "op", string(c.op), "err", err)
+			}
+			return
+		}
+		sdb.count(&sdb.repairs)
+	default:
+		sdb.count(&sdb.matches)
+	}
+}
+
+// errShadowSkipped reports that a comparison was skipped, as the wrapped database was written to
+// since the read.
+var errShadowSkipped = errors.New("shadow comparison skipped")
+
+// comparePoint compares a Get or Has.
+func (sdb *ShadowReadDB) comparePoint(c shadowComparison) (bool, string, error) {
+	value, err := sdb.db.Get(c.key)
+	if err != nil {
+		return false, "", err
+	}
+	if !bytes.Equal(value, c.value) || (value == nil) != (c.value == nil) {
+		return false, "", errShadowSkipped
+	}
+	shadowValue, err := sdb.shadow.Get(c.key)
+	if err != nil {
+		return false, "", err
+	}
+	if c.op == OpHas {
+		if (shadowValue == nil) != (c.value == nil) {
+			return true, fmt.Sprintf("key %X exists: %t, in shadow: %t", c.key, c.value != nil, shadowValue != nil), nil
+		}
+		return false, "", nil
+	}
+	if !bytes.Equal(shadowValue, c.value) || (shadowValue == nil) != (c.value == nil) {
+		return true, fmt.Sprintf("key %X has value %X, in shadow: %X", c.key, c.value, shadowValue), nil
+	}
+	return false, "", nil
+}
+
+// comparePage compares a page of iterated items.
+func (sdb *ShadowReadDB) comparePage(c shadowComparison) (bool, string, error) {
+	isReverse := c.op == OpReverseIterator
+	items, err := readDirection(sdb.db, c.start, c.end, isReverse)
+	if err != nil {
+		return false, "", err
+	}
+	if !equalItems(items, c.items) {
+		return false, "", errShadowSkipped
+	}
+	shadowItems, err := readDirection(sdb.shadow, c.start, c.end, isReverse)
+	if err != nil {
+		return false, "", err
+	}
+	if !equalItems(shadowItems, c.items) {
+		return true, fmt.Sprintf("range [%X, %X) has %d items, in shadow: %d, or values differ",
+			c.start, c.end, len(c.items), len(shadowItems)), nil
+	}
+	return false, "", nil
+}
+
+// repair rewrites the shadow database with the result of a mismatching read: the key read, or all
+// the items of the range of an iterator page.
+func (sdb *ShadowReadDB) repair(c shadowComparison) error {
+	batch := sdb.shadow.NewBatch()
+	defer batch.Close()
+	switch c.op {
+	case OpGet, OpHas:
+		if c.value == nil {
+			if err := batch.Delete(c.key); err != nil {
+				return err
+			}
+		} else if err := batch.Set(c.key, c.value); err != nil {
+			return err
+		}
+	default:
+		// The batch applies the deletes of the items of the shadow before the sets.
+		shadowItems, err := readRange(sdb.shadow, c.start, c.end)
+		if err != nil {
+			return err
+		}
+		for _, item := range shadowItems {
+			if err := batch.Delete(item.key); err != nil {
+				return err
+			}
+		}
+		for _, item := range c.items {
+			if err := batch.Set(item.key, item.value); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Write()
+}
+
+// readDirection reads all items within [start, end), in reverse order if isReverse.
+func readDirection(db DB, start, end []byte, isReverse bool) ([]mirrorItem, error) {
+	if !isReverse {
+		return readRange(db, start, end)
+	}
+	itr, err := db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	var items []mirrorItem
+	for ; itr.Valid(); itr.Next() {
+		items = append(items, mirrorItem{cp(itr.Key()), cp(itr.Value())})
+	}
+	return items, itr.Error()
+}
+
+// cpNil copies bz, keeping nil values nil.
+func cpNil(bz []byte) []byte {
+	if bz == nil {
+		return nil
+	}
+	return cp(bz)
+}
+
+// equalItems returns whether two lists of items are equal.
+func equalItems(a, b []mirrorItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i].key, b[i].key) || !bytes.Equal(a[i].value, b[i].value) {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterMetrics registers counters of the comparisons of the database with the given name,
+// named storage_shadow_* within namespace, with reg.
+func (sdb *ShadowReadDB) RegisterMetrics(namespace, name string, reg prometheus.Registerer) error {
+	counters := []struct {
+		name    string
+		help    string
+		counter *uint64
+	}{
+		{"shadow_matches_total", "Number of reads which matched the shadow database.", &sdb.matches},
+		{"shadow_mismatches_total", "Number of reads which did not match the shadow database.", &sdb.mismatches},
+		{"shadow_skipped_total", "Number of comparisons skipped due to concurrent writes.", &sdb.skipped},
+		{"shadow_dropped_total", "Number of comparisons dropped as the queue was full.", &sdb.dropped},
+		{"shadow_errors_total", "Number of comparisons or repairs which failed with an error.", &sdb.failures},
+		{"shadow_repairs_total", "Number of mismatches repaired in the shadow database.", &sdb.repairs},
+	}
+	for _, c := range counters {
+		counter := c.counter
+		err := reg.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "storage",
+			Name:        c.name,
+			Help:        c.help,
+			ConstLabels: prometheus.Labels{"db": name},
+		}, func() float64 {
+			sdb.mtx.Lock()
+			defer sdb.mtx.Unlock()
+			return float64(*counter)
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get implements DB.
+func (sdb *ShadowReadDB) Get(key []byte) ([]byte, error) {
+	value, err := sdb.db.Get(key)
+	if err == nil {
+		sdb.enqueue(shadowComparison{op: OpGet, key: cp(key), value: cpNil(value)})
+	}
+	return value, err
+}
+
+// Has implements DB.
+func (sdb *ShadowReadDB) Has(key []byte) (bool, error) {
+	value, err := sdb.db.Get(key)
+	if err != nil {
+		return false, err
+	}
+	sdb.enqueue(shadowComparison{op: OpHas, key: cp(key), value: cpNil(value)})
+	return value != nil, nil
+}
+
+// Set implements DB.
+func (sdb *ShadowReadDB) Set(key []byte, value []byte) error {
+	return sdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (sdb *ShadowReadDB) SetSync(key []byte, value []byte) error {
+	return sdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (sdb *ShadowReadDB) Delete(key []byte) error {
+	return sdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (sdb *ShadowReadDB) DeleteSync(key []byte) error {
+	return sdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (sdb *ShadowReadDB) Iterator(start, end []byte) (Iterator, error) {
+	itr, err := sdb.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return newShadowReadDBIterator(sdb, itr, OpIterator), nil
+}
+
+// ReverseIterator implements DB.
+func (sdb *ShadowReadDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	itr, err := sdb.db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return newShadowReadDBIterator(sdb, itr, OpReverseIterator), nil
+}
+
+// Close implements DB. It waits for the queued comparisons, and closes both databases.
+func (sdb *ShadowReadDB) Close() error {
+	sdb.closeMtx.Lock()
+	if sdb.closed {
+		sdb.closeMtx.Unlock()
+		return nil
+	}
+	sdb.closed = true
+	close(sdb.queue)
+	sdb.closeMtx.Unlock()
+	<-sdb.done
+
+	err := sdb.db.Close()
+	if closeErr := sdb.shadow.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (sdb *ShadowReadDB) NewBatch() Batch {
+	return sdb.db.NewBatch()
+}
+
+// Print implements DB.
+func (sdb *ShadowReadDB) Print() error {
+	return sdb.db.Print()
+}
+
+// Stats implements DB.
+func (sdb *ShadowReadDB) Stats() map[string]string {
+	stats := sdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	sdb.mtx.Lock()
+	defer sdb.mtx.Unlock()
+	stats["shadow.matches"] = strconv.FormatUint(sdb.matches, 10)
+	stats["shadow.mismatches"] = strconv.FormatUint(sdb.mismatches, 10)
+	stats["shadow.skipped"] = strconv.FormatUint(sdb.skipped, 10)
+	stats["shadow.dropped"] = strconv.FormatUint(sdb.dropped, 10)
+	stats["shadow.errors"] = strconv.FormatUint(sdb.failures, 10)
+	stats["shadow.repairs"] = strconv.FormatUint(sdb.repairs, 10)
+	return stats
+}
+
+// Compact implements DB.
+func (sdb *ShadowReadDB) Compact(start, end []byte) error {
+	return sdb.db.Compact(start, end)
+}
+
+// shadowReadDBIterator records the iterated items, and enqueues a comparison of every page of
+// them, and of the last partial page when exhausted or closed.
+type shadowReadDBIterator struct {
+	sdb       *ShadowReadDB
+	source    Iterator
+	op        DBOperation
+	bound     []byte // bound of the current page opposite to the iteration direction
+	items     []mirrorItem
+	exhausted bool
+}
+
+var _ Iterator = (*shadowReadDBIterator)(nil)
+
+func newShadowReadDBIterator(sdb *ShadowReadDB, source Iterator, op DBOperation) *shadowReadDBIterator {
+	start, end := source.Domain()
+	itr := &shadowReadDBIterator{sdb: sdb, source: source, op: op, bound: start}
+	if op == OpReverseIterator {
+		itr.bound = end
+	}
+	itr.record()
+	return itr
+}
+
+// record records the current item, and enqueues the page if it is full or the iteration is done.
+func (itr *shadowReadDBIterator) record() {
+	if itr.exhausted {
+		return
+	}
+	if !itr.source.Valid() {
+		itr.exhausted = true
+		if itr.source.Error() == nil {
+			itr.flush(true)
+		}
+		return
+	}
+	itr.items = append(itr.items, mirrorItem{cp(itr.source.Key()), cp(itr.source.Value())})
+	if len(itr.items) >= itr.sdb.cfg.PageSize {
+		itr.flush(false)
+	}
+}
+
+// flush enqueues the comparison of the current page. If the iteration is done, the page extends
+// to the end of the domain, otherwise to its last item.
+func (itr *shadowReadDBIterator) flush(done bool) {
+	if !done && len(itr.items) == 0 {
+		return
+	}
+	domainStart, domainEnd := itr.source.Domain()
+	c := shadowComparison{op: itr.op, items: itr.items}
+	var last []byte
+	if len(itr.items) > 0 {
+		last = itr.items[len(itr.items)-1].key
+	}
+	if itr.op == OpReverseIterator {
+		c.start, c.end = domainStart, itr.bound
+		if !done {
+			c.start = last
+		}
+		itr.bound = last
+	} else {
+		c.start, c.end = itr.bound, domainEnd
+		if !done {
+			c.end = append(cp(last), 0x00)
+		}
+		itr.bound = append(cp(last), 0x00)
+	}
+	itr.sdb.enqueue(c)
+	itr.items = nil
+}
+
+// Domain implements Iterator.
+func (itr *shadowReadDBIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *shadowReadDBIterator) Valid() bool {
+	return itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *shadowReadDBIterator) Next() {
+	itr.source.Next()
+	itr.record()
+}
+
+// Key implements Iterator.
+func (itr *shadowReadDBIterator) Key() []byte {
+	return itr.source.Key()
+}
+
+// Value implements Iterator.
+func (itr *shadowReadDBIterator) Value() []byte {
+	return itr.source.Value()
+}
+
+// Error implements Iterator.
+func (itr *shadowReadDBIterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements Iterator. The items iterated since the last page are compared.
+func (itr *shadowReadDBIterator) Close() error {
+	if !itr.exhausted {
+		itr.exhausted = true
+		itr.flush(false)
+	}
+	return itr.source.Close()
+}
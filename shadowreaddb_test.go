@@ -0,0 +1,139 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// newShadowReadTestDBs returns two databases with the same five keys.
+func newShadowReadTestDBs(t *testing.T) (*MemDB, *MemDB) {
+	t.Helper()
+	db, shadow := NewMemDB(), NewMemDB()
+	for _, key := range []string{"a", "c", "e", "g", "i"} {
+		require.NoError(t, db.Set(bz(key), bz(key)))
+		require.NoError(t, shadow.Set(bz(key), bz(key)))
+	}
+	return db, shadow
+}
+
+// iterateAll iterates over itr, and closes it.
+func iterateAll(t *testing.T, itr Iterator) {
+	t.Helper()
+	for ; itr.Valid(); itr.Next() {
+	}
+	require.NoError(t, itr.Close())
+}
+
+func TestShadowReadDBPointReads(t *testing.T) {
+	db, shadow := newShadowReadTestDBs(t)
+	require.NoError(t, shadow.Set(bz("a"), bz("x")))
+	require.NoError(t, shadow.Set(bz("b"), bz("b")))
+	logger := &testLogger{}
+	sdb := NewShadowReadDB(db, shadow, ShadowReadDBConfig{Logger: logger})
+
+	checkValue(t, sdb, bz("c"), bz("c"))
+	checkValue(t, sdb, bz("a"), bz("a"))
+	ok, err := sdb.Has(bz("b"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = sdb.Has(bz("a"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, sdb.Close())
+	stats := sdb.Stats()
+	require.Equal(t, "2", stats["shadow.matches"])
+	require.Equal(t, "2", stats["shadow.mismatches"])
+	require.Len(t, logger.lines, 2)
+}
+
+func TestShadowReadDBIterator(t *testing.T) {
+	db, shadow := newShadowReadTestDBs(t)
+	require.NoError(t, shadow.Set(bz("k"), bz("k")))
+	sdb := NewShadowReadDB(db, shadow, ShadowReadDBConfig{PageSize: 2})
+
+	// Full iterations are compared in pages of 2 items, and a last page up to the end of the
+	// domain, which does not match as it covers k.
+	itr, err := sdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	iterateAll(t, itr)
+	itr, err = sdb.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	iterateAll(t, itr)
+	itr, err = sdb.ReverseIterator(bz("b"), bz("h"))
+	require.NoError(t, err)
+	iterateAll(t, itr)
+
+	// Partial iterations are compared up to the last item iterated.
+	itr, err = sdb.Iterator(bz("b"), nil)
+	require.NoError(t, err)
+	for _, key := range []string{"c", "e", "g"} {
+		require.Equal(t, bz(key), itr.Key())
+		itr.Next()
+	}
+	require.NoError(t, itr.Close())
+
+	require.NoError(t, sdb.Close())
+	stats := sdb.Stats()
+	require.Equal(t, "8", stats["shadow.matches"])
+	require.Equal(t, "2", stats["shadow.mismatches"])
+}
+
+func TestShadowReadDBSkipped(t *testing.T) {
+	db, shadow := newShadowReadTestDBs(t)
+	sdb := NewShadowReadDB(db, shadow, ShadowReadDBConfig{})
+	defer sdb.Close()
+
+	// Comparisons of reads made before a write to the database are skipped.
+	sdb.compare(shadowComparison{op: OpGet, key: bz("a"), value: bz("old")})
+	sdb.compare(shadowComparison{op: OpIterator, start: bz("a"), end: bz("b"), items: nil})
+	require.Equal(t, "2", sdb.Stats()["shadow.skipped"])
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, sdb.RegisterMetrics("test", "state", reg))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 6)
+}
+
+func TestShadowReadDBRepair(t *testing.T) {
+	db, shadow := newShadowReadTestDBs(t)
+	require.NoError(t, shadow.Set(bz("a"), bz("x")))
+	require.NoError(t, shadow.Set(bz("b"), bz("b")))
+	require.NoError(t, shadow.Delete(bz("g")))
+	require.NoError(t, shadow.Set(bz("h"), bz("h")))
+	logger := &testLogger{}
+	sdb := NewShadowReadDB(db, shadow, ShadowReadDBConfig{PageSize: 2, Logger: logger, Repair: true})
+
+	// Mismatching point reads rewrite the key in the shadow.
+	checkValue(t, sdb, bz("a"), bz("a"))
+	ok, err := sdb.Has(bz("b"))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Mismatching iterator pages rewrite their range in the shadow.
+	itr, err := sdb.Iterator(bz("e"), nil)
+	require.NoError(t, err)
+	iterateAll(t, itr)
+
+	require.NoError(t, sdb.Close())
+	stats := sdb.Stats()
+	require.Equal(t, "4", stats["shadow.mismatches"])
+	require.Equal(t, "4", stats["shadow.repairs"])
+	require.Len(t, logger.lines, 4)
+	itr, err = shadow.Iterator(nil, nil)
+	require.NoError(t, err)
+	expected, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	for ; expected.Valid(); expected.Next() {
+		require.True(t, itr.Valid())
+		require.Equal(t, expected.Key(), itr.Key())
+		require.Equal(t, expected.Value(), itr.Value())
+		itr.Next()
+	}
+	require.False(t, itr.Valid())
+	require.NoError(t, itr.Close())
+	require.NoError(t, expected.Close())
+}
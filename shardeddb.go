@@ -0,0 +1,363 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// ShardFunc returns the index of the shard storing a key.
+type ShardFunc func(key []byte) int
+
+// HashSharding spreads keys evenly across n shards by their FNV-1a hash.
+func HashSharding(n int) ShardFunc {
+	return func(key []byte) int {
+		h := fnv.New32a()
+		h.Write(key)
+		return int(h.Sum32() % uint32(n))
+	}
+}
+
+// RangeSharding partitions the keyspace into contiguous ranges, e.g. by key prefix, using sorted
+// boundaries: shard 0 stores the keys before boundaries[0], shard i the keys within
+// [boundaries[i-1], boundaries[i]), and the last shard the keys from the last boundary onwards, for
+// a total of len(boundaries)+1 shards.
+func RangeSharding(boundaries ...[]byte) ShardFunc {
+	return func(key []byte) int {
+		return sort.Search(len(boundaries), func(i int) bool {
+			return bytes.Compare(key, boundaries[i]) < 0
+		})
+	}
+}
+
+// ShardedDB partitions the keyspace across several databases, e.g. on different disks, and
+// presents them as a single database. Iterators merge the keys of all shards.
+//
+// Batches are split by shard, and written shard by shard, so they are only atomic within a shard:
+// if writing to a shard fails, the writes to previous shards remain.
+type ShardedDB struct {
+	shards []DB
+	shard  ShardFunc
+}
+
+var _ DB = (*ShardedDB)(nil)
+
+// NewShardedDB creates a database storing every key in shards[shard(key)].
+func NewShardedDB(shards []DB, shard ShardFunc) *ShardedDB {
+	return &ShardedDB{
+		shards: shards,
+		shard:  shard,
+	}
+}
+
+// shardFor returns the shard storing the key.
+func (sdb *ShardedDB) shardFor(key []byte) (DB, error) {
+	i := sdb.shard(key)
+	if i < 0 || i >= len(sdb.shards) {
+		return nil, fmt.Errorf("key %X mapped to shard %d, out of %d shards", key, i, len(sdb.shards))
+	}
+	return sdb.shards[i], nil
+}
+
+// Get implements DB.
+func (sdb *ShardedDB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return nil, err
+	}
+	return shard.Get(key)
+}
+
+// Has implements DB.
+func (sdb *ShardedDB) Has(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return false, err
+	}
+	return shard.Has(key)
+}
+
+// Set implements DB.
+func (sdb *ShardedDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return err
+	}
+	return shard.Set(key, value)
+}
+
+// SetSync implements DB.
+func (sdb *ShardedDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return err
+	}
+	return shard.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (sdb *ShardedDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return err
+	}
+	return shard.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (sdb *ShardedDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	shard, err := sdb.shardFor(key)
+	if err != nil {
+		return err
+	}
+	return shard.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (sdb *ShardedDB) Iterator(start, end []byte) (Iterator, error) {
+	return sdb.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (sdb *ShardedDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return sdb.newIterator(start, end, true)
+}
+
+func (sdb *ShardedDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errKeyEmpty
+	}
+	sources := make([]Iterator, 0, len(sdb.shards))
+	for _, shard := range sdb.shards {
+		var itr Iterator
+		var err error
+		if isReverse {
+			itr, err = shard.ReverseIterator(start, end)
+		} else {
+			itr, err = shard.Iterator(start, end)
+		}
+		if err != nil {
+			for _, source := range sources {
+				source.Close()
+			}
+			return nil, err
+		}
+		sources = append(sources, itr)
+	}
+	return newMergeIterator(start, end, isReverse, sources...), nil
+}
+
+// Close implements DB. It closes all shards, and returns the first error.
+func (sdb *ShardedDB) Close() error {
+	var err error
+	for _, shard := range sdb.shards {
+		if cerr := shard.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (sdb *ShardedDB) NewBatch() Batch {
+	return &shardedDBBatch{
+		sdb:     sdb,
+		batches: make([]Batch, len(sdb.shards)),
+	}
+}
+
+// Print implements DB.
+func (sdb *ShardedDB) Print() error {
+	itr, err := sdb.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		key := itr.Key()
+		value := itr.Value()
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return nil
+}
+
+// Stats implements DB. The stats of every shard are prefixed with "shard<index>.".
+func (sdb *ShardedDB) Stats() map[string]string {
+	stats := make(map[string]string)
+	for i, shard := range sdb.shards {
+		for key, value := range shard.Stats() {
+			stats[fmt.Sprintf("shard%d.%s", i, key)] = value
+		}
+	}
+	return stats
+}
+
+// Compact implements DB. It compacts the range in all shards.
+func (sdb *ShardedDB) Compact(start, end []byte) error {
+	for _, shard := range sdb.shards {
+		if err := shard.Compact(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardedDBBatch creates a batch per shard on first use.
+type shardedDBBatch struct {
+	sdb     *ShardedDB
+	batches []Batch // nil once closed or written
+	written []Batch // the batches of the shards already written, reused by Reset
+}
+
+var _ Batch = (*shardedDBBatch)(nil)
+
+// batchFor returns the batch of the shard storing the key.
+func (b *shardedDBBatch) batchFor(key []byte) (Batch, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	if b.batches == nil {
+		return nil, errBatchClosed
+	}
+	i := b.sdb.shard(key)
+	if i < 0 || i >= len(b.batches) {
+		return nil, fmt.Errorf("key %X mapped to shard %d, out of %d shards", key, i, len(b.batches))
+	}
+	if b.batches[i] == nil {
+		b.batches[i] = b.sdb.shards[i].NewBatch()
+	}
+	return b.batches[i], nil
+}
+
+// Set implements Batch.
+func (b *shardedDBBatch) Set(key, value []byte) error {
+	batch, err := b.batchFor(key)
+	if err != nil {
+		return err
+	}
+	return batch.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *shardedDBBatch) Delete(key []byte) error {
+	batch, err := b.batchFor(key)
+	if err != nil {
+		return err
+	}
+	return batch.Delete(key)
+}
+
+// Count implements Batch. It is the total of the batches of the shards.
+func (b *shardedDBBatch) Count() int {
+	n := 0
+	for _, batch := range b.batches {
+		if batch != nil {
+			n += batch.Count()
+		}
+	}
+	return n
+}
+
+// SizeBytes implements Batch. It is the total of the batches of the shards.
+func (b *shardedDBBatch) SizeBytes() int {
+	n := 0
+	for _, batch := range b.batches {
+		if batch != nil {
+			n += batch.SizeBytes()
+		}
+	}
+	return n
+}
+
+// Write implements Batch.
+func (b *shardedDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *shardedDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *shardedDBBatch) write(sync bool) error {
+	if b.batches == nil {
+		return errBatchClosed
+	}
+	if b.written == nil {
+		b.written = make([]Batch, len(b.batches))
+	}
+	for i, batch := range b.batches {
+		if batch == nil {
+			continue
+		}
+		var err error
+		if sync {
+			err = batch.WriteSync()
+		} else {
+			err = batch.Write()
+		}
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		// Written batches are not written again if a later shard fails and the write is retried.
+		b.batches[i], b.written[i] = nil, batch
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.batches = nil
+	return nil
+}
+
+// Reset implements Batch. The batches of the shards are reused.
+func (b *shardedDBBatch) Reset() error {
+	if b.batches == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.batches, b.written = b.written, nil
+	}
+	for i, batch := range b.batches {
+		if b.written != nil && b.written[i] != nil {
+			batch, b.written[i] = b.written[i], nil
+			b.batches[i] = batch
+		}
+		if batch != nil {
+			if err := batch.Reset(); err != nil {
+				return fmt.Errorf("shard %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close implements Batch.
+func (b *shardedDBBatch) Close() error {
+	for _, batches := range [][]Batch{b.batches, b.written} {
+		for _, batch := range batches {
+			if batch != nil {
+				batch.Close()
+			}
+		}
+	}
+	b.batches, b.written = nil, nil
+	return nil
+}
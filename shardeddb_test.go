@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedDB(t *testing.T) {
+	testCases := map[string]ShardFunc{
+		"hash":  HashSharding(3),
+		"range": RangeSharding(int642Bytes(10), int642Bytes(20)),
+	}
+	for name, shard := range testCases {
+		t.Run(name, func(t *testing.T) {
+			shards := []DB{NewMemDB(), NewMemDB(), NewMemDB()}
+			sdb := NewShardedDB(shards, shard)
+			defer sdb.Close()
+
+			batch := sdb.NewBatch()
+			defer batch.Close()
+			for i := int64(0); i < 30; i++ {
+				require.NoError(t, batch.Set(int642Bytes(i), int642Bytes(i)))
+			}
+			require.NoError(t, batch.Delete(int642Bytes(15)))
+			require.NoError(t, batch.Write())
+			require.Equal(t, errBatchClosed, batch.Write())
+			require.NoError(t, sdb.Delete(int642Bytes(16)))
+
+			// Every shard stores some of the keys, and each key is stored in one shard.
+			for i, shardDB := range shards {
+				itr, err := shardDB.Iterator(nil, nil)
+				require.NoError(t, err)
+				require.True(t, itr.Valid(), "shard %d is empty", i)
+				require.NoError(t, itr.Close())
+			}
+			checkValue(t, sdb, int642Bytes(7), int642Bytes(7))
+			checkValue(t, sdb, int642Bytes(15), nil)
+
+			itr, err := sdb.Iterator(int642Bytes(8), int642Bytes(18))
+			require.NoError(t, err)
+			verifyIterator(t, itr, []int64{8, 9, 10, 11, 12, 13, 14, 17}, "forward iterator")
+			require.NoError(t, itr.Close())
+			itr, err = sdb.ReverseIterator(int642Bytes(25), nil)
+			require.NoError(t, err)
+			verifyIterator(t, itr, []int64{29, 28, 27, 26, 25}, "reverse iterator")
+			require.NoError(t, itr.Close())
+
+			stats := sdb.Stats()
+			for i := range shards {
+				require.Contains(t, stats, fmt.Sprintf("shard%d.database.type", i))
+			}
+		})
+	}
+}
+
+func TestShardedDBInvalidShard(t *testing.T) {
+	sdb := NewShardedDB([]DB{NewMemDB()}, func([]byte) int { return 1 })
+	defer sdb.Close()
+
+	require.Error(t, sdb.Set(bz("a"), bz("1")))
+	_, err := sdb.Get(bz("a"))
+	require.Error(t, err)
+	batch := sdb.NewBatch()
+	defer batch.Close()
+	require.Error(t, batch.Set(bz("a"), bz("1")))
+	require.Equal(t, errKeyEmpty, sdb.Set(nil, bz("1")))
+}
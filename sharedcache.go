@@ -0,0 +1,231 @@
+package db
+
+import (
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb/cache"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// SharedCache is a block cache shared by several databases, so that an operator can set one
+// memory budget for all the databases of a node instead of one per database. Pass it to NewDB
+// with WithSharedCache.
+//
+// The goleveldb and pebble backends cannot share blocks with each other, so the cache holds one
+// pool of the given size for each of them, which is only allocated as blocks are cached: a node
+// using a single backend, as usual, stays within the budget.
+type SharedCache struct {
+	size      int64
+	pebble    *pebble.Cache
+	goLevelDB *goLevelDBSharedLRU
+}
+
+// NewSharedCache creates a block cache of size bytes, to be shared by databases opened with
+// WithSharedCache. A size of 0 disables block caching entirely. The caller must call Close once
+// the cache is no longer needed, which can be before the databases using it are closed.
+func NewSharedCache(size int64) *SharedCache {
+	size = max(size, 0)
+	return &SharedCache{
+		size:      size,
+		pebble:    pebble.NewCache(size),
+		goLevelDB: newGoLevelDBSharedLRU(int(min(size, math.MaxInt))),
+	}
+}
+
+// Size returns the size in bytes of the cache.
+func (c *SharedCache) Size() int64 {
+	return c.size
+}
+
+// Close releases the reference of the caller to the cache. The databases using it keep their own.
+func (c *SharedCache) Close() error {
+	c.pebble.Unref()
+	return nil
+}
+
+// WithSharedCache makes goleveldb and pebble databases use the given block cache instead of
+// allocating their own. It overrides WithPebbleCache and WithGoLevelDBBlockCacheCapacity if given
+// before them.
+func WithSharedCache(c *SharedCache) Option {
+	return func(o *dbOptions) {
+		o.pebble.cache = c.pebble
+		o.goLevelDB.tune = append(o.goLevelDB.tune, func(o *opt.Options) {
+			if c.size == 0 {
+				o.BlockCacheCapacity = -1
+				return
+			}
+			o.BlockCacher = &opt.CacherFunc{NewFunc: func(int) cache.Cacher {
+				return &goLevelDBSharedCacher{lru: c.goLevelDB}
+			}}
+			o.BlockCacheCapacity = c.goLevelDB.capacity
+		})
+	}
+}
+
+// goLevelDBSharedLRU is an LRU cache of the blocks of several goleveldb databases. goleveldb
+// identifies the blocks of a database by table file number, which is not unique across databases,
+// so each database accesses the cache through its own goLevelDBSharedCacher, which only evicts the
+// blocks of that database.
+type goLevelDBSharedLRU struct {
+	mtx      sync.Mutex
+	capacity int
+	used     int
+	recent   goLevelDBLRUNode // sentinel of the list of cached blocks, most recently used first
+}
+
+func newGoLevelDBSharedLRU(capacity int) *goLevelDBSharedLRU {
+	l := &goLevelDBSharedLRU{capacity: capacity}
+	l.recent.next, l.recent.prev = &l.recent, &l.recent
+	return l
+}
+
+// goLevelDBLRUNode is a block in a goLevelDBSharedLRU, referenced by the CacheData of its node.
+type goLevelDBLRUNode struct {
+	n          *cache.Node
+	h          *cache.Handle
+	owner      *goLevelDBSharedCacher
+	ban        bool
+	next, prev *goLevelDBLRUNode
+}
+
+func (rn *goLevelDBLRUNode) insertAfter(at *goLevelDBLRUNode) {
+	rn.prev, rn.next = at, at.next
+	at.next.prev = rn
+	at.next = rn
+}
+
+func (rn *goLevelDBLRUNode) unlink() {
+	rn.prev.next, rn.next.prev = rn.next, rn.prev
+	rn.prev, rn.next = nil, nil
+}
+
+// evictLocked removes a block from the cache. Its handle must be released once the lock is
+// released.
+func (l *goLevelDBSharedLRU) evictLocked(rn *goLevelDBLRUNode) {
+	rn.unlink()
+	rn.n.CacheData = nil
+	l.used -= rn.n.Size()
+}
+
+// evictWhere removes the blocks for which match returns true.
+func (l *goLevelDBSharedLRU) evictWhere(match func(rn *goLevelDBLRUNode) bool) {
+	var evicted []*goLevelDBLRUNode
+	l.mtx.Lock()
+	for rn := l.recent.prev; rn != &l.recent; {
+		prev := rn.prev
+		if match(rn) {
+			l.evictLocked(rn)
+			evicted = append(evicted, rn)
+		}
+		rn = prev
+	}
+	l.mtx.Unlock()
+	releaseGoLevelDBLRUNodes(evicted)
+}
+
+func releaseGoLevelDBLRUNodes(nodes []*goLevelDBLRUNode) {
+	for _, rn := range nodes {
+		rn.h.Release()
+	}
+}
+
+// goLevelDBSharedCacher is the cacher of a goleveldb database using a SharedCache.
+type goLevelDBSharedCacher struct {
+	lru *goLevelDBSharedLRU
+}
+
+var _ cache.Cacher = (*goLevelDBSharedCacher)(nil)
+
+// Capacity implements cache.Cacher.
+func (c *goLevelDBSharedCacher) Capacity() int {
+	return c.lru.capacity
+}
+
+// SetCapacity implements cache.Cacher. The capacity of a shared cache is fixed.
+func (c *goLevelDBSharedCacher) SetCapacity(int) {}
+
+// Promote implements cache.Cacher. It caches a block, evicting the least recently used blocks of
+// any database if needed, or marks a cached block as the most recently used.
+func (c *goLevelDBSharedCacher) Promote(n *cache.Node) {
+	l := c.lru
+	var evicted []*goLevelDBLRUNode
+	l.mtx.Lock()
+	if n.CacheData == nil {
+		if n.Size() <= l.capacity {
+			rn := &goLevelDBLRUNode{n: n, h: n.GetHandle(), owner: c}
+			rn.insertAfter(&l.recent)
+			n.CacheData = unsafe.Pointer(rn)
+			l.used += n.Size()
+			for l.used > l.capacity {
+				oldest := l.recent.prev
+				l.evictLocked(oldest)
+				evicted = append(evicted, oldest)
+			}
+		}
+	} else if rn := (*goLevelDBLRUNode)(n.CacheData); !rn.ban {
+		rn.unlink()
+		rn.insertAfter(&l.recent)
+	}
+	l.mtx.Unlock()
+	releaseGoLevelDBLRUNodes(evicted)
+}
+
+// Ban implements cache.Cacher. It evicts a block and prevents it from being cached again.
+func (c *goLevelDBSharedCacher) Ban(n *cache.Node) {
+	l := c.lru
+	l.mtx.Lock()
+	if n.CacheData == nil {
+		n.CacheData = unsafe.Pointer(&goLevelDBLRUNode{n: n, owner: c, ban: true})
+		l.mtx.Unlock()
+		return
+	}
+	rn := (*goLevelDBLRUNode)(n.CacheData)
+	if rn.ban {
+		l.mtx.Unlock()
+		return
+	}
+	rn.unlink()
+	rn.ban = true
+	l.used -= n.Size()
+	h := rn.h
+	rn.h = nil
+	l.mtx.Unlock()
+	h.Release()
+}
+
+// Evict implements cache.Cacher.
+func (c *goLevelDBSharedCacher) Evict(n *cache.Node) {
+	l := c.lru
+	l.mtx.Lock()
+	rn := (*goLevelDBLRUNode)(n.CacheData)
+	if rn == nil || rn.ban {
+		l.mtx.Unlock()
+		return
+	}
+	l.evictLocked(rn)
+	l.mtx.Unlock()
+	rn.h.Release()
+}
+
+// EvictNS implements cache.Cacher. Only the blocks of this database are evicted.
+func (c *goLevelDBSharedCacher) EvictNS(ns uint64) {
+	c.lru.evictWhere(func(rn *goLevelDBLRUNode) bool {
+		return rn.owner == c && rn.n.NS() == ns
+	})
+}
+
+// EvictAll implements cache.Cacher. Only the blocks of this database are evicted, which goleveldb
+// does when the database is closed.
+func (c *goLevelDBSharedCacher) EvictAll() {
+	c.lru.evictWhere(func(rn *goLevelDBLRUNode) bool {
+		return rn.owner == c
+	})
+}
+
+// Close implements cache.Cacher. The shared cache stays open for the other databases.
+func (c *goLevelDBSharedCacher) Close() error {
+	return nil
+}
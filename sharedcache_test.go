@@ -0,0 +1,127 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/cache"
+)
+
+func TestSharedCachePebble(t *testing.T) {
+	shared := NewSharedCache(32 << 20)
+	defer shared.Close()
+
+	dir := t.TempDir()
+	dbs := make([]*PebbleDB, 2)
+	for i := range dbs {
+		db, err := NewDB(fmt.Sprintf("shared%d", i), PebbleDBBackend, dir, WithSharedCache(shared))
+		require.NoError(t, err)
+		defer db.Close()
+		dbs[i] = db.(*PebbleDB)
+		fillAndRead(t, db, 1000)
+	}
+	db1, db2 := dbs[0], dbs[1]
+	require.Positive(t, db1.DB().Metrics().BlockCache.Size)
+	require.Equal(t, db1.DB().Metrics().BlockCache, db2.DB().Metrics().BlockCache)
+	require.LessOrEqual(t, db1.DB().Metrics().BlockCache.Size, shared.Size())
+}
+
+func TestSharedCacheGoLevelDB(t *testing.T) {
+	shared := NewSharedCache(64 << 10)
+	defer shared.Close()
+
+	dir := t.TempDir()
+	dbs := make([]*GoLevelDB, 2)
+	for i := range dbs {
+		db, err := NewDB(fmt.Sprintf("shared%d", i), GoLevelDBBackend, dir, WithSharedCache(shared))
+		require.NoError(t, err)
+		defer db.Close()
+		dbs[i] = db.(*GoLevelDB)
+		fillAndRead(t, db, 1000)
+	}
+
+	// Without the shared cache, each database would cache all of its blocks.
+	cached := 0
+	for _, db := range dbs {
+		property, err := db.DB().GetProperty("leveldb.cachedblock")
+		require.NoError(t, err)
+		size, err := strconv.Atoi(property)
+		require.NoError(t, err)
+		cached += size
+	}
+	require.Positive(t, cached)
+	require.LessOrEqual(t, int64(cached), shared.Size())
+
+	// Closing a database evicts its blocks, and leaves the cache usable by the others.
+	require.NoError(t, dbs[0].Close())
+	property, err := dbs[1].DB().GetProperty("leveldb.cachedblock")
+	require.NoError(t, err)
+	require.Equal(t, property, strconv.Itoa(shared.goLevelDB.used))
+	fillAndRead(t, dbs[1], 10)
+}
+
+func TestGoLevelDBSharedCacher(t *testing.T) {
+	lru := newGoLevelDBSharedLRU(100)
+	cache1 := cache.NewCache(&goLevelDBSharedCacher{lru: lru})
+	cache2 := cache.NewCache(&goLevelDBSharedCacher{lru: lru})
+	cacheBlock := func(c *cache.Cache, ns, key uint64) {
+		c.Get(ns, key, func() (int, cache.Value) { return 10, key }).Release()
+	}
+
+	// Both databases use the same table numbers.
+	for key := uint64(0); key < 3; key++ {
+		cacheBlock(cache1, 1, key)
+		cacheBlock(cache2, 1, key)
+	}
+	require.Equal(t, 60, lru.used)
+
+	// Evicting a table of a database leaves the blocks of the other one.
+	cache1.EvictNS(1)
+	require.Zero(t, cache1.Nodes())
+	require.Equal(t, 3, cache2.Nodes())
+	require.Equal(t, 30, lru.used)
+
+	// The least recently used blocks of any database are evicted once the cache is full.
+	for key := uint64(0); key < 8; key++ {
+		cacheBlock(cache1, 2, key)
+	}
+	require.Equal(t, 100, lru.used)
+	require.Equal(t, 2, cache2.Nodes())
+
+	// Closing a database evicts its blocks.
+	require.NoError(t, cache1.CloseWeak())
+	require.Equal(t, 20, lru.used)
+	require.Equal(t, 2, cache2.Nodes())
+	require.NoError(t, cache2.CloseWeak())
+	require.Zero(t, lru.used)
+}
+
+func TestSharedCacheDisabled(t *testing.T) {
+	shared := NewSharedCache(0)
+	defer shared.Close()
+
+	for _, backend := range []BackendType{GoLevelDBBackend, PebbleDBBackend} {
+		db, err := NewDB("disabled", backend, t.TempDir(), WithSharedCache(shared))
+		require.NoError(t, err)
+		fillAndRead(t, db, 10)
+		require.NoError(t, db.Close())
+	}
+}
+
+// fillAndRead writes n keys of 1KB to db, compacts it so that they are stored in tables, and reads
+// them back.
+func fillAndRead(t *testing.T, db DB, n int) {
+	t.Helper()
+	value := make([]byte, 1024)
+	for i := 0; i < n; i++ {
+		require.NoError(t, db.Set([]byte(fmt.Sprintf("key%06d", i)), value))
+	}
+	require.NoError(t, db.Compact(nil, nil))
+	for i := 0; i < n; i++ {
+		got, err := db.Get([]byte(fmt.Sprintf("key%06d", i)))
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"time"
+)
+
+// SlowLogDB wraps a database, and logs every operation taking longer than a threshold, along with
+// the prefix of its key and its duration. This helps pinpoint delays caused by the database, e.g.
+// write stalls during compactions. Iterators log each slow step.
+type SlowLogDB struct {
+	db        DB
+	threshold time.Duration
+	logger    Logger
+	clock     Clock
+}
+
+var _ DB = (*SlowLogDB)(nil)
+
+// NewSlowLogDB wraps db, logging operations slower than threshold to logger.
+func NewSlowLogDB(db DB, threshold time.Duration, logger Logger) *SlowLogDB {
+	return &SlowLogDB{
+		db:        db,
+		threshold: threshold,
+		logger:    logger,
+		clock:     SystemClock,
+	}
+}
+
+// check logs an operation on key, which may be nil, if it started more than the threshold ago.
+func (sdb *SlowLogDB) check(op DBOperation, key []byte, start time.Time) {
+	elapsed := sdb.clock.Now().Sub(start)
+	if elapsed <= sdb.threshold {
+		return
+	}
+	keyvals := []any{"op", string(op), "duration", elapsed}
+	if key != nil {
+		keyvals = append(keyvals, "key_prefix", keyPrefixHex(key))
+	}
+	sdb.logger.Info("slow database operation", keyvals...)
+}
+
+// Get implements DB.
+func (sdb *SlowLogDB) Get(key []byte) ([]byte, error) {
+	defer sdb.check(OpGet, key, sdb.clock.Now())
+	return sdb.db.Get(key)
+}
+
+// Has implements DB.
+func (sdb *SlowLogDB) Has(key []byte) (bool, error) {
+	defer sdb.check(OpHas, key, sdb.clock.Now())
+	return sdb.db.Has(key)
+}
+
+// Set implements DB.
+func (sdb *SlowLogDB) Set(key []byte, value []byte) error {
+	defer sdb.check(OpSet, key, sdb.clock.Now())
+	return sdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (sdb *SlowLogDB) SetSync(key []byte, value []byte) error {
+	defer sdb.check(OpSetSync, key, sdb.clock.Now())
+	return sdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (sdb *SlowLogDB) Delete(key []byte) error {
+	defer sdb.check(OpDelete, key, sdb.clock.Now())
+	return sdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (sdb *SlowLogDB) DeleteSync(key []byte) error {
+	defer sdb.check(OpDeleteSync, key, sdb.clock.Now())
+	return sdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (sdb *SlowLogDB) Iterator(start, end []byte) (Iterator, error) {
+	defer sdb.check(OpIterator, start, sdb.clock.Now())
+	itr, err := sdb.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &slowLogDBIterator{sdb: sdb, source: itr}, nil
+}
+
+// ReverseIterator implements DB.
+func (sdb *SlowLogDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	defer sdb.check(OpReverseIterator, start, sdb.clock.Now())
+	itr, err := sdb.db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &slowLogDBIterator{sdb: sdb, source: itr}, nil
+}
+
+// Close implements DB.
+func (sdb *SlowLogDB) Close() error {
+	return sdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (sdb *SlowLogDB) NewBatch() Batch {
+	return &slowLogDBBatch{
+		sdb:   sdb,
+		batch: sdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (sdb *SlowLogDB) Print() error {
+	return sdb.db.Print()
+}
+
+// Stats implements DB.
+func (sdb *SlowLogDB) Stats() map[string]string {
+	return sdb.db.Stats()
+}
+
+// Compact implements DB.
+func (sdb *SlowLogDB) Compact(start, end []byte) error {
+	defer sdb.check(OpCompact, start, sdb.clock.Now())
+	return sdb.db.Compact(start, end)
+}
+
+// slowLogDBIterator logs slow iterator steps, with the key reached by the step.
+type slowLogDBIterator struct {
+	sdb    *SlowLogDB
+	source Iterator
+}
+
+var _ Iterator = (*slowLogDBIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *slowLogDBIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *slowLogDBIterator) Valid() bool {
+	return itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *slowLogDBIterator) Next() {
+	start := itr.sdb.clock.Now()
+	itr.source.Next()
+	var key []byte
+	if itr.source.Valid() {
+		key = itr.source.Key()
+	}
+	itr.sdb.check(OpIteratorNext, key, start)
+}
+
+// Key implements Iterator.
+func (itr *slowLogDBIterator) Key() []byte {
+	return itr.source.Key()
+}
+
+// Value implements Iterator.
+func (itr *slowLogDBIterator) Value() []byte {
+	return itr.source.Value()
+}
+
+// Error implements Iterator.
+func (itr *slowLogDBIterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *slowLogDBIterator) Close() error {
+	return itr.source.Close()
+}
+
+// slowLogDBBatch logs slow batch writes.
+type slowLogDBBatch struct {
+	sdb   *SlowLogDB
+	batch Batch
+}
+
+var _ Batch = (*slowLogDBBatch)(nil)
+
+// Set implements Batch.
+func (b *slowLogDBBatch) Set(key, value []byte) error {
+	return b.batch.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *slowLogDBBatch) Delete(key []byte) error {
+	return b.batch.Delete(key)
+}
+
+// Count implements Batch.
+func (b *slowLogDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *slowLogDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *slowLogDBBatch) Write() error {
+	defer b.sdb.check(OpBatchWrite, nil, b.sdb.clock.Now())
+	return b.batch.Write()
+}
+
+// WriteSync implements Batch.
+func (b *slowLogDBBatch) WriteSync() error {
+	defer b.sdb.check(OpBatchWriteSync, nil, b.sdb.clock.Now())
+	return b.batch.WriteSync()
+}
+
+// Reset implements Batch.
+func (b *slowLogDBBatch) Reset() error {
+	return b.batch.Reset()
+}
+
+// Close implements Batch.
+func (b *slowLogDBBatch) Close() error {
+	return b.batch.Close()
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowLogDB(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	mem := &slowClockDB{MemDB: NewMemDB(), clock: clock, delay: 2 * time.Second}
+	logger := &testLogger{}
+	sdb := NewSlowLogDB(mem, time.Second, logger)
+	sdb.clock = clock
+	defer sdb.Close()
+
+	require.NoError(t, sdb.Set(bz("slow/key/with/a/long/name"), bz("value")))
+	checkValue(t, sdb, bz("slow/key/with/a/long/name"), bz("value"))
+	batch := sdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("fast"), bz("value")))
+	require.NoError(t, batch.Write())
+	itr, err := sdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	keys := 0
+	for ; itr.Valid(); itr.Next() {
+		keys++
+	}
+	require.Equal(t, 2, keys)
+	require.NoError(t, itr.Close())
+
+	require.Len(t, logger.lines, 1)
+	require.Contains(t, logger.lines[0], "slow database operation")
+	require.Contains(t, logger.lines[0], "set")
+	require.Contains(t, logger.lines[0], "2s")
+	require.Contains(t, logger.lines[0], keyPrefixHex(bz("slow/key")))
+}
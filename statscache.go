@@ -0,0 +1,50 @@
+package db
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// WithStatsCacheTTL makes a goleveldb or pebble database cache the statistics returned by Stats
+// for ttl, so that frequent callers, such as Prometheus scrapes, do not recompute them each time,
+// which is costly on large stores. Statistics are recomputed on every call by default.
+func WithStatsCacheTTL(ttl time.Duration) Option {
+	return func(o *dbOptions) {
+		o.statsCacheTTL = ttl
+	}
+}
+
+// statsCache caches the statistics of a database for a TTL. The zero value and a nil statsCache
+// cache nothing.
+type statsCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mtx     sync.Mutex
+	stats   map[string]string
+	expires time.Time
+}
+
+// newStatsCache creates a cache with the TTL set by WithStatsCacheTTL, or returns nil if there is
+// none.
+func newStatsCache(o *dbOptions) *statsCache {
+	if o.statsCacheTTL <= 0 {
+		return nil
+	}
+	return &statsCache{ttl: o.statsCacheTTL, clock: o.clock}
+}
+
+// get returns the cached statistics, or computes them if they have expired. Callers get their own
+// copy, which they may modify, as wrapping databases do.
+func (c *statsCache) get(compute func() map[string]string) map[string]string {
+	if c == nil {
+		return compute()
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if now := c.clock.Now(); c.stats == nil || !now.Before(c.expires) {
+		c.stats, c.expires = compute(), now.Add(c.ttl)
+	}
+	return maps.Clone(c.stats)
+}
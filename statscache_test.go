@@ -0,0 +1,56 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCache(t *testing.T) {
+	clock := clocktest.NewManualClock(time.Unix(0, 0))
+	cache := newStatsCache(newDBOptions([]Option{WithClock(clock), WithStatsCacheTTL(time.Second)}))
+	computed := 0
+	compute := func() map[string]string {
+		computed++
+		return map[string]string{"computed": strconv.Itoa(computed)}
+	}
+
+	stats := cache.get(compute)
+	require.Equal(t, "1", stats["computed"])
+	// Callers get their own copy.
+	stats["computed"] = "modified"
+	clock.Advance(time.Second - 1)
+	require.Equal(t, "1", cache.get(compute)["computed"])
+	clock.Advance(1)
+	require.Equal(t, "2", cache.get(compute)["computed"])
+
+	// Without a TTL, statistics are computed on every call.
+	require.Nil(t, newStatsCache(newDBOptions(nil)))
+	var none *statsCache
+	require.Equal(t, "3", none.get(compute)["computed"])
+	require.Equal(t, "4", none.get(compute)["computed"])
+}
+
+func TestDBStatsCache(t *testing.T) {
+	for _, backend := range []BackendType{GoLevelDBBackend, PebbleDBBackend} {
+		t.Run(string(backend), func(t *testing.T) {
+			clock := clocktest.NewManualClock(time.Unix(0, 0))
+			db, err := NewDB("stats", backend, t.TempDir(), WithClock(clock), WithStatsCacheTTL(time.Minute))
+			require.NoError(t, err)
+			defer db.Close()
+
+			stats := db.Stats()
+			require.NotEmpty(t, stats)
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, db.Set(int642Bytes(int64(i)), []byte(randStr(100))))
+			}
+			require.NoError(t, db.Compact(nil, nil))
+			require.Equal(t, stats, db.Stats())
+			clock.Advance(time.Minute)
+			require.NotEqual(t, stats, db.Stats())
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// streamChunkSize is the size of the chunks streamed values are stored in, which bounds the
+	// memory used to stream a value.
+	streamChunkSize = 1 << 20
+)
+
+var (
+	// streamManifestMagic starts the manifests stored under the keys of streamed values.
+	streamManifestMagic = []byte("\xffcometbft-db/stream\x00")
+
+	// ErrStreamCorrupted is returned when reading a streamed value whose manifest or chunks are
+	// missing or invalid.
+	ErrStreamCorrupted = errors.New("streamed value corrupted")
+)
+
+// ValueStreamer is implemented by databases which can stream values natively, without storing
+// them in chunks. Use the SetReader, GetReader and DeleteStream functions to stream values with
+// any database.
+type ValueStreamer interface {
+	// SetReader sets the value of key to the size bytes read from r.
+	// CONTRACT: key readonly []byte
+	SetReader(key []byte, r io.Reader, size int64) error
+
+	// GetReader returns a reader of the value of key, or nil if the key does not exist. The
+	// caller must close it.
+	// CONTRACT: key readonly []byte
+	GetReader(key []byte) (io.ReadCloser, error)
+
+	// DeleteStream deletes the value of key.
+	// CONTRACT: key readonly []byte
+	DeleteStream(key []byte) error
+}
+
+// streamManifest describes a streamed value, stored in chunks of the given generation.
+type streamManifest struct {
+	generation uint64
+	size       int64
+	chunks     uint32
+}
+
+func (m streamManifest) encode() []byte {
+	bz := append(cp(streamManifestMagic), make([]byte, 20)...)
+	n := len(streamManifestMagic)
+	binary.BigEndian.PutUint64(bz[n:], m.generation)
+	binary.BigEndian.PutUint64(bz[n+8:], uint64(m.size))
+	binary.BigEndian.PutUint32(bz[n+16:], m.chunks)
+	return bz
+}
+
+// decodeStreamManifest decodes the manifest stored as the value of a streamed key, and returns
+// false if the value is not one.
+func decodeStreamManifest(bz []byte) (streamManifest, bool) {
+	n := len(streamManifestMagic)
+	if len(bz) != n+20 || !bytes.HasPrefix(bz, streamManifestMagic) {
+		return streamManifest{}, false
+	}
+	return streamManifest{
+		generation: binary.BigEndian.Uint64(bz[n:]),
+		size:       int64(binary.BigEndian.Uint64(bz[n+8:])),
+		chunks:     binary.BigEndian.Uint32(bz[n+16:]),
+	}, true
+}
+
+// streamChunkKey returns the key of a chunk of a streamed value: the key, a 0x00 byte, the
+// generation and the index of the chunk.
+func streamChunkKey(key []byte, generation uint64, i uint32) []byte {
+	chunkKey := make([]byte, 0, len(key)+13)
+	chunkKey = append(append(chunkKey, key...), 0)
+	chunkKey = binary.BigEndian.AppendUint64(chunkKey, generation)
+	return binary.BigEndian.AppendUint32(chunkKey, i)
+}
+
+// SetReader sets the value of key in db to the size bytes read from r, e.g. to store a block or
+// a snapshot without holding it in memory. If db is a ValueStreamer, the value is streamed
+// natively. Otherwise, it is stored in chunks of 1MB, which are written before a manifest under
+// key, so that readers never see a partially written value.
+//
+// The chunks are stored under keys made of key, a 0x00 byte and 12 more bytes, so that they sort
+// right after key. Streamed values should therefore be kept in a key space of their own, e.g. a
+// PrefixDB, and be deleted with DeleteStream. Overwriting a streamed value deletes the chunks of
+// the previous one.
+func SetReader(db DB, key []byte, r io.Reader, size int64) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if size < 0 {
+		return fmt.Errorf("negative size %d", size)
+	}
+	if vs, ok := db.(ValueStreamer); ok {
+		return vs.SetReader(key, r, size)
+	}
+	previous, err := db.Get(key)
+	if err != nil {
+		return err
+	}
+	old, overwrite := decodeStreamManifest(previous)
+	manifest := streamManifest{
+		generation: old.generation + 1,
+		size:       size,
+		chunks:     uint32((size + streamChunkSize - 1) / streamChunkSize),
+	}
+	if int64(manifest.chunks)*streamChunkSize < size {
+		return fmt.Errorf("value of %d bytes is too large to stream", size)
+	}
+
+	for i := uint32(0); i < manifest.chunks; i++ {
+		// Chunks are not reused, since not all backends copy the values passed to Set.
+		chunk := make([]byte, min(size-int64(i)*streamChunkSize, streamChunkSize))
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return errors.Join(err, deleteStreamChunks(db, key, manifest.generation, i))
+		}
+		if err := db.Set(streamChunkKey(key, manifest.generation, i), chunk); err != nil {
+			return errors.Join(err, deleteStreamChunks(db, key, manifest.generation, i))
+		}
+	}
+
+	// The manifest is replaced and the previous chunks deleted atomically.
+	batch := db.NewBatch()
+	defer batch.Close()
+	if err := batch.Set(key, manifest.encode()); err != nil {
+		return err
+	}
+	if overwrite {
+		for i := uint32(0); i < old.chunks; i++ {
+			if err := batch.Delete(streamChunkKey(key, old.generation, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Write()
+}
+
+// deleteStreamChunks deletes the first n chunks of the given generation of a streamed value.
+func deleteStreamChunks(db DB, key []byte, generation uint64, n uint32) error {
+	batch := db.NewBatch()
+	defer batch.Close()
+	for i := uint32(0); i < n; i++ {
+		if err := batch.Delete(streamChunkKey(key, generation, i)); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// GetReader returns a reader of the value of key in db, or nil if the key does not exist, e.g. to
+// serve a block or a snapshot without holding it in memory. The caller must close it. If db is a
+// ValueStreamer, the value is streamed natively. Otherwise, values stored by SetReader are read
+// one chunk at a time, and other values are read at once.
+//
+// Chunks are read as the reader is consumed, so a concurrent SetReader or DeleteStream of the same
+// key fails the reader with ErrStreamCorrupted.
+func GetReader(db DBReader, key []byte) (io.ReadCloser, error) {
+	if len(key) == 0 {
+		return nil, errKeyEmpty
+	}
+	if vs, ok := db.(ValueStreamer); ok {
+		return vs.GetReader(key)
+	}
+	value, err := db.Get(key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	manifest, ok := decodeStreamManifest(value)
+	if !ok {
+		return io.NopCloser(bytes.NewReader(value)), nil
+	}
+	return &streamReader{db: db, key: cp(key), manifest: manifest}, nil
+}
+
+// DeleteStream deletes the value of key in db, along with its chunks if it was stored by
+// SetReader. Values stored by SetReader must be deleted with DeleteStream rather than Delete,
+// which leaves their chunks behind.
+func DeleteStream(db DB, key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if vs, ok := db.(ValueStreamer); ok {
+		return vs.DeleteStream(key)
+	}
+	value, err := db.Get(key)
+	if err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	defer batch.Close()
+	if err := batch.Delete(key); err != nil {
+		return err
+	}
+	if manifest, ok := decodeStreamManifest(value); ok {
+		for i := uint32(0); i < manifest.chunks; i++ {
+			if err := batch.Delete(streamChunkKey(key, manifest.generation, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Write()
+}
+
+// streamReader reads the chunks of a streamed value as it is consumed.
+type streamReader struct {
+	db       DBReader
+	key      []byte
+	manifest streamManifest
+	next     uint32 // the index of the next chunk to read
+	read     int64  // the number of bytes read from the chunks so far
+	chunk    []byte // the unread part of the current chunk, in buf
+	buf      []byte
+	closed   bool
+}
+
+var _ io.ReadCloser = (*streamReader)(nil)
+
+// Read implements io.Reader.
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, errors.New("stream reader is closed")
+	}
+	for len(r.chunk) == 0 {
+		if r.next == r.manifest.chunks {
+			if r.read != r.manifest.size {
+				return 0, fmt.Errorf("%w: read %d bytes instead of %d", ErrStreamCorrupted, r.read,
+					r.manifest.size)
+			}
+			return 0, io.EOF
+		}
+		chunk, ok, err := GetAppend(r.db, streamChunkKey(r.key, r.manifest.generation, r.next), r.buf[:0])
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("%w: chunk %d is missing", ErrStreamCorrupted, r.next)
+		}
+		r.read += int64(len(chunk))
+		if r.read > r.manifest.size {
+			return 0, fmt.Errorf("%w: chunk %d is too large", ErrStreamCorrupted, r.next)
+		}
+		r.next++
+		r.buf, r.chunk = chunk, chunk
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (r *streamReader) Close() error {
+	r.closed, r.chunk, r.buf = true, nil, nil
+	return nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamValue(t *testing.T) {
+	for _, backend := range []BackendType{MemDBBackend, GoLevelDBBackend, PebbleDBBackend} {
+		t.Run(string(backend), func(t *testing.T) {
+			db, err := NewDB("stream", backend, t.TempDir())
+			require.NoError(t, err)
+			defer db.Close()
+
+			value := make([]byte, 2*streamChunkSize+100)
+			rand.New(rand.NewSource(1)).Read(value)
+			require.NoError(t, SetReader(db, bz("block"), bytes.NewReader(value), int64(len(value))))
+
+			r, err := GetReader(db, bz("block"))
+			require.NoError(t, err)
+			read, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			require.Equal(t, value, read)
+
+			// Overwriting a streamed value deletes the chunks of the previous one.
+			value = value[:streamChunkSize/2]
+			require.NoError(t, SetReader(db, bz("block"), bytes.NewReader(value), int64(len(value))))
+			r, err = GetReader(db, bz("block"))
+			require.NoError(t, err)
+			read, err = io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, value, read)
+			require.Equal(t, 2, countKeys(t, db))
+
+			require.NoError(t, DeleteStream(db, bz("block")))
+			require.Zero(t, countKeys(t, db))
+			r, err = GetReader(db, bz("block"))
+			require.NoError(t, err)
+			require.Nil(t, r)
+		})
+	}
+}
+
+func TestStreamValueEdgeCases(t *testing.T) {
+	db := NewMemDB()
+
+	// Values set with Set are read at once.
+	require.NoError(t, db.Set(bz("plain"), bz("value")))
+	r, err := GetReader(db, bz("plain"))
+	require.NoError(t, err)
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, bz("value"), read)
+	require.NoError(t, DeleteStream(db, bz("plain")))
+	checkValue(t, db, bz("plain"), nil)
+
+	// Empty values can be streamed.
+	require.NoError(t, SetReader(db, bz("empty"), bytes.NewReader(nil), 0))
+	r, err = GetReader(db, bz("empty"))
+	require.NoError(t, err)
+	read, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, read)
+	require.NoError(t, DeleteStream(db, bz("empty")))
+
+	// A short reader fails the write, which leaves no chunks behind.
+	err = SetReader(db, bz("short"), bytes.NewReader(make([]byte, streamChunkSize+1)), streamChunkSize+2)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Zero(t, countKeys(t, db))
+
+	_, err = GetReader(db, nil)
+	require.ErrorIs(t, err, errKeyEmpty)
+	require.Error(t, SetReader(db, bz("negative"), bytes.NewReader(nil), -1))
+
+	// Missing chunks are detected.
+	value := make([]byte, streamChunkSize+1)
+	require.NoError(t, SetReader(db, bz("block"), bytes.NewReader(value), int64(len(value))))
+	manifest, ok := decodeStreamManifest(mustGet(t, db, bz("block")))
+	require.True(t, ok)
+	require.NoError(t, db.Delete(streamChunkKey(bz("block"), manifest.generation, 1)))
+	r, err = GetReader(db, bz("block"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrStreamCorrupted)
+}
+
+// countKeys returns the number of keys in db.
+func countKeys(t *testing.T, db DB) int {
+	t.Helper()
+	itr, err := db.Iterator(nil, nil)
+	require.NoError(t, err)
+	defer itr.Close()
+	n := 0
+	for ; itr.Valid(); itr.Next() {
+		n++
+	}
+	require.NoError(t, itr.Error())
+	return n
+}
+
+// mustGet returns the value of key in db.
+func mustGet(t *testing.T, db DB, key []byte) []byte {
+	t.Helper()
+	value, err := db.Get(key)
+	require.NoError(t, err)
+	return value
+}
@@ -0,0 +1,352 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// tieredDBMigrateChunk is the number of keys migrated at a time by TieredDB.Migrate.
+const tieredDBMigrateChunk = 1000
+
+// TieredDB stores data in two tiers: writes land in a fast hot database, e.g. a memdb or pebble on
+// NVMe, and key ranges are migrated to a larger cold database, e.g. goleveldb on HDD or an
+// ArchiveDB, with Migrate. Reads go to the hot database first and fall through to the cold one,
+// so migrations are transparent to readers.
+//
+// Deletes are applied to both tiers. Batches are written to the cold tier first for their deletes,
+// then to the hot tier, so batches deleting migrated keys are not atomic across tiers.
+type TieredDB struct {
+	mtx  sync.RWMutex // held exclusively while migrating a chunk of keys
+	hot  DB
+	cold DB
+}
+
+var _ DB = (*TieredDB)(nil)
+
+// NewTieredDB creates a database over the hot and cold tiers.
+func NewTieredDB(hot, cold DB) *TieredDB {
+	return &TieredDB{
+		hot:  hot,
+		cold: cold,
+	}
+}
+
+// Migrate moves the keys of the hot tier within [start, end) to the cold tier, and returns the
+// number of keys moved. Keys are moved in chunks, blocking writes only while a chunk is moved, so
+// e.g. all heights below a watermark can be migrated while the database is in use. Every chunk is
+// synced to the cold tier before being deleted from the hot one.
+func (tdb *TieredDB) Migrate(start, end []byte) (int, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return 0, errKeyEmpty
+	}
+	total := 0
+	for {
+		n, next, err := tdb.migrateChunk(start, end)
+		total += n
+		if err != nil || next == nil {
+			return total, err
+		}
+		start = next
+	}
+}
+
+// migrateChunk moves up to tieredDBMigrateChunk keys from start, and returns the key to continue
+// from, or nil when done.
+func (tdb *TieredDB) migrateChunk(start, end []byte) (int, []byte, error) {
+	tdb.mtx.Lock()
+	defer tdb.mtx.Unlock()
+
+	itr, err := tdb.hot.Iterator(start, end)
+	if err != nil {
+		return 0, nil, err
+	}
+	coldBatch := tdb.cold.NewBatch()
+	defer coldBatch.Close()
+	var keys [][]byte
+	for ; itr.Valid() && len(keys) < tieredDBMigrateChunk; itr.Next() {
+		if err := coldBatch.Set(itr.Key(), itr.Value()); err != nil {
+			itr.Close()
+			return 0, nil, err
+		}
+		keys = append(keys, cp(itr.Key()))
+	}
+	more := itr.Valid()
+	if err := itr.Error(); err != nil {
+		itr.Close()
+		return 0, nil, err
+	}
+	if err := itr.Close(); err != nil {
+		return 0, nil, err
+	}
+	if len(keys) == 0 {
+		return 0, nil, nil
+	}
+	if err := coldBatch.WriteSync(); err != nil {
+		return 0, nil, err
+	}
+
+	// Reads prefer the hot tier, so the keys remain consistent if deleting them is interrupted.
+	hotBatch := tdb.hot.NewBatch()
+	defer hotBatch.Close()
+	for _, key := range keys {
+		if err := hotBatch.Delete(key); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := hotBatch.Write(); err != nil {
+		return 0, nil, err
+	}
+	if !more {
+		return len(keys), nil, nil
+	}
+	// Continue right after the last migrated key.
+	return len(keys), append(keys[len(keys)-1], 0), nil
+}
+
+// Get implements DB.
+func (tdb *TieredDB) Get(key []byte) ([]byte, error) {
+	value, err := tdb.hot.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+	return tdb.cold.Get(key)
+}
+
+// Has implements DB.
+func (tdb *TieredDB) Has(key []byte) (bool, error) {
+	ok, err := tdb.hot.Has(key)
+	if err != nil || ok {
+		return ok, err
+	}
+	return tdb.cold.Has(key)
+}
+
+// Set implements DB.
+func (tdb *TieredDB) Set(key []byte, value []byte) error {
+	tdb.mtx.RLock()
+	defer tdb.mtx.RUnlock()
+	return tdb.hot.Set(key, value)
+}
+
+// SetSync implements DB.
+func (tdb *TieredDB) SetSync(key []byte, value []byte) error {
+	tdb.mtx.RLock()
+	defer tdb.mtx.RUnlock()
+	return tdb.hot.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (tdb *TieredDB) Delete(key []byte) error {
+	tdb.mtx.RLock()
+	defer tdb.mtx.RUnlock()
+	if err := tdb.cold.Delete(key); err != nil {
+		return err
+	}
+	return tdb.hot.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (tdb *TieredDB) DeleteSync(key []byte) error {
+	tdb.mtx.RLock()
+	defer tdb.mtx.RUnlock()
+	if err := tdb.cold.DeleteSync(key); err != nil {
+		return err
+	}
+	return tdb.hot.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (tdb *TieredDB) Iterator(start, end []byte) (Iterator, error) {
+	return tdb.newIterator(start, end, false)
+}
+
+// ReverseIterator implements DB.
+func (tdb *TieredDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return tdb.newIterator(start, end, true)
+}
+
+func (tdb *TieredDB) newIterator(start, end []byte, isReverse bool) (Iterator, error) {
+	// The lock prevents a chunk from being migrated between creating the two iterators.
+	tdb.mtx.RLock()
+	defer tdb.mtx.RUnlock()
+
+	var hot, cold Iterator
+	var err error
+	if isReverse {
+		hot, err = tdb.hot.ReverseIterator(start, end)
+	} else {
+		hot, err = tdb.hot.Iterator(start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isReverse {
+		cold, err = tdb.cold.ReverseIterator(start, end)
+	} else {
+		cold, err = tdb.cold.Iterator(start, end)
+	}
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	return newMergeIterator(start, end, isReverse, hot, cold), nil
+}
+
+// Close implements DB. It closes both tiers.
+func (tdb *TieredDB) Close() error {
+	err := tdb.hot.Close()
+	if cerr := tdb.cold.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (tdb *TieredDB) NewBatch() Batch {
+	return &tieredDBBatch{
+		tdb:     tdb,
+		batch:   tdb.hot.NewBatch(),
+		deletes: [][]byte{},
+	}
+}
+
+// Print implements DB.
+func (tdb *TieredDB) Print() error {
+	itr, err := tdb.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		key := itr.Key()
+		value := itr.Value()
+		fmt.Printf("[%X]:\t[%X]\n", key, value)
+	}
+	return nil
+}
+
+// Stats implements DB. The stats of the tiers are prefixed with "hot." and "cold.".
+func (tdb *TieredDB) Stats() map[string]string {
+	stats := make(map[string]string)
+	for key, value := range tdb.hot.Stats() {
+		stats["hot."+key] = value
+	}
+	for key, value := range tdb.cold.Stats() {
+		stats["cold."+key] = value
+	}
+	return stats
+}
+
+// Compact implements DB. It compacts both tiers.
+func (tdb *TieredDB) Compact(start, end []byte) error {
+	if err := tdb.hot.Compact(start, end); err != nil {
+		return err
+	}
+	return tdb.cold.Compact(start, end)
+}
+
+// tieredDBBatch is a batch of the hot tier, which also records its deletes to apply them to the
+// cold tier.
+type tieredDBBatch struct {
+	tdb     *TieredDB
+	batch   Batch
+	deletes [][]byte // nil once closed
+}
+
+var _ Batch = (*tieredDBBatch)(nil)
+
+// Set implements Batch.
+func (b *tieredDBBatch) Set(key, value []byte) error {
+	if b.deletes == nil {
+		return errBatchClosed
+	}
+	return b.batch.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *tieredDBBatch) Delete(key []byte) error {
+	if b.deletes == nil {
+		return errBatchClosed
+	}
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.deletes = append(b.deletes, key)
+	return nil
+}
+
+// Count implements Batch.
+func (b *tieredDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *tieredDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *tieredDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *tieredDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *tieredDBBatch) write(sync bool) error {
+	if b.deletes == nil {
+		return errBatchClosed
+	}
+	b.tdb.mtx.RLock()
+	defer b.tdb.mtx.RUnlock()
+
+	if len(b.deletes) > 0 {
+		cold := b.tdb.cold.NewBatch()
+		defer cold.Close()
+		for _, key := range b.deletes {
+			if err := cold.Delete(key); err != nil {
+				return err
+			}
+		}
+		var err error
+		if sync {
+			err = cold.WriteSync()
+		} else {
+			err = cold.Write()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	if sync {
+		err = b.batch.WriteSync()
+	} else {
+		err = b.batch.Write()
+	}
+	if err != nil {
+		return err
+	}
+	// The written batch rejects further use, unless it is reset.
+	clear(b.deletes)
+	b.deletes = b.deletes[:0]
+	return nil
+}
+
+// Reset implements Batch.
+func (b *tieredDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	clear(b.deletes)
+	b.deletes = b.deletes[:0]
+	return nil
+}
+
+// Close implements Batch.
+func (b *tieredDBBatch) Close() error {
+	b.deletes = nil
+	return b.batch.Close()
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredDB(t *testing.T) {
+	hot, cold := NewMemDB(), NewMemDB()
+	tdb := NewTieredDB(hot, cold)
+	defer tdb.Close()
+
+	n := int64(tieredDBMigrateChunk*2 + 10)
+	for i := int64(0); i < n; i++ {
+		require.NoError(t, tdb.Set(int642Bytes(i), int642Bytes(i)))
+	}
+	migrated, err := tdb.Migrate(nil, int642Bytes(n-5))
+	require.NoError(t, err)
+	require.EqualValues(t, n-5, migrated)
+
+	// Reads fall through to the cold tier.
+	checkValue(t, hot, int642Bytes(1), nil)
+	checkValue(t, cold, int642Bytes(1), int642Bytes(1))
+	checkValue(t, tdb, int642Bytes(1), int642Bytes(1))
+	checkValue(t, tdb, int642Bytes(n-1), int642Bytes(n-1))
+	ok, err := tdb.Has(int642Bytes(2))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Writes of migrated keys land in the hot tier and take precedence, deletes apply to both.
+	require.NoError(t, tdb.Set(int642Bytes(2), bz("new")))
+	checkValue(t, tdb, int642Bytes(2), bz("new"))
+	require.NoError(t, tdb.Delete(int642Bytes(3)))
+	batch := tdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Delete(int642Bytes(4)))
+	require.NoError(t, batch.Set(int642Bytes(5), bz("new")))
+	require.NoError(t, batch.Write())
+	require.Equal(t, errBatchClosed, batch.Write())
+	checkValue(t, tdb, int642Bytes(3), nil)
+	checkValue(t, tdb, int642Bytes(4), nil)
+	checkValue(t, tdb, int642Bytes(5), bz("new"))
+
+	itr, err := tdb.Iterator(nil, int642Bytes(7))
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{0, 1, 2, 5, 6}, "forward iterator")
+	require.NoError(t, itr.Close())
+	itr, err = tdb.ReverseIterator(int642Bytes(n-7), nil)
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{n - 1, n - 2, n - 3, n - 4, n - 5, n - 6, n - 7}, "reverse iterator")
+	require.NoError(t, itr.Close())
+
+	require.Equal(t, "memDB", tdb.Stats()["cold.database.type"])
+}
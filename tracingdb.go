@@ -0,0 +1,344 @@
+package db
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+// tracingKeyPrefixLen is the number of leading key bytes recorded in spans, which is enough to
+// identify the store prefixes used by CometBFT without recording whole keys.
+const tracingKeyPrefixLen = 8
+
+// Span attributes recorded by TracingDB.
+const (
+	SpanAttrBackend      = "db.backend"
+	SpanAttrKeyPrefix    = "db.key_prefix"
+	SpanAttrBytesRead    = "db.bytes_read"
+	SpanAttrBytesWritten = "db.bytes_written"
+	SpanAttrKeys         = "db.keys"
+)
+
+// SpanAttribute is a key-value attribute of a span.
+type SpanAttribute struct {
+	Key   string
+	Value any
+}
+
+// Tracer starts the spans of a TracingDB. It has the shape of an OpenTelemetry tracer, so that an
+// OpenTelemetry tracer can be adapted by converting the attributes and errors of the spans, without
+// this package depending on OpenTelemetry.
+type Tracer interface {
+	// Start starts a span with the given name and attributes, as a child of the span in ctx if any.
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...SpanAttribute)
+	// End ends the span, recording the error the operation failed with if any.
+	End(err error)
+}
+
+// TracingDB wraps a database, and traces every operation in a span named after it, e.g. "db.get",
+// carrying the backend name, the key prefix, and the number of bytes read or written. Spans are
+// children of the span in the context given to WithContext, so that database time shows up within
+// e.g. block processing traces. Iterator spans cover the whole iteration, until Close.
+type TracingDB struct {
+	db      DB
+	tracer  Tracer
+	backend string
+	ctx     context.Context
+}
+
+var _ DB = (*TracingDB)(nil)
+
+// NewTracingDB wraps db, tracing its operations with tracer. The backend is recorded in spans.
+func NewTracingDB(db DB, tracer Tracer, backend BackendType) *TracingDB {
+	return &TracingDB{
+		db:      db,
+		tracer:  tracer,
+		backend: string(backend),
+		ctx:     context.Background(),
+	}
+}
+
+// WithContext returns a view of the database whose spans are children of the span in ctx. Batches
+// created from the view are traced in ctx as well. Closing the view closes the database.
+func (tdb *TracingDB) WithContext(ctx context.Context) *TracingDB {
+	view := *tdb
+	view.ctx = ctx
+	return &view
+}
+
+// start starts the span of an operation on the given key, which may be nil.
+func (tdb *TracingDB) start(ctx context.Context, op DBOperation, key []byte) Span {
+	attrs := []SpanAttribute{{SpanAttrBackend, tdb.backend}}
+	if key != nil {
+		attrs = append(attrs, SpanAttribute{SpanAttrKeyPrefix, keyPrefixHex(key)})
+	}
+	return tdb.tracer.Start(ctx, "db."+string(op), attrs...)
+}
+
+// keyPrefixHex returns the hex encoding of the leading bytes of key.
+func keyPrefixHex(key []byte) string {
+	if len(key) > tracingKeyPrefixLen {
+		key = key[:tracingKeyPrefixLen]
+	}
+	return hex.EncodeToString(key)
+}
+
+// Get implements DB.
+func (tdb *TracingDB) Get(key []byte) ([]byte, error) {
+	span := tdb.start(tdb.ctx, OpGet, key)
+	value, err := tdb.db.Get(key)
+	span.SetAttributes(SpanAttribute{SpanAttrBytesRead, len(value)})
+	span.End(err)
+	return value, err
+}
+
+// Has implements DB.
+func (tdb *TracingDB) Has(key []byte) (bool, error) {
+	span := tdb.start(tdb.ctx, OpHas, key)
+	ok, err := tdb.db.Has(key)
+	span.End(err)
+	return ok, err
+}
+
+// Set implements DB.
+func (tdb *TracingDB) Set(key []byte, value []byte) error {
+	span := tdb.start(tdb.ctx, OpSet, key)
+	span.SetAttributes(SpanAttribute{SpanAttrBytesWritten, len(key) + len(value)})
+	err := tdb.db.Set(key, value)
+	span.End(err)
+	return err
+}
+
+// SetSync implements DB.
+func (tdb *TracingDB) SetSync(key []byte, value []byte) error {
+	span := tdb.start(tdb.ctx, OpSetSync, key)
+	span.SetAttributes(SpanAttribute{SpanAttrBytesWritten, len(key) + len(value)})
+	err := tdb.db.SetSync(key, value)
+	span.End(err)
+	return err
+}
+
+// Delete implements DB.
+func (tdb *TracingDB) Delete(key []byte) error {
+	span := tdb.start(tdb.ctx, OpDelete, key)
+	err := tdb.db.Delete(key)
+	span.End(err)
+	return err
+}
+
+// DeleteSync implements DB.
+func (tdb *TracingDB) DeleteSync(key []byte) error {
+	span := tdb.start(tdb.ctx, OpDeleteSync, key)
+	err := tdb.db.DeleteSync(key)
+	span.End(err)
+	return err
+}
+
+// Iterator implements DB.
+func (tdb *TracingDB) Iterator(start, end []byte) (Iterator, error) {
+	span := tdb.start(tdb.ctx, OpIterator, start)
+	itr, err := tdb.db.Iterator(start, end)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	return &tracingDBIterator{source: itr, span: span}, nil
+}
+
+// ReverseIterator implements DB.
+func (tdb *TracingDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	span := tdb.start(tdb.ctx, OpReverseIterator, start)
+	itr, err := tdb.db.ReverseIterator(start, end)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	return &tracingDBIterator{source: itr, span: span}, nil
+}
+
+// Close implements DB.
+func (tdb *TracingDB) Close() error {
+	return tdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (tdb *TracingDB) NewBatch() Batch {
+	return &tracingDBBatch{
+		tdb:   tdb,
+		ctx:   tdb.ctx,
+		batch: tdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (tdb *TracingDB) Print() error {
+	return tdb.db.Print()
+}
+
+// Stats implements DB.
+func (tdb *TracingDB) Stats() map[string]string {
+	return tdb.db.Stats()
+}
+
+// Compact implements DB.
+func (tdb *TracingDB) Compact(start, end []byte) error {
+	span := tdb.start(tdb.ctx, OpCompact, nil)
+	err := tdb.db.Compact(start, end)
+	span.End(err)
+	return err
+}
+
+// tracingDBIterator ends the span of an iteration when closed, recording the number of keys and
+// bytes read.
+type tracingDBIterator struct {
+	source    Iterator
+	span      Span
+	keys      int
+	bytesRead int
+	keyRead   bool // whether the current key was counted
+	valueRead bool // whether the current value was counted
+}
+
+var _ Iterator = (*tracingDBIterator)(nil)
+
+// Domain implements Iterator.
+func (itr *tracingDBIterator) Domain() ([]byte, []byte) {
+	return itr.source.Domain()
+}
+
+// Valid implements Iterator.
+func (itr *tracingDBIterator) Valid() bool {
+	return itr.source.Valid()
+}
+
+// Next implements Iterator.
+func (itr *tracingDBIterator) Next() {
+	itr.source.Next()
+	itr.keyRead, itr.valueRead = false, false
+}
+
+// Key implements Iterator.
+func (itr *tracingDBIterator) Key() []byte {
+	key := itr.source.Key()
+	if !itr.keyRead {
+		itr.keys++
+		itr.bytesRead += len(key)
+		itr.keyRead = true
+	}
+	return key
+}
+
+// Value implements Iterator.
+func (itr *tracingDBIterator) Value() []byte {
+	value := itr.source.Value()
+	if !itr.valueRead {
+		itr.bytesRead += len(value)
+		itr.valueRead = true
+	}
+	return value
+}
+
+// Error implements Iterator.
+func (itr *tracingDBIterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements Iterator.
+func (itr *tracingDBIterator) Close() error {
+	if itr.span == nil {
+		return itr.source.Close()
+	}
+	spanErr := itr.source.Error()
+	err := itr.source.Close()
+	if err != nil {
+		spanErr = err
+	}
+	itr.span.SetAttributes(
+		SpanAttribute{SpanAttrKeys, itr.keys},
+		SpanAttribute{SpanAttrBytesRead, itr.bytesRead},
+	)
+	itr.span.End(spanErr)
+	itr.span = nil
+	return err
+}
+
+// tracingDBBatch traces batch writes in the context the batch was created in.
+type tracingDBBatch struct {
+	tdb          *TracingDB
+	ctx          context.Context
+	batch        Batch
+	keys         int
+	bytesWritten int
+}
+
+var _ Batch = (*tracingDBBatch)(nil)
+
+// Set implements Batch.
+func (b *tracingDBBatch) Set(key, value []byte) error {
+	if err := b.batch.Set(key, value); err != nil {
+		return err
+	}
+	b.keys++
+	b.bytesWritten += len(key) + len(value)
+	return nil
+}
+
+// Delete implements Batch.
+func (b *tracingDBBatch) Delete(key []byte) error {
+	if err := b.batch.Delete(key); err != nil {
+		return err
+	}
+	b.keys++
+	b.bytesWritten += len(key)
+	return nil
+}
+
+// Count implements Batch.
+func (b *tracingDBBatch) Count() int {
+	return b.batch.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *tracingDBBatch) SizeBytes() int {
+	return b.batch.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *tracingDBBatch) Write() error {
+	return b.write(OpBatchWrite, b.batch.Write)
+}
+
+// WriteSync implements Batch.
+func (b *tracingDBBatch) WriteSync() error {
+	return b.write(OpBatchWriteSync, b.batch.WriteSync)
+}
+
+func (b *tracingDBBatch) write(op DBOperation, write func() error) error {
+	span := b.tdb.start(b.ctx, op, nil)
+	span.SetAttributes(
+		SpanAttribute{SpanAttrKeys, b.keys},
+		SpanAttribute{SpanAttrBytesWritten, b.bytesWritten},
+	)
+	err := write()
+	span.End(err)
+	return err
+}
+
+// Reset implements Batch.
+func (b *tracingDBBatch) Reset() error {
+	if err := b.batch.Reset(); err != nil {
+		return err
+	}
+	b.keys, b.bytesWritten = 0, 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *tracingDBBatch) Close() error {
+	return b.batch.Close()
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type traceParentKey struct{}
+
+// recordedSpan is a span recorded by recordingTracer.
+type recordedSpan struct {
+	name   string
+	parent any
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...SpanAttribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err, s.ended = err, true
+}
+
+// recordingTracer records the spans it starts, with the parent found in their context.
+type recordingTracer struct {
+	mtx   sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) Span {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	span := &recordedSpan{name: name, parent: ctx.Value(traceParentKey{}), attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestTracingDB(t *testing.T) {
+	tracer := &recordingTracer{}
+	tdb := NewTracingDB(NewMemDB(), tracer, MemDBBackend)
+	defer tdb.Close()
+
+	require.NoError(t, tdb.Set(bz("key/1"), bz("value")))
+	ctx := context.WithValue(context.Background(), traceParentKey{}, "block")
+	view := tdb.WithContext(ctx)
+	checkValue(t, view, bz("key/1"), bz("value"))
+	require.Equal(t, errKeyEmpty, view.Delete(nil))
+
+	batch := view.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("key/2"), bz("v")))
+	require.NoError(t, batch.Delete(bz("key/1")))
+	require.NoError(t, batch.WriteSync())
+
+	itr, err := tdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	checkItem(t, itr, bz("key/2"), bz("v"))
+	checkItem(t, itr, bz("key/2"), bz("v"))
+	checkNext(t, itr, false)
+	require.NoError(t, itr.Close())
+
+	require.Len(t, tracer.spans, 5)
+	set, get, del, write, iter := tracer.spans[0], tracer.spans[1], tracer.spans[2], tracer.spans[3], tracer.spans[4]
+	require.Equal(t, "db.set", set.name)
+	require.Nil(t, set.parent)
+	require.Equal(t, "memdb", set.attrs[SpanAttrBackend])
+	require.Equal(t, "6b65792f31", set.attrs[SpanAttrKeyPrefix])
+	require.Equal(t, 10, set.attrs[SpanAttrBytesWritten])
+
+	require.Equal(t, "db.get", get.name)
+	require.Equal(t, "block", get.parent)
+	require.Equal(t, 5, get.attrs[SpanAttrBytesRead])
+	require.True(t, errors.Is(del.err, errKeyEmpty))
+
+	require.Equal(t, "db.batch_write_sync", write.name)
+	require.Equal(t, "block", write.parent)
+	require.Equal(t, 2, write.attrs[SpanAttrKeys])
+	require.Equal(t, 11, write.attrs[SpanAttrBytesWritten])
+
+	require.Equal(t, "db.iterator", iter.name)
+	require.True(t, iter.ended)
+	require.Equal(t, 1, iter.attrs[SpanAttrKeys])
+	require.Equal(t, 6, iter.attrs[SpanAttrBytesRead])
+}
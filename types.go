@@ -11,8 +11,30 @@ var (
 
 	// errValueNil is returned when attempting to set a nil value.
 	errValueNil = errors.New("value cannot be nil")
+
+	// ErrReadOnly is returned when attempting to write to a read-only database.
+	ErrReadOnly = errors.New("database is read-only")
 )
 
+// DBReader is the read-only subset of the DB interface, implemented by read-only views of a
+// database such as snapshots.
+type DBReader interface {
+	// Get fetches the value of the given key, or nil if it does not exist.
+	// CONTRACT: key, value readonly []byte
+	Get(key []byte) ([]byte, error)
+
+	// Has checks if a key exists.
+	// CONTRACT: key, value readonly []byte
+	Has(key []byte) (bool, error)
+
+	// Iterator returns an iterator over a domain of keys, in ascending order. See DB.Iterator.
+	Iterator(start, end []byte) (Iterator, error)
+
+	// ReverseIterator returns an iterator over a domain of keys, in descending order. See
+	// DB.ReverseIterator.
+	ReverseIterator(start, end []byte) (Iterator, error)
+}
+
 // DB is the main interface for all database backends. DBs are concurrency-safe. Callers must call
 // Close on the database when done.
 //
@@ -87,14 +109,29 @@ type Batch interface {
 	// CONTRACT: key readonly []byte
 	Delete(key []byte) error
 
-	// Write writes the batch, possibly without flushing to disk. Only Close() can be called after,
-	// other methods will error.
+	// Count returns the number of operations pending in the batch, e.g. to commit every N
+	// operations. It is 0 once the batch was written or closed.
+	Count() int
+
+	// SizeBytes returns the size in bytes of the operations pending in the batch, e.g. to bound
+	// the size of commits. It is the size of the encoded batch for backends which encode it as
+	// operations are added, and the total size of the keys and values otherwise, so it is only
+	// comparable between batches of the same backend. It is 0 once the batch was written or closed.
+	SizeBytes() int
+
+	// Write writes the batch, possibly without flushing to disk. Only Reset() and Close() can be
+	// called after, other methods will error.
 	Write() error
 
-	// WriteSync writes the batch and flushes it to disk. Only Close() can be called after, other
-	// methods will error.
+	// WriteSync writes the batch and flushes it to disk. Only Reset() and Close() can be called
+	// after, other methods will error.
 	WriteSync() error
 
+	// Reset discards the operations pending in the batch, and makes a written batch usable again,
+	// so that committers can reuse a single batch, and the memory it allocated, for every commit
+	// instead of creating a new one. It errors if the batch was closed.
+	Reset() error
+
 	// Close closes the batch. It is idempotent, but calls to other methods afterwards will error.
 	Close() error
 }
@@ -155,3 +192,44 @@ type Iterator interface {
 	// Close closes the iterator, relasing any allocated resources.
 	Close() error
 }
+
+// UnsafeIterator is implemented by iterators which can return their current key and value
+// without copying them, e.g. for bulk readers such as state exports, which would otherwise spend
+// most of their time allocating. Whether Key and Value copy depends on the backend and its
+// options, while UnsafeKey and UnsafeValue never copy when the backend allows it.
+//
+// The returned slices must not be modified, and are only valid until the next call to Next or
+// Close, after which they may point to other data, or to freed memory. Callers must copy them
+// to retain them. Use the UnsafeKey and UnsafeValue functions to fall back to Key and Value for
+// iterators which do not implement UnsafeIterator.
+type UnsafeIterator interface {
+	Iterator
+
+	// UnsafeKey returns the key at the current position without copying it. Panics if the
+	// iterator is invalid.
+	UnsafeKey() []byte
+
+	// UnsafeValue returns the value at the current position without copying it. Panics if the
+	// iterator is invalid.
+	UnsafeValue() []byte
+}
+
+// UnsafeKey returns the key at the current position of itr, without copying it if itr is an
+// UnsafeIterator. The key must not be modified, and is only valid until the next call to Next
+// or Close.
+func UnsafeKey(itr Iterator) []byte {
+	if u, ok := itr.(UnsafeIterator); ok {
+		return u.UnsafeKey()
+	}
+	return itr.Key()
+}
+
+// UnsafeValue returns the value at the current position of itr, without copying it if itr is an
+// UnsafeIterator. The value must not be modified, and is only valid until the next call to Next
+// or Close.
+func UnsafeValue(itr Iterator) []byte {
+	if u, ok := itr.(UnsafeIterator); ok {
+		return u.UnsafeValue()
+	}
+	return itr.Value()
+}
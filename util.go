@@ -34,6 +34,22 @@ func cpIncr(bz []byte) (ret []byte) {
 	return nil
 }
 
+// prefixEnd returns the exclusive end of the range of keys starting with prefix, i.e. the
+// smallest key greater than all of them, or nil if there is none because prefix is made only of
+// 0xFF bytes. Unlike cpIncr, trailing 0xFF bytes are dropped rather than wrapped around, so that
+// e.g. the end of 0x01FF is 0x02 and not 0x0200, which would include the key 0x02.
+// CONTRACT: len(prefix) > 0.
+func prefixEnd(prefix []byte) []byte {
+	end := cp(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < byte(0xFF) {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
 // See DB interface documentation for more information.
 func IsKeyInDomain(key, start, end []byte) bool {
 	if bytes.Compare(key, start) < 0 {
@@ -49,3 +65,34 @@ func FileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !os.IsNotExist(err)
 }
+
+// newAtomicBatch creates a batch of db which is written atomically, for databases whose batches
+// may be split into several writes, such as a GoLevelDB with a maximum batch size.
+func newAtomicBatch(db DB) Batch {
+	if adb, ok := db.(interface{ NewAtomicBatch() Batch }); ok {
+		return adb.NewAtomicBatch()
+	}
+	return db.NewBatch()
+}
+
+// writeOperations writes operations to db as a batch.
+func writeOperations(db DB, ops []operation, sync bool) error {
+	batch := db.NewBatch()
+	defer batch.Close()
+	for _, op := range ops {
+		var err error
+		switch op.opType {
+		case opTypeSet:
+			err = batch.Set(op.key, op.value)
+		case opTypeDelete:
+			err = batch.Delete(op.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if sync {
+		return batch.WriteSync()
+	}
+	return batch.Write()
+}
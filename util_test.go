@@ -118,3 +118,10 @@ func TestPrefixIteratorMatches1N(t *testing.T) {
 		})
 	}
 }
+
+func TestPrefixEnd(t *testing.T) {
+	require.Equal(t, []byte{0x01, 0x03}, prefixEnd([]byte{0x01, 0x02}))
+	require.Equal(t, []byte{0x02}, prefixEnd([]byte{0x01, 0xff}))
+	require.Equal(t, []byte{0x01, 0x01}, prefixEnd([]byte{0x01, 0x00, 0xff, 0xff}))
+	require.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrKeyPrefixNotAllowed is returned by KeyPrefixWhitelist when a key does not
+// start with any of the whitelisted prefixes.
+var ErrKeyPrefixNotAllowed = errors.New("key prefix not allowed")
+
+// WriteOp identifies the kind of write being validated.
+type WriteOp int
+
+const (
+	WriteOpSet WriteOp = iota + 1
+	WriteOpDelete
+)
+
+// String implements fmt.Stringer.
+func (op WriteOp) String() string {
+	switch op {
+	case WriteOpSet:
+		return "set"
+	case WriteOpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("WriteOp(%d)", int(op))
+	}
+}
+
+// WriteValidator inspects a write before it reaches the underlying database. The value is nil for
+// deletes. Returning a non-nil error rejects the write.
+// CONTRACT: key, value readonly []byte
+type WriteValidator func(op WriteOp, key, value []byte) error
+
+// ValidationError is returned when a WriteValidator rejects a write.
+type ValidationError struct {
+	Op  WriteOp
+	Key []byte
+	Err error
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s of key %X rejected: %v", e.Op, e.Key, e.Err)
+}
+
+// Unwrap returns the error reported by the validator.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// KeyPrefixWhitelist returns a validator rejecting any write whose key does not start with one of
+// the given prefixes.
+func KeyPrefixWhitelist(prefixes ...[]byte) WriteValidator {
+	return func(_ WriteOp, key, _ []byte) error {
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(key, prefix) {
+				return nil
+			}
+		}
+		return ErrKeyPrefixNotAllowed
+	}
+}
+
+// PrefixValueValidator returns a validator that runs check on the values of all sets whose key
+// starts with prefix, e.g. to enforce a value schema for a store. Deletes are always accepted.
+func PrefixValueValidator(prefix []byte, check func(key, value []byte) error) WriteValidator {
+	return func(op WriteOp, key, value []byte) error {
+		if op != WriteOpSet || !bytes.HasPrefix(key, prefix) {
+			return nil
+		}
+		return check(key, value)
+	}
+}
+
+// ValidatingDB wraps a database and runs registered validators on every write, including writes
+// made through batches, so that storage bugs are caught at the boundary.
+type ValidatingDB struct {
+	mtx        sync.RWMutex
+	db         DB
+	validators []WriteValidator
+}
+
+var _ DB = (*ValidatingDB)(nil)
+
+// NewValidatingDB wraps db, validating writes with the given validators.
+func NewValidatingDB(db DB, validators ...WriteValidator) *ValidatingDB {
+	return &ValidatingDB{
+		db:         db,
+		validators: validators,
+	}
+}
+
+// RegisterValidator adds a validator which is run after all previously registered ones.
+func (vdb *ValidatingDB) RegisterValidator(validator WriteValidator) {
+	vdb.mtx.Lock()
+	defer vdb.mtx.Unlock()
+
+	vdb.validators = append(vdb.validators, validator)
+}
+
+// validate runs all validators, returning a *ValidationError for the first rejection.
+func (vdb *ValidatingDB) validate(op WriteOp, key, value []byte) error {
+	vdb.mtx.RLock()
+	defer vdb.mtx.RUnlock()
+
+	for _, validator := range vdb.validators {
+		if err := validator(op, key, value); err != nil {
+			return &ValidationError{Op: op, Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+// Get implements DB.
+func (vdb *ValidatingDB) Get(key []byte) ([]byte, error) {
+	return vdb.db.Get(key)
+}
+
+// Has implements DB.
+func (vdb *ValidatingDB) Has(key []byte) (bool, error) {
+	return vdb.db.Has(key)
+}
+
+// Set implements DB.
+func (vdb *ValidatingDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := vdb.validate(WriteOpSet, key, value); err != nil {
+		return err
+	}
+	return vdb.db.Set(key, value)
+}
+
+// SetSync implements DB.
+func (vdb *ValidatingDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := vdb.validate(WriteOpSet, key, value); err != nil {
+		return err
+	}
+	return vdb.db.SetSync(key, value)
+}
+
+// Delete implements DB.
+func (vdb *ValidatingDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if err := vdb.validate(WriteOpDelete, key, nil); err != nil {
+		return err
+	}
+	return vdb.db.Delete(key)
+}
+
+// DeleteSync implements DB.
+func (vdb *ValidatingDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if err := vdb.validate(WriteOpDelete, key, nil); err != nil {
+		return err
+	}
+	return vdb.db.DeleteSync(key)
+}
+
+// Iterator implements DB.
+func (vdb *ValidatingDB) Iterator(start, end []byte) (Iterator, error) {
+	return vdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (vdb *ValidatingDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return vdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (vdb *ValidatingDB) Close() error {
+	return vdb.db.Close()
+}
+
+// NewBatch implements DB.
+func (vdb *ValidatingDB) NewBatch() Batch {
+	return &validatingDBBatch{
+		vdb:    vdb,
+		source: vdb.db.NewBatch(),
+	}
+}
+
+// Print implements DB.
+func (vdb *ValidatingDB) Print() error {
+	return vdb.db.Print()
+}
+
+// Stats implements DB.
+func (vdb *ValidatingDB) Stats() map[string]string {
+	return vdb.db.Stats()
+}
+
+// Compact implements DB.
+func (vdb *ValidatingDB) Compact(start, end []byte) error {
+	return vdb.db.Compact(start, end)
+}
+
+// validatingDBBatch validates operations as they are added, so a rejected operation never becomes
+// part of the batch.
+type validatingDBBatch struct {
+	vdb    *ValidatingDB
+	source Batch
+}
+
+var _ Batch = (*validatingDBBatch)(nil)
+
+// Set implements Batch.
+func (b *validatingDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if err := b.vdb.validate(WriteOpSet, key, value); err != nil {
+		return err
+	}
+	return b.source.Set(key, value)
+}
+
+// Delete implements Batch.
+func (b *validatingDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if err := b.vdb.validate(WriteOpDelete, key, nil); err != nil {
+		return err
+	}
+	return b.source.Delete(key)
+}
+
+// Count implements Batch.
+func (b *validatingDBBatch) Count() int {
+	return b.source.Count()
+}
+
+// SizeBytes implements Batch.
+func (b *validatingDBBatch) SizeBytes() int {
+	return b.source.SizeBytes()
+}
+
+// Write implements Batch.
+func (b *validatingDBBatch) Write() error {
+	return b.source.Write()
+}
+
+// WriteSync implements Batch.
+func (b *validatingDBBatch) WriteSync() error {
+	return b.source.WriteSync()
+}
+
+// Reset implements Batch.
+func (b *validatingDBBatch) Reset() error {
+	return b.source.Reset()
+}
+
+// Close implements Batch.
+func (b *validatingDBBatch) Close() error {
+	return b.source.Close()
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatingDBKeyPrefixWhitelist(t *testing.T) {
+	vdb := NewValidatingDB(NewMemDB(), KeyPrefixWhitelist(bz("a/"), bz("b/")))
+
+	require.NoError(t, vdb.Set(bz("a/1"), bz("value")))
+	require.NoError(t, vdb.SetSync(bz("b/1"), bz("value")))
+	require.NoError(t, vdb.Delete(bz("a/1")))
+
+	err := vdb.Set(bz("c/1"), bz("value"))
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, WriteOpSet, verr.Op)
+	require.Equal(t, bz("c/1"), verr.Key)
+	require.ErrorIs(t, err, ErrKeyPrefixNotAllowed)
+
+	err = vdb.DeleteSync(bz("c/1"))
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, WriteOpDelete, verr.Op)
+
+	checkValue(t, vdb, bz("b/1"), bz("value"))
+	checkValue(t, vdb, bz("c/1"), nil)
+}
+
+func TestValidatingDBPrefixValueValidator(t *testing.T) {
+	errTooLong := errors.New("value too long")
+	vdb := NewValidatingDB(NewMemDB())
+	vdb.RegisterValidator(PrefixValueValidator(bz("h/"), func(_, value []byte) error {
+		if len(value) > 2 {
+			return errTooLong
+		}
+		return nil
+	}))
+
+	require.NoError(t, vdb.Set(bz("h/1"), bz("ab")))
+	require.NoError(t, vdb.Set(bz("x/1"), bz("abc")))
+	require.ErrorIs(t, vdb.Set(bz("h/2"), bz("abc")), errTooLong)
+	require.NoError(t, vdb.Delete(bz("h/1")))
+}
+
+func TestValidatingDBBatch(t *testing.T) {
+	vdb := NewValidatingDB(NewMemDB(), KeyPrefixWhitelist(bz("a/")))
+
+	batch := vdb.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set(bz("a/1"), bz("value")))
+	require.ErrorIs(t, batch.Set(bz("b/1"), bz("value")), ErrKeyPrefixNotAllowed)
+	require.ErrorIs(t, batch.Delete(bz("b/1")), ErrKeyPrefixNotAllowed)
+	require.Equal(t, errKeyEmpty, batch.Set(nil, bz("value")))
+	require.NoError(t, batch.Write())
+
+	checkValue(t, vdb, bz("a/1"), bz("value"))
+	checkValue(t, vdb, bz("b/1"), nil)
+}
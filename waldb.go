@@ -0,0 +1,403 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// WALDB wraps a database with a write-ahead log, giving crash consistency to backends which lose
+// writes on crash, such as MemDB. Every write, including batches, is appended to the log as a
+// single record before it is applied to the underlying database, and the log is replayed into the
+// database when it is opened. Synced writes fsync the log, others only write it to the OS.
+//
+// The log has the same record format as the data files of BitcaskDB, so batches are replayed
+// atomically, and a record torn by a crash at the end of the log is discarded. It grows with every
+// write until Compact, or Checkpoint, rewrites it with the contents of the database.
+type WALDB struct {
+	mtx  sync.Mutex
+	db   DB
+	path string
+	log  *os.File
+	size int64
+}
+
+var _ DB = (*WALDB)(nil)
+
+// NewWALDB wraps db with the write-ahead log at path, which is created if it does not exist, and
+// replays the existing log into db.
+func NewWALDB(db DB, path string) (*WALDB, error) {
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	wdb := &WALDB{
+		db:   db,
+		path: path,
+		log:  log,
+	}
+	if err := wdb.replay(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	return wdb, nil
+}
+
+// replay applies the records of the log to the database, and truncates a torn record at its end.
+func (wdb *WALDB) replay() error {
+	data, err := io.ReadAll(wdb.log)
+	if err != nil {
+		return err
+	}
+	var offset int
+	for offset < len(data) {
+		if len(data)-offset < bitcaskRecordHeaderSize {
+			break
+		}
+		checksum := binary.BigEndian.Uint32(data[offset:])
+		length := int(binary.BigEndian.Uint32(data[offset+4:]))
+		payloadOffset := offset + bitcaskRecordHeaderSize
+		if length > len(data)-payloadOffset {
+			break
+		}
+		payload := data[payloadOffset : payloadOffset+length]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			break
+		}
+		ops, _, err := decodeBitcaskPayload(payload)
+		if err != nil {
+			return fmt.Errorf("invalid record at offset %d of write-ahead log %s: %w", offset, wdb.path, err)
+		}
+		if err := wdb.apply(ops); err != nil {
+			return err
+		}
+		offset = payloadOffset + length
+	}
+	if offset < len(data) {
+		// The tail of the log was torn by a crash, and was never acknowledged.
+		if err := wdb.log.Truncate(int64(offset)); err != nil {
+			return err
+		}
+	}
+	wdb.size = int64(offset)
+	return nil
+}
+
+// apply applies operations to the database as a batch. It need not be synced, since the
+// operations are already in the log.
+func (wdb *WALDB) apply(ops []operation) error {
+	batch := wdb.db.NewBatch()
+	defer batch.Close()
+	for _, op := range ops {
+		var err error
+		switch op.opType {
+		case opTypeSet:
+			err = batch.Set(op.key, op.value)
+		case opTypeDelete:
+			err = batch.Delete(op.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// write appends the operations to the log, and then applies them to the database.
+func (wdb *WALDB) write(ops []operation, sync bool) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	record, _ := encodeBitcaskRecord(ops)
+	wdb.mtx.Lock()
+	defer wdb.mtx.Unlock()
+	if wdb.log == nil {
+		return errors.New("database is closed")
+	}
+	// A failed write leaves the size unchanged, so that the next write overwrites it.
+	if _, err := wdb.log.WriteAt(record, wdb.size); err != nil {
+		return err
+	}
+	if sync {
+		if err := wdb.log.Sync(); err != nil {
+			return err
+		}
+	}
+	wdb.size += int64(len(record))
+	return wdb.apply(ops)
+}
+
+// Checkpoint atomically replaces the log with the current contents of the database, so that it
+// no longer grows with overwritten and deleted keys. Writes are blocked while it runs.
+func (wdb *WALDB) Checkpoint() error {
+	wdb.mtx.Lock()
+	defer wdb.mtx.Unlock()
+	if wdb.log == nil {
+		return errors.New("database is closed")
+	}
+
+	itr, err := wdb.db.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	tmp := wdb.path + tmpFileSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	var (
+		ops  []operation
+		size int
+		n    int64
+	)
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		record, _ := encodeBitcaskRecord(ops)
+		if _, err := f.Write(record); err != nil {
+			return err
+		}
+		n += int64(len(record))
+		ops, size = ops[:0], 0
+		return nil
+	}
+	for ; itr.Valid(); itr.Next() {
+		// Iterator keys and values may be reused by the next step, so they are copied.
+		ops = append(ops, operation{opTypeSet, cp(itr.Key()), cp(itr.Value())})
+		size += len(itr.Key()) + len(itr.Value())
+		if size >= 1<<20 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := itr.Error(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, wdb.path); err != nil {
+		return err
+	}
+	// The open file is now the checkpoint, which is appended to from now on.
+	wdb.log.Close()
+	wdb.log, f = f, nil
+	wdb.size = n
+	return nil
+}
+
+// Get implements DB.
+func (wdb *WALDB) Get(key []byte) ([]byte, error) {
+	return wdb.db.Get(key)
+}
+
+// Has implements DB.
+func (wdb *WALDB) Has(key []byte) (bool, error) {
+	return wdb.db.Has(key)
+}
+
+// Set implements DB.
+func (wdb *WALDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return wdb.write([]operation{{opTypeSet, key, value}}, false)
+}
+
+// SetSync implements DB.
+func (wdb *WALDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return wdb.write([]operation{{opTypeSet, key, value}}, true)
+}
+
+// Delete implements DB.
+func (wdb *WALDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return wdb.write([]operation{{opTypeDelete, key, nil}}, false)
+}
+
+// DeleteSync implements DB.
+func (wdb *WALDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return wdb.write([]operation{{opTypeDelete, key, nil}}, true)
+}
+
+// Iterator implements DB.
+func (wdb *WALDB) Iterator(start, end []byte) (Iterator, error) {
+	return wdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB.
+func (wdb *WALDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return wdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB.
+func (wdb *WALDB) Close() error {
+	wdb.mtx.Lock()
+	defer wdb.mtx.Unlock()
+	if wdb.log == nil {
+		return nil
+	}
+	err := wdb.log.Sync()
+	if closeErr := wdb.log.Close(); err == nil {
+		err = closeErr
+	}
+	wdb.log = nil
+	if closeErr := wdb.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (wdb *WALDB) NewBatch() Batch {
+	return &walDBBatch{wdb: wdb}
+}
+
+// Print implements DB.
+func (wdb *WALDB) Print() error {
+	return wdb.db.Print()
+}
+
+// Stats implements DB.
+func (wdb *WALDB) Stats() map[string]string {
+	stats := wdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	wdb.mtx.Lock()
+	defer wdb.mtx.Unlock()
+	stats["wal.size"] = strconv.FormatInt(wdb.size, 10)
+	return stats
+}
+
+// Compact implements DB. It compacts the underlying database, and checkpoints the log.
+func (wdb *WALDB) Compact(start, end []byte) error {
+	if err := wdb.db.Compact(start, end); err != nil {
+		return err
+	}
+	return wdb.Checkpoint()
+}
+
+// walDBBatch buffers operations, which are logged as a single record when written.
+type walDBBatch struct {
+	wdb     *WALDB
+	ops     []operation
+	size    int    // of the keys and values of ops
+	written *WALDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*walDBBatch)(nil)
+
+// Set implements Batch.
+func (b *walDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *walDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *walDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *walDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch.
+func (b *walDBBatch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync implements Batch.
+func (b *walDBBatch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *walDBBatch) write(sync bool) error {
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	if err := b.wdb.write(b.ops, sync); err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	clear(b.ops)
+	b.wdb, b.written, b.ops, b.size = nil, b.wdb, b.ops[:0], 0
+	return nil
+}
+
+// Reset implements Batch.
+func (b *walDBBatch) Reset() error {
+	if b.wdb == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.wdb, b.written = b.written, nil
+	}
+	clear(b.ops)
+	b.ops, b.size = b.ops[:0], 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *walDBBatch) Close() error {
+	b.wdb, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	wdb, err := NewWALDB(NewMemDB(), path)
+	require.NoError(t, err)
+	require.NoError(t, wdb.SetSync(bz("a"), bz("1")))
+	require.NoError(t, wdb.Set(bz("b"), []byte{}))
+	batch := wdb.NewBatch()
+	require.NoError(t, batch.Set(bz("c"), bz("3")))
+	require.NoError(t, batch.Delete(bz("a")))
+	require.NoError(t, batch.WriteSync())
+	require.Equal(t, errBatchClosed, batch.Write())
+	require.NoError(t, wdb.Close())
+
+	// Tear the last record, as if the process crashed while appending it.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 2, 3, 4, 0, 0, 0, 9, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// A fresh memdb recovers all acknowledged writes from the log.
+	wdb, err = NewWALDB(NewMemDB(), path)
+	require.NoError(t, err)
+	checkValue(t, wdb, bz("a"), nil)
+	checkValue(t, wdb, bz("b"), []byte{})
+	checkValue(t, wdb, bz("c"), bz("3"))
+	require.NoError(t, wdb.Set(bz("d"), bz("4")))
+	require.NoError(t, wdb.Close())
+
+	wdb, err = NewWALDB(NewMemDB(), path)
+	require.NoError(t, err)
+	defer wdb.Close()
+	checkValue(t, wdb, bz("d"), bz("4"))
+}
+
+func TestWALDBCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	wdb, err := NewWALDB(NewMemDB(), path)
+	require.NoError(t, err)
+	for i := int64(0); i < 100; i++ {
+		require.NoError(t, wdb.Set(int642Bytes(i%10), int642Bytes(i)))
+	}
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, wdb.Compact(nil, nil))
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Less(t, after.Size(), before.Size())
+
+	// Writes after the checkpoint are appended to it.
+	require.NoError(t, wdb.Delete(int642Bytes(0)))
+	require.NoError(t, wdb.Close())
+
+	wdb, err = NewWALDB(NewMemDB(), path)
+	require.NoError(t, err)
+	defer wdb.Close()
+	checkValue(t, wdb, int642Bytes(0), nil)
+	checkValue(t, wdb, int642Bytes(9), int642Bytes(99))
+	itr, err := wdb.Iterator(nil, nil)
+	require.NoError(t, err)
+	verifyIterator(t, itr, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9}, "keys after checkpoint")
+	require.NoError(t, itr.Close())
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookMaxRetries     = 3
+	defaultWebhookRetryBackoff   = time.Second
+	defaultWebhookMinInterval    = time.Minute
+	defaultWebhookQueueSize      = 16
+	defaultWebhookStallThreshold = 3
+	defaultWebhookStallWindow    = time.Minute
+	defaultWebhookTimeout        = 10 * time.Second
+)
+
+// WebhookSinkConfig configures a WebhookSink. Zero values are replaced by defaults.
+type WebhookSinkConfig struct {
+	// URL receives the alerts as JSON encoded POST requests.
+	URL string
+	// Client is the HTTP client used to deliver alerts. Defaults to a client with a 10s timeout.
+	Client *http.Client
+	// Types are the event types that trigger an alert. Defaults to EventCorruption and
+	// EventWriteStall.
+	Types []EventType
+	// StallThreshold is the number of write stalls within StallWindow that trigger an alert, so
+	// that a single transient stall does not page anyone. Defaults to 3 stalls within a minute.
+	StallThreshold int
+	StallWindow    time.Duration
+	// MaxRetries is the number of times a failed delivery is retried, with RetryBackoff doubling
+	// after every attempt. Defaults to 3 retries starting at 1s.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// MinInterval rate limits alerts: at most one alert per event type is sent per interval, and
+	// the number of suppressed events is reported with the next alert. Defaults to one minute.
+	MinInterval time.Duration
+	// QueueSize is the number of alerts that can wait for delivery. Further alerts are dropped.
+	// Defaults to 16.
+	QueueSize int
+	// Logger, if set, is used to report failed deliveries.
+	Logger Logger
+	// Clock is used to timestamp events without a time and to wait between retries. Defaults to
+	// SystemClock.
+	Clock Clock
+}
+
+// webhookPayload is the JSON document posted for every alert.
+type webhookPayload struct {
+	Type       EventType     `json:"type"`
+	Backend    BackendType   `json:"backend"`
+	Name       string        `json:"name"`
+	Dir        string        `json:"dir"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Details    string        `json:"details,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Suppressed int           `json:"suppressed,omitempty"`
+}
+
+// WebhookSink is an EventSink posting critical storage events to a webhook, e.g. to page the
+// operator of an unattended validator. Deliveries happen in a background goroutine with retries,
+// so HandleEvent never blocks. Callers must call Close when done.
+type WebhookSink struct {
+	cfg    WebhookSinkConfig
+	types  map[EventType]bool
+	queue  chan webhookPayload
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mtx        sync.Mutex
+	closed     bool
+	stalls     []time.Time
+	lastSent   map[EventType]time.Time
+	suppressed map[EventType]int
+}
+
+var _ EventSink = (*WebhookSink)(nil)
+
+// NewWebhookSink creates a webhook sink and starts its delivery goroutine.
+func NewWebhookSink(cfg WebhookSinkConfig) *WebhookSink {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	if len(cfg.Types) == 0 {
+		cfg.Types = []EventType{EventCorruption, EventWriteStall}
+	}
+	if cfg.StallThreshold <= 0 {
+		cfg.StallThreshold = defaultWebhookStallThreshold
+	}
+	if cfg.StallWindow <= 0 {
+		cfg.StallWindow = defaultWebhookStallWindow
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultWebhookMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultWebhookRetryBackoff
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = defaultWebhookMinInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultWebhookQueueSize
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+
+	types := make(map[EventType]bool, len(cfg.Types))
+	for _, typ := range cfg.Types {
+		types[typ] = true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WebhookSink{
+		cfg:        cfg,
+		types:      types,
+		queue:      make(chan webhookPayload, cfg.QueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		lastSent:   make(map[EventType]time.Time),
+		suppressed: make(map[EventType]int),
+	}
+	go s.deliverRoutine()
+	return s
+}
+
+// HandleEvent implements EventSink.
+func (s *WebhookSink) HandleEvent(ev Event) {
+	if !s.types[ev.Type] {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = s.cfg.Clock.Now()
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return
+	}
+	if ev.Type == EventWriteStall && !s.stallThresholdReached(ev.Time) {
+		return
+	}
+	if last, ok := s.lastSent[ev.Type]; ok && ev.Time.Sub(last) < s.cfg.MinInterval {
+		s.suppressed[ev.Type]++
+		return
+	}
+
+	payload := webhookPayload{
+		Type:       ev.Type,
+		Backend:    ev.Backend,
+		Name:       ev.Name,
+		Dir:        ev.Dir,
+		Time:       ev.Time,
+		Duration:   ev.Duration,
+		Details:    ev.Details,
+		Suppressed: s.suppressed[ev.Type],
+	}
+	if ev.Err != nil {
+		payload.Error = ev.Err.Error()
+	}
+	select {
+	case s.queue <- payload:
+		s.lastSent[ev.Type] = ev.Time
+		s.suppressed[ev.Type] = 0
+	default:
+		s.suppressed[ev.Type]++
+	}
+}
+
+// stallThresholdReached records a write stall at the given time, and returns whether enough stalls
+// happened within the stall window to alert. The caller must hold the mutex.
+func (s *WebhookSink) stallThresholdReached(at time.Time) bool {
+	stalls := s.stalls[:0]
+	for _, stall := range s.stalls {
+		if at.Sub(stall) < s.cfg.StallWindow {
+			stalls = append(stalls, stall)
+		}
+	}
+	s.stalls = append(stalls, at)
+	if len(s.stalls) < s.cfg.StallThreshold {
+		return false
+	}
+	s.stalls = s.stalls[:0]
+	return true
+}
+
+// Close stops the sink. Alerts still waiting for delivery are discarded.
+func (s *WebhookSink) Close() error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mtx.Unlock()
+
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) deliverRoutine() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case payload := <-s.queue:
+			if err := s.deliver(payload); err != nil && s.cfg.Logger != nil {
+				s.cfg.Logger.Error("failed to deliver storage alert", "type", payload.Type,
+					"name", payload.Name, "err", err)
+			}
+		}
+	}
+}
+
+// deliver posts the payload, retrying with exponential backoff.
+func (s *WebhookSink) deliver(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	backoff := s.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(body)
+		if err == nil || attempt >= s.cfg.MaxRetries {
+			return err
+		}
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-s.cfg.Clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *WebhookSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
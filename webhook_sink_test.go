@@ -0,0 +1,133 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft-db/internal/clocktest"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer is a test webhook endpoint failing the first failures requests.
+type webhookServer struct {
+	mtx      sync.Mutex
+	failures int
+	attempts int
+	received []webhookPayload
+}
+
+func (ws *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+
+	ws.attempts++
+	if ws.failures > 0 {
+		ws.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var payload webhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ws.received = append(ws.received, payload)
+}
+
+func (ws *webhookServer) payloads() []webhookPayload {
+	ws.mtx.Lock()
+	defer ws.mtx.Unlock()
+	return append([]webhookPayload(nil), ws.received...)
+}
+
+func TestWebhookSinkDeliversWithRetries(t *testing.T) {
+	ws := &webhookServer{failures: 2}
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookSinkConfig{URL: server.URL, RetryBackoff: time.Millisecond})
+	defer sink.Close()
+
+	sink.HandleEvent(Event{Type: EventOpen, Name: "state"})
+	sink.HandleEvent(Event{Type: EventCorruption, Backend: GoLevelDBBackend, Name: "state",
+		Err: errors.New("checksum mismatch")})
+
+	require.Eventually(t, func() bool { return len(ws.payloads()) == 1 }, 5*time.Second, time.Millisecond)
+	payload := ws.payloads()[0]
+	require.Equal(t, EventCorruption, payload.Type)
+	require.Equal(t, GoLevelDBBackend, payload.Backend)
+	require.Equal(t, "checksum mismatch", payload.Error)
+	ws.mtx.Lock()
+	require.Equal(t, 3, ws.attempts)
+	ws.mtx.Unlock()
+}
+
+func TestWebhookSinkRateLimit(t *testing.T) {
+	ws := &webhookServer{}
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookSinkConfig{URL: server.URL, MinInterval: time.Hour})
+	defer sink.Close()
+
+	now := time.Now()
+	sink.HandleEvent(Event{Type: EventCorruption, Time: now})
+	sink.HandleEvent(Event{Type: EventCorruption, Time: now.Add(time.Minute)})
+	sink.HandleEvent(Event{Type: EventCorruption, Time: now.Add(2 * time.Minute)})
+	sink.HandleEvent(Event{Type: EventCorruption, Time: now.Add(2 * time.Hour)})
+
+	require.Eventually(t, func() bool { return len(ws.payloads()) == 2 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, 0, ws.payloads()[0].Suppressed)
+	require.Equal(t, 2, ws.payloads()[1].Suppressed)
+}
+
+func TestWebhookSinkWriteStallThreshold(t *testing.T) {
+	ws := &webhookServer{}
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookSinkConfig{
+		URL:            server.URL,
+		StallThreshold: 3,
+		StallWindow:    time.Minute,
+	})
+	defer sink.Close()
+
+	now := time.Now()
+	// Stalls spread out over more than the window do not alert.
+	sink.HandleEvent(Event{Type: EventWriteStall, Time: now})
+	sink.HandleEvent(Event{Type: EventWriteStall, Time: now.Add(time.Minute)})
+	sink.HandleEvent(Event{Type: EventWriteStall, Time: now.Add(2 * time.Minute)})
+	// Repeated stalls do.
+	sink.HandleEvent(Event{Type: EventWriteStall, Time: now.Add(2*time.Minute + time.Second)})
+	require.Never(t, func() bool { return len(ws.payloads()) > 0 }, 50*time.Millisecond, time.Millisecond)
+	sink.HandleEvent(Event{Type: EventWriteStall, Time: now.Add(2*time.Minute + 2*time.Second)})
+
+	require.Eventually(t, func() bool { return len(ws.payloads()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, EventWriteStall, ws.payloads()[0].Type)
+}
+
+func TestWebhookSinkClock(t *testing.T) {
+	ws := &webhookServer{failures: 1}
+	server := httptest.NewServer(ws)
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := clocktest.NewManualClock(start)
+	sink := NewWebhookSink(WebhookSinkConfig{URL: server.URL, RetryBackoff: time.Hour, Clock: clock})
+	defer sink.Close()
+
+	// Events without a time are stamped by the clock, and retries wait for the clock.
+	sink.HandleEvent(Event{Type: EventCorruption, Name: "state"})
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, 5*time.Second, time.Millisecond)
+	require.Empty(t, ws.payloads())
+
+	clock.Advance(time.Hour)
+	require.Eventually(t, func() bool { return len(ws.payloads()) == 1 }, 5*time.Second, time.Millisecond)
+	require.True(t, start.Equal(ws.payloads()[0].Time))
+}
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errWriteQueueClosed is returned by writes to a closed WriteQueueDB.
+var errWriteQueueClosed = errors.New("write queue is closed")
+
+// WriteQueueDB wraps a database, and writes Set, Delete and batches asynchronously: they are
+// added to a bounded queue, which a committer goroutine drains by writing up to maxBatch operations
+// at once in a single batch. Writers only wait while the queue is full, which applies backpressure
+// once the database cannot keep up, and bounds the memory held by queued writes to queueSize
+// writes.
+//
+// Writes are applied in the order they were queued, and a batch is applied atomically. Reads go
+// directly to the database, so they do not see the writes still queued: this suits writers which
+// do not need to read their own writes, such as indexers. Use Flush to wait for the queued writes
+// to be applied. Synced writes wait for themselves and all writes queued before them to be written
+// and synced.
+//
+// Once a queued write fails, the error is returned by all subsequent writes, Flush and Close, and
+// no further writes are applied.
+type WriteQueueDB struct {
+	db       DB
+	maxBatch int
+	queue    chan queuedWrite
+	finished chan struct{} // closed by the committer goroutine when it returns
+	batches  atomic.Uint64 // number of batches written
+
+	mtx    sync.RWMutex // held for reading while queueing, and for writing to close the queue
+	closed bool
+
+	errMtx sync.Mutex
+	err    error // the first failed write
+}
+
+var _ DB = (*WriteQueueDB)(nil)
+
+// queuedWrite is a write in the queue of a WriteQueueDB. If done is set, the write is synced if
+// sync is set, and the error of the batch it is written with is sent to done.
+type queuedWrite struct {
+	ops  []operation
+	sync bool
+	done chan error
+}
+
+// NewWriteQueueDB wraps db, queueing up to queueSize writes, which are written in batches of up to
+// maxBatch operations. queueSize and maxBatch default to 1024 if 0 or less.
+func NewWriteQueueDB(db DB, queueSize, maxBatch int) *WriteQueueDB {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	if maxBatch <= 0 {
+		maxBatch = 1024
+	}
+	wdb := &WriteQueueDB{
+		db:       db,
+		maxBatch: maxBatch,
+		queue:    make(chan queuedWrite, queueSize),
+		finished: make(chan struct{}),
+	}
+	go wdb.run()
+	return wdb
+}
+
+// run writes the queued writes in batches, until the queue is closed.
+func (wdb *WriteQueueDB) run() {
+	defer close(wdb.finished)
+	var writes []queuedWrite
+	for w := range wdb.queue {
+		writes = append(writes[:0], w)
+		count := len(w.ops)
+	drain:
+		for count < wdb.maxBatch {
+			select {
+			case w, ok := <-wdb.queue:
+				if !ok {
+					break drain
+				}
+				writes = append(writes, w)
+				count += len(w.ops)
+			default:
+				break drain
+			}
+		}
+		wdb.write(writes)
+	}
+}
+
+// write writes the given queued writes in a single batch, and notifies those waiting for it.
+func (wdb *WriteQueueDB) write(writes []queuedWrite) {
+	err := wdb.Err()
+	if err == nil {
+		var ops []operation
+		sync := false
+		for _, w := range writes {
+			ops = append(ops, w.ops...)
+			sync = sync || w.sync
+		}
+		if len(ops) > 0 || sync {
+			err = writeOperations(wdb.db, ops, sync)
+			wdb.batches.Add(1)
+		}
+		if err != nil {
+			wdb.errMtx.Lock()
+			wdb.err = err
+			wdb.errMtx.Unlock()
+		}
+	}
+	for _, w := range writes {
+		if w.done != nil {
+			w.done <- err
+		}
+	}
+}
+
+// enqueue adds a write to the queue, waiting while it is full, and returns the error of a failed
+// queued write, if any.
+func (wdb *WriteQueueDB) enqueue(w queuedWrite) error {
+	if err := wdb.Err(); err != nil {
+		return err
+	}
+	wdb.mtx.RLock()
+	defer wdb.mtx.RUnlock()
+	if wdb.closed {
+		return errWriteQueueClosed
+	}
+	wdb.queue <- w
+	return nil
+}
+
+// wait adds a write to the queue, and waits for it to be written.
+func (wdb *WriteQueueDB) wait(ops []operation, sync bool) error {
+	done := make(chan error, 1)
+	if err := wdb.enqueue(queuedWrite{ops: ops, sync: sync, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Flush waits until all writes queued before it have been written.
+func (wdb *WriteQueueDB) Flush() error {
+	return wdb.wait(nil, false)
+}
+
+// Err returns the error of the first queued write which failed, if any.
+func (wdb *WriteQueueDB) Err() error {
+	wdb.errMtx.Lock()
+	defer wdb.errMtx.Unlock()
+	return wdb.err
+}
+
+// QueueDepth returns the number of writes waiting in the queue.
+func (wdb *WriteQueueDB) QueueDepth() int {
+	return len(wdb.queue)
+}
+
+// Get implements DB. Writes still queued are not visible.
+func (wdb *WriteQueueDB) Get(key []byte) ([]byte, error) {
+	return wdb.db.Get(key)
+}
+
+// Has implements DB. Writes still queued are not visible.
+func (wdb *WriteQueueDB) Has(key []byte) (bool, error) {
+	return wdb.db.Has(key)
+}
+
+// Set implements DB. The write is queued.
+func (wdb *WriteQueueDB) Set(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return wdb.enqueue(queuedWrite{ops: []operation{{opTypeSet, cp(key), cp(value)}}})
+}
+
+// SetSync implements DB. It waits for the write to be written and synced.
+func (wdb *WriteQueueDB) SetSync(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	return wdb.wait([]operation{{opTypeSet, key, value}}, true)
+}
+
+// Delete implements DB. The write is queued.
+func (wdb *WriteQueueDB) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return wdb.enqueue(queuedWrite{ops: []operation{{opTypeDelete, cp(key), nil}}})
+}
+
+// DeleteSync implements DB. It waits for the write to be written and synced.
+func (wdb *WriteQueueDB) DeleteSync(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	return wdb.wait([]operation{{opTypeDelete, key, nil}}, true)
+}
+
+// Iterator implements DB. Writes still queued are not visible.
+func (wdb *WriteQueueDB) Iterator(start, end []byte) (Iterator, error) {
+	return wdb.db.Iterator(start, end)
+}
+
+// ReverseIterator implements DB. Writes still queued are not visible.
+func (wdb *WriteQueueDB) ReverseIterator(start, end []byte) (Iterator, error) {
+	return wdb.db.ReverseIterator(start, end)
+}
+
+// Close implements DB. It writes the queued writes, then closes the database.
+func (wdb *WriteQueueDB) Close() error {
+	wdb.mtx.Lock()
+	if !wdb.closed {
+		wdb.closed = true
+		close(wdb.queue)
+	}
+	wdb.mtx.Unlock()
+	<-wdb.finished
+	err := wdb.Err()
+	if cerr := wdb.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewBatch implements DB.
+func (wdb *WriteQueueDB) NewBatch() Batch {
+	return &writeQueueDBBatch{wdb: wdb}
+}
+
+// Print implements DB.
+func (wdb *WriteQueueDB) Print() error {
+	return wdb.db.Print()
+}
+
+// Stats implements DB.
+func (wdb *WriteQueueDB) Stats() map[string]string {
+	stats := wdb.db.Stats()
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	stats["write_queue.depth"] = strconv.Itoa(wdb.QueueDepth())
+	stats["write_queue.capacity"] = strconv.Itoa(cap(wdb.queue))
+	stats["write_queue.batches"] = strconv.FormatUint(wdb.batches.Load(), 10)
+	return stats
+}
+
+// Compact implements DB.
+func (wdb *WriteQueueDB) Compact(start, end []byte) error {
+	return wdb.db.Compact(start, end)
+}
+
+// RegisterMetrics registers a gauge of the queue depth of the database with the given name, named
+// storage_write_queue_depth within namespace, and a counter of the batches written, named
+// storage_write_queue_batches_total, with reg.
+func (wdb *WriteQueueDB) RegisterMetrics(namespace, name string, reg prometheus.Registerer) error {
+	labels := prometheus.Labels{"db": name}
+	depth := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   "storage",
+		Name:        "write_queue_depth",
+		Help:        "Number of writes waiting in the write queue.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(wdb.QueueDepth())
+	})
+	batches := prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   "storage",
+		Name:        "write_queue_batches_total",
+		Help:        "Number of batches written from the write queue.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(wdb.batches.Load())
+	})
+	for _, c := range []prometheus.Collector{depth, batches} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQueueDBBatch buffers operations, which are queued as a single write when the batch is
+// written.
+type writeQueueDBBatch struct {
+	wdb     *WriteQueueDB
+	ops     []operation
+	size    int           // of the keys and values of ops
+	written *WriteQueueDB // the database once written, restored by Reset
+}
+
+var _ Batch = (*writeQueueDBBatch)(nil)
+
+// Set implements Batch.
+func (b *writeQueueDBBatch) Set(key, value []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if value == nil {
+		return errValueNil
+	}
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key) + len(value)
+	b.ops = append(b.ops, operation{opTypeSet, cp(key), cp(value)})
+	return nil
+}
+
+// Delete implements Batch.
+func (b *writeQueueDBBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errKeyEmpty
+	}
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	b.size += len(key)
+	b.ops = append(b.ops, operation{opTypeDelete, cp(key), nil})
+	return nil
+}
+
+// Count implements Batch.
+func (b *writeQueueDBBatch) Count() int {
+	return len(b.ops)
+}
+
+// SizeBytes implements Batch.
+func (b *writeQueueDBBatch) SizeBytes() int {
+	return b.size
+}
+
+// Write implements Batch. The batch is queued.
+func (b *writeQueueDBBatch) Write() error {
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	if len(b.ops) > 0 {
+		if err := b.wdb.enqueue(queuedWrite{ops: b.ops}); err != nil {
+			return err
+		}
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.wdb, b.written, b.ops, b.size = nil, b.wdb, nil, 0
+	return nil
+}
+
+// WriteSync implements Batch. It waits for the batch to be written and synced.
+func (b *writeQueueDBBatch) WriteSync() error {
+	if b.wdb == nil {
+		return errBatchClosed
+	}
+	if err := b.wdb.wait(b.ops, true); err != nil {
+		return err
+	}
+	// Make sure batch cannot be used afterwards, unless it is reset. Callers should still call
+	// Close(), for errors.
+	b.wdb, b.written, b.ops, b.size = nil, b.wdb, nil, 0
+	return nil
+}
+
+// Reset implements Batch. The queued operations of a written batch are not reused.
+func (b *writeQueueDBBatch) Reset() error {
+	if b.wdb == nil {
+		if b.written == nil {
+			return errBatchClosed
+		}
+		b.wdb, b.written = b.written, nil
+	}
+	b.ops, b.size = nil, 0
+	return nil
+}
+
+// Close implements Batch.
+func (b *writeQueueDBBatch) Close() error {
+	b.wdb, b.written, b.ops, b.size = nil, nil, nil, 0
+	return nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteQueueDB(t *testing.T) {
+	wdb := NewWriteQueueDB(NewMemDB(), 0, 10)
+
+	key := bz("a")
+	require.NoError(t, wdb.Set(key, bz("1")))
+	// Keys and values are copied when queued.
+	key[0] = 'z'
+	require.NoError(t, wdb.Delete(bz("a")))
+	require.NoError(t, wdb.Set(bz("a"), bz("2")))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, wdb.Set(bz(fmt.Sprintf("key%03d", i)), bz("value")))
+	}
+	batch := wdb.NewBatch()
+	require.NoError(t, batch.Set(bz("b"), bz("batch")))
+	require.NoError(t, batch.Delete(bz("key000")))
+	require.Equal(t, 2, batch.Count())
+	require.NoError(t, batch.Write())
+	require.NoError(t, batch.Close())
+	require.ErrorIs(t, batch.Write(), errBatchClosed)
+
+	require.NoError(t, wdb.Flush())
+	require.Zero(t, wdb.QueueDepth())
+	checkValue(t, wdb, bz("a"), bz("2"))
+	checkValue(t, wdb, bz("z"), nil)
+	checkValue(t, wdb, bz("b"), bz("batch"))
+	checkValue(t, wdb, bz("key000"), nil)
+	checkValue(t, wdb, bz("key099"), bz("value"))
+
+	// Synced writes are visible once they return.
+	require.NoError(t, wdb.SetSync(bz("c"), bz("sync")))
+	checkValue(t, wdb, bz("c"), bz("sync"))
+	require.NoError(t, wdb.DeleteSync(bz("c")))
+	checkValue(t, wdb, bz("c"), nil)
+	batch = wdb.NewBatch()
+	require.NoError(t, batch.Set(bz("d"), bz("sync")))
+	require.NoError(t, batch.WriteSync())
+	checkValue(t, wdb, bz("d"), bz("sync"))
+	// Written batches can be reused once reset, without changing the queued operations.
+	require.NoError(t, batch.Reset())
+	require.NoError(t, batch.Set(bz("d"), bz("reset")))
+	require.NoError(t, batch.WriteSync())
+	checkValue(t, wdb, bz("d"), bz("reset"))
+
+	stats := wdb.Stats()
+	require.Equal(t, "0", stats["write_queue.depth"])
+	require.Equal(t, "1024", stats["write_queue.capacity"])
+	require.NotEqual(t, "0", stats["write_queue.batches"])
+
+	// Queued writes are written on Close.
+	require.NoError(t, wdb.Set(bz("e"), bz("last")))
+	inner := wdb.db
+	require.NoError(t, wdb.Close())
+	checkValue(t, inner, bz("e"), bz("last"))
+	require.ErrorIs(t, wdb.Set(bz("f"), bz("closed")), errWriteQueueClosed)
+}
+
+func TestWriteQueueDBBackpressure(t *testing.T) {
+	hdb := NewHookDB(NewMemDB())
+	release := make(chan struct{})
+	hdb.RegisterPreCommitHook(func([]BatchOp, Batch) error {
+		<-release
+		return nil
+	})
+	wdb := NewWriteQueueDB(hdb, 2, 1)
+	defer wdb.Close()
+
+	// The first write is taken by the committer, which blocks, and the next two fill the queue.
+	require.NoError(t, wdb.Set(bz("a"), bz("1")))
+	require.Eventually(t, func() bool { return wdb.QueueDepth() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, wdb.Set(bz("b"), bz("2")))
+	require.NoError(t, wdb.Set(bz("c"), bz("3")))
+	require.Equal(t, 2, wdb.QueueDepth())
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, wdb.RegisterMetrics("test", "index", reg))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+	require.Equal(t, "test_storage_write_queue_batches_total", families[0].GetName())
+	require.Equal(t, "test_storage_write_queue_depth", families[1].GetName())
+	require.EqualValues(t, 2, families[1].GetMetric()[0].GetGauge().GetValue())
+
+	// Writers block while the queue is full.
+	done := make(chan error)
+	go func() {
+		done <- wdb.Set(bz("d"), bz("4"))
+	}()
+	select {
+	case <-done:
+		t.Fatal("write did not block on a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, wdb.Flush())
+	checkValue(t, wdb, bz("d"), bz("4"))
+}
+
+func TestWriteQueueDBError(t *testing.T) {
+	hdb := NewHookDB(NewMemDB())
+	errWrite := errors.New("write failed")
+	hdb.RegisterPreCommitHook(func([]BatchOp, Batch) error {
+		return errWrite
+	})
+	wdb := NewWriteQueueDB(hdb, 0, 0)
+
+	// The failure of a queued write is returned by Flush and all subsequent writes.
+	require.NoError(t, wdb.Set(bz("a"), bz("1")))
+	require.ErrorIs(t, wdb.Flush(), errWrite)
+	require.ErrorIs(t, wdb.Set(bz("b"), bz("2")), errWrite)
+	require.ErrorIs(t, wdb.SetSync(bz("b"), bz("2")), errWrite)
+	require.ErrorIs(t, wdb.Err(), errWrite)
+	require.ErrorIs(t, wdb.Close(), errWrite)
+	checkValue(t, hdb, bz("a"), nil)
+}